@@ -4,31 +4,54 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"wechat-view/internal/acme"
 	"wechat-view/internal/api"
+	"wechat-view/internal/chatlog"
 	"wechat-view/internal/config"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/redact"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/usage"
+	"wechat-view/internal/vectors"
 )
 
 func main() {
 	var (
 		cfgPath = flag.String("config", "report.config.json", "配置文件路径（可选）")
+		profile = flag.String("profile", "", "配置 profile 名称（如 prod），覆盖公共配置")
 		dataDir = flag.String("data-dir", "", "原始聊天记录目录（默认读取配置文件）")
+		siteDir = flag.String("site-dir", "", "同时托管生成的静态站点目录（serve 模式，留空关闭）")
 		listen  = flag.String("listen", ":8080", "HTTP 监听地址")
+		pprofAt = flag.String("pprof", "", "pprof 调试监听地址（如 127.0.0.1:6060，留空关闭）")
+		metrics = flag.Bool("metrics", true, "在 /metrics 暴露 Prometheus 指标")
+		tlsCert = flag.String("tls-cert", "", "TLS 证书 PEM 文件（与 --tls-key 同时设置时启用 HTTPS 与 HTTP/2）")
+		tlsKey  = flag.String("tls-key", "", "TLS 私钥 PEM 文件")
+		acmeFor = flag.String("acme-host", "", "通过 Let's Encrypt 自动申请证书的域名，逗号分隔（覆盖 api.tls.acme.hosts）")
+		acmeTo  = flag.String("acme-email", "", "ACME 账户联系邮箱（覆盖 api.tls.acme.email）")
 	)
 	flag.Parse()
 
-	cfg, err := config.Load(*cfgPath)
+	cfg, err := config.LoadProfile(*cfgPath, *profile)
 	if err != nil {
 		log.Fatalf("读取配置失败: %v", err)
 	}
 	cfg.Defaults()
+	// 错误信息的语言在启动时确定，热更新不切换。
+	if err := i18n.Use(cfg.Report.Language); err != nil {
+		log.Fatalf("report.language 配置非法: %v", err)
+	}
 
 	resolvedDataDir := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
 	if _, err := os.Stat(resolvedDataDir); errors.Is(err, os.ErrNotExist) {
@@ -42,6 +65,38 @@ func main() {
 		log.Fatalf("初始化 API Server 失败: %v", err)
 	}
 
+	if *metrics {
+		apiServer.EnableMetrics()
+	}
+
+	if err := applyConfig(apiServer, cfg, resolvedDataDir, *listen, false); err != nil {
+		log.Fatal(err)
+	}
+
+	if *siteDir != "" {
+		opts := api.SiteOptions{
+			Dir:          *siteDir,
+			Watermark:    cfg.Report.Watermark.Enabled,
+			ViewerHeader: cfg.Report.Watermark.ViewerHeader,
+		}
+		if err := apiServer.MountSite(opts); err != nil {
+			log.Fatalf("挂载站点失败: %v", err)
+		}
+		log.Printf("托管静态站点 %s（水印：%v）", *siteDir, opts.Watermark)
+	}
+
+	if ec := cfg.API.Events; ec.Enabled {
+		dir := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+		err := apiServer.EnableEvents(api.EventOptions{
+			SiteDir:  dir,
+			Interval: time.Duration(ec.IntervalSeconds) * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("开启事件推送失败: %v", err)
+		}
+		log.Printf("已开启事件推送 /api/v1/events（监视 %s）", dir)
+	}
+
 	srv := &http.Server{
 		Addr:         *listen,
 		Handler:      apiServer,
@@ -50,27 +105,336 @@ func main() {
 		IdleTimeout:  90 * time.Second,
 	}
 
+	certFile := firstNonEmpty(*tlsCert, cfg.API.TLS.CertFile)
+	keyFile := firstNonEmpty(*tlsKey, cfg.API.TLS.KeyFile)
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("TLS 证书与私钥需要同时设置")
+	}
+	acmeCfg := cfg.API.TLS.ACME
+	if *acmeFor != "" {
+		acmeCfg.Hosts = splitList(*acmeFor)
+	}
+	acmeCfg.Email = firstNonEmpty(*acmeTo, acmeCfg.Email)
+	if certFile != "" && len(acmeCfg.Hosts) > 0 {
+		log.Fatal("TLS 证书文件与 ACME 自动证书只能二选一")
+	}
+	var challengeSrv *http.Server
+	if len(acmeCfg.Hosts) > 0 {
+		manager := &acme.Manager{
+			Hosts:        acmeCfg.Hosts,
+			Email:        acmeCfg.Email,
+			CacheDir:     firstNonEmpty(acmeCfg.CacheDir, filepath.Join(resolvedDataDir, "acme")),
+			DirectoryURL: acmeCfg.DirectoryURL,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		// CA 通过 80 端口的明文 HTTP 校验域名，其余请求跳转到 HTTPS。
+		challengeSrv = &http.Server{
+			Addr:         firstNonEmpty(acmeCfg.HTTPListen, ":80"),
+			Handler:      manager.HTTPHandler(nil),
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.Printf("ACME 校验服务监听 %s", challengeSrv.Addr)
+			if err := challengeSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("ACME 校验服务运行异常: %v", err)
+			}
+		}()
+		// 启动时即申请（或从缓存加载）证书，避免首个请求等待签发。
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			if _, err := manager.Ensure(ctx); err != nil {
+				log.Printf("警告: 申请 TLS 证书失败，将在下次握手时重试: %v", err)
+			}
+		}()
+	} else if certFile != "" {
+		certs, err := api.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("加载 TLS 证书失败: %v", err)
+		}
+		srv.TLSConfig = certs.TLSConfig()
+	} else if authCfg, _ := cfg.API.Auth.WithEnv(os.Getenv); authCfg.Enabled() {
+		log.Printf("警告: 未配置 TLS，凭据将以明文传输，请放在 HTTPS 反向代理之后")
+	}
+
 	go func() {
-		log.Printf("REST API 服务启动，监听 %s，数据目录 %s", *listen, resolvedDataDir)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		scheme := "HTTP"
+		if srv.TLSConfig != nil {
+			scheme = "HTTPS"
+		}
+		log.Printf("REST API 服务启动（%s），监听 %s，数据目录 %s", scheme, *listen, resolvedDataDir)
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("服务运行异常: %v", err)
 		}
 	}()
 
-	waitForSignal()
+	if *pprofAt != "" {
+		go servePprof(*pprofAt)
+	}
+
+	waitForSignal(func() { reloadConfig(apiServer, *cfgPath, *profile, resolvedDataDir, *listen) })
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("优雅关闭失败: %v", err)
 	}
+	if challengeSrv != nil {
+		_ = challengeSrv.Shutdown(ctx)
+	}
 	log.Println("服务已退出")
 }
 
-func waitForSignal() {
+// servePprof 在独立端口暴露 net/http/pprof，避免与业务接口混在一起对外暴露。
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Printf("pprof 已开启，监听 %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("pprof 服务异常: %v", err)
+	}
+}
+
+// applyConfig 按配置开启、更新或关闭鉴权、风险复核、跨域、语义搜索、限流与实时消息。启动时调用一次，
+// 收到 SIGHUP 时以 reload 为 true 再次调用。各项相互独立：某项校验失败时只有
+// 该项保持原状，其余各项照常应用，错误合并返回。鉴权最先应用，其他配置有误
+// 也不会耽误新的访问控制生效。
+func applyConfig(apiServer *api.Server, cfg config.Config, dataDir, listen string, reload bool) error {
+	errs := []error{
+		applyAuth(apiServer, cfg, listen),
+		applyRisk(apiServer, cfg, reload),
+		applyCORS(apiServer, cfg),
+		applySemanticSearch(apiServer, cfg, dataDir),
+		applyRateLimit(apiServer, cfg),
+		applyLive(apiServer, cfg, dataDir),
+	}
+	apiServer.SetDayCacheSize(cfg.API.DayCache)
+	return errors.Join(errs...)
+}
+
+// applyAuth 开启、更新或关闭访问鉴权。
+func applyAuth(apiServer *api.Server, cfg config.Config, listen string) error {
+	authCfg, err := cfg.API.Auth.WithEnv(os.Getenv)
+	if err != nil {
+		return fmt.Errorf("读取鉴权配置失败: %w", err)
+	}
+	if authCfg.Enabled() {
+		err := apiServer.EnableAuth(api.AuthOptions{
+			Tokens: authCfg.Tokens,
+			Users:  authCfg.Users,
+			Realm:  authCfg.Realm,
+			Public: authCfg.Public,
+		})
+		if err != nil {
+			return fmt.Errorf("初始化鉴权失败: %w", err)
+		}
+		log.Printf("已开启访问鉴权（%d 个令牌，%d 个账号）", len(authCfg.Tokens), len(authCfg.Users))
+	} else {
+		apiServer.DisableAuth()
+		log.Printf("警告: 未配置 api.auth，任何能访问 %s 的人都可以读取聊天记录", listen)
+	}
+	return nil
+}
+
+// applyRisk 开启或更新风险复核；关闭需要重启。
+func applyRisk(apiServer *api.Server, cfg config.Config, reload bool) error {
+	if len(cfg.Risk.Rules) > 0 {
+		detector, err := risk.Compile(cfg.Risk.Rules, cfg.Risk.Allow)
+		if err != nil {
+			return fmt.Errorf("风险规则无效: %w", err)
+		}
+		if err := apiServer.EnableRiskReview(detector); err != nil {
+			return fmt.Errorf("初始化风险复核失败: %w", err)
+		}
+		log.Printf("已开启风险消息复核（%d 条规则）", len(cfg.Risk.Rules))
+	} else if reload && apiServer.RiskReviewEnabled() {
+		log.Printf("提示: 配置中已没有风险规则，关闭风险复核需要重启服务")
+	}
+	return nil
+}
+
+// applyCORS 开启、更新或关闭跨域访问。
+func applyCORS(apiServer *api.Server, cfg config.Config) error {
+	if c := cfg.API.CORS; len(c.Origins) > 0 {
+		err := apiServer.EnableCORS(api.CORSOptions{
+			Origins: c.Origins,
+			Headers: c.Headers,
+			MaxAge:  time.Duration(c.MaxAgeSeconds) * time.Second,
+		})
+		if err != nil {
+			return fmt.Errorf("初始化跨域配置失败: %w", err)
+		}
+		log.Printf("已开启跨域访问: %s", strings.Join(c.Origins, ", "))
+	} else {
+		apiServer.DisableCORS()
+	}
+	return nil
+}
+
+// applySemanticSearch 按 llm.embeddings 开启语义搜索，配置了对话模型时
+// 同时开启问答助手。
+func applySemanticSearch(apiServer *api.Server, cfg config.Config, dataDir string) error {
+	if e := cfg.LLM.Embeddings; e.Enabled && e.SearchIndex {
+		// 与生成器共用 data/llm-usage.json，每次调用后立即写入。
+		meter := usage.NewMeter(filepath.Join(dataDir, usage.FileName), cfg.LLM.Pricing.Models, cfg.LLM.Pricing.Currency)
+		flushUsage := func() {
+			if _, err := meter.Flush(); err != nil {
+				log.Printf("记录 LLM 用量失败: %v", err)
+			}
+		}
+		client := insight.Client{
+			BaseURL: firstNonEmpty(e.BaseURL, cfg.LLM.BaseURL),
+			Model:   e.Model,
+			APIKey:  firstNonEmpty(e.APIKey, cfg.LLM.APIKey),
+			Timeout: time.Duration(cfg.LLM.TimeoutSeconds) * time.Second,
+			Meter:   meter,
+		}
+		if cfg.LLM.Scrub.Enabled {
+			scrub, err := insight.NewScrubber(cfg.LLM.Scrub.Patterns)
+			if err != nil {
+				return fmt.Errorf("llm.scrub 规则无效: %w", err)
+			}
+			client.Scrub = scrub
+		}
+		embed := func(ctx context.Context, text string) ([]float64, error) {
+			defer flushUsage()
+			vecs, err := client.Embed(ctx, []string{text})
+			if err != nil {
+				return nil, err
+			}
+			return vecs[0], nil
+		}
+		if err := apiServer.EnableSemanticSearch(embed, e.Model); err != nil {
+			return fmt.Errorf("初始化语义搜索失败: %w", err)
+		}
+		log.Printf("已开启语义搜索（模型 %s）", e.Model)
+
+		if cfg.LLM.Enabled && cfg.LLM.BaseURL != "" && cfg.LLM.Model != "" {
+			chat := insight.Client{
+				BaseURL:     cfg.LLM.BaseURL,
+				Model:       cfg.LLM.Model,
+				APIKey:      cfg.LLM.APIKey,
+				Temperature: cfg.LLM.Temperature,
+				Timeout:     time.Duration(cfg.LLM.TimeoutSeconds) * time.Second,
+				Scrub:       client.Scrub,
+				Meter:       meter,
+			}
+			answer := func(ctx context.Context, question string, hits []vectors.Hit, delta func(string)) (string, error) {
+				sources := make([]insight.Source, len(hits))
+				for i, h := range hits {
+					sources[i] = insight.Source{Date: h.Date, Sender: h.Sender, Time: h.Time, Text: h.Text}
+				}
+				defer flushUsage()
+				return chat.Answer(ctx, question, sources, delta)
+			}
+			if err := apiServer.EnableAssistant(answer); err != nil {
+				return fmt.Errorf("初始化问答助手失败: %w", err)
+			}
+			log.Printf("已开启问答助手 /api/v1/ask（模型 %s）", cfg.LLM.Model)
+		}
+	}
+	return nil
+}
+
+// applyRateLimit 开启、更新或关闭按 IP 限流。
+func applyRateLimit(apiServer *api.Server, cfg config.Config) error {
+	if rl := cfg.API.RateLimit; rl.RequestsPerSecond > 0 {
+		err := apiServer.EnableRateLimit(api.RateLimitOptions{
+			Rate:       rl.RequestsPerSecond,
+			Burst:      rl.Burst,
+			TrustProxy: rl.TrustProxy,
+			Exempt:     rl.Exempt,
+		})
+		if err != nil {
+			return fmt.Errorf("初始化限流失败: %w", err)
+		}
+		log.Printf("已开启按 IP 限流（每秒 %g 次）", rl.RequestsPerSecond)
+	} else {
+		apiServer.DisableRateLimit()
+	}
+	return nil
+}
+
+// applyLive 开启、更新或关闭实时消息。
+func applyLive(apiServer *api.Server, cfg config.Config, dataDir string) error {
+	if lc := cfg.API.Live; lc.Enabled {
+		client := chatlog.Client{
+			BaseURL: cfg.Chatlog.BaseURL,
+			HTTP:    &http.Client{Timeout: 30 * time.Second},
+		}
+		if cfg.Chatlog.MaxResponseMB > 0 {
+			client.MaxResponseBytes = int64(cfg.Chatlog.MaxResponseMB) << 20
+		}
+		opts := api.LiveOptions{
+			Fetch: func(ctx context.Context, day, talker string) ([]chatlog.Message, error) {
+				msgs, _, err := client.FetchReportDayContext(ctx, day, cfg.Report.DayStartHour, talker, cfg.Chatlog.Keyword)
+				return msgs, err
+			},
+			DayStartHour: cfg.Report.DayStartHour,
+			Talkers:      lc.Talkers,
+			Interval:     time.Duration(lc.IntervalSeconds) * time.Second,
+			Backlog:      lc.Backlog,
+		}
+		if len(opts.Talkers) == 0 {
+			opts.Talkers = cfg.TalkerIDs()
+		}
+		if cfg.Report.Anonymize {
+			// 与站点使用同一份化名；新出现的成员只在内存中分配，不写回文件。
+			anon, err := redact.Open(filepath.Join(dataDir, "pseudonyms.json"))
+			if err != nil {
+				return fmt.Errorf("读取化名失败: %w", err)
+			}
+			opts.Filter = anon.Messages
+		}
+		if err := apiServer.EnableLive(opts); err != nil {
+			return fmt.Errorf("初始化实时消息失败: %w", err)
+		}
+		log.Printf("已开启实时消息 /api/v1/live（%s）", strings.Join(opts.Talkers, ", "))
+	} else {
+		apiServer.DisableLive()
+	}
+	return nil
+}
+
+// reloadConfig 重新读取配置文件并应用可热更新的部分；读取失败时沿用原配置。
+// 监听地址、目录、TLS 证书路径、指标与水印仍需重启才能生效。
+func reloadConfig(apiServer *api.Server, cfgPath, profile, dataDir, listen string) {
+	log.Printf("收到 SIGHUP，重新加载配置 %s", cfgPath)
+	cfg, err := config.LoadProfile(cfgPath, profile)
+	if err != nil {
+		log.Printf("重新加载配置失败，继续使用原配置: %v", err)
+		return
+	}
+	cfg.Defaults()
+	if err := applyConfig(apiServer, cfg, dataDir, listen, true); err != nil {
+		log.Printf("重新加载配置失败，部分设置保持原状: %v", err)
+		return
+	}
+	log.Printf("配置已重新加载")
+}
+
+// waitForSignal 阻塞到收到 SIGINT 或 SIGTERM；每次收到 SIGHUP 调用 reload，
+// 进行中的请求不受影响。
+func waitForSignal(reload func()) {
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-	<-ch
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range ch {
+		if sig != syscall.SIGHUP {
+			return
+		}
+		reload()
+	}
 }
 
 func firstNonEmpty(vals ...string) string {
@@ -81,3 +445,14 @@ func firstNonEmpty(vals ...string) string {
 	}
 	return ""
 }
+
+// splitList 拆分逗号分隔的命令行参数，忽略空项。
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/insight"
+)
+
+// runABTest compares the LLM arms archived by llm.compare across the
+// rendered days, to help choose a model and prompt.
+func runABTest(args []string) {
+	fs := flag.NewFlagSet("abtest", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	from := fs.String("from", "", "First day to include, YYYY-MM-DD (default: oldest raw file)")
+	to := fs.String("to", "", "Last day to include, YYYY-MM-DD (default: newest raw file)")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON")
+	_ = fs.Parse(args)
+
+	for _, d := range []string{*from, *to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			log.Fatalf("invalid date %q, expect YYYY-MM-DD", d)
+		}
+	}
+	cfg := loadConfig(*cfgPath, *profile)
+	data := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	site := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	days, err := archive.ListDays(data)
+	if err != nil {
+		log.Fatalf("list raw days failed: %v", err)
+	}
+	var compared [][]insight.Variant
+	for _, day := range days {
+		if (*from != "" && day < *from) || (*to != "" && day > *to) {
+			continue
+		}
+		meta, err := archive.LoadMeta(site, day)
+		if err != nil || len(meta.AIVariants) < 2 {
+			continue
+		}
+		compared = append(compared, meta.AIVariants)
+	}
+	if len(compared) == 0 {
+		log.Fatalf("no A/B results under %s; enable llm.compare and generate some days first", site)
+	}
+	stats := insight.Tally(compared)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"days": len(compared), "arms": stats}); err != nil {
+			log.Fatalf("write statistics failed: %v", err)
+		}
+		return
+	}
+	fmt.Printf("%d day(s) compared\n\n", len(compared))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARM\tMODEL\tPROMPT\tDAYS\tFAILED\tAVG SCORE\tWINS\tTIES\tAVG LATENCY")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.1f\t%d\t%d\t%dms\n",
+			s.Label, s.Model, s.Prompt, s.Days, s.Failures, s.AvgScore, s.Wins, s.Ties, s.AvgLatencyMS)
+	}
+	tw.Flush()
+}
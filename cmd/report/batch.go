@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"wechat-view/internal/archive"
+)
+
+// batchTask is one unit of batch work, such as fetching one day.
+type batchTask struct {
+	name string
+	run  func() error
+}
+
+// batchResult is how a batchTask went.
+type batchResult struct {
+	name string
+	err  error
+	took time.Duration
+}
+
+// runPool runs tasks on at most workers goroutines and returns their results
+// in task order. A failing or panicking task is recorded and the others go
+// on.
+func runPool(workers int, tasks []batchTask) []batchResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]batchResult, len(tasks))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(tasks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = runTask(tasks[i])
+			}
+		}()
+	}
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func runTask(t batchTask) (res batchResult) {
+	start := time.Now()
+	res.name = t.name
+	defer func() {
+		if p := recover(); p != nil {
+			res.err = fmt.Errorf("panic: %v", p)
+		}
+		res.took = time.Since(start)
+	}()
+	res.err = t.run()
+	return res
+}
+
+// logBatch prints one line per failure and a closing tally for the stage
+// named what, and returns the names that failed.
+func logBatch(what string, results []batchResult, verbose bool) []string {
+	var failed []string
+	var took time.Duration
+	for _, r := range results {
+		took += r.took
+		if r.err != nil {
+			failed = append(failed, r.name)
+			log.Printf("%s %s failed: %v", what, r.name, r.err)
+		} else if verbose {
+			log.Printf("%s %s done in %s", what, r.name, r.took.Round(time.Millisecond))
+		}
+	}
+	if len(results) > 0 {
+		log.Printf("%s: %d succeeded, %d failed (%s of work)", what, len(results)-len(failed), len(failed), took.Round(time.Millisecond))
+	}
+	return failed
+}
+
+// runRange fetches and renders every day from..to (inclusive) and rebuilds
+// the site once. Fetching and media archiving run on workers goroutines;
+// rendering goes day by day in date order, because each day reads the
+// previous days' reports (membership totals, escalated questions). A failed
+// day is reported and skipped rather than stopping the batch; the exit code
+// is 1 when anything failed.
+func (g *generator) runRange(from, to string, force bool, workers int) int {
+	days, err := archive.Window(to, dayCount(from, to))
+	if err != nil {
+		log.Printf("invalid date range: %v", err)
+		return 2
+	}
+	var fetches []batchTask
+	for _, day := range days {
+		if archive.HasRaw(g.opts.dataDir, day) && !force {
+			continue
+		}
+		day := day
+		fetches = append(fetches, batchTask{name: day, run: func() error {
+			if _, err := g.fetch(day); err != nil {
+				return err
+			}
+			g.archiveMedia(day)
+			return nil
+		}})
+	}
+	if g.verbose {
+		log.Printf("Fetching %d of %d day(s) with %d worker(s)", len(fetches), len(days), workers)
+	}
+	fetchFailed := logBatch("fetch", runPool(workers, fetches), g.verbose)
+	skip := map[string]bool{}
+	for _, day := range fetchFailed {
+		skip[day] = true
+	}
+
+	code := 0
+	var renders []batchResult
+	for _, day := range days {
+		if skip[day] || !archive.HasRaw(g.opts.dataDir, day) {
+			continue
+		}
+		// A full or unwritable disk fails every later day too.
+		if err := g.checkDisk(); err != nil {
+			log.Printf("stopped before rendering %s: %v", day, err)
+			code = 1
+			break
+		}
+		day := day
+		renders = append(renders, runTask(batchTask{name: day, run: func() error {
+			_, err := g.render(day)
+			return err
+		}}))
+	}
+	renderFailed := logBatch("render", renders, g.verbose)
+	g.flushUsage()
+
+	if err := g.updateSite(); err != nil {
+		log.Printf("update site failed: %v", err)
+		code = 1
+	}
+	g.publish(from + ".." + to)
+	if len(fetchFailed)+len(renderFailed) > 0 {
+		sort.Strings(fetchFailed)
+		log.Printf("Batch %s..%s finished with failures; fetch: %v, render: %v", from, to, fetchFailed, renderFailed)
+		code = 1
+	}
+	return code
+}
+
+// dayCount is how many days from..to spans, inclusive; both are valid
+// YYYY-MM-DD dates.
+func dayCount(from, to string) int {
+	f, _ := time.Parse("2006-01-02", from)
+	t, _ := time.Parse("2006-01-02", to)
+	return int(t.Sub(f).Hours()/24) + 1
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/config"
+	"wechat-view/internal/demo"
+	"wechat-view/internal/media"
+	"wechat-view/internal/tags"
+	"wechat-view/internal/testkit"
+)
+
+func TestRunPool(t *testing.T) {
+	cases := []struct {
+		name    string
+		workers int
+		tasks   int
+		panicAt int // index of a panicking task, -1 for none
+		failAt  int // index of a failing task, -1 for none
+	}{
+		{"more tasks than workers", 3, 10, -1, -1},
+		{"more workers than tasks", 8, 3, -1, -1},
+		{"zero workers run serially", 0, 4, -1, -1},
+		{"negative workers run serially", -2, 4, -1, -1},
+		{"no tasks", 4, 0, -1, -1},
+		{"panicking task", 2, 5, 1, -1},
+		{"failing task", 2, 5, -1, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var running, peak, ran atomic.Int32
+			tasks := make([]batchTask, c.tasks)
+			for i := range tasks {
+				i := i
+				tasks[i] = batchTask{name: fmt.Sprintf("t%d", i), run: func() error {
+					ran.Add(1)
+					n := running.Add(1)
+					defer running.Add(-1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					// Later tasks finish first, so results arrive out of order.
+					time.Sleep(time.Duration(c.tasks-i) * time.Millisecond)
+					switch i {
+					case c.panicAt:
+						panic("boom")
+					case c.failAt:
+						return errors.New("bad day")
+					}
+					return nil
+				}}
+			}
+			results := runPool(c.workers, tasks)
+			if len(results) != c.tasks || int(ran.Load()) != c.tasks {
+				t.Fatalf("%d results, %d tasks ran, want %d", len(results), ran.Load(), c.tasks)
+			}
+			limit := c.workers
+			if limit < 1 {
+				limit = 1
+			}
+			if int(peak.Load()) > limit {
+				t.Fatalf("%d tasks ran at once, workers %d", peak.Load(), c.workers)
+			}
+			for i, r := range results {
+				if r.name != fmt.Sprintf("t%d", i) {
+					t.Fatalf("result %d is %s, want task order", i, r.name)
+				}
+				switch {
+				case i == c.panicAt:
+					if r.err == nil || !strings.Contains(r.err.Error(), "panic: boom") {
+						t.Fatalf("panic not recorded: %v", r.err)
+					}
+				case i == c.failAt:
+					if r.err == nil || r.err.Error() != "bad day" {
+						t.Fatalf("failure not recorded: %v", r.err)
+					}
+				case r.err != nil:
+					t.Fatalf("task %d: %v", i, r.err)
+				}
+				if r.took <= 0 {
+					t.Fatalf("task %d has no duration", i)
+				}
+			}
+		})
+	}
+}
+
+// newBatchGenerator returns a generator over temp dirs that fetches from
+// chat and downloads images from img.
+func newBatchGenerator(t *testing.T, chat *testkit.ChatlogServer, img string) *generator {
+	t.Helper()
+	var cfg config.Config
+	cfg.Tags = demo.Tags
+	cfg.Defaults()
+	cfg.Report.PDF.Enabled = false
+	cfg.Report.Media.Download = true
+	tagger, err := tags.Compile(cfg.Tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder, err := summaryBuilder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := resolvedOptions{
+		baseURL:    chat.URL,
+		imageBase:  img,
+		talker:     demo.Talker,
+		dataDir:    filepath.Join(t.TempDir(), "data"),
+		siteDir:    filepath.Join(t.TempDir(), "site"),
+		recentDays: cfg.Report.RecentDays,
+		messageCap: cfg.Report.MessagePreview,
+	}
+	return &generator{cfg: cfg, opts: opts, tagger: tagger, builder: builder, noPublish: true}
+}
+
+// imageDay is a chatlog response for day with tagged text and n images.
+func imageDay(t *testing.T, day string, n int) []byte {
+	t.Helper()
+	at, _ := time.ParseInLocation("2006-01-02 15:04", day+" 09:00", time.Local)
+	recs := []map[string]any{{
+		"time": at.Format(time.RFC3339), "talker": demo.Talker, "sender": "wxid_a", "senderName": "阿强",
+		"type": 1, "content": "线上服务挂了，谁在看？",
+	}}
+	for i := 0; i < n; i++ {
+		recs = append(recs, map[string]any{
+			"time": at.Add(time.Duration(i+1) * time.Minute).Format(time.RFC3339), "talker": demo.Talker,
+			"sender": "wxid_b", "senderName": "小美", "type": 3, "content": "[图片]",
+			"contents": map[string]any{"md5": fmt.Sprintf("%s%02d", strings.ReplaceAll(day, "-", ""), i), "path": `msg\attach\x.dat`},
+		})
+	}
+	b, err := json.Marshal(recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRunRangeIsolatesFailingDay(t *testing.T) {
+	chat := testkit.NewChatlogServer()
+	defer chat.Close()
+	var images atomic.Int32
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	img := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		images.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer img.Close()
+
+	days := []string{"2001-03-01", "2001-03-02", "2001-03-03", "2001-03-04", "2001-03-05"}
+	for _, day := range days {
+		chat.SetDay(day, imageDay(t, day, 3))
+	}
+	chat.SetDay("2001-03-03", []byte(testkit.MalformedJSON))
+	g := newBatchGenerator(t, chat, img.URL)
+
+	// Four workers fetch, tag and download media at once; go test -race
+	// checks they share nothing unsafely.
+	if code := g.runRange(days[0], days[len(days)-1], false, 4); code != 1 {
+		t.Fatalf("exit code %d, want 1", code)
+	}
+	for _, day := range days {
+		_, err := os.Stat(filepath.Join(archive.DayDir(g.opts.siteDir, day), "meta.json"))
+		if day == "2001-03-03" {
+			if err == nil || archive.HasRaw(g.opts.dataDir, day) {
+				t.Fatalf("failed day %s was stored or rendered", day)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s not rendered: %v", day, err)
+		}
+		raw, err := archive.LoadRaw(g.opts.dataDir, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := raw.Messages[0].Tags; len(got) == 0 {
+			t.Fatalf("%s not tagged: %+v", day, raw.Messages[0])
+		}
+		for _, m := range raw.Messages[1:] {
+			if _, ok := media.Find(filepath.Join(g.opts.dataDir, "media"), day, m.MediaMD5); !ok {
+				t.Fatalf("%s image %s not downloaded", day, m.MediaMD5)
+			}
+		}
+	}
+	if n := images.Load(); n != 12 {
+		t.Fatalf("%d image requests, want 12", n)
+	}
+
+	// A second run skips stored days and only retries the failed one.
+	chat.SetDay("2001-03-03", imageDay(t, "2001-03-03", 1))
+	before := chat.Requests()
+	if code := g.runRange(days[0], days[len(days)-1], false, 4); code != 0 {
+		t.Fatalf("retry exit code %d, want 0", code)
+	}
+	if n := chat.Requests() - before; n != 1 {
+		t.Fatalf("retry fetched %d day(s), want 1", n)
+	}
+}
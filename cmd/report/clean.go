@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// cacheDir holds regenerable state (the release check cache) that is safe
+// to delete at any time.
+func cacheDir(dataDir string) string {
+	return filepath.Join(dataDir, ".cache")
+}
+
+// sweepTempFiles removes temp files that earlier runs left behind when they
+// crashed or were killed mid-write. Files younger than
+// atomicfile.StaleAfter are kept, as another run may still be writing them.
+func sweepTempFiles(verbose bool, dirs ...string) {
+	for _, dir := range dirs {
+		res, err := atomicfile.Sweep(dir, atomicfile.StaleAfter)
+		if err != nil {
+			log.Printf("warning: sweep temp files in %s: %v", dir, err)
+			continue
+		}
+		if res.Files > 0 || verbose {
+			log.Printf("Removed %d stale temp file(s) (%s) from %s", res.Files, byteCount(res.Bytes), dir)
+		}
+	}
+}
+
+// runClean removes temp files from the data and site directories, and with
+// --cache also the build cache.
+func runClean(args []string) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	olderThan := fs.Duration("older-than", 0, "Only remove temp files older than this (e.g. 1h); 0 removes all, so stop running reports first")
+	cache := fs.Bool("cache", false, "Also remove the build cache under <data-dir>/.cache")
+	_ = fs.Parse(args)
+
+	cfg := loadConfig(*cfgPath, *profile)
+	data := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	site := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+
+	var total atomicfile.SweepResult
+	for _, dir := range []string{data, site} {
+		res, err := atomicfile.Sweep(dir, *olderThan)
+		if err != nil {
+			log.Fatalf("clean %s failed: %v", dir, err)
+		}
+		total.Files += res.Files
+		total.Bytes += res.Bytes
+	}
+	log.Printf("Removed %d temp file(s), %s", total.Files, byteCount(total.Bytes))
+
+	if *cache {
+		dir := cacheDir(data)
+		size := dirSize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			log.Fatalf("remove build cache failed: %v", err)
+		}
+		log.Printf("Removed build cache %s (%s)", dir, byteCount(size))
+	}
+}
+
+func dirSize(dir string) int64 {
+	var n int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			n += info.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// byteCount renders n as B, KB or MB for log lines.
+func byteCount(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
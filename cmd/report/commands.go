@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/config"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/members"
+	"wechat-view/internal/redact"
+	"wechat-view/internal/render"
+	"wechat-view/internal/watermark"
+)
+
+// subcommands are dispatched on the first argument; anything else falls
+// through to the default daily generation flow.
+var subcommands = map[string]func(args []string){
+	"abtest":          runABTest,
+	"clean":           runClean,
+	"daemon":          runDaemon,
+	"demo":            runDemo,
+	"e2e":             runE2E,
+	"export":          runExport,
+	"members":         runMembers,
+	"publish":         runPublish,
+	"recalc":          runRecalc,
+	"retention":       runRetention,
+	"service":         runService,
+	"sync":            runSync,
+	"validate-config": runValidateConfig,
+	"watermark":       runWatermark,
+}
+
+// loadConfig loads the config file with an optional profile and applies
+// defaults, exiting on error like the main flow does.
+func loadConfig(path, profile string) config.Config {
+	cfg, err := config.LoadProfile(path, profile)
+	if err != nil {
+		log.Fatalf("load config failed: %v", err)
+	}
+	cfg.Defaults()
+	useTemplates(cfg)
+	return cfg
+}
+
+// useTemplates switches rendering to report.templatesDir, if set, and
+// to the report.language catalog.
+func useTemplates(cfg config.Config) {
+	if err := render.UseTemplatesDir(cfg.Report.TemplatesDir); err != nil {
+		log.Fatalf("invalid report.templatesDir: %v", err)
+	}
+	if err := i18n.Use(cfg.Report.Language); err != nil {
+		log.Fatalf("invalid report.language: %v", err)
+	}
+}
+
+func memberOptions(cfg config.Config) members.Options {
+	return members.Options{
+		SilentDays:    cfg.Report.Members.SilentDays,
+		MinActiveDays: cfg.Report.Members.MinActiveDays,
+	}
+}
+
+// openRedactor loads the pseudonyms kept in dataDir for report.anonymize.
+func openRedactor(dataDir string) (*redact.Redactor, error) {
+	r, err := redact.Open(filepath.Join(dataDir, "pseudonyms.json"))
+	if err != nil {
+		return nil, fmt.Errorf("load pseudonyms failed: %w", err)
+	}
+	return r, nil
+}
+
+// runMembers rebuilds the monthly member lifecycle pages from all raw data,
+// regardless of report.members.enabled.
+func runMembers(args []string) {
+	fs := flag.NewFlagSet("members", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	silent := fs.Int("silent-days", 0, "Days without messages before a regular member is at risk (overrides config)")
+	_ = fs.Parse(args)
+
+	cfg := loadConfig(*cfgPath, *profile)
+	opts := memberOptions(cfg)
+	if *silent > 0 {
+		opts.SilentDays = *silent
+	}
+	site := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	data := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	var anon *redact.Redactor
+	if cfg.Report.Anonymize {
+		r, err := openRedactor(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		anon = r
+	}
+	if err := render.UpdateMemberReports(site, data, opts, anon); err != nil {
+		log.Fatalf("update member reports failed: %v", err)
+	}
+	if err := anon.Save(); err != nil {
+		log.Printf("warning: save pseudonyms failed: %v", err)
+	}
+	if err := render.UpdateHomeIndex(site, data, cfg.Report.RecentDays); err != nil {
+		log.Fatalf("update home index failed: %v", err)
+	}
+	log.Printf("Generated member reports under %s", site)
+}
+
+// runWatermark prints the provenance marks hidden in the given files (or
+// stdin), e.g. text pasted from a leaked page.
+func runWatermark(args []string) {
+	fs := flag.NewFlagSet("watermark", flag.ExitOnError)
+	_ = fs.Parse(args)
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	found := 0
+	for _, name := range inputs {
+		var b []byte
+		var err error
+		if name == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(name)
+		}
+		if err != nil {
+			log.Fatalf("read %s failed: %v", name, err)
+		}
+		for _, payload := range watermark.Decode(string(b)) {
+			m := watermark.ParseMark(payload)
+			when := ""
+			if !m.Time.IsZero() {
+				when = m.Time.Local().Format(time.RFC3339)
+			}
+			fmt.Printf("%s\tviewer=%s\tsource=%s\ttime=%s\n", name, m.Viewer, m.Source, when)
+			found++
+		}
+	}
+	if found == 0 {
+		log.Printf("no watermark found")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"wechat-view/internal/config"
+)
+
+// runDaemon stays in the foreground and generates yesterday's report once a
+// day at --at (local time). Each run is a child process of this binary so a
+// failing day cannot take the daemon down, and so it reads the current
+// config; SIGHUP re-checks the config and picks up a changed daemon.at.
+// With --service it runs as the Windows service "report service install"
+// registered, stopping when the service is stopped.
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	at := fs.String("at", "", "Daily run time HH:MM in local time (overrides config daemon.at, default 08:00)")
+	runNow := fs.Bool("run-now", false, "Also generate once immediately on start")
+	verbose := fs.Bool("v", false, "Verbose logging in each run")
+	asService := fs.Bool("service", false, "Run under the Windows service control manager (set by service install)")
+	workDir := fs.String("workdir", "", "Change to this directory first; Windows services start in System32")
+	logFile := fs.String("log-file", "", "Append the daemon's and each run's output to this file")
+	_ = fs.Parse(args)
+
+	if *workDir != "" {
+		if err := os.Chdir(*workDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		// Runs inherit os.Stdout and os.Stderr, see runOnce.
+		os.Stdout, os.Stderr = f, f
+		log.SetOutput(f)
+	}
+
+	cfg := loadConfig(*cfgPath, *profile)
+	hour, minute, err := parseClock(firstNonEmpty(*at, cfg.Daemon.At, "08:00"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	startHour := cfg.Report.DayStartHour
+	runArgs := []string{"--config", *cfgPath}
+	if *profile != "" {
+		runArgs = append(runArgs, "--profile", *profile)
+	}
+	if *verbose {
+		runArgs = append(runArgs, "-v")
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	loop := func() {
+		if *runNow {
+			runOnce(runArgs, startHour)
+		}
+		for {
+			next := nextRun(time.Now(), hour, minute)
+			log.Printf("Next report run at %s", next.Format("2006-01-02 15:04"))
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				log.Printf("Daemon stopped")
+				return
+			case <-reload:
+				timer.Stop()
+				hour, minute, startHour = reloadDaemon(*cfgPath, *profile, *at, hour, minute, startHour)
+			case <-timer.C:
+				runOnce(runArgs, startHour)
+			}
+		}
+	}
+	if *asService {
+		if err := serveWindowsService(serviceName, stop, loop); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	loop()
+}
+
+// reloadDaemon re-reads the config on SIGHUP and returns the run time and
+// report.dayStartHour to use from now on. Runs read the config afresh
+// anyway, so this only checks it is still valid and picks up a new
+// daemon.at and day boundary; on errors the old values are kept.
+func reloadDaemon(cfgPath, profile, at string, hour, minute, startHour int) (int, int, int) {
+	cfg, err := config.LoadProfile(cfgPath, profile)
+	if err != nil {
+		log.Printf("warning: reload config failed, keeping the previous one: %v", err)
+		return hour, minute, startHour
+	}
+	cfg.Defaults()
+	h, m, err := parseClock(firstNonEmpty(at, cfg.Daemon.At, "08:00"))
+	if err != nil {
+		log.Printf("warning: reload config failed, keeping the previous run time: %v", err)
+		return hour, minute, startHour
+	}
+	log.Printf("Config reloaded; the next run uses it")
+	return h, m, cfg.Report.DayStartHour
+}
+
+// runOnce generates yesterday's report by re-executing this binary;
+// startHour is report.dayStartHour, see reportDay.
+func runOnce(args []string, startHour int) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("warning: locate executable: %v", err)
+		return
+	}
+	day := reportDay(time.Now(), startHour)
+	cmd := exec.Command(exe, append(args, "--date", day)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		log.Printf("warning: report for %s failed: %v", day, err)
+		return
+	}
+	log.Printf("Report for %s done in %s", day, time.Since(start).Round(time.Second))
+}
+
+func parseClock(s string) (int, int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expect HH:MM", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// nextRun returns the first hour:minute strictly after now. Tomorrow's run is
+// built from the calendar date rather than by adding a day to today's, so a
+// time skipped by a DST change today does not shift later runs.
+func nextRun(now time.Time, hour, minute int) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseClock(t *testing.T) {
+	cases := []struct {
+		in           string
+		hour, minute int
+		ok           bool
+	}{
+		{"08:00", 8, 0, true},
+		{"00:00", 0, 0, true},
+		{"23:59", 23, 59, true},
+		{"7:05", 7, 5, true},
+		{"24:00", 0, 0, false},
+		{"12:60", 0, 0, false},
+		{"08:00:00", 0, 0, false},
+		{"8am", 0, 0, false},
+		{" 08:00", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, c := range cases {
+		h, m, err := parseClock(c.in)
+		if (err == nil) != c.ok {
+			t.Errorf("parseClock(%q) err = %v, want ok=%v", c.in, err, c.ok)
+			continue
+		}
+		if c.ok && (h != c.hour || m != c.minute) {
+			t.Errorf("parseClock(%q) = %d:%d, want %d:%d", c.in, h, m, c.hour, c.minute)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	local := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04 MST", s, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		name         string
+		now          time.Time
+		hour, minute int
+		want         time.Time
+	}{
+		{"later today", utc("2025-10-16 07:59"), 8, 0, utc("2025-10-16 08:00")},
+		{"exactly now runs tomorrow", utc("2025-10-16 08:00"), 8, 0, utc("2025-10-17 08:00")},
+		{"already passed", utc("2025-10-16 08:01"), 8, 0, utc("2025-10-17 08:00")},
+		{"midnight", utc("2025-10-16 23:59"), 0, 0, utc("2025-10-17 00:00")},
+		{"month end", utc("2025-10-31 09:00"), 8, 0, utc("2025-11-01 08:00")},
+		{"year end", utc("2025-12-31 23:30"), 8, 0, utc("2026-01-01 08:00")},
+		{"leap day", utc("2028-02-28 09:00"), 8, 0, utc("2028-02-29 08:00")},
+		// 2025-03-09 02:30 does not exist in New York: that day's run
+		// falls back to 01:30 EST, and the next day's is at 02:30 again.
+		{"skipped by DST today", local("2025-03-09 01:00 EST"), 2, 30, local("2025-03-09 01:30 EST")},
+		{"after a skipped time", local("2025-03-09 04:00 EDT"), 2, 30, local("2025-03-10 02:30 EDT")},
+		// 2025-11-02 01:30 happens twice; the daemon runs on the first.
+		{"repeated by DST", local("2025-11-02 00:30 EDT"), 1, 30, local("2025-11-02 01:30 EDT")},
+		{"during the repeat", local("2025-11-02 01:45 EST"), 1, 30, local("2025-11-03 01:30 EST")},
+	}
+	for _, c := range cases {
+		if got := nextRun(c.now, c.hour, c.minute); !got.Equal(c.want) {
+			t.Errorf("%s: nextRun(%s, %02d:%02d) = %s, want %s", c.name, c.now, c.hour, c.minute, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/config"
+	"wechat-view/internal/demo"
+	"wechat-view/internal/tags"
+)
+
+// runDemo renders a complete example site from built-in synthetic chat data,
+// without a chatlog service or config file.
+func runDemo(args []string) {
+	fs := flag.NewFlagSet("demo", flag.ExitOnError)
+	out := fs.String("out", "demo", "Output directory; data/ and site/ are created inside")
+	days := fs.Int("days", 14, "Number of days of demo chat to generate")
+	verbose := fs.Bool("v", false, "Verbose logging")
+	_ = fs.Parse(args)
+
+	var cfg config.Config
+	cfg.Tags = demo.Tags
+	cfg.Summarize.Tokenizer = "dict"
+	cfg.Report.Members.Enabled = true
+	cfg.Chatlog.TalkerName = demo.TalkerName
+	cfg.Defaults()
+
+	opts := resolvedOptions{
+		talker:      demo.Talker,
+		talkerLabel: demo.TalkerName,
+		dataDir:     filepath.Join(*out, "data"),
+		siteDir:     filepath.Join(*out, "site"),
+		recentDays:  cfg.Report.RecentDays,
+		messageCap:  cfg.Report.MessagePreview,
+	}
+	mustMkdirAll(opts.dataDir)
+	mustMkdirAll(opts.siteDir)
+
+	tagger, err := tags.Compile(cfg.Tags)
+	if err != nil {
+		log.Fatalf("invalid demo tag rules: %v", err)
+	}
+	builder, err := summaryBuilder(cfg)
+	if err != nil {
+		log.Fatalf("init summarizer failed: %v", err)
+	}
+	g := &generator{cfg: cfg, opts: opts, tagger: tagger, builder: builder, verbose: *verbose}
+
+	for _, day := range demo.Days(time.Now().AddDate(0, 0, -1), *days) {
+		body, err := demo.Day(day)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msgs, meta, err := chatlog.Client{}.Decode(bytes.NewReader(body))
+		if err != nil {
+			log.Fatalf("decode demo data failed: %v", err)
+		}
+		if _, err := g.store(day, msgs, meta); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := g.render(day); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := g.updateSite(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Demo site ready: open %s", filepath.Join(opts.siteDir, "index.html"))
+}
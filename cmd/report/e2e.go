@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/config"
+	"wechat-view/internal/demo"
+	"wechat-view/internal/tags"
+	"wechat-view/internal/testkit"
+	"wechat-view/internal/vectors"
+)
+
+// e2eCheck is one step of the self-test; steps run in order and share the
+// generator and fake servers.
+type e2eCheck struct {
+	name string
+	run  func() error
+}
+
+// runE2E runs the whole pipeline against fake chatlog and LLM servers, with
+// injected failures, so users can verify a new version (and their config)
+// before upgrading. It exits 1 when any check fails.
+func runE2E(args []string) {
+	if !e2eSuite(args) {
+		os.Exit(1)
+	}
+}
+
+func e2eSuite(args []string) bool {
+	fs := flag.NewFlagSet("e2e", flag.ExitOnError)
+	cfgPath := fs.String("config", "", "Optional config file whose tags and summarize settings are exercised")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	keep := fs.Bool("keep", false, "Keep the temporary output directory for inspection")
+	verbose := fs.Bool("v", false, "Verbose logging")
+	_ = fs.Parse(args)
+
+	var cfg config.Config
+	if *cfgPath != "" {
+		cfg = loadConfig(*cfgPath, *profile)
+	} else {
+		cfg.Tags = demo.Tags
+		cfg.Defaults()
+	}
+
+	chat := testkit.NewChatlogServer()
+	defer chat.Close()
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+
+	// Point everything at the fakes and switch off side effects.
+	cfg.Chatlog.BaseURL = chat.URL
+	cfg.Chatlog.ImageBaseURL = ""
+	cfg.LLM = config.LLMConfig{Enabled: true, BaseURL: llm.URL, Model: "e2e", TimeoutSeconds: 1, MaxMessages: 60, MaxChars: 260}
+	cfg.Notify = config.NotifyConfig{}
+	cfg.Report.PDF.Enabled = false
+	cfg.Report.Media.Download = false
+
+	out, err := os.MkdirTemp("", "wechat-view-e2e-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *keep {
+		log.Printf("Output kept in %s", out)
+	} else {
+		defer os.RemoveAll(out)
+	}
+	opts := resolvedOptions{
+		baseURL:     chat.URL,
+		talker:      demo.Talker,
+		talkerLabel: demo.TalkerName,
+		dataDir:     filepath.Join(out, "data"),
+		siteDir:     filepath.Join(out, "site"),
+		recentDays:  cfg.Report.RecentDays,
+		messageCap:  cfg.Report.MessagePreview,
+	}
+	mustMkdirAll(opts.dataDir)
+	mustMkdirAll(opts.siteDir)
+	tagger, err := tags.Compile(cfg.Tags)
+	if err != nil {
+		log.Fatalf("invalid tag rules: %v", err)
+	}
+	builder, err := summaryBuilder(cfg)
+	if err != nil {
+		log.Fatalf("init summarizer failed: %v", err)
+	}
+	g := &generator{cfg: cfg, opts: opts, tagger: tagger, builder: builder, verbose: *verbose}
+
+	days := demo.Days(time.Now().AddDate(0, 0, -1), 4)
+	healthy := func() {
+		chat.SetFault(testkit.Fault{})
+		llm.Reset()
+	}
+	// renderDay fetches and renders day, expecting the rule-based report to
+	// survive and AI insights to be present only when wantAI is set.
+	renderDay := func(day string, wantAI bool) error {
+		if _, err := g.fetch(day); err != nil {
+			return err
+		}
+		res, err := g.render(day)
+		if err != nil {
+			return err
+		}
+		if res.summary.TotalMessages == 0 {
+			return errors.New("summary has no messages")
+		}
+		if _, err := os.Stat(res.htmlPath); err != nil {
+			return err
+		}
+		switch {
+		case wantAI && res.insights == nil:
+			return errors.New("expected AI insights, got none")
+		case !wantAI && res.insights != nil:
+			return errors.New("expected the LLM failure to drop AI insights")
+		}
+		return nil
+	}
+	expectFetchError := func(day string) error {
+		if _, err := g.fetch(day); err == nil {
+			return errors.New("expected fetch to fail")
+		}
+		if _, err := os.Stat(archive.RawPath(opts.dataDir, day)); err == nil {
+			return errors.New("failed fetch still wrote a raw file")
+		}
+		return nil
+	}
+
+	checks := []e2eCheck{
+		{"fetch, summarize and render with AI insights", func() error {
+			return renderDay(days[0], true)
+		}},
+		{"refetching unchanged data keeps data version 1", func() error {
+			changed, err := g.fetch(days[0])
+			if err != nil {
+				return err
+			}
+			raw, err := archive.LoadRaw(opts.dataDir, days[0])
+			if err != nil {
+				return err
+			}
+			if changed || raw.DataVersion == nil || raw.DataVersion.Version != 1 {
+				return fmt.Errorf("changed=%v version=%+v", changed, raw.DataVersion)
+			}
+			return nil
+		}},
+		{"re-rendering unchanged data reuses the cached AI insights", func() error {
+			before := llm.Requests()
+			res, err := g.render(days[0])
+			if err != nil {
+				return err
+			}
+			if res.insights == nil {
+				return errors.New("cached AI insights missing")
+			}
+			if n := llm.Requests() - before; n != 0 {
+				return fmt.Errorf("LLM called %d time(s) for an unchanged day", n)
+			}
+			return nil
+		}},
+		{"embeddings cluster topics and index the day for semantic search", func() error {
+			g.cfg.LLM.Embeddings = config.LLMEmbeddingsConfig{Enabled: true, Model: "e2e-embed", SearchIndex: true}
+			defer func() { g.cfg.LLM.Embeddings = cfg.LLM.Embeddings }()
+			res, err := g.render(days[0])
+			if err != nil {
+				return err
+			}
+			if len(res.summary.Topics) == 0 || !res.summary.Topics[0].Clustered {
+				return fmt.Errorf("topics not clustered: %+v", res.summary.Topics)
+			}
+			idx, err := vectors.Load(opts.dataDir, days[0])
+			if err != nil {
+				return err
+			}
+			hits, err := vectors.NewIndex(opts.dataDir).Search(vectors.Query{Vector: vectorOf(idx.Entries[0].Vector)}, "e2e-embed")
+			if err != nil || len(hits) == 0 || hits[0].Text != idx.Entries[0].Text {
+				return fmt.Errorf("search for an indexed message: %+v, %v", hits, err)
+			}
+			return nil
+		}},
+		{"slow LLM times out and the report still renders", func() error {
+			llm.SetFault(testkit.Fault{Delay: 3 * time.Second})
+			return renderDay(days[1], false)
+		}},
+		{"LLM HTTP 500 is tolerated", func() error {
+			llm.SetFault(testkit.Fault{Status: http.StatusInternalServerError, Body: `{"error":{"message":"boom"}}`})
+			return renderDay(days[2], false)
+		}},
+		{"malformed LLM reply is tolerated", func() error {
+			llm.SetContent("这不是 JSON")
+			return renderDay(days[3], false)
+		}},
+		{"chatlog HTTP error is reported", func() error {
+			chat.SetFault(testkit.Fault{Status: http.StatusBadGateway, Body: "upstream down"})
+			return expectFetchError("2001-01-01")
+		}},
+		{"malformed chatlog response is reported", func() error {
+			chat.SetFault(testkit.Fault{Body: testkit.MalformedJSON})
+			return expectFetchError("2001-01-02")
+		}},
+		{"batch range isolates a failing day", func() error {
+			chat.SetDay("2001-02-02", []byte(testkit.MalformedJSON))
+			if code := g.runRange("2001-02-01", "2001-02-03", false, 2); code != 1 {
+				return fmt.Errorf("exit code %d, want 1", code)
+			}
+			for _, day := range []string{"2001-02-01", "2001-02-03"} {
+				if _, err := os.Stat(filepath.Join(archive.DayDir(opts.siteDir, day), "meta.json")); err != nil {
+					return fmt.Errorf("%s not rendered: %v", day, err)
+				}
+			}
+			if fileExists(archive.RawPath(opts.dataDir, "2001-02-02")) {
+				return errors.New("failed day still wrote a raw file")
+			}
+			return nil
+		}},
+		{"cross-day pages and manifest are built", func() error {
+			if err := g.updateSite(); err != nil {
+				return err
+			}
+			want := []string{"index.html", "links/index.html", "weekly/index.html", "build-manifest.json"}
+			if !cfg.Report.DisableSearch {
+				want = append(want, "search-index.json")
+			}
+			for _, name := range want {
+				if _, err := os.Stat(filepath.Join(opts.siteDir, filepath.FromSlash(name))); err != nil {
+					return fmt.Errorf("missing %s", name)
+				}
+			}
+			return nil
+		}},
+		{"retention compresses and deletes old raw days", func() error {
+			policy := config.RetentionPolicy{CompressAfterDays: 2, DeleteAfterDays: 4}
+			res, err := applyRetention(opts.dataDir, opts.siteDir, policy, time.Date(2001, 2, 5, 9, 0, 0, 0, time.Local), false, false)
+			if err != nil {
+				return err
+			}
+			if res.compressed != 1 || res.deleted != 1 {
+				return fmt.Errorf("compressed %d and deleted %d days, want 1 and 1", res.compressed, res.deleted)
+			}
+			if archive.HasRaw(opts.dataDir, "2001-02-01") {
+				return errors.New("2001-02-01 still has raw data")
+			}
+			if p, _ := archive.FindRaw(opts.dataDir, "2001-02-03"); filepath.Ext(p) != archive.GzipSuffix {
+				return fmt.Errorf("2001-02-03 not compressed: %s", p)
+			}
+			if _, err := g.render("2001-02-03"); err != nil {
+				return fmt.Errorf("render compressed day: %w", err)
+			}
+			if err := g.updateSite(); err != nil {
+				return err
+			}
+			days, err := archive.ReportDays(opts.dataDir, opts.siteDir)
+			if err != nil || len(days) == 0 || days[0] != "2001-02-01" {
+				return fmt.Errorf("deleted day dropped from the site: %v, %v", days, err)
+			}
+			return nil
+		}},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		healthy()
+		start := time.Now()
+		if err := c.run(); err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Printf("PASS  %s (%s)\n", c.name, time.Since(start).Round(time.Millisecond))
+	}
+	fmt.Printf("%d/%d checks passed (chatlog requests %d, llm requests %d)\n", len(checks)-failed, len(checks), chat.Requests(), llm.Requests())
+	return failed == 0
+}
+
+func vectorOf(v []float32) []float64 {
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = float64(x)
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/export"
+)
+
+// runExport converts archived raw days into another platform's chat export
+// JSON, so the group can be browsed next to its Discord or Telegram
+// communities in the same archive viewer.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	format := fs.String("format", "discord", "Archive layout: "+strings.Join(export.Formats, " or "))
+	from := fs.String("from", "", "First day to export, YYYY-MM-DD (default: oldest raw file)")
+	to := fs.String("to", "", "Last day to export, YYYY-MM-DD (default: newest raw file)")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	talkerID := fs.String("talker", "", "Talker of config.talkers to export (required when the list is set)")
+	out := fs.String("out", "", "Output file (default: stdout)")
+	_ = fs.Parse(args)
+
+	for _, d := range []string{*from, *to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			log.Fatalf("invalid date %q, expect YYYY-MM-DD", d)
+		}
+	}
+	if *format != "discord" && *format != "telegram" {
+		log.Fatalf("unknown export format %q, expect %s", *format, strings.Join(export.Formats, " or "))
+	}
+
+	cfg := loadConfig(*cfgPath, *profile)
+	if *talkerID == "" && len(cfg.Talkers) > 0 {
+		log.Fatal("--talker is required with config.talkers")
+	}
+	cfg.Report.DataDir = firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	cfg = cfg.ForTalker(firstNonEmpty(*talkerID, cfg.Chatlog.Talker))
+	data := cfg.Report.DataDir
+	days, err := archive.ListDays(data)
+	if err != nil {
+		log.Fatalf("list raw days failed: %v", err)
+	}
+	talker := cfg.Chatlog.Talker
+	var msgs []chatlog.Message
+	exported := 0
+	for _, day := range days {
+		if (*from != "" && day < *from) || (*to != "" && day > *to) {
+			continue
+		}
+		raw, err := archive.LoadRaw(data, day)
+		if err != nil {
+			log.Printf("warning: export %s: %v", day, err)
+			continue
+		}
+		if talker == "" {
+			talker = raw.Talker
+		}
+		msgs = append(msgs, raw.Messages...)
+		exported++
+	}
+	if exported == 0 {
+		log.Fatalf("no raw days to export in %s", data)
+	}
+
+	ch := export.Channel{
+		ID:           talker,
+		Name:         firstNonEmpty(cfg.TalkerLabel(talker), talker),
+		ImageBaseURL: cfg.Chatlog.ImageBaseURL,
+	}
+	var doc any
+	if *format == "telegram" {
+		doc = export.Telegram(ch, msgs)
+	} else {
+		doc = export.Discord(ch, msgs, time.Now())
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("create %s failed: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		log.Fatalf("write export failed: %v", err)
+	}
+	log.Printf("Exported %d message(s) from %d day(s) as %s", len(msgs), exported, *format)
+}
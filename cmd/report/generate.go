@@ -0,0 +1,1451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/claims"
+	"wechat-view/internal/config"
+	"wechat-view/internal/diskcheck"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/media"
+	"wechat-view/internal/qa"
+	"wechat-view/internal/redact"
+	"wechat-view/internal/render"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/tags"
+	"wechat-view/internal/unfurl"
+	"wechat-view/internal/usage"
+	"wechat-view/internal/vectors"
+	"wechat-view/internal/version"
+	"wechat-view/internal/watermark"
+)
+
+// resolvedOptions are the flag/config values the pipeline runs with.
+type resolvedOptions struct {
+	baseURL     string
+	talker      string
+	talkerLabel string
+	keyword     string
+	dataDir     string
+	siteDir     string
+	imageBase   string
+	recentDays  int
+	messageCap  int
+}
+
+// generator runs the per-day pipeline: fetch raw data, then summarize and
+// render a day page. Site-wide pages are rebuilt once per run by updateSite.
+type generator struct {
+	cfg     config.Config
+	opts    resolvedOptions
+	tagger  *tags.Tagger
+	risk    *risk.Detector
+	builder summarize.Builder
+	latest  version.Release
+	verbose bool
+	// reuseInsights takes AI insights from the existing meta.json instead of
+	// calling the LLM (used by recalc).
+	reuseInsights bool
+	// refreshInsights calls the LLM even when the insight cache has a
+	// result for the day's messages.
+	refreshInsights bool
+	// metaOnly skips the HTML page and PDF, writing meta.json alone.
+	metaOnly bool
+	// noPublish skips publish, for runs of one talker of several whose
+	// parent publishes the whole site.
+	noPublish bool
+	// meter records the tokens of LLM requests for data/llm-usage.json;
+	// nil records nothing.
+	meter *usage.Meter
+	// memberNet caches each archived day's net membership change, loaded
+	// from meta.json on first use and updated as days are rendered.
+	memberNet map[string]int
+	// anon is the pseudonym store, loaded on first use when
+	// report.anonymize is on.
+	anon *redact.Redactor
+	// previews and unfurler back report.unfurl; both are set up on first
+	// use.
+	previews *unfurl.Cache
+	unfurler *unfurl.Fetcher
+}
+
+// dayResult is what later steps (notifications) need from a rendered day.
+type dayResult struct {
+	raw      archive.Raw
+	summary  summarize.Summary
+	insights *insight.Result
+	// variants holds every arm's insight when llm.compare is enabled;
+	// insights is then the first arm that succeeded.
+	variants []insight.Variant
+	// headline is the llm.headline title and share text, if any.
+	headline *insight.Headline
+	// guard is set when the insights failed llm.guardrails.
+	guard    *insight.GuardReport
+	htmlPath string
+	metaPath string
+}
+
+// fetch pulls day from chatlog and writes the raw file. changed reports that
+// an existing raw file held a different message set (recalls, backfills).
+func (g *generator) fetch(day string) (bool, error) {
+	if err := g.checkDisk(); err != nil {
+		return false, fmt.Errorf("not fetching %s: %w", day, err)
+	}
+	client := chatlog.Client{
+		BaseURL:          g.opts.baseURL,
+		MaxMessages:      g.cfg.Chatlog.MaxMessages,
+		MaxResponseBytes: int64(g.cfg.Chatlog.MaxResponseMB) << 20,
+	}
+	msgs, meta, err := client.FetchReportDayContext(context.Background(), day, g.cfg.Report.DayStartHour, g.opts.talker, g.opts.keyword)
+	if err != nil {
+		return false, fmt.Errorf("fetch failed: %w", err)
+	}
+	if truncated, _ := meta["truncated"].(bool); truncated {
+		log.Printf("warning: %s has %v messages, kept the first %d (chatlog.maxMessages)", day, meta["totalMessages"], len(msgs))
+	}
+	return g.store(day, msgs, meta)
+}
+
+// checkDisk refuses to go on when the data or site directory is not
+// writable or nearly full, so a network mount that dropped out or filled
+// up does not leave half-written days behind.
+func (g *generator) checkDisk() error {
+	d := g.cfg.Report.Disk
+	if d.Disabled {
+		return nil
+	}
+	for _, dir := range []string{g.opts.dataDir, g.opts.siteDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("disk check failed: %w", err)
+		}
+		st, err := diskcheck.Check(dir, uint64(d.MinFreeMB)<<20)
+		if err != nil {
+			return fmt.Errorf("disk check failed: %w", err)
+		}
+		if st.Total > 0 && st.Free < uint64(d.WarnFreeMB)<<20 {
+			log.Printf("warning: %s has only %s free (report.disk.warnFreeMB is %d MB)", dir, diskcheck.Bytes(st.Free), d.WarnFreeMB)
+		}
+	}
+	return nil
+}
+
+// store tags msgs and writes them as day's raw file, bumping the data
+// version when they differ from what was stored before.
+func (g *generator) store(day string, msgs []chatlog.Message, meta map[string]any) (bool, error) {
+	g.tagger.Apply(msgs)
+
+	var prev *archive.DataVersion
+	var old []chatlog.Message
+	if existing, err := archive.LoadRaw(g.opts.dataDir, day); err == nil {
+		prev = existing.DataVersion
+		old = existing.Messages
+		if old == nil {
+			old = []chatlog.Message{}
+		}
+	}
+	dv, changed := archive.NextVersion(prev, old, msgs, time.Now())
+	raw := archive.Raw{
+		Date:        day,
+		Talker:      g.opts.talker,
+		Keyword:     g.opts.keyword,
+		Meta:        meta,
+		Messages:    msgs,
+		DataVersion: &dv,
+	}
+	rawPath, err := archive.WriteRaw(g.opts.dataDir, day, raw)
+	if err != nil {
+		return false, fmt.Errorf("write raw json failed: %w", err)
+	}
+	if g.verbose {
+		log.Printf("Saved raw: %s (%d messages, data version %d)", rawPath, len(msgs), dv.Version)
+	}
+	if changed {
+		log.Printf("Data for %s changed since last fetch (+%d/-%d/~%d messages), now version %d", day, dv.Added, dv.Removed, dv.Edited, dv.Version)
+	}
+	return changed, nil
+}
+
+// render summarizes the stored raw file for day and writes its page and
+// meta.json (plus PDF when enabled).
+func (g *generator) render(day string) (dayResult, error) {
+	raw, err := archive.LoadRaw(g.opts.dataDir, day)
+	if err != nil {
+		return dayResult{}, fmt.Errorf("read raw json failed: %w", err)
+	}
+	// Re-tag with the current rules so edits to config.tags reach old days.
+	if g.tagger.Apply(raw.Messages) {
+		rawPath, err := archive.WriteRaw(g.opts.dataDir, day, raw)
+		if err != nil {
+			return dayResult{}, fmt.Errorf("write retagged raw json failed: %w", err)
+		}
+		if g.verbose {
+			log.Printf("Updated tags in %s", rawPath)
+		}
+	}
+
+	riskStats := g.riskStats(day, raw.Messages)
+	// Anonymize after re-tagging and the risk scan, which need the original
+	// text; everything below renders or sends the redacted copies.
+	anon, err := g.redactor()
+	if err != nil {
+		return dayResult{}, err
+	}
+	raw.Messages = anon.Messages(raw.Messages)
+	if err := anon.Save(); err != nil {
+		return dayResult{}, fmt.Errorf("save pseudonyms failed: %w", err)
+	}
+
+	previews := g.linkPreviews(day, raw.Messages)
+	builder := g.builder
+	builder.Watchlist = builder.Watchlist.For(raw.Talker)
+	if previews != nil {
+		builder.ResolveLink = previews.Resolve
+	}
+	if anon != nil {
+		admins := make([]string, len(builder.Announce.Admins))
+		for i, a := range builder.Announce.Admins {
+			admins[i] = anon.Pseudonym(a)
+		}
+		builder.Announce.Admins = admins
+	}
+	prev, prevErr := archive.LoadMeta(g.opts.siteDir, day)
+	if !g.reuseInsights {
+		builder.TopicEmbedding = g.topicEmbedding(g.indexVectors(day, raw.Talker, raw.Messages))
+	}
+	sum := builder.Build(raw.Messages)
+	if g.reuseInsights && prevErr == nil {
+		sum.Topics = reuseClusteredTopics(sum.Topics, prev.Summary.Topics, anon)
+	}
+	if g.cfg.Report.HideRecalls {
+		sum.Recalls = nil
+	}
+	sum.Membership.Cumulative, sum.Membership.Total = g.memberCount(day, sum.Membership.Net())
+	sum.Risk = riskStats
+	sum.Compare = summarize.Compare(raw.Messages, g.earlier(day, -1), g.earlier(day, -7))
+	g.escalate(day, raw.Talker, &sum.ReplyDebt, raw.Messages, anon)
+	res := dayResult{raw: raw, summary: sum}
+
+	label := firstNonEmpty(g.opts.talkerLabel, g.cfg.TalkerLabel(raw.Talker))
+
+	// Optional AI insights
+	if g.reuseInsights {
+		if prevErr == nil {
+			res.insights = prev.AIInsights
+			res.variants = prev.AIVariants
+			// Check insights rejected last time again.
+			rejected := g.loadRejected(day)
+			if res.insights == nil && len(res.variants) == 0 {
+				res.insights = rejected.Insights
+			}
+			for i, v := range res.variants {
+				if r := rejected.Variants[v.Label]; v.Result == nil && r != nil {
+					res.variants[i].Result, res.variants[i].Error = r, ""
+				}
+			}
+		}
+		// Stored insights may predate report.anonymize.
+		if anon != nil {
+			res.insights = redactInsight(anon, res.insights)
+			for i, v := range res.variants {
+				res.variants[i].Result = redactInsight(anon, v.Result)
+			}
+		}
+	} else if arms := g.insightArms(); len(arms) > 0 {
+		talker := firstNonEmpty(label, raw.Talker, g.opts.talker)
+		variants := g.generateInsights(day, raw.Talker, talker, arms, sum, raw.Messages)
+		if len(arms) > 1 {
+			res.variants = variants
+		}
+		for _, v := range variants {
+			if v.Error != "" && g.verbose {
+				log.Printf("llm insights (%s) failed: %v", v.Label, v.Error)
+			}
+			if res.insights == nil && v.Result != nil {
+				res.insights = v.Result
+			}
+		}
+	}
+
+	g.guardInsights(day, &res, raw.Messages)
+
+	if prevErr == nil {
+		sum.ActionItems = g.refineActions(sum.ActionItems, prev.Summary.ActionItems, anon)
+		sum.Topics = g.deepDiveTopics(sum.Topics, prev.Summary.Topics, raw.Messages, anon)
+	} else {
+		sum.ActionItems = g.refineActions(sum.ActionItems, nil, anon)
+		sum.Topics = g.deepDiveTopics(sum.Topics, nil, raw.Messages, anon)
+	}
+	if prevErr == nil {
+		res.headline = g.headline(day, firstNonEmpty(label, raw.Talker, g.opts.talker), sum, res.insights, raw.Messages, prev.AIHeadline, anon)
+	} else {
+		res.headline = g.headline(day, firstNonEmpty(label, raw.Talker, g.opts.talker), sum, res.insights, raw.Messages, nil, anon)
+	}
+	res.summary = sum
+
+	dayDir := archive.DayDir(g.opts.siteDir, day)
+	mustMkdirAll(dayDir)
+	res.htmlPath = filepath.Join(dayDir, "index.html")
+	res.metaPath = filepath.Join(dayDir, "meta.json")
+
+	ctx := render.DayContext{
+		Date:         day,
+		DayStartHour: g.cfg.Report.DayStartHour,
+		Talker:       raw.Talker,
+		TalkerLabel:  label,
+		Keyword:      raw.Keyword,
+		Summary:      sum,
+		Messages:     raw.Messages,
+		ImageBaseURL: g.opts.imageBase,
+		MessageLimit: g.opts.messageCap,
+		DataVersion:  raw.DataVersion,
+		LocalMedia:   g.publishMedia(day, dayDir, raw.Messages),
+		HideSections: g.cfg.Report.Sections.For(g.opts.talker).Hide,
+		// Negative turns the transcript pages off.
+		MessagePageSize: max(g.cfg.Report.MessagePageSize, 0),
+	}
+	if !g.cfg.Report.DisableSearch {
+		ctx.SearchURL = "../../../search.html"
+	}
+	if g.cfg.Report.Charts.EChartsFile != "" {
+		ctx.ChartsScript = "../../../" + render.EChartsAsset
+	}
+	ctx.LinkPreviews = previews
+	if store, err := claims.Open(filepath.Join(g.opts.dataDir, "claims.json")); err != nil {
+		log.Printf("warning: load question claims failed: %v", err)
+	} else {
+		ctx.Claims = store.ByID(day)
+		for _, item := range sum.ReplyDebt.Escalated {
+			if c, ok := store.Get(item.ID); ok {
+				ctx.Claims[item.ID] = c
+			}
+		}
+	}
+	if version.Version != "dev" {
+		ctx.Version = version.Version
+	}
+	if g.latest.Tag != "" {
+		ctx.UpdateNotice = i18n.Tf("发现新版本 %s，建议升级", g.latest.Tag)
+		ctx.UpdateURL = g.latest.URL
+	}
+	if g.cfg.Report.Watermark.Enabled {
+		now := time.Now()
+		ctx.GeneratedAt = now.Format(time.RFC3339)
+		ctx.Provenance = firstNonEmpty(label, raw.Talker, g.opts.talker)
+		ctx.Watermark = watermark.Encode(watermark.Mark{Source: raw.Talker, Time: now}.String()) + watermark.Slot
+	}
+	fresh := archive.DayMeta{Date: day, Summary: sum, AIInsights: res.insights}
+	if prevErr == nil {
+		ctx.Regen = g.changelog(day, &prev, fresh)
+	} else {
+		ctx.Regen = g.changelog(day, nil, fresh)
+	}
+	ctx.AIInsights = insightView(res.insights)
+	if ins := res.insights; ins != nil && len(res.variants) == 0 && ins.Model != "" && ins.Model != g.cfg.LLM.Model {
+		ctx.AIInsights.FallbackModel = ins.Model
+	}
+	if gr := res.guard; gr != nil {
+		if gr.Rejected {
+			ctx.AIRejected = guardView(gr.Issues)
+		} else if ctx.AIInsights != nil {
+			ctx.AIInsights.Flags = guardView(gr.Issues)
+		}
+	}
+	if res.headline != nil {
+		ctx.Headline, ctx.ShareText = res.headline.Title, res.headline.Tweet
+	}
+	if len(res.variants) > 1 {
+		for _, v := range res.variants {
+			view := render.AIVariant{
+				Label:     v.Label,
+				Model:     v.Model,
+				Score:     v.Quality.Score,
+				LatencyMS: v.LatencyMS,
+				Error:     v.Error,
+				Insights:  insightView(v.Result),
+			}
+			if issues := g.guardCheck(v.Result, raw.Messages); len(issues) > 0 {
+				if g.cfg.LLM.Guardrails.Action == "flag" {
+					view.Insights.Flags = guardView(issues)
+				} else {
+					view.Insights, view.Error = nil, i18n.T("未通过内容校验")
+				}
+			}
+			ctx.AIVariants = append(ctx.AIVariants, view)
+		}
+	}
+	if !g.metaOnly {
+		if len(sum.Interactions.Edges) > 0 {
+			if err := render.WriteGraphJSON(dayDir, sum.Interactions); err != nil {
+				return dayResult{}, fmt.Errorf("write interaction graph failed: %w", err)
+			}
+			ctx.GraphJSON = render.GraphJSONName
+		}
+		if err := render.DayHTML(res.htmlPath, ctx); err != nil {
+			return dayResult{}, fmt.Errorf("render day html failed: %w", err)
+		}
+		widget := render.NewWidget(day, firstNonEmpty(label, raw.Talker, g.opts.talker), sum)
+		widget.URL = "index.html"
+		if res.headline != nil {
+			widget.Headline = res.headline.Title
+		}
+		if err := render.WriteWidget(dayDir, widget); err != nil {
+			return dayResult{}, fmt.Errorf("render widget failed: %w", err)
+		}
+		if g.cfg.Report.PDF.Enabled {
+			pdf, err := render.NewPDFRenderer(g.cfg.Report.PDF.Renderer, g.cfg.Report.PDF.Binary, time.Duration(g.cfg.Report.PDF.TimeoutSeconds)*time.Second)
+			if err != nil {
+				return dayResult{}, fmt.Errorf("init pdf renderer failed: %w", err)
+			}
+			pdfPath := filepath.Join(dayDir, "report.pdf")
+			if err := pdf.RenderPDF(context.Background(), res.htmlPath, pdfPath); err != nil {
+				log.Printf("warning: render pdf failed: %v", err)
+			} else {
+				if g.verbose {
+					log.Printf("Generated: %s", pdfPath)
+				}
+				// Link the PDF only once it exists; the PDF itself is
+				// rendered from the page without the link.
+				ctx.PDFURL = "report.pdf"
+				if err := render.DayHTML(res.htmlPath, ctx); err != nil {
+					return dayResult{}, fmt.Errorf("render day html failed: %w", err)
+				}
+			}
+		}
+	}
+	metaPayload := map[string]any{
+		"date":    day,
+		"talker":  raw.Talker,
+		"keyword": raw.Keyword,
+		"summary": sum,
+	}
+	if res.insights != nil {
+		metaPayload["aiInsights"] = *res.insights
+	}
+	if len(res.variants) > 0 {
+		metaPayload["aiVariants"] = res.variants
+	}
+	if res.headline != nil {
+		metaPayload["aiHeadline"] = *res.headline
+	}
+	if res.guard != nil {
+		metaPayload["aiGuard"] = *res.guard
+	}
+	if raw.DataVersion != nil {
+		metaPayload["dataVersion"] = raw.DataVersion
+	}
+	if err := writeJSON(res.metaPath, metaPayload); err != nil {
+		return dayResult{}, fmt.Errorf("write day meta failed: %w", err)
+	}
+	return res, nil
+}
+
+// changelog records how the page differs from the previous render of day,
+// when there was one and anything changed, in data/diffs, and returns the
+// latest recorded change for the page notice.
+func (g *generator) changelog(day string, prev *archive.DayMeta, fresh archive.DayMeta) *archive.MetaDiff {
+	cl, err := archive.LoadChangelog(g.opts.dataDir, day)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("warning: read changelog for %s failed: %v", day, err)
+	}
+	if prev != nil {
+		if d := archive.DiffMeta(*prev, fresh, time.Now()); !d.Empty() {
+			cl.Date = day
+			cl.Add(d)
+			if err := writeJSON(archive.DiffPath(g.opts.dataDir, day), cl); err != nil {
+				log.Printf("warning: write changelog for %s failed: %v", day, err)
+			} else if g.verbose {
+				log.Printf("Regenerated %s: %s", day, strings.Join(d.Changes(), "; "))
+			}
+		}
+	}
+	return cl.Latest()
+}
+
+// redactor returns the pseudonym store when report.anonymize is on, or nil.
+func (g *generator) redactor() (*redact.Redactor, error) {
+	if !g.cfg.Report.Anonymize {
+		return nil, nil
+	}
+	if g.anon == nil {
+		r, err := openRedactor(g.opts.dataDir)
+		if err != nil {
+			return nil, err
+		}
+		// Learn everyone up front so a name first seen later is still
+		// replaced in the text of earlier days.
+		days, _ := archive.ListDays(g.opts.dataDir)
+		for _, day := range days {
+			if raw, err := archive.LoadRaw(g.opts.dataDir, day); err == nil {
+				r.Learn(raw.Messages)
+			}
+		}
+		g.anon = r
+	}
+	return g.anon, nil
+}
+
+// linkPreviews returns the report.unfurl cache, nil when it is off, after
+// expanding the shortlinks and fetching the previews of the bare links in
+// msgs that are not cached yet. Recalc only reads the cache.
+func (g *generator) linkPreviews(day string, msgs []chatlog.Message) *unfurl.Cache {
+	uc := g.cfg.Report.Unfurl
+	if !uc.Enabled && !uc.ExpandShortlinks {
+		return nil
+	}
+	if g.previews == nil {
+		c, err := unfurl.Open(filepath.Join(g.opts.dataDir, "unfurl.json"))
+		if err != nil {
+			log.Printf("warning: load link previews failed: %v", err)
+			return nil
+		}
+		g.previews = c
+		g.unfurler = &unfurl.Fetcher{
+			Timeout:   time.Duration(uc.TimeoutSeconds) * time.Second,
+			MaxBytes:  int64(uc.MaxKB) << 10,
+			UserAgent: uc.UserAgent,
+		}
+	}
+	if g.reuseInsights || len(msgs) == 0 {
+		return g.previews
+	}
+	limit := uc.MaxPerDay
+	if limit == 0 {
+		limit = 30
+	}
+	bare := render.BareLinks(msgs)
+	expanded, fetched := 0, 0
+	if uc.ExpandShortlinks {
+		expanded = g.previews.Expand(context.Background(), g.unfurler, bare, limit)
+	}
+	if uc.Enabled {
+		// Previews are keyed by the normalized address, which is what day
+		// pages and the link library look up.
+		urls := make([]string, len(bare))
+		for i, u := range bare {
+			urls[i] = summarize.NormalizeURL(g.previews.Resolve(u))
+		}
+		fetched = g.previews.Fill(context.Background(), g.unfurler, urls, limit)
+	}
+	if err := g.previews.Save(); err != nil {
+		log.Printf("warning: save link previews failed: %v", err)
+	}
+	if g.verbose && expanded+fetched > 0 {
+		log.Printf("Expanded %d shortlink(s) and fetched %d link preview(s) for %s", expanded, fetched, day)
+	}
+	return g.previews
+}
+
+// insightArms returns the configured LLM setups: the primary one, plus the
+// challenger when llm.compare is enabled. Nil means AI insights are off.
+func (g *generator) insightArms() []insight.Arm {
+	llm := g.cfg.LLM
+	if !llm.Enabled || llm.BaseURL == "" || llm.Model == "" {
+		return nil
+	}
+	primary := insight.Client{
+		BaseURL:      llm.BaseURL,
+		Model:        llm.Model,
+		APIKey:       llm.APIKey,
+		Temperature:  llm.Temperature,
+		Timeout:      time.Duration(llm.TimeoutSeconds) * time.Second,
+		MaxMessages:  llm.MaxMessages,
+		MaxChars:     llm.MaxChars,
+		SystemPrompt: llm.SystemPrompt,
+		Meter:        g.meter,
+	}
+	if llm.Scrub.Enabled {
+		scrub, err := insight.NewScrubber(llm.Scrub.Patterns)
+		if err != nil {
+			// Rather no insights than messages sent unscrubbed.
+			log.Printf("warning: not calling the LLM: llm.scrub: %v", err)
+			return nil
+		}
+		primary.Scrub = scrub
+	}
+	if m := llm.MapReduce; m.Enabled {
+		primary.MapReduce = insight.MapReduce{ChunkMessages: m.ChunkMessages, MaxChunks: m.MaxChunks}
+	}
+	for _, f := range llm.FallbackModels {
+		primary.Fallbacks = append(primary.Fallbacks, insight.Fallback{BaseURL: f.BaseURL, Model: f.Model, APIKey: f.APIKey})
+	}
+	arms := []insight.Arm{{Label: llm.Label, Client: primary}}
+	if b := llm.Compare; b.Enabled {
+		challenger := primary
+		// A challenger rescued by another model would blur the comparison.
+		challenger.Fallbacks = nil
+		challenger.BaseURL = firstNonEmpty(b.BaseURL, primary.BaseURL)
+		challenger.Model = firstNonEmpty(b.Model, primary.Model)
+		challenger.APIKey = firstNonEmpty(b.APIKey, primary.APIKey)
+		challenger.SystemPrompt = firstNonEmpty(b.SystemPrompt, primary.SystemPrompt)
+		if b.Temperature != 0 {
+			challenger.Temperature = b.Temperature
+		}
+		arms = append(arms, insight.Arm{Label: b.Label, Client: challenger})
+	}
+	return arms
+}
+
+// insightCache holds the AI insights generated so far, see
+// generateInsights.
+func (g *generator) insightCache() insight.Cache {
+	return insight.Cache{Dir: filepath.Join(cacheDir(g.opts.dataDir), "insights")}
+}
+
+// generateInsights returns each arm's variant for day. An arm whose model
+// and prompt already ran on the same messages is taken from the insight
+// cache, unless --refresh-insights; the others run together and their
+// results are cached.
+func (g *generator) generateInsights(day, talkerID, talker string, arms []insight.Arm, sum summarize.Summary, msgs []chatlog.Message) []insight.Variant {
+	cache := g.insightCache()
+	data := archive.Fingerprint(msgs)
+	out := make([]insight.Variant, len(arms))
+	var missing []insight.Arm
+	var at []int
+	for i, arm := range arms {
+		if !g.refreshInsights {
+			if v, ok := cache.Get(arm.Client.Key(day, talkerID, data, sum)); ok {
+				if g.verbose {
+					log.Printf("Reusing cached AI insights from %s", arm.Client.Model)
+				}
+				v.Label = arm.Label
+				out[i] = v
+				continue
+			}
+		}
+		missing = append(missing, arm)
+		at = append(at, i)
+	}
+	if len(missing) == 0 {
+		return out
+	}
+	if g.verbose {
+		for _, arm := range missing {
+			log.Printf("Generating AI insights via %s (%s)", arm.Client.BaseURL, arm.Client.Model)
+		}
+	}
+	for j, v := range insight.Compare(context.Background(), missing, day, talker, sum, msgs) {
+		out[at[j]] = v
+		client := missing[j].Client
+		if v.Result != nil && v.Result.Model != client.Model {
+			// Cached under the fallback model, so the next render tries the
+			// primary model again.
+			log.Printf("warning: %s failed, AI insights for %s come from fallback model %s", client.Model, day, v.Result.Model)
+			client = client.AnsweredBy(v.Result.Model)
+		}
+		if err := cache.Put(client.Key(day, talkerID, data, sum), v); err != nil {
+			log.Printf("warning: cache ai insights: %v", err)
+		}
+	}
+	return out
+}
+
+// embeddingsClient builds the llm.embeddings client; ok is false when
+// embeddings are off or llm.scrub cannot be compiled.
+func (g *generator) embeddingsClient() (insight.Client, bool) {
+	llm := g.cfg.LLM
+	e := llm.Embeddings
+	if !e.Enabled || e.Model == "" || firstNonEmpty(e.BaseURL, llm.BaseURL) == "" {
+		return insight.Client{}, false
+	}
+	client := insight.Client{
+		BaseURL: firstNonEmpty(e.BaseURL, llm.BaseURL),
+		Model:   e.Model,
+		APIKey:  firstNonEmpty(e.APIKey, llm.APIKey),
+		Timeout: time.Duration(llm.TimeoutSeconds) * time.Second,
+		Meter:   g.meter,
+	}
+	if llm.Scrub.Enabled {
+		scrub, err := insight.NewScrubber(llm.Scrub.Patterns)
+		if err != nil {
+			log.Printf("warning: not calling the embeddings API: llm.scrub: %v", err)
+			return insight.Client{}, false
+		}
+		client.Scrub = scrub
+	}
+	return client, true
+}
+
+// topicEmbedding returns the llm.embeddings topic clustering, or the zero
+// value, which keeps keyword topics, when it is off. Texts found in indexed,
+// the day's search index, are not embedded again.
+func (g *generator) topicEmbedding(indexed map[string][]float32) summarize.TopicEmbedding {
+	client, ok := g.embeddingsClient()
+	if !ok {
+		return summarize.TopicEmbedding{}
+	}
+	e := g.cfg.LLM.Embeddings
+	return summarize.TopicEmbedding{
+		Clusters:    e.Clusters,
+		MaxMessages: e.MaxMessages,
+		Embed: func(texts []string) ([][]float64, error) {
+			out := make([][]float64, len(texts))
+			var missing []string
+			for i, t := range texts {
+				if v, ok := indexed[t]; ok {
+					out[i] = make([]float64, len(v))
+					for d, x := range v {
+						out[i][d] = float64(x)
+					}
+				} else {
+					missing = append(missing, t)
+				}
+			}
+			if len(missing) == 0 {
+				return out, nil
+			}
+			if g.verbose {
+				log.Printf("Embedding %d messages via %s (%s)", len(missing), client.BaseURL, client.Model)
+			}
+			vecs, err := client.Embed(context.Background(), missing)
+			if err != nil {
+				if g.verbose {
+					log.Printf("llm embeddings failed, keeping keyword topics: %v", err)
+				}
+				return nil, err
+			}
+			for i := range out {
+				if out[i] == nil {
+					out[i], vecs = vecs[0], vecs[1:]
+				}
+			}
+			return out, nil
+		},
+	}
+}
+
+// maxIndexedRunes cuts long messages before they are embedded for search.
+const maxIndexedRunes = 500
+
+// indexVectors embeds day's messages into the llm.embeddings.searchIndex
+// store, data/vectors/<day>.json, unless it is already up to date, and
+// returns the stored vectors by message text. Failures only log: search
+// then misses the day until the next run.
+func (g *generator) indexVectors(day, talker string, msgs []chatlog.Message) map[string][]float32 {
+	client, ok := g.embeddingsClient()
+	if !ok || !g.cfg.LLM.Embeddings.SearchIndex {
+		return nil
+	}
+	fingerprint := archive.Fingerprint(msgs)
+	byText := func(d vectors.Day) map[string][]float32 {
+		out := make(map[string][]float32, len(d.Entries))
+		for _, e := range d.Entries {
+			out[e.Text] = e.Vector
+		}
+		return out
+	}
+	if d, err := vectors.Load(g.opts.dataDir, day); err == nil && d.Fingerprint == fingerprint && d.Model == client.Model && d.Talker == talker {
+		return byText(d)
+	}
+
+	d := vectors.Day{Talker: talker, Model: client.Model, Fingerprint: fingerprint}
+	var texts []string
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		text := strings.TrimSpace(firstNonEmpty(m.Content, m.Text))
+		if m.MsgType == 10000 || text == "" {
+			continue
+		}
+		if r := []rune(text); len(r) > maxIndexedRunes {
+			text = string(r[:maxIndexedRunes])
+		}
+		ts := m.Timestamp
+		if ts == 0 {
+			ts = m.CreateTime
+		}
+		if ts > 1_000_000_000_000 {
+			ts /= 1000
+		}
+		d.Entries = append(d.Entries, vectors.Entry{Sender: firstNonEmpty(m.SenderName, m.Sender), Time: ts, Text: text})
+		if !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) > 0 {
+		if g.verbose {
+			log.Printf("Indexing %d messages of %s for semantic search", len(texts), day)
+		}
+		vecs, err := client.Embed(context.Background(), texts)
+		if err != nil {
+			log.Printf("warning: semantic index of %s not updated: %v", day, err)
+			return nil
+		}
+		byTextVec := make(map[string][]float64, len(texts))
+		for i, t := range texts {
+			byTextVec[t] = vecs[i]
+		}
+		for i := range d.Entries {
+			d.Entries[i].Vector = vectors.Normalize(byTextVec[d.Entries[i].Text])
+		}
+	}
+	if err := vectors.Save(g.opts.dataDir, day, d); err != nil {
+		log.Printf("warning: save semantic index of %s failed: %v", day, err)
+	}
+	return byText(d)
+}
+
+// reuseClusteredTopics keeps the embedding topics stored in prev on reruns
+// that reuse insights, so recalc does not call the embeddings API; keyword
+// topics are rebuilt as usual.
+func reuseClusteredTopics(topics, prev []summarize.Topic, anon *redact.Redactor) []summarize.Topic {
+	if len(prev) == 0 || !prev[0].Clustered {
+		return topics
+	}
+	out := make([]summarize.Topic, len(prev))
+	for i, tp := range prev {
+		// Stored topics may predate report.anonymize.
+		if anon != nil {
+			tp.Representative = anon.Text(tp.Representative)
+		}
+		out[i] = tp
+	}
+	return out
+}
+
+// refineActions runs llm.refineActions over the rule-based action items.
+// Reruns that reuse insights keep the refined items stored in prev instead;
+// on any failure the rule-based items are kept.
+func (g *generator) refineActions(items, prev []summarize.ActionItem, anon *redact.Redactor) []summarize.ActionItem {
+	if !g.cfg.LLM.RefineActions || len(items) == 0 {
+		return items
+	}
+	if g.reuseInsights {
+		if len(prev) == 0 || !prev[0].Refined {
+			return items
+		}
+		out := make([]summarize.ActionItem, len(prev))
+		for i, it := range prev {
+			// Stored items may predate report.anonymize.
+			if anon != nil {
+				it.Owner, it.Sender = anon.Text(it.Owner), anon.Text(it.Sender)
+				it.Task, it.Source = anon.Text(it.Task), anon.Text(it.Source)
+			}
+			out[i] = it
+		}
+		return out
+	}
+	arms := g.insightArms()
+	if len(arms) == 0 {
+		return items
+	}
+	refined, err := arms[0].Client.RefineActions(context.Background(), items)
+	if err != nil {
+		if g.verbose {
+			log.Printf("llm action items failed: %v", err)
+		}
+		return items
+	}
+	return refined
+}
+
+// deepDiveTopics runs llm.topicDeepDive over the day's topics. Reruns that
+// reuse insights copy the deep dives stored in prev to the topics of the
+// same name instead; on any failure the topics are kept without them.
+func (g *generator) deepDiveTopics(topics, prev []summarize.Topic, msgs []chatlog.Message, anon *redact.Redactor) []summarize.Topic {
+	if !g.cfg.LLM.TopicDeepDive || len(topics) == 0 {
+		return topics
+	}
+	if g.reuseInsights {
+		stored := map[string]*summarize.TopicDeepDive{}
+		for _, tp := range prev {
+			if tp.DeepDive != nil {
+				stored[tp.Name] = tp.DeepDive
+			}
+		}
+		out := make([]summarize.Topic, len(topics))
+		for i, tp := range topics {
+			if d := stored[tp.Name]; d != nil {
+				dive := *d
+				// Stored deep dives may predate report.anonymize.
+				if anon != nil {
+					dive.Explanation = anon.Text(d.Explanation)
+					dive.Viewpoints = redactList(anon, d.Viewpoints)
+					dive.OpenQuestions = redactList(anon, d.OpenQuestions)
+				}
+				tp.DeepDive = &dive
+			}
+			out[i] = tp
+		}
+		return out
+	}
+	arms := g.insightArms()
+	if len(arms) == 0 {
+		return topics
+	}
+	out, err := arms[0].Client.DeepDiveTopics(context.Background(), topics, msgs)
+	if err != nil {
+		if g.verbose {
+			log.Printf("llm topic deep dives failed: %v", err)
+		}
+		return topics
+	}
+	return out
+}
+
+// guardInsights applies llm.guardrails to the day's insights. With a
+// comparison, the first variant that passes becomes the insights. When none
+// does, "reject" drops them, leaving the rule-based highlights on the page
+// and in notifications, and "flag" keeps them; either way res.guard records
+// the problems. Rejected results never reach meta.json: they are kept in
+// the data directory (see rejectedInsights).
+func (g *generator) guardInsights(day string, res *dayResult, msgs []chatlog.Message) {
+	if !g.cfg.LLM.Guardrails.Enabled {
+		return
+	}
+	reject := g.cfg.LLM.Guardrails.Action != "flag"
+	var report *insight.GuardReport
+	var passed, failed *insight.Result
+	check := func(r *insight.Result) bool {
+		issues := g.guardCheck(r, msgs)
+		if len(issues) == 0 {
+			return true
+		}
+		if report == nil {
+			report, failed = &insight.GuardReport{Model: r.Model, Issues: issues}, r
+		}
+		return false
+	}
+	var rejected rejectedInsights
+	defer func() { g.saveRejected(day, rejected) }()
+	for i, v := range res.variants {
+		switch {
+		case v.Result == nil:
+		case check(v.Result):
+			if passed == nil {
+				passed = v.Result
+			}
+		case reject:
+			if rejected.Variants == nil {
+				rejected.Variants = map[string]*insight.Result{}
+			}
+			rejected.Variants[v.Label] = v.Result
+			res.variants[i].Result, res.variants[i].Error = nil, i18n.T("未通过内容校验")
+		}
+	}
+	if len(res.variants) == 0 && res.insights != nil && check(res.insights) {
+		passed = res.insights
+	}
+	if passed != nil {
+		res.insights = passed
+		return
+	}
+	if report == nil {
+		return
+	}
+	if !reject {
+		log.Printf("warning: AI insights for %s flagged by llm.guardrails: %s", day, guardSummary(report.Issues))
+		res.insights = failed
+	} else {
+		log.Printf("warning: AI insights for %s rejected by llm.guardrails, keeping rule-based highlights: %s", day, guardSummary(report.Issues))
+		report.Rejected = true
+		if len(res.variants) == 0 {
+			rejected.Insights = failed
+		}
+		res.insights = nil
+	}
+	res.guard = report
+}
+
+// rejectedInsights holds what llm.guardrails rejected for a day, the
+// insights or comparison variants by label. It lives under the data
+// directory rather than in the published meta.json, so recalc can check it
+// again after the guardrails change without publishing the rejected text.
+type rejectedInsights struct {
+	Insights *insight.Result            `json:"insights,omitempty"`
+	Variants map[string]*insight.Result `json:"variants,omitempty"`
+}
+
+func (g *generator) rejectedPath(day string) string {
+	return filepath.Join(g.insightCache().Dir, "rejected", day+".json")
+}
+
+func (g *generator) loadRejected(day string) rejectedInsights {
+	var r rejectedInsights
+	b, err := os.ReadFile(g.rejectedPath(day))
+	if err == nil {
+		err = json.Unmarshal(b, &r)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("warning: read rejected AI insights for %s: %v", day, err)
+	}
+	return r
+}
+
+// saveRejected stores r for day, or removes the day's file when nothing was
+// rejected.
+func (g *generator) saveRejected(day string, r rejectedInsights) {
+	p := g.rejectedPath(day)
+	if r.Insights == nil && len(r.Variants) == 0 {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("warning: remove rejected AI insights for %s: %v", day, err)
+		}
+		return
+	}
+	mustMkdirAll(filepath.Dir(p))
+	if err := writeJSON(p, r); err != nil {
+		log.Printf("warning: keep rejected AI insights for %s: %v", day, err)
+	}
+}
+
+// guardCheck returns the llm.guardrails problems of r, none when the
+// guardrails are off or r is nil.
+func (g *generator) guardCheck(r *insight.Result, msgs []chatlog.Message) []insight.GuardIssue {
+	gr := g.cfg.LLM.Guardrails
+	if !gr.Enabled || r == nil {
+		return nil
+	}
+	return insight.Guard{MaxBulletRunes: gr.MaxBulletRunes, BannedTerms: gr.BannedTerms}.Check(*r, msgs)
+}
+
+func guardSummary(issues []insight.GuardIssue) string {
+	parts := make([]string, len(issues))
+	for i, is := range issues {
+		parts[i] = is.Kind + " " + strconv.Quote(is.Text)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func guardView(issues []insight.GuardIssue) []render.GuardIssue {
+	out := make([]render.GuardIssue, len(issues))
+	for i, is := range issues {
+		out[i] = render.GuardIssue{Kind: is.Kind, Text: is.Text}
+	}
+	return out
+}
+
+// headline runs llm.headline for day. Reruns that reuse insights keep the
+// headline stored in prev instead; a failure leaves the day without one.
+func (g *generator) headline(day, talker string, sum summarize.Summary, insights *insight.Result, msgs []chatlog.Message, prev *insight.Headline, anon *redact.Redactor) *insight.Headline {
+	if !g.cfg.LLM.Headline {
+		return nil
+	}
+	if g.reuseInsights {
+		if prev == nil {
+			return nil
+		}
+		h := *prev
+		// Stored headlines may predate report.anonymize.
+		if anon != nil {
+			h.Title, h.Tweet = anon.Text(h.Title), anon.Text(h.Tweet)
+		}
+		return &h
+	}
+	arms := g.insightArms()
+	if len(arms) == 0 {
+		return nil
+	}
+	h, err := arms[0].Client.Headline(context.Background(), day, talker, sum, insights, msgs)
+	if err != nil {
+		if g.verbose {
+			log.Printf("llm headline failed: %v", err)
+		}
+		return nil
+	}
+	return &h
+}
+
+// redactInsight returns a copy of r with known names and contact details
+// replaced the way anon redacts messages.
+func redactInsight(anon *redact.Redactor, r *insight.Result) *insight.Result {
+	if r == nil {
+		return nil
+	}
+	out := *r
+	out.Overview, out.Spotlight = anon.Text(r.Overview), anon.Text(r.Spotlight)
+	for _, list := range []*[]string{&out.Highlights, &out.Opportunities, &out.Risks, &out.Actions} {
+		*list = redactList(anon, *list)
+	}
+	return &out
+}
+
+func redactList(anon *redact.Redactor, list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = anon.Text(s)
+	}
+	return out
+}
+
+func insightView(ins *insight.Result) *render.AIInsights {
+	if ins == nil {
+		return nil
+	}
+	return &render.AIInsights{
+		Overview:      ins.Overview,
+		Highlights:    ins.Highlights,
+		Opportunities: ins.Opportunities,
+		Risks:         ins.Risks,
+		Actions:       ins.Actions,
+		Spotlight:     ins.Spotlight,
+	}
+}
+
+// memberCount records net as day's membership change and returns the
+// running net change and member count through day, see
+// render.RunningMembership. Days rendered before membership parsing existed
+// count as zero until recalculated.
+func (g *generator) memberCount(day string, net int) (cumulative, total int) {
+	if g.memberNet == nil {
+		g.memberNet, _ = render.MembershipNets(g.opts.siteDir, g.opts.dataDir)
+		if g.memberNet == nil {
+			g.memberNet = map[string]int{}
+		}
+	}
+	g.memberNet[day] = net
+	return render.RunningMembership(g.memberNet, day, g.cfg.Report.MemberBaseline)
+}
+
+// earlier loads the raw messages of the day offset days from day, or nil
+// when that day was not archived.
+func (g *generator) earlier(day string, offset int) *summarize.Earlier {
+	t, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return nil
+	}
+	d := t.AddDate(0, 0, offset).Format("2006-01-02")
+	raw, err := archive.LoadRaw(g.opts.dataDir, d)
+	if err != nil {
+		return nil
+	}
+	// g.anon is set once render has loaded it for report.anonymize.
+	return &summarize.Earlier{Date: d, Messages: g.anon.Messages(raw.Messages)}
+}
+
+// escalate applies summarize.replyDebt: questions from the reports of the
+// previous carryDays days that are still unanswered, and not resolved as
+// claims, are carried into rd.
+func (g *generator) escalate(day, talker string, rd *summarize.ReplyDebt, msgs []chatlog.Message, anon *redact.Redactor) {
+	rc := g.cfg.Summarize.ReplyDebt
+	if rc.EscalateAfterHours <= 0 {
+		return
+	}
+	t, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return
+	}
+	esc := summarize.Escalation{
+		After:     time.Duration(rc.EscalateAfterHours * float64(time.Hour)),
+		CarryDays: rc.CarryDays,
+	}
+	if owner, ok := rc.Owners[talker]; ok {
+		esc.Owner = anon.Pseudonym(owner.Name)
+	}
+	carry := esc.CarryDays
+	if carry <= 0 {
+		carry = 7
+	}
+	// Newest reports first, so a question keeps the day it was first
+	// escalated on.
+	var earlier []summarize.ReplyItem
+	answered := map[string]bool{}
+	for i := 1; i <= carry; i++ {
+		d := t.AddDate(0, 0, -i).Format("2006-01-02")
+		meta, err := archive.LoadMeta(g.opts.siteDir, d)
+		if err != nil {
+			continue
+		}
+		debt := meta.Summary.ReplyDebt
+		for _, item := range debt.LateResolved {
+			answered[item.ID] = true
+		}
+		earlier = append(earlier, debt.Escalated...)
+		for _, item := range debt.Outstanding {
+			if item.Date == "" {
+				item.Date = d
+			}
+			earlier = append(earlier, item)
+		}
+	}
+	store, err := claims.Open(filepath.Join(g.opts.dataDir, "claims.json"))
+	if err != nil {
+		log.Printf("warning: load question claims failed: %v", err)
+	}
+	resolved := func(id string) bool {
+		if store == nil {
+			return false
+		}
+		c, ok := store.Get(id)
+		return ok && c.Status == claims.StatusResolved
+	}
+	open := earlier[:0]
+	for _, item := range earlier {
+		if !answered[item.ID] && !resolved(item.ID) {
+			open = append(open, item)
+		}
+	}
+	esc.Escalate(rd, day, open, msgs)
+	escalated := rd.Escalated[:0]
+	for _, item := range rd.Escalated {
+		if !resolved(item.ID) {
+			escalated = append(escalated, item)
+		}
+	}
+	rd.Escalated = escalated
+}
+
+// riskStats counts day's risk hits against the review log, so confirmed
+// hits and whitelisted false positives show up in the summary. It returns
+// nil when no risk rules are configured.
+func (g *generator) riskStats(day string, msgs []chatlog.Message) *summarize.RiskStats {
+	if g.risk == nil {
+		return nil
+	}
+	store, err := risk.Open(filepath.Join(g.opts.dataDir, "risk_reviews.json"))
+	if err != nil {
+		log.Printf("warning: load risk reviews failed: %v", err)
+	}
+	hits := g.risk.Scan(day, msgs, store)
+	return risk.Stats(hits, len(store.List(day, risk.StatusFalsePositive)))
+}
+
+// refresh refetches the n days before day that already have raw data and
+// re-renders those whose message set changed. Failures only log warnings.
+func (g *generator) refresh(day string, n int) {
+	if n <= 0 {
+		return
+	}
+	span, err := archive.Window(day, n+1)
+	if err != nil {
+		log.Printf("warning: refresh: %v", err)
+		return
+	}
+	for _, d := range span[:n] {
+		if !archive.HasRaw(g.opts.dataDir, d) {
+			continue
+		}
+		changed, err := g.fetch(d)
+		if err != nil {
+			log.Printf("warning: refresh %s: %v", d, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		g.archiveMedia(d)
+		if _, err := g.render(d); err != nil {
+			log.Printf("warning: re-render %s: %v", d, err)
+		}
+	}
+}
+
+// usageMeter records LLM usage into dataDir's ledger at the llm.pricing
+// prices.
+func usageMeter(cfg config.Config, dataDir string) *usage.Meter {
+	p := cfg.LLM.Pricing
+	return usage.NewMeter(filepath.Join(dataDir, usage.FileName), p.Models, p.Currency)
+}
+
+// flushUsage adds the run's LLM usage to data/llm-usage.json and, with -v,
+// logs its cost next to today's and this month's.
+func (g *generator) flushUsage() {
+	if g.meter == nil {
+		return
+	}
+	ledger, err := g.meter.Flush()
+	if err != nil {
+		log.Printf("warning: record llm usage: %v", err)
+		return
+	}
+	run := g.meter.Total()
+	if !g.verbose || run.Requests == 0 {
+		return
+	}
+	now := time.Now()
+	cur := g.meter.Currency()
+	log.Printf("LLM usage: %d request(s), %d prompt + %d completion tokens, ~%.4f %s (today %.4f, %s %.4f)",
+		run.Requests, run.PromptTokens, run.CompletionTokens, run.Cost, cur,
+		ledger.Day(now.Format("2006-01-02")).Cost, now.Format("2006-01"), ledger.Month(now.Format("2006-01")).Cost)
+}
+
+// updateSite rebuilds the cross-day pages after day pages changed.
+func (g *generator) updateSite() error {
+	cfg := g.cfg
+	anon, err := g.redactor()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := anon.Save(); err != nil {
+			log.Printf("warning: save pseudonyms failed: %v", err)
+		}
+	}()
+	th := cfg.Report.Theme.For(g.opts.talker)
+	if err := render.WriteTheme(g.opts.siteDir, render.Theme{Mode: th.Mode, Accent: th.Accent, Light: th.Light, Dark: th.Dark}); err != nil {
+		return fmt.Errorf("write theme failed: %w", err)
+	}
+	if f := cfg.Report.Charts.EChartsFile; f != "" {
+		if err := render.InstallECharts(g.opts.siteDir, f); err != nil {
+			return fmt.Errorf("install echarts failed: %w", err)
+		}
+	}
+	if len(cfg.Tags) > 0 {
+		if err := render.UpdateTagTrends(g.opts.siteDir, g.opts.dataDir, cfg.Report.TagTrendDays); err != nil {
+			return fmt.Errorf("update tag trends failed: %w", err)
+		}
+	}
+	if !cfg.Report.DisableSearch {
+		if err := render.UpdateSearchIndex(g.opts.siteDir, g.opts.dataDir, anon); err != nil {
+			return fmt.Errorf("update search index failed: %w", err)
+		}
+	}
+	if a := cfg.Report.Assistant; a.Enabled {
+		if err := render.WriteAssistantPage(g.opts.siteDir, a.APIBaseURL); err != nil {
+			return fmt.Errorf("write assistant page failed: %w", err)
+		}
+	}
+	if err := render.UpdateLinkLibrary(g.opts.siteDir, g.opts.dataDir, anon, g.linkPreviews("", nil)); err != nil {
+		return fmt.Errorf("update link library failed: %w", err)
+	}
+	if err := g.updateKnowledgeBase(); err != nil {
+		return fmt.Errorf("update q&a knowledge base failed: %w", err)
+	}
+	if err := render.UpdateWeeklyReports(g.opts.siteDir, g.opts.dataDir); err != nil {
+		return fmt.Errorf("update weekly reports failed: %w", err)
+	}
+	if err := render.UpdateTopicTimelines(g.opts.siteDir, g.opts.dataDir); err != nil {
+		return fmt.Errorf("update topic timelines failed: %w", err)
+	}
+	if err := render.UpdatePeopleProfiles(g.opts.siteDir, g.opts.dataDir, anon, g.linkPreviews("", nil)); err != nil {
+		return fmt.Errorf("update people profiles failed: %w", err)
+	}
+	if err := render.UpdateMembershipSeries(g.opts.siteDir, g.opts.dataDir, cfg.Report.MemberBaseline); err != nil {
+		return fmt.Errorf("update membership series failed: %w", err)
+	}
+	if cfg.Report.Members.Enabled {
+		if err := render.UpdateMemberReports(g.opts.siteDir, g.opts.dataDir, memberOptions(cfg), anon); err != nil {
+			return fmt.Errorf("update member reports failed: %w", err)
+		}
+	}
+	// Update site index (recent days)
+	if err := render.UpdateHomeIndex(g.opts.siteDir, g.opts.dataDir, g.opts.recentDays); err != nil {
+		return fmt.Errorf("update home index failed: %w", err)
+	}
+	if err := render.UpdateManifest(g.opts.siteDir, g.opts.dataDir, version.Version); err != nil {
+		return fmt.Errorf("update build manifest failed: %w", err)
+	}
+	return nil
+}
+
+// updateKnowledgeBase folds every day's answered questions into data/qa.json
+// and renders site/qa. The JSON file outlives day pages, so entries survive
+// even if old days are later removed.
+func (g *generator) updateKnowledgeBase() error {
+	path := filepath.Join(g.opts.dataDir, "qa.json")
+	base, err := qa.Load(path)
+	if err != nil {
+		return err
+	}
+	days, err := archive.ReportDays(g.opts.dataDir, g.opts.siteDir)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, day := range days {
+		meta, err := archive.LoadMeta(g.opts.siteDir, day)
+		if err != nil {
+			continue
+		}
+		for _, item := range meta.Summary.ReplyDebt.Resolved {
+			if base.Add(day, item) {
+				changed = true
+			}
+		}
+	}
+	if changed {
+		if err := base.Save(path); err != nil {
+			return err
+		}
+	}
+	return render.UpdateQAPage(g.opts.siteDir, base)
+}
+
+// archiveMedia downloads day's images into data/media when enabled. Failures
+// are logged; pages fall back to the chatlog image URL for missing files.
+func (g *generator) archiveMedia(day string) {
+	if !g.cfg.Report.Media.Download {
+		return
+	}
+	raw, err := archive.LoadRaw(g.opts.dataDir, day)
+	if err != nil {
+		log.Printf("warning: archive media for %s: %v", day, err)
+		return
+	}
+	d := media.Downloader{
+		BaseURL:  firstNonEmpty(g.opts.imageBase, g.opts.baseURL),
+		Dir:      filepath.Join(g.opts.dataDir, "media"),
+		MaxBytes: int64(g.cfg.Report.Media.MaxMB) << 20,
+	}
+	res, err := d.Download(context.Background(), day, raw.Messages)
+	if err != nil {
+		log.Printf("warning: archive media for %s: %v", day, err)
+		return
+	}
+	if res.Failed > 0 {
+		log.Printf("warning: %d image(s) for %s could not be downloaded", res.Failed, day)
+	}
+	if g.verbose {
+		log.Printf("Media for %s: %d downloaded, %d already archived", day, res.Downloaded, res.Existing)
+	}
+}
+
+// publishMedia copies archived images for msgs next to the day page and
+// returns their page-relative URLs keyed by MD5.
+func (g *generator) publishMedia(day, dayDir string, msgs []chatlog.Message) map[string]string {
+	if !g.cfg.Report.Media.Download {
+		return nil
+	}
+	out := map[string]string{}
+	root := filepath.Join(g.opts.dataDir, "media")
+	for _, m := range msgs {
+		if m.MsgType != 3 || m.MediaMD5 == "" {
+			continue
+		}
+		src, ok := media.Find(root, day, m.MediaMD5)
+		if !ok {
+			continue
+		}
+		name := filepath.Base(src)
+		dst := filepath.Join(dayDir, "media", name)
+		if !fileExists(dst) {
+			if err := copyFile(src, dst); err != nil {
+				log.Printf("warning: publish %s: %v", src, err)
+				continue
+			}
+		}
+		out[m.MediaMD5] = "media/" + name
+	}
+	return out
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// a half-copied file must never replace a published one
+	out, err := atomicfile.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Commit()
+}
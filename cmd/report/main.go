@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,195 +11,513 @@ import (
 	"strings"
 	"time"
 
-	"wechat-view/internal/chatlog"
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
 	"wechat-view/internal/config"
-	"wechat-view/internal/insight"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/notify"
+	"wechat-view/internal/notify/email"
+	"wechat-view/internal/notify/mqtt"
 	"wechat-view/internal/render"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/subscribe"
 	"wechat-view/internal/summarize"
+	"wechat-view/internal/tags"
+	"wechat-view/internal/version"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
+		}
+	}
+
 	var (
 		cfgPath   = flag.String("config", "report.config.json", "Optional config file (JSON). Flags override its values.")
+		profile   = flag.String("profile", "", "Config profile to apply on top of the base config (e.g. prod)")
 		baseURL   = flag.String("base-url", "", "Base URL of local chatlog service (overrides config)")
 		dateStr   = flag.String("date", "", "Date to fetch, format YYYY-MM-DD (default: yesterday)")
+		fromStr   = flag.String("from", "", "First day of a batch run, YYYY-MM-DD; the run covers --from..--to")
+		toStr     = flag.String("to", "", "Last day of a batch run, YYYY-MM-DD (default: yesterday)")
+		workers   = flag.Int("workers", 0, "Days fetched in parallel by a batch run (overrides config report.workers)")
 		talker    = flag.String("talker", "", "Chat room or talker id, e.g., 27587714869@chatroom")
 		keyword   = flag.String("keyword", "", "Filter keyword (optional)")
 		dataDir   = flag.String("data-dir", "", "Directory to store raw daily JSON (overrides config)")
 		siteDir   = flag.String("site-dir", "", "Directory to store generated site (overrides config)")
 		imageBase = flag.String("image-base-url", "", "Local image base URL for inline images")
 		force     = flag.Bool("force", false, "Force re-fetch even if data exists")
+		noPublish = flag.Bool("no-publish", false, "Skip publishing at the end of the run")
+		dryRun    = flag.Bool("dry-run", false, "Print what the run would fetch, write and send to the LLM, without doing it")
+		refreshAI = flag.Bool("refresh-insights", false, "Call the LLM again even for days whose AI insights are cached")
 		verbose   = flag.Bool("v", false, "Verbose logging")
+		pprofDir  = flag.String("pprof", "", "Write CPU and heap profiles into this directory")
+		showVer   = flag.Bool("version", false, "Print version and exit")
 	)
 	flag.Parse()
 
-	cfg, err := config.Load(*cfgPath)
+	if *showVer {
+		fmt.Println(version.Version)
+		return
+	}
+
+	stopProfiling := startProfiling(*pprofDir)
+	defer stopProfiling()
+
+	cfg, err := config.LoadProfile(*cfgPath, *profile)
 	if err != nil {
 		log.Fatalf("load config failed: %v", err)
 	}
 	cfg.Defaults()
+	useTemplates(cfg)
+	cfg.Report.DataDir = firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	cfg.Report.SiteDir = firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+
+	if *toStr != "" && *fromStr == "" {
+		log.Fatal("--to needs --from")
+	}
+	if *fromStr != "" && *dateStr != "" {
+		log.Fatal("use either --date or --from/--to")
+	}
+	day := firstNonEmpty(*dateStr, *toStr)
+	if day == "" {
+		day = reportDay(time.Now(), cfg.Report.DayStartHour)
+	}
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		log.Fatal("invalid date format, expect YYYY-MM-DD")
+	}
+	if *fromStr != "" {
+		if _, err := time.Parse("2006-01-02", *fromStr); err != nil {
+			log.Fatal("invalid --from date, expect YYYY-MM-DD")
+		}
+		if *fromStr > day {
+			log.Fatalf("--from %s is after --to %s", *fromStr, day)
+		}
+	}
 
-	resolved := struct {
-		baseURL     string
-		talker      string
-		talkerLabel string
-		keyword     string
-		dataDir     string
-		siteDir     string
-		imageBase   string
-		recentDays  int
-		messageCap  int
-	}{
+	if *talker == "" && len(cfg.Talkers) > 0 {
+		args := os.Args[1:]
+		if *dateStr == "" && *fromStr == "" {
+			// Pin the day so every room reports on the same one.
+			args = append(args[:len(args):len(args)], "--date", day)
+		}
+		label := day
+		if *fromStr != "" {
+			label = *fromStr + ".." + day
+		}
+		code := runTalkers(cfg, args, label, *noPublish, *dryRun, *verbose)
+		stopProfiling()
+		os.Exit(code)
+	}
+	cfg = cfg.ForTalker(firstNonEmpty(*talker, cfg.Chatlog.Talker))
+	resolved := resolvedOptions{
 		baseURL:    firstNonEmpty(*baseURL, cfg.Chatlog.BaseURL, "http://127.0.0.1:5030"),
-		talker:     firstNonEmpty(*talker, cfg.Chatlog.Talker),
+		talker:     cfg.Chatlog.Talker,
 		keyword:    firstNonEmpty(*keyword, cfg.Chatlog.Keyword),
-		dataDir:    firstNonEmpty(*dataDir, cfg.Report.DataDir, "data"),
-		siteDir:    firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site"),
+		dataDir:    cfg.Report.DataDir,
+		siteDir:    cfg.Report.SiteDir,
 		imageBase:  firstNonEmpty(*imageBase, cfg.Chatlog.ImageBaseURL),
 		recentDays: cfg.Report.RecentDays,
 		messageCap: cfg.Report.MessagePreview,
 	}
 	if resolved.talker == "" {
-		log.Fatal("--talker is required (provide via flag or config.chatlog.talker)")
+		log.Fatal("--talker is required (provide via flag, config.chatlog.talker or config.talkers)")
 	}
 	resolved.talkerLabel = cfg.TalkerLabel(resolved.talker)
 
-	day := *dateStr
-	if day == "" {
-		// default to yesterday (local time)
-		day = time.Now().Add(-24 * time.Hour).Format("2006-01-02")
-	}
-
 	if *verbose {
 		label := resolved.talker
 		if resolved.talkerLabel != "" {
 			label = fmt.Sprintf("%s (%s)", resolved.talkerLabel, resolved.talker)
 		}
-		log.Printf("Fetching for date=%s talker=%s keyword=%s", day, label, resolved.keyword)
+		span := day
+		if *fromStr != "" {
+			span = *fromStr + ".." + day
+		}
+		log.Printf("Fetching for date=%s talker=%s keyword=%s", span, label, resolved.keyword)
+	}
+
+	tagger, err := tags.Compile(cfg.Tags)
+	if err != nil {
+		log.Fatalf("invalid tag rules: %v", err)
+	}
+	detector, err := risk.Compile(cfg.Risk.Rules, cfg.Risk.Allow)
+	if err != nil {
+		log.Fatalf("invalid risk rules: %v", err)
+	}
+	builder, err := summaryBuilder(cfg)
+	if err != nil {
+		log.Fatalf("init summarizer failed: %v", err)
+	}
+
+	if *dryRun {
+		g := &generator{cfg: cfg, opts: resolved, builder: builder, verbose: *verbose, noPublish: *noPublish, refreshInsights: *refreshAI}
+		days := []string{day}
+		if *fromStr != "" {
+			if days, err = archive.Window(day, dayCount(*fromStr, day)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		g.plan(days, *force, *fromStr == "")
+		return
 	}
 
 	// Ensure folders exist
 	mustMkdirAll(resolved.dataDir)
 	mustMkdirAll(resolved.siteDir)
+	sweepTempFiles(*verbose, resolved.dataDir, resolved.siteDir)
 
-	// Prepare paths
-	rawPath := filepath.Join(resolved.dataDir, fmt.Sprintf("%s.json", day))
-	if fileExists(rawPath) && !*force {
-		if *verbose {
-			log.Printf("Raw data exists: %s (use --force to refetch)", rawPath)
+	g := &generator{cfg: cfg, opts: resolved, tagger: tagger, risk: detector, builder: builder, verbose: *verbose, noPublish: *noPublish, refreshInsights: *refreshAI}
+	g.meter = usageMeter(cfg, resolved.dataDir)
+	if err := g.checkDisk(); err != nil {
+		log.Fatal(err)
+	}
+	if !cfg.Update.Disabled && version.Version != "dev" {
+		checker := version.Checker{
+			Repo:      cfg.Update.Repo,
+			CachePath: filepath.Join(cacheDir(resolved.dataDir), "latest-release.json"),
 		}
-	} else {
-		// Fetch from chatlog API
-		client := chatlog.Client{BaseURL: resolved.baseURL}
-		msgs, meta, err := client.FetchDay(day, resolved.talker, resolved.keyword)
-		if err != nil {
-			log.Fatalf("fetch failed: %v", err)
+		checkCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		rel, err := checker.Latest(checkCtx)
+		cancel()
+		switch {
+		case err != nil:
+			if *verbose {
+				log.Printf("update check failed: %v", err)
+			}
+		case version.Newer(rel.Tag, version.Version):
+			g.latest = rel
+			log.Printf("A newer wechat-view %s is available (running %s): %s", rel.Tag, version.Version, rel.URL)
 		}
-		// Persist raw
-		if err := writeJSON(rawPath, map[string]any{"date": day, "talker": resolved.talker, "keyword": resolved.keyword, "meta": meta, "messages": msgs}); err != nil {
-			log.Fatalf("write raw json failed: %v", err)
+	}
+
+	if *fromStr != "" {
+		n := *workers
+		if n <= 0 {
+			n = cfg.Report.Workers
 		}
+		// Batch runs only build the archive: no notifications and no
+		// refresh of the days before it.
+		code := g.runRange(*fromStr, day, *force, n)
+		stopProfiling()
+		os.Exit(code)
+	}
+
+	if rawPath, ok := archive.FindRaw(resolved.dataDir, day); ok && !*force {
 		if *verbose {
-			log.Printf("Saved raw: %s (%d messages)", rawPath, len(msgs))
+			log.Printf("Raw data exists: %s (use --force to refetch)", rawPath)
 		}
+	} else if _, err := g.fetch(day); err != nil {
+		log.Fatal(err)
 	}
+	g.archiveMedia(day)
 
-	// Read raw for summarization (ensures idempotency)
-	var raw struct {
-		Date     string            `json:"date"`
-		Talker   string            `json:"talker"`
-		Keyword  string            `json:"keyword"`
-		Meta     map[string]any    `json:"meta"`
-		Messages []chatlog.Message `json:"messages"`
+	res, err := g.render(day)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if err := readJSON(rawPath, &raw); err != nil {
-		log.Fatalf("read raw json failed: %v", err)
+	g.refresh(day, cfg.Report.RefreshDays)
+	g.flushUsage()
+	g.retention()
+	if err := g.updateSite(); err != nil {
+		log.Fatal(err)
 	}
+	// Publish before notifying, so the links in the digest resolve.
+	g.publish(day)
 
-	// Summarize
-	sum := summarize.BuildSummary(raw.Messages)
+	if *verbose {
+		log.Printf("Generated: %s and %s", res.htmlPath, res.metaPath)
+	}
 
-	// Optional AI insights
-	var insights insight.Result
-	var haveInsights bool
-	if cfg.LLM.Enabled && cfg.LLM.BaseURL != "" && cfg.LLM.Model != "" {
-		if *verbose {
-			log.Printf("Generating AI insights via %s (%s)", cfg.LLM.BaseURL, cfg.LLM.Model)
-		}
-		client := insight.Client{
-			BaseURL:     cfg.LLM.BaseURL,
-			Model:       cfg.LLM.Model,
-			APIKey:      cfg.LLM.APIKey,
-			Temperature: cfg.LLM.Temperature,
-			Timeout:     time.Duration(cfg.LLM.TimeoutSeconds) * time.Second,
-			MaxMessages: cfg.LLM.MaxMessages,
-			MaxChars:    cfg.LLM.MaxChars,
-		}
-		if res, err := client.Generate(context.Background(), day, firstNonEmpty(resolved.talkerLabel, raw.Talker, resolved.talker), sum, raw.Messages); err != nil {
-			if *verbose {
-				log.Printf("llm insights failed: %v", err)
+	targets := notifiers(cfg.Notify.TargetsFor(resolved.talker), resolved.talker)
+	if len(targets) > 0 || len(cfg.Notify.Subscriptions) > 0 || len(cfg.Watchlist) > 0 || len(cfg.Summarize.ReplyDebt.Owners) > 0 {
+		digest := notify.Digest{
+			Date:          day,
+			Talker:        firstNonEmpty(resolved.talkerLabel, res.raw.Talker, resolved.talker),
+			TotalMessages: res.summary.TotalMessages,
+			UniqueSenders: res.summary.UniqueSenders,
+			Highlights:    res.summary.Highlights,
+		}
+		if res.insights != nil {
+			digest.Overview = res.insights.Overview
+		}
+		if res.headline != nil {
+			digest.Headline = res.headline.Title
+		}
+		if base := strings.TrimRight(cfg.Notify.SiteBaseURL, "/"); base != "" {
+			digest.URL = base + "/" + archive.DayURL(day)
+		}
+		if b, err := os.ReadFile(res.htmlPath); err == nil {
+			digest.HTML = string(b)
+		}
+		if cfg.Notify.BroadcastTip {
+			if advice, err := render.RecentBroadcast(resolved.siteDir, day, render.BroadcastWindow); err == nil {
+				digest.BroadcastTip = advice.Tip()
+			}
+		}
+		if len(targets) > 0 {
+			if err := notify.SendAll(context.Background(), targets, digest); err != nil {
+				log.Printf("warning: notify failed: %v", err)
+			} else if *verbose {
+				log.Printf("Notified %d channel(s)", len(targets))
 			}
-		} else {
-			insights = res
-			haveInsights = true
+		}
+		notifySubscribers(cfg, resolved.talker, digest, res, *verbose)
+		notifyWatchAlerts(cfg, resolved.talker, digest, res, *verbose)
+		notifyEscalations(cfg, resolved.talker, digest, res, *verbose)
+		if cfg.Notify.WeeklyAwards && len(targets) > 0 {
+			notifyWeeklyAwards(cfg, resolved.siteDir, day, digest.Talker, targets, *verbose)
 		}
 	}
+}
 
-	// Render day page and meta
-	y, m, d, err := splitDate(day)
+// notifyWeeklyAwards posts the week's MVP and contributor awards once the
+// week's Sunday has been generated.
+func notifyWeeklyAwards(cfg config.Config, siteDir, day, talker string, targets []notify.Notifier, verbose bool) {
+	if t, err := time.Parse("2006-01-02", day); err != nil || t.Weekday() != time.Sunday {
+		return
+	}
+	rep, err := render.LoadWeeklyReport(siteDir, day)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("warning: load weekly report failed: %v", err)
+		return
 	}
-	dayDir := filepath.Join(resolved.siteDir, y, m, d)
-	mustMkdirAll(dayDir)
+	lines := rep.Awards.Lines()
+	if len(lines) == 0 {
+		if verbose {
+			log.Printf("Weekly awards %s: nobody qualified", rep.Week)
+		}
+		return
+	}
+	d := notify.Digest{
+		Kind:          notify.KindWeeklyAwards,
+		Date:          rep.From + i18n.T(" 至 ") + rep.To,
+		Talker:        talker,
+		Week:          rep.Week,
+		TotalMessages: rep.TotalMessages,
+		Highlights:    lines,
+	}
+	if base := strings.TrimRight(cfg.Notify.SiteBaseURL, "/"); base != "" {
+		d.URL = base + "/weekly/" + rep.Week + ".html"
+	}
+	if err := notify.SendAll(context.Background(), targets, d); err != nil {
+		log.Printf("warning: notify weekly awards failed: %v", err)
+	} else if verbose {
+		log.Printf("Weekly awards %s: notified %d channel(s)", rep.Week, len(targets))
+	}
+}
 
-	dayHTML := filepath.Join(dayDir, "index.html")
-	dayMeta := filepath.Join(dayDir, "meta.json")
+// notifyWatchAlerts pushes one alert per watchlist rule whose hits reached
+// its threshold, to the rule's own targets or else the talker's.
+func notifyWatchAlerts(cfg config.Config, talker string, base notify.Digest, res dayResult, verbose bool) {
+	for _, hit := range res.summary.Watch {
+		if !hit.Alert() {
+			continue
+		}
+		var targets []notify.Notifier
+		for _, rule := range cfg.Watchlist {
+			if strings.TrimSpace(rule.Name) == hit.Name {
+				targets = notifiers(rule.NotifyTargets, talker)
+				break
+			}
+		}
+		if len(targets) == 0 {
+			targets = notifiers(cfg.Notify.TargetsFor(talker), talker)
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		d := notify.Digest{
+			Kind:          notify.KindWatchAlert,
+			Date:          base.Date,
+			Talker:        base.Talker,
+			URL:           base.URL,
+			Alert:         hit.Name,
+			Threshold:     hit.Threshold,
+			TotalMessages: hit.Hits,
+		}
+		for _, m := range hit.Messages {
+			line := m.Sender + "：" + m.Text
+			if m.At != "" {
+				line = m.At + " " + line
+			}
+			d.Highlights = append(d.Highlights, line)
+		}
+		if err := notify.SendAll(context.Background(), targets, d); err != nil {
+			log.Printf("warning: notify watchlist alert %q failed: %v", hit.Name, err)
+		} else if verbose {
+			log.Printf("Watchlist %q: %d hit(s), alerted %d channel(s)", hit.Name, hit.Hits, len(targets))
+		}
+	}
+}
 
-	ctx := render.DayContext{
-		Date:         day,
-		Talker:       raw.Talker,
-		TalkerLabel:  resolved.talkerLabel,
-		Keyword:      raw.Keyword,
-		Summary:      sum,
-		Messages:     raw.Messages,
-		ImageBaseURL: resolved.imageBase,
-		MessageLimit: resolved.messageCap,
-	}
-	if haveInsights {
-		ctx.AIInsights = &render.AIInsights{
-			Overview:      insights.Overview,
-			Highlights:    insights.Highlights,
-			Opportunities: insights.Opportunities,
-			Risks:         insights.Risks,
-			Actions:       insights.Actions,
-			Spotlight:     insights.Spotlight,
-		}
-	}
-	if err := render.DayHTML(dayHTML, ctx); err != nil {
-		log.Fatalf("render day html failed: %v", err)
-	}
-	metaPayload := map[string]any{
-		"date":    day,
-		"talker":  raw.Talker,
-		"keyword": raw.Keyword,
-		"summary": sum,
-	}
-	if haveInsights {
-		metaPayload["aiInsights"] = insights
-	}
-	if err := writeJSON(dayMeta, metaPayload); err != nil {
-		log.Fatalf("write day meta failed: %v", err)
+// notifyEscalations tells the talker's reply-debt owner about questions
+// escalated today, on the owner's channels or else the talker's.
+func notifyEscalations(cfg config.Config, talker string, base notify.Digest, res dayResult, verbose bool) {
+	owner, ok := cfg.Summarize.ReplyDebt.Owners[talker]
+	if !ok || strings.TrimSpace(owner.Name) == "" {
+		return
+	}
+	var fresh []summarize.ReplyItem
+	for _, item := range res.summary.ReplyDebt.Escalated {
+		if item.EscalatedOn == base.Date {
+			fresh = append(fresh, item)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+	targets := notifiers(owner.NotifyTargets, talker)
+	if len(targets) == 0 {
+		targets = notifiers(cfg.Notify.TargetsFor(talker), talker)
+	}
+	if len(targets) == 0 {
+		return
+	}
+	d := notify.Digest{
+		Kind:          notify.KindEscalation,
+		Date:          base.Date,
+		Talker:        base.Talker,
+		URL:           base.URL,
+		EscalatedTo:   firstNonEmpty(fresh[0].Owner, owner.Name),
+		Threshold:     int(cfg.Summarize.ReplyDebt.EscalateAfterHours),
+		TotalMessages: len(fresh),
+	}
+	for i, item := range fresh {
+		if i == 10 {
+			d.Highlights = append(d.Highlights, i18n.Tf("另有 %d 个问题，详见日报", len(fresh)-i))
+			break
+		}
+		d.Highlights = append(d.Highlights, i18n.Tf("%s %s：%s（已等待 %.0f 小时）", item.Date, item.Questioner, item.Question, item.AgeMinutes/60))
+	}
+	if err := notify.SendAll(context.Background(), targets, d); err != nil {
+		log.Printf("warning: notify reply-debt escalation failed: %v", err)
+	} else if verbose {
+		log.Printf("Escalated %d question(s) to %s on %d channel(s)", len(fresh), d.EscalatedTo, len(targets))
+	}
+}
+
+// notifySubscribers sends every matching subscription its personalised
+// digest; subscribers whose keywords did not come up today get nothing.
+func notifySubscribers(cfg config.Config, talker string, base notify.Digest, res dayResult, verbose bool) {
+	for _, sub := range cfg.Notify.Subscriptions {
+		if !sub.Covers(talker) {
+			continue
+		}
+		targets := notifiers(sub.NotifyTargets, talker)
+		if len(targets) == 0 {
+			continue
+		}
+		d, ok := subscribe.Digest(sub.Keywords, base, res.raw.Messages, res.summary)
+		if !ok {
+			if verbose {
+				log.Printf("Subscription %q: nothing about %v today", sub.Name, sub.Keywords)
+			}
+			continue
+		}
+		if err := notify.SendAll(context.Background(), targets, d); err != nil {
+			log.Printf("warning: notify subscription %q failed: %v", sub.Name, err)
+		} else if verbose {
+			log.Printf("Subscription %q: sent %d message(s) to %d channel(s)", sub.Name, d.TotalMessages, len(targets))
+		}
 	}
+}
 
-	// Update site index (recent days)
-	if err := render.UpdateHomeIndex(resolved.siteDir, resolved.dataDir, resolved.recentDays); err != nil {
-		log.Fatalf("update home index failed: %v", err)
+// notifiers builds the configured notification channels.
+func notifiers(t config.NotifyTargets, talker string) []notify.Notifier {
+	var out []notify.Notifier
+	if t.WeCom.WebhookURL != "" {
+		out = append(out, notify.WeCom{WebhookURL: t.WeCom.WebhookURL})
+	}
+	if t.DingTalk.WebhookURL != "" {
+		out = append(out, notify.DingTalk{WebhookURL: t.DingTalk.WebhookURL, Secret: t.DingTalk.Secret})
+	}
+	if t.Feishu.WebhookURL != "" {
+		out = append(out, notify.Feishu{WebhookURL: t.Feishu.WebhookURL, Secret: t.Feishu.Secret})
+	}
+	if e := t.Email; e.Host != "" && len(e.To) > 0 {
+		subject := e.Subject
+		if s, ok := e.Subjects[talker]; ok && s != "" {
+			subject = s
+		}
+		out = append(out, email.Sender{
+			Host:               e.Host,
+			Port:               e.Port,
+			Username:           e.Username,
+			Password:           e.Password,
+			From:               e.From,
+			To:                 e.To,
+			TLS:                e.TLS,
+			InsecureSkipVerify: e.InsecureSkipVerify,
+			Subject:            subject,
+		})
 	}
+	if m := t.MQTT; m.Broker != "" {
+		out = append(out, mqtt.Publisher{
+			Broker:             m.Broker,
+			Topic:              m.Topic,
+			Username:           m.Username,
+			Password:           m.Password,
+			ClientID:           m.ClientID,
+			QoS:                m.QoS,
+			Retain:             m.Retain,
+			DiscoveryPrefix:    m.DiscoveryPrefix,
+			InsecureSkipVerify: m.InsecureSkipVerify,
+		})
+	}
+	return out
+}
 
-	if *verbose {
-		log.Printf("Generated: %s and %s", dayHTML, dayMeta)
+// summaryBuilder maps the summarize config section onto a summarize.Builder.
+func summaryBuilder(cfg config.Config) (summarize.Builder, error) {
+	tokenizer, err := summarize.NewTokenizer(cfg.Summarize.Tokenizer, cfg.Summarize.UserDict)
+	if err != nil {
+		return summarize.Builder{}, err
 	}
+	lex := summarize.Lexicon{}
+	if cfg.Summarize.LexiconFile != "" {
+		if lex, err = summarize.LoadLexicon(cfg.Summarize.LexiconFile); err != nil {
+			return summarize.Builder{}, err
+		}
+	}
+	lex = lex.Merge(summarize.Lexicon{
+		Stopwords: cfg.Summarize.Stopwords,
+		Positive:  cfg.Summarize.PositiveWords,
+		Negative:  cfg.Summarize.NegativeWords,
+		Emoji:     cfg.Summarize.EmojiSentiment,
+	})
+	b := summarize.Builder{Tokenizer: tokenizer, Lexicon: lex}
+	ac := cfg.Summarize.Announcements
+	b.Announce = summarize.AnnounceRules{Admins: ac.Admins, MinChars: ac.MinChars, MinMentions: ac.MinMentions}
+	rd := cfg.Summarize.ReplyDebt
+	b.ReplyMatch = summarize.ReplyMatch{
+		Threshold: rd.SimilarityThreshold,
+		Window:    time.Duration(rd.MatchWindowMinutes) * time.Minute,
+	}
+	if len(cfg.Watchlist) > 0 {
+		rules := make([]summarize.WatchRule, len(cfg.Watchlist))
+		for i, r := range cfg.Watchlist {
+			rules[i] = r.WatchRule
+		}
+		if b.Watchlist, err = summarize.NewWatchlist(rules); err != nil {
+			return summarize.Builder{}, err
+		}
+	}
+	if len(cfg.Summarize.Entities) > 0 {
+		if b.Entities, err = summarize.NewEntityExtractor(cfg.Summarize.Entities); err != nil {
+			return summarize.Builder{}, err
+		}
+	}
+	if nc := cfg.Summarize.Normalize; nc.Traditional || nc.FullWidth || nc.LowerURLs {
+		b.Normalizer = summarize.NewNormalizer(nc.Traditional, nc.FullWidth, nc.LowerURLs)
+		if nc.T2SFile != "" {
+			if err := b.Normalizer.LoadFile(nc.T2SFile); err != nil {
+				return summarize.Builder{}, err
+			}
+		}
+	}
+	return b, nil
 }
 
 func mustMkdirAll(p string) {
@@ -215,37 +532,24 @@ func fileExists(p string) bool {
 }
 
 func writeJSON(p string, v any) error {
-	tmp := p + ".tmp"
-	f, err := os.Create(tmp)
+	f, err := atomicfile.Create(p)
 	if err != nil {
 		return err
 	}
+	defer f.Abort()
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(v); err != nil {
-		f.Close()
 		return err
 	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-	return os.Rename(tmp, p)
+	return f.Commit()
 }
 
-func readJSON(p string, v any) error {
-	b, err := os.ReadFile(p)
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(b, v)
-}
-
-func splitDate(s string) (string, string, string, error) {
-	parts := strings.Split(s, "-")
-	if len(parts) != 3 {
-		return "", "", "", errors.New("invalid date format, expect YYYY-MM-DD")
-	}
-	return parts[0], parts[1], parts[2], nil
+// reportDay is yesterday's date at now, counting days from startHour
+// (report.dayStartHour) instead of midnight, so a run before the boundary
+// does not pick a report day that is still going on.
+func reportDay(now time.Time, startHour int) string {
+	return now.Add(-time.Duration(startHour)*time.Hour).AddDate(0, 0, -1).Format("2006-01-02")
 }
 
 func firstNonEmpty(vals ...string) string {
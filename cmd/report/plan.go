@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/config"
+	"wechat-view/internal/render"
+)
+
+// plan prints what a run over days would do, for --dry-run: what it fetches
+// from chatlog, which files it writes or overwrites, and whether and how
+// heavily it calls the LLM. Nothing is written and the LLM is not called;
+// days without a raw file (or all of them with force) are fetched into
+// memory to count their messages. notify is false for batch runs, which
+// send nothing.
+func (g *generator) plan(days []string, force, notify bool) {
+	label := g.opts.talker
+	if g.opts.talkerLabel != "" {
+		label = fmt.Sprintf("%s (%s)", g.opts.talkerLabel, g.opts.talker)
+	}
+	fmt.Printf("Dry run for %s: nothing is written and the LLM is not called\n", label)
+	for _, day := range days {
+		fmt.Println(day)
+		msgs, ok := g.planFetch(day, force)
+		dayDir := archive.DayDir(g.opts.siteDir, day)
+		if !g.metaOnly {
+			planWrite(filepath.Join(dayDir, "index.html"))
+			planWrite(filepath.Join(dayDir, render.WidgetName))
+			if g.cfg.Report.PDF.Enabled {
+				planWrite(filepath.Join(dayDir, "report.pdf"))
+			}
+		}
+		planWrite(filepath.Join(dayDir, "meta.json"))
+		if ok {
+			g.planLLM(day, msgs)
+		}
+	}
+
+	fmt.Println("site")
+	if n := g.cfg.Report.RefreshDays; n > 0 && notify {
+		planStep("refresh", "refetch the %d day(s) before the last, re-rendering those whose messages changed", n)
+	}
+	pages := []string{"index.html", render.ThemeFile, render.ManifestName, "membership.json", "links", "qa", "weekly", "topics", "people"}
+	if !g.cfg.Report.DisableSearch {
+		pages = append(pages, "search.html", "search-index.json")
+	}
+	if len(g.cfg.Tags) > 0 {
+		pages = append(pages, "tags")
+	}
+	if g.cfg.Report.Members.Enabled {
+		pages = append(pages, "members")
+	}
+	if g.cfg.Report.Assistant.Enabled {
+		pages = append(pages, "assistant.html")
+	}
+	planStep("rebuild", "cross-day pages in %s: %s", g.opts.siteDir, strings.Join(pages, ", "))
+
+	if !g.noPublish {
+		planPublish(g.cfg)
+	}
+	if notify {
+		var names []string
+		for _, n := range notifiers(g.cfg.Notify.TargetsFor(g.opts.talker), g.opts.talker) {
+			names = append(names, n.Name())
+		}
+		if len(names) > 0 {
+			planStep("notify", "%s", strings.Join(names, ", "))
+		}
+		if n := len(g.cfg.Notify.Subscriptions); n > 0 {
+			planStep("notify", "%d subscription(s), if they match the day", n)
+		}
+	}
+}
+
+// planFetch prints where day's messages come from and returns them; ok is
+// false when chatlog could not be reached.
+func (g *generator) planFetch(day string, force bool) ([]chatlog.Message, bool) {
+	rawPath, exists := archive.FindRaw(g.opts.dataDir, day)
+	if exists && !force {
+		raw, err := archive.LoadRaw(g.opts.dataDir, day)
+		if err != nil {
+			planStep("read", "%s: %v", rawPath, err)
+			return nil, false
+		}
+		planStep("reuse", "%s, %d messages (--force refetches)", rawPath, len(raw.Messages))
+		return raw.Messages, true
+	}
+	client := chatlog.Client{
+		BaseURL:          g.opts.baseURL,
+		MaxMessages:      g.cfg.Chatlog.MaxMessages,
+		MaxResponseBytes: int64(g.cfg.Chatlog.MaxResponseMB) << 20,
+	}
+	msgs, _, err := client.FetchReportDayContext(context.Background(), day, g.cfg.Report.DayStartHour, g.opts.talker, g.opts.keyword)
+	if err != nil {
+		planStep("fetch", "%s, talker %s: %v", g.opts.baseURL, g.opts.talker, err)
+		return nil, false
+	}
+	what := "talker " + g.opts.talker
+	if g.opts.keyword != "" {
+		what += fmt.Sprintf(", keyword %q", g.opts.keyword)
+	}
+	planStep("fetch", "%s, %s: %d messages", g.opts.baseURL, what, len(msgs))
+	if exists {
+		planStep("write", "%s (overwrite)", rawPath)
+	} else {
+		planWrite(archive.RawPath(g.opts.dataDir, day))
+	}
+	return msgs, true
+}
+
+// planLLM prints the calls render would make to the LLM for day.
+func (g *generator) planLLM(day string, msgs []chatlog.Message) {
+	if g.reuseInsights {
+		planStep("llm", "none; AI insights are kept from meta.json")
+		return
+	}
+	if arms := g.insightArms(); len(arms) == 0 {
+		planStep("llm", "none (llm.enabled is off)")
+	} else {
+		if anon, err := g.redactor(); err == nil {
+			msgs = anon.Messages(msgs)
+		}
+		builder := g.builder
+		builder.Watchlist = builder.Watchlist.For(g.opts.talker)
+		sum := builder.Build(msgs)
+		talker := firstNonEmpty(g.opts.talkerLabel, g.opts.talker)
+		data := archive.Fingerprint(msgs)
+		for _, arm := range arms {
+			if _, ok := g.insightCache().Get(arm.Client.Key(day, g.opts.talker, data, sum)); ok && !g.refreshInsights {
+				planStep("llm", "%s: cached for these messages, not called (--refresh-insights calls it)", arm.Client.Model)
+				continue
+			}
+			sampled, tokens, err := arm.Client.Estimate(day, talker, sum, msgs)
+			if err != nil {
+				planStep("llm", "%s: %v", arm.Client.Model, err)
+				continue
+			}
+			if n := arm.Client.Chunks(msgs); n > 0 {
+				planStep("llm", "%s at %s: %d messages in %d chunk requests plus one to combine them, ~%d input tokens", arm.Client.Model, arm.Client.BaseURL, sampled, n, tokens)
+				continue
+			}
+			planStep("llm", "%s at %s: %d of %d messages sampled, ~%d input tokens", arm.Client.Model, arm.Client.BaseURL, sampled, len(msgs), tokens)
+		}
+		if fallbacks := arms[0].Client.Fallbacks; len(fallbacks) > 0 {
+			models := make([]string, len(fallbacks))
+			for i, f := range fallbacks {
+				models[i] = f.Model
+			}
+			planStep("llm", "if %s fails: %s, in that order", arms[0].Client.Model, strings.Join(models, ", "))
+		}
+		if g.cfg.LLM.RefineActions && len(sum.ActionItems) > 0 {
+			planStep("llm", "refine %d action item(s)", len(sum.ActionItems))
+		}
+		if g.cfg.LLM.TopicDeepDive && len(sum.Topics) > 0 {
+			planStep("llm", "deep dives into %d topic(s)", len(sum.Topics))
+		}
+		if g.cfg.LLM.Headline {
+			planStep("llm", "headline and share text")
+		}
+	}
+	if client, ok := g.embeddingsClient(); ok {
+		planStep("llm", "embeddings with %s for topics (up to %d messages)", client.Model, g.cfg.LLM.Embeddings.MaxMessages)
+	}
+}
+
+// planPublish prints where publishSite would send the site.
+func planPublish(cfg config.Config) {
+	var targets []string
+	if remoteStore(cfg.Storage.Remote) != nil {
+		targets = append(targets, "storage.remote")
+	}
+	if cfg.Publish.Git.Enabled {
+		targets = append(targets, "publish.git")
+	}
+	for _, t := range uploadTargets(cfg) {
+		targets = append(targets, "publish."+t.Name())
+	}
+	if len(targets) > 0 {
+		planStep("publish", "%s", strings.Join(targets, ", "))
+	}
+}
+
+// planWrite prints that path would be written, and whether that replaces
+// an existing file.
+func planWrite(path string) {
+	if _, err := os.Stat(path); err == nil {
+		planStep("write", "%s (overwrite)", path)
+	} else {
+		planStep("write", "%s (new)", path)
+	}
+}
+
+func planStep(step, format string, args ...any) {
+	fmt.Printf("  %-8s %s\n", step, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// startProfiling writes cpu-<ts>.pprof while the run is in progress and a
+// heap-<ts>.pprof snapshot when the returned stop function is called.
+func startProfiling(dir string) func() {
+	if dir == "" {
+		return func() {}
+	}
+	mustMkdirAll(dir)
+	stamp := time.Now().Format("20060102-150405")
+	cpuPath := filepath.Join(dir, "cpu-"+stamp+".pprof")
+	cpu, err := os.Create(cpuPath)
+	if err != nil {
+		log.Fatalf("create cpu profile failed: %v", err)
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		log.Fatalf("start cpu profile failed: %v", err)
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		cpu.Close()
+		heapPath := filepath.Join(dir, "heap-"+stamp+".pprof")
+		heap, err := os.Create(heapPath)
+		if err != nil {
+			log.Printf("create heap profile failed: %v", err)
+			return
+		}
+		defer heap.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(heap); err != nil {
+			log.Printf("write heap profile failed: %v", err)
+			return
+		}
+		log.Printf("Profiles written: %s, %s", cpuPath, heapPath)
+	}
+}
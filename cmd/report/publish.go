@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/config"
+	"wechat-view/internal/publish"
+	"wechat-view/internal/storage"
+)
+
+// remoteStore returns the storage.remote bucket, nil when it is off.
+func remoteStore(r config.RemoteStorageConfig) *storage.S3 {
+	if !r.Enabled {
+		return nil
+	}
+	return &storage.S3{
+		Endpoint:        r.Endpoint,
+		Region:          r.Region,
+		Bucket:          r.Bucket,
+		AccessKeyID:     r.AccessKeyID,
+		SecretAccessKey: r.SecretAccessKey,
+		SessionToken:    r.SessionToken,
+		PathStyle:       r.PathStyle,
+		CacheControl:    r.CacheControl,
+		HTTP:            &http.Client{Timeout: time.Duration(r.TimeoutSeconds) * time.Second},
+	}
+}
+
+// keyPrefix turns a configured prefix into "dir/" form; empty stays empty.
+func keyPrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// syncRemote uploads what changed in siteDir, and in dataDir when
+// storage.remote.data is set, to the storage.remote bucket.
+func syncRemote(cfg config.Config, dataDir, siteDir string, verbose bool) error {
+	r := cfg.Storage.Remote
+	store := remoteStore(r)
+	if store == nil {
+		return nil
+	}
+	ctx := context.Background()
+	sitePrefix, dataPrefix := keyPrefix(r.SitePrefix), keyPrefix(r.DataPrefix)
+	var keep []string
+	if r.Data {
+		keep = append(keep, dataPrefix)
+	}
+	res, err := storage.Sync(ctx, store, siteDir, sitePrefix, storage.SyncOptions{Prune: r.Prune, Keep: keep})
+	logSync("site", res, r.Bucket+"/"+sitePrefix, verbose)
+	if err != nil {
+		return fmt.Errorf("sync site: %w", err)
+	}
+	if !r.Data {
+		return nil
+	}
+	res, err = storage.Sync(ctx, store, dataDir, dataPrefix, storage.SyncOptions{
+		Prune: r.Prune,
+		Keep:  []string{sitePrefix},
+		// Skip the build cache, the publish clones and cmd/api's ACME keys.
+		Skip: func(rel string) bool {
+			return strings.HasPrefix(rel, ".cache/") || strings.HasPrefix(rel, ".publish/") || strings.HasPrefix(rel, "acme/")
+		},
+	})
+	logSync("data", res, r.Bucket+"/"+dataPrefix, verbose)
+	if err != nil {
+		return fmt.Errorf("sync data: %w", err)
+	}
+	return nil
+}
+
+func logSync(what string, res storage.SyncResult, dest string, verbose bool) {
+	if res.Uploaded == 0 && res.Deleted == 0 && !verbose {
+		return
+	}
+	log.Printf("Synced %s to %s: %d uploaded (%s), %d unchanged, %d deleted", what, dest, res.Uploaded, byteCount(res.Bytes), res.Unchanged, res.Deleted)
+}
+
+// publish uploads the run's output to storage.remote, commits it for
+// publish.git and uploads it to publish.webdav and publish.sftp, whichever
+// are enabled; label names the run (a day or a range) in commit messages.
+// Failures are logged: the local site is complete either way and the next
+// run catches up.
+func (g *generator) publish(label string) {
+	if g.noPublish {
+		return
+	}
+	publishSite(g.cfg, g.opts.dataDir, g.opts.siteDir, publish.MessageData{Date: label, Talker: firstNonEmpty(g.opts.talkerLabel, g.opts.talker)}, g.verbose)
+}
+
+// publishSite is the publish step of a run over dataDir and siteDir;
+// failures are logged, not fatal.
+func publishSite(cfg config.Config, dataDir, siteDir string, md publish.MessageData, verbose bool) {
+	if err := syncRemote(cfg, dataDir, siteDir, verbose); err != nil {
+		log.Printf("warning: storage.remote: %v", err)
+	}
+	if err := publishGit(cfg, dataDir, siteDir, md, verbose); err != nil {
+		log.Printf("warning: publish.git: %v", err)
+	}
+	for _, t := range uploadTargets(cfg) {
+		if err := uploadSite(t, dataDir, siteDir, verbose); err != nil {
+			log.Printf("warning: publish.%s: %v", t.Name(), err)
+		}
+	}
+}
+
+// uploadTarget is an enabled publish.webdav or publish.sftp target.
+type uploadTarget struct {
+	publish.Uploader
+	timeout time.Duration
+}
+
+// uploadTargets returns the enabled upload targets.
+func uploadTargets(cfg config.Config) []uploadTarget {
+	var out []uploadTarget
+	if w := cfg.Publish.WebDAV; w.Enabled {
+		timeout := time.Duration(w.TimeoutSeconds) * time.Second
+		out = append(out, uploadTarget{publish.WebDAV{URL: w.URL, Username: w.Username, Password: w.Password, HTTP: &http.Client{Timeout: timeout}}, timeout})
+	}
+	if s := cfg.Publish.SFTP; s.Enabled {
+		out = append(out, uploadTarget{publish.SFTP{
+			Host:         s.Host,
+			Port:         s.Port,
+			User:         s.User,
+			IdentityFile: s.IdentityFile,
+			Dir:          s.Dir,
+			Command:      s.Command,
+		}, time.Duration(s.TimeoutSeconds) * time.Second})
+	}
+	return out
+}
+
+// uploadSite uploads the site files that changed since the last upload to
+// t, remembering what was sent in <dataDir>/.publish/<name>.json.
+func uploadSite(t uploadTarget, dataDir, siteDir string, verbose bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	res, err := publish.Incremental(ctx, t, siteDir, filepath.Join(dataDir, ".publish", t.Name()+".json"))
+	if err != nil {
+		return err
+	}
+	if res.Uploaded > 0 || verbose {
+		log.Printf("Uploaded %d changed file(s) to %s, %d unchanged", res.Uploaded, t.Name(), res.Unchanged)
+	}
+	return nil
+}
+
+// gitPublisher returns the publish.git target, nil when it is off.
+func gitPublisher(cfg config.Config, dataDir string) *publish.Git {
+	c := cfg.Publish.Git
+	if !c.Enabled {
+		return nil
+	}
+	return &publish.Git{
+		Remote:      c.Remote,
+		Branch:      c.Branch,
+		Dir:         firstNonEmpty(c.Dir, filepath.Join(dataDir, ".publish", "git")),
+		Message:     c.Message,
+		AuthorName:  c.AuthorName,
+		AuthorEmail: c.AuthorEmail,
+		CNAME:       c.CNAME,
+	}
+}
+
+// publishGit commits and pushes siteDir for publish.git.
+func publishGit(cfg config.Config, dataDir, siteDir string, data publish.MessageData, verbose bool) error {
+	g := gitPublisher(cfg, dataDir)
+	if g == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Publish.Git.TimeoutSeconds)*time.Second)
+	defer cancel()
+	res, err := g.Publish(ctx, siteDir, data)
+	if err != nil {
+		return err
+	}
+	if res.Commit != "" {
+		log.Printf("Published %d changed file(s) as %s to %s", res.Files, res.Commit, firstNonEmpty(cfg.Publish.Git.Branch, "gh-pages"))
+	} else if verbose {
+		log.Printf("Nothing to publish: the site is unchanged")
+	}
+	return nil
+}
+
+// runPublish publishes the current site to every enabled publish target
+// without generating anything, e.g. after a failed push.
+func runPublish(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	label := fs.String("date", "", "What the commit message calls the update (default: today)")
+	_ = fs.Parse(args)
+
+	cfg := loadConfig(*cfgPath, *profile)
+	targets := uploadTargets(cfg)
+	if !cfg.Publish.Git.Enabled && len(targets) == 0 {
+		log.Printf("none of publish.git, publish.webdav and publish.sftp is enabled")
+		os.Exit(2)
+	}
+	data := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	site := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	md := publish.MessageData{
+		Date:   firstNonEmpty(*label, time.Now().Format("2006-01-02")),
+		Talker: firstNonEmpty(cfg.TalkerLabel(cfg.Chatlog.Talker), cfg.Chatlog.Talker),
+	}
+	failed := false
+	if err := publishGit(cfg, data, site, md, true); err != nil {
+		log.Printf("publish.git failed: %v", err)
+		failed = true
+	}
+	for _, t := range targets {
+		if err := uploadSite(t, data, site, true); err != nil {
+			log.Printf("publish.%s failed: %v", t.Name(), err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runSync uploads the data and site directories to storage.remote without
+// generating anything, e.g. after switching the bucket.
+func runSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	verbose := fs.Bool("v", false, "Verbose logging")
+	_ = fs.Parse(args)
+
+	cfg := loadConfig(*cfgPath, *profile)
+	if !cfg.Storage.Remote.Enabled {
+		log.Printf("storage.remote is not enabled")
+		os.Exit(2)
+	}
+	data := firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	site := firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	if err := syncRemote(cfg, data, site, *verbose); err != nil {
+		log.Fatalf("sync failed: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/tags"
+)
+
+// runRecalc recomputes summaries for stored days with the current algorithm
+// and config, without refetching or calling the LLM; existing AI insights
+// are carried over from meta.json.
+func runRecalc(args []string) {
+	fs := flag.NewFlagSet("recalc", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	from := fs.String("from", "", "First day to recalculate, YYYY-MM-DD (default: oldest raw file)")
+	to := fs.String("to", "", "Last day to recalculate, YYYY-MM-DD (default: newest raw file)")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	metaOnly := fs.Bool("meta-only", false, "Only rewrite meta.json, keep existing day pages and PDFs")
+	talker := fs.String("talker", "", "Talker of config.talkers to recalculate (default: all of them)")
+	noPublish := fs.Bool("no-publish", false, "Skip publishing at the end of the run")
+	verbose := fs.Bool("v", false, "Verbose logging")
+	_ = fs.Parse(args)
+
+	for _, d := range []string{*from, *to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			log.Fatalf("invalid date %q, expect YYYY-MM-DD", d)
+		}
+	}
+
+	cfg := loadConfig(*cfgPath, *profile)
+	cfg.Report.DataDir = firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	cfg.Report.SiteDir = firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	if *talker == "" && len(cfg.Talkers) > 0 {
+		os.Exit(runTalkers(cfg, append([]string{"recalc"}, args...), "recalc", *noPublish, false, *verbose))
+	}
+	cfg = cfg.ForTalker(firstNonEmpty(*talker, cfg.Chatlog.Talker))
+	opts := resolvedOptions{
+		talker:     cfg.Chatlog.Talker,
+		dataDir:    cfg.Report.DataDir,
+		siteDir:    cfg.Report.SiteDir,
+		imageBase:  cfg.Chatlog.ImageBaseURL,
+		recentDays: cfg.Report.RecentDays,
+		messageCap: cfg.Report.MessagePreview,
+	}
+	tagger, err := tags.Compile(cfg.Tags)
+	if err != nil {
+		log.Fatalf("invalid tag rules: %v", err)
+	}
+	detector, err := risk.Compile(cfg.Risk.Rules, cfg.Risk.Allow)
+	if err != nil {
+		log.Fatalf("invalid risk rules: %v", err)
+	}
+	builder, err := summaryBuilder(cfg)
+	if err != nil {
+		log.Fatalf("init summarizer failed: %v", err)
+	}
+	g := &generator{
+		cfg:           cfg,
+		opts:          opts,
+		tagger:        tagger,
+		risk:          detector,
+		builder:       builder,
+		verbose:       *verbose,
+		reuseInsights: true,
+		metaOnly:      *metaOnly,
+		noPublish:     *noPublish,
+	}
+
+	sweepTempFiles(*verbose, opts.dataDir, opts.siteDir)
+	days, err := archive.ListDays(opts.dataDir)
+	if err != nil {
+		log.Fatalf("list raw days failed: %v", err)
+	}
+	done := 0
+	var failed []string
+	for _, day := range days {
+		if (*from != "" && day < *from) || (*to != "" && day > *to) {
+			continue
+		}
+		if err := g.checkDisk(); err != nil {
+			log.Fatalf("stopped before %s: %v", day, err)
+		}
+		if _, err := g.render(day); err != nil {
+			log.Printf("warning: recalc %s: %v", day, err)
+			failed = append(failed, day)
+			continue
+		}
+		done++
+		if *verbose {
+			log.Printf("Recalculated %s", day)
+		}
+	}
+	if err := g.updateSite(); err != nil {
+		log.Fatal(err)
+	}
+	g.publish("recalc")
+	if len(failed) > 0 {
+		log.Printf("Recalculated %d day(s), %d failed: %s", done, len(failed), strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+	log.Printf("Recalculated %d day(s)", done)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/config"
+	"wechat-view/internal/vectors"
+)
+
+// retentionResult tallies one retention pass.
+type retentionResult struct {
+	compressed, deleted int
+	// kept are days old enough to delete that were never rendered.
+	kept  []string
+	saved int64
+}
+
+// applyRetention gzips and deletes the raw days in dataDir that policy p
+// ages out, counting ages in calendar days before today. A day is deleted
+// only once its meta.json exists, so the summary outlives the messages, and
+// its archive.History is written first, so member, people and link pages
+// keep the day; rendered pages and published media are never touched.
+func applyRetention(dataDir, siteDir string, p config.RetentionPolicy, today time.Time, dryRun, verbose bool) (retentionResult, error) {
+	var res retentionResult
+	if p.CompressAfterDays <= 0 && p.DeleteAfterDays <= 0 {
+		return res, nil
+	}
+	days, err := archive.ListDays(dataDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return res, nil
+		}
+		return res, err
+	}
+	y, m, d := today.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	for _, day := range days {
+		t, err := time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			continue
+		}
+		age := int(midnight.Sub(t).Hours()+12) / 24
+		switch {
+		case p.DeleteAfterDays > 0 && age >= p.DeleteAfterDays:
+			meta, err := archive.LoadMeta(siteDir, day)
+			if err != nil {
+				res.kept = append(res.kept, day)
+				continue
+			}
+			if verbose || dryRun {
+				log.Printf("Delete raw data of %s (%d days old)", day, age)
+			}
+			if dryRun {
+				res.deleted++
+				continue
+			}
+			raw, err := archive.LoadRaw(dataDir, day)
+			if err != nil {
+				return res, fmt.Errorf("read %s: %w", day, err)
+			}
+			if err := archive.SaveHistory(dataDir, day, archive.NewHistory(raw, meta.Summary.Topics)); err != nil {
+				return res, fmt.Errorf("keep history of %s: %w", day, err)
+			}
+			if err := deleteRawDay(dataDir, day); err != nil {
+				return res, fmt.Errorf("delete %s: %w", day, err)
+			}
+			res.deleted++
+		case p.CompressAfterDays > 0 && age >= p.CompressAfterDays:
+			if path, _ := archive.FindRaw(dataDir, day); filepath.Ext(path) == archive.GzipSuffix {
+				continue
+			}
+			if verbose || dryRun {
+				log.Printf("Compress raw data of %s (%d days old)", day, age)
+			}
+			if dryRun {
+				res.compressed++
+				continue
+			}
+			saved, err := archive.Compact(dataDir, day)
+			if err != nil {
+				return res, fmt.Errorf("compress %s: %w", day, err)
+			}
+			res.compressed++
+			res.saved += saved
+		}
+	}
+	return res, nil
+}
+
+// deleteRawDay removes everything under dataDir that holds day's messages:
+// the raw file in either form, its search vectors and archived media.
+func deleteRawDay(dataDir, day string) error {
+	if err := archive.RemoveRaw(dataDir, day); err != nil {
+		return err
+	}
+	if err := os.Remove(vectors.Path(dataDir, day)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(dataDir, "media", day))
+}
+
+// logRetention reports a retention pass; dry runs say what would happen.
+func logRetention(res retentionResult, dryRun bool) {
+	for _, day := range res.kept {
+		log.Printf("warning: kept raw data of %s past report.retention.deleteAfterDays: it has no meta.json yet", day)
+	}
+	if res.compressed == 0 && res.deleted == 0 {
+		return
+	}
+	if dryRun {
+		log.Printf("Retention would compress %d and delete %d raw day(s)", res.compressed, res.deleted)
+		return
+	}
+	log.Printf("Retention compressed %d raw day(s), saving %s, and deleted %d", res.compressed, byteCount(res.saved), res.deleted)
+}
+
+// retention applies report.retention for the run's talker. It runs before
+// the site is updated, so search and links drop deleted days right away.
+func (g *generator) retention() {
+	res, err := applyRetention(g.opts.dataDir, g.opts.siteDir, g.cfg.Report.Retention.For(g.opts.talker), time.Now(), false, g.verbose)
+	if err != nil {
+		log.Printf("warning: retention: %v", err)
+	}
+	logRetention(res, false)
+}
+
+// runRetention applies report.retention on its own, e.g. after changing
+// the policy. Aggregate pages pick up deleted days on the next run.
+func runRetention(args []string) {
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Optional config file (JSON)")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	dataDir := fs.String("data-dir", "", "Directory with raw daily JSON (overrides config)")
+	siteDir := fs.String("site-dir", "", "Directory of the generated site (overrides config)")
+	talker := fs.String("talker", "", "Talker whose policy applies (overrides config chatlog.talker; default: each of config.talkers)")
+	dryRun := fs.Bool("dry-run", false, "Only list the days that would be compressed or deleted")
+	verbose := fs.Bool("v", false, "Verbose logging")
+	_ = fs.Parse(args)
+
+	cfg := loadConfig(*cfgPath, *profile)
+	cfg.Report.DataDir = firstNonEmpty(*dataDir, cfg.Report.DataDir, "data")
+	cfg.Report.SiteDir = firstNonEmpty(*siteDir, cfg.Report.SiteDir, "site")
+	ids := cfg.TalkerIDs()
+	if *talker != "" || len(ids) == 0 {
+		ids = []string{*talker}
+	}
+	for _, id := range ids {
+		tc := cfg.ForTalker(id)
+		p := tc.Report.Retention.For(id)
+		if p.CompressAfterDays <= 0 && p.DeleteAfterDays <= 0 {
+			log.Printf("No retention policy configured (report.retention)")
+			continue
+		}
+		res, err := applyRetention(tc.Report.DataDir, tc.Report.SiteDir, p, time.Now(), *dryRun, *verbose)
+		logRetention(res, *dryRun)
+		if err != nil {
+			log.Fatalf("retention failed: %v", err)
+		}
+	}
+}
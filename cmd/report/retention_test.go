@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/config"
+	"wechat-view/internal/members"
+	"wechat-view/internal/render"
+	"wechat-view/internal/summarize"
+)
+
+func TestRetentionKeepsMemberPeopleAndLinkHistory(t *testing.T) {
+	dataDir, siteDir := t.TempDir(), t.TempDir()
+	at := func(day, clock string) int64 {
+		v, err := time.ParseInLocation("2006-01-02 15:04", day+" "+clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Unix()
+	}
+	days := map[string][]chatlog.Message{
+		"2025-01-10": {
+			{Sender: "wxid_a", SenderName: "阿强", Timestamp: at("2025-01-10", "09:00"), MsgType: 1, Content: "部署文档在 https://docs.example.com/deploy 看这个"},
+			{Sender: "wxid_b", SenderName: "小美", Timestamp: at("2025-01-10", "21:30"), MsgType: 49, Content: "[链接]",
+				Share: &chatlog.Share{URL: "https://blog.example.com/k8s", Title: "K8s 入门", Desc: "从零开始"}},
+			{Sender: "wxid_b", SenderName: "小美", Timestamp: at("2025-01-10", "21:31"), MsgType: 1, Content: "这个部署方案不错"},
+		},
+		"2025-10-15": {
+			{Sender: "wxid_a", SenderName: "阿强", Timestamp: at("2025-10-15", "10:00"), MsgType: 1, Content: "早"},
+		},
+	}
+	for day, msgs := range days {
+		if _, err := archive.WriteRaw(dataDir, day, archive.Raw{Date: day, Talker: "1@chatroom", Messages: msgs}); err != nil {
+			t.Fatal(err)
+		}
+		meta := archive.DayMeta{Date: day, Talker: "1@chatroom", Summary: summarize.BuildSummary(msgs)}
+		meta.Summary.Topics = []summarize.Topic{{Name: "部署", Count: 2}}
+		b, err := json.Marshal(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(archive.DayDir(siteDir, day), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(archive.DayDir(siteDir, day), "meta.json"), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type outputs struct {
+		members map[string]*members.Member
+		days    []string
+		people  string
+		links   string
+	}
+	build := func() outputs {
+		t.Helper()
+		var o outputs
+		var err error
+		if o.members, o.days, err = members.Scan(dataDir, nil); err != nil {
+			t.Fatalf("成员统计失败: %v", err)
+		}
+		if err := render.UpdatePeopleProfiles(siteDir, dataDir, nil, nil); err != nil {
+			t.Fatalf("生成成员档案失败: %v", err)
+		}
+		if err := render.UpdateLinkLibrary(siteDir, dataDir, nil, nil); err != nil {
+			t.Fatalf("生成链接库失败: %v", err)
+		}
+		b, _ := os.ReadFile(filepath.Join(siteDir, "people", "people.json"))
+		o.people = string(b)
+		b, _ = os.ReadFile(filepath.Join(siteDir, "links", "links.json"))
+		o.links = string(b)
+		return o
+	}
+	before := build()
+	if m := before.members["wxid_a"]; m == nil || m.FirstSeen != "2025-01-10" || m.ActiveDays != 2 {
+		t.Fatalf("删除前成员统计不对: %+v", m)
+	}
+	if !strings.Contains(before.links, "docs.example.com/deploy") || !strings.Contains(before.links, "K8s 入门") || !strings.Contains(before.people, `"部署"`) {
+		t.Fatalf("删除前的链接库或成员档案缺内容:\n%s\n%s", before.links, before.people)
+	}
+
+	today := time.Date(2025, 10, 16, 12, 0, 0, 0, time.Local)
+	res, err := applyRetention(dataDir, siteDir, config.RetentionPolicy{DeleteAfterDays: 90}, today, false, false)
+	if err != nil || res.deleted != 1 {
+		t.Fatalf("保留策略执行异常: %+v %v", res, err)
+	}
+	if archive.HasRaw(dataDir, "2025-01-10") {
+		t.Fatal("过期的原始数据未删除")
+	}
+	if h, err := archive.LoadHistory(dataDir, "2025-01-10"); err != nil || h.Messages[0].Content != "https://docs.example.com/deploy 部署" {
+		t.Fatalf("history 应只保留链接与话题: %+v %v", h.Messages, err)
+	}
+
+	after := build()
+	if !reflect.DeepEqual(after.members, before.members) || !reflect.DeepEqual(after.days, before.days) {
+		t.Fatalf("删除原始数据后成员统计变了: %v %+v", after.days, after.members["wxid_a"])
+	}
+	if after.people != before.people {
+		t.Fatalf("删除原始数据后成员档案变了:\n%s\n---\n%s", before.people, after.people)
+	}
+	if after.links != before.links {
+		t.Fatalf("删除原始数据后链接库变了:\n%s\n---\n%s", before.links, after.links)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+const serviceName = "wechat-view-report"
+
+// serviceSpec describes how the installed unit starts the daemon.
+type serviceSpec struct {
+	Name    string
+	Exe     string
+	Args    []string
+	WorkDir string
+	LogPath string
+}
+
+// runService handles "report service install|uninstall", registering
+// "report daemon" with the platform's service manager: a systemd user unit on
+// Linux, a LaunchAgent on macOS and an automatic-start service on Windows.
+func runService(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: report service install|uninstall [flags]")
+		os.Exit(2)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("service "+action, flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Config file the daemon uses")
+	profile := fs.String("profile", "", "Config profile for the daemon")
+	at := fs.String("at", "", "Daily run time HH:MM (default: config daemon.at or 08:00)")
+	dryRun := fs.Bool("dry-run", false, "Print the generated unit instead of installing it")
+	_ = fs.Parse(args[1:])
+
+	switch action {
+	case "install":
+		spec, err := newServiceSpec(*cfgPath, *profile, *at)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := installService(spec, *dryRun); err != nil {
+			log.Fatalf("install service failed: %v", err)
+		}
+	case "uninstall":
+		if err := uninstallService(serviceName); err != nil {
+			log.Fatalf("uninstall service failed: %v", err)
+		}
+	default:
+		log.Fatalf("unknown service action %q (want install or uninstall)", action)
+	}
+}
+
+func newServiceSpec(cfgPath, profile, at string) (serviceSpec, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	if strings.Contains(exe, string(filepath.Separator)+"go-build") {
+		return serviceSpec{}, fmt.Errorf("build the binary first (go build -o report ./cmd/report); %s is a temporary go run binary", exe)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	absCfg, err := filepath.Abs(cfgPath)
+	if err != nil {
+		return serviceSpec{}, err
+	}
+	if at != "" {
+		if _, _, err := parseClock(at); err != nil {
+			return serviceSpec{}, err
+		}
+	}
+	spec := serviceSpec{
+		Name:    serviceName,
+		Exe:     exe,
+		Args:    []string{"daemon", "--config", absCfg},
+		WorkDir: wd,
+		LogPath: filepath.Join(wd, serviceName+".log"),
+	}
+	if profile != "" {
+		spec.Args = append(spec.Args, "--profile", profile)
+	}
+	if at != "" {
+		spec.Args = append(spec.Args, "--at", at)
+	}
+	return spec, nil
+}
+
+func installService(spec serviceSpec, dryRun bool) error {
+	path, content, cmds, err := serviceUnit(spec, runtime.GOOS)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		if path != "" {
+			fmt.Printf("# %s\n%s\n", path, content)
+		}
+		for _, c := range cmds {
+			fmt.Println(strings.Join(c, " "))
+		}
+		return nil
+	}
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+		log.Printf("Wrote %s", path)
+	}
+	if err := runAll(cmds); err != nil {
+		return err
+	}
+	log.Printf("Installed %s; reports are generated daily from %s", spec.Name, spec.WorkDir)
+	return nil
+}
+
+func uninstallService(name string) error {
+	path, cmds := serviceRemoval(name)
+	// Each step is tried on its own: a service that is not running fails
+	// to stop but must still be deleted.
+	for _, c := range cmds {
+		if err := runAll([][]string{c}); err != nil {
+			log.Printf("warning: %v", err)
+		}
+	}
+	if path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	log.Printf("Removed %s", name)
+	return nil
+}
+
+// serviceUnit returns the unit file (if any) and the commands that activate
+// it on goos.
+func serviceUnit(spec serviceSpec, goos string) (string, string, [][]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", nil, err
+	}
+	switch goos {
+	case "linux":
+		path := filepath.Join(home, ".config", "systemd", "user", spec.Name+".service")
+		content, err := execTemplate(systemdUnit, spec)
+		return path, content, [][]string{
+			{"systemctl", "--user", "daemon-reload"},
+			{"systemctl", "--user", "enable", "--now", spec.Name + ".service"},
+		}, err
+	case "darwin":
+		path := filepath.Join(home, "Library", "LaunchAgents", launchdLabel(spec.Name)+".plist")
+		content, err := execTemplate(launchdPlist, spec)
+		return path, content, [][]string{{"launchctl", "load", "-w", path}}, err
+	case "windows":
+		// A service started at boot by the service control manager; the
+		// daemon talks to it with --service, see service_windows.go. It
+		// starts in System32 and has no console, hence --workdir and
+		// --log-file.
+		args := append(append([]string{spec.Exe}, spec.Args...), "--service", "--workdir", spec.WorkDir, "--log-file", spec.LogPath)
+		for i := range args {
+			args[i] = quoteWindows(args[i])
+		}
+		return "", "", [][]string{
+			{"sc.exe", "create", spec.Name, "binPath=", strings.Join(args, " "), "start=", "auto", "DisplayName=", "wechat-view daily report"},
+			{"sc.exe", "description", spec.Name, "Generates the wechat-view report every day"},
+			{"sc.exe", "failure", spec.Name, "reset=", "86400", "actions=", "restart/60000"},
+			{"sc.exe", "start", spec.Name},
+		}, nil
+	}
+	return "", "", nil, fmt.Errorf("service install is not supported on %s; run \"report daemon\" under your own supervisor", goos)
+}
+
+func serviceRemoval(name string) (string, [][]string) {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "linux":
+		return filepath.Join(home, ".config", "systemd", "user", name+".service"),
+			[][]string{{"systemctl", "--user", "disable", "--now", name + ".service"}}
+	case "darwin":
+		path := filepath.Join(home, "Library", "LaunchAgents", launchdLabel(name)+".plist")
+		return path, [][]string{{"launchctl", "unload", "-w", path}}
+	case "windows":
+		return "", [][]string{{"sc.exe", "stop", name}, {"sc.exe", "delete", name}}
+	}
+	return "", nil
+}
+
+func runAll(cmds [][]string) error {
+	for _, c := range cmds {
+		out, err := exec.Command(c[0], c[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(c, " "), err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+func launchdLabel(name string) string {
+	return "io.github.myysophia." + name
+}
+
+func quoteWindows(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+func execTemplate(text string, spec serviceSpec) (string, error) {
+	funcs := template.FuncMap{
+		"label": launchdLabel,
+		"quote": func(s string) string {
+			if strings.ContainsAny(s, " \t\"\\") {
+				return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+			}
+			return s
+		},
+		"xml": func(s string) string {
+			var b bytes.Buffer
+			_ = xml.EscapeText(&b, []byte(s))
+			return b.String()
+		},
+	}
+	t, err := template.New("unit").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, spec); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+const systemdUnit = `[Unit]
+Description=wechat-view daily report
+After=network-online.target
+
+[Service]
+Type=simple
+WorkingDirectory={{quote .WorkDir}}
+ExecStart={{quote .Exe}}{{range .Args}} {{quote .}}{{end}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=60
+
+[Install]
+WantedBy=default.target
+`
+
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key><string>{{label .Name}}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>{{xml .Exe}}</string>{{range .Args}}
+    <string>{{xml .}}</string>{{end}}
+  </array>
+  <key>WorkingDirectory</key><string>{{xml .WorkDir}}</string>
+  <key>RunAtLoad</key><true/>
+  <key>KeepAlive</key><true/>
+  <key>StandardOutPath</key><string>{{xml .LogPath}}</string>
+  <key>StandardErrorPath</key><string>{{xml .LogPath}}</string>
+</dict>
+</plist>
+`
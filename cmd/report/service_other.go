@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// serveWindowsService is only meaningful on Windows; elsewhere the daemon
+// runs under systemd or launchd as a plain process.
+func serveWindowsService(name string, stop chan<- os.Signal, run func()) error {
+	return errors.New("--service is for the Windows service control manager; run the daemon without it")
+}
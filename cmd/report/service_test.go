@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWindowsServiceInstallCommands(t *testing.T) {
+	spec := serviceSpec{
+		Name:    serviceName,
+		Exe:     `C:\Program Files\wechat-view\report.exe`,
+		Args:    []string{"daemon", "--config", `C:\wv\report.config.json`, "--at", "07:30"},
+		WorkDir: `C:\wv`,
+		LogPath: `C:\wv\wechat-view-report.log`,
+	}
+	path, _, cmds, err := serviceUnit(spec, "windows")
+	if err != nil || path != "" {
+		t.Fatalf("path = %q, err = %v", path, err)
+	}
+	create := cmds[0]
+	if strings.Join(create[:3], " ") != "sc.exe create "+serviceName || create[3] != "binPath=" {
+		t.Fatalf("create = %q", create)
+	}
+	want := `"C:\Program Files\wechat-view\report.exe" daemon --config C:\wv\report.config.json --at 07:30 --service --workdir C:\wv --log-file C:\wv\wechat-view-report.log`
+	if create[4] != want {
+		t.Fatalf("binPath = %s\nwant      %s", create[4], want)
+	}
+	if got := strings.Join(create[5:7], " "); got != "start= auto" {
+		t.Fatalf("start type = %q", got)
+	}
+	if last := cmds[len(cmds)-1]; strings.Join(last, " ") != "sc.exe start "+serviceName {
+		t.Fatalf("service not started: %q", last)
+	}
+}
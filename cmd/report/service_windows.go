@@ -0,0 +1,140 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The service control manager API, called through advapi32 directly so the
+// module keeps to the standard library.
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+
+	serviceMainCallback    = syscall.NewCallback(serviceMain)
+	serviceHandlerCallback = syscall.NewCallback(serviceHandler)
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped     = 1
+	serviceStopPending = 3
+	serviceRunning     = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented = 120
+)
+
+// serviceStatus mirrors SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry mirrors SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// winService is what the SCM callbacks share; a process hosts one service.
+var winService struct {
+	name *uint16
+	stop chan<- os.Signal
+	run  func()
+	err  error
+
+	mu     sync.Mutex
+	handle uintptr
+	status serviceStatus
+}
+
+// serveWindowsService hands the process to the service control manager,
+// which calls run once the service starts. A stop or shutdown request sends
+// os.Interrupt on stop, and run must then return. It fails when the process
+// was not started by the SCM.
+func serveWindowsService(name string, stop chan<- os.Signal, run func()) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	winService.name, winService.stop, winService.run = p, stop, run
+	table := []serviceTableEntry{{name: p, proc: serviceMainCallback}, {}}
+	if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		return fmt.Errorf("connect to the service control manager (start it with sc.exe start %s): %w", name, err)
+	}
+	return winService.err
+}
+
+// serviceMain is the ServiceMain the dispatcher runs on its own thread.
+func serviceMain(argc, argv uintptr) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(winService.name)), serviceHandlerCallback, 0)
+	if h == 0 {
+		winService.err = fmt.Errorf("register service control handler: %w", err)
+		return 0
+	}
+	winService.mu.Lock()
+	winService.handle = h
+	winService.mu.Unlock()
+	setServiceState(serviceRunning)
+	winService.run()
+	setServiceState(serviceStopped)
+	return 0
+}
+
+// serviceHandler is the HandlerEx the SCM calls with control requests.
+func serviceHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceState(serviceStopPending)
+		select {
+		case winService.stop <- os.Interrupt:
+		default:
+		}
+		return 0
+	case serviceControlInterrogate:
+		winService.mu.Lock()
+		state := winService.status.CurrentState
+		winService.mu.Unlock()
+		setServiceState(state)
+		return 0
+	}
+	return errorCallNotImplemented
+}
+
+func setServiceState(state uint32) {
+	winService.mu.Lock()
+	defer winService.mu.Unlock()
+	s := &winService.status
+	s.ServiceType = serviceWin32OwnProcess
+	s.CurrentState = state
+	s.ControlsAccepted = 0
+	s.WaitHint = 0
+	switch state {
+	case serviceRunning:
+		s.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	case serviceStopPending:
+		s.CheckPoint++
+		s.WaitHint = 30000
+	}
+	procSetServiceStatus.Call(winService.handle, uintptr(unsafe.Pointer(s)))
+}
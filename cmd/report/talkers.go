@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/config"
+	"wechat-view/internal/publish"
+	"wechat-view/internal/render"
+)
+
+// runTalkers runs a report command once per entry of config.talkers, each
+// a child process of this binary with args plus --talker and --no-publish,
+// like the daemon's runs; each writes into its own subdirectory of the data
+// and site dirs. The parent then writes the root index linking the rooms
+// and publishes the whole site once, unless dryRun (the children print
+// their plans); label names the run in commit messages. It returns the
+// exit code: 1 if any talker failed.
+func runTalkers(cfg config.Config, args []string, label string, noPublish, dryRun, verbose bool) int {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("locate executable: %v", err)
+		return 1
+	}
+	var failed, labels []string
+	for _, t := range cfg.Talkers {
+		name := firstNonEmpty(t.Label, t.ID)
+		labels = append(labels, name)
+		cmd := exec.Command(exe, append(args[:len(args):len(args)], "--talker", t.ID, "--no-publish")...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("warning: %s: %v", name, err)
+			failed = append(failed, name)
+		}
+	}
+
+	if dryRun {
+		fmt.Println("site")
+		planWrite(filepath.Join(cfg.Report.SiteDir, "index.html"))
+		if !noPublish {
+			planPublish(cfg)
+		}
+		return exitCode(failed, len(cfg.Talkers))
+	}
+	if err := writeTalkerIndex(cfg); err != nil {
+		log.Printf("warning: write talker index: %v", err)
+		failed = append(failed, "index")
+	}
+	if !noPublish {
+		publishSite(cfg, cfg.Report.DataDir, cfg.Report.SiteDir, publish.MessageData{Date: label, Talker: strings.Join(labels, ", ")}, verbose)
+	}
+	return exitCode(failed, len(cfg.Talkers))
+}
+
+// exitCode logs the failed talkers and returns 1 if there are any.
+func exitCode(failed []string, total int) int {
+	if len(failed) > 0 {
+		log.Printf("%d of %d talker(s) failed: %s", len(failed), total, strings.Join(failed, ", "))
+		return 1
+	}
+	return 0
+}
+
+// writeTalkerIndex writes the site root of a talkers config: the shared
+// theme and an index linking each room's own index page.
+func writeTalkerIndex(cfg config.Config) error {
+	siteDir := cfg.Report.SiteDir
+	if err := os.MkdirAll(siteDir, 0o755); err != nil {
+		return err
+	}
+	th := cfg.Report.Theme.Theme
+	if err := render.WriteTheme(siteDir, render.Theme{Mode: th.Mode, Accent: th.Accent, Light: th.Light, Dark: th.Dark}); err != nil {
+		return err
+	}
+	links := make([]render.TalkerLink, 0, len(cfg.Talkers))
+	for _, t := range cfg.Talkers {
+		link := render.TalkerLink{
+			Label: firstNonEmpty(t.Label, t.ID),
+			URL:   filepath.ToSlash(t.Subdir()) + "/index.html",
+		}
+		if days, err := archive.ListDays(filepath.Join(cfg.Report.DataDir, t.Subdir())); err == nil && len(days) > 0 {
+			link.Latest = days[len(days)-1]
+		}
+		links = append(links, link)
+	}
+	return render.WriteTalkerIndex(siteDir, links)
+}
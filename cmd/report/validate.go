@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/config"
+	"wechat-view/internal/diskcheck"
+	"wechat-view/internal/render"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/tags"
+)
+
+// runValidateConfig checks the config the way a nightly run would use it:
+// unknown keys, malformed values, rule syntax, directories and, unless
+// --offline, whether chatlog and the LLM answer. Every problem is printed
+// with the field to fix; the command exits 1 when any check fails.
+func runValidateConfig(args []string) {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	cfgPath := fs.String("config", "report.config.json", "Config file (JSON) to validate")
+	profile := fs.String("profile", "", "Config profile to apply on top of the base config")
+	offline := fs.Bool("offline", false, "Skip the chatlog and LLM connectivity checks")
+	timeout := fs.Duration("timeout", 20*time.Second, "Timeout of each connectivity check")
+	_ = fs.Parse(args)
+
+	var failed, warned int
+	report := func(status, format string, a ...any) {
+		switch status {
+		case "FAIL":
+			failed++
+		case "WARN":
+			warned++
+		}
+		fmt.Printf("%-5s %s\n", status, fmt.Sprintf(format, a...))
+	}
+
+	if _, err := os.Stat(*cfgPath); err != nil {
+		report("FAIL", "%s: %v", *cfgPath, err)
+		fmt.Printf("%d error(s), %d warning(s)\n", failed, warned)
+		os.Exit(1)
+	}
+	unknown, err := config.UnknownKeys(*cfgPath)
+	if err != nil {
+		report("FAIL", "%s: %v", *cfgPath, err)
+		fmt.Printf("%d error(s), %d warning(s)\n", failed, warned)
+		os.Exit(1)
+	}
+	for _, key := range unknown {
+		report("FAIL", "%s: unknown key, check the spelling against report.config_example.json", key)
+	}
+	cfg, err := config.LoadProfile(*cfgPath, *profile)
+	if err != nil {
+		report("FAIL", "%v", err)
+		fmt.Printf("%d error(s), %d warning(s)\n", failed, warned)
+		os.Exit(1)
+	}
+	cfg.Defaults()
+
+	for _, issue := range cfg.Check() {
+		status := "FAIL"
+		if issue.Warning {
+			status = "WARN"
+		}
+		report(status, "%s", issue)
+	}
+	if _, err := tags.Compile(cfg.Tags); err != nil {
+		report("FAIL", "tags: %v", err)
+	}
+	if _, err := risk.Compile(cfg.Risk.Rules, cfg.Risk.Allow); err != nil {
+		report("FAIL", "risk: %v", err)
+	}
+	if _, err := summaryBuilder(cfg); err != nil {
+		report("FAIL", "summarize: %v", err)
+	}
+	checkSections := func(field string, p config.SectionsPolicy) {
+		for _, name := range p.Hide {
+			if !slices.Contains(render.DaySections, name) {
+				report("FAIL", "%s.hide: unknown section %q (known: %s)", field, name, strings.Join(render.DaySections, ", "))
+			}
+		}
+	}
+	checkSections("report.sections", cfg.Report.Sections.SectionsPolicy)
+	for talker, p := range cfg.Report.Sections.Talkers {
+		checkSections("report.sections.talkers."+talker, p)
+	}
+	// A missing directory is already reported by Check.
+	if st, err := os.Stat(cfg.Report.TemplatesDir); err == nil && st.IsDir() {
+		if names, err := render.CheckTemplatesDir(cfg.Report.TemplatesDir); err != nil {
+			report("FAIL", "report.templatesDir: %v", err)
+		} else {
+			report("OK", "report.templatesDir: overrides %s", firstNonEmpty(strings.Join(names, ", "), "nothing"))
+		}
+	}
+
+	minFree := uint64(cfg.Report.Disk.MinFreeMB) << 20
+	for field, dir := range map[string]string{
+		"report.dataDir": firstNonEmpty(cfg.Report.DataDir, "data"),
+		"report.siteDir": firstNonEmpty(cfg.Report.SiteDir, "site"),
+	} {
+		switch _, err := os.Stat(dir); {
+		case errors.Is(err, os.ErrNotExist):
+			report("WARN", "%s: %s does not exist yet and will be created on the first run", field, dir)
+		case err != nil:
+			report("FAIL", "%s: %v", field, err)
+		case !cfg.Report.Disk.Disabled:
+			if st, err := diskcheck.Check(dir, minFree); err != nil {
+				report("FAIL", "%s: %v", field, err)
+			} else if st.Total > 0 {
+				report("OK", "%s: %s is writable, %s free", field, dir, diskcheck.Bytes(st.Free))
+			}
+		}
+	}
+
+	if *offline {
+		fmt.Printf("%d error(s), %d warning(s); connectivity not checked (--offline)\n", failed, warned)
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	baseURL := firstNonEmpty(cfg.Chatlog.BaseURL, "http://127.0.0.1:5030")
+	for _, talker := range cfg.TalkerIDs() {
+		day := reportDay(time.Now(), cfg.Report.DayStartHour)
+		client := chatlog.Client{BaseURL: baseURL, MaxMessages: 1, HTTP: &http.Client{Timeout: *timeout}}
+		start := time.Now()
+		msgs, _, err := client.FetchDay(day, talker, "")
+		switch {
+		case err != nil:
+			report("FAIL", "chatlog.baseURL: %s is not answering: %v (is chatlog running with its HTTP server enabled?)", baseURL, err)
+		case len(msgs) == 0:
+			report("WARN", "chatlog.talker: no messages from %s on %s; check the talker id if the group was not quiet", talker, day)
+		default:
+			report("OK", "chatlog: %s answered for %s in %s", baseURL, talker, time.Since(start).Round(time.Millisecond))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if store := remoteStore(cfg.Storage.Remote); store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		start := time.Now()
+		if err := store.Check(ctx); err != nil {
+			report("FAIL", "storage.remote: %v", err)
+		} else {
+			report("OK", "storage.remote: bucket %s answered in %s", cfg.Storage.Remote.Bucket, time.Since(start).Round(time.Millisecond))
+		}
+		cancel()
+	}
+
+	if pub := gitPublisher(cfg, firstNonEmpty(cfg.Report.DataDir, "data")); pub != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		if err := pub.Check(ctx); err != nil {
+			report("FAIL", "publish.git.remote: %v", err)
+		} else {
+			report("OK", "publish.git: remote answered")
+		}
+		cancel()
+	}
+	for _, t := range uploadTargets(cfg) {
+		checker, ok := t.Uploader.(interface{ Check(context.Context) error })
+		if !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		if err := checker.Check(ctx); err != nil {
+			report("FAIL", "publish.%s: %v", t.Name(), err)
+		} else {
+			report("OK", "publish.%s: target answered", t.Name())
+		}
+		cancel()
+	}
+
+	g := &generator{cfg: cfg}
+	for _, arm := range g.insightArms() {
+		client := arm.Client
+		if client.Timeout == 0 || client.Timeout > *timeout {
+			client.Timeout = *timeout
+		}
+		start := time.Now()
+		if err := client.Ping(context.Background()); err != nil {
+			report("FAIL", "llm (%s, %s): %v", arm.Label, client.Model, err)
+		} else {
+			report("OK", "llm (%s): %s answered in %s", arm.Label, client.Model, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	fmt.Printf("%d error(s), %d warning(s)\n", failed, warned)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
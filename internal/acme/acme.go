@@ -0,0 +1,677 @@
+// Package acme obtains and renews TLS certificates from an ACME CA such as
+// Let's Encrypt (RFC 8555), answering http-01 challenges. The account key
+// and certificates are kept in a cache directory, so restarts reuse them
+// instead of asking the CA again.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// LetsEncryptURL is the directory of Let's Encrypt's production CA.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ChallengePath prefixes the URLs the CA fetches http-01 answers from.
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// renewBefore is how long before expiry a certificate is renewed.
+const renewBefore = 30 * 24 * time.Hour
+
+// Manager serves a certificate for Hosts, obtaining it on first use and
+// renewing it in the background once it nears expiry. The CA must reach
+// HTTPHandler on port 80 of every host. It is safe for concurrent use.
+type Manager struct {
+	// Hosts are the names the certificate covers; handshakes for other
+	// names are refused. Wildcards need dns-01 and are not supported.
+	Hosts []string
+	// Email is the account contact the CA sends expiry notices to.
+	Email string
+	// CacheDir holds the account key and the certificate.
+	CacheDir string
+	// DirectoryURL is the CA's directory; empty means Let's Encrypt.
+	DirectoryURL string
+	// Client talks to the CA; nil uses a client with a 30s timeout.
+	Client *http.Client
+
+	// pollInterval is how long to wait between status checks.
+	pollInterval time.Duration
+	now          func() time.Time
+
+	obtainMu sync.Mutex // one order at a time
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	renewing bool
+	tokens   sync.Map // http-01 token -> key authorization
+}
+
+// TLSConfig returns a server config that takes its certificate from m.
+// Handed to an http.Server it negotiates HTTP/2 as well.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// GetCertificate is for tls.Config.GetCertificate. Without a certificate
+// it loads the cached one or orders one, blocking the handshake; a
+// certificate close to expiry is still served while a renewal runs.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if name := strings.TrimSuffix(strings.ToLower(hello.ServerName), "."); name != "" && !m.hostAllowed(name) {
+		return nil, fmt.Errorf("acme: no certificate for host %q", name)
+	}
+	m.mu.Lock()
+	cert := m.cert
+	if cert != nil && m.expiring(cert) && !m.renewing {
+		m.renewing = true
+		go m.renew()
+	}
+	m.mu.Unlock()
+	if cert != nil && m.clock().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	return m.Ensure(context.Background())
+}
+
+// Ensure returns a valid certificate, from memory, the cache or the CA.
+// Call it at startup to have the certificate ready before the first
+// handshake.
+func (m *Manager) Ensure(ctx context.Context) (*tls.Certificate, error) {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+	m.mu.Lock()
+	cert := m.cert
+	m.mu.Unlock()
+	if cert == nil {
+		if cached, err := m.loadCached(); err == nil {
+			cert = cached
+		} else if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("warning: acme: ignoring cached certificate: %v", err)
+		}
+	}
+	if cert == nil || !m.clock().Before(cert.Leaf.NotAfter) || (m.expiring(cert) && !m.renewingNow()) {
+		fresh, err := m.obtain(ctx)
+		if err != nil {
+			if cert != nil && m.clock().Before(cert.Leaf.NotAfter) {
+				log.Printf("warning: acme: renewal failed, serving the current certificate: %v", err)
+				m.set(cert)
+				return cert, nil
+			}
+			return nil, err
+		}
+		cert = fresh
+	}
+	m.set(cert)
+	return cert, nil
+}
+
+// renew orders a new certificate in the background, keeping the current
+// one on failure; the next handshake after a failure tries again.
+func (m *Manager) renew() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	m.obtainMu.Lock()
+	cert, err := m.obtain(ctx)
+	m.obtainMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewing = false
+	if err != nil {
+		log.Printf("warning: acme: renewing the certificate for %s failed: %v", strings.Join(m.Hosts, ", "), err)
+		return
+	}
+	m.cert = cert
+}
+
+func (m *Manager) renewingNow() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.renewing
+}
+
+func (m *Manager) set(cert *tls.Certificate) {
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+}
+
+func (m *Manager) expiring(cert *tls.Certificate) bool {
+	return cert.Leaf.NotAfter.Sub(m.clock()) < renewBefore
+}
+
+func (m *Manager) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *Manager) hostAllowed(name string) bool {
+	for _, h := range m.Hosts {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPHandler answers the CA's http-01 challenges and passes every other
+// request to fallback; a nil fallback redirects configured hosts to HTTPS.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.URL.Path, ChallengePath); ok {
+			if v, ok := m.tokens.Load(token); ok {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = io.WriteString(w, v.(string))
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		if fallback != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !m.hostAllowed(host) || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// cachePaths returns where the certificate chain and its key are kept.
+func (m *Manager) cachePaths() (string, string) {
+	name := strings.ToLower(m.Hosts[0])
+	return filepath.Join(m.CacheDir, name+".crt"), filepath.Join(m.CacheDir, name+".key")
+}
+
+// loadCached reads the cached certificate if it covers every host.
+func (m *Manager) loadCached() (*tls.Certificate, error) {
+	if len(m.Hosts) == 0 {
+		return nil, errors.New("acme: no hosts configured")
+	}
+	certPath, keyPath := m.cachePaths()
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	for _, h := range m.Hosts {
+		if err := cert.Leaf.VerifyHostname(h); err != nil {
+			return nil, fmt.Errorf("cached certificate does not cover %s", h)
+		}
+	}
+	return &cert, nil
+}
+
+// parseLeaf fills cert.Leaf, which tls.X509KeyPair leaves nil before Go
+// 1.23.
+func parseLeaf(cert *tls.Certificate) error {
+	if cert.Leaf != nil {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+// obtain runs a whole order and stores the result; callers hold obtainMu.
+func (m *Manager) obtain(ctx context.Context) (*tls.Certificate, error) {
+	if len(m.Hosts) == 0 {
+		return nil, errors.New("acme: no hosts configured")
+	}
+	if err := os.MkdirAll(m.CacheDir, 0o700); err != nil {
+		return nil, err
+	}
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	hc := m.Client
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+	c := &client{hc: hc, key: accountKey, poll: m.pollInterval}
+	if c.poll <= 0 {
+		c.poll = 2 * time.Second
+	}
+	if err := c.discover(ctx, firstNonEmpty(m.DirectoryURL, LetsEncryptURL)); err != nil {
+		return nil, err
+	}
+	if err := c.register(ctx, m.Email); err != nil {
+		return nil, err
+	}
+	order, orderURL, err := c.newOrder(ctx, m.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	for _, authURL := range order.Authorizations {
+		if err := c.authorize(ctx, authURL, &m.tokens); err != nil {
+			return nil, err
+		}
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.Hosts[0]},
+		DNSNames: m.Hosts,
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := c.finalize(ctx, order, orderURL, csr)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err == nil {
+		err = parseLeaf(&cert)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("acme: CA returned an unusable certificate: %w", err)
+	}
+	certPath, keyPath := m.cachePaths()
+	if err := atomicfile.WriteFile(keyPath, keyPEM); err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(certPath, chain); err != nil {
+		return nil, err
+	}
+	log.Printf("acme: obtained a certificate for %s, valid until %s", strings.Join(m.Hosts, ", "), cert.Leaf.NotAfter.Format(time.DateOnly))
+	return &cert, nil
+}
+
+// accountKey loads the cached account key or creates one.
+func (m *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	p := filepath.Join(m.CacheDir, "account.key")
+	if b, err := os.ReadFile(p); err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("acme: %s is not a PEM key", p)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// client speaks the ACME protocol for one order.
+type client struct {
+	hc    *http.Client
+	key   *ecdsa.PrivateKey
+	poll  time.Duration
+	dir   directory
+	kid   string
+	nonce string
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []struct {
+		Type   string   `json:"type"`
+		URL    string   `json:"url"`
+		Token  string   `json:"token"`
+		Status string   `json:"status"`
+		Error  *Problem `json:"error"`
+	} `json:"challenges"`
+}
+
+// Problem is an error document returned by the CA.
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", strings.TrimPrefix(p.Type, "urn:ietf:params:acme:error:"), p.Detail)
+}
+
+func (c *client) discover(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("acme: directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("acme: directory: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c.dir); err != nil {
+		return fmt.Errorf("acme: directory: %w", err)
+	}
+	if c.dir.NewNonce == "" || c.dir.NewAccount == "" || c.dir.NewOrder == "" {
+		return errors.New("acme: directory is missing newNonce, newAccount or newOrder")
+	}
+	return nil
+}
+
+// register finds or creates the account of c.key and remembers its URL.
+func (c *client) register(ctx context.Context, email string) error {
+	req := map[string]any{"termsOfServiceAgreed": true}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	resp, _, err := c.post(ctx, c.dir.NewAccount, req)
+	if err != nil {
+		return fmt.Errorf("acme: account: %w", err)
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return errors.New("acme: account: no Location in response")
+	}
+	return nil
+}
+
+func (c *client) newOrder(ctx context.Context, hosts []string) (order, string, error) {
+	ids := make([]map[string]string, len(hosts))
+	for i, h := range hosts {
+		ids[i] = map[string]string{"type": "dns", "value": h}
+	}
+	var o order
+	resp, body, err := c.post(ctx, c.dir.NewOrder, map[string]any{"identifiers": ids})
+	if err != nil {
+		return o, "", fmt.Errorf("acme: order: %w", err)
+	}
+	if err := json.Unmarshal(body, &o); err != nil {
+		return o, "", fmt.Errorf("acme: order: %w", err)
+	}
+	return o, resp.Header.Get("Location"), nil
+}
+
+// authorize answers the http-01 challenge of one authorization and waits
+// for the CA to validate it.
+func (c *client) authorize(ctx context.Context, url string, tokens *sync.Map) error {
+	var a authorization
+	if err := c.fetch(ctx, url, &a); err != nil {
+		return fmt.Errorf("acme: authorization: %w", err)
+	}
+	if a.Status == "valid" {
+		return nil
+	}
+	i := -1
+	for j, ch := range a.Challenges {
+		if ch.Type == "http-01" {
+			i = j
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("acme: %s offers no http-01 challenge", a.Identifier.Value)
+	}
+	ch := a.Challenges[i]
+	tokens.Store(ch.Token, ch.Token+"."+thumbprint(&c.key.PublicKey))
+	defer tokens.Delete(ch.Token)
+	if _, _, err := c.post(ctx, ch.URL, struct{}{}); err != nil {
+		return fmt.Errorf("acme: challenge %s: %w", a.Identifier.Value, err)
+	}
+	for {
+		if err := c.fetch(ctx, url, &a); err != nil {
+			return fmt.Errorf("acme: authorization: %w", err)
+		}
+		switch a.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+		default:
+			for _, ch := range a.Challenges {
+				if ch.Error != nil {
+					return fmt.Errorf("acme: validating %s: %w", a.Identifier.Value, ch.Error)
+				}
+			}
+			return fmt.Errorf("acme: validating %s: authorization %s", a.Identifier.Value, a.Status)
+		}
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// finalize submits the CSR, waits for the order and downloads the chain.
+func (c *client) finalize(ctx context.Context, o order, orderURL string, csr []byte) ([]byte, error) {
+	if _, body, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}); err != nil {
+		return nil, fmt.Errorf("acme: finalize: %w", err)
+	} else if err := json.Unmarshal(body, &o); err != nil {
+		return nil, fmt.Errorf("acme: finalize: %w", err)
+	}
+	for o.Status != "valid" {
+		switch o.Status {
+		case "pending", "ready", "processing":
+		default:
+			if o.Error != nil {
+				return nil, fmt.Errorf("acme: order: %w", o.Error)
+			}
+			return nil, fmt.Errorf("acme: order %s", o.Status)
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+		if err := c.fetch(ctx, orderURL, &o); err != nil {
+			return nil, fmt.Errorf("acme: order: %w", err)
+		}
+	}
+	_, chain, err := c.post(ctx, o.Certificate, nil)
+	if err != nil {
+		return nil, fmt.Errorf("acme: certificate: %w", err)
+	}
+	return chain, nil
+}
+
+func (c *client) wait(ctx context.Context) error {
+	t := time.NewTimer(c.poll)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// fetch is a POST-as-GET of url decoded into v.
+func (c *client) fetch(ctx context.Context, url string, v any) error {
+	_, body, err := c.post(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// post sends payload to url as a JWS signed with the account key; a nil
+// payload is a POST-as-GET. A rejected nonce is retried once.
+func (c *client) post(ctx context.Context, url string, payload any) (*http.Response, []byte, error) {
+	var body []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = b
+	}
+	for attempt := 0; ; attempt++ {
+		nonce, err := c.takeNonce(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		jws, err := c.sign(url, nonce, body)
+		if err != nil {
+			return nil, nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jws))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		resp, err := c.hc.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.nonce = resp.Header.Get("Replay-Nonce")
+		if resp.StatusCode < 400 {
+			return resp, data, nil
+		}
+		p := &Problem{Status: resp.StatusCode}
+		if json.Unmarshal(data, p) != nil || p.Type == "" {
+			return nil, nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+		}
+		if p.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+			continue
+		}
+		return nil, nil, p
+	}
+}
+
+func (c *client) takeNonce(ctx context.Context) (string, error) {
+	if n := c.nonce; n != "" {
+		c.nonce = ""
+		return n, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("acme: nonce: %w", err)
+	}
+	resp.Body.Close()
+	n := resp.Header.Get("Replay-Nonce")
+	if n == "" {
+		return "", errors.New("acme: nonce: no Replay-Nonce in response")
+	}
+	return n, nil
+}
+
+// sign wraps payload in a flattened JWS (ES256), identified by the account
+// URL once registered and by the public key before.
+func (c *client) sign(url, nonce string, payload []byte) ([]byte, error) {
+	protected := map[string]any{"alg": "ES256", "nonce": nonce, "url": url}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = jwk(&c.key.PublicKey)
+	}
+	hdr, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	signed := b64(hdr) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return json.Marshal(map[string]string{"protected": b64(hdr), "payload": b64(payload), "signature": b64(sig)})
+}
+
+// jwk is the JSON Web Key of a P-256 public key, members in the order RFC
+// 7638 hashes them.
+func jwk(pub *ecdsa.PublicKey) map[string]string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return map[string]string{"crv": "P-256", "kty": "EC", "x": b64(x), "y": b64(y)}
+}
+
+// thumbprint is the RFC 7638 thumbprint that key authorizations end with.
+func thumbprint(pub *ecdsa.PublicKey) string {
+	k := jwk(pub)
+	canon := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`, k["x"], k["y"])
+	sum := sha256.Sum256([]byte(canon))
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,364 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCA is a minimal ACME server. It checks every JWS, validates http-01
+// challenges against the manager's HTTPHandler and issues certificates
+// from its own root.
+type fakeCA struct {
+	t        *testing.T
+	srv      *httptest.Server
+	key      *ecdsa.PrivateKey
+	root     *x509.Certificate
+	validate http.Handler
+
+	mu         sync.Mutex
+	lifetime   time.Duration
+	account    *ecdsa.PublicKey
+	nonces     map[string]bool
+	nextNonce  int
+	rejectNext bool // answer the next request with badNonce
+	orders     int
+	hosts      []string
+	tokens     map[string]string // authz id -> token
+	valid      map[string]bool
+	chain      []byte
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	ca := &fakeCA{t: t, lifetime: 90 * 24 * time.Hour, nonces: map[string]bool{}, tokens: map[string]string{}, valid: map[string]bool{}}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.key = key
+	ca.root, _ = x509.ParseCertificate(der)
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) url(path string) string { return ca.srv.URL + path }
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if r.URL.Path == "/dir" {
+		json.NewEncoder(w).Encode(map[string]string{"newNonce": ca.url("/nonce"), "newAccount": ca.url("/account"), "newOrder": ca.url("/order")})
+		return
+	}
+	ca.nextNonce++
+	nonce := fmt.Sprintf("n%d", ca.nextNonce)
+	ca.nonces[nonce] = true
+	w.Header().Set("Replay-Nonce", nonce)
+	if r.URL.Path == "/nonce" {
+		return
+	}
+	payload, err := ca.verify(r)
+	if err != nil {
+		ca.problem(w, "malformed", err.Error())
+		return
+	}
+	if payload == nil && ca.rejectNext {
+		ca.rejectNext = false
+		ca.problem(w, "badNonce", "stale nonce")
+		return
+	}
+	switch p := r.URL.Path; {
+	case p == "/account":
+		w.Header().Set("Location", ca.url("/acct/1"))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"status":"valid"}`)
+	case p == "/order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &req)
+		ca.orders++
+		ca.hosts = nil
+		var authz []string
+		for i, id := range req.Identifiers {
+			ca.hosts = append(ca.hosts, id.Value)
+			ref := fmt.Sprintf("%d-%d", ca.orders, i)
+			ca.tokens[ref] = "tok" + ref
+			authz = append(authz, ca.url("/authz/"+ref))
+		}
+		w.Header().Set("Location", ca.url("/orders/1"))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"status": "pending", "authorizations": authz, "finalize": ca.url("/finalize")})
+	case strings.HasPrefix(p, "/authz/"):
+		ref := strings.TrimPrefix(p, "/authz/")
+		status := "pending"
+		if ca.valid[ref] {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": "x"},
+			"challenges": []map[string]string{
+				{"type": "dns-01", "url": ca.url("/chal/dns"), "token": "unused"},
+				{"type": "http-01", "url": ca.url("/chal/" + ref), "token": ca.tokens[ref]},
+			},
+		})
+	case strings.HasPrefix(p, "/chal/"):
+		ref := strings.TrimPrefix(p, "/chal/")
+		token := ca.tokens[ref]
+		rec := httptest.NewRecorder()
+		ca.validate.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://x"+ChallengePath+token, nil))
+		if want := token + "." + thumbprint(ca.account); rec.Body.String() != want {
+			ca.problem(w, "unauthorized", fmt.Sprintf("got %q, want %q", rec.Body.String(), want))
+			return
+		}
+		ca.valid[ref] = true
+		io.WriteString(w, `{"status":"valid"}`)
+	case p == "/finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			ca.problem(w, "badCSR", fmt.Sprint(err))
+			return
+		}
+		leaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(ca.orders + 1)),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(ca.lifetime),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca.root, csr.PublicKey, ca.key)
+		if err != nil {
+			ca.t.Error(err)
+		}
+		ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})...)
+		json.NewEncoder(w).Encode(map[string]any{"status": "processing", "finalize": ca.url("/finalize")})
+	case p == "/orders/1":
+		json.NewEncoder(w).Encode(map[string]any{"status": "valid", "certificate": ca.url("/cert")})
+	case p == "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify checks the nonce, url and signature of a JWS request and returns
+// its payload, nil for a POST-as-GET.
+func (ca *fakeCA) verify(r *http.Request) ([]byte, error) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, err
+	}
+	hdrJSON, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var hdr struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  map[string]string
+	}
+	if err := json.Unmarshal(hdrJSON, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Alg != "ES256" || hdr.URL != ca.url(r.URL.Path) {
+		return nil, fmt.Errorf("bad header %s", hdrJSON)
+	}
+	if !ca.nonces[hdr.Nonce] {
+		return nil, fmt.Errorf("unknown nonce %q", hdr.Nonce)
+	}
+	delete(ca.nonces, hdr.Nonce)
+	pub := ca.account
+	if hdr.JWK != nil {
+		if r.URL.Path != "/account" {
+			return nil, fmt.Errorf("jwk used for %s", r.URL.Path)
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(hdr.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(hdr.JWK["y"])
+		pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		ca.account = pub
+	} else if hdr.Kid != ca.url("/acct/1") || pub == nil {
+		return nil, fmt.Errorf("unknown kid %q", hdr.Kid)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, fmt.Errorf("bad signature")
+	}
+	if jws.Payload == "" {
+		return nil, nil
+	}
+	return base64.RawURLEncoding.DecodeString(jws.Payload)
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:" + typ, "detail": detail})
+}
+
+func (ca *fakeCA) orderCount() int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.orders
+}
+
+func newManager(ca *fakeCA, dir string) *Manager {
+	m := &Manager{Hosts: []string{"chat.example.com", "www.example.com"}, Email: "ops@example.com", CacheDir: dir, DirectoryURL: ca.url("/dir"), pollInterval: time.Millisecond}
+	ca.mu.Lock()
+	ca.validate = m.HTTPHandler(nil)
+	ca.mu.Unlock()
+	return m
+}
+
+func TestObtainsAndCachesCertificate(t *testing.T) {
+	ca := newFakeCA(t)
+	dir := t.TempDir()
+	m := newManager(ca, dir)
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "chat.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cert.Leaf.DNSNames; len(got) != 2 || got[0] != "chat.example.com" || got[1] != "www.example.com" {
+		t.Fatalf("DNS names = %v", got)
+	}
+	if err := cert.Leaf.CheckSignatureFrom(ca.root); err != nil {
+		t.Fatalf("not issued by the CA: %v", err)
+	}
+	if again, _ := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"}); again != cert {
+		t.Fatal("second handshake did not reuse the certificate")
+	}
+
+	// A restart serves the cached certificate without a new order.
+	restarted := newManager(ca, dir)
+	cached, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "chat.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.orderCount() != 1 || cached.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+		t.Fatalf("orders = %d, cached serial %v, first serial %v", ca.orderCount(), cached.Leaf.SerialNumber, cert.Leaf.SerialNumber)
+	}
+}
+
+func TestRejectsUnknownHost(t *testing.T) {
+	ca := newFakeCA(t)
+	m := newManager(ca, t.TempDir())
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example.net"}); err == nil {
+		t.Fatal("certificate handed out for an unconfigured host")
+	}
+	if ca.orderCount() != 0 {
+		t.Fatal("unknown host triggered an order")
+	}
+}
+
+func TestRenewsExpiringCertificate(t *testing.T) {
+	ca := newFakeCA(t)
+	ca.lifetime = 10 * 24 * time.Hour
+	m := newManager(ca, t.TempDir())
+	hello := &tls.ClientHelloInfo{ServerName: "chat.example.com"}
+	first, err := m.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.mu.Lock()
+	ca.lifetime = 90 * 24 * time.Hour
+	ca.mu.Unlock()
+
+	// The expiring certificate is still served while the renewal runs.
+	if cert, err := m.GetCertificate(hello); err != nil || cert != first {
+		t.Fatalf("during renewal got %v, %v", cert, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := m.GetCertificate(hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != first {
+			if left := time.Until(cert.Leaf.NotAfter); left < 80*24*time.Hour {
+				t.Fatalf("renewed certificate expires in %v", left)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("certificate not renewed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := ca.orderCount(); n != 2 {
+		t.Fatalf("orders = %d, want 2", n)
+	}
+}
+
+func TestRetriesBadNonce(t *testing.T) {
+	ca := newFakeCA(t)
+	ca.rejectNext = true
+	m := newManager(ca, t.TempDir())
+	if _, err := m.Ensure(context.Background()); err != nil {
+		t.Fatalf("badNonce not retried: %v", err)
+	}
+}
+
+func TestFailedChallengeIsReported(t *testing.T) {
+	ca := newFakeCA(t)
+	m := newManager(ca, t.TempDir())
+	ca.validate = http.NotFoundHandler()
+	_, err := m.Ensure(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestHTTPHandlerRedirectsToHTTPS(t *testing.T) {
+	m := &Manager{Hosts: []string{"chat.example.com"}}
+	m.tokens.Store("abc", "abc.thumb")
+
+	rec := httptest.NewRecorder()
+	m.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://chat.example.com"+ChallengePath+"abc", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "abc.thumb" {
+		t.Fatalf("challenge: %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	m.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://chat.example.com:80/days/2025-10-16?x=1", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://chat.example.com/days/2025-10-16?x=1" {
+		t.Fatalf("redirect: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	m.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://other.example.net/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown host: %d", rec.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/vectors"
+)
+
+// 问答检索的消息条数默认值与上限。
+const (
+	defaultAskSources = 8
+	maxAskSources     = 20
+)
+
+const noSourcesAnswer = "归档里没有找到相关的消息。"
+
+// Answerer 以 sources 为依据回答 question，回答中用 [n] 引用第 n 条消息。
+// delta 非空时流式返回，每收到一段回答就调用一次。
+type Answerer func(ctx context.Context, question string, sources []vectors.Hit, delta func(string)) (string, error)
+
+// askRequest 是 /api/v1/ask 的请求体。
+type askRequest struct {
+	Question string `json:"question"`
+	Talker   string `json:"talker,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+var askDocs = []operation{{
+	ID: "ask", Method: http.MethodPost, Path: "/api/v1/ask", Tag: "search",
+	Summary: "问答助手：检索相关消息后由模型作答，[n] 引用第 n 条来源；Accept: text/event-stream 时以 SSE 流式返回",
+	Body:    askRequest{},
+	Response: struct {
+		Question string        `json:"question"`
+		Answer   string        `json:"answer"`
+		Sources  []vectors.Hit `json:"sources"`
+	}{},
+}}
+
+// EnableAssistant 挂载 POST /api/v1/ask：先用语义搜索检索相关消息，再交给
+// answer 生成带引用的回答。需先调用 EnableSemanticSearch；再次调用只替换 answer。
+func (s *Server) EnableAssistant(answer Answerer) error {
+	if answer == nil {
+		return errors.New("answerer is required")
+	}
+	if s.semantic.Load() == nil {
+		return errors.New("semantic search is required")
+	}
+	if s.answer.Swap(&answer) == nil {
+		s.route(s.handleAsk, askDocs, "/api/v1/ask")
+	}
+	return nil
+}
+
+// handleAsk 处理 POST /api/v1/ask。请求头 Accept 含 text/event-stream 时以
+// SSE 流式返回：先发 sources 事件，再逐段发 delta，最后发 done 或 error；
+// 否则一次性返回 {question, answer, sources}。
+func (s *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req askRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("请求体不是合法 JSON: %w", err))
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("缺少问题 question")))
+		return
+	}
+	for _, d := range []string{req.From, req.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("日期格式非法: %w", err))
+			return
+		}
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultAskSources
+	}
+
+	sem := s.semantic.Load()
+	vec, err := sem.embed(r.Context(), req.Question)
+	if err != nil {
+		log.Printf("embed question failed: %v", err)
+		writeError(w, http.StatusBadGateway, errors.New(i18n.T("问题向量化失败")))
+		return
+	}
+	sources, err := sem.index.Search(vectors.Query{
+		Vector: vec,
+		From:   req.From,
+		To:     req.To,
+		Talker: req.Talker,
+		Limit:  min(req.Limit, maxAskSources),
+	}, sem.model)
+	if err != nil {
+		log.Printf("search sources failed: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取向量索引失败")))
+		return
+	}
+	answer := *s.answer.Load()
+	if len(sources) == 0 {
+		// 没有可引用的消息时不调用模型，避免凭空作答。
+		sources = []vectors.Hit{}
+		answer = func(_ context.Context, _ string, _ []vectors.Hit, delta func(string)) (string, error) {
+			if delta != nil {
+				delta(i18n.T(noSourcesAnswer))
+			}
+			return i18n.T(noSourcesAnswer), nil
+		}
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		text, err := answer(r.Context(), req.Question, sources, nil)
+		if err != nil {
+			log.Printf("answer question failed: %v", err)
+			writeError(w, http.StatusBadGateway, errors.New(i18n.T("生成回答失败")))
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]any{"question": req.Question, "answer": text, "sources": sources})
+		return
+	}
+
+	// 回答可能超过服务端的写超时，流式响应期间放宽截止时间。
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(2 * time.Minute))
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, payload any) {
+		b, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		_ = rc.Flush()
+	}
+	send("sources", sources)
+	if _, err := answer(r.Context(), req.Question, sources, func(text string) {
+		send("delta", map[string]string{"text": text})
+	}); err != nil {
+		log.Printf("answer question failed: %v", err)
+		send("error", map[string]string{"error": i18n.T("生成回答失败")})
+		return
+	}
+	send("done", map[string]any{})
+}
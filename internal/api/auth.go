@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"wechat-view/internal/i18n"
+)
+
+// AuthOptions 配置访问鉴权。Tokens 用于 Authorization: Bearer，
+// Users 为 Basic Auth 的用户名到密码；两者可同时配置，任一通过即可。
+type AuthOptions struct {
+	Tokens []string
+	Users  map[string]string
+	// Realm 显示在浏览器的登录框中，默认 wechat-view。
+	Realm string
+	// Public 列出无需鉴权的路径，以 / 结尾的按前缀匹配；默认仅 /healthz。
+	Public []string
+}
+
+// auth 校验请求凭据。令牌与密码只保存 SHA-256 摘要，并用常量时间比较。
+type auth struct {
+	tokens [][32]byte
+	users  map[string][32]byte
+	realm  string
+	public []string
+}
+
+type authUserKey struct{}
+
+// EnableAuth 要求之后的所有请求（含托管站点）携带有效凭据，Public 中的路径除外。
+// 再次调用会替换现有凭据。
+func (s *Server) EnableAuth(opts AuthOptions) error {
+	a := &auth{users: map[string][32]byte{}, realm: opts.Realm, public: opts.Public}
+	for _, t := range opts.Tokens {
+		if t = strings.TrimSpace(t); t != "" {
+			a.tokens = append(a.tokens, sha256.Sum256([]byte(t)))
+		}
+	}
+	for user, pass := range opts.Users {
+		if strings.TrimSpace(user) == "" || pass == "" {
+			return fmt.Errorf("basic auth user %q needs a name and a password", user)
+		}
+		a.users[user] = sha256.Sum256([]byte(pass))
+	}
+	if len(a.tokens) == 0 && len(a.users) == 0 {
+		return errors.New("auth needs at least one token or user")
+	}
+	if a.realm == "" {
+		a.realm = "wechat-view"
+	}
+	if a.public == nil {
+		a.public = []string{"/healthz"}
+	}
+	s.auth.Store(a)
+	return nil
+}
+
+// DisableAuth 关闭鉴权。
+func (s *Server) DisableAuth() {
+	s.auth.Store(nil)
+}
+
+// check 返回通过鉴权的请求；查看者身份写入上下文供水印使用：Basic Auth
+// 为用户名，Bearer 令牌为 token- 加令牌 SHA-256 的前 8 位十六进制。
+func (a *auth) check(r *http.Request) (*http.Request, bool) {
+	if matchPath(a.public, r.URL.Path) {
+		return r, true
+	}
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		sum := sha256.Sum256([]byte(strings.TrimSpace(header[7:])))
+		ok := 0
+		for _, t := range a.tokens {
+			ok |= subtle.ConstantTimeCompare(sum[:], t[:])
+		}
+		if ok != 1 {
+			return r, false
+		}
+		return r.WithContext(context.WithValue(r.Context(), authUserKey{}, "token-"+hex.EncodeToString(sum[:4]))), true
+	}
+	if user, pass, found := r.BasicAuth(); found {
+		want, known := a.users[user]
+		sum := sha256.Sum256([]byte(pass))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 && known {
+			return r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)), true
+		}
+	}
+	return r, false
+}
+
+func (a *auth) challenge(w http.ResponseWriter) {
+	if len(a.users) > 0 {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, a.realm))
+	}
+	if len(a.tokens) > 0 {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, a.realm))
+	}
+	writeError(w, http.StatusUnauthorized, errors.New(i18n.T("未授权，请提供有效的访问令牌或账号")))
+}
+
+// authUser 返回通过鉴权的查看者身份，见 check；未鉴权时为空。
+func authUser(r *http.Request) string {
+	user, _ := r.Context().Value(authUserKey{}).(string)
+	return user
+}
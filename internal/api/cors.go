@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions 允许浏览器中其他域名下的看板调用接口。
+type CORSOptions struct {
+	// Origins 列出允许的来源（如 https://dash.example.com），"*" 允许任意来源。
+	Origins []string
+	// Headers 为预检允许的请求头，默认 Authorization 与 Content-Type。
+	Headers []string
+	// MaxAge 为浏览器缓存预检结果的时长，默认 10 分钟。
+	MaxAge time.Duration
+}
+
+// cors 为匹配的来源写入 Access-Control-* 响应头，并直接应答预检请求。
+type cors struct {
+	origins map[string]bool
+	any     bool
+	headers string
+	maxAge  string
+}
+
+// EnableCORS 开启跨域访问，再次调用会替换现有配置。
+// 凭据（Authorization）只对明确列出的来源放行。
+func (s *Server) EnableCORS(opts CORSOptions) error {
+	c := &cors{origins: map[string]bool{}}
+	for _, o := range opts.Origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch {
+		case o == "":
+		case o == "*":
+			c.any = true
+		default:
+			c.origins[strings.ToLower(o)] = true
+		}
+	}
+	if !c.any && len(c.origins) == 0 {
+		return errors.New("cors needs at least one allowed origin")
+	}
+	headers := opts.Headers
+	if len(headers) == 0 {
+		headers = []string{"Authorization", "Content-Type"}
+	}
+	c.headers = strings.Join(headers, ", ")
+	maxAge := opts.MaxAge
+	if maxAge <= 0 {
+		maxAge = 10 * time.Minute
+	}
+	c.maxAge = strconv.Itoa(int(maxAge.Seconds()))
+	s.cors.Store(c)
+	return nil
+}
+
+// DisableCORS 关闭跨域访问。
+func (s *Server) DisableCORS() {
+	s.cors.Store(nil)
+}
+
+// allows 判断是否放行来自 origin 的请求。
+func (c *cors) allows(origin string) bool {
+	return c.any || c.origins[strings.ToLower(origin)]
+}
+
+// handle 写入跨域响应头；预检请求在此应答并返回 true。
+// 预检不带凭据，所以要在鉴权之前处理。
+func (c *cors) handle(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if !c.allows(origin) {
+		return false
+	}
+	listed := c.origins[strings.ToLower(origin)]
+	if listed {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+	h.Set("Access-Control-Expose-Headers", "Retry-After, ETag, Last-Modified")
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", c.headers)
+	h.Set("Access-Control-Max-Age", c.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
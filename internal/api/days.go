@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/archive"
+)
+
+// defaultDayCacheSize 为默认缓存的日文件个数。
+const defaultDayCacheSize = 16
+
+// dayFile 是读入内存的一天原始数据。body 与 etag 不可修改，可被多个请求共享。
+type dayFile struct {
+	date    string
+	modTime time.Time
+	// size 为磁盘上文件的大小，压缩归档时小于 body。
+	size int64
+	body []byte
+	// etag 为内容 SHA-256 生成的强 ETag（含引号）。
+	etag string
+
+	parseOnce sync.Once
+	doc       map[string]json.RawMessage
+	msgs      []map[string]any
+	parseErr  error
+}
+
+// parsed 返回顶层字段与消息列表，首次调用时解析并缓存。
+func (d *dayFile) parsed() (map[string]json.RawMessage, []map[string]any, error) {
+	d.parseOnce.Do(func() {
+		if err := json.Unmarshal(d.body, &d.doc); err != nil {
+			d.parseErr = err
+			return
+		}
+		if raw, ok := d.doc["messages"]; ok {
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			if err := dec.Decode(&d.msgs); err != nil {
+				d.parseErr = fmt.Errorf("messages: %w", err)
+			}
+		}
+	})
+	return d.doc, d.msgs, d.parseErr
+}
+
+// dayCache 是日文件的 LRU 缓存。每次取用都会 stat 文件，修改时间或大小
+// 变化（重新抓取、刷新）后重新读取，因此不会返回过期内容。
+type dayCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // 最近使用的在前，元素值为 *dayFile
+	days  map[string]*list.Element
+}
+
+// SetDayCacheSize 设置内存中缓存的日文件个数，0 使用默认值 16，负数关闭缓存。
+// 可在运行中调用，缩小时淘汰最久未用的日文件。
+func (s *Server) SetDayCacheSize(n int) {
+	if n == 0 {
+		n = defaultDayCacheSize
+	}
+	if n < 0 {
+		n = 0
+	}
+	c := &s.days
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = n
+	c.evict()
+}
+
+// loadDay 返回 date 的原始数据，优先使用缓存。
+func (s *Server) loadDay(date string) (*dayFile, error) {
+	path := s.dayPath(date)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &s.days
+	c.mu.Lock()
+	if el, ok := c.days[date]; ok {
+		if d := el.Value.(*dayFile); d.modTime.Equal(info.ModTime()) && d.size == info.Size() {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return d, nil
+		}
+	}
+	c.mu.Unlock()
+
+	body, err := archive.ReadRawFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// ETag 按解压后的内容计算，压缩归档不会让客户端缓存失效。
+	sum := sha256.Sum256(body)
+	d := &dayFile{date: date, modTime: info.ModTime(), size: info.Size(), body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	if after, err := os.Stat(path); err != nil || !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		// 读取期间文件被替换，不缓存这个版本。
+		return d, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return d, nil
+	}
+	if c.days == nil {
+		c.order = list.New()
+		c.days = map[string]*list.Element{}
+	}
+	if el, ok := c.days[date]; ok {
+		el.Value = d
+		c.order.MoveToFront(el)
+	} else {
+		c.days[date] = c.order.PushFront(d)
+	}
+	c.evict()
+	return d, nil
+}
+
+// evict 淘汰超出容量的日文件，调用方需持有 mu。
+func (c *dayCache) evict() {
+	for c.order != nil && c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.days, el.Value.(*dayFile).date)
+	}
+}
+
+// notModified 写出 ETag 与 Last-Modified，并在请求的 If-None-Match 匹配
+// etag（弱比较，gzip 后弱化的 ETag 同样匹配），或没有 If-None-Match 而
+// If-Modified-Since 不早于 modTime 时写出 304 并返回 true。供按内容生成
+// 响应的 JSON 接口使用，modTime 为零时只看 ETag。
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			match = match || tag == "*" || tag == etag
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.IsZero() {
+		match = !modTime.Truncate(time.Second).After(ims)
+	}
+	if match {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return match
+}
+
+// derivedETag 为由 base 内容按 parts 派生出的响应生成强 ETag。
+func derivedETag(base string, parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(base))
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/render"
+)
+
+// 事件推送的默认检查间隔、心跳间隔与写超时。
+const (
+	defaultEventsInterval = 2 * time.Second
+	eventsPing            = 30 * time.Second
+	eventsWriteTimeout    = 10 * time.Second
+	// eventsBuffer 是每个连接积压的事件上限，超出说明客户端读得太慢，断开它。
+	eventsBuffer = 64
+)
+
+// Event 是 /api/v1/events 推送的一条消息。
+type Event struct {
+	// Type 为 hello（连接建立）、day（某天的日报重新生成）或 site（一次生成结束）。
+	Type string `json:"type"`
+	// Date 与 URL 只出现在 day 事件中，URL 相对站点根目录。
+	Date string `json:"date,omitempty"`
+	URL  string `json:"url,omitempty"`
+	// GeneratedAt 为站点清单的生成时间。
+	GeneratedAt string `json:"generatedAt,omitempty"`
+	// Files 为 site 事件中内容有变化的文件数。
+	Files int `json:"files,omitempty"`
+}
+
+// EventOptions 配置 /api/v1/events。
+type EventOptions struct {
+	// SiteDir 为生成的站点目录，通过其中的 build-manifest.json 发现重新生成的日报。
+	SiteDir string
+	// Interval 为检查清单的间隔，默认 2 秒。
+	Interval time.Duration
+}
+
+// events 监视站点清单，把变化广播给所有 WebSocket 连接。
+type events struct {
+	dir      string
+	interval time.Duration
+
+	mu          sync.Mutex
+	subs        map[chan Event]struct{}
+	modTime     time.Time
+	generatedAt string
+	files       map[string]string
+}
+
+var dayPageRegexp = regexp.MustCompile(`^(\d{4})/(\d{2})/(\d{2})/(?:index\.html|meta\.json)$`)
+
+// EnableEvents 挂载 GET /api/v1/events（WebSocket）。每次 report 运行结束写入
+// build-manifest.json 后，推送内容变化的每一天（day 事件）和一次 site 事件，
+// 看板收到后刷新即可，不必轮询 meta.json。daemon、--from/--to 与 recalc 的
+// 运行都会触发。只能调用一次。
+func (s *Server) EnableEvents(opts EventOptions) error {
+	if strings.TrimSpace(opts.SiteDir) == "" {
+		return errors.New("site dir is required")
+	}
+	dir, err := filepath.Abs(opts.SiteDir)
+	if err != nil {
+		return fmt.Errorf("resolve site dir: %w", err)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultEventsInterval
+	}
+	e := &events{dir: dir, interval: opts.Interval, subs: map[chan Event]struct{}{}}
+	if !s.events.CompareAndSwap(nil, e) {
+		return errors.New("events already enabled")
+	}
+	e.poll()
+	go e.watch()
+	s.route(s.handleEvents, eventsDocs, "/api/v1/events")
+	return nil
+}
+
+var eventsDocs = []operation{{
+	ID: "events", Method: http.MethodGet, Path: "/api/v1/events", Tag: "live",
+	Summary: "WebSocket：日报重新生成后推送事件，每个文本帧为一条 Event JSON",
+	Status:  http.StatusSwitchingProtocols,
+}}
+
+// handleEvents 升级为 WebSocket，先发送 hello，之后逐条推送事件（文本帧，
+// 内容为 Event 的 JSON），空闲时发送 ping。
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	allow := func(origin string) bool {
+		c := s.cors.Load()
+		return c != nil && c.allows(origin)
+	}
+	conn, err := upgradeWebSocket(w, r, allow)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	e := s.events.Load()
+	ch, hello := e.subscribe()
+	defer e.unsubscribe(ch)
+	send := func(ev Event) bool {
+		b, _ := json.Marshal(ev)
+		return conn.WriteText(b, eventsWriteTimeout) == nil
+	}
+	if !send(hello) {
+		return
+	}
+	closed := make(chan struct{})
+	go func() {
+		_ = conn.readLoop()
+		close(closed)
+	}()
+	ping := time.NewTicker(eventsPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-ch:
+			if !ok || !send(ev) {
+				return
+			}
+		case <-ping.C:
+			if conn.writeFrame(wsPing, nil, eventsWriteTimeout) != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribe 注册一个连接，返回其事件通道和当前状态的 hello 事件。
+func (e *events) subscribe() (chan Event, Event) {
+	ch := make(chan Event, eventsBuffer)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subs[ch] = struct{}{}
+	return ch, Event{Type: "hello", GeneratedAt: e.generatedAt}
+}
+
+func (e *events) unsubscribe(ch chan Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.subs[ch]; ok {
+		delete(e.subs, ch)
+		close(ch)
+	}
+}
+
+func (e *events) watch() {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	for range t.C {
+		e.poll()
+	}
+}
+
+// poll 在清单修改时间变化后重新读取，对比每个文件的哈希并广播变化。
+// EnableEvents 中的首次读取还没有连接，只记录现状。
+func (e *events) poll() {
+	info, err := os.Stat(filepath.Join(e.dir, render.ManifestName))
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	unchanged := info.ModTime().Equal(e.modTime)
+	e.mu.Unlock()
+	if unchanged {
+		return
+	}
+	m, err := render.LoadManifest(e.dir)
+	if err != nil {
+		log.Printf("load %s failed: %v", render.ManifestName, err)
+		return
+	}
+	files := make(map[string]string, len(m.Files))
+	for name, f := range m.Files {
+		files[name] = f.SHA256
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := e.files
+	e.modTime, e.generatedAt, e.files = info.ModTime(), m.GeneratedAt, files
+	changed := 0
+	var days []string
+	seen := map[string]bool{}
+	for name, sum := range files {
+		if prev[name] == sum {
+			continue
+		}
+		changed++
+		if d := dayPageRegexp.FindStringSubmatch(name); d != nil {
+			if day := d[1] + "-" + d[2] + "-" + d[3]; !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+	}
+	if changed == 0 {
+		return
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		e.broadcast(Event{Type: "day", Date: day, URL: strings.ReplaceAll(day, "-", "/") + "/", GeneratedAt: m.GeneratedAt})
+	}
+	e.broadcast(Event{Type: "site", GeneratedAt: m.GeneratedAt, Files: changed})
+}
+
+// broadcast 把事件放进每个连接的通道；通道已满的连接被断开。调用方持有 mu。
+func (e *events) broadcast(ev Event) {
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinBytes 以下的响应压缩后省不了多少，直接原样返回。
+const gzipMinBytes = 1024
+
+var gzipWriters = sync.Pool{New: func() any {
+	zw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+	return zw
+}}
+
+// gzipResponse 在客户端接受 gzip 时压缩 JSON 响应。已有 Content-Encoding、
+// 非 JSON（如 SSE）、无响应体的状态码、范围请求以及小于 gzipMinBytes 的响应
+// 都原样透传；长度未知时先缓冲 gzipMinBytes 字节再决定。
+type gzipResponse struct {
+	http.ResponseWriter
+	rangeReq bool
+	// status 非零表示处理器已写响应头，但还在缓冲、未发给客户端。
+	status      int
+	buf         []byte
+	zw          *gzip.Writer
+	wroteHeader bool
+}
+
+// withGzip 在 r 接受 gzip 时包装 w，返回的 done 必须在处理结束后调用。
+func withGzip(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		return w, func() {}
+	}
+	g := &gzipResponse{ResponseWriter: w, rangeReq: r.Header.Get("Range") != ""}
+	return g, g.close
+}
+
+func (g *gzipResponse) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.Header()
+	if g.rangeReq || h.Get("Content-Encoding") != "" || code == http.StatusNoContent || code == http.StatusNotModified || code < 200 ||
+		!strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+		if n >= gzipMinBytes {
+			g.startGzip(code)
+		} else {
+			g.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	g.status = code
+}
+
+// startGzip 改写响应头、发出 code，并把缓冲的内容写入压缩流。
+func (g *gzipResponse) startGzip(code int) {
+	h := g.Header()
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	h.Set("Content-Encoding", "gzip")
+	// 压缩后内容不同，弱化 ETag 以免与未压缩的表示混用。
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	g.ResponseWriter.WriteHeader(code)
+	g.zw = gzipWriters.Get().(*gzip.Writer)
+	g.zw.Reset(g.ResponseWriter)
+	g.status = 0
+	if len(g.buf) > 0 {
+		_, _ = g.zw.Write(g.buf)
+		g.buf = nil
+	}
+}
+
+// writePlain 不压缩，发出缓冲的响应头与内容。
+func (g *gzipResponse) writePlain() error {
+	g.ResponseWriter.WriteHeader(g.status)
+	g.status = 0
+	buf := g.buf
+	g.buf = nil
+	_, err := g.ResponseWriter.Write(buf)
+	return err
+}
+
+func (g *gzipResponse) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case g.zw != nil:
+		return g.zw.Write(b)
+	case g.status != 0:
+		g.buf = append(g.buf, b...)
+		if len(g.buf) >= gzipMinBytes {
+			g.startGzip(g.status)
+		}
+		return len(b), nil
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush 先发出缓冲与已压缩的数据，再透传给底层 ResponseWriter。
+func (g *gzipResponse) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.status != 0 {
+		g.startGzip(g.status)
+	}
+	if g.zw != nil {
+		_ = g.zw.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter。
+func (g *gzipResponse) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponse) close() {
+	if g.status != 0 {
+		_ = g.writePlain()
+		return
+	}
+	if g.zw == nil {
+		return
+	}
+	_ = g.zw.Close()
+	g.zw.Reset(io.Discard)
+	gzipWriters.Put(g.zw)
+	g.zw = nil
+}
+
+// acceptsGzip 判断 Accept-Encoding 是否接受 gzip（q=0 表示拒绝）。
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "gzip" && name != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
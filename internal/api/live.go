@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/i18n"
+)
+
+// 实时消息的默认轮询间隔、首屏条数与心跳间隔。
+const (
+	defaultLiveInterval = 5 * time.Second
+	defaultLiveBacklog  = 20
+	maxLiveBacklog      = 200
+	liveHeartbeat       = 30 * time.Second
+)
+
+// LiveFetcher 返回 talker 在 day（YYYY-MM-DD）当天至今的全部消息，按时间排序。
+type LiveFetcher func(ctx context.Context, day, talker string) ([]chatlog.Message, error)
+
+// LiveOptions 配置 GET /api/v1/live。
+type LiveOptions struct {
+	Fetch LiveFetcher
+	// Talkers 为允许订阅的群，第一个是未带 talker 参数时的默认值。
+	Talkers []string
+	// Interval 为轮询 chatlog 的间隔，默认 5 秒。
+	Interval time.Duration
+	// Backlog 为连接时先补发的当天最近消息条数，默认 20。
+	Backlog int
+	// DayStartHour 为日报的日界（本地时间 0-23 点），与 report.dayStartHour
+	// 一致；未到该钟点时仍算作前一天。
+	DayStartHour int
+	// Filter 非空时在推送前处理每次抓取的全部消息，如替换为化名。
+	Filter func([]chatlog.Message) []chatlog.Message
+	// Now 仅供测试替换当前时间。
+	Now func() time.Time
+}
+
+// live 轮询 chatlog，同一群的多个订阅共享一次抓取结果。
+type live struct {
+	opts    LiveOptions
+	allowed map[string]bool
+
+	mu    sync.Mutex
+	polls map[string]*livePoll
+}
+
+// livePoll 是某个群某天最近一次抓取的结果。
+type livePoll struct {
+	done chan struct{}
+	at   time.Time
+	day  string
+	msgs []chatlog.Message
+	err  error
+}
+
+// EnableLive 挂载 GET /api/v1/live，以 Server-Sent Events 推送今天的新消息；
+// 再次调用替换配置，进行中的连接在下次轮询时生效。
+func (s *Server) EnableLive(opts LiveOptions) error {
+	if opts.Fetch == nil {
+		return errors.New("live fetcher is required")
+	}
+	if len(opts.Talkers) == 0 {
+		return errors.New("at least one talker is required")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultLiveInterval
+	}
+	if opts.Backlog <= 0 {
+		opts.Backlog = defaultLiveBacklog
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	l := &live{opts: opts, allowed: map[string]bool{}, polls: map[string]*livePoll{}}
+	for _, t := range opts.Talkers {
+		l.allowed[t] = true
+	}
+	if s.live.Swap(l) == nil {
+		s.liveOnce.Do(func() { s.route(s.handleLive, liveDocs, "/api/v1/live") })
+	}
+	return nil
+}
+
+// DisableLive 关闭实时消息，已挂载的路由返回 404，进行中的连接随之结束。
+func (s *Server) DisableLive() {
+	s.live.Store(nil)
+}
+
+var liveDocs = []operation{{
+	ID: "live", Method: http.MethodGet, Path: "/api/v1/live", Tag: "live",
+	Summary: "实时消息（SSE）：message 事件的 data 为消息 JSON，id 为消息键",
+	Params: []param{
+		{Name: "talker", In: "query", Description: "群 ID，默认配置中的第一个"},
+		{Name: "backlog", In: "query", Description: "先补发的最近消息条数", Type: "integer"},
+	},
+	ContentType: "text/event-stream",
+}}
+
+// handleLive 处理 GET /api/v1/live?talker=。先补发当天最近 backlog 条消息
+// （带 Last-Event-ID 重连时改为补发其后的消息），之后每次轮询推送新消息。
+// 事件：message（data 为消息 JSON，id 为消息键）、error（抓取失败，稍后重试），
+// 空闲时发送注释行作为心跳。
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	l := s.live.Load()
+	if l == nil {
+		writeError(w, http.StatusNotFound, errors.New(i18n.T("未开启实时消息")))
+		return
+	}
+	q := r.URL.Query()
+	talker := strings.TrimSpace(q.Get("talker"))
+	if talker == "" {
+		talker = l.opts.Talkers[0]
+	}
+	if !l.allowed[talker] {
+		writeError(w, http.StatusForbidden, i18n.Errorf("不允许订阅 %s", talker))
+		return
+	}
+	backlog := l.opts.Backlog
+	if v := q.Get("backlog"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, errors.New(i18n.T("backlog 须为非负整数")))
+			return
+		}
+		backlog = min(n, maxLiveBacklog)
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// 每次写入前延长截止时间，使连接不受服务端写超时限制。
+	write := func(format string, args ...any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(liveHeartbeat + l.opts.Interval))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !write("retry: %d\n\n", l.opts.Interval.Milliseconds()) {
+		return
+	}
+
+	var (
+		day      string
+		seen     map[string]bool
+		lastID   = r.Header.Get("Last-Event-ID")
+		lastSent = time.Now()
+		failing  bool
+	)
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+	for {
+		// 配置被替换或关闭后，按新配置继续或结束连接。
+		cur := s.live.Load()
+		if cur == nil || !cur.allowed[talker] {
+			return
+		}
+		l = cur
+		msgs, today, err := l.fetch(r.Context(), talker)
+		switch {
+		case r.Context().Err() != nil:
+			return
+		case err != nil:
+			if !failing {
+				log.Printf("live %s failed: %v", talker, err)
+				b, _ := json.Marshal(map[string]string{"error": i18n.T("读取 chatlog 失败，稍后重试")})
+				if !write("event: error\ndata: %s\n\n", b) {
+					return
+				}
+				lastSent = time.Now()
+			}
+			failing = true
+		default:
+			failing = false
+			var fresh []chatlog.Message
+			if today != day {
+				// 首次连接或跨天：只补发 backlog 条，之前的视为已读。
+				day, seen = today, make(map[string]bool, len(msgs))
+				start := max(len(msgs)-backlog, 0)
+				if lastID != "" {
+					for i, m := range msgs {
+						if liveKey(m) == lastID {
+							start = i + 1
+							break
+						}
+					}
+					lastID = ""
+				}
+				for i, m := range msgs {
+					seen[liveKey(m)] = true
+					if i >= start {
+						fresh = append(fresh, m)
+					}
+				}
+			} else {
+				for _, m := range msgs {
+					if k := liveKey(m); !seen[k] {
+						seen[k] = true
+						fresh = append(fresh, m)
+					}
+				}
+			}
+			for _, m := range fresh {
+				b, err := json.Marshal(m)
+				if err != nil {
+					continue
+				}
+				if !write("id: %s\nevent: message\ndata: %s\n\n", liveKey(m), b) {
+					return
+				}
+				lastSent = time.Now()
+			}
+		}
+		if time.Since(lastSent) >= liveHeartbeat {
+			if !write(": ping\n\n") {
+				return
+			}
+			lastSent = time.Now()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch 返回 talker 今天的消息。距上次抓取不足半个轮询间隔时复用结果，
+// 并发的请求只等同一次抓取，避免多块看板成倍请求 chatlog。
+func (l *live) fetch(ctx context.Context, talker string) ([]chatlog.Message, string, error) {
+	now := l.opts.Now()
+	day := now.Add(-time.Duration(l.opts.DayStartHour) * time.Hour).Format("2006-01-02")
+	l.mu.Lock()
+	p := l.polls[talker]
+	// 进行中的同日抓取直接等待；已完成的在半个间隔内复用。
+	if p == nil || p.day != day || (isClosed(p.done) && now.Sub(p.at) >= l.opts.Interval/2) {
+		p = &livePoll{done: make(chan struct{}), at: now, day: day}
+		l.polls[talker] = p
+		go func() {
+			// 不绑定单个请求的 ctx，以免首个订阅断开时取消其他订阅等待的抓取。
+			fctx, cancel := context.WithTimeout(context.Background(), max(l.opts.Interval*2, 10*time.Second))
+			defer cancel()
+			p.msgs, p.err = l.opts.Fetch(fctx, day, talker)
+			if p.err == nil && l.opts.Filter != nil {
+				p.msgs = l.opts.Filter(p.msgs)
+			}
+			close(p.done)
+		}()
+	}
+	l.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return nil, day, ctx.Err()
+	case <-p.done:
+		return p.msgs, p.day, p.err
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// liveKey 是 SSE 事件的 id：优先用消息 ID，否则用发送者、时间与内容哈希。
+func liveKey(m chatlog.Message) string {
+	for _, id := range []string{m.MsgID, m.ID} {
+		if id != "" && !strings.ContainsAny(id, "\r\n") {
+			return id
+		}
+	}
+	ts := m.Timestamp
+	if ts == 0 {
+		ts = m.CreateTime
+	}
+	h := fnv.New32a()
+	h.Write([]byte(m.Content))
+	sender := strings.NewReplacer("\r", "", "\n", "").Replace(firstNonEmpty(m.Sender, m.From, m.SenderName))
+	return fmt.Sprintf("%s@%d#%08x", sender, ts, h.Sum32())
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/diskcheck"
+	"wechat-view/internal/version"
+)
+
+// latencyBuckets 是请求耗时直方图的上界（秒）。
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route, method string
+	code          int
+}
+
+// routeStats 是单个路由的耗时直方图与响应字节数。
+type routeStats struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+	bytes   uint64
+}
+
+// metrics 以 Prometheus 文本格式导出请求计数、耗时、流量与归档状态。
+// 只用标准库实现，无需引入 client_golang。
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	routes   map[string]*routeStats
+	started  time.Time
+}
+
+// EnableMetrics 注册 GET /metrics，并开始统计之后的所有请求。
+func (s *Server) EnableMetrics() {
+	s.metrics = &metrics{
+		requests: map[requestKey]uint64{},
+		routes:   map[string]*routeStats{},
+		started:  time.Now(),
+	}
+	s.route(s.handleMetrics, metricsDocs, "/metrics")
+}
+
+var metricsDocs = []operation{{
+	ID: "metrics", Method: http.MethodGet, Path: "/metrics", Tag: "meta",
+	Summary: "Prometheus 指标", ContentType: "text/plain",
+}}
+
+// observe 记录一次请求。route 取自 ServeMux 匹配到的注册路径，
+// 避免把日期、id 等写进标签导致序列数膨胀。
+func (m *metrics) observe(route, method string, code int, bytes int64, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	secs := elapsed.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{route, method, code}]++
+	rs := m.routes[route]
+	if rs == nil {
+		rs = &routeStats{buckets: make([]uint64, len(latencyBuckets))}
+		m.routes[route] = rs
+	}
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			rs.buckets[i]++
+		}
+	}
+	rs.sum += secs
+	rs.count++
+	rs.bytes += uint64(bytes)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	s.metrics.write(bw)
+	writeArchiveMetrics(bw, s.dataDir)
+	_ = bw.Flush()
+}
+
+func (m *metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP wechat_view_build_info Version of the running API server.")
+	fmt.Fprintln(w, "# TYPE wechat_view_build_info gauge")
+	fmt.Fprintf(w, "wechat_view_build_info{version=%s} 1\n", quoteLabel(version.Version))
+	fmt.Fprintln(w, "# HELP wechat_view_start_time_seconds Unix time the API server started.")
+	fmt.Fprintln(w, "# TYPE wechat_view_start_time_seconds gauge")
+	fmt.Fprintf(w, "wechat_view_start_time_seconds %d\n", m.started.Unix())
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	fmt.Fprintln(w, "# HELP wechat_view_http_requests_total HTTP requests by route, method and status code.")
+	fmt.Fprintln(w, "# TYPE wechat_view_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "wechat_view_http_requests_total{route=%s,method=%s,code=\"%d\"} %d\n",
+			quoteLabel(k.route), quoteLabel(k.method), k.code, m.requests[k])
+	}
+
+	routes := make([]string, 0, len(m.routes))
+	for r := range m.routes {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes)
+	fmt.Fprintln(w, "# HELP wechat_view_http_request_duration_seconds HTTP request latency by route.")
+	fmt.Fprintln(w, "# TYPE wechat_view_http_request_duration_seconds histogram")
+	for _, r := range routes {
+		rs, label := m.routes[r], quoteLabel(r)
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "wechat_view_http_request_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n",
+				label, strconv.FormatFloat(le, 'g', -1, 64), rs.buckets[i])
+		}
+		fmt.Fprintf(w, "wechat_view_http_request_duration_seconds_bucket{route=%s,le=\"+Inf\"} %d\n", label, rs.count)
+		fmt.Fprintf(w, "wechat_view_http_request_duration_seconds_sum{route=%s} %s\n", label, strconv.FormatFloat(rs.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "wechat_view_http_request_duration_seconds_count{route=%s} %d\n", label, rs.count)
+	}
+	fmt.Fprintln(w, "# HELP wechat_view_http_response_bytes_total Response body bytes served by route.")
+	fmt.Fprintln(w, "# TYPE wechat_view_http_response_bytes_total counter")
+	for _, r := range routes {
+		fmt.Fprintf(w, "wechat_view_http_response_bytes_total{route=%s} %d\n", quoteLabel(r), m.routes[r].bytes)
+	}
+}
+
+// writeArchiveMetrics 在抓取时扫描数据目录，导出归档天数、体积、所在磁盘剩余空间与最新一天。
+func writeArchiveMetrics(w *bufio.Writer, dataDir string) {
+	days, err := archive.ListDays(dataDir)
+	if err != nil {
+		days = nil
+	}
+	var size int64
+	for _, day := range days {
+		p, _ := archive.FindRaw(dataDir, day)
+		if info, err := os.Stat(p); err == nil {
+			size += info.Size()
+		}
+	}
+	fmt.Fprintln(w, "# HELP wechat_view_archive_days Number of archived raw days.")
+	fmt.Fprintln(w, "# TYPE wechat_view_archive_days gauge")
+	fmt.Fprintf(w, "wechat_view_archive_days %d\n", len(days))
+	fmt.Fprintln(w, "# HELP wechat_view_archive_bytes Total size of the archived raw day files.")
+	fmt.Fprintln(w, "# TYPE wechat_view_archive_bytes gauge")
+	fmt.Fprintf(w, "wechat_view_archive_bytes %d\n", size)
+	if free, total, err := diskcheck.FreeSpace(dataDir); err == nil {
+		fmt.Fprintln(w, "# HELP wechat_view_disk_free_bytes Free space on the file system holding the data directory.")
+		fmt.Fprintln(w, "# TYPE wechat_view_disk_free_bytes gauge")
+		fmt.Fprintf(w, "wechat_view_disk_free_bytes %d\n", free)
+		fmt.Fprintln(w, "# HELP wechat_view_disk_total_bytes Size of the file system holding the data directory.")
+		fmt.Fprintln(w, "# TYPE wechat_view_disk_total_bytes gauge")
+		fmt.Fprintf(w, "wechat_view_disk_total_bytes %d\n", total)
+	}
+	if len(days) == 0 {
+		return
+	}
+	latest, err := time.ParseInLocation("2006-01-02", days[len(days)-1], time.Local)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP wechat_view_archive_latest_day_timestamp_seconds Local midnight of the most recent archived day, as Unix time.")
+	fmt.Fprintln(w, "# TYPE wechat_view_archive_latest_day_timestamp_seconds gauge")
+	fmt.Fprintf(w, "wechat_view_archive_latest_day_timestamp_seconds %d\n", latest.Unix())
+}
+
+// quoteLabel 按 Prometheus 文本格式转义标签值。
+func quoteLabel(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
+
+// statusRecorder 记录处理器写出的状态码与字节数。
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush 透传给底层 ResponseWriter，保持流式响应可用。
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter。
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/version"
+)
+
+// operation 描述一个接口，是生成 /api/v1/openapi.json 的路由元数据。
+// 路由通过 s.route 与说明一起注册，条件挂载的接口（风险复核、语义搜索等）
+// 开启后才出现在文档中。
+type operation struct {
+	// ID 为 operationId，用于生成客户端的方法名，需全局唯一。
+	ID     string
+	Method string
+	// Path 为 OpenAPI 路径模板，如 /api/v1/chatlogs/{date}。
+	Path    string
+	Tag     string
+	Summary string
+	Params  []param
+	// Body 为请求体的零值，按其类型生成 schema；nil 表示没有请求体。
+	Body any
+	// Status 为成功时的状态码，默认 200。
+	Status int
+	// Response 为成功响应的零值，按其类型生成 schema；ContentType 不是
+	// JSON 时忽略。ContentType 默认 application/json。
+	Response    any
+	ContentType string
+}
+
+// param 是查询或路径参数。Type 为 string（默认）、integer 或 number。
+type param struct {
+	Name        string
+	In          string
+	Description string
+	Type        string
+	Required    bool
+	Enum        []string
+}
+
+// 各接口共用的参数。
+var (
+	pathDateParam  = param{Name: "date", In: "path", Description: "日期，YYYY-MM-DD", Required: true}
+	queryDateParam = param{Name: "date", In: "query", Description: "日期，YYYY-MM-DD"}
+	fromParam      = param{Name: "from", In: "query", Description: "起始日期（含），YYYY-MM-DD"}
+	toParam        = param{Name: "to", In: "query", Description: "结束日期（含），YYYY-MM-DD"}
+)
+
+// apiDocs 保存已注册接口的说明，按 方法+路径 去重，重复挂载时以后者为准。
+type apiDocs struct {
+	mu  sync.Mutex
+	ops map[string]operation
+}
+
+// route 把 h 注册到 patterns，并记录其接口说明。
+func (s *Server) route(h http.HandlerFunc, ops []operation, patterns ...string) {
+	for _, p := range patterns {
+		s.mux.HandleFunc(p, h)
+	}
+	s.docs.mu.Lock()
+	defer s.docs.mu.Unlock()
+	if s.docs.ops == nil {
+		s.docs.ops = map[string]operation{}
+	}
+	for _, op := range ops {
+		s.docs.ops[op.Method+" "+op.Path] = op
+	}
+}
+
+// operations 返回已注册的接口说明，按路径与方法排序。
+func (s *Server) operations() []operation {
+	s.docs.mu.Lock()
+	ops := make([]operation, 0, len(s.docs.ops))
+	for _, op := range s.docs.ops {
+		ops = append(ops, op)
+	}
+	s.docs.mu.Unlock()
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+var openAPIDocs = []operation{{
+	ID: "getOpenAPI", Method: http.MethodGet, Path: "/api/v1/openapi.json", Tag: "meta",
+	Summary: "本接口文档（OpenAPI 3.0），只包含当前已开启的接口", Response: map[string]any{},
+}}
+
+// handleOpenAPI 处理 GET /api/v1/openapi.json。
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, s.openAPI())
+}
+
+// openAPI 由已注册接口的说明生成 OpenAPI 3.0 文档。开启鉴权时声明
+// Bearer/Basic 两种方式，公开路径标记为无需鉴权。
+func (s *Server) openAPI() map[string]any {
+	c := schemas{"Error": map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"error": map[string]any{"type": "string"}},
+		"required":   []string{"error"},
+	}}
+	a := s.auth.Load()
+	paths := map[string]map[string]any{}
+	for _, op := range s.operations() {
+		item := paths[op.Path]
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = c.operation(op, a)
+	}
+	components := map[string]any{"schemas": c}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "wechat-view API",
+			"version": version.Version,
+		},
+		"paths":      paths,
+		"components": components,
+	}
+	if a != nil {
+		schemes := map[string]any{}
+		var security []map[string][]string
+		if len(a.tokens) > 0 {
+			schemes["bearerAuth"] = map[string]any{"type": "http", "scheme": "bearer"}
+			security = append(security, map[string][]string{"bearerAuth": {}})
+		}
+		if len(a.users) > 0 {
+			schemes["basicAuth"] = map[string]any{"type": "http", "scheme": "basic"}
+			security = append(security, map[string][]string{"basicAuth": {}})
+		}
+		components["securitySchemes"] = schemes
+		doc["security"] = security
+	}
+	return doc
+}
+
+// operation 生成一个接口的 Operation 对象。
+func (c schemas) operation(op operation, a *auth) map[string]any {
+	out := map[string]any{
+		"operationId": op.ID,
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+	}
+	if len(op.Params) > 0 {
+		params := make([]map[string]any, len(op.Params))
+		for i, p := range op.Params {
+			schema := map[string]any{"type": firstNonEmpty(p.Type, "string")}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			params[i] = map[string]any{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.Required || p.In == "path",
+				"schema":      schema,
+			}
+		}
+		out["parameters"] = params
+	}
+	if op.Body != nil {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": c.of(reflect.TypeOf(op.Body))}},
+		}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch ct := firstNonEmpty(op.ContentType, "application/json"); {
+	case ct == "application/json" && op.Response != nil:
+		ok["content"] = map[string]any{ct: map[string]any{"schema": c.of(reflect.TypeOf(op.Response))}}
+	case ct != "application/json":
+		ok["content"] = map[string]any{ct: map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+	out["responses"] = map[string]any{
+		strconv.Itoa(status): ok,
+		"default": map[string]any{
+			"description": "错误",
+			"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+		},
+	}
+	if a != nil && matchPath(a.public, op.Path) {
+		out["security"] = []any{}
+	}
+	return out
+}
+
+// schemas 由 Go 类型生成 JSON Schema，与 encoding/json 的编码规则一致；
+// 具名结构体放进 components.schemas，以 包名.类型名 引用。
+type schemas map[string]any
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (c schemas) of(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return c.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": c.of(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": c.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": c.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.object(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := c[name]; !ok {
+			// 先占位，递归引用自身的类型不会无限展开。
+			c[name] = map[string]any{}
+			c[name] = c.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// object 生成结构体的 schema。没有 omitempty 且不是指针的字段为必有字段。
+func (c schemas) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	c.fields(t, props, &required)
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// fields 收集 t 的 JSON 字段，匿名嵌入的结构体字段提升到外层。
+func (c schemas) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				c.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = c.of(ft)
+		if !strings.Contains(","+opts+",", ",omitempty,") && ft.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
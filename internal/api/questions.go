@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"wechat-view/internal/claims"
+	"wechat-view/internal/i18n"
+)
+
+// claimRequest 是 assign/resolve 接口的请求体。
+type claimRequest struct {
+	Assignee string `json:"assignee,omitempty"`
+	By       string `json:"by,omitempty"`
+	Note     string `json:"note,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Question string `json:"question,omitempty"`
+}
+
+var questionsDocs = []operation{{
+	ID: "listQuestions", Method: http.MethodGet, Path: "/api/v1/questions", Tag: "questions",
+	Summary: "列出未回复问题的认领状态",
+	Params:  []param{queryDateParam},
+	Response: struct {
+		Questions []claims.Claim `json:"questions"`
+	}{},
+}}
+
+var questionActionDocs = []operation{{
+	ID: "getQuestion", Method: http.MethodGet, Path: "/api/v1/questions/{id}", Tag: "questions",
+	Summary:  "返回一个问题的认领状态",
+	Params:   []param{questionIDParam},
+	Response: claims.Claim{},
+}, {
+	ID: "assignQuestion", Method: http.MethodPost, Path: "/api/v1/questions/{id}/assign", Tag: "questions",
+	Summary:  "认领问题，assignee 必填",
+	Params:   []param{questionIDParam},
+	Body:     claimRequest{},
+	Response: claims.Claim{},
+}, {
+	ID: "resolveQuestion", Method: http.MethodPost, Path: "/api/v1/questions/{id}/resolve", Tag: "questions",
+	Summary:  "标记问题已解决，by 缺省为认领人",
+	Params:   []param{questionIDParam},
+	Body:     claimRequest{},
+	Response: claims.Claim{},
+}}
+
+var questionIDParam = param{Name: "id", In: "path", Description: "问题 ID，见日报中的未回复问题"}
+
+// handleQuestions 列出问题认领状态，可用 ?date=YYYY-MM-DD 过滤。
+func (s *Server) handleQuestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	date := strings.TrimSpace(r.URL.Query().Get("date"))
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("日期格式非法: %w", err))
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{"questions": s.claims.List(date)})
+}
+
+// handleQuestionAction 处理 POST /api/v1/questions/{id}/assign 与 /resolve。
+func (s *Server) handleQuestionAction(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/questions/"), "/")
+	id, action, ok := strings.Cut(rest, "/")
+	if !ok {
+		if c, found := s.claims.Get(rest); found && r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, c)
+			return
+		}
+		writeError(w, http.StatusNotFound, errors.New(i18n.T("未找到该问题")))
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req claimRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("请求体不是合法 JSON: %w", err))
+		return
+	}
+	var (
+		c   claims.Claim
+		err error
+	)
+	switch action {
+	case "assign":
+		if strings.TrimSpace(req.Assignee) == "" {
+			writeError(w, http.StatusBadRequest, errors.New(i18n.T("缺少 assignee")))
+			return
+		}
+		c, err = s.claims.Assign(id, strings.TrimSpace(req.Assignee), req.Date, req.Question)
+	case "resolve":
+		c, err = s.claims.Resolve(id, strings.TrimSpace(req.By), req.Note)
+	default:
+		writeError(w, http.StatusNotFound, i18n.Errorf("未知操作 %q", action))
+		return
+	}
+	switch {
+	case errors.Is(err, claims.ErrInvalidID):
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("问题 id 非法")))
+	case errors.Is(err, claims.ErrLocked):
+		writeError(w, http.StatusServiceUnavailable, errors.New(i18n.T("认领状态正被其他进程更新，请稍后重试")))
+	case err != nil:
+		log.Printf("update claim %s failed: %v", id, err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("保存认领状态失败")))
+	default:
+		writeJSON(w, http.StatusOK, c)
+	}
+}
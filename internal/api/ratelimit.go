@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/i18n"
+)
+
+// RateLimitOptions 按客户端 IP 做令牌桶限流，防止个别客户端反复触发磁盘读取。
+type RateLimitOptions struct {
+	// Rate 为每秒补充的请求数。
+	Rate float64
+	// Burst 为桶容量，即允许的瞬时突发，默认取 Rate 的两倍（至少 1）。
+	Burst int
+	// TrustProxy 为 true 时取 X-Forwarded-For 中最左侧的地址，
+	// 仅在服务位于可信反向代理之后时开启，否则客户端可伪造 IP。
+	TrustProxy bool
+	// Exempt 列出不限流的路径，以 / 结尾的按前缀匹配；默认仅 /healthz。
+	Exempt []string
+}
+
+// limiterIdle 之后未再访问的客户端桶会被清理。
+const limiterIdle = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter 为每个客户端 IP 维护一个令牌桶。
+type limiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	trustProxy bool
+	exempt     []string
+	buckets    map[string]*bucket
+	swept      time.Time
+	now        func() time.Time
+}
+
+// EnableRateLimit 开启按 IP 限流，超限的请求返回 429 与 Retry-After。
+// 再次调用会替换现有配置，各客户端的额度重新计算。
+func (s *Server) EnableRateLimit(opts RateLimitOptions) error {
+	if opts.Rate <= 0 || math.IsInf(opts.Rate, 0) || math.IsNaN(opts.Rate) {
+		return errors.New("rate limit needs a positive rate")
+	}
+	burst := float64(opts.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(opts.Rate*2))
+	}
+	exempt := opts.Exempt
+	if exempt == nil {
+		exempt = []string{"/healthz"}
+	}
+	s.limiter.Store(&limiter{
+		rate:       opts.Rate,
+		burst:      burst,
+		trustProxy: opts.TrustProxy,
+		exempt:     exempt,
+		buckets:    map[string]*bucket{},
+		now:        time.Now,
+	})
+	return nil
+}
+
+// DisableRateLimit 关闭限流。
+func (s *Server) DisableRateLimit() {
+	s.limiter.Store(nil)
+}
+
+// allow 消耗 r 所属客户端的一个令牌；不足时返回需要等待的时长。
+func (l *limiter) allow(r *http.Request) (bool, time.Duration) {
+	if matchPath(l.exempt, r.URL.Path) {
+		return true, 0
+	}
+	key := clientIP(r, l.trustProxy)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > limiterIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > limiterIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *limiter) reject(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, errors.New(i18n.T("请求过于频繁，请稍后再试")))
+}
+
+// clientIP 返回用于限流的客户端地址。
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// matchPath 判断 path 是否在 paths 中，以 / 结尾的项按前缀匹配。
+func matchPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
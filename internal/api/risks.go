@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/risk"
+)
+
+// reviewRequest 是 confirm/false-positive 接口的请求体。
+type reviewRequest struct {
+	By   string `json:"by,omitempty"`
+	Note string `json:"note,omitempty"`
+	// Phrase 为误报时加入白名单的片段，需出现在原消息中；留空则整条消息加白。
+	Phrase string `json:"phrase,omitempty"`
+}
+
+var risksDocs = []operation{{
+	ID: "listRisks", Method: http.MethodGet, Path: "/api/v1/risks", Tag: "risks",
+	Summary: "风险消息复核队列；status 为 false_positive 时返回 reviews，否则返回 hits",
+	Params: []param{queryDateParam,
+		{Name: "status", In: "query", Description: "复核状态，默认 pending", Enum: []string{risk.StatusPending, risk.StatusConfirmed, risk.StatusFalsePositive}},
+	},
+	Response: struct {
+		Hits    []risk.Hit    `json:"hits,omitempty"`
+		Reviews []risk.Review `json:"reviews,omitempty"`
+	}{},
+}}
+
+var riskActionDocs = []operation{{
+	ID: "getRisk", Method: http.MethodGet, Path: "/api/v1/risks/{id}", Tag: "risks",
+	Summary: "返回一条风险消息", Params: []param{riskIDParam}, Response: risk.Hit{},
+}, {
+	ID: "confirmRisk", Method: http.MethodPost, Path: "/api/v1/risks/{id}/confirm", Tag: "risks",
+	Summary: "确认违规", Params: []param{riskIDParam}, Body: reviewRequest{}, Response: risk.Review{},
+}, {
+	ID: "dismissRisk", Method: http.MethodPost, Path: "/api/v1/risks/{id}/false-positive", Tag: "risks",
+	Summary: "标记误报，phrase（或整条消息）加入白名单", Params: []param{riskIDParam}, Body: reviewRequest{}, Response: risk.Review{},
+}}
+
+var riskIDParam = param{Name: "id", In: "path", Description: "风险消息 ID"}
+
+// EnableRiskReview 挂载风险消息复核接口，detector 为按配置编译的风险规则。
+// 再次调用只替换检测规则。
+func (s *Server) EnableRiskReview(detector *risk.Detector) error {
+	if detector == nil {
+		return errors.New("risk rules are required")
+	}
+	if s.reviews != nil {
+		s.risk.Store(detector)
+		return nil
+	}
+	store, err := risk.Open(filepath.Join(s.dataDir, "risk_reviews.json"))
+	if err != nil {
+		return fmt.Errorf("open risk reviews: %w", err)
+	}
+	s.risk.Store(detector)
+	s.reviews = store
+	s.route(s.handleRisks, risksDocs, "/api/v1/risks")
+	s.route(s.handleRiskAction, riskActionDocs, "/api/v1/risks/")
+	return nil
+}
+
+// RiskReviewEnabled 报告是否已挂载风险复核接口。
+func (s *Server) RiskReviewEnabled() bool {
+	return s.reviews != nil
+}
+
+// handleRisks 列出风险命中。?date=YYYY-MM-DD 指定日期（默认全部），
+// ?status=pending|confirmed|false_positive 过滤复核状态（默认 pending）。
+// 误报已进入白名单，不再被检测到，因此从复核记录中列出。
+func (s *Server) handleRisks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	date := strings.TrimSpace(q.Get("date"))
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("日期格式非法: %w", err))
+			return
+		}
+	}
+	status := strings.TrimSpace(q.Get("status"))
+	if status == "" {
+		status = risk.StatusPending
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	switch status {
+	case risk.StatusFalsePositive:
+		writeJSON(w, http.StatusOK, map[string]any{"reviews": s.reviews.List(date, status)})
+		return
+	case risk.StatusPending, risk.StatusConfirmed:
+	default:
+		writeError(w, http.StatusBadRequest, i18n.Errorf("未知状态 %q", status))
+		return
+	}
+	days := []string{date}
+	if date == "" {
+		var err error
+		if days, err = archive.ListDays(s.dataDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("list raw days failed: %v", err)
+			writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
+			return
+		}
+	}
+	hits := []risk.Hit{}
+	for _, day := range days {
+		dayHits, err := s.scanDay(day)
+		if errors.Is(err, os.ErrNotExist) && date == "" {
+			continue
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, i18n.Errorf("未找到 %s 的聊天记录", day))
+			return
+		}
+		if err != nil {
+			log.Printf("scan %s failed: %v", day, err)
+			writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
+			return
+		}
+		for _, h := range dayHits {
+			if h.Status == status {
+				hits = append(hits, h)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"hits": hits})
+}
+
+// handleRiskAction 处理 GET /api/v1/risks/{id} 与
+// POST /api/v1/risks/{id}/confirm、/false-positive。
+func (s *Server) handleRiskAction(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/risks/"), "/")
+	id, action, hasAction := strings.Cut(rest, "/")
+	day, ok := risk.DayOf(id)
+	if !ok {
+		writeError(w, http.StatusBadRequest, risk.ErrInvalidID)
+		return
+	}
+	hit, found, err := s.findHit(day, id)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("scan %s failed: %v", day, err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New(i18n.T("未找到该风险消息")))
+		return
+	}
+	if !hasAction {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, hit)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req reviewRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("请求体不是合法 JSON: %w", err))
+		return
+	}
+	var rv risk.Review
+	switch action {
+	case "confirm":
+		rv, err = s.reviews.Confirm(hit, strings.TrimSpace(req.By), req.Note)
+	case "false-positive":
+		if req.Phrase != "" && !strings.Contains(strings.ToLower(hit.Content), strings.ToLower(strings.TrimSpace(req.Phrase))) {
+			writeError(w, http.StatusBadRequest, errors.New(i18n.T("phrase 必须出现在原消息中")))
+			return
+		}
+		rv, err = s.reviews.Dismiss(hit, strings.TrimSpace(req.By), req.Note, req.Phrase)
+	default:
+		writeError(w, http.StatusNotFound, i18n.Errorf("未知操作 %q", action))
+		return
+	}
+	if err != nil {
+		log.Printf("review risk %s failed: %v", id, err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("保存复核结果失败")))
+		return
+	}
+	writeJSON(w, http.StatusOK, rv)
+}
+
+// scanDay 按当前规则与白名单检测当日原始消息。
+func (s *Server) scanDay(day string) ([]risk.Hit, error) {
+	raw, err := archive.LoadRaw(s.dataDir, day)
+	if err != nil {
+		return nil, err
+	}
+	return s.risk.Load().Scan(day, raw.Messages, s.reviews), nil
+}
+
+// findHit 在当日命中中查找 id。已判为误报的命中会被自身加入的白名单
+// 过滤，此时从复核记录还原，便于复核人改判。
+func (s *Server) findHit(day, id string) (risk.Hit, bool, error) {
+	hits, err := s.scanDay(day)
+	for _, h := range hits {
+		if h.ID == id {
+			return h, true, nil
+		}
+	}
+	if rv, ok := s.reviews.Get(id); ok {
+		return risk.Hit{ID: rv.ID, Date: rv.Date, Rule: rv.Rule, Content: rv.Content, Status: rv.Status, Review: &rv}, true, nil
+	}
+	return risk.Hit{}, false, err
+}
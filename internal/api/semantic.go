@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/vectors"
+)
+
+// 语义搜索结果条数的默认值与上限。
+const (
+	defaultSemanticLimit = 10
+	maxSemanticLimit     = 50
+)
+
+// Embedder 把查询语句转换为向量，需与建索引时使用同一个模型。
+type Embedder func(ctx context.Context, text string) ([]float64, error)
+
+// semantic 是语义搜索所需的向量索引与查询向量化函数。
+type semantic struct {
+	index *vectors.Index
+	embed Embedder
+	model string
+}
+
+// EnableSemanticSearch 挂载 GET /api/v1/semantic-search，在 dataDir/vectors
+// 下由 report 生成的向量索引中查找与查询语义最接近的消息。model 为索引使用的
+// 向量模型，其他模型生成的日期会被跳过；再次调用只替换向量化函数。
+func (s *Server) EnableSemanticSearch(embed Embedder, model string) error {
+	if embed == nil {
+		return errors.New("embedder is required")
+	}
+	first := s.semantic.Load() == nil
+	s.semantic.Store(&semantic{index: vectors.NewIndex(s.dataDir), embed: embed, model: model})
+	if first {
+		s.route(s.handleSemanticSearch, semanticDocs, "/api/v1/semantic-search")
+	}
+	return nil
+}
+
+var semanticDocs = []operation{{
+	ID: "semanticSearch", Method: http.MethodGet, Path: "/api/v1/semantic-search", Tag: "search",
+	Summary: "语义搜索：在向量索引中找出与查询语义最接近的消息",
+	Params: []param{
+		{Name: "q", In: "query", Description: "查询内容", Required: true},
+		{Name: "limit", In: "query", Description: "返回条数，上限 50", Type: "integer"},
+		fromParam, toParam,
+		{Name: "talker", In: "query", Description: "只搜索该群"},
+		{Name: "minScore", In: "query", Description: "最低相似度", Type: "number"},
+	},
+	Response: struct {
+		Query string        `json:"query"`
+		Hits  []vectors.Hit `json:"hits"`
+	}{},
+}}
+
+// handleSemanticSearch 处理 GET /api/v1/semantic-search?q=&limit=&from=&to=&talker=&minScore=。
+func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("q"))
+	if text == "" {
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("缺少查询内容 q")))
+		return
+	}
+	query := vectors.Query{From: strings.TrimSpace(q.Get("from")), To: strings.TrimSpace(q.Get("to")), Talker: strings.TrimSpace(q.Get("talker"))}
+	for _, d := range []string{query.From, query.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("日期格式非法: %w", err))
+			return
+		}
+	}
+	limit, err := positiveInt(q.Get("limit"), defaultSemanticLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("limit 非法: %w", err))
+		return
+	}
+	query.Limit = min(limit, maxSemanticLimit)
+	if v := strings.TrimSpace(q.Get("minScore")); v != "" {
+		if query.MinScore, err = strconv.ParseFloat(v, 64); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("minScore 非法: %w", err))
+			return
+		}
+	}
+
+	sem := s.semantic.Load()
+	query.Vector, err = sem.embed(r.Context(), text)
+	if err != nil {
+		log.Printf("embed semantic query failed: %v", err)
+		writeError(w, http.StatusBadGateway, errors.New(i18n.T("查询向量化失败")))
+		return
+	}
+	hits, err := sem.index.Search(query, sem.model)
+	if err != nil {
+		log.Printf("semantic search failed: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取向量索引失败")))
+		return
+	}
+	if hits == nil {
+		hits = []vectors.Hit{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{"query": text, "hits": hits})
+}
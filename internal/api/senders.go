@@ -0,0 +1,276 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/members"
+	"wechat-view/internal/summarize"
+)
+
+// 分页参数默认值与上限。
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// senderSorts 列出 /api/v1/senders 支持的排序字段。
+var senderSorts = map[string]func(a, b SenderStat) int{
+	"messages":   func(a, b SenderStat) int { return a.Messages - b.Messages },
+	"activeDays": func(a, b SenderStat) int { return a.ActiveDays - b.ActiveDays },
+	"answers":    func(a, b SenderStat) int { return a.Answers - b.Answers },
+	"firstSeen":  func(a, b SenderStat) int { return strings.Compare(a.FirstSeen, b.FirstSeen) },
+	"lastSeen":   func(a, b SenderStat) int { return strings.Compare(a.LastSeen, b.LastSeen) },
+	"name":       func(a, b SenderStat) int { return strings.Compare(a.Name, b.Name) },
+}
+
+// SenderStat 是一位发送者在查询区间内的活跃度。Answers 为其回答
+// 他人提问的次数（与日报"回复债"的判定一致）。
+type SenderStat struct {
+	Key        string `json:"key"`
+	Name       string `json:"name"`
+	Messages   int    `json:"messages"`
+	ActiveDays int    `json:"activeDays"`
+	Answers    int    `json:"answers"`
+	FirstSeen  string `json:"firstSeen"`
+	LastSeen   string `json:"lastSeen"`
+}
+
+// senderDay 是单日的发送者统计缓存，原始文件修改时间变化时失效。
+type senderDay struct {
+	modTime time.Time
+	members map[string]*members.Member
+	answers map[string]int
+}
+
+// senderCache 缓存逐日统计，避免每次请求都重新计算回复债。
+type senderCache struct {
+	mu   sync.Mutex
+	days map[string]senderDay
+}
+
+var sendersDocs = []operation{{
+	ID: "listSenders", Method: http.MethodGet, Path: "/api/v1/senders", Tag: "senders",
+	Summary: "成员分析：区间内每位发送者的消息数、活跃天数与答疑次数",
+	Params: []param{fromParam, toParam,
+		{Name: "sort", In: "query", Description: "排序字段，默认 messages", Enum: []string{"messages", "activeDays", "answers", "firstSeen", "lastSeen", "name"}},
+		{Name: "order", In: "query", Description: "排序方向，默认 desc", Enum: []string{"asc", "desc"}},
+		{Name: "page", In: "query", Description: "页码，从 1 开始", Type: "integer"},
+		{Name: "pageSize", In: "query", Description: "每页条数，默认 50，上限 500", Type: "integer"},
+	},
+	Response: struct {
+		From     string       `json:"from"`
+		To       string       `json:"to"`
+		Sort     string       `json:"sort"`
+		Order    string       `json:"order"`
+		Page     int          `json:"page"`
+		PageSize int          `json:"pageSize"`
+		Total    int          `json:"total"`
+		Senders  []SenderStat `json:"senders"`
+	}{},
+}}
+
+// handleSenders 处理 GET /api/v1/senders?from=&to=&sort=&order=&page=&pageSize=。
+func (s *Server) handleSenders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	from, to := strings.TrimSpace(q.Get("from")), strings.TrimSpace(q.Get("to"))
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("日期格式非法: %w", err))
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("from %s 晚于 to %s", from, to))
+		return
+	}
+	sortBy := firstNonEmpty(q.Get("sort"), "messages")
+	cmp, ok := senderSorts[sortBy]
+	if !ok {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("不支持按 %q 排序", sortBy))
+		return
+	}
+	order := firstNonEmpty(q.Get("order"), "desc")
+	if order != "asc" && order != "desc" {
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("order 只能为 asc 或 desc")))
+		return
+	}
+	page, err := positiveInt(q.Get("page"), 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("page 非法: %w", err))
+		return
+	}
+	pageSize, err := positiveInt(q.Get("pageSize"), defaultPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("pageSize 非法: %w", err))
+		return
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	stats, err := s.senderStats(from, to)
+	if err != nil {
+		log.Printf("collect sender stats failed: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
+		return
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		c := cmp(stats[i], stats[j])
+		if c == 0 {
+			return stats[i].Key < stats[j].Key
+		}
+		if order == "asc" {
+			return c < 0
+		}
+		return c > 0
+	})
+	total := len(stats)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from":     from,
+		"to":       to,
+		"sort":     sortBy,
+		"order":    order,
+		"page":     page,
+		"pageSize": pageSize,
+		"total":    total,
+		"senders":  stats[start:end],
+	})
+}
+
+// senderStats 汇总 [from, to] 内每位发送者的统计，端点为空表示不限。
+// 原始数据已被保留策略删除的日子按其 history 统计。
+func (s *Server) senderStats(from, to string) ([]SenderStat, error) {
+	days, err := archive.HistoryDays(s.dataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []SenderStat{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	agg := map[string]*SenderStat{}
+	for _, day := range days {
+		if (from != "" && day < from) || (to != "" && day > to) {
+			continue
+		}
+		sd, err := s.senderDay(day)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", day, err)
+		}
+		byName := map[string]*SenderStat{}
+		for key, m := range sd.members {
+			st := agg[key]
+			if st == nil {
+				st = &SenderStat{Key: key, FirstSeen: day}
+				agg[key] = st
+			}
+			st.Name = m.Name
+			st.Messages += m.Messages
+			st.ActiveDays++
+			st.LastSeen = day
+			byName[m.Name] = st
+		}
+		for name, n := range sd.answers {
+			if st := byName[name]; st != nil {
+				st.Answers += n
+			}
+		}
+	}
+	out := make([]SenderStat, 0, len(agg))
+	for _, st := range agg {
+		out = append(out, *st)
+	}
+	return out, nil
+}
+
+// senderDay 返回单日统计，必要时重新读取原始文件；原始文件已删除时
+// 读取保留策略留下的 history。
+func (s *Server) senderDay(day string) (senderDay, error) {
+	p, hasRaw := archive.FindRaw(s.dataDir, day)
+	if !hasRaw {
+		p = archive.HistoryPath(s.dataDir, day)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return senderDay{}, err
+	}
+	s.senders.mu.Lock()
+	cached, ok := s.senders.days[day]
+	s.senders.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached, nil
+	}
+	sd := senderDay{modTime: info.ModTime(), members: map[string]*members.Member{}, answers: map[string]int{}}
+	if !hasRaw {
+		h, err := archive.LoadHistory(s.dataDir, day)
+		if err != nil {
+			return senderDay{}, err
+		}
+		members.Add(sd.members, day, h.Messages)
+		for name, n := range h.Answers {
+			sd.answers[name] = n
+		}
+	} else {
+		raw, err := archive.LoadRaw(s.dataDir, day)
+		if err != nil {
+			return senderDay{}, err
+		}
+		members.Add(sd.members, day, raw.Messages)
+		for _, item := range summarize.BuildSummary(raw.Messages).ReplyDebt.Resolved {
+			if item.AnsweredBy != "" && item.AnsweredBy != item.Questioner {
+				sd.answers[item.AnsweredBy]++
+			}
+		}
+	}
+	s.senders.mu.Lock()
+	if s.senders.days == nil {
+		s.senders.days = map[string]senderDay{}
+	}
+	s.senders.days[day] = sd
+	s.senders.mu.Unlock()
+	return sd, nil
+}
+
+// positiveInt 解析正整数查询参数，空值返回 def。
+func positiveInt(v string, def int) (int, error) {
+	if strings.TrimSpace(v) == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New(i18n.T("必须大于 0"))
+	}
+	return n, nil
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if s := strings.TrimSpace(v); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,13 +10,45 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/claims"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/risk"
 )
 
 // Server 提供访问原始聊天记录的 RESTful API。
 type Server struct {
 	dataDir string
 	mux     *http.ServeMux
+	claims  *claims.Store
+	// risk 与 reviews 在 EnableRiskReview 之后可用。
+	risk    atomic.Pointer[risk.Detector]
+	reviews *risk.Store
+	senders senderCache
+	days    dayCache
+	// metrics 在 EnableMetrics 之后非空。
+	metrics *metrics
+	// auth、cors 与 limiter 分别由 EnableAuth、EnableCORS、EnableRateLimit
+	// 设置。用原子指针保存，以便重新加载配置时替换而不影响进行中的请求。
+	auth    atomic.Pointer[auth]
+	cors    atomic.Pointer[cors]
+	limiter atomic.Pointer[limiter]
+	// semantic 在 EnableSemanticSearch 之后非空，answer 在 EnableAssistant 之后非空。
+	semantic atomic.Pointer[semantic]
+	answer   atomic.Pointer[Answerer]
+	// live 在 EnableLive 之后非空，DisableLive 后置空但路由保留。
+	live     atomic.Pointer[live]
+	liveOnce sync.Once
+	// events 在 EnableEvents 之后非空。
+	events atomic.Pointer[events]
+	// siteDir 为 MountSite 托管的站点目录，未托管时为空。
+	siteDir string
+	// docs 为已注册接口的说明，见 openapi.go。
+	docs apiDocs
 }
 
 // NewServer 创建 API Server，dataDir 指向原始聊天记录目录。
@@ -27,25 +60,94 @@ func NewServer(dataDir string) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("resolve data dir: %w", err)
 	}
-	s := &Server{dataDir: absDir, mux: http.NewServeMux()}
+	store, err := claims.Open(filepath.Join(absDir, "claims.json"))
+	if err != nil {
+		return nil, fmt.Errorf("open claims: %w", err)
+	}
+	s := &Server{dataDir: absDir, mux: http.NewServeMux(), claims: store}
+	s.days.size = defaultDayCacheSize
 	s.registerRoutes()
 	return s, nil
 }
 
-// ServeHTTP 实现 http.Handler 接口。
+// ServeHTTP 实现 http.Handler 接口。客户端接受时 JSON 响应以 gzip 压缩，
+// 指标统计的是压缩后的字节数。
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.metrics == nil {
+		gw, done := withGzip(w, r)
+		defer done()
+		s.serve(gw, r)
+		return
+	}
+	_, route := s.mux.Handler(r)
+	rec := &statusRecorder{ResponseWriter: w}
+	start := time.Now()
+	gw, done := withGzip(rec, r)
+	s.serve(gw, r)
+	done()
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	s.metrics.observe(route, r.Method, rec.status, rec.bytes, time.Since(start))
+}
+
+// serve 依次处理跨域、限流与鉴权，再交给路由。预检请求不计入限流，
+// 限流放在鉴权之前，以便同时挡住暴力猜测凭据。
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if c := s.cors.Load(); c != nil && c.handle(w, r) {
+		return
+	}
+	if l := s.limiter.Load(); l != nil {
+		if ok, wait := l.allow(r); !ok {
+			l.reject(w, wait)
+			return
+		}
+	}
+	if a := s.auth.Load(); a != nil {
+		var ok bool
+		if r, ok = a.check(r); !ok {
+			a.challenge(w)
+			return
+		}
+	}
 	s.mux.ServeHTTP(w, r)
 }
 
 func (s *Server) registerRoutes() {
-	s.mux.HandleFunc("/api/v1/chatlogs", s.handleChatlog)
-	s.mux.HandleFunc("/api/v1/chatlogs/", s.handleChatlog)
-	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	s.route(s.handleChatlog, chatlogDocs, "/api/v1/chatlogs", "/api/v1/chatlogs/")
+	s.route(s.handleQuestions, questionsDocs, "/api/v1/questions")
+	s.route(s.handleQuestionAction, questionActionDocs, "/api/v1/questions/")
+	s.route(s.handleSenders, sendersDocs, "/api/v1/senders")
+	s.route(s.handleWidget, widgetDocs, "/api/v1/widget", "/api/v1/widget/")
+	s.route(s.handleLLMUsage, llmUsageDocs, "/api/v1/admin/llm-usage")
+	s.route(s.handleOpenAPI, openAPIDocs, "/api/v1/openapi.json")
+	s.route(func(w http.ResponseWriter, r *http.Request) {
 		resp := map[string]string{"status": "ok"}
 		writeJSON(w, http.StatusOK, resp)
-	})
+	}, healthzDocs, "/healthz")
 }
 
+var healthzDocs = []operation{{
+	ID: "healthz", Method: http.MethodGet, Path: "/healthz", Tag: "meta", Summary: "健康检查",
+	Response: struct {
+		Status string `json:"status"`
+	}{},
+}}
+
+var chatlogDocs = []operation{{
+	ID: "getChatlog", Method: http.MethodGet, Path: "/api/v1/chatlogs/{date}", Tag: "chatlogs",
+	Summary:  "返回某天的原始聊天记录",
+	Params:   []param{pathDateParam, chatlogTagParam},
+	Response: archive.Raw{},
+}, {
+	ID: "getChatlogByQuery", Method: http.MethodGet, Path: "/api/v1/chatlogs", Tag: "chatlogs",
+	Summary:  "同 getChatlog，以查询参数指定日期",
+	Params:   []param{{Name: "date", In: "query", Description: "日期，YYYY-MM-DD", Required: true}, chatlogTagParam},
+	Response: archive.Raw{},
+}}
+
+var chatlogTagParam = param{Name: "tag", In: "query", Description: "只返回带该标签的消息（配置中的 tags 规则）"}
+
 func (s *Server) handleChatlog(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w, http.MethodGet)
@@ -56,19 +158,29 @@ func (s *Server) handleChatlog(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	if err := s.streamChatlog(w, r, date); err != nil {
+	serve := s.streamChatlog
+	if tag := strings.TrimSpace(r.URL.Query().Get("tag")); tag != "" {
+		serve = func(w http.ResponseWriter, r *http.Request, date string) error {
+			return s.serveTagged(w, r, date, tag)
+		}
+	}
+	if err := serve(w, r, date); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			writeError(w, http.StatusNotFound, fmt.Errorf("未找到 %s 的聊天记录", date))
+			writeError(w, http.StatusNotFound, i18n.Errorf("未找到 %s 的聊天记录", date))
 			return
 		}
 		log.Printf("serve %s failed: %v", date, err)
-		writeError(w, http.StatusInternalServerError, errors.New("读取聊天记录失败"))
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
 		return
 	}
 }
 
 func (s *Server) extractDate(r *http.Request) (string, error) {
-	const prefix = "/api/v1/chatlogs"
+	return pathDate(r, "/api/v1/chatlogs")
+}
+
+// pathDate 从 prefix 之后的路径或 date 查询参数中取出 YYYY-MM-DD 日期。
+func pathDate(r *http.Request, prefix string) (string, error) {
 	path := strings.TrimPrefix(r.URL.Path, prefix)
 	path = strings.Trim(path, "/")
 	date := path
@@ -76,32 +188,72 @@ func (s *Server) extractDate(r *http.Request) (string, error) {
 		date = strings.TrimSpace(r.URL.Query().Get("date"))
 	}
 	if date == "" {
-		return "", errors.New("缺少日期，请提供 YYYY-MM-DD 格式的 date")
+		return "", errors.New(i18n.T("缺少日期，请提供 YYYY-MM-DD 格式的 date"))
 	}
 	if strings.Contains(date, "/") {
-		return "", errors.New("日期格式非法")
+		return "", errors.New(i18n.T("日期格式非法"))
 	}
 	if _, err := time.Parse("2006-01-02", date); err != nil {
-		return "", fmt.Errorf("日期格式非法: %w", err)
+		return "", i18n.Errorf("日期格式非法: %w", err)
 	}
 	return date, nil
 }
 
+// dayPath 返回当日原始数据文件，已压缩归档的为 .json.gz。
+func (s *Server) dayPath(date string) string {
+	p, _ := archive.FindRaw(s.dataDir, date)
+	return p
+}
+
+// streamChatlog 返回当日原始数据。ETag 为内容哈希，Last-Modified 为文件
+// 修改时间，轮询的看板可用 If-None-Match 或 If-Modified-Since 得到 304。
 func (s *Server) streamChatlog(w http.ResponseWriter, r *http.Request, date string) error {
-	filePath := filepath.Join(s.dataDir, fmt.Sprintf("%s.json", date))
-	f, err := os.Open(filePath)
+	day, err := s.loadDay(date)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", day.etag)
+	http.ServeContent(w, r, date+".json", day.modTime, bytes.NewReader(day.body))
+	return nil
+}
 
-	info, err := f.Stat()
+// serveTagged 返回仅包含指定标签消息的当日数据，其余字段原样保留。
+func (s *Server) serveTagged(w http.ResponseWriter, r *http.Request, date, tag string) error {
+	day, err := s.loadDay(date)
 	if err != nil {
 		return err
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-store")
-	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	w.Header().Set("Cache-Control", "no-cache")
+	if notModified(w, r, derivedETag(day.etag, "tag", tag), day.modTime) {
+		return nil
+	}
+	parsed, msgs, err := day.parsed()
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", date, err)
+	}
+	// parsed 为缓存共享，复制一份再替换 messages。
+	doc := make(map[string]json.RawMessage, len(parsed))
+	for k, v := range parsed {
+		doc[k] = v
+	}
+	filtered := make([]map[string]any, 0)
+	for _, m := range msgs {
+		tags, _ := m["tags"].([]any)
+		for _, t := range tags {
+			if name, _ := t.(string); name == tag {
+				filtered = append(filtered, m)
+				break
+			}
+		}
+	}
+	out, err := json.Marshal(filtered)
+	if err != nil {
+		return err
+	}
+	doc["messages"] = out
+	writeJSON(w, http.StatusOK, doc)
 	return nil
 }
 
@@ -122,5 +274,5 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 
 func methodNotAllowed(w http.ResponseWriter, allow string) {
 	w.Header().Set("Allow", allow)
-	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("仅支持 %s 请求", allow))
+	writeError(w, http.StatusMethodNotAllowed, i18n.Errorf("仅支持 %s 请求", allow))
 }
@@ -1,11 +1,41 @@
 package api
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/render"
+	"wechat-view/internal/risk"
+	"wechat-view/internal/tags"
+	"wechat-view/internal/usage"
+	"wechat-view/internal/vectors"
+	"wechat-view/internal/watermark"
 )
 
 func TestExtractDateFromPath(t *testing.T) {
@@ -65,6 +95,158 @@ func TestHandleChatlogSuccess(t *testing.T) {
 	}
 }
 
+func TestHandleChatlogGzip(t *testing.T) {
+	dir := t.TempDir()
+	day := `{"date":"2025-09-27","messages":[` + strings.Repeat(`{"content":"重复的消息内容"},`, 200) + `{}]}`
+	if err := os.WriteFile(filepath.Join(dir, "2025-09-27.json"), []byte(day), 0o644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	get := func(encoding, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/chatlogs/2025-09-27", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("br, gzip;q=0.8", "")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Content-Length") != "" || !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("应返回 gzip 压缩的响应: %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip 解析失败: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != day {
+		t.Fatalf("解压后内容不一致 (%v): %.80s", err, got)
+	}
+	if rec.Body.Len() >= len(day)/4 {
+		t.Fatalf("压缩效果异常: %d -> %d 字节", len(day), rec.Body.Len())
+	}
+
+	for _, c := range []struct{ encoding, rangeHeader string }{{"gzip;q=0", ""}, {"", ""}, {"gzip", "bytes=0-9"}} {
+		rec := get(c.encoding, c.rangeHeader)
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("Accept-Encoding=%q Range=%q 时不应压缩", c.encoding, c.rangeHeader)
+		}
+	}
+
+	// 长度未知的小响应缓冲后原样返回。
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Fatalf("小响应不应压缩: %v %s", rec.Header(), rec.Body.String())
+	}
+}
+
+func TestHandleChatlogETag(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "2025-09-28.json")
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	write(`{"date":"2025-09-28","messages":[{"content":"机房断电","tags":["故障"]},{"content":"午饭"}]}`)
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{"/api/v1/chatlogs/2025-09-28", "/api/v1/chatlogs/2025-09-28?tag=" + url.QueryEscape("故障")} {
+		first := get(target, nil)
+		etag := first.Header().Get("ETag")
+		if first.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+			t.Fatalf("%s: 应返回强 ETag，得到 %d %q", target, first.Code, etag)
+		}
+		if rec := get(target, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Fatalf("%s: If-None-Match 匹配时应返回 304，得到 %d", target, rec.Code)
+		}
+		if rec := get(target, http.Header{"If-Modified-Since": {first.Header().Get("Last-Modified")}}); rec.Code != http.StatusNotModified {
+			t.Fatalf("%s: If-Modified-Since 未变时应返回 304，得到 %d", target, rec.Code)
+		}
+	}
+	tagged := get("/api/v1/chatlogs/2025-09-28?tag="+url.QueryEscape("故障"), nil).Header().Get("ETag")
+	if other := get("/api/v1/chatlogs/2025-09-28?tag=x", nil).Header().Get("ETag"); other == tagged {
+		t.Fatal("不同标签的 ETag 不应相同")
+	}
+
+	// 文件更新后缓存失效，旧 ETag 不再匹配。
+	old := get("/api/v1/chatlogs/2025-09-28", nil).Header().Get("ETag")
+	write(`{"date":"2025-09-28","messages":[]}`)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("修改时间失败: %v", err)
+	}
+	rec := get("/api/v1/chatlogs/2025-09-28", http.Header{"If-None-Match": {old}})
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"date":"2025-09-28","messages":[]}` {
+		t.Fatalf("文件更新后应返回新内容，得到 %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 压缩归档后内容与 ETag 不变。
+	fresh := rec.Header().Get("ETag")
+	if _, err := archive.Compact(dir, "2025-09-28"); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	rec = get("/api/v1/chatlogs/2025-09-28", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"date":"2025-09-28","messages":[]}` || rec.Header().Get("ETag") != fresh {
+		t.Fatalf("压缩后应透明读取，得到 %d %s %q", rec.Code, rec.Body.String(), rec.Header().Get("ETag"))
+	}
+}
+
+func TestDayCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"2025-09-01", "2025-09-02", "2025-09-03"} {
+		if err := os.WriteFile(filepath.Join(dir, d+".json"), []byte(`{"date":"`+d+`"}`), 0o644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	srv.SetDayCacheSize(2)
+	load := func(d string) *dayFile {
+		f, err := srv.loadDay(d)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", d, err)
+		}
+		return f
+	}
+	first := load("2025-09-01")
+	load("2025-09-02")
+	if load("2025-09-01") != first {
+		t.Fatal("未变化的日文件应命中缓存")
+	}
+	load("2025-09-03") // 淘汰最久未用的 09-02
+	if _, ok := srv.days.days["2025-09-02"]; ok || len(srv.days.days) != 2 {
+		t.Fatalf("LRU 淘汰异常: %v", srv.days.days)
+	}
+	srv.SetDayCacheSize(-1)
+	if len(srv.days.days) != 0 || load("2025-09-01") == first {
+		t.Fatal("关闭缓存后不应再复用")
+	}
+}
+
 func TestHandleChatlogNotFound(t *testing.T) {
 	dir := t.TempDir()
 	srv, err := NewServer(dir)
@@ -80,3 +262,1147 @@ func TestHandleChatlogNotFound(t *testing.T) {
 		t.Fatalf("期望状态码 404，得到 %d", rec.Code)
 	}
 }
+
+func TestHandleChatlogFilterByTag(t *testing.T) {
+	dir := t.TempDir()
+	raw := `{"date":"2025-09-26","messages":[{"content":"服务挂了","tags":["故障"]},{"content":"早"},{"content":"加个导出","tags":["需求"]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "2025-09-26.json"), []byte(raw), 0o644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/chatlogs/2025-09-26?tag="+url.QueryEscape("故障"), nil)
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", rec.Code)
+	}
+	var got struct {
+		Date     string           `json:"date"`
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if got.Date != "2025-09-26" || len(got.Messages) != 1 || got.Messages[0]["content"] != "服务挂了" {
+		t.Fatalf("过滤结果不符: %s", rec.Body.String())
+	}
+}
+
+func TestMountSiteInjectsViewerWatermark(t *testing.T) {
+	site := t.TempDir()
+	page := "<p>要点" + watermark.Slot + "</p>"
+	if err := os.WriteFile(filepath.Join(site, "index.html"), []byte(page), 0o644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	srv, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if err := srv.MountSite(SiteOptions{Dir: site, Watermark: true, ViewerHeader: "X-Forwarded-User"}); err != nil {
+		t.Fatalf("挂载站点失败: %v", err)
+	}
+	viewer := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("期望 200，得到 %d", rec.Code)
+		}
+		got := watermark.Decode(rec.Body.String())
+		if len(got) != 1 {
+			t.Fatalf("水印解析结果异常: %q", got)
+		}
+		return watermark.ParseMark(got[0]).Viewer
+	}
+	if v := viewer(""); v != "alice" {
+		t.Fatalf("未开启鉴权时应取配置的请求头，得到 %q", v)
+	}
+
+	// 开启鉴权后以令牌身份为准，伪造的请求头不起作用。
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"s3cret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := viewer("s3cret"); !strings.HasPrefix(v, "token-") || len(v) != len("token-")+8 {
+		t.Fatalf("查看者应为令牌摘要，得到 %q", v)
+	}
+}
+
+func TestMountSiteUsesManifestETag(t *testing.T) {
+	site := t.TempDir()
+	if err := os.WriteFile(filepath.Join(site, "index.html"), []byte("<p>首页</p>"), 0o644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := render.UpdateManifest(site, t.TempDir(), "test"); err != nil {
+		t.Fatalf("生成清单失败: %v", err)
+	}
+	srv, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if err := srv.MountSite(SiteOptions{Dir: site}); err != nil {
+		t.Fatalf("挂载站点失败: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" {
+		t.Fatalf("期望 200 且带 ETag，得到 %d %q", rec.Code, tag)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", tag)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("期望 304，得到 %d", rec.Code)
+	}
+
+	// 清单生成后被改写的文件不能再用清单中的哈希。
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(site, "index.html"), []byte("<p>新首页</p>"), 0o644); err != nil {
+		t.Fatalf("改写测试文件失败: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(site, "index.html"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "新首页") || rec.Header().Get("ETag") == tag {
+		t.Fatalf("改写后期望 200 与新 ETag，得到 %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestQuestionAssignAndResolve(t *testing.T) {
+	dir := t.TempDir()
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post("/api/v1/questions/0123456789ab/assign", `{"assignee":"alice","date":"2025-10-16","question":"怎么部署？"}`); rec.Code != http.StatusOK {
+		t.Fatalf("认领期望 200，得到 %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/api/v1/questions/0123456789ab/resolve", `{"note":"见文档"}`); rec.Code != http.StatusOK {
+		t.Fatalf("解决期望 200，得到 %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/api/v1/questions/bad-id/assign", `{"assignee":"bob"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "问题 id 非法") {
+		t.Fatalf("非法 id 期望 400，得到 %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions?date=2025-10-16", nil))
+	var resp struct {
+		Questions []map[string]string `json:"questions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(resp.Questions) != 1 || resp.Questions[0]["status"] != "resolved" || resp.Questions[0]["resolvedBy"] != "alice" {
+		t.Fatalf("认领状态异常: %+v", resp.Questions)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "claims.json")); err != nil {
+		t.Fatalf("未持久化认领状态: %v", err)
+	}
+}
+
+func TestQuestionConcurrentAssignAcrossServers(t *testing.T) {
+	dir := t.TempDir()
+	// 两个服务实例共用同一数据目录，模拟多进程同时写 claims.json。
+	var servers [2]*Server
+	for i := range servers {
+		srv, err := NewServer(dir)
+		if err != nil {
+			t.Fatalf("创建服务失败: %v", err)
+		}
+		servers[i] = srv
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"assignee":"user%d","date":"2025-10-16"}`, i)
+			rec := httptest.NewRecorder()
+			servers[i%2].ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/questions/%012x/assign", i), strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Errorf("认领期望 200，得到 %d: %s", rec.Code, rec.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, srv := range servers {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/questions?date=2025-10-16", nil))
+		var resp struct {
+			Questions []map[string]string `json:"questions"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if len(resp.Questions) != 20 {
+			t.Fatalf("服务 %d 期望 20 条认领，得到 %d", i, len(resp.Questions))
+		}
+	}
+}
+
+func TestRiskReviewFeedsWhitelist(t *testing.T) {
+	dir := t.TempDir()
+	raw := `{"date":"2025-10-16","messages":[
+		{"sender":"a","senderName":"阿强","time":"2025-10-16T09:00:00+08:00","content":"这个杀毒软件还行"},
+		{"sender":"b","senderName":"小美","time":"2025-10-16T09:01:00+08:00","content":"加我V信私聊返利"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(raw), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	detector, err := risk.Compile([]tags.Rule{{Name: "违规", Patterns: []string{"杀", "返利"}}}, nil)
+	if err != nil {
+		t.Fatalf("编译规则失败: %v", err)
+	}
+	if err := srv.EnableRiskReview(detector); err != nil {
+		t.Fatalf("开启复核失败: %v", err)
+	}
+	list := func(query string) []risk.Hit {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/risks"+query, nil))
+		var resp struct {
+			Hits []risk.Hit `json:"hits"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v %s", err, rec.Body)
+		}
+		return resp.Hits
+	}
+	post := func(path, body string) int {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	hits := list("?date=2025-10-16")
+	if len(hits) != 2 {
+		t.Fatalf("期望 2 条待复核，得到 %+v", hits)
+	}
+	if code := post("/api/v1/risks/"+hits[0].ID+"/false-positive", `{"by":"alice","phrase":"不存在"}`); code != http.StatusBadRequest {
+		t.Fatalf("白名单片段不在原文中期望 400，得到 %d", code)
+	}
+	if code := post("/api/v1/risks/"+hits[0].ID+"/false-positive", `{"by":"alice","phrase":"杀毒"}`); code != http.StatusOK {
+		t.Fatalf("误报期望 200，得到 %d", code)
+	}
+	if code := post("/api/v1/risks/"+hits[1].ID+"/confirm", `{"by":"alice"}`); code != http.StatusOK {
+		t.Fatalf("确认期望 200，得到 %d", code)
+	}
+	if pending := list(""); len(pending) != 0 {
+		t.Fatalf("复核后不应再有待复核: %+v", pending)
+	}
+	if confirmed := list("?status=confirmed"); len(confirmed) != 1 || confirmed[0].Review.ReviewedBy != "alice" {
+		t.Fatalf("确认结果不对: %+v", confirmed)
+	}
+
+	// 白名单对后续检测生效
+	store, err := risk.Open(filepath.Join(dir, "risk_reviews.json"))
+	if err != nil {
+		t.Fatalf("读取复核记录失败: %v", err)
+	}
+	later := detector.Scan("2025-10-17", []chatlog.Message{{Sender: "c", Content: "推荐个杀毒工具"}}, store)
+	if len(later) != 0 {
+		t.Fatalf("白名单未生效: %+v", later)
+	}
+}
+
+func TestHandleSendersSortAndPage(t *testing.T) {
+	dir := t.TempDir()
+	days := map[string]string{
+		"2025-10-15": `{"date":"2025-10-15","messages":[
+			{"sender":"a","senderName":"阿强","time":"2025-10-15T09:00:00+08:00","content":"早"},
+			{"sender":"b","senderName":"小美","time":"2025-10-15T09:01:00+08:00","content":"早上好"}]}`,
+		"2025-10-16": `{"date":"2025-10-16","messages":[
+			{"sender":"a","senderName":"阿强","time":"2025-10-16T09:00:00+08:00","content":"服务怎么部署？","isQuestion":true},
+			{"sender":"c","senderName":"老王","time":"2025-10-16T09:02:00+08:00","content":"@阿强 用 docker compose up 就行","mentions":["阿强"]},
+			{"sender":"a","senderName":"阿强","time":"2025-10-16T09:03:00+08:00","content":"好的谢谢"}]}`,
+	}
+	for day, raw := range days {
+		if err := os.WriteFile(filepath.Join(dir, day+".json"), []byte(raw), 0o644); err != nil {
+			t.Fatalf("写入测试数据失败: %v", err)
+		}
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	type page struct {
+		Total   int          `json:"total"`
+		Senders []SenderStat `json:"senders"`
+	}
+	get := func(query string) (int, page) {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/senders"+query, nil))
+		var resp page
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	_, all := get("")
+	if all.Total != 3 || all.Senders[0].Key != "a" {
+		t.Fatalf("默认应按消息数倒序: %+v", all)
+	}
+	if a := all.Senders[0]; a.Messages != 3 || a.ActiveDays != 2 || a.FirstSeen != "2025-10-15" || a.LastSeen != "2025-10-16" {
+		t.Fatalf("阿强的统计不对: %+v", a)
+	}
+	_, top := get("?sort=answers&pageSize=1")
+	if len(top.Senders) != 1 || top.Senders[0].Key != "c" || top.Senders[0].Answers != 1 {
+		t.Fatalf("答疑排序不对: %+v", top)
+	}
+	_, second := get("?sort=name&order=asc&page=2&pageSize=2")
+	if second.Total != 3 || len(second.Senders) != 1 {
+		t.Fatalf("分页不对: %+v", second)
+	}
+	_, ranged := get("?from=2025-10-16&to=2025-10-16")
+	if ranged.Total != 2 {
+		t.Fatalf("日期区间未生效: %+v", ranged)
+	}
+	for _, q := range []string{"?from=20251016", "?sort=bogus", "?page=0", "?from=2025-10-16&to=2025-10-15"} {
+		if code, _ := get(q); code != http.StatusBadRequest {
+			t.Fatalf("%s 期望 400，得到 %d", q, code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/senders?from=2025-10-16&to=2025-10-15", nil))
+	if !strings.Contains(rec.Body.String(), "from 2025-10-16 晚于 to 2025-10-15") {
+		t.Fatalf("起止颠倒的错误信息不对: %s", rec.Body)
+	}
+
+	// 保留策略删除原始数据后按 history 统计，结果不变
+	raw, err := archive.LoadRaw(dir, "2025-10-16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.SaveHistory(dir, "2025-10-16", archive.NewHistory(raw, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.RemoveRaw(dir, "2025-10-16"); err != nil {
+		t.Fatal(err)
+	}
+	if srv, err = NewServer(dir); err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if _, kept := get(""); !reflect.DeepEqual(kept, all) {
+		t.Fatalf("删除原始数据后统计变了: %+v，之前 %+v", kept, all)
+	}
+}
+
+func TestWidgetServesDayCard(t *testing.T) {
+	dir := t.TempDir()
+	raw := `{"date":"2025-10-16","talker":"产品群","messages":[
+		{"sender":"a","senderName":"阿强","time":"2025-10-16T09:00:00+08:00","content":"发布计划今天定下来吗"},
+		{"sender":"b","senderName":"小美","time":"2025-10-16T09:01:00+08:00","content":"发布计划下午评审"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(raw), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/widget/2025-10-16")
+	var card render.Widget
+	if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+		t.Fatalf("解析响应失败: %v (%s)", err, rec.Body.String())
+	}
+	if card.Date != "2025-10-16" || card.Talker != "产品群" || card.Messages != 2 || card.Senders != 2 || card.URL != "" {
+		t.Fatalf("卡片内容不对: %+v", card)
+	}
+	if latest := get("/api/v1/widget/latest"); !strings.Contains(latest.Body.String(), `"date":"2025-10-16"`) {
+		t.Fatalf("latest 应返回最近一天: %s", latest.Body.String())
+	}
+	html := get("/api/v1/widget?date=2025-10-16&format=html")
+	if ct := html.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(html.Body.String(), "产品群") {
+		t.Fatalf("HTML 卡片异常: %s %s", ct, html.Body.String())
+	}
+	for target, want := range map[string]int{
+		"/api/v1/widget/2025-10-17":            http.StatusNotFound,
+		"/api/v1/widget/20251016":              http.StatusBadRequest,
+		"/api/v1/widget/2025-10-16?format=xml": http.StatusBadRequest,
+	} {
+		if code := get(target).Code; code != want {
+			t.Fatalf("%s 期望 %d，得到 %d", target, want, code)
+		}
+	}
+
+	// 托管站点后优先读取 meta.json，带上 AI 标题与日报链接。
+	site := t.TempDir()
+	dayDir := archive.DayDir(site, "2025-10-16")
+	if err := os.MkdirAll(dayDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	meta := `{"date":"2025-10-16","talker":"产品群","summary":{"totalMessages":40,"uniqueSenders":6},"aiHeadline":{"title":"发布计划定了","tweet":""}}`
+	if err := os.WriteFile(filepath.Join(dayDir, "meta.json"), []byte(meta), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.MountSite(SiteOptions{Dir: site}); err != nil {
+		t.Fatalf("托管站点失败: %v", err)
+	}
+	card = render.Widget{}
+	if err := json.Unmarshal(get("/api/v1/widget/2025-10-16").Body.Bytes(), &card); err != nil {
+		t.Fatal(err)
+	}
+	if card.Messages != 40 || card.Headline != "发布计划定了" || card.URL != "/2025/10/16/index.html" {
+		t.Fatalf("应使用 meta.json: %+v", card)
+	}
+}
+
+func TestOpenAPIDescribesMountedRoutes(t *testing.T) {
+	srv, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	type spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas         map[string]map[string]any `json:"schemas"`
+			SecuritySchemes map[string]any            `json:"securitySchemes"`
+		} `json:"components"`
+		Security []map[string]any `json:"security"`
+	}
+	get := func(header string) (spec, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("期望 200，得到 %d: %s", rec.Code, rec.Body)
+		}
+		var doc spec
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("解析文档失败: %v", err)
+		}
+		return doc, rec.Body.String()
+	}
+
+	doc, body := get("")
+	if doc.OpenAPI != "3.0.3" || doc.Paths["/api/v1/chatlogs/{date}"]["get"] == nil || doc.Paths["/api/v1/senders"]["get"] == nil {
+		t.Fatalf("缺少内置接口: %v", doc.Paths)
+	}
+	if _, ok := doc.Paths["/api/v1/risks"]; ok {
+		t.Fatal("未开启的风险复核不应出现在文档中")
+	}
+	// 每个引用都能解析，operationId 不重复。
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(body, -1) {
+		if doc.Components.Schemas[ref[1]] == nil {
+			t.Fatalf("引用 %s 未定义", ref[1])
+		}
+	}
+	ids := map[string]bool{}
+	for p, item := range doc.Paths {
+		for method, op := range item {
+			id, _ := op["operationId"].(string)
+			if id == "" || ids[id] {
+				t.Fatalf("%s %s 的 operationId 为空或重复: %q", method, p, id)
+			}
+			ids[id] = true
+		}
+	}
+	widget := doc.Components.Schemas["render.Widget"]["properties"].(map[string]any)
+	if widget["vibeScore"].(map[string]any)["type"] != "integer" || widget["headline"] == nil {
+		t.Fatalf("卡片 schema 不对: %v", widget)
+	}
+	if req := doc.Components.Schemas["api.SenderStat"]["required"]; !strings.Contains(fmt.Sprint(req), "activeDays") {
+		t.Fatalf("成员统计的必有字段不对: %v", req)
+	}
+
+	detector, err := risk.Compile([]tags.Rule{{Name: "违规", Patterns: []string{"返利"}}}, nil)
+	if err != nil {
+		t.Fatalf("编译规则失败: %v", err)
+	}
+	if err := srv.EnableRiskReview(detector); err != nil {
+		t.Fatalf("开启复核失败: %v", err)
+	}
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"secret"}}); err != nil {
+		t.Fatalf("开启鉴权失败: %v", err)
+	}
+	doc, _ = get("Bearer secret")
+	confirm := doc.Paths["/api/v1/risks/{id}/confirm"]["post"]
+	if confirm == nil || confirm["requestBody"] == nil {
+		t.Fatalf("开启后应描述风险复核接口: %v", doc.Paths["/api/v1/risks/{id}/confirm"])
+	}
+	if doc.Components.SecuritySchemes["bearerAuth"] == nil || len(doc.Security) != 1 {
+		t.Fatalf("应声明 Bearer 鉴权: %+v", doc.Components.SecuritySchemes)
+	}
+	if sec, ok := doc.Paths["/healthz"]["get"]["security"].([]any); !ok || len(sec) != 0 {
+		t.Fatalf("公开路径应无需鉴权: %v", doc.Paths["/healthz"]["get"])
+	}
+}
+
+func TestSemanticSearchRanksAcrossDays(t *testing.T) {
+	dir := t.TempDir()
+	save := func(day, talker, model string, entries ...vectors.Entry) {
+		if err := vectors.Save(dir, day, vectors.Day{Talker: talker, Model: model, Entries: entries}); err != nil {
+			t.Fatalf("写入向量索引失败: %v", err)
+		}
+	}
+	save("2025-10-15", "group", "m",
+		vectors.Entry{Sender: "阿强", Text: "nginx 超时怎么排查", Vector: []float32{1, 0.1}},
+		vectors.Entry{Sender: "小美", Text: "周末去爬山", Vector: []float32{0, 1}})
+	save("2025-10-16", "group", "m", vectors.Entry{Sender: "老王", Text: "网关 504 了", Vector: []float32{0.9, 0.3}})
+	save("2025-10-17", "group", "other", vectors.Entry{Text: "别的模型", Vector: []float32{1, 0}})
+
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/semantic-search"+query, nil))
+		return rec
+	}
+	if rec := get("?q=x"); rec.Code != http.StatusNotFound {
+		t.Fatalf("未开启时期望 404，得到 %d", rec.Code)
+	}
+	var asked string
+	embed := func(_ context.Context, text string) ([]float64, error) {
+		asked = text
+		return []float64{1, 0}, nil
+	}
+	if err := srv.EnableSemanticSearch(embed, "m"); err != nil {
+		t.Fatalf("开启语义搜索失败: %v", err)
+	}
+
+	rec := get("?q=" + url.QueryEscape("我们之前讨论过超时吗") + "&limit=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望 200，得到 %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Hits []vectors.Hit `json:"hits"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if asked != "我们之前讨论过超时吗" || len(resp.Hits) != 2 || resp.Hits[0].Sender != "阿强" || resp.Hits[1].Date != "2025-10-16" {
+		t.Fatalf("结果不对（查询 %q）: %+v", asked, resp.Hits)
+	}
+	rec = get("?q=x&from=2025-10-16&minScore=0.5")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Hits) != 1 || resp.Hits[0].Sender != "老王" {
+		t.Fatalf("日期与相似度过滤未生效: %s", rec.Body.String())
+	}
+	for _, q := range []string{"", "?q=x&limit=0", "?q=x&to=bad", "?q=x&minScore=abc"} {
+		if rec := get(q); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%q 期望 400，得到 %d", q, rec.Code)
+		}
+	}
+}
+
+func TestAskStreamsAnswerWithSources(t *testing.T) {
+	dir := t.TempDir()
+	if err := vectors.Save(dir, "2025-10-16", vectors.Day{Talker: "group", Model: "m", Entries: []vectors.Entry{
+		{Sender: "老王", Text: "网关超时调到 60 秒就好了", Vector: []float32{1, 0}},
+	}}); err != nil {
+		t.Fatalf("写入向量索引失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	answer := func(_ context.Context, q string, sources []vectors.Hit, delta func(string)) (string, error) {
+		if delta != nil {
+			delta("调到 60 秒")
+			delta(" [1]")
+		}
+		return "调到 60 秒 [1]", nil
+	}
+	if err := srv.EnableAssistant(answer); err == nil {
+		t.Fatal("未开启语义搜索时应当报错")
+	}
+	embed := func(context.Context, string) ([]float64, error) { return []float64{1, 0}, nil }
+	if err := srv.EnableSemanticSearch(embed, "m"); err != nil {
+		t.Fatalf("开启语义搜索失败: %v", err)
+	}
+	if err := srv.EnableAssistant(answer); err != nil {
+		t.Fatalf("开启问答助手失败: %v", err)
+	}
+	post := func(body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/ask", strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"question":"超时怎么处理"}`, "text/event-stream")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("期望 SSE 响应，得到 %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"event: sources\ndata: [{\"date\":\"2025-10-16\"", "event: delta\ndata: {\"text\":\"调到 60 秒\"}", "event: done"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("缺少 %q:\n%s", want, body)
+		}
+	}
+
+	rec = post(`{"question":"超时怎么处理"}`, "application/json")
+	var resp struct {
+		Answer  string        `json:"answer"`
+		Sources []vectors.Hit `json:"sources"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Answer != "调到 60 秒 [1]" || len(resp.Sources) != 1 {
+		t.Fatalf("JSON 响应不对: %s", rec.Body.String())
+	}
+	// 检索不到消息时不调用模型。
+	rec = post(`{"question":"x","from":"2030-01-01"}`, "application/json")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Answer != noSourcesAnswer {
+		t.Fatalf("无结果时应直接回复: %s", rec.Body.String())
+	}
+	if rec := post(`{"question":" "}`, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("空问题期望 400，得到 %d", rec.Code)
+	}
+}
+
+func TestLLMUsageSummarizesLedger(t *testing.T) {
+	dir := t.TempDir()
+	ledger := `{"currency":"USD","days":{
+		"2025-09-30":{"gpt":{"requests":1,"promptTokens":1000,"completionTokens":100,"cost":0.5}},
+		"2025-10-01":{"gpt":{"requests":2,"promptTokens":3000,"completionTokens":300,"cost":1.5},"embed":{"requests":4,"promptTokens":400,"completionTokens":0,"cost":0}},
+		"2025-10-02":{"gpt":{"requests":1,"promptTokens":500,"completionTokens":50,"cost":0.25}}}}`
+	if err := os.WriteFile(filepath.Join(dir, usage.FileName), []byte(ledger), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/llm-usage?month=2025-10", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望 200，得到 %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Currency string         `json:"currency"`
+		Month    usage.Period   `json:"month"`
+		Days     []usage.Period `json:"days"`
+		Months   []usage.Period `json:"months"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Currency != "USD" || resp.Month.Requests != 7 || resp.Month.Cost != 1.75 || resp.Month.Models["embed"].PromptTokens != 400 {
+		t.Fatalf("月度汇总异常: %+v", resp)
+	}
+	if len(resp.Days) != 2 || resp.Days[0].Period != "2025-10-01" || len(resp.Months) != 2 || resp.Months[0].Cost != 0.5 {
+		t.Fatalf("逐日或逐月明细异常: %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/llm-usage?month=2025-13", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("非法月份期望 400，得到 %d", rec.Code)
+	}
+}
+
+func TestMetricsCountsRequestsAndArchive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(`{"date":"2025-10-16","messages":[]}`), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	srv.EnableMetrics()
+	for _, path := range []string{"/api/v1/chatlogs/2025-10-16", "/api/v1/chatlogs/2025-10-17", "/healthz"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("期望文本格式指标，得到 %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`wechat_view_http_requests_total{route="/api/v1/chatlogs/",method="GET",code="200"} 1`,
+		`wechat_view_http_requests_total{route="/api/v1/chatlogs/",method="GET",code="404"} 1`,
+		`wechat_view_http_request_duration_seconds_count{route="/healthz"} 1`,
+		`wechat_view_http_response_bytes_total{route="/api/v1/chatlogs/"}`,
+		"wechat_view_archive_days 1\n",
+		"wechat_view_archive_latest_day_timestamp_seconds ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("指标缺少 %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestAuthRequiresTokenOrBasicAuth(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(`{"date":"2025-10-16","messages":[]}`), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if err := srv.EnableAuth(AuthOptions{}); err == nil {
+		t.Fatal("没有凭据时应拒绝开启鉴权")
+	}
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"s3cret"}, Users: map[string]string{"alice": "pw"}}); err != nil {
+		t.Fatalf("开启鉴权失败: %v", err)
+	}
+	get := func(path string, set func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if set != nil {
+			set(req)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/chatlogs/2025-10-16", nil)
+	if rec.Code != http.StatusUnauthorized || len(rec.Header().Values("WWW-Authenticate")) != 2 {
+		t.Fatalf("未带凭据期望 401 与两种质询，得到 %d %v", rec.Code, rec.Header().Values("WWW-Authenticate"))
+	}
+	cases := []struct {
+		name string
+		set  func(r *http.Request)
+		want int
+	}{
+		{"正确令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"错误令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"正确账号", func(r *http.Request) { r.SetBasicAuth("alice", "pw") }, http.StatusOK},
+		{"错误密码", func(r *http.Request) { r.SetBasicAuth("alice", "bad") }, http.StatusUnauthorized},
+		{"未知账号", func(r *http.Request) { r.SetBasicAuth("mallory", "pw") }, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		if rec := get("/api/v1/chatlogs/2025-10-16", c.set); rec.Code != c.want {
+			t.Fatalf("%s 期望 %d，得到 %d", c.name, c.want, rec.Code)
+		}
+	}
+	if rec := get("/healthz", nil); rec.Code != http.StatusOK {
+		t.Fatalf("/healthz 应免鉴权，得到 %d", rec.Code)
+	}
+}
+
+func TestCORSAndRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(`{"date":"2025-10-16","messages":[]}`), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if err := srv.EnableCORS(CORSOptions{Origins: []string{"https://dash.example.com"}}); err != nil {
+		t.Fatalf("开启跨域失败: %v", err)
+	}
+	if err := srv.EnableRateLimit(RateLimitOptions{Rate: 1, Burst: 2}); err != nil {
+		t.Fatalf("开启限流失败: %v", err)
+	}
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"s3cret"}}); err != nil {
+		t.Fatalf("开启鉴权失败: %v", err)
+	}
+	now := time.Date(2025, 10, 16, 9, 0, 0, 0, time.UTC)
+	srv.limiter.Load().now = func() time.Time { return now }
+	do := func(method, origin, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/chatlogs/2025-10-16", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		} else {
+			req.Header.Set("Authorization", "Bearer s3cret")
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodOptions, "https://dash.example.com", "10.0.0.1:1234")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" ||
+		!strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Fatalf("预检应免鉴权并放行，得到 %d %v", rec.Code, rec.Header())
+	}
+	if rec := do(http.MethodGet, "https://evil.example.com", "10.0.0.2:1234"); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("未列出的来源不应放行: %v", rec.Header())
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := do(http.MethodGet, "https://dash.example.com", "10.0.0.1:1234")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("第 %d 次请求应在突发额度内，得到 %d", i+1, rec.Code)
+		}
+		// 跨域页面要读到缓存校验头才能发条件请求
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "Retry-After, ETag, Last-Modified" {
+			t.Fatalf("Access-Control-Expose-Headers = %q", got)
+		}
+	}
+	rec = do(http.MethodGet, "https://dash.example.com", "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("超出额度应返回 429 与 Retry-After，得到 %d %v", rec.Code, rec.Header())
+	}
+	if rec := do(http.MethodGet, "", "10.0.0.3:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("其他 IP 不应受影响，得到 %d", rec.Code)
+	}
+	now = now.Add(time.Second)
+	if rec := do(http.MethodGet, "", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("补充令牌后应放行，得到 %d", rec.Code)
+	}
+}
+
+func TestCertReloaderPicksUpRenewal(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert := func(serial int64, mod time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("生成私钥失败: %v", err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			NotBefore:    mod.Add(-time.Hour),
+			NotAfter:     mod.Add(24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("生成证书失败: %v", err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("编码私钥失败: %v", err)
+		}
+		if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+			t.Fatalf("写入证书失败: %v", err)
+		}
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+			t.Fatalf("写入私钥失败: %v", err)
+		}
+		if err := os.Chtimes(certFile, mod, mod); err != nil {
+			t.Fatalf("修改时间失败: %v", err)
+		}
+	}
+	serial := func(c *tls.Certificate) int64 {
+		leaf, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatalf("解析证书失败: %v", err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+
+	start := time.Date(2025, 10, 16, 9, 0, 0, 0, time.UTC)
+	writeCert(1, start)
+	certs, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("加载证书失败: %v", err)
+	}
+	now := start
+	certs.now = func() time.Time { return now }
+	if c, _ := certs.GetCertificate(nil); serial(c) != 1 {
+		t.Fatalf("期望初始证书 1，得到 %d", serial(c))
+	}
+
+	writeCert(2, start.Add(time.Hour))
+	now = now.Add(2 * time.Minute)
+	if c, _ := certs.GetCertificate(nil); serial(c) != 2 {
+		t.Fatalf("续期后应重新加载，得到 %d", serial(c))
+	}
+
+	if err := os.WriteFile(keyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatalf("写入私钥失败: %v", err)
+	}
+	if err := os.Chtimes(certFile, start.Add(2*time.Hour), start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("修改时间失败: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if c, _ := certs.GetCertificate(nil); serial(c) != 2 {
+		t.Fatalf("加载失败时应保留旧证书，得到 %d", serial(c))
+	}
+	if _, err := NewCertReloader(certFile, keyFile); err == nil {
+		t.Fatal("私钥损坏时应返回错误")
+	}
+}
+
+func TestReEnableReplacesAccessControls(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2025-10-16.json"), []byte(`{"date":"2025-10-16","messages":[]}`), 0o644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+	srv, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/chatlogs/2025-10-16", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"old"}}); err != nil {
+		t.Fatalf("开启鉴权失败: %v", err)
+	}
+	if err := srv.EnableAuth(AuthOptions{Tokens: []string{"new"}}); err != nil {
+		t.Fatalf("替换鉴权失败: %v", err)
+	}
+	if get("old") != http.StatusUnauthorized || get("new") != http.StatusOK {
+		t.Fatal("重新开启鉴权后应只接受新令牌")
+	}
+	if err := srv.EnableAuth(AuthOptions{Users: map[string]string{"alice": ""}}); err == nil {
+		t.Fatal("无效配置应返回错误")
+	}
+	if get("new") != http.StatusOK {
+		t.Fatal("无效配置不应替换现有凭据")
+	}
+	srv.DisableAuth()
+	if get("") != http.StatusOK {
+		t.Fatal("关闭鉴权后应直接放行")
+	}
+}
+
+func TestLiveStreamsNewMessages(t *testing.T) {
+	srv, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	var (
+		mu   sync.Mutex
+		msgs []chatlog.Message
+	)
+	add := func(id, text string) {
+		mu.Lock()
+		msgs = append(msgs, chatlog.Message{MsgID: id, Sender: "wxid_a", Content: text})
+		mu.Unlock()
+	}
+	add("1", "早")
+	add("2", "上线了吗")
+	add("3", "上线了")
+	err = srv.EnableLive(LiveOptions{
+		Fetch: func(_ context.Context, day, talker string) ([]chatlog.Message, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]chatlog.Message(nil), msgs...), nil
+		},
+		Talkers:  []string{"group@chatroom"},
+		Interval: 20 * time.Millisecond,
+		Filter: func(in []chatlog.Message) []chatlog.Message {
+			out := append([]chatlog.Message(nil), in...)
+			for i := range out {
+				out[i].SenderName = "用户A"
+			}
+			return out
+		},
+	})
+	if err != nil {
+		t.Fatalf("开启实时消息失败: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	open := func(query, lastID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/live"+query, nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	// next 读取下一条 message 事件，返回 id 与消息。
+	next := func(br *bufio.Reader) (string, chatlog.Message) {
+		var id string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("读取事件失败: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			if v, ok := strings.CutPrefix(line, "id: "); ok {
+				id = v
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok && id != "" {
+				var m chatlog.Message
+				if err := json.Unmarshal([]byte(v), &m); err != nil {
+					t.Fatalf("消息不是 JSON: %s", v)
+				}
+				return id, m
+			}
+		}
+	}
+
+	resp, br := open("?backlog=2", "")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("期望 SSE 响应，得到 %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{"2", "3"} {
+		if id, m := next(br); id != want || m.SenderName != "用户A" {
+			t.Fatalf("补发消息期望 %s（已化名），得到 %s %+v", want, id, m)
+		}
+	}
+	add("4", "回滚了")
+	if id, m := next(br); id != "4" || m.Content != "回滚了" {
+		t.Fatalf("新消息期望 4，得到 %s %+v", id, m)
+	}
+	resp.Body.Close()
+
+	// 断线重连时从 Last-Event-ID 之后补发。
+	resp, br = open("?talker=group@chatroom", "3")
+	if id, _ := next(br); id != "4" {
+		t.Fatalf("重连期望补发 4，得到 %s", id)
+	}
+	resp.Body.Close()
+
+	if resp, _ := open("?talker=other@chatroom", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("未允许的群期望 403，得到 %d", resp.StatusCode)
+	}
+	if resp, _ := open("?backlog=x", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("非法 backlog 期望 400，得到 %d", resp.StatusCode)
+	}
+	srv.DisableLive()
+	if resp, _ := open("", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("关闭后期望 404，得到 %d", resp.StatusCode)
+	}
+}
+
+func TestEventsPushRegeneratedDays(t *testing.T) {
+	site, data := t.TempDir(), t.TempDir()
+	writeSite := func(files map[string]string) {
+		for name, body := range files {
+			p := filepath.Join(site, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := render.UpdateManifest(site, data, "test"); err != nil {
+			t.Fatalf("写入清单失败: %v", err)
+		}
+	}
+	writeSite(map[string]string{"index.html": "home", "2025/10/16/index.html": "day", "2025/10/16/meta.json": `{"total":1}`})
+
+	srv, err := NewServer(data)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	if err := srv.EnableEvents(EventOptions{SiteDir: site, Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("开启事件推送失败: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	if resp, err := http.Get(ts.URL + "/api/v1/events"); err != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("普通 GET 期望 426，得到 %v %v", resp, err)
+	}
+	dial := func(origin string) (net.Conn, *bufio.Reader, string) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+		if err != nil {
+			t.Fatalf("连接失败: %v", err)
+		}
+		fmt.Fprintf(conn, "GET /api/v1/events HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nOrigin: %s\r\n\r\n",
+			strings.TrimPrefix(ts.URL, "http://"), origin)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("读取握手响应失败: %v", err)
+		}
+		return conn, br, resp.Status + " " + resp.Header.Get("Sec-WebSocket-Accept")
+	}
+	// readFrame 读取一个服务端帧（不带掩码），返回操作码与内容。
+	readFrame := func(conn net.Conn, br *bufio.Reader) (byte, []byte) {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		h := make([]byte, 2)
+		if _, err := io.ReadFull(br, h); err != nil {
+			t.Fatalf("读取帧失败: %v", err)
+		}
+		n := int(h[1] & 0x7F)
+		if n == 126 {
+			b := make([]byte, 2)
+			io.ReadFull(br, b)
+			n = int(b[0])<<8 | int(b[1])
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			t.Fatalf("读取帧内容失败: %v", err)
+		}
+		return h[0] & 0x0F, payload
+	}
+	readEvent := func(conn net.Conn, br *bufio.Reader) Event {
+		op, b := readFrame(conn, br)
+		var ev Event
+		if op != wsText || json.Unmarshal(b, &ev) != nil {
+			t.Fatalf("期望事件文本帧，得到 %d %s", op, b)
+		}
+		return ev
+	}
+
+	if _, _, status := dial("https://evil.example.com"); !strings.HasPrefix(status, "403") {
+		t.Fatalf("跨站连接期望 403，得到 %s", status)
+	}
+	conn, br, status := dial(ts.URL)
+	defer conn.Close()
+	if status != "101 Switching Protocols s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("握手响应不对: %s", status)
+	}
+	if ev := readEvent(conn, br); ev.Type != "hello" || ev.GeneratedAt == "" {
+		t.Fatalf("期望 hello 事件，得到 %+v", ev)
+	}
+
+	// 客户端 ping（带掩码）应得到 pong。
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | wsPing, 0x80 | 2}, mask...)
+	frame = append(frame, 'h'^mask[0], 'i'^mask[1])
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	if op, b := readFrame(conn, br); op != wsPong || string(b) != "hi" {
+		t.Fatalf("期望 pong hi，得到 %d %q", op, b)
+	}
+
+	writeSite(map[string]string{"2025/10/16/meta.json": `{"total":2}`, "2025/10/17/index.html": "day 2", "index.html": "home 2"})
+	// 文件系统时间精度较粗时，确保清单的修改时间有变化。
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(site, render.ManifestName), later, later); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Event{
+		{Type: "day", Date: "2025-10-16", URL: "2025/10/16/"},
+		{Type: "day", Date: "2025-10-17", URL: "2025/10/17/"},
+		{Type: "site", Files: 3},
+	} {
+		ev := readEvent(conn, br)
+		ev.GeneratedAt = ""
+		if ev != want {
+			t.Fatalf("期望 %+v，得到 %+v", want, ev)
+		}
+	}
+}
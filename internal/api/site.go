@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/render"
+	"wechat-view/internal/watermark"
+)
+
+// SiteOptions 配置静态站点托管（serve 模式）。
+type SiteOptions struct {
+	Dir string
+	// Watermark 为真时，在返回的 HTML 中注入查看者水印。
+	Watermark bool
+	// 查看者标识优先取鉴权身份（Basic Auth 用户名或令牌摘要），未鉴权的请求
+	// 取 ViewerHeader 指定的请求头，再缺失时使用客户端 IP。ViewerHeader
+	// 可被客户端伪造，只应在前置代理会覆盖该请求头时配置；默认不读取。
+	ViewerHeader string
+}
+
+// MountSite 在 / 下托管生成的静态站点，API 路由优先匹配。
+func (s *Server) MountSite(opts SiteOptions) error {
+	if strings.TrimSpace(opts.Dir) == "" {
+		return errors.New("site dir is required")
+	}
+	absDir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("resolve site dir: %w", err)
+	}
+	opts.Dir = absDir
+	s.siteDir = absDir
+	files := http.FileServer(http.Dir(absDir))
+	manifest := &manifestCache{dir: absDir}
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !opts.Watermark {
+			// FileServer 会根据 ETag 处理 If-None-Match，内容未变时返回 304
+			if tag := manifest.etag(r.URL.Path); tag != "" {
+				w.Header().Set("ETag", tag)
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			files.ServeHTTP(w, r)
+			return
+		}
+		serveWatermarked(w, r, opts, files)
+	})
+	return nil
+}
+
+// serveWatermarked 为 HTML 页面填充查看者水印，其余文件交给 files 处理。
+func serveWatermarked(w http.ResponseWriter, r *http.Request, opts SiteOptions, files http.Handler) {
+	name := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	if !strings.HasSuffix(name, ".html") {
+		files.ServeHTTP(w, r)
+		return
+	}
+	b, err := os.ReadFile(filepath.Join(opts.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		// 目录跳转、404 等情况沿用 FileServer 的处理
+		files.ServeHTTP(w, r)
+		return
+	}
+	mark := watermark.Mark{Viewer: viewerID(r, opts.ViewerHeader), Time: time.Now()}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, _ = w.Write(watermark.Fill(b, mark))
+}
+
+// manifestCache 读取站点的 build-manifest.json，文件变化后自动重新加载。
+type manifestCache struct {
+	dir     string
+	mu      sync.Mutex
+	modTime time.Time
+	files   map[string]render.FileEntry
+}
+
+// etag 返回请求路径对应文件的 ETag，文件不存在时返回空串。清单生成后
+// 未再改动的文件使用清单中的内容哈希，重新生成也不变；清单之后被改写
+// 或不在清单中的文件由其大小与修改时间生成，避免对新内容返回 304。
+func (c *manifestCache) etag(urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" || strings.HasSuffix(urlPath, "/") {
+		name = path.Join(name, "index.html")
+	}
+	file, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(name)))
+	if err != nil || file.IsDir() {
+		return ""
+	}
+	fallback := fmt.Sprintf(`"%x-%x"`, file.Size(), file.ModTime().UnixNano())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(filepath.Join(c.dir, render.ManifestName))
+	if err != nil {
+		c.files = nil
+		return fallback
+	}
+	if !info.ModTime().Equal(c.modTime) {
+		m, err := render.LoadManifest(c.dir)
+		if err != nil {
+			return fallback
+		}
+		c.files, c.modTime = m.Files, info.ModTime()
+	}
+	entry, ok := c.files[name]
+	if !ok || len(entry.SHA256) < 16 || entry.Size != file.Size() || file.ModTime().After(c.modTime) {
+		return fallback
+	}
+	return `"` + entry.SHA256[:16] + `"`
+}
+
+func viewerID(r *http.Request, header string) string {
+	if user := authUser(r); user != "" {
+		return user
+	}
+	if header != "" {
+		if v := strings.TrimSpace(r.Header.Get(header)); v != "" {
+			return v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader 从 PEM 文件加载 TLS 证书，文件修改后在下一次握手时自动重新加载，
+// 这样 certbot 等工具续期证书后无需重启服务。自动向 Let's Encrypt 申请证书
+// 见 internal/acme。
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+	now     func() time.Time
+}
+
+// certCheckInterval 是两次检查证书文件修改时间的最小间隔。
+const certCheckInterval = time.Minute
+
+// NewCertReloader 立即加载一次证书，文件缺失或不匹配时返回错误。
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CertReloader) load() error {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("tls cert: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls key pair: %w", err)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return nil
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate。重新加载失败时继续使用旧证书。
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := c.now(); now.Sub(c.checked) >= certCheckInterval {
+		c.checked = now
+		if info, err := os.Stat(c.certFile); err == nil && !info.ModTime().Equal(c.modTime) {
+			prev, prevMod := c.cert, c.modTime
+			if err := c.load(); err != nil {
+				c.cert, c.modTime = prev, prevMod
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// TLSConfig 返回使用该证书的服务端配置，最低 TLS 1.2。
+// 交给 http.Server 后会自动协商 HTTP/2。
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/usage"
+)
+
+var llmUsageDocs = []operation{{
+	ID: "getLLMUsage", Method: http.MethodGet, Path: "/api/v1/admin/llm-usage", Tag: "admin",
+	Summary: "LLM 用量与费用估算：某月合计、逐日明细与各月合计",
+	Params:  []param{{Name: "month", In: "query", Description: "月份，YYYY-MM，默认本月"}},
+	Response: struct {
+		Currency string         `json:"currency"`
+		Month    usage.Period   `json:"month"`
+		Days     []usage.Period `json:"days"`
+		Months   []usage.Period `json:"months"`
+	}{},
+}}
+
+// handleLLMUsage 返回 data/llm-usage.json 中的 LLM 用量与费用估算：
+// ?month=YYYY-MM 指定月份（默认本月），返回该月合计与逐日明细，以及各月合计。
+// 用量含 token 数与成本，部署到公网时应开启鉴权。
+func (s *Server) handleLLMUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	month := strings.TrimSpace(r.URL.Query().Get("month"))
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	} else if _, err := time.Parse("2006-01", month); err != nil {
+		writeError(w, http.StatusBadRequest, i18n.Errorf("月份格式非法，应为 YYYY-MM: %w", err))
+		return
+	}
+	ledger, err := usage.Load(filepath.Join(s.dataDir, usage.FileName))
+	if err != nil {
+		log.Printf("read llm usage failed: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取 LLM 用量失败")))
+		return
+	}
+	days := ledger.DaysOf(month + "-")
+	if days == nil {
+		days = []usage.Period{}
+	}
+	months := ledger.Months()
+	if months == nil {
+		months = []usage.Period{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"currency": ledger.Currency,
+		"month":    ledger.Month(month),
+		"days":     days,
+		"months":   months,
+	})
+}
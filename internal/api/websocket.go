@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/i18n"
+)
+
+// WebSocket 操作码（RFC 6455）。
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// wsMaxFrame 是接受的客户端帧上限；事件通道只需要控制帧。
+const wsMaxFrame = 4 << 10
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsConn 是只实现服务端推送所需部分的 WebSocket 连接：发送文本帧，
+// 应答 ping 与 close，不支持分片和扩展。
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+// upgradeWebSocket 完成握手并接管连接。跨站请求只接受同源或 allowOrigin
+// 放行的来源，避免其他网站借用登录状态读取事件。
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, allowOrigin func(string) bool) (*wsConn, error) {
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		writeError(w, http.StatusUpgradeRequired, errors.New(i18n.T("需要 WebSocket 连接")))
+		return nil, errors.New("not a websocket request")
+	}
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("不支持的 WebSocket 版本")))
+		return nil, errors.New("bad websocket handshake")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) && (allowOrigin == nil || !allowOrigin(origin)) {
+		writeError(w, http.StatusForbidden, i18n.Errorf("不允许来自 %s 的连接", origin))
+		return nil, errors.New("websocket origin not allowed")
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("无法建立 WebSocket 连接")))
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	_ = conn.SetDeadline(time.Time{})
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+// WriteText 发送一个文本帧，timeout 内写不完视为连接已断开。
+func (c *wsConn) WriteText(b []byte, timeout time.Duration) error {
+	return c.writeFrame(wsText, b, timeout)
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readLoop 读取客户端帧直到连接关闭：应答 ping 与 close，忽略数据帧。
+func (c *wsConn) readLoop() error {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			return err
+		}
+		op, masked := h[0]&0x0F, h[1]&0x80 != 0
+		n := uint64(h[1] & 0x7F)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		if !masked || n > wsMaxFrame {
+			// 客户端帧必须带掩码（RFC 6455 5.1）。
+			_ = c.writeFrame(wsClose, []byte{0x03, 0xEA}, time.Second)
+			return errors.New("invalid websocket frame")
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return err
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload, 5*time.Second); err != nil {
+				return err
+			}
+		case wsClose:
+			_ = c.writeFrame(wsClose, payload[:min(len(payload), 2)], time.Second)
+			return io.EOF
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+// headerHas 判断逗号分隔的请求头中是否含有 token（不区分大小写）。
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/render"
+	"wechat-view/internal/summarize"
+)
+
+var widgetDocs = []operation{{
+	ID: "getWidget", Method: http.MethodGet, Path: "/api/v1/widget/{date}", Tag: "summaries",
+	Summary: "某天的摘要卡片：消息数、发言人数、群氛围与热门话题",
+	Params: []param{
+		{Name: "date", In: "path", Description: "日期，YYYY-MM-DD，或 latest 表示最近一天"},
+		widgetFormatParam,
+	},
+	Response: render.Widget{},
+}, {
+	ID: "getWidgetByQuery", Method: http.MethodGet, Path: "/api/v1/widget", Tag: "summaries",
+	Summary: "同 getWidget，以查询参数指定日期",
+	Params: []param{
+		{Name: "date", In: "query", Description: "日期，YYYY-MM-DD，或 latest 表示最近一天", Required: true},
+		widgetFormatParam,
+	},
+	Response: render.Widget{},
+}}
+
+var widgetFormatParam = param{Name: "format", In: "query", Description: "json（默认）或 html（可 iframe 嵌入的卡片）", Enum: []string{"json", "html"}}
+
+// handleWidget 处理 GET /api/v1/widget/{date}：返回当天的摘要卡片（消息数、
+// 发言人数、群氛围与热门话题），默认为 JSON，format=html 时返回可直接
+// iframe 嵌入的 widget.html。date 可写作 latest，表示最近一天。
+func (s *Server) handleWidget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	format := firstNonEmpty(r.URL.Query().Get("format"), "json")
+	if format != "json" && format != "html" {
+		writeError(w, http.StatusBadRequest, errors.New(i18n.T("format 只能为 json 或 html")))
+		return
+	}
+	var date string
+	if firstNonEmpty(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/widget"), "/"), r.URL.Query().Get("date")) == "latest" {
+		days, err := archive.ReportDays(s.dataDir, s.siteDir)
+		if err != nil || len(days) == 0 {
+			writeError(w, http.StatusNotFound, errors.New(i18n.T("暂无聊天记录")))
+			return
+		}
+		date = days[len(days)-1]
+	} else {
+		var err error
+		if date, err = pathDate(r, "/api/v1/widget"); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	card, err := s.widget(date)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, i18n.Errorf("未找到 %s 的聊天记录", date))
+			return
+		}
+		log.Printf("build widget %s failed: %v", date, err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("读取聊天记录失败")))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	if format == "json" {
+		writeJSON(w, http.StatusOK, card)
+		return
+	}
+	var buf bytes.Buffer
+	if err := render.RenderWidget(&buf, card); err != nil {
+		log.Printf("render widget %s failed: %v", date, err)
+		writeError(w, http.StatusInternalServerError, errors.New(i18n.T("生成摘要卡片失败")))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// widget 生成 date 的摘要卡片。托管站点时优先读取日报的 meta.json，
+// 带上 AI 标题与日报链接；否则由原始数据现算。
+func (s *Server) widget(date string) (render.Widget, error) {
+	if s.siteDir != "" {
+		if meta, err := archive.LoadMeta(s.siteDir, date); err == nil {
+			card := render.NewWidget(date, meta.Talker, meta.Summary)
+			card.URL = "/" + archive.DayURL(date)
+			if meta.AIHeadline != nil {
+				card.Headline = meta.AIHeadline.Title
+			}
+			return card, nil
+		}
+	}
+	raw, err := archive.LoadRaw(s.dataDir, date)
+	if err != nil {
+		return render.Widget{}, err
+	}
+	return render.NewWidget(date, raw.Talker, summarize.BuildSummary(raw.Messages)), nil
+}
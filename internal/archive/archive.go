@@ -0,0 +1,258 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+)
+
+// Raw mirrors data/YYYY-MM-DD.json as written by cmd/report.
+type Raw struct {
+	Date     string            `json:"date"`
+	Talker   string            `json:"talker"`
+	Keyword  string            `json:"keyword"`
+	Meta     map[string]any    `json:"meta"`
+	Messages []chatlog.Message `json:"messages"`
+	// DataVersion is absent in files written before versioning.
+	DataVersion *DataVersion `json:"dataVersion,omitempty"`
+}
+
+// DayMeta mirrors site/YYYY/MM/DD/meta.json.
+type DayMeta struct {
+	Date        string               `json:"date"`
+	Talker      string               `json:"talker"`
+	Keyword     string               `json:"keyword"`
+	Summary     summarize.Summary    `json:"summary"`
+	AIInsights  *insight.Result      `json:"aiInsights,omitempty"`
+	AIVariants  []insight.Variant    `json:"aiVariants,omitempty"`
+	AIHeadline  *insight.Headline    `json:"aiHeadline,omitempty"`
+	AIGuard     *insight.GuardReport `json:"aiGuard,omitempty"`
+	DataVersion *DataVersion         `json:"dataVersion,omitempty"`
+}
+
+// ListDays returns the YYYY-MM-DD days with raw files in dataDir, plain or
+// compacted, oldest first.
+func ListDays(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), GzipSuffix)
+		if len(name) == 15 && name[4] == '-' && name[7] == '-' && name[10:] == ".json" && !seen[name[:10]] {
+			seen[name[:10]] = true
+			days = append(days, name[:10])
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// RawPath returns the raw file path for day.
+func RawPath(dataDir, day string) string {
+	return filepath.Join(dataDir, day+".json")
+}
+
+// LoadRaw reads the raw file for day, plain or compacted.
+func LoadRaw(dataDir, day string) (Raw, error) {
+	p, _ := FindRaw(dataDir, day)
+	b, err := ReadRawFile(p)
+	if err != nil {
+		return Raw{}, err
+	}
+	var raw Raw
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return Raw{}, err
+	}
+	return raw, nil
+}
+
+// DayDir returns site/YYYY/MM/DD for day.
+func DayDir(siteDir, day string) string {
+	if len(day) != 10 {
+		return filepath.Join(siteDir, day)
+	}
+	return filepath.Join(siteDir, day[:4], day[5:7], day[8:10])
+}
+
+// DayURL returns the day page path relative to the site root.
+func DayURL(day string) string {
+	if len(day) != 10 {
+		return day
+	}
+	return day[:4] + "/" + day[5:7] + "/" + day[8:10] + "/index.html"
+}
+
+// LoadMeta reads the rendered meta.json for day.
+func LoadMeta(siteDir, day string) (DayMeta, error) {
+	var meta DayMeta
+	if err := readJSON(filepath.Join(DayDir(siteDir, day), "meta.json"), &meta); err != nil {
+		return DayMeta{}, err
+	}
+	return meta, nil
+}
+
+// Window returns the n calendar days ending at last (inclusive), oldest first.
+func Window(last string, n int) ([]string, error) {
+	end, err := time.Parse("2006-01-02", last)
+	if err != nil {
+		return nil, fmt.Errorf("invalid day %q: %w", last, err)
+	}
+	out := make([]string, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		out = append(out, end.AddDate(0, 0, -i).Format("2006-01-02"))
+	}
+	return out, nil
+}
+
+func readJSON(p string, v any) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// DataVersion tracks how a day's raw messages changed across refetches, so
+// pages can tell readers when recalls or backfills altered the record.
+type DataVersion struct {
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	// FetchedAt is when the current message set was first fetched.
+	FetchedAt string `json:"fetchedAt"`
+	// RefreshedAt is the last refetch, whether or not anything changed.
+	RefreshedAt string `json:"refreshedAt"`
+	Added       int    `json:"added,omitempty"`
+	Removed     int    `json:"removed,omitempty"`
+	// Edited counts messages kept under the same identity whose text
+	// changed.
+	Edited int `json:"edited,omitempty"`
+}
+
+// Changes describes the message counts that changed in short phrases for
+// the page notice, in the report language.
+func (v DataVersion) Changes() []string {
+	var out []string
+	if v.Added > 0 {
+		out = append(out, i18n.Tf("新增 %v 条", v.Added))
+	}
+	if v.Edited > 0 {
+		out = append(out, i18n.Tf("修改 %v 条", v.Edited))
+	}
+	if v.Removed > 0 {
+		out = append(out, i18n.Tf("移除 %v 条", v.Removed))
+	}
+	return out
+}
+
+// Fingerprint hashes the identity and text of msgs. Derived fields such as
+// tags are ignored so re-tagging does not bump the version.
+func Fingerprint(msgs []chatlog.Message) string {
+	h := sha256.New()
+	for _, m := range msgs {
+		fmt.Fprintf(h, "%s\n", contentKey(m))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// NextVersion compares a refetched message set with the stored one. prev may
+// be nil for raw files written before versioning, and old is nil on the first
+// fetch. changed reports whether the message set differs from old.
+func NextVersion(prev *DataVersion, old, fresh []chatlog.Message, now time.Time) (DataVersion, bool) {
+	stamp := now.Format(time.RFC3339)
+	next := DataVersion{Version: 1, Hash: Fingerprint(fresh), FetchedAt: stamp, RefreshedAt: stamp}
+	if old == nil {
+		return next, false
+	}
+	base := DataVersion{Version: 1, Hash: Fingerprint(old), FetchedAt: stamp}
+	if prev != nil {
+		base = *prev
+	}
+	if base.Hash == next.Hash {
+		base.RefreshedAt = stamp
+		return base, false
+	}
+	next.Version = base.Version + 1
+	next.Added, next.Removed, next.Edited = diffMessages(old, fresh)
+	return next, true
+}
+
+// diffMessages counts the changes between two message sets with the same
+// key as Fingerprint, so a changed hash always shows up in the counts.
+// Unmatched messages that share an identity are counted as edited rather
+// than as one removed and one added.
+func diffMessages(old, fresh []chatlog.Message) (added, removed, edited int) {
+	count := make(map[string]int, len(old))
+	for _, m := range old {
+		count[contentKey(m)]++
+	}
+	var unmatched []chatlog.Message
+	for _, m := range fresh {
+		k := contentKey(m)
+		if count[k] > 0 {
+			count[k]--
+			continue
+		}
+		unmatched = append(unmatched, m)
+	}
+	left := make(map[string]int)
+	for _, m := range old {
+		if k := contentKey(m); count[k] > 0 {
+			count[k]--
+			left[messageKey(m)]++
+		}
+	}
+	for _, m := range unmatched {
+		if k := messageKey(m); left[k] > 0 {
+			left[k]--
+			edited++
+			continue
+		}
+		added++
+	}
+	for _, n := range left {
+		removed += n
+	}
+	return added, removed, edited
+}
+
+// contentKey is the identity and text of m.
+func contentKey(m chatlog.Message) string {
+	return messageKey(m) + "\x00" + m.Content + "\x00" + m.Text
+}
+
+func messageKey(m chatlog.Message) string {
+	if id := firstSet(m.MsgID, m.ID); id != "" {
+		return id
+	}
+	ts := m.Timestamp
+	if ts == 0 {
+		ts = m.CreateTime
+	}
+	return fmt.Sprintf("%s@%d", firstSet(m.Sender, m.From, m.SenderName), ts)
+}
+
+func firstSet(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+)
+
+func TestNextVersion(t *testing.T) {
+	now := time.Date(2025, 10, 16, 8, 0, 0, 0, time.UTC)
+	a := chatlog.Message{MsgID: "1", Content: "早"}
+	b := chatlog.Message{MsgID: "2", Content: "收到"}
+	c := chatlog.Message{MsgID: "3", Content: "补录"}
+
+	first, changed := NextVersion(nil, nil, []chatlog.Message{a, b}, now)
+	if changed || first.Version != 1 {
+		t.Fatalf("first fetch = %+v changed=%v", first, changed)
+	}
+
+	tagged := b
+	tagged.Tags = []string{"通知"}
+	same, changed := NextVersion(&first, []chatlog.Message{a, b}, []chatlog.Message{a, tagged}, now.Add(time.Hour))
+	if changed || same.Version != 1 || same.RefreshedAt == first.RefreshedAt {
+		t.Fatalf("unchanged refetch = %+v changed=%v", same, changed)
+	}
+
+	next, changed := NextVersion(&same, []chatlog.Message{a, b}, []chatlog.Message{a, c}, now.Add(2*time.Hour))
+	if !changed || next.Version != 2 || next.Added != 1 || next.Removed != 1 {
+		t.Fatalf("changed refetch = %+v changed=%v", next, changed)
+	}
+
+	edited := c
+	edited.Text = "补录（已编辑）"
+	third, changed := NextVersion(&next, []chatlog.Message{a, c}, []chatlog.Message{a, edited}, now.Add(3*time.Hour))
+	if !changed || third.Version != 3 || third.Edited != 1 || third.Added != 0 || third.Removed != 0 {
+		t.Fatalf("edited refetch = %+v changed=%v", third, changed)
+	}
+}
+
+func TestDiffMeta(t *testing.T) {
+	now := time.Date(2025, 10, 16, 8, 0, 0, 0, time.UTC)
+	old := DayMeta{
+		Summary:    summarize.Summary{TotalMessages: 120, UniqueSenders: 9, Topics: []summarize.Topic{{Name: "发布"}, {Name: "报销"}}},
+		AIInsights: &insight.Result{Overview: "讨论发布", Highlights: []string{"发布顺利"}, Risks: []string{"报销慢"}},
+	}
+	if d := DiffMeta(old, old, now); !d.Empty() {
+		t.Fatalf("identical metas differ: %v", d.Changes())
+	}
+
+	fresh := old
+	fresh.Summary.TotalMessages = 118
+	fresh.Summary.Topics = []summarize.Topic{{Name: "发布"}, {Name: "值班"}}
+	fresh.AIInsights = &insight.Result{Overview: "讨论发布与值班", Highlights: []string{"发布顺利", "值班已排好"}}
+	d := DiffMeta(old, fresh, now)
+	want := []string{"消息数 120 → 118", "新增主题：值班", "移除主题：报销", "AI 概述已更新", "AI 洞察新增 1 条、移除 1 条"}
+	if got := d.Changes(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("changes = %q, want %q", got, want)
+	}
+
+	fresh.AIInsights = nil
+	if got := DiffMeta(old, fresh, now).Changes(); got[len(got)-1] != "AI 洞察已移除" {
+		t.Fatalf("dropped insights not reported: %q", got)
+	}
+
+	var cl Changelog
+	for i := 0; i < changelogMax+5; i++ {
+		cl.Add(MetaDiff{At: now.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)})
+	}
+	if len(cl.Entries) != changelogMax || cl.Latest().At != now.Add(time.Duration(changelogMax+4)*time.Hour).Format(time.RFC3339) {
+		t.Fatalf("changelog kept %d entries, latest %+v", len(cl.Entries), cl.Latest())
+	}
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// GzipSuffix ends the name of a compacted raw file, data/YYYY-MM-DD.json.gz.
+const GzipSuffix = ".gz"
+
+// FindRaw returns the path of day's raw file, plain or compacted, and
+// whether there is one. The plain file wins if both exist.
+func FindRaw(dataDir, day string) (string, bool) {
+	p := RawPath(dataDir, day)
+	if _, err := os.Stat(p); err == nil {
+		return p, true
+	}
+	if _, err := os.Stat(p + GzipSuffix); err == nil {
+		return p + GzipSuffix, true
+	}
+	return p, false
+}
+
+// HasRaw reports whether day has a raw file in either form.
+func HasRaw(dataDir, day string) bool {
+	_, ok := FindRaw(dataDir, day)
+	return ok
+}
+
+// ReadRawFile returns the JSON in the raw file at path, decompressing
+// compacted files.
+func ReadRawFile(path string) ([]byte, error) {
+	if !strings.HasSuffix(path, GzipSuffix) {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// WriteRaw stores raw as day's raw file in the form the day already has,
+// so rewriting a compacted day keeps it compacted, and returns the path.
+func WriteRaw(dataDir, day string, raw Raw) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(raw); err != nil {
+		return "", err
+	}
+	p, _ := FindRaw(dataDir, day)
+	if strings.HasSuffix(p, GzipSuffix) {
+		return p, writeGzip(p, buf.Bytes())
+	}
+	return p, atomicfile.WriteFile(p, buf.Bytes())
+}
+
+// Compact replaces day's plain raw file with a gzip-compressed copy that
+// keeps the original modification time, and returns the bytes saved.
+// Already compacted days are left alone.
+func Compact(dataDir, day string) (int64, error) {
+	p := RawPath(dataDir, day)
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeGzip(p+GzipSuffix, b); err != nil {
+		return 0, err
+	}
+	_ = os.Chtimes(p+GzipSuffix, info.ModTime(), info.ModTime())
+	zinfo, err := os.Stat(p + GzipSuffix)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(p); err != nil {
+		return 0, err
+	}
+	return info.Size() - zinfo.Size(), nil
+}
+
+// RemoveRaw deletes day's raw file in both forms.
+func RemoveRaw(dataDir, day string) error {
+	for _, p := range []string{RawPath(dataDir, day), RawPath(dataDir, day) + GzipSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeGzip(path string, b []byte) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// ReportDays returns the days that have a raw file in dataDir or a
+// rendered meta.json in siteDir, oldest first. Pages built from meta.json
+// use it, so days whose raw data was removed by retention keep counting.
+func ReportDays(dataDir, siteDir string) ([]string, error) {
+	days, err := ListDays(dataDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(days))
+	for _, d := range days {
+		seen[d] = true
+	}
+	years, err := os.ReadDir(siteDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, y := range years {
+		if !y.IsDir() || !isDigits(y.Name(), 4) {
+			continue
+		}
+		months, _ := os.ReadDir(filepath.Join(siteDir, y.Name()))
+		for _, m := range months {
+			if !m.IsDir() || !isDigits(m.Name(), 2) {
+				continue
+			}
+			dds, _ := os.ReadDir(filepath.Join(siteDir, y.Name(), m.Name()))
+			for _, d := range dds {
+				day := y.Name() + "-" + m.Name() + "-" + d.Name()
+				if !d.IsDir() || !isDigits(d.Name(), 2) || seen[day] {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(siteDir, y.Name(), m.Name(), d.Name(), "meta.json")); err == nil {
+					seen[day] = true
+					days = append(days, day)
+				}
+			}
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	data, site := t.TempDir(), t.TempDir()
+	raw := Raw{Date: "2025-10-01", Talker: "1@chatroom", Messages: []chatlog.Message{{MsgID: "1", Content: "早"}}}
+	if _, err := WriteRaw(data, "2025-10-01", raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteRaw(data, "2025-10-02", raw); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(RawPath(data, "2025-10-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Compact(data, "2025-10-01"); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	p, ok := FindRaw(data, "2025-10-01")
+	if !ok || p != RawPath(data, "2025-10-01")+GzipSuffix {
+		t.Fatalf("FindRaw = %q, %v", p, ok)
+	}
+	if _, err := os.Stat(RawPath(data, "2025-10-01")); !os.IsNotExist(err) {
+		t.Fatalf("plain file left behind: %v", err)
+	}
+	if after, _ := os.Stat(p); !after.ModTime().Equal(before.ModTime()) {
+		t.Fatalf("modtime %v, want %v", after.ModTime(), before.ModTime())
+	}
+	got, err := LoadRaw(data, "2025-10-01")
+	if err != nil || !reflect.DeepEqual(got.Messages, raw.Messages) {
+		t.Fatalf("LoadRaw after compact = %+v, %v", got, err)
+	}
+
+	// Rewriting a compacted day keeps it compacted.
+	raw.Messages = append(raw.Messages, chatlog.Message{MsgID: "2", Content: "收到"})
+	if p, err := WriteRaw(data, "2025-10-01", raw); err != nil || filepath.Ext(p) != GzipSuffix {
+		t.Fatalf("WriteRaw = %q, %v", p, err)
+	}
+	if got, _ := LoadRaw(data, "2025-10-01"); len(got.Messages) != 2 {
+		t.Fatalf("rewritten day has %d messages", len(got.Messages))
+	}
+
+	days, err := ListDays(data)
+	if err != nil || !reflect.DeepEqual(days, []string{"2025-10-01", "2025-10-02"}) {
+		t.Fatalf("ListDays = %v, %v", days, err)
+	}
+
+	// A deleted day still counts for pages built from meta.json.
+	if err := os.MkdirAll(DayDir(site, "2025-09-30"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(DayDir(site, "2025-09-30"), "meta.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveRaw(data, "2025-10-01"); err != nil {
+		t.Fatal(err)
+	}
+	days, err = ReportDays(data, site)
+	if err != nil || !reflect.DeepEqual(days, []string{"2025-09-30", "2025-10-02"}) {
+		t.Fatalf("ReportDays = %v, %v", days, err)
+	}
+}
+
+func TestHistoryStandsInForDeletedRaw(t *testing.T) {
+	data := t.TempDir()
+	raw := Raw{Date: "2025-10-01", Talker: "1@chatroom", Messages: []chatlog.Message{
+		{Sender: "a", SenderName: "阿强", Timestamp: 1759280400, MsgType: 1, Content: "私密内容，链接见 https://example.com/a 部署完成"},
+		{Sender: "b", SenderName: "小美", MsgType: 49, Content: "[链接]", Share: &chatlog.Share{URL: "https://example.com/b", Title: "标题"}, Mentions: []string{"阿强"}},
+	}}
+	for _, day := range []string{"2025-10-01", "2025-10-02"} {
+		if _, err := WriteRaw(data, day, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveHistory(data, "2025-10-01", NewHistory(raw, []summarize.Topic{{Name: "部署"}, {Name: "发布"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveRaw(data, "2025-10-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	if days, err := ListDays(data); err != nil || !reflect.DeepEqual(days, []string{"2025-10-02"}) {
+		t.Fatalf("ListDays = %v, %v", days, err)
+	}
+	days, err := HistoryDays(data)
+	if err != nil || !reflect.DeepEqual(days, []string{"2025-10-01", "2025-10-02"}) {
+		t.Fatalf("HistoryDays = %v, %v", days, err)
+	}
+	msgs, err := LoadDayMessages(data, "2025-10-01")
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("LoadDayMessages = %+v, %v", msgs, err)
+	}
+	want := chatlog.Message{Sender: "a", SenderName: "阿强", Timestamp: 1759280400, MsgType: 1, Content: "https://example.com/a 部署"}
+	if !reflect.DeepEqual(msgs[0], want) {
+		t.Fatalf("history keeps more than links and topics: %+v", msgs[0])
+	}
+	if msgs[1].Share == nil || msgs[1].Share.Title != "标题" || msgs[1].Mentions != nil {
+		t.Fatalf("shared card not kept: %+v", msgs[1])
+	}
+	if msgs, _ := LoadDayMessages(data, "2025-10-02"); msgs[0].Content != raw.Messages[0].Content {
+		t.Fatalf("days with raw files read the raw file: %+v", msgs[0])
+	}
+}
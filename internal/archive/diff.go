@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/insight"
+)
+
+// changelogMax is how many regenerations a day's changelog keeps.
+const changelogMax = 20
+
+// MetaDiff records how a regenerated day page differs from the meta.json it
+// replaced: message and sender counts, topics and AI insights.
+type MetaDiff struct {
+	At             string   `json:"at"`
+	MessagesBefore int      `json:"messagesBefore"`
+	MessagesAfter  int      `json:"messagesAfter"`
+	SendersBefore  int      `json:"sendersBefore"`
+	SendersAfter   int      `json:"sendersAfter"`
+	TopicsAdded    []string `json:"topicsAdded,omitempty"`
+	TopicsRemoved  []string `json:"topicsRemoved,omitempty"`
+	// OverviewBefore and OverviewAfter are set when the AI overview changed.
+	OverviewBefore string `json:"overviewBefore,omitempty"`
+	OverviewAfter  string `json:"overviewAfter,omitempty"`
+	// InsightsAdded and InsightsRemoved are AI highlight, opportunity, risk
+	// and action bullets that appeared or disappeared.
+	InsightsAdded   []string `json:"insightsAdded,omitempty"`
+	InsightsRemoved []string `json:"insightsRemoved,omitempty"`
+	// InsightsGained and InsightsLost mark AI insights appearing on or
+	// dropping off the page as a whole.
+	InsightsGained bool `json:"insightsGained,omitempty"`
+	InsightsLost   bool `json:"insightsLost,omitempty"`
+}
+
+// Changelog mirrors data/diffs/YYYY-MM-DD.json, the regenerations of one
+// day that changed its page, oldest first.
+type Changelog struct {
+	Date    string     `json:"date"`
+	Entries []MetaDiff `json:"entries"`
+}
+
+// DiffPath returns the changelog path for day.
+func DiffPath(dataDir, day string) string {
+	return filepath.Join(dataDir, "diffs", day+".json")
+}
+
+// LoadChangelog reads the changelog for day.
+func LoadChangelog(dataDir, day string) (Changelog, error) {
+	var log Changelog
+	if err := readJSON(DiffPath(dataDir, day), &log); err != nil {
+		return Changelog{}, err
+	}
+	return log, nil
+}
+
+// Add appends d and drops the oldest entries beyond the retention limit.
+func (c *Changelog) Add(d MetaDiff) {
+	c.Entries = append(c.Entries, d)
+	if n := len(c.Entries); n > changelogMax {
+		c.Entries = append([]MetaDiff(nil), c.Entries[n-changelogMax:]...)
+	}
+}
+
+// Latest returns the most recent entry, or nil when there is none.
+func (c Changelog) Latest() *MetaDiff {
+	if len(c.Entries) == 0 {
+		return nil
+	}
+	return &c.Entries[len(c.Entries)-1]
+}
+
+// DiffMeta compares the previous meta of a day with the freshly rendered
+// one. Use Empty to tell whether anything a reader would notice changed.
+func DiffMeta(old, fresh DayMeta, now time.Time) MetaDiff {
+	d := MetaDiff{
+		At:             now.Format(time.RFC3339),
+		MessagesBefore: old.Summary.TotalMessages,
+		MessagesAfter:  fresh.Summary.TotalMessages,
+		SendersBefore:  old.Summary.UniqueSenders,
+		SendersAfter:   fresh.Summary.UniqueSenders,
+	}
+	oldTopics := make([]string, 0, len(old.Summary.Topics))
+	for _, t := range old.Summary.Topics {
+		oldTopics = append(oldTopics, t.Name)
+	}
+	freshTopics := make([]string, 0, len(fresh.Summary.Topics))
+	for _, t := range fresh.Summary.Topics {
+		freshTopics = append(freshTopics, t.Name)
+	}
+	d.TopicsAdded, d.TopicsRemoved = diffStrings(oldTopics, freshTopics)
+
+	switch {
+	case old.AIInsights == nil && fresh.AIInsights != nil:
+		d.InsightsGained = true
+	case old.AIInsights != nil && fresh.AIInsights == nil:
+		d.InsightsLost = true
+	case old.AIInsights != nil:
+		if o, f := strings.TrimSpace(old.AIInsights.Overview), strings.TrimSpace(fresh.AIInsights.Overview); o != f {
+			d.OverviewBefore, d.OverviewAfter = o, f
+		}
+		d.InsightsAdded, d.InsightsRemoved = diffStrings(insightBullets(old.AIInsights), insightBullets(fresh.AIInsights))
+	}
+	return d
+}
+
+// Empty reports whether nothing changed.
+func (d MetaDiff) Empty() bool {
+	return len(d.Changes()) == 0
+}
+
+// Changes describes the differences in short phrases for the page notice,
+// most significant first, in the report language.
+func (d MetaDiff) Changes() []string {
+	var out []string
+	if d.MessagesBefore != d.MessagesAfter {
+		out = append(out, i18n.Tf("消息数 %d → %d", d.MessagesBefore, d.MessagesAfter))
+	}
+	if d.SendersBefore != d.SendersAfter {
+		out = append(out, i18n.Tf("发言人数 %d → %d", d.SendersBefore, d.SendersAfter))
+	}
+	if len(d.TopicsAdded) > 0 {
+		out = append(out, i18n.T("新增主题：")+strings.Join(d.TopicsAdded, i18n.T("、")))
+	}
+	if len(d.TopicsRemoved) > 0 {
+		out = append(out, i18n.T("移除主题：")+strings.Join(d.TopicsRemoved, i18n.T("、")))
+	}
+	switch {
+	case d.InsightsGained:
+		out = append(out, i18n.T("新增 AI 洞察"))
+	case d.InsightsLost:
+		out = append(out, i18n.T("AI 洞察已移除"))
+	default:
+		if d.OverviewBefore != "" || d.OverviewAfter != "" {
+			out = append(out, i18n.T("AI 概述已更新"))
+		}
+		switch a, r := len(d.InsightsAdded), len(d.InsightsRemoved); {
+		case a > 0 && r > 0:
+			out = append(out, i18n.Tf("AI 洞察新增 %d 条、移除 %d 条", a, r))
+		case a > 0:
+			out = append(out, i18n.Tf("AI 洞察新增 %d 条", a))
+		case r > 0:
+			out = append(out, i18n.Tf("AI 洞察移除 %d 条", r))
+		}
+	}
+	return out
+}
+
+func insightBullets(r *insight.Result) []string {
+	var out []string
+	for _, list := range [][]string{r.Highlights, r.Opportunities, r.Risks, r.Actions} {
+		for _, s := range list {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// diffStrings returns the values of fresh missing from old and the values
+// of old missing from fresh, each in its original order.
+func diffStrings(old, fresh []string) (added, removed []string) {
+	inOld := make(map[string]bool, len(old))
+	for _, s := range old {
+		inOld[s] = true
+	}
+	inFresh := make(map[string]bool, len(fresh))
+	for _, s := range fresh {
+		inFresh[s] = true
+		if !inOld[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !inFresh[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
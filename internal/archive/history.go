@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// HistoryDir holds, under dataDir, what retention keeps of deleted raw days.
+const HistoryDir = "history"
+
+// History mirrors data/history/YYYY-MM-DD.json, written by retention in
+// place of a raw day it deletes. It keeps what the cross-day member, people
+// and link pages and the senders API read, and drops the message text.
+type History struct {
+	Date   string `json:"date"`
+	Talker string `json:"talker"`
+	// Messages keep sender, time, type and shared card of each message.
+	// Content is reduced to the links the text held and the day's topics
+	// it mentioned, space separated.
+	Messages []chatlog.Message `json:"messages"`
+	// Answers counts the day's answered questions per answerer.
+	Answers map[string]int `json:"answers,omitempty"`
+}
+
+var historyURLRegexp = regexp.MustCompile(`https?://[^\s]+`)
+
+// HistoryPath returns the history file path for day.
+func HistoryPath(dataDir, day string) string {
+	return filepath.Join(dataDir, HistoryDir, day+".json")
+}
+
+// NewHistory reduces raw to its history; topics are the day's topics from
+// meta.json.
+func NewHistory(raw Raw, topics []summarize.Topic) History {
+	h := History{Date: raw.Date, Talker: raw.Talker, Messages: make([]chatlog.Message, 0, len(raw.Messages))}
+	for _, m := range raw.Messages {
+		text := strings.TrimSpace(firstSet(m.Content, m.Text))
+		kept := historyURLRegexp.FindAllString(text, -1)
+		lower := strings.ToLower(text)
+		for _, tp := range topics {
+			if tp.Name != "" && strings.Contains(lower, tp.Name) {
+				kept = append(kept, tp.Name)
+			}
+		}
+		r := chatlog.Message{
+			Sender:     m.Sender,
+			SenderName: m.SenderName,
+			From:       m.From,
+			Nickname:   m.Nickname,
+			Timestamp:  m.Timestamp,
+			CreateTime: m.CreateTime,
+			Time:       m.Time,
+			Content:    strings.Join(kept, " "),
+			MsgType:    m.MsgType,
+			SubType:    m.SubType,
+		}
+		if m.Share != nil && m.Share.URL != "" {
+			r.Share = &chatlog.Share{URL: m.Share.URL, Title: m.Share.Title, Desc: m.Share.Desc}
+		}
+		h.Messages = append(h.Messages, r)
+	}
+	for _, item := range summarize.BuildSummary(raw.Messages).ReplyDebt.Resolved {
+		if item.AnsweredBy != "" && item.AnsweredBy != item.Questioner {
+			if h.Answers == nil {
+				h.Answers = map[string]int{}
+			}
+			h.Answers[item.AnsweredBy]++
+		}
+	}
+	return h
+}
+
+// SaveHistory writes h as day's history file.
+func SaveHistory(dataDir, day string, h History) error {
+	if h.Date == "" {
+		h.Date = day
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := HistoryPath(dataDir, day)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(p, b)
+}
+
+// LoadHistory reads the history retention left for day.
+func LoadHistory(dataDir, day string) (History, error) {
+	var h History
+	if err := readJSON(HistoryPath(dataDir, day), &h); err != nil {
+		return History{}, err
+	}
+	return h, nil
+}
+
+// HistoryDays returns the days with a raw file or a history in dataDir,
+// oldest first. Cross-day pages built from messages use it, so days whose
+// raw data was removed by retention keep counting.
+func HistoryDays(dataDir string) ([]string, error) {
+	days, err := ListDays(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dataDir, HistoryDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(days))
+	for _, d := range days {
+		seen[d] = true
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || len(name) != 15 || name[4] != '-' || name[7] != '-' || name[10:] != ".json" || seen[name[:10]] {
+			continue
+		}
+		seen[name[:10]] = true
+		days = append(days, name[:10])
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// LoadDayMessages returns day's messages from its raw file, or from its
+// history once retention removed the raw file. History messages carry only
+// what History keeps.
+func LoadDayMessages(dataDir, day string) ([]chatlog.Message, error) {
+	if HasRaw(dataDir, day) {
+		raw, err := LoadRaw(dataDir, day)
+		return raw.Messages, err
+	}
+	h, err := LoadHistory(dataDir, day)
+	return h.Messages, err
+}
@@ -0,0 +1,147 @@
+// Package atomicfile writes files through a temp file in the same directory
+// and renames it into place, so readers never see a half-written page or
+// JSON file. All temp files share the ".tmp-" prefix; Sweep removes the
+// ones a crashed or killed run left behind.
+package atomicfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prefix starts the name of every temp file written by this package.
+const Prefix = ".tmp-"
+
+// StaleAfter is how old a temp file must be before startup sweeps treat it
+// as abandoned; younger files may belong to a run still in progress.
+const StaleAfter = time.Hour
+
+// File is a pending write. Write to it, then Commit; Abort discards it and
+// is a no-op after Commit, so it can always be deferred.
+type File struct {
+	*os.File
+	final string
+	done  bool
+}
+
+// Create opens a temp file next to final, creating the directory.
+func Create(final string) (*File, error) {
+	dir := filepath.Dir(final)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, Prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: tmp, final: final}, nil
+}
+
+// Commit closes the temp file and renames it to the final path. On failure
+// the temp file is removed.
+func (f *File) Commit() error {
+	if f.done {
+		return errors.New("atomicfile: already committed or aborted")
+	}
+	f.done = true
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.final); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort closes and removes the temp file unless it was committed.
+func (f *File) Abort() {
+	if f == nil || f.done {
+		return
+	}
+	f.done = true
+	_ = f.File.Close()
+	_ = os.Remove(f.Name())
+}
+
+// WriteFile atomically replaces path with data.
+func WriteFile(path string, data []byte) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// legacyTemps are the "<name>.tmp" files older versions wrote next to the
+// JSON files they replaced; raw day files are matched by legacyRawTemp.
+var legacyTemps = map[string]bool{
+	"meta.json.tmp":         true,
+	"claims.json.tmp":       true,
+	"qa.json.tmp":           true,
+	"risk_reviews.json.tmp": true,
+}
+
+const legacyRawTemp = "2006-01-02.json.tmp"
+
+// IsTemp reports whether name is a temp file: this package's ".tmp-*"
+// files and the known "<name>.tmp" files older versions wrote. Other names
+// ending in .tmp belong to the user and are left alone.
+func IsTemp(name string) bool {
+	if strings.HasPrefix(name, Prefix) || legacyTemps[name] {
+		return true
+	}
+	_, err := time.Parse(legacyRawTemp, name)
+	return err == nil
+}
+
+// SweepResult counts what Sweep removed.
+type SweepResult struct {
+	Files int
+	Bytes int64
+}
+
+// Sweep removes temp files under root last modified more than olderThan
+// ago (0 removes them all). A missing root is not an error.
+func Sweep(root string, olderThan time.Duration) (SweepResult, error) {
+	var res SweepResult
+	cutoff := time.Now().Add(-olderThan)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !IsTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if olderThan > 0 && info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		res.Files++
+		res.Bytes += info.Size()
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,99 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAbortRemovesTempFile(t *testing.T) {
+	dir := t.TempDir()
+	final := filepath.Join(dir, "sub", "index.html")
+	write := func(fail bool) error {
+		f, err := Create(final)
+		if err != nil {
+			return err
+		}
+		defer f.Abort()
+		if _, err := f.WriteString("<html>"); err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("模板渲染失败")
+		}
+		return f.Commit()
+	}
+	if err := write(true); err == nil {
+		t.Fatal("应返回错误")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(final)); len(entries) != 0 {
+		t.Fatalf("失败后不应残留临时文件: %v", entries)
+	}
+	if err := write(false); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if info, err := os.Stat(final); err != nil || info.Mode().Perm() != 0o644 {
+		t.Fatalf("最终文件不对: %v %v", info, err)
+	}
+}
+
+func TestIsTemp(t *testing.T) {
+	cases := map[string]bool{
+		Prefix + "123":        true,
+		Prefix + "report.pdf": true,
+		"meta.json.tmp":       true,
+		"qa.json.tmp":         true,
+		"2025-10-16.json.tmp": true,
+		"foo.tmp":             false,
+		"notes.json.tmp":      false,
+		"2025-10-16.json":     false,
+		"2025-13-01.json.tmp": false,
+		"index.html":          false,
+	}
+	for name, want := range cases {
+		if got := IsTemp(name); got != want {
+			t.Errorf("IsTemp(%q) = %v, 期望 %v", name, got, want)
+		}
+	}
+}
+
+func TestSweepKeepsFreshTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "2025", Prefix+"123")
+	legacy := filepath.Join(dir, "claims.json.tmp")
+	fresh := filepath.Join(dir, Prefix+"456")
+	keep := filepath.Join(dir, "index.html")
+	user := filepath.Join(dir, "foo.tmp")
+	for _, p := range []string{old, legacy, fresh, keep, user} {
+		if err := WriteFile(p, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-2 * StaleAfter)
+	for _, p := range []string{old, legacy, user} {
+		if err := os.Chtimes(p, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := Sweep(dir, StaleAfter)
+	if err != nil || res.Files != 2 {
+		t.Fatalf("应清理 2 个陈旧临时文件: %+v %v", res, err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatal("新建的临时文件可能仍在使用，不应清理")
+	}
+	if res, _ := Sweep(dir, 0); res.Files != 1 {
+		t.Fatalf("older-than 0 应清理全部临时文件: %+v", res)
+	}
+	for _, p := range []string{keep, user} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("普通文件不应被清理: %s", p)
+		}
+	}
+	if _, err := Sweep(filepath.Join(dir, "missing"), 0); err != nil {
+		t.Fatalf("目录不存在不应报错: %v", err)
+	}
+}
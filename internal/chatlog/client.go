@@ -1,6 +1,11 @@
 package chatlog
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,35 +22,44 @@ type Client struct {
 	BaseURL string
 	// Optional: custom HTTP client (timeouts)
 	HTTP *http.Client
+	// Optional: keep at most this many messages; extra ones are counted and
+	// reported in meta ("truncated", "keptMessages", "totalMessages").
+	MaxMessages int
+	// Optional: abort with ErrResponseTooLarge once the body exceeds this size.
+	MaxResponseBytes int64
 }
 
 type Message struct {
-	ID         string                 `json:"id,omitempty"`
-	MsgID      string                 `json:"msgId,omitempty"`
-	Talker     string                 `json:"talker,omitempty"`
-	TalkerName string                 `json:"talkerName,omitempty"`
-	Sender     string                 `json:"sender,omitempty"`
-	SenderName string                 `json:"senderName,omitempty"`
-	From       string                 `json:"from,omitempty"`
-	Nickname   string                 `json:"nickname,omitempty"`
-	Timestamp  int64                  `json:"timestamp,omitempty"`
-	CreateTime int64                  `json:"createTime,omitempty"`
-	Time       string                 `json:"time,omitempty"`
-	Content    string                 `json:"content,omitempty"`
-	Text       string                 `json:"text,omitempty"`
-	Type       string                 `json:"type,omitempty"`
-	MsgType    int                    `json:"msgType,omitempty"`
-	SubType    int                    `json:"subType,omitempty"`
-	IsChatRoom bool                   `json:"isChatRoom,omitempty"`
-	IsSelf     bool                   `json:"isSelf,omitempty"`
-	MediaMD5   string                 `json:"mediaMD5,omitempty"`
-	MediaPath  string                 `json:"mediaPath,omitempty"`
-	Mentions   []string               `json:"mentions,omitempty"`
-	Emojis     []string               `json:"emojis,omitempty"`
-	Reference  *Reference             `json:"reference,omitempty"`
-	IsQuestion bool                   `json:"isQuestion,omitempty"`
-	Share      *Share                 `json:"share,omitempty"`
-	Extras     map[string]interface{} `json:"-"`
+	ID         string      `json:"id,omitempty"`
+	MsgID      string      `json:"msgId,omitempty"`
+	Talker     string      `json:"talker,omitempty"`
+	TalkerName string      `json:"talkerName,omitempty"`
+	Sender     string      `json:"sender,omitempty"`
+	SenderName string      `json:"senderName,omitempty"`
+	From       string      `json:"from,omitempty"`
+	Nickname   string      `json:"nickname,omitempty"`
+	Timestamp  int64       `json:"timestamp,omitempty"`
+	CreateTime int64       `json:"createTime,omitempty"`
+	Time       string      `json:"time,omitempty"`
+	Content    string      `json:"content,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	MsgType    int         `json:"msgType,omitempty"`
+	SubType    int         `json:"subType,omitempty"`
+	IsChatRoom bool        `json:"isChatRoom,omitempty"`
+	IsSelf     bool        `json:"isSelf,omitempty"`
+	MediaMD5   string      `json:"mediaMD5,omitempty"`
+	MediaPath  string      `json:"mediaPath,omitempty"`
+	Mentions   []string    `json:"mentions,omitempty"`
+	Emojis     []string    `json:"emojis,omitempty"`
+	Reference  *Reference  `json:"reference,omitempty"`
+	IsQuestion bool        `json:"isQuestion,omitempty"`
+	Share      *Share      `json:"share,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+	// Extras holds keys of the chatlog message this package does not know;
+	// nil when there are none.
+	Extras map[string]interface{} `json:"-"`
 }
 
 type Reference struct {
@@ -65,8 +80,45 @@ type Share struct {
 	URL   string `json:"url,omitempty"`
 }
 
+// Attachment describes a video or file message.
+type Attachment struct {
+	FileName string `json:"fileName,omitempty"`
+	Size     int64  `json:"size,omitempty"`     // bytes
+	Duration int    `json:"duration,omitempty"` // seconds, videos only
+}
+
+// Message types that carry an attachment.
+const (
+	TypeVideo   = 43
+	TypeApp     = 49
+	SubTypeFile = 6
+)
+
+// IsVideo reports whether m is a video message.
+func (m Message) IsVideo() bool { return m.MsgType == TypeVideo }
+
+// IsFile reports whether m is a file message (app message subtype 6).
+func (m Message) IsFile() bool { return m.MsgType == TypeApp && m.SubType == SubTypeFile }
+
+// FileName returns the attachment name, falling back to the share title that
+// chatlog uses for file messages.
+func (m Message) FileName() string {
+	if m.Attachment != nil && m.Attachment.FileName != "" {
+		return m.Attachment.FileName
+	}
+	if m.Share != nil {
+		return m.Share.Title
+	}
+	return ""
+}
+
 // FetchDay calls chatlog local API for one day and returns best-effort parsed messages.
 func (c Client) FetchDay(day, talker, keyword string) ([]Message, map[string]any, error) {
+	return c.FetchDayContext(context.Background(), day, talker, keyword)
+}
+
+// FetchDayContext is FetchDay with a context that cancels the request.
+func (c Client) FetchDayContext(ctx context.Context, day, talker, keyword string) ([]Message, map[string]any, error) {
 	base := strings.TrimRight(c.BaseURL, "/")
 	u, _ := url.Parse(base + "/api/v1/chatlog")
 	q := u.Query()
@@ -82,7 +134,13 @@ func (c Client) FetchDay(day, talker, keyword string) ([]Message, map[string]any
 	if httpClient == nil {
 		httpClient = &http.Client{Timeout: 30 * time.Second}
 	}
-	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Asking explicitly turns off the transport's transparent gzip, so
+	// deflate can be offered too; the body is decompressed below.
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -94,124 +152,608 @@ func (c Client) FetchDay(day, talker, keyword string) ([]Message, map[string]any
 		return nil, nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(b))
 	}
 
-	var raw any
-	dec := json.NewDecoder(resp.Body)
-	dec.UseNumber()
-	if err := dec.Decode(&raw); err != nil {
+	body, err := decompress(resp)
+	if err != nil {
 		return nil, nil, err
 	}
+	defer body.Close()
+	var r io.Reader = body
+	if c.MaxResponseBytes > 0 {
+		// The limit applies to the decompressed size, so a small compressed
+		// body cannot expand past it either.
+		r = &limitedReader{r: body, n: c.MaxResponseBytes}
+	}
+	return c.decodeMessages(r)
+}
 
-	// Try to locate array of messages under common keys
-	arr, meta := normalizeResponse(raw)
-	if arr == nil {
-		return nil, nil, errors.New("unable to locate messages array in response")
+// FetchReportDayContext fetches the report day that starts at startHour
+// (0-23, local time): from startHour on day until startHour the next day.
+// chatlog splits days at midnight, so for startHour > 0 both calendar days
+// are fetched and trimmed to the window; messages without a time stay with
+// day. Both days are fetched whole and MaxMessages applies to the window,
+// so a busy morning before startHour cannot push out the evening, and
+// totalMessages counts the window only.
+func (c Client) FetchReportDayContext(ctx context.Context, day string, startHour int, talker, keyword string) ([]Message, map[string]any, error) {
+	if startHour <= 0 {
+		return c.FetchDayContext(ctx, day, talker, keyword)
+	}
+	d, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return nil, nil, err
+	}
+	from := d.Add(time.Duration(startHour) * time.Hour)
+	to := from.AddDate(0, 0, 1)
+	whole := c
+	whole.MaxMessages = 0
+	first, meta, err := whole.FetchDayContext(ctx, day, talker, keyword)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, _, err := whole.FetchDayContext(ctx, d.AddDate(0, 0, 1).Format("2006-01-02"), talker, keyword)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []Message
+	for _, m := range first {
+		if at := sentAt(m); at.IsZero() || !at.Before(from) {
+			out = append(out, m)
+		}
+	}
+	for _, m := range next {
+		if at := sentAt(m); !at.IsZero() && at.Before(to) {
+			out = append(out, m)
+		}
+	}
+	total := len(out)
+	if c.MaxMessages > 0 && len(out) > c.MaxMessages {
+		out = out[:c.MaxMessages]
+	}
+	return out, c.truncationMeta(meta, len(out), total), nil
+}
+
+// sentAt is when m was sent, or the zero time; the RFC 3339 time wins over
+// numeric stamps, which chatlog fills from seq.
+func sentAt(m Message) time.Time {
+	if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
+		return t
+	}
+	ts := m.Timestamp
+	if ts <= 0 {
+		ts = m.CreateTime
+	}
+	if ts <= 0 {
+		return time.Time{}
 	}
+	if ts > 1_000_000_000_000 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
 
-	msgs := make([]Message, 0, len(arr))
-	for _, it := range arr {
-		if m, ok := it.(map[string]any); ok {
-			msgs = append(msgs, mapToMessage(m))
+// decompress returns the body of resp decoded according to its
+// Content-Encoding (gzip or deflate).
+func decompress(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return io.NopCloser(resp.Body), nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("gzip response: %w", err)
 		}
+		return zr, nil
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, though some servers send raw
+		// deflate; the zlib header tells them apart.
+		br := bufio.NewReader(resp.Body)
+		if head, err := br.Peek(2); err == nil && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 && head[0]&0x0f == 8 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("deflate response: %w", err)
+			}
+			return zr, nil
+		}
+		return flate.NewReader(br), nil
 	}
-	return msgs, meta, nil
-}
-
-// normalizeResponse tries common envelopes: {data: []}, {list: []}, {messages: []}, or root []. Returns messages array and meta.
-func normalizeResponse(v any) ([]any, map[string]any) {
-	switch x := v.(type) {
-	case []any:
-		return x, nil
-	case map[string]any:
-		// potential meta is the whole object minus the array
-		keys := []string{"data", "list", "messages", "items", "result"}
-		for _, k := range keys {
-			if arr, ok := x[k].([]any); ok {
-				meta := make(map[string]any)
-				for mk, mv := range x {
-					if mk == k {
-						continue
-					}
-					meta[mk] = mv
+	return nil, fmt.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))
+}
+
+// Decode parses a chatlog API response body (for example a saved export or
+// generated demo data) with the same rules and limits as FetchDay.
+func (c Client) Decode(r io.Reader) ([]Message, map[string]any, error) {
+	return c.decodeMessages(r)
+}
+
+// decodeMessages walks the response with a token stream so only one message
+// is materialised at a time. It accepts the same envelopes as
+// normalizeResponse: a root array or an object holding the array under a
+// common key, with the remaining keys returned as meta.
+func (c Client) decodeMessages(r io.Reader) ([]Message, map[string]any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch tok {
+	case json.Delim('['):
+		msgs, total, err := c.decodeArray(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+		return msgs, c.truncationMeta(nil, len(msgs), total), nil
+	case json.Delim('{'):
+		meta := make(map[string]any)
+		var msgs []Message
+		total := 0
+		found := false
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			key, _ := kt.(string)
+			if found || !isMessagesKey(key) {
+				var v any
+				if err := dec.Decode(&v); err != nil {
+					return nil, nil, err
 				}
-				return arr, meta
+				meta[key] = v
+				continue
+			}
+			vt, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			if vt != json.Delim('[') {
+				v, err := readValue(dec, vt)
+				if err != nil {
+					return nil, nil, err
+				}
+				meta[key] = v
+				continue
+			}
+			msgs, total, err = c.decodeArray(dec)
+			if err != nil {
+				return nil, nil, err
 			}
+			found = true
 		}
+		if !found {
+			return nil, nil, errors.New("unable to locate messages array in response")
+		}
+		return msgs, c.truncationMeta(meta, len(msgs), total), nil
+	}
+	return nil, nil, errors.New("unable to locate messages array in response")
+}
+
+// decodeArray consumes array elements up to and including the closing bracket.
+// Elements beyond MaxMessages are skipped but still counted.
+func (c Client) decodeArray(dec *json.Decoder) ([]Message, int, error) {
+	msgs := make([]Message, 0, 256)
+	total := 0
+	// raw is reused for every element; decodeMessage copies what it keeps.
+	var raw json.RawMessage
+	for dec.More() {
+		if c.MaxMessages > 0 && len(msgs) >= c.MaxMessages {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, 0, err
+			}
+			total++
+			continue
+		}
+		if err := dec.Decode(&raw); err != nil {
+			return nil, 0, err
+		}
+		if m, ok := decodeMessage(raw); ok {
+			msgs = append(msgs, m)
+			total++
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, 0, err
+	}
+	return msgs, total, nil
+}
+
+func (c Client) truncationMeta(meta map[string]any, kept, total int) map[string]any {
+	if total <= kept {
+		return meta
+	}
+	if meta == nil {
+		meta = make(map[string]any)
+	}
+	meta["truncated"] = true
+	meta["keptMessages"] = kept
+	meta["totalMessages"] = total
+	return meta
+}
+
+// readValue rebuilds a JSON value whose first token was already consumed.
+func readValue(dec *json.Decoder, tok json.Token) (any, error) {
+	switch tok {
+	case json.Delim('{'):
+		obj := make(map[string]any)
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			key, _ := kt.(string)
+			obj[key] = v
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// isMessagesKey lists the envelope keys that may hold the messages array:
+// {data: []}, {list: []}, {messages: []}, {items: []} or {result: []}.
+func isMessagesKey(k string) bool {
+	switch k {
+	case "data", "list", "messages", "items", "result":
+		return true
 	}
-	return nil, nil
+	return false
+}
+
+// ErrResponseTooLarge is returned when the chatlog response exceeds MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("chatlog response exceeds size limit")
+
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// field is one scalar of a message as chatlog sent it. Chatlog versions
+// disagree on types (ids and times come as strings or numbers), so a field
+// keeps the JSON kind and converts on read; objects and arrays are kept
+// only as "present".
+type field struct {
+	kind byte // 0 for absent or null, else '"', '0', 'b' or '{'
+	s    string
 }
 
-func toInt64(v any) int64 {
-	switch t := v.(type) {
-	case json.Number:
-		i, _ := t.Int64()
+// parseField reads the JSON value v. Strings without escapes share v's
+// memory.
+func parseField(v string) field {
+	switch v[0] {
+	case 'n':
+		return field{}
+	case '"':
+		return field{kind: '"', s: unquote(v)}
+	case 't', 'f':
+		return field{kind: 'b', s: v}
+	case '{', '[':
+		return field{kind: '{'}
+	}
+	return field{kind: '0', s: v}
+}
+
+func (f field) String() string {
+	if f.kind == '"' || f.kind == '0' {
+		return f.s
+	}
+	return ""
+}
+
+func (f field) Int64() int64 {
+	switch f.kind {
+	case '0':
+		i, _ := strconv.ParseInt(f.s, 10, 64)
+		return i
+	case '"':
+		i, _ := strconv.ParseInt(strings.TrimSpace(f.s), 10, 64)
 		return i
-	case float64:
-		return int64(t)
-	case int64:
-		return t
-	case int:
-		return int64(t)
 	}
 	return 0
 }
 
-func toString(v any) string {
-	switch t := v.(type) {
-	case string:
-		return t
-	case json.Number:
-		return t.String()
+func (f field) Bool() bool {
+	switch f.kind {
+	case 'b':
+		return f.s == "true"
+	case '"':
+		return f.s == "true" || f.s == "1"
+	case '0':
+		return f.Int64() != 0
 	}
-	return ""
+	return false
 }
 
-func mapToMessage(m map[string]any) Message {
-	msg := Message{
-		ID:         toString(firstNonEmpty(m["id"], m["_id"], m["msgId"], m["msgID"])),
-		MsgID:      toString(firstNonEmpty(m["msgId"], m["msgID"], m["id"])),
-		Talker:     toString(firstNonEmpty(m["talker"], m["chatroom"], m["room"], m["toUserName"])),
-		TalkerName: toString(firstNonEmpty(m["talkerName"], m["roomName"])),
-		Sender:     toString(firstNonEmpty(m["sender"], m["from"], m["fromUser"], m["fromUserName"])),
-		SenderName: toString(firstNonEmpty(m["senderName"], m["displayName"], m["nickname"], m["senderNick"])),
-		From:       toString(m["from"]),
-		Nickname:   toString(firstNonEmpty(m["nickname"], m["displayName"], m["senderName"])),
-		Timestamp:  toInt64(firstNonEmpty(m["seq"], m["timestamp"], m["ts"], m["createTime"])),
-		CreateTime: toInt64(m["createTime"]),
-		Time:       toString(firstNonEmpty(m["time"], m["createdAt"], m["date"])),
-		Content:    toString(firstNonEmpty(m["content"], m["text"], m["message"], m["body"])),
-		Text:       toString(m["text"]),
-		Type:       toString(firstNonEmpty(m["type"], m["msgTypeName"])),
-		MsgType:    int(toInt64(firstNonEmpty(m["msgType"], m["type"]))),
-		SubType:    int(toInt64(m["subType"])),
-		Extras:     map[string]any{},
-	}
-	// booleans
-	if v, ok := m["isChatRoom"]; ok {
-		switch t := v.(type) {
-		case bool:
-			msg.IsChatRoom = t
-		case string:
-			msg.IsChatRoom = t == "true" || t == "1"
-		case json.Number:
-			i, _ := t.Int64()
-			msg.IsChatRoom = i != 0
-		case float64:
-			msg.IsChatRoom = t != 0
+// first returns the first field that is set and, for strings, not blank.
+func first(fs ...field) field {
+	for _, f := range fs {
+		if f.kind == 0 || (f.kind == '"' && strings.TrimSpace(f.s) == "") {
+			continue
+		}
+		return f
+	}
+	return field{}
+}
+
+// wireMessage holds the keys a message may use for each Message field.
+type wireMessage struct {
+	id, underscoreID, msgId, msgID                 field
+	talker, chatroom, room, toUserName, talkerName field
+	roomName, sender, from, fromUser, fromUserName field
+	senderName, displayName, nickname, senderNick  field
+	seq, timestamp, ts, createTime                 field
+	time, createdAt, date                          field
+	content, text, message, body                   field
+	typ, msgTypeName, msgType, subType             field
+	isChatRoom, isSelf                             field
+	contents                                       wireContents
+	// appMsg merges the "appMsgInfo" and "appMsg" objects.
+	appMsg wireShare
+	extras map[string]any
+}
+
+func (w *wireMessage) set(key, value string) {
+	var f *field
+	switch key {
+	case "id":
+		f = &w.id
+	case "_id":
+		f = &w.underscoreID
+	case "msgId":
+		f = &w.msgId
+	case "msgID":
+		f = &w.msgID
+	case "talker":
+		f = &w.talker
+	case "chatroom":
+		f = &w.chatroom
+	case "room":
+		f = &w.room
+	case "toUserName":
+		f = &w.toUserName
+	case "talkerName":
+		f = &w.talkerName
+	case "roomName":
+		f = &w.roomName
+	case "sender":
+		f = &w.sender
+	case "from":
+		f = &w.from
+	case "fromUser":
+		f = &w.fromUser
+	case "fromUserName":
+		f = &w.fromUserName
+	case "senderName":
+		f = &w.senderName
+	case "displayName":
+		f = &w.displayName
+	case "nickname":
+		f = &w.nickname
+	case "senderNick":
+		f = &w.senderNick
+	case "seq":
+		f = &w.seq
+	case "timestamp":
+		f = &w.timestamp
+	case "ts":
+		f = &w.ts
+	case "createTime":
+		f = &w.createTime
+	case "time":
+		f = &w.time
+	case "createdAt":
+		f = &w.createdAt
+	case "date":
+		f = &w.date
+	case "content":
+		f = &w.content
+	case "text":
+		f = &w.text
+	case "message":
+		f = &w.message
+	case "body":
+		f = &w.body
+	case "type":
+		f = &w.typ
+	case "msgTypeName":
+		f = &w.msgTypeName
+	case "msgType":
+		f = &w.msgType
+	case "subType":
+		f = &w.subType
+	case "isChatRoom":
+		f = &w.isChatRoom
+	case "isSelf":
+		f = &w.isSelf
+	case "contents":
+		if value[0] == '{' {
+			w.contents.present = true
+			eachMember(value, w.contents.set)
+		}
+		return
+	case "appMsgInfo", "appMsg":
+		if value[0] == '{' {
+			eachMember(value, w.appMsg.set)
 		}
+		return
+	default:
+		// Unknown keys are rare; keep them as generic values.
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var v any
+		if dec.Decode(&v) == nil {
+			if w.extras == nil {
+				w.extras = map[string]any{}
+			}
+			w.extras[key] = v
+		}
+		return
 	}
-	if v, ok := m["isSelf"]; ok {
-		switch t := v.(type) {
-		case bool:
-			msg.IsSelf = t
-		case string:
-			msg.IsSelf = t == "true" || t == "1"
-		case json.Number:
-			i, _ := t.Int64()
-			msg.IsSelf = i != 0
-		case float64:
-			msg.IsSelf = t != 0
+	*f = parseField(value)
+}
+
+// wireContents is the "contents" object of media, file, share and reply
+// messages.
+type wireContents struct {
+	present                           bool
+	md5, path, title, desc, url       field
+	fileName, filename                field
+	fileSize, totalLen, size, length  field
+	playLength, duration, videoLength field
+	refer                             wireReference
+}
+
+func (c *wireContents) set(key, value string) {
+	switch key {
+	case "md5":
+		c.md5 = parseField(value)
+	case "path":
+		c.path = parseField(value)
+	case "title":
+		c.title = parseField(value)
+	case "desc":
+		c.desc = parseField(value)
+	case "url":
+		c.url = parseField(value)
+	case "fileName":
+		c.fileName = parseField(value)
+	case "filename":
+		c.filename = parseField(value)
+	case "fileSize":
+		c.fileSize = parseField(value)
+	case "totalLen":
+		c.totalLen = parseField(value)
+	case "size":
+		c.size = parseField(value)
+	case "length":
+		c.length = parseField(value)
+	case "playLength":
+		c.playLength = parseField(value)
+	case "duration":
+		c.duration = parseField(value)
+	case "videoLength":
+		c.videoLength = parseField(value)
+	case "refer":
+		if value[0] == '{' {
+			eachMember(value, c.refer.set)
 		}
 	}
+}
+
+// wireReference is the quoted message of a reply ("contents.refer").
+type wireReference struct {
+	seq, time, talker, talkerName, sender, senderName field
+	typ, msgType, subType, content, text, message     field
+}
+
+func (r *wireReference) set(key, value string) {
+	switch key {
+	case "seq":
+		r.seq = parseField(value)
+	case "time":
+		r.time = parseField(value)
+	case "talker":
+		r.talker = parseField(value)
+	case "talkerName":
+		r.talkerName = parseField(value)
+	case "sender":
+		r.sender = parseField(value)
+	case "senderName":
+		r.senderName = parseField(value)
+	case "type":
+		r.typ = parseField(value)
+	case "msgType":
+		r.msgType = parseField(value)
+	case "subType":
+		r.subType = parseField(value)
+	case "content":
+		r.content = parseField(value)
+	case "text":
+		r.text = parseField(value)
+	case "message":
+		r.message = parseField(value)
+	}
+}
+
+// wireShare is share metadata stored outside "contents".
+type wireShare struct {
+	present          bool
+	title, desc, url field
+}
+
+func (s *wireShare) set(key, value string) {
+	s.present = true
+	switch key {
+	case "title":
+		s.title = parseField(value)
+	case "desc":
+		s.desc = parseField(value)
+	case "url":
+		s.url = parseField(value)
+	}
+}
+
+// decodeMessage converts one array element, already validated by the
+// decoder, into a Message. All unescaped strings of the message share the
+// memory of a single copy of the element. ok is false for elements that
+// are not objects.
+func decodeMessage(raw []byte) (msg Message, ok bool) {
+	if len(raw) == 0 || raw[0] != '{' {
+		return msg, false
+	}
+	var w wireMessage
+	eachMember(string(raw), w.set)
+	return w.toMessage(), true
+}
+
+func (w *wireMessage) toMessage() Message {
+	msg := Message{
+		ID:         first(w.id, w.underscoreID, w.msgId, w.msgID).String(),
+		MsgID:      first(w.msgId, w.msgID, w.id).String(),
+		Talker:     first(w.talker, w.chatroom, w.room, w.toUserName).String(),
+		TalkerName: first(w.talkerName, w.roomName).String(),
+		Sender:     first(w.sender, w.from, w.fromUser, w.fromUserName).String(),
+		SenderName: first(w.senderName, w.displayName, w.nickname, w.senderNick).String(),
+		From:       w.from.String(),
+		Nickname:   first(w.nickname, w.displayName, w.senderName).String(),
+		Timestamp:  first(w.seq, w.timestamp, w.ts, w.createTime).Int64(),
+		CreateTime: w.createTime.Int64(),
+		Time:       first(w.time, w.createdAt, w.date).String(),
+		Content:    first(w.content, w.text, w.message, w.body).String(),
+		Text:       w.text.String(),
+		Type:       first(w.typ, w.msgTypeName).String(),
+		MsgType:    int(first(w.msgType, w.typ).Int64()),
+		SubType:    int(w.subType.Int64()),
+		IsChatRoom: w.isChatRoom.Bool(),
+		IsSelf:     w.isSelf.Bool(),
+		Extras:     w.extras,
+	}
 	text := msg.Content
 	if text == "" {
 		text = msg.Text
@@ -223,59 +765,95 @@ func mapToMessage(m map[string]any) Message {
 	}
 
 	// contents for media / references
-	if c, ok := m["contents"].(map[string]any); ok {
-		if v, ok2 := c["md5"]; ok2 {
-			msg.MediaMD5 = toString(v)
+	if c := &w.contents; c.present {
+		msg.MediaMD5 = c.md5.String()
+		msg.MediaPath = c.path.String()
+		msg.Reference = parseReference(&c.refer)
+		if msg.IsVideo() || msg.IsFile() {
+			msg.Attachment = parseAttachment(c, msg.IsVideo())
 		}
-		if v, ok2 := c["path"]; ok2 {
-			msg.MediaPath = toString(v)
+		if msg.MsgType == TypeApp && (c.title.String() != "" || c.url.String() != "") {
+			msg.Share = &Share{Title: c.title.String(), Desc: c.desc.String(), URL: c.url.String()}
 		}
-		if refRaw, ok2 := c["refer"].(map[string]any); ok2 {
-			if ref := parseReference(refRaw); ref != nil {
-				msg.Reference = ref
-			}
+	}
+	// fallback if share metadata stored elsewhere
+	if msg.Share == nil && w.appMsg.present {
+		msg.Share = &Share{Title: w.appMsg.title.String(), Desc: w.appMsg.desc.String(), URL: w.appMsg.url.String()}
+	}
+	return msg
+}
+
+// eachMember calls fn with every key and raw value of the JSON object obj,
+// which must already be valid JSON.
+func eachMember(obj string, fn func(key, value string)) {
+	i := skipSpace(obj, 1)
+	for i < len(obj) && obj[i] == '"' {
+		end := skipValue(obj, i)
+		key := unquote(obj[i:end])
+		i = skipSpace(obj, end)
+		i = skipSpace(obj, i+1) // ':'
+		end = skipValue(obj, i)
+		fn(key, obj[i:end])
+		i = skipSpace(obj, end)
+		if i < len(obj) && obj[i] == ',' {
+			i = skipSpace(obj, i+1)
 		}
-		if msg.MsgType == 49 {
-			if title := toString(c["title"]); title != "" || toString(c["url"]) != "" {
-				msg.Share = &Share{
-					Title: toString(c["title"]),
-					Desc:  toString(c["desc"]),
-					URL:   toString(c["url"]),
-				}
-			} else if ext, ok := msg.Extras["appMsg"].(map[string]any); ok {
-				// fallback if share metadata stored elsewhere
-				msg.Share = &Share{
-					Title: toString(ext["title"]),
-					Desc:  toString(ext["desc"]),
-					URL:   toString(ext["url"]),
-				}
+	}
+}
+
+// skipValue returns the index just past the JSON value starting at s[i].
+func skipValue(s string, i int) int {
+	switch s[i] {
+	case '"':
+		for j := i + 1; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
 			}
 		}
-	}
-	// copy remaining unknowns into Extras
-	appMsg := map[string]any{}
-	for k, v := range m {
-		switch k {
-		case "id", "_id", "msgId", "msgID", "talker", "chatroom", "room", "toUserName", "talkerName", "sender", "from", "fromUser", "fromUserName", "senderName", "senderNick", "nickname", "displayName", "seq", "timestamp", "ts", "createTime", "time", "createdAt", "date", "content", "text", "message", "body", "type", "msgTypeName", "msgType", "subType", "isChatRoom", "isSelf", "contents":
-			// skip
-		case "appMsgInfo", "appMsg":
-			if mv, ok := v.(map[string]any); ok {
-				for kk, vv := range mv {
-					appMsg[kk] = vv
+		return len(s)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(s); j++ {
+			switch s[j] {
+			case '"':
+				j = skipValue(s, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
 				}
 			}
-		default:
-			msg.Extras[k] = v
 		}
+		return len(s)
 	}
-	if msg.Share == nil && len(appMsg) > 0 {
-		msg.Share = &Share{
-			Title: toString(appMsg["title"]),
-			Desc:  toString(appMsg["desc"]),
-			URL:   toString(appMsg["url"]),
-		}
+	j := i
+	for j < len(s) && !strings.ContainsRune(",}] \t\r\n", rune(s[j])) {
+		j++
 	}
-	return msg
+	return j
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// unquote decodes the JSON string literal q, sharing q's memory unless it
+// has escapes.
+func unquote(q string) string {
+	if !strings.Contains(q, `\`) {
+		return q[1 : len(q)-1]
+	}
+	var s string
+	_ = json.Unmarshal([]byte(q), &s)
+	return s
 }
 
 var (
@@ -292,20 +870,33 @@ var (
 	)
 )
 
-func parseReference(m map[string]any) *Reference {
-	if len(m) == 0 {
+// parseAttachment reads the name, size and duration chatlog exposes for
+// videos and files; missing fields stay zero.
+func parseAttachment(c *wireContents, video bool) *Attachment {
+	a := &Attachment{
+		FileName: first(c.fileName, c.filename, c.title).String(),
+		Size:     first(c.fileSize, c.totalLen, c.size, c.length).Int64(),
+	}
+	if video {
+		a.Duration = int(first(c.playLength, c.duration, c.videoLength).Int64())
+	}
+	if *a == (Attachment{}) {
 		return nil
 	}
+	return a
+}
+
+func parseReference(r *wireReference) *Reference {
 	ref := &Reference{
-		Seq:        toInt64(m["seq"]),
-		Time:       toString(m["time"]),
-		Talker:     toString(m["talker"]),
-		TalkerName: toString(m["talkerName"]),
-		Sender:     toString(m["sender"]),
-		SenderName: toString(m["senderName"]),
-		Type:       int(toInt64(firstNonEmpty(m["type"], m["msgType"]))),
-		SubType:    int(toInt64(m["subType"])),
-		Content:    toString(firstNonEmpty(m["content"], m["text"], m["message"])),
+		Seq:        r.seq.Int64(),
+		Time:       r.time.String(),
+		Talker:     r.talker.String(),
+		TalkerName: r.talkerName.String(),
+		Sender:     r.sender.String(),
+		SenderName: r.senderName.String(),
+		Type:       int(first(r.typ, r.msgType).Int64()),
+		SubType:    int(r.subType.Int64()),
+		Content:    first(r.content, r.text, r.message).String(),
 	}
 	if ref.Seq == 0 && ref.Time == "" && ref.Sender == "" && ref.SenderName == "" && ref.Content == "" {
 		return nil
@@ -387,19 +978,3 @@ func normalizeSpaces(s string) string {
 	}
 	return spaceReplacer.Replace(s)
 }
-
-func firstNonEmpty(vals ...any) any {
-	for _, v := range vals {
-		switch t := v.(type) {
-		case nil:
-			continue
-		case string:
-			if strings.TrimSpace(t) != "" {
-				return v
-			}
-		default:
-			return v
-		}
-	}
-	return nil
-}
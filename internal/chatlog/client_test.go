@@ -0,0 +1,242 @@
+package chatlog
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeFieldVariants(t *testing.T) {
+	body := `{"total": 4, "data": [
+		{"_id": 7, "fromUser": "wxid_a", "displayName": " ", "senderNick": "阿明", "ts": "1700000000", "isSelf": "1", "isChatRoom": 1,
+		 "msgType": 49, "subType": 6, "text": "请问 @张三 [微笑]",
+		 "contents": {"fileName": "方案.pdf", "totalLen": "2048", "refer": {"seq": 5, "msgType": 1, "text": "原文"}},
+		 "avatar": "https://example.com/a.jpg"},
+		null,
+		{"msgType": 1, "content": "转义 \"引号\" 中", "contents": "不是对象", "appMsgInfo": {"title": "标题", "url": "https://example.com"}},
+		{"msgType": 43, "contents": {"playLength": 12, "refer": {}}}
+	], "next": null}`
+	msgs, meta, err := Client{}.Decode(bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("应跳过非对象元素，得到 %d 条", len(msgs))
+	}
+	if meta["total"] != json.Number("4") || meta["next"] != nil {
+		t.Fatalf("信封字段异常: %v", meta)
+	}
+
+	m := msgs[0]
+	if m.ID != "7" || m.Sender != "wxid_a" || m.SenderName != "阿明" || m.Timestamp != 1700000000 || !m.IsSelf || !m.IsChatRoom {
+		t.Fatalf("字段别名解析异常: %+v", m)
+	}
+	if !m.IsFile() || m.Attachment == nil || m.Attachment.FileName != "方案.pdf" || m.Attachment.Size != 2048 {
+		t.Fatalf("附件解析异常: %+v", m.Attachment)
+	}
+	if m.Reference == nil || m.Reference.Seq != 5 || m.Reference.Type != 1 || m.Reference.Content != "原文" {
+		t.Fatalf("引用解析异常: %+v", m.Reference)
+	}
+	if m.Content != "请问 @张三 [微笑]" || !m.IsQuestion || len(m.Mentions) != 1 || len(m.Emojis) != 1 {
+		t.Fatalf("正文派生字段异常: %+v", m)
+	}
+	if m.Extras["avatar"] != "https://example.com/a.jpg" {
+		t.Fatalf("未知字段应进入 Extras: %v", m.Extras)
+	}
+
+	if got := msgs[1].Content; got != `转义 "引号" 中` {
+		t.Fatalf("转义字符串解析异常: %q", got)
+	}
+	if s := msgs[1].Share; s == nil || s.Title != "标题" || s.URL != "https://example.com" {
+		t.Fatalf("appMsgInfo 分享解析异常: %+v", s)
+	}
+	if a := msgs[2].Attachment; a == nil || a.Duration != 12 || msgs[2].Reference != nil {
+		t.Fatalf("视频解析异常: %+v %+v", a, msgs[2].Reference)
+	}
+}
+
+func TestDecodeTruncates(t *testing.T) {
+	msgs, meta, err := Client{MaxMessages: 2}.Decode(bytes.NewReader(largeDay(5)))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(msgs) != 2 || meta["truncated"] != true || meta["totalMessages"] != 5 {
+		t.Fatalf("截断异常: %d 条, %v", len(msgs), meta)
+	}
+}
+
+func TestFetchDayDecompresses(t *testing.T) {
+	body := largeDay(50)
+	for _, enc := range []string{"", "gzip", "deflate", "raw-deflate"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				t.Errorf("请求未声明 Accept-Encoding: %q", r.Header.Get("Accept-Encoding"))
+			}
+			var zw io.WriteCloser
+			switch enc {
+			case "gzip":
+				w.Header().Set("Content-Encoding", "gzip")
+				zw = gzip.NewWriter(w)
+			case "deflate":
+				w.Header().Set("Content-Encoding", "deflate")
+				zw = zlib.NewWriter(w)
+			case "raw-deflate":
+				w.Header().Set("Content-Encoding", "deflate")
+				zw, _ = flate.NewWriter(w, flate.DefaultCompression)
+			default:
+				_, _ = w.Write(body)
+				return
+			}
+			_, _ = zw.Write(body)
+			_ = zw.Close()
+		}))
+		msgs, _, err := Client{BaseURL: srv.URL}.FetchDay("2024-05-01", "123@chatroom", "")
+		srv.Close()
+		if err != nil || len(msgs) != 50 || msgs[49].Sender != "wxid_9" {
+			t.Fatalf("%s: 解压解析异常: %d 条, %v", enc, len(msgs), err)
+		}
+	}
+
+	// 大小上限按解压后的字节计算。
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+	}))
+	defer srv.Close()
+	_, _, err := Client{BaseURL: srv.URL, MaxResponseBytes: int64(len(body) / 2)}.FetchDay("2024-05-01", "123@chatroom", "")
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("应按解压后大小触发上限，得到 %v", err)
+	}
+}
+
+func TestFetchReportDayShiftsWindow(t *testing.T) {
+	days := map[string]string{
+		"2024-05-01": `[{"time":"2024-05-01T02:00:00+08:00","content":"前一天的深夜"},{"time":"2024-05-01T09:00:00+08:00","content":"早上"},{"content":"没有时间"}]`,
+		"2024-05-02": `[{"time":"2024-05-02T01:30:00+08:00","content":"凌晨还在聊"},{"time":"2024-05-02T04:00:00+08:00","content":"第二天"}]`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, days[r.URL.Query().Get("time")])
+	}))
+	defer srv.Close()
+	loc := time.Local
+	time.Local = time.FixedZone("CST", 8*3600)
+	defer func() { time.Local = loc }()
+
+	msgs, meta, err := Client{BaseURL: srv.URL}.FetchReportDayContext(context.Background(), "2024-05-01", 4, "123@chatroom", "")
+	if err != nil {
+		t.Fatalf("抓取失败: %v", err)
+	}
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.Content)
+	}
+	if strings.Join(got, "|") != "早上|没有时间|凌晨还在聊" || meta["truncated"] != nil {
+		t.Fatalf("日界切分异常: %v, %v", got, meta)
+	}
+
+	msgs, meta, _ = Client{BaseURL: srv.URL, MaxMessages: 2}.FetchReportDayContext(context.Background(), "2024-05-01", 4, "123@chatroom", "")
+	if len(msgs) != 2 || meta["truncated"] != true || meta["totalMessages"] != 3 {
+		t.Fatalf("截断异常: %d 条, %v", len(msgs), meta)
+	}
+}
+
+func TestFetchReportDayTruncatesWindowNotCalendarDay(t *testing.T) {
+	days := map[string]string{
+		"2024-05-01": `[{"time":"2024-05-01T01:00:00+08:00","content":"a"},{"time":"2024-05-01T02:00:00+08:00","content":"b"},{"time":"2024-05-01T03:00:00+08:00","content":"c"},{"time":"2024-05-01T10:00:00+08:00","content":"d"},{"time":"2024-05-01T20:00:00+08:00","content":"e"}]`,
+		"2024-05-02": `[{"time":"2024-05-02T01:00:00+08:00","content":"f"},{"time":"2024-05-02T05:00:00+08:00","content":"g"}]`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, days[r.URL.Query().Get("time")])
+	}))
+	defer srv.Close()
+	loc := time.Local
+	time.Local = time.FixedZone("CST", 8*3600)
+	defer func() { time.Local = loc }()
+
+	// 每个自然日都超过 MaxMessages：先截断再切分会只剩凌晨的消息。
+	msgs, meta, err := Client{BaseURL: srv.URL, MaxMessages: 2}.FetchReportDayContext(context.Background(), "2024-05-01", 4, "123@chatroom", "")
+	if err != nil {
+		t.Fatalf("抓取失败: %v", err)
+	}
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.Content)
+	}
+	if strings.Join(got, "|") != "d|e" {
+		t.Fatalf("应保留窗口内最早的消息: %v", got)
+	}
+	if meta["truncated"] != true || meta["totalMessages"] != 3 || meta["keptMessages"] != 2 {
+		t.Fatalf("丢弃数应只计窗口内的消息: %v", meta)
+	}
+
+	msgs, meta, _ = Client{BaseURL: srv.URL, MaxMessages: 3}.FetchReportDayContext(context.Background(), "2024-05-01", 4, "123@chatroom", "")
+	if len(msgs) != 3 || meta["truncated"] != nil {
+		t.Fatalf("窗口未超出上限时不应截断: %d 条, %v", len(msgs), meta)
+	}
+}
+
+// largeDay is a chatlog response of n messages shaped like a busy group
+// day: mostly text, some replies and images.
+func largeDay(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"total":`)
+	fmt.Fprint(&b, n)
+	b.WriteString(`,"data":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"seq":%d,"time":"2024-05-01T10:%02d:%02d+08:00","talker":"123@chatroom","talkerName":"测试群","sender":"wxid_%d","senderName":"成员%d","isChatRoom":true,"type":1,"subType":0,"content":"第 %d 条消息，讨论一下部署流程和监控告警 @成员%d [微笑]"`,
+			1714528800000+int64(i), i/60%60, i%60, i%40, i%40, i, (i+1)%40)
+		switch i % 10 {
+		case 3:
+			fmt.Fprintf(&b, `,"contents":{"refer":{"seq":%d,"sender":"wxid_1","senderName":"成员1","type":1,"content":"上一条"}}`, i-1)
+		case 7:
+			b.WriteString(`,"contents":{"md5":"0123456789abcdef0123456789abcdef","path":"msg/attach/img.dat"}`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
+
+func BenchmarkDecode(b *testing.B) {
+	body := largeDay(50000)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := (Client{}).Decode(bytes.NewReader(body)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeGeneric decodes the same day into generic maps, the way
+// responses were parsed before decoding straight into Message; compare its
+// allocs/op with BenchmarkDecode.
+func BenchmarkDecodeGeneric(b *testing.B) {
+	body := largeDay(50000)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v map[string]any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
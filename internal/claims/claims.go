@@ -0,0 +1,271 @@
+// Package claims turns unanswered questions into lightweight tickets: a
+// question can be assigned to someone and later marked resolved. States are
+// persisted as one JSON file (data/claims.json) shared by the API server
+// and the static generator.
+//
+// Each update takes a lock file next to it (claims.json.lock), re-reads the
+// file, applies the change and replaces the file atomically, so concurrent
+// writers, whether goroutines or processes, never drop each other's updates
+// and readers never see a partial file. Reads pick up other processes'
+// writes when the file changes on disk.
+package claims
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// Statuses a claim moves through.
+const (
+	StatusAssigned = "assigned"
+	StatusResolved = "resolved"
+)
+
+// ErrInvalidID is returned for ids that are not summarize.ReplyID values.
+var ErrInvalidID = errors.New("invalid question id")
+
+var idRegexp = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// ErrLocked is returned when another writer held the lock for lockWait.
+var ErrLocked = errors.New("claims file is locked by another writer")
+
+// lockWait bounds how long an update waits for the lock file; a lock older
+// than staleLock was left by a crashed writer and is taken over.
+const (
+	lockWait  = 5 * time.Second
+	staleLock = 30 * time.Second
+)
+
+// Claim is the workflow state of one question.
+type Claim struct {
+	ID         string `json:"id"`
+	Date       string `json:"date,omitempty"`
+	Question   string `json:"question,omitempty"`
+	Status     string `json:"status"`
+	Assignee   string `json:"assignee,omitempty"`
+	AssignedAt string `json:"assignedAt,omitempty"`
+	ResolvedBy string `json:"resolvedBy,omitempty"`
+	ResolvedAt string `json:"resolvedAt,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// Store is a file-backed set of claims, safe for concurrent use.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	claims  map[string]Claim
+	modTime time.Time // of the file claims were read from
+	size    int64
+}
+
+// Open loads the store at path; a missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now, claims: map[string]Claim{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replaces the claims with the file's; callers hold mu.
+func (s *Store) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.claims, s.modTime, s.size = map[string]Claim{}, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []Claim
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	claims := make(map[string]Claim, len(list))
+	for _, c := range list {
+		claims[c.ID] = c
+	}
+	s.claims, s.modTime, s.size = claims, info.ModTime(), info.Size()
+	return nil
+}
+
+// refresh reloads the file if another writer changed it since it was
+// read, keeping the current claims when that fails; callers hold mu.
+func (s *Store) refresh() {
+	info, err := os.Stat(s.path)
+	if err != nil || (info.ModTime().Equal(s.modTime) && info.Size() == s.size) {
+		return
+	}
+	_ = s.load()
+}
+
+// Get returns the claim for id.
+func (s *Store) Get(id string) (Claim, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	c, ok := s.claims[id]
+	return c, ok
+}
+
+// List returns the claims of day, or all claims when day is empty, newest
+// activity first.
+func (s *Store) List(day string) []Claim {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	out := make([]Claim, 0, len(s.claims))
+	for _, c := range s.claims {
+		if day == "" || c.Date == day {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := out[i].updatedAt(), out[j].updatedAt(); a != b {
+			return a > b
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// ByID returns the claims of day keyed by question id, for rendering.
+func (s *Store) ByID(day string) map[string]Claim {
+	out := map[string]Claim{}
+	for _, c := range s.List(day) {
+		out[c.ID] = c
+	}
+	return out
+}
+
+// Assign hands the question to assignee, reopening it if it was resolved.
+// date and question describe the question for listing and are kept from
+// earlier calls when empty.
+func (s *Store) Assign(id, assignee, date, question string) (Claim, error) {
+	if assignee == "" {
+		return Claim{}, errors.New("assignee is required")
+	}
+	return s.update(id, func(c *Claim) {
+		c.Status = StatusAssigned
+		c.Assignee = assignee
+		c.AssignedAt = s.now().Format(time.RFC3339)
+		c.ResolvedBy, c.ResolvedAt, c.Note = "", "", ""
+		if date != "" {
+			c.Date = date
+		}
+		if question != "" {
+			c.Question = question
+		}
+	})
+}
+
+// Resolve marks the question done. by defaults to the assignee.
+func (s *Store) Resolve(id, by, note string) (Claim, error) {
+	return s.update(id, func(c *Claim) {
+		if by == "" {
+			by = c.Assignee
+		}
+		c.Status = StatusResolved
+		c.ResolvedBy = by
+		c.ResolvedAt = s.now().Format(time.RFC3339)
+		c.Note = note
+	})
+}
+
+func (s *Store) update(id string, apply func(*Claim)) (Claim, error) {
+	if !idRegexp.MatchString(id) {
+		return Claim{}, ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return Claim{}, err
+	}
+	defer unlock()
+	if err := s.load(); err != nil {
+		return Claim{}, err
+	}
+	c, ok := s.claims[id]
+	if !ok {
+		c = Claim{ID: id}
+	}
+	apply(&c)
+	prev, existed := s.claims[id]
+	s.claims[id] = c
+	if err := s.save(); err != nil {
+		if existed {
+			s.claims[id] = prev
+		} else {
+			delete(s.claims, id)
+		}
+		return Claim{}, err
+	}
+	return c, nil
+}
+
+// lock creates the lock file, waiting up to lockWait for another writer to
+// remove it, and returns the function that releases it.
+func (s *Store) lock() (func(), error) {
+	p := s.path + ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(p) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(p); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(p)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// save writes all claims atomically and notes the file it wrote; callers
+// hold mu and the lock.
+func (s *Store) save() error {
+	list := make([]Claim, 0, len(s.claims))
+	for _, c := range s.claims {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(s.path, data); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+func (c Claim) updatedAt() string {
+	if c.ResolvedAt > c.AssignedAt {
+		return c.ResolvedAt
+	}
+	return c.AssignedAt
+}
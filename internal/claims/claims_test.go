@@ -0,0 +1,117 @@
+package claims
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAssignResolvePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	s.now = func() time.Time { return time.Date(2025, 10, 16, 9, 0, 0, 0, time.UTC) }
+	if _, err := s.Assign("0123456789ab", "alice", "2025-10-15", "怎么部署？"); err != nil {
+		t.Fatalf("认领失败: %v", err)
+	}
+	if _, err := s.Resolve("0123456789ab", "", "已回复"); err != nil {
+		t.Fatalf("标记解决失败: %v", err)
+	}
+	if _, err := s.Assign("../../etc", "bob", "", ""); err != ErrInvalidID {
+		t.Fatalf("期望 ErrInvalidID，得到 %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	c, ok := reopened.Get("0123456789ab")
+	if !ok || c.Status != StatusResolved || c.ResolvedBy != "alice" || c.Question != "怎么部署？" {
+		t.Fatalf("持久化结果异常: %+v", c)
+	}
+	if got := reopened.ByID("2025-10-15"); len(got) != 1 {
+		t.Fatalf("按日期筛选异常: %+v", got)
+	}
+}
+
+func TestConcurrentWritersKeepEveryClaim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	// Two stores on one file stand in for the API server and another
+	// process writing at the same time.
+	a, err := Open(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		s := a
+		if i%2 == 1 {
+			s = b
+		}
+		wg.Add(1)
+		go func(s *Store, i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("%012x", i)
+			if _, err := s.Assign(id, fmt.Sprintf("user%d", i), "2025-10-16", ""); err != nil {
+				errs <- err
+				return
+			}
+			if i%4 == 0 {
+				if _, err := s.Resolve(id, "", "done"); err != nil {
+					errs <- err
+				}
+			}
+		}(s, i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("并发写入失败: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	for _, s := range []*Store{reopened, a, b} {
+		if got := s.List(""); len(got) != 40 {
+			t.Fatalf("期望 40 条认领，得到 %d", len(got))
+		}
+	}
+	for i := 0; i < 40; i += 4 {
+		if c, _ := reopened.Get(fmt.Sprintf("%012x", i)); c.Status != StatusResolved || c.ResolvedBy != fmt.Sprintf("user%d", i) {
+			t.Fatalf("解决状态丢失: %+v", c)
+		}
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("锁文件未释放: %v", err)
+	}
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if err := os.WriteFile(path+".lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Assign("0123456789ab", "alice", "", ""); err != nil {
+		t.Fatalf("残留锁未被接管: %v", err)
+	}
+}
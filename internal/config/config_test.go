@@ -0,0 +1,289 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "report.config.json")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	return p
+}
+
+func TestLoadProfileMergesOverBase(t *testing.T) {
+	p := writeConfig(t, `{
+		"chatlog": {"baseURL": "http://127.0.0.1:5030", "talker": "a@chatroom"},
+		"llm": {"enabled": true, "model": "base"},
+		"profiles": {"prod": {"chatlog": {"baseURL": "http://10.0.0.5:5030"}, "llm": {"model": "prod"}}}
+	}`)
+	cfg, err := LoadProfile(p, "prod")
+	if err != nil {
+		t.Fatalf("加载 profile 失败: %v", err)
+	}
+	if cfg.Chatlog.BaseURL != "http://10.0.0.5:5030" || cfg.Chatlog.Talker != "a@chatroom" {
+		t.Fatalf("chatlog 合并异常: %+v", cfg.Chatlog)
+	}
+	if !cfg.LLM.Enabled || cfg.LLM.Model != "prod" {
+		t.Fatalf("llm 合并异常: %+v", cfg.LLM)
+	}
+
+	base, err := Load(p)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if base.LLM.Model != "base" {
+		t.Fatalf("未指定 profile 时不应合并: %+v", base.LLM)
+	}
+}
+
+func TestLoadProfileUnknown(t *testing.T) {
+	p := writeConfig(t, `{"profiles": {"dev": {}, "prod": {}}}`)
+	_, err := LoadProfile(p, "staging")
+	if err == nil || !strings.Contains(err.Error(), "dev, prod") {
+		t.Fatalf("期望提示可用 profile，得到 %v", err)
+	}
+}
+
+func TestAPIAuthWithEnv(t *testing.T) {
+	env := map[string]string{
+		"WECHAT_VIEW_API_TOKENS": " t1 , ,t2",
+		"WECHAT_VIEW_API_USERS":  "alice:pa:ss,bob:pw",
+	}
+	base := APIAuthConfig{Tokens: []string{"cfg"}, Users: map[string]string{"bob": "old"}}
+	got, err := base.WithEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("读取环境变量失败: %v", err)
+	}
+	if strings.Join(got.Tokens, ",") != "cfg,t1,t2" || got.Users["alice"] != "pa:ss" || got.Users["bob"] != "pw" {
+		t.Fatalf("合并结果异常: %+v", got)
+	}
+	if base.Users["bob"] != "old" || len(base.Tokens) != 1 {
+		t.Fatalf("不应修改原配置: %+v", base)
+	}
+	if (APIAuthConfig{}).Enabled() || !got.Enabled() {
+		t.Fatal("Enabled 判断异常")
+	}
+	env["WECHAT_VIEW_API_USERS"] = "nopassword"
+	if _, err := base.WithEnv(func(k string) string { return env[k] }); err == nil {
+		t.Fatal("缺少密码应报错")
+	}
+}
+
+func TestLoadExpandsAndOverridesFromEnv(t *testing.T) {
+	p := writeConfig(t, `{
+		"llm": {"apiKey": "${TEST_LLM_KEY}", "baseURL": "${TEST_LLM_URL:-https://llm.example.com}", "model": "cost $$5 $5 $${X}"},
+		"notify": {"feishu": {"webhookURL": "https://open.feishu.cn/hook/${TEST_HOOK}"}},
+		"report": {"siteDir": "site", "disk": {"minfreemb": 100}}
+	}`)
+	t.Setenv("TEST_LLM_KEY", "sk-secret")
+	t.Setenv("TEST_HOOK", "abc")
+	t.Setenv("WECHAT_VIEW_REPORT_SITE_DIR", "/srv/site")
+	t.Setenv("WECHAT_VIEW_REPORT_DISK_MIN_FREE_MB", "512")
+	t.Setenv("WECHAT_VIEW_LLM_ENABLED", "true")
+	t.Setenv("WECHAT_VIEW_API_CORS_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("WECHAT_VIEW_NOT_A_FIELD", "ignored")
+
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if cfg.LLM.APIKey != "sk-secret" || cfg.LLM.BaseURL != "https://llm.example.com" || cfg.LLM.Model != "cost $$5 $5 ${X}" {
+		t.Fatalf("变量展开不对: %+v", cfg.LLM)
+	}
+	if cfg.Notify.Feishu.WebhookURL != "https://open.feishu.cn/hook/abc" {
+		t.Fatalf("webhook 展开不对: %q", cfg.Notify.Feishu.WebhookURL)
+	}
+	if cfg.Report.SiteDir != "/srv/site" || cfg.Report.Disk.MinFreeMB != 512 || !cfg.LLM.Enabled {
+		t.Fatalf("环境变量覆盖不对: %+v %+v", cfg.Report.SiteDir, cfg.Report.Disk)
+	}
+	if got := strings.Join(cfg.API.CORS.Origins, "|"); got != "https://a.example.com|https://b.example.com" {
+		t.Fatalf("列表覆盖不对: %q", got)
+	}
+
+	if _, err := Load(writeConfig(t, `{"llm": {"apiKey": "${TEST_UNSET_KEY}"}}`)); err == nil || !strings.Contains(err.Error(), "TEST_UNSET_KEY") {
+		t.Fatalf("未设置的变量应报错: %v", err)
+	}
+	t.Setenv("WECHAT_VIEW_REPORT_RECENT_DAYS", "many")
+	if _, err := Load(p); err == nil || !strings.Contains(err.Error(), "WECHAT_VIEW_REPORT_RECENT_DAYS") {
+		t.Fatalf("无效数值应报错: %v", err)
+	}
+}
+
+func TestUnknownKeysAndCheck(t *testing.T) {
+	p := writeConfig(t, `{
+		"chatlog": {"baseURL": "127.0.0.1:5030", "talkr": "x"},
+		"llm": {"enabled": true, "baseURL": "https://api.example.com/v1", "fallbackModels": [{"baseURL": "https://backup.example.com/v1"}], "guardrails": {"enabled": true, "action": "drop"}},
+		"notify": {"feishu": {"webhookURL": "https://open.feishu.cn/hook/x"}, "subscriptions": [{"name": "a", "keywords": ["发布"], "emial": {}}]},
+		"daemon": {"at": "8am"},
+		"profiles": {"prod": {"report": {"siteDir": "s", "bogus": 1}}}
+	}`)
+	unknown, err := UnknownKeys(p)
+	if err != nil {
+		t.Fatalf("检查未知字段失败: %v", err)
+	}
+	want := "chatlog.talkr|notify.subscriptions.0.emial|profiles.prod.report.bogus"
+	if got := strings.Join(unknown, "|"); got != want {
+		t.Fatalf("未知字段 = %q，期望 %q", got, want)
+	}
+
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	cfg.Defaults()
+	var fails, warns []string
+	for _, issue := range cfg.Check() {
+		if issue.Warning {
+			warns = append(warns, issue.Field)
+		} else {
+			fails = append(fails, issue.Field)
+		}
+	}
+	if got := strings.Join(fails, "|"); got != "chatlog.baseURL|chatlog.talker|daemon.at|llm.fallbackModels.0.model|llm.guardrails.action|llm.model" {
+		t.Fatalf("错误字段 = %q", got)
+	}
+	if got := strings.Join(warns, "|"); got != "llm.apiKey" {
+		t.Fatalf("警告字段 = %q", got)
+	}
+}
+
+func TestForTalkerAppliesProfile(t *testing.T) {
+	p := writeConfig(t, `{
+		"chatlog": {"talker": "old@chatroom", "keyword": "全局"},
+		"talkers": [
+			{"id": "a@chatroom", "label": "产品群", "keyword": "发布", "llm": {"model": "small", "systemPrompt": "只谈产品"}, "notify": {"feishu": {"webhookURL": "https://open.feishu.cn/hook/a"}}, "sections": {"hide": ["messages"]}},
+			{"id": "b@chatroom", "dir": "ops", "llm": {"disabled": true}}
+		],
+		"report": {"siteDir": "out", "theme": {"talkers": {"c@chatroom": {"mode": "dark"}}}},
+		"llm": {"enabled": true, "baseURL": "https://api.example.com/v1", "model": "big"},
+		"notify": {"talkers": {"c@chatroom": {"feishu": {"webhookURL": "https://open.feishu.cn/hook/c"}}}}
+	}`)
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if got := strings.Join(cfg.TalkerIDs(), ","); got != "a@chatroom,b@chatroom" {
+		t.Fatalf("TalkerIDs = %q", got)
+	}
+
+	a := cfg.ForTalker("a@chatroom")
+	if a.Chatlog.Talker != "a@chatroom" || a.Chatlog.Keyword != "发布" || a.TalkerLabel("a@chatroom") != "产品群" {
+		t.Fatalf("chatlog 未按群覆盖: %+v", a.Chatlog)
+	}
+	if !a.LLM.Enabled || a.LLM.Model != "small" || a.LLM.SystemPrompt != "只谈产品" {
+		t.Fatalf("llm 未按群覆盖: %+v", a.LLM)
+	}
+	if a.Notify.TargetsFor("a@chatroom").Feishu.WebhookURL != "https://open.feishu.cn/hook/a" || len(a.Notify.Talkers) != 2 {
+		t.Fatalf("通知目标异常: %+v", a.Notify.Talkers)
+	}
+	if len(cfg.Notify.Talkers) != 1 {
+		t.Fatal("ForTalker 不应修改原配置的 map")
+	}
+	if got := a.Report.Sections.For("a@chatroom").Hide; len(got) != 1 || got[0] != "messages" {
+		t.Fatalf("sections = %v", got)
+	}
+	if a.Report.DataDir != filepath.Join("data", "a@chatroom") || a.Report.SiteDir != filepath.Join("out", "a@chatroom") {
+		t.Fatalf("输出目录 = %s, %s", a.Report.DataDir, a.Report.SiteDir)
+	}
+
+	b := cfg.ForTalker("b@chatroom")
+	if b.LLM.Enabled || b.Chatlog.Keyword != "全局" || b.Report.SiteDir != filepath.Join("out", "ops") {
+		t.Fatalf("b 群配置异常: %+v %+v", b.LLM, b.Report.SiteDir)
+	}
+	if other := cfg.ForTalker("x@chatroom"); other.Chatlog.Talker != "x@chatroom" || other.Report.SiteDir != "out" {
+		t.Fatalf("不在列表中的群应沿用全局配置: %+v", other.Report)
+	}
+}
+
+func TestSectionsForTalker(t *testing.T) {
+	p := writeConfig(t, `{"report": {"sections": {
+		"hide": ["messages", "links"],
+		"talkers": {"a@chatroom": {"hide": ["vibes"]}, "b@chatroom": {"hide": []}}
+	}}}`)
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	s := cfg.Report.Sections
+	if got := strings.Join(s.For("x@chatroom").Hide, ","); got != "messages,links" {
+		t.Fatalf("默认隐藏 = %q", got)
+	}
+	// 群级配置整体替换默认值，而不是合并
+	if got := strings.Join(s.For("a@chatroom").Hide, ","); got != "vibes" {
+		t.Fatalf("a 群隐藏 = %q", got)
+	}
+	if got := s.For("b@chatroom").Hide; len(got) != 0 {
+		t.Fatalf("空列表应显示全部区块: %v", got)
+	}
+}
+
+func TestCheckTalkers(t *testing.T) {
+	cfg := Config{Talkers: []TalkerConfig{
+		{ID: "a@chatroom"},
+		{ID: "a@chatroom", Dir: "a2"},
+		{ID: "b", Dir: "../b"},
+		{ID: "c", Dir: "a@chatroom"},
+		{Label: "无 id"},
+	}}
+	cfg.Defaults()
+	var fails []string
+	for _, issue := range cfg.Check() {
+		if !issue.Warning && strings.HasPrefix(issue.Field, "talkers") || issue.Field == "chatlog.talker" {
+			fails = append(fails, issue.Field)
+		}
+	}
+	if got := strings.Join(fails, "|"); got != "talkers.1.id|talkers.2.dir|talkers.3.dir|talkers.4.id" {
+		t.Fatalf("错误字段 = %q", got)
+	}
+}
+
+func TestCheckACME(t *testing.T) {
+	fields := func(tls APITLSConfig) string {
+		var c Config
+		c.API.TLS = tls
+		var got []string
+		for _, issue := range c.Check() {
+			if strings.HasPrefix(issue.Field, "api.tls") {
+				got = append(got, issue.Field)
+			}
+		}
+		return strings.Join(got, "|")
+	}
+	if got := fields(APITLSConfig{ACME: APIACMEConfig{Hosts: []string{"chat.example.com"}, Email: "ops@example.com"}}); got != "" {
+		t.Fatalf("合法 ACME 配置报错: %q", got)
+	}
+	if got := fields(APITLSConfig{ACME: APIACMEConfig{Hosts: []string{"*.example.com"}, DirectoryURL: "acme.example.com"}}); got != "api.tls.acme.directoryURL|api.tls.acme.hosts" {
+		t.Fatalf("通配符与目录地址未拦截: %q", got)
+	}
+	if got := fields(APITLSConfig{ACME: APIACMEConfig{Email: "ops@example.com"}}); got != "api.tls.acme" {
+		t.Fatalf("缺少 hosts 未拦截: %q", got)
+	}
+}
+
+func TestCheckTheme(t *testing.T) {
+	var c Config
+	c.Report.Theme = ThemeConfig{
+		Theme: Theme{Mode: "dark", Accent: "#e4572e", Light: map[string]string{"bg": "#fff"}},
+		Talkers: map[string]Theme{"a@chatroom": {
+			Mode:   "sepia",
+			Accent: "red}",
+			Dark:   map[string]string{"--bg": "#000", "fg": "red;x"},
+		}},
+	}
+	var got []string
+	for _, issue := range c.Check() {
+		if strings.HasPrefix(issue.Field, "report.theme") {
+			got = append(got, issue.Field)
+		}
+	}
+	want := "report.theme.talkers.a@chatroom.accent|report.theme.talkers.a@chatroom.dark|report.theme.talkers.a@chatroom.dark.fg|report.theme.talkers.a@chatroom.mode"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("主题错误字段 = %q", strings.Join(got, "|"))
+	}
+}
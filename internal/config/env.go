@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that override config fields,
+// e.g. WECHAT_VIEW_LLM_API_KEY for llm.apiKey.
+const EnvPrefix = "WECHAT_VIEW_"
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in every string value of v
+// with the environment variable, so secrets can stay out of the file. Only
+// "${" starts a reference: any other "$", including "$$", is kept as is, so
+// existing values such as passwords load unchanged. "$${" writes a literal
+// "${". A variable that is unset and has no default is an error rather than
+// silently becoming "".
+func expandEnv(v any, lookup func(string) (string, bool)) (any, error) {
+	switch x := v.(type) {
+	case string:
+		return expandString(x, lookup)
+	case map[string]any:
+		for k, item := range x {
+			out, err := expandEnv(item, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			x[k] = out
+		}
+	case []any:
+		for i, item := range x {
+			out, err := expandEnv(item, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			x[i] = out
+		}
+	}
+	return v, nil
+}
+
+func expandString(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDef := strings.Cut(ref, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in %q", s)
+		}
+		val, ok := lookup(name)
+		switch {
+		case ok && val != "":
+		case hasDef:
+			val = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(val)
+		i += end
+	}
+	return b.String(), nil
+}
+
+// applyEnvOverrides sets fields of doc from WECHAT_VIEW_* variables in
+// environ ("KEY=value" pairs). The words after the prefix name the JSON path
+// case-insensitively, with underscores also allowed inside a key:
+// WECHAT_VIEW_REPORT_DISK_MIN_FREE_MB sets report.disk.minFreeMB. Values are
+// parsed by the field type; string lists are comma-separated and maps,
+// objects and object lists take JSON. Variables that match no field are
+// ignored, since other WECHAT_VIEW_* variables exist (see APIAuthConfig).
+func applyEnvOverrides(doc map[string]any, environ []string) error {
+	vars := map[string]string{}
+	for _, kv := range environ {
+		name, val, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(name, EnvPrefix) && len(name) > len(EnvPrefix) {
+			vars[name] = val
+		}
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		words := strings.Split(strings.TrimPrefix(name, EnvPrefix), "_")
+		path, t, ok := envPath(reflect.TypeOf(Config{}), words)
+		if !ok {
+			continue
+		}
+		val, err := envValue(t, vars[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		setPath(doc, path, val)
+	}
+	return nil
+}
+
+// envPath resolves words to a JSON path in t, preferring the longest key
+// at each level, and returns the type of the field it ends at.
+func envPath(t reflect.Type, words []string) ([]string, reflect.Type, bool) {
+	if len(words) == 0 {
+		return nil, t, true
+	}
+	fields := jsonFields(t)
+	if fields == nil {
+		return nil, nil, false
+	}
+	for n := len(words); n > 0; n-- {
+		want := strings.ToLower(strings.Join(words[:n], ""))
+		for _, f := range fields {
+			if strings.ToLower(strings.ReplaceAll(f.key, "_", "")) != want {
+				continue
+			}
+			if rest, ft, ok := envPath(f.typ, words[n:]); ok {
+				return append([]string{f.key}, rest...), ft, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+type jsonField struct {
+	key string
+	typ reflect.Type
+}
+
+// jsonFields lists the JSON keys of struct type t the way encoding/json
+// sees them, with the fields of untagged embedded structs promoted. It
+// returns nil when t is not a struct.
+func jsonFields(t reflect.Type) []jsonField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	out := []jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		switch {
+		case tag == "-":
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			out = append(out, jsonFields(f.Type)...)
+		case !f.IsExported():
+		case name != "":
+			out = append(out, jsonField{name, f.Type})
+		default:
+			out = append(out, jsonField{f.Name, f.Type})
+		}
+	}
+	return out
+}
+
+// envValue converts s to the JSON value of a field of type t.
+func envValue(t reflect.Type, s string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("want true or false, got %q", s)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		s = strings.TrimSpace(s)
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("want a number, got %q", s)
+		}
+		return json.Number(s), nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(s), "[") {
+			out := []any{}
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					out = append(out, item)
+				}
+			}
+			return out, nil
+		}
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("want JSON: %w", err)
+	}
+	return v, nil
+}
+
+// setPath sets doc[path[0]][path[1]]... = val, creating objects on the way.
+// Keys match case-insensitively like encoding/json, so "apikey" in the file
+// is replaced rather than left to compete with "apiKey".
+func setPath(doc map[string]any, path []string, val any) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := doc[foldKey(doc, key)].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			delete(doc, foldKey(doc, key))
+			doc[key] = next
+		}
+		doc = next
+	}
+	last := path[len(path)-1]
+	delete(doc, foldKey(doc, last))
+	doc[last] = val
+}
+
+// foldKey returns the key of doc equal to key under case folding, or key.
+func foldKey(doc map[string]any, key string) string {
+	if _, ok := doc[key]; ok {
+		return key
+	}
+	for k := range doc {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
+}
@@ -0,0 +1,517 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"wechat-view/internal/i18n"
+)
+
+// themeVarRegexp matches the CSS variable names report.theme may set.
+var themeVarRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Issue is one problem found by Check.
+type Issue struct {
+	// Field is the JSON path, e.g. "llm.baseURL".
+	Field   string
+	Message string
+	// Warning marks issues that do not stop a run.
+	Warning bool
+}
+
+func (i Issue) String() string {
+	return i.Field + ": " + i.Message
+}
+
+// UnknownKeys returns the JSON paths in the config file at path, profiles
+// included, that match no config field. They are usually typos, which
+// encoding/json would otherwise drop without a word.
+func UnknownKeys(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	var out []string
+	cfgType := reflect.TypeOf(Config{})
+	for key, v := range doc {
+		if key != "profiles" {
+			continue
+		}
+		profiles, _ := v.(map[string]any)
+		for name, p := range profiles {
+			unknownKeys(p, cfgType, "profiles."+name+".", &out)
+		}
+		delete(doc, key)
+	}
+	unknownKeys(doc, cfgType, "", &out)
+	sort.Strings(out)
+	return out, nil
+}
+
+func unknownKeys(v any, t reflect.Type, prefix string, out *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, item := range obj {
+			var match *jsonField
+			for i := range fields {
+				if strings.EqualFold(fields[i].key, key) {
+					match = &fields[i]
+					break
+				}
+			}
+			if match == nil {
+				*out = append(*out, prefix+key)
+				continue
+			}
+			unknownKeys(item, match.typ, prefix+key+".", out)
+		}
+	case reflect.Map:
+		obj, _ := v.(map[string]any)
+		for key, item := range obj {
+			unknownKeys(item, t.Elem(), prefix+key+".", out)
+		}
+	case reflect.Slice, reflect.Array:
+		list, _ := v.([]any)
+		for i, item := range list {
+			unknownKeys(item, t.Elem(), fmt.Sprintf("%s%d.", prefix, i), out)
+		}
+	}
+}
+
+// Check reports missing and malformed values in c, which should already
+// have Defaults applied. It does not touch the network; see cmd/report
+// validate-config for the connectivity checks.
+func (c Config) Check() []Issue {
+	var issues []Issue
+	fail := func(field, format string, args ...any) {
+		issues = append(issues, Issue{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(field, format string, args ...any) {
+		issues = append(issues, Issue{Field: field, Message: fmt.Sprintf(format, args...), Warning: true})
+	}
+	checkURL := func(field, raw string) {
+		if raw == "" {
+			return
+		}
+		if err := httpURL(raw); err != nil {
+			fail(field, "%v", err)
+		}
+	}
+
+	checkURL("chatlog.baseURL", c.Chatlog.BaseURL)
+	checkURL("chatlog.imageBaseURL", c.Chatlog.ImageBaseURL)
+	if strings.TrimSpace(c.Chatlog.Talker) == "" && len(c.Talkers) == 0 {
+		fail("chatlog.talker", "not set; use the chatroom id (e.g. 123@chatroom) or wxid to report on, list rooms in talkers, or pass --talker on every run")
+	}
+	if c.Chatlog.MaxMessages < 0 || c.Chatlog.MaxResponseMB < 0 {
+		fail("chatlog", "maxMessages and maxResponseMB must not be negative")
+	}
+
+	if c.LLM.Enabled {
+		if c.LLM.BaseURL == "" {
+			fail("llm.baseURL", "required when llm.enabled is true, e.g. https://api.openai.com/v1")
+		}
+		checkURL("llm.baseURL", c.LLM.BaseURL)
+		if strings.TrimSpace(c.LLM.Model) == "" {
+			fail("llm.model", "required when llm.enabled is true")
+		}
+		if c.LLM.APIKey == "" {
+			warn("llm.apiKey", "empty; fine for local models, hosted APIs will answer 401")
+		}
+		if c.LLM.Temperature < 0 || c.LLM.Temperature > 2 {
+			warn("llm.temperature", "%g is outside 0-2", c.LLM.Temperature)
+		}
+		for _, p := range c.LLM.Scrub.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				fail("llm.scrub.patterns", "%q: %v", p, err)
+			}
+		}
+		for i, f := range c.LLM.FallbackModels {
+			field := fmt.Sprintf("llm.fallbackModels.%d", i)
+			checkURL(field+".baseURL", f.BaseURL)
+			if strings.TrimSpace(f.Model) == "" {
+				fail(field+".model", "required")
+			}
+		}
+		if c.LLM.Compare.Enabled {
+			checkURL("llm.compare.baseURL", c.LLM.Compare.BaseURL)
+			if c.LLM.Compare.Label == c.LLM.Label {
+				fail("llm.compare.label", "must differ from llm.label (%q)", c.LLM.Label)
+			}
+		}
+	} else if c.LLM.Compare.Enabled {
+		warn("llm.compare.enabled", "has no effect while llm.enabled is false")
+	}
+	if gr := c.LLM.Guardrails; gr.Enabled {
+		if gr.Action != "reject" && gr.Action != "flag" {
+			fail("llm.guardrails.action", "%q is not reject or flag", gr.Action)
+		}
+		if gr.MaxBulletRunes < 0 {
+			fail("llm.guardrails.maxBulletRunes", "must not be negative")
+		}
+	}
+	if m := c.LLM.MapReduce; m.Enabled && (m.ChunkMessages < 0 || m.MaxChunks < 0) {
+		fail("llm.mapReduce", "chunkMessages and maxChunks must not be negative")
+	}
+	for model, p := range c.LLM.Pricing.Models {
+		if p.Prompt < 0 || p.Completion < 0 {
+			fail("llm.pricing.models."+model, "prices must not be negative")
+		}
+	}
+	if e := c.LLM.Embeddings; e.Enabled {
+		if e.BaseURL == "" && c.LLM.BaseURL == "" {
+			fail("llm.embeddings.baseURL", "required when neither it nor llm.baseURL is set")
+		}
+		checkURL("llm.embeddings.baseURL", e.BaseURL)
+		if strings.TrimSpace(e.Model) == "" {
+			fail("llm.embeddings.model", "required when llm.embeddings.enabled is true, e.g. text-embedding-3-small")
+		}
+		if e.Clusters < 0 || e.MaxMessages < 0 {
+			fail("llm.embeddings", "clusters and maxMessages must not be negative")
+		}
+	}
+
+	checkURL("report.assistant.apiBaseURL", c.Report.Assistant.APIBaseURL)
+	checkURL("notify.siteBaseURL", c.Notify.SiteBaseURL)
+	issues = append(issues, c.Notify.NotifyTargets.check("notify")...)
+	for _, talker := range sortedTargetKeys(c.Notify.Talkers) {
+		issues = append(issues, c.Notify.Talkers[talker].check("notify.talkers."+talker)...)
+	}
+	for i, sub := range c.Notify.Subscriptions {
+		field := fmt.Sprintf("notify.subscriptions.%d", i)
+		if len(sub.Keywords) == 0 {
+			fail(field+".keywords", "empty; the subscription would never match")
+		}
+		issues = append(issues, sub.NotifyTargets.check(field)...)
+	}
+
+	for i, r := range c.Watchlist {
+		field := fmt.Sprintf("watchlist.%d", i)
+		if r.Threshold < 0 {
+			fail(field+".threshold", "must not be negative")
+		}
+		issues = append(issues, r.NotifyTargets.check(field)...)
+	}
+
+	if c.Daemon.At != "" {
+		if _, err := time.Parse("15:04", c.Daemon.At); err != nil {
+			fail("daemon.at", "%q is not HH:MM", c.Daemon.At)
+		}
+	}
+
+	if c.Report.Workers < 0 {
+		fail("report.workers", "must not be negative")
+	}
+	if h := c.Report.DayStartHour; h < 0 || h > 23 {
+		fail("report.dayStartHour", "%d is not an hour between 0 and 23", h)
+	}
+	checkRetention := func(field string, p RetentionPolicy) {
+		if p.CompressAfterDays < 0 {
+			fail(field+".compressAfterDays", "must not be negative")
+		}
+		if p.DeleteAfterDays < 0 {
+			fail(field+".deleteAfterDays", "must not be negative")
+		}
+		if p.CompressAfterDays > 0 && p.DeleteAfterDays > 0 && p.DeleteAfterDays <= p.CompressAfterDays {
+			warn(field+".deleteAfterDays", "%d is not after compressAfterDays (%d), so days are deleted without ever being compressed", p.DeleteAfterDays, p.CompressAfterDays)
+		}
+	}
+	checkRetention("report.retention", c.Report.Retention.RetentionPolicy)
+	for talker, p := range c.Report.Retention.Talkers {
+		checkRetention("report.retention.talkers."+talker, p)
+	}
+	checkTheme := func(field string, t Theme) {
+		switch t.Mode {
+		case "", "auto", "light", "dark":
+		default:
+			fail(field+".mode", "%q is not auto, light or dark", t.Mode)
+		}
+		if t.Accent != "" && strings.ContainsAny(t.Accent, ";{}<\n") {
+			fail(field+".accent", "%q is not a CSS color", t.Accent)
+		}
+		for _, palette := range []struct {
+			name string
+			vars map[string]string
+		}{{"light", t.Light}, {"dark", t.Dark}} {
+			for name, v := range palette.vars {
+				if !themeVarRegexp.MatchString(name) {
+					fail(field+"."+palette.name, "%q is not a CSS variable name (lowercase, without --)", name)
+				} else if strings.TrimSpace(v) == "" || strings.ContainsAny(v, ";{}<\n") {
+					fail(field+"."+palette.name+"."+name, "%q is not a CSS value", v)
+				}
+			}
+		}
+	}
+	if dir := c.Report.TemplatesDir; dir != "" {
+		if st, err := os.Stat(dir); err != nil {
+			fail("report.templatesDir", "%v", err)
+		} else if !st.IsDir() {
+			fail("report.templatesDir", "%s is not a directory", dir)
+		}
+	}
+	if lang := c.Report.Language; lang != "" && !slices.Contains(i18n.Languages(), lang) {
+		fail("report.language", "%q is not one of %s", lang, strings.Join(i18n.Languages(), ", "))
+	}
+	if f := c.Report.Charts.EChartsFile; f != "" {
+		if _, err := os.Stat(f); err != nil {
+			fail("report.charts.echartsFile", "%v", err)
+		}
+	}
+	checkTheme("report.theme", c.Report.Theme.Theme)
+	for talker, t := range c.Report.Theme.Talkers {
+		checkTheme("report.theme.talkers."+talker, t)
+	}
+	ids, dirs := map[string]bool{}, map[string]bool{}
+	for i, t := range c.Talkers {
+		field := fmt.Sprintf("talkers.%d", i)
+		if strings.TrimSpace(t.ID) == "" {
+			fail(field+".id", "not set; use the chatroom id or wxid")
+			continue
+		}
+		if ids[t.ID] {
+			fail(field+".id", "%s is listed twice", t.ID)
+		}
+		ids[t.ID] = true
+		if dir := t.Subdir(); !filepath.IsLocal(dir) || dir == "." {
+			fail(field+".dir", "%q is not a subdirectory name; set dir for ids that are not valid file names", dir)
+		} else if dirs[filepath.Clean(dir)] {
+			fail(field+".dir", "%s is used by another talker", dir)
+		} else {
+			dirs[filepath.Clean(dir)] = true
+		}
+		if t.LLM.Temperature < 0 {
+			fail(field+".llm.temperature", "must not be negative")
+		}
+		if t.Notify != nil {
+			issues = append(issues, t.Notify.check(field+".notify")...)
+		}
+		if t.Theme != nil {
+			checkTheme(field+".theme", *t.Theme)
+		}
+	}
+	if d := c.Report.Disk; !d.Disabled && d.WarnFreeMB < d.MinFreeMB {
+		warn("report.disk.warnFreeMB", "%d is below minFreeMB (%d), so no warning comes before runs stop", d.WarnFreeMB, d.MinFreeMB)
+	}
+
+	if r := c.Storage.Remote; r.Enabled {
+		if r.Endpoint == "" {
+			fail("storage.remote.endpoint", "required when storage.remote.enabled is set")
+		}
+		checkURL("storage.remote.endpoint", r.Endpoint)
+		if r.Bucket == "" {
+			fail("storage.remote.bucket", "required when storage.remote.enabled is set")
+		}
+		if r.AccessKeyID == "" || r.SecretAccessKey == "" {
+			fail("storage.remote", "set accessKeyID and secretAccessKey (or WECHAT_VIEW_STORAGE_REMOTE_SECRET_ACCESS_KEY)")
+		}
+		if r.Data && strings.Trim(r.SitePrefix, "/") == strings.Trim(r.DataPrefix, "/") {
+			fail("storage.remote.dataPrefix", "must differ from sitePrefix")
+		}
+		if r.TimeoutSeconds < 0 {
+			fail("storage.remote.timeoutSeconds", "must not be negative")
+		}
+	}
+
+	if g := c.Publish.Git; g.Enabled {
+		if g.Remote == "" {
+			fail("publish.git.remote", "required when publish.git.enabled is set")
+		}
+		if _, err := template.New("message").Parse(g.Message); err != nil {
+			fail("publish.git.message", "%v", err)
+		}
+		if g.TimeoutSeconds < 0 {
+			fail("publish.git.timeoutSeconds", "must not be negative")
+		}
+	}
+	if w := c.Publish.WebDAV; w.Enabled {
+		if w.URL == "" {
+			fail("publish.webdav.url", "required when publish.webdav.enabled is set")
+		}
+		checkURL("publish.webdav.url", w.URL)
+		if w.Username != "" && w.Password == "" {
+			warn("publish.webdav.password", "empty; set it or WECHAT_VIEW_PUBLISH_WEBDAV_PASSWORD")
+		}
+		if w.TimeoutSeconds < 0 {
+			fail("publish.webdav.timeoutSeconds", "must not be negative")
+		}
+	}
+	if s := c.Publish.SFTP; s.Enabled {
+		if s.Host == "" {
+			fail("publish.sftp.host", "required when publish.sftp.enabled is set")
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			fail("publish.sftp.port", "%d is not a port", s.Port)
+		}
+		if s.IdentityFile != "" {
+			if _, err := os.Stat(s.IdentityFile); err != nil {
+				fail("publish.sftp.identityFile", "%v", err)
+			}
+		}
+		if s.TimeoutSeconds < 0 {
+			fail("publish.sftp.timeoutSeconds", "must not be negative")
+		}
+	}
+
+	tls := c.API.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		fail("api.tls", "set both certFile and keyFile, or neither")
+	}
+	for field, p := range map[string]string{"api.tls.certFile": tls.CertFile, "api.tls.keyFile": tls.KeyFile} {
+		if p == "" {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			fail(field, "%v", err)
+		}
+	}
+	if a := tls.ACME; len(a.Hosts) > 0 {
+		if tls.CertFile != "" {
+			fail("api.tls.acme", "set either certFile/keyFile or acme.hosts, not both")
+		}
+		for _, h := range a.Hosts {
+			if h == "" || strings.ContainsAny(h, "*/: ") {
+				fail("api.tls.acme.hosts", "%q is not a plain host name (wildcards are not supported)", h)
+			}
+		}
+		if a.DirectoryURL != "" {
+			if err := httpURL(a.DirectoryURL); err != nil {
+				fail("api.tls.acme.directoryURL", "%v", err)
+			}
+		}
+		if a.Email != "" && !strings.Contains(a.Email, "@") {
+			fail("api.tls.acme.email", "%q is not an email address", a.Email)
+		}
+	} else if a.Email != "" || a.CacheDir != "" || a.DirectoryURL != "" || a.HTTPListen != "" {
+		fail("api.tls.acme", "set hosts to enable ACME")
+	}
+	for _, o := range c.API.CORS.Origins {
+		if o != "*" {
+			if err := httpURL(o); err != nil {
+				fail("api.cors.origins", "%q: %v", o, err)
+			}
+		}
+	}
+	if c.API.RateLimit.RequestsPerSecond < 0 || c.API.RateLimit.Burst < 0 {
+		fail("api.rateLimit", "requestsPerSecond and burst must not be negative")
+	}
+	if l := c.API.Live; l.Enabled {
+		if c.Chatlog.BaseURL == "" {
+			fail("api.live", "needs chatlog.baseURL to poll")
+		}
+		if len(l.Talkers) == 0 && len(c.TalkerIDs()) == 0 {
+			fail("api.live.talkers", "set talkers or chatlog.talker")
+		}
+		if l.IntervalSeconds < 0 || l.Backlog < 0 {
+			fail("api.live", "intervalSeconds and backlog must not be negative")
+		}
+	}
+	if c.API.Events.IntervalSeconds < 0 {
+		fail("api.events.intervalSeconds", "must not be negative")
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Field < issues[j].Field })
+	return issues
+}
+
+// check validates the channels of one set of notification targets.
+func (t NotifyTargets) check(prefix string) []Issue {
+	var issues []Issue
+	fail := func(field, format string, args ...any) {
+		issues = append(issues, Issue{Field: prefix + "." + field, Message: fmt.Sprintf(format, args...)})
+	}
+	for field, raw := range map[string]string{
+		"wecom.webhookURL":    t.WeCom.WebhookURL,
+		"dingtalk.webhookURL": t.DingTalk.WebhookURL,
+		"feishu.webhookURL":   t.Feishu.WebhookURL,
+	} {
+		if raw == "" {
+			continue
+		}
+		if err := httpURL(raw); err != nil {
+			fail(field, "%v", err)
+		}
+	}
+	switch e := t.Email; {
+	case e.Host == "" && len(e.To) > 0:
+		fail("email.host", "required when email.to is set")
+	case e.Host != "" && len(e.To) == 0:
+		issues = append(issues, Issue{Field: prefix + ".email.to", Message: "no recipients, so no email is sent", Warning: true})
+	case e.Host != "":
+		if e.From == "" {
+			fail("email.from", "required to send email")
+		}
+		if e.Port < 0 || e.Port > 65535 {
+			fail("email.port", "%d is not a port", e.Port)
+		}
+		switch e.TLS {
+		case "", "starttls", "tls", "none":
+		default:
+			fail("email.tls", "%q must be starttls, tls or none", e.TLS)
+		}
+	}
+	if m := t.MQTT; m.Broker != "" {
+		broker := m.Broker
+		if !strings.Contains(broker, "://") {
+			broker = "tcp://" + broker
+		}
+		u, err := url.Parse(broker)
+		switch {
+		case err != nil:
+			fail("mqtt.broker", "%v", err)
+		case u.Scheme != "tcp" && u.Scheme != "mqtt" && u.Scheme != "ssl" && u.Scheme != "tls" && u.Scheme != "mqtts":
+			fail("mqtt.broker", "scheme %q must be tcp, mqtt, ssl, tls or mqtts", u.Scheme)
+		case u.Host == "":
+			fail("mqtt.broker", "%q has no host", m.Broker)
+		}
+		if m.QoS != 0 && m.QoS != 1 {
+			fail("mqtt.qos", "%d must be 0 or 1", m.QoS)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Field < issues[j].Field })
+	return issues
+}
+
+func sortedTargetKeys(m map[string]NotifyTargets) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// httpURL reports why raw is not an absolute http(s) URL.
+func httpURL(raw string) error {
+	if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
+		return fmt.Errorf("%q needs an http:// or https:// scheme", raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a URL: %w", raw, err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	return nil
+}
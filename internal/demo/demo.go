@@ -0,0 +1,180 @@
+// Package demo produces a deterministic synthetic group chat in the chatlog
+// API's JSON shape, so the full pipeline can run without a chatlog service.
+package demo
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"wechat-view/internal/tags"
+)
+
+const (
+	// Talker is the chat room id used for demo data.
+	Talker = "demo@chatroom"
+	// TalkerName labels the demo group on rendered pages.
+	TalkerName = "示例 · AI 工程交流群"
+)
+
+// Tags are tag rules that match the demo conversation.
+var Tags = []tags.Rule{
+	{Name: "招聘", Patterns: []string{"招聘", "内推", "JD"}},
+	{Name: "故障", Patterns: []string{"报错", "挂了", "超时", "OOM"}},
+	{Name: "资源", Patterns: []string{"https?://", "论文", "开源"}},
+}
+
+type member struct{ id, name string }
+
+var members = []member{
+	{"wxid_demo_alice", "Alice｜后端"},
+	{"wxid_demo_bob", "老王"},
+	{"wxid_demo_carol", "Carol-算法"},
+	{"wxid_demo_dave", "大卫"},
+	{"wxid_demo_erin", "Erin 产品"},
+	{"wxid_demo_frank", "Frank"},
+	{"wxid_demo_grace", "小G"},
+	{"wxid_demo_heidi", "Heidi@运维"},
+}
+
+var questions = []string{
+	"有人在生产上跑过 vLLM 吗？显存怎么规划的？",
+	"RAG 的召回率大家一般怎么评估？",
+	"Agent 调工具老是超时，有什么排查思路？",
+	"Claude 和 GPT 写单测哪个更稳？",
+	"向量库选 Milvus 还是 pgvector？",
+	"长上下文模型真的能替代检索吗？",
+	"有没有靠谱的 prompt 版本管理工具？",
+}
+
+var answers = []string{
+	"我们是按 batch 大小预留 30% 显存，另外开了 prefix cache",
+	"先做一批人工标注的 query，算 recall@10，再看线上点击",
+	"先看是不是工具本身慢，再把超时和重试拆开配置",
+	"单测的话 Claude 更稳一些，边界条件考虑得多",
+	"数据量不大直接 pgvector，省一套运维",
+	"替代不了，成本和延迟都扛不住，检索还是要的",
+	"我们直接放 git 里，配合评测集做回归",
+}
+
+var chatter = []string{
+	"今天的分享很有收获[强]",
+	"同意楼上，关键还是评测集",
+	"周末有人去线下 meetup 吗？",
+	"刚升级完依赖，服务又报错了[捂脸]",
+	"线上又挂了一次，OOM，已经回滚",
+	"我们团队在招聘 LLM 应用工程师，欢迎内推",
+	"这个思路不错，回头试试",
+	"哈哈哈哈[呲牙]",
+	"收到",
+	"mark 一下，晚点细看",
+	"开源社区最近节奏好快",
+	"有没有人整理过今天的讨论？",
+}
+
+var shares = []struct{ title, desc, url string }{
+	{"Building effective agents", "A practical guide to agent design patterns", "https://www.anthropic.com/research/building-effective-agents"},
+	{"vLLM 官方文档", "Easy, fast, and cheap LLM serving", "https://docs.vllm.ai/"},
+	{"pgvector", "Open-source vector similarity search for Postgres", "https://github.com/pgvector/pgvector"},
+	{"RAG 评测实践", "从离线指标到线上 A/B", "https://example.com/rag-eval"},
+}
+
+// Days returns the n calendar days ending at last, oldest first.
+func Days(last time.Time, n int) []string {
+	out := make([]string, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		out = append(out, last.AddDate(0, 0, -i).Format("2006-01-02"))
+	}
+	return out
+}
+
+// Day returns a chatlog-style JSON array of messages for day. The same day
+// always yields the same conversation.
+func Day(day string) ([]byte, error) {
+	start, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid day %q: %w", day, err)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(day))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	// a core of regulars plus one or two members who drift in and out
+	active := members[:5+rng.Intn(len(members)-4)]
+	n := 40 + rng.Intn(60)
+	at := start.Add(8*time.Hour + time.Duration(rng.Intn(60))*time.Minute)
+	var records []map[string]any
+	var lastAsk map[string]any
+	seq := int64(0)
+	emit := func(m member, typ, sub int, content string, contents map[string]any) map[string]any {
+		seq++
+		rec := map[string]any{
+			"seq":        at.UnixMilli() + seq,
+			"time":       at.Format(time.RFC3339),
+			"talker":     Talker,
+			"talkerName": TalkerName,
+			"sender":     m.id,
+			"senderName": m.name,
+			"isChatRoom": true,
+			"type":       typ,
+			"subType":    sub,
+			"content":    content,
+		}
+		if contents != nil {
+			rec["contents"] = contents
+		}
+		records = append(records, rec)
+		return rec
+	}
+	for i := 0; i < n; i++ {
+		// denser in the late morning and evening
+		gap := time.Duration(2+rng.Intn(20)) * time.Minute
+		if h := at.Hour(); h < 10 || (h > 13 && h < 19) {
+			gap *= 2
+		}
+		at = at.Add(gap)
+		if at.Day() != start.Day() {
+			break
+		}
+		who := active[rng.Intn(len(active))]
+		switch r := rng.Intn(100); {
+		case r < 12:
+			q := questions[rng.Intn(len(questions))]
+			lastAsk = emit(who, 1, 0, q, nil)
+		case r < 22 && lastAsk != nil:
+			asked := lastAsk
+			idx := indexOf(questions, asked["content"].(string))
+			emit(who, 49, 57, "@"+asked["senderName"].(string)+" "+answers[idx], map[string]any{
+				"refer": map[string]any{
+					"seq":        asked["seq"],
+					"sender":     asked["sender"],
+					"senderName": asked["senderName"],
+					"type":       1,
+					"content":    asked["content"],
+				},
+			})
+			lastAsk = nil
+		case r < 30:
+			s := shares[rng.Intn(len(shares))]
+			emit(who, 49, 5, s.title, map[string]any{"title": s.title, "desc": s.desc, "url": s.url})
+		case r < 35:
+			emit(who, 3, 0, "[图片]", nil)
+		case r < 37:
+			emit(member{"系统消息", "系统消息"}, 10000, 0, fmt.Sprintf("\"%s\" 撤回了一条消息", who.name), nil)
+		default:
+			emit(who, 1, 0, chatter[rng.Intn(len(chatter))], nil)
+		}
+	}
+	return json.Marshal(records)
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return 0
+}
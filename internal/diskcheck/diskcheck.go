@@ -0,0 +1,83 @@
+// Package diskcheck verifies that output directories are writable and have
+// room left before a run writes to them. Network mounts (NAS, SMB, NFS) can
+// turn read-only or fill up without notice; checking first avoids leaving
+// half-written days behind.
+package diskcheck
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// ErrUnsupported is returned by FreeSpace on platforms without a free space
+// query.
+var ErrUnsupported = errors.New("free space query not supported on this platform")
+
+// Status is the health of one directory.
+type Status struct {
+	Dir string
+	// Free and Total are in bytes; both are 0 when unknown.
+	Free  uint64
+	Total uint64
+	// Err is set when a probe file could not be written, synced or removed.
+	Err error
+}
+
+// Writable reports whether the write probe succeeded.
+func (s Status) Writable() bool { return s.Err == nil }
+
+// Probe writes, syncs and removes a small file in dir and reads the free
+// space of its file system. The probe file carries the atomicfile prefix,
+// so a probe interrupted midway is swept like any other temp file.
+func Probe(dir string) Status {
+	st := Status{Dir: dir}
+	st.Err = writeProbe(dir)
+	if free, total, err := FreeSpace(dir); err == nil {
+		st.Free, st.Total = free, total
+	}
+	return st
+}
+
+func writeProbe(dir string) error {
+	f, err := os.CreateTemp(dir, atomicfile.Prefix+"probe-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, werr := f.Write([]byte("wechat-view disk probe\n"))
+	if werr == nil {
+		werr = f.Sync()
+	}
+	cerr := f.Close()
+	rerr := os.Remove(name)
+	return errors.Join(werr, cerr, rerr)
+}
+
+// Check probes dir and returns an error when it is not writable or has
+// less than minFree bytes free. Unknown free space passes.
+func Check(dir string, minFree uint64) (Status, error) {
+	st := Probe(dir)
+	if st.Err != nil {
+		return st, fmt.Errorf("%s is not writable: %w", dir, st.Err)
+	}
+	if st.Total > 0 && st.Free < minFree {
+		return st, fmt.Errorf("%s has only %s free, below the %s minimum", dir, Bytes(st.Free), Bytes(minFree))
+	}
+	return st, nil
+}
+
+// Bytes renders n as B, KB, MB or GB.
+func Bytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,39 @@
+package diskcheck
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	st, err := Check(dir, 0)
+	if err != nil || !st.Writable() {
+		t.Fatalf("临时目录应可写: %+v %v", st, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("探测文件应被删除: %v", entries)
+	}
+
+	if _, err := Check(filepath.Join(dir, "missing"), 0); err == nil || !strings.Contains(err.Error(), "not writable") {
+		t.Fatalf("不存在的目录应报不可写: %v", err)
+	}
+
+	if st.Total == 0 {
+		t.Skip("当前平台无法读取剩余空间")
+	}
+	if _, err := Check(dir, math.MaxUint64); err == nil || !strings.Contains(err.Error(), "below the") {
+		t.Fatalf("剩余空间不足应报错: %v", err)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512 B", 1536: "1.5 KB", 200 << 20: "200.0 MB", 3 << 30: "3.0 GB"} {
+		if got := Bytes(n); got != want {
+			t.Errorf("Bytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package diskcheck
+
+// FreeSpace is not implemented here; Check then only verifies writability.
+func FreeSpace(dir string) (free, total uint64, err error) {
+	return 0, 0, ErrUnsupported
+}
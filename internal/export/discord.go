@@ -0,0 +1,203 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// DiscordExport mirrors the JSON written by DiscordChatExporter, which
+// viewers such as DiscordChatExporter-frontend and chat-analytics read.
+type DiscordExport struct {
+	Guild        DiscordGuild     `json:"guild"`
+	Channel      DiscordChannel   `json:"channel"`
+	DateRange    DiscordDateRange `json:"dateRange"`
+	ExportedAt   string           `json:"exportedAt"`
+	Messages     []DiscordMessage `json:"messages"`
+	MessageCount int              `json:"messageCount"`
+}
+
+type DiscordGuild struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	IconURL string `json:"iconUrl"`
+}
+
+type DiscordChannel struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	CategoryID string `json:"categoryId"`
+	Category   string `json:"category"`
+	Name       string `json:"name"`
+	Topic      string `json:"topic"`
+}
+
+type DiscordDateRange struct {
+	After  *string `json:"after"`
+	Before *string `json:"before"`
+}
+
+type DiscordMessage struct {
+	ID              string              `json:"id"`
+	Type            string              `json:"type"`
+	Timestamp       string              `json:"timestamp"`
+	TimestampEdited *string             `json:"timestampEdited"`
+	IsPinned        bool                `json:"isPinned"`
+	Content         string              `json:"content"`
+	Author          DiscordUser         `json:"author"`
+	Attachments     []DiscordAttachment `json:"attachments"`
+	Embeds          []DiscordEmbed      `json:"embeds"`
+	Stickers        []DiscordSticker    `json:"stickers"`
+	Reactions       []any               `json:"reactions"`
+	Mentions        []DiscordUser       `json:"mentions"`
+	Reference       *DiscordReference   `json:"reference,omitempty"`
+}
+
+type DiscordUser struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Discriminator string   `json:"discriminator"`
+	Nickname      string   `json:"nickname"`
+	Color         *string  `json:"color"`
+	IsBot         bool     `json:"isBot"`
+	Roles         []string `json:"roles"`
+	AvatarURL     string   `json:"avatarUrl"`
+}
+
+type DiscordAttachment struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	FileName      string `json:"fileName"`
+	FileSizeBytes int64  `json:"fileSizeBytes"`
+}
+
+type DiscordEmbed struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Images      []any  `json:"images"`
+	Fields      []any  `json:"fields"`
+}
+
+type DiscordSticker struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	SourceURL string `json:"sourceUrl"`
+}
+
+type DiscordReference struct {
+	MessageID string  `json:"messageId"`
+	ChannelID string  `json:"channelId"`
+	GuildID   *string `json:"guildId"`
+}
+
+// Discord converts msgs (oldest first) into a DiscordChatExporter archive.
+// Join, leave and rename notices become the matching Discord system message
+// types; other WeChat system notices are kept as messages from "系统消息".
+func Discord(ch Channel, msgs []chatlog.Message, now time.Time) DiscordExport {
+	channelID := snowflake(ch.ID)
+	out := DiscordExport{
+		Guild:      DiscordGuild{ID: channelID, Name: "WeChat"},
+		Channel:    DiscordChannel{ID: channelID, Type: "GuildTextChat", Category: "WeChat", Name: firstNonEmpty(ch.Name, ch.ID)},
+		ExportedAt: now.Format(time.RFC3339),
+		Messages:   []DiscordMessage{},
+	}
+	for _, e := range prepare(msgs) {
+		dm := DiscordMessage{
+			ID:          discordID(channelID, e.seq),
+			Type:        "Default",
+			Content:     text(e.Message),
+			Author:      discordUser(senderID(e.Message), senderName(e.Message)),
+			Attachments: []DiscordAttachment{},
+			Embeds:      []DiscordEmbed{},
+			Stickers:    []DiscordSticker{},
+			Reactions:   []any{},
+			Mentions:    []DiscordUser{},
+		}
+		if !e.at.IsZero() {
+			dm.Timestamp = e.at.Format(time.RFC3339)
+		}
+		if isSystem(e.Message) {
+			dm.Author = discordUser("system", "系统消息")
+			if events := summarize.ParseMemberEvents(e.Message); len(events) > 0 {
+				ev := events[0]
+				if ev.By != "" && ev.Kind != summarize.MemberLeave {
+					dm.Author = discordUser(ev.By, ev.By)
+				}
+				switch ev.Kind {
+				case summarize.MemberJoin:
+					dm.Type = "RecipientAdd"
+				case summarize.MemberLeave, summarize.MemberRemove:
+					dm.Type = "RecipientRemove"
+				case summarize.GroupRename:
+					dm.Type = "ChannelNameChange"
+					dm.Content = ev.Name
+				}
+				if ev.Kind != summarize.GroupRename {
+					for _, x := range events {
+						dm.Mentions = append(dm.Mentions, discordUser(x.Who, x.Who))
+					}
+				}
+			}
+		} else {
+			for _, name := range e.Mentions {
+				dm.Mentions = append(dm.Mentions, discordUser(name, name))
+			}
+		}
+		if u := imageURL(ch, e.Message); u != "" {
+			dm.Attachments = append(dm.Attachments, DiscordAttachment{ID: dm.ID, URL: u, FileName: e.MediaMD5 + ".jpg"})
+			dm.Content = ""
+		}
+		if e.IsFile() || e.IsVideo() {
+			dm.Attachments = append(dm.Attachments, DiscordAttachment{ID: dm.ID, FileName: firstNonEmpty(e.FileName(), "attachment"), FileSizeBytes: attachmentSize(e.Message)})
+		}
+		if isSticker(e.Message) {
+			dm.Stickers = append(dm.Stickers, DiscordSticker{ID: dm.ID, Name: "表情", Format: "Png"})
+		}
+		if s := e.Share; s != nil && !e.IsFile() && (s.URL != "" || s.Title != "") {
+			dm.Embeds = append(dm.Embeds, DiscordEmbed{Title: s.Title, URL: s.URL, Description: s.Desc, Images: []any{}, Fields: []any{}})
+		}
+		if e.replyTo > 0 {
+			dm.Type = "Reply"
+			dm.Reference = &DiscordReference{MessageID: discordID(channelID, e.replyTo), ChannelID: channelID}
+		}
+		out.Messages = append(out.Messages, dm)
+	}
+	out.MessageCount = len(out.Messages)
+	if n := len(out.Messages); n > 0 {
+		first, last := out.Messages[0].Timestamp, out.Messages[n-1].Timestamp
+		if first != "" {
+			out.DateRange.After = &first
+		}
+		if last != "" {
+			out.DateRange.Before = &last
+		}
+	}
+	return out
+}
+
+func discordUser(id, name string) DiscordUser {
+	return DiscordUser{ID: snowflake(id), Name: name, Discriminator: "0000", Nickname: name, Roles: []string{}}
+}
+
+// snowflake maps a WeChat id onto a stable numeric id, since Discord tools
+// expect decimal snowflakes.
+func snowflake(s string) string {
+	return strconv.FormatInt(numericID(s), 10)
+}
+
+// discordID numbers messages inside the channel: ids must be unique and
+// increase with time, which seq already does.
+func discordID(channelID string, seq int) string {
+	return channelID[:min(len(channelID), 8)] + leftPad(strconv.Itoa(seq), 10)
+}
+
+func leftPad(s string, n int) string {
+	for len(s) < n {
+		s = "0" + s
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+// Package export converts archived WeChat messages into the JSON layouts of
+// other platforms' chat exports, so cross-platform archive viewers can open
+// them: DiscordChatExporter's JSON and Telegram Desktop's result.json.
+package export
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/media"
+)
+
+// Formats lists the supported export layouts.
+var Formats = []string{"discord", "telegram"}
+
+// Channel describes the exported group.
+type Channel struct {
+	ID   string
+	Name string
+	// ImageBaseURL, when set, turns image messages into attachment URLs
+	// served by chatlog.
+	ImageBaseURL string
+}
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>"'，。、）)]+`)
+
+// entry is one message with the ids shared by both formats.
+type entry struct {
+	chatlog.Message
+	seq     int
+	at      time.Time
+	replyTo int // seq of the quoted message, 0 if unknown
+}
+
+// prepare numbers msgs from 1 and resolves quoted replies to the seq of the
+// original, matched by sender and send time.
+func prepare(msgs []chatlog.Message) []entry {
+	out := make([]entry, len(msgs))
+	type key struct{ sender, at string }
+	bySenderTime := map[key]int{}
+	for i, m := range msgs {
+		e := entry{Message: m, seq: i + 1, at: messageTime(m)}
+		if ref := m.Reference; ref != nil && ref.Time != "" {
+			if t, err := time.Parse(time.RFC3339, ref.Time); err == nil {
+				e.replyTo = bySenderTime[key{firstNonEmpty(ref.Sender, ref.SenderName), t.UTC().Format(time.RFC3339)}]
+			}
+		}
+		if !e.at.IsZero() {
+			at := e.at.UTC().Format(time.RFC3339)
+			bySenderTime[key{m.Sender, at}] = e.seq
+			if m.SenderName != "" {
+				bySenderTime[key{m.SenderName, at}] = e.seq
+			}
+		}
+		out[i] = e
+	}
+	return out
+}
+
+func messageTime(m chatlog.Message) time.Time {
+	if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
+		return t
+	}
+	ts := m.Timestamp
+	if ts == 0 {
+		ts = m.CreateTime
+	}
+	if ts <= 0 {
+		return time.Time{}
+	}
+	if ts > 1_000_000_000_000 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+func text(m chatlog.Message) string {
+	if m.Content != "" {
+		return m.Content
+	}
+	return m.Text
+}
+
+func senderName(m chatlog.Message) string {
+	return firstNonEmpty(m.SenderName, m.Nickname, m.Sender, m.From, "未知")
+}
+
+func senderID(m chatlog.Message) string {
+	return firstNonEmpty(m.Sender, m.From, m.SenderName, "unknown")
+}
+
+func attachmentSize(m chatlog.Message) int64 {
+	if m.Attachment == nil {
+		return 0
+	}
+	return m.Attachment.Size
+}
+
+func isSystem(m chatlog.Message) bool { return m.MsgType == 10000 }
+
+func isSticker(m chatlog.Message) bool { return m.MsgType == 47 }
+
+func imageURL(ch Channel, m chatlog.Message) string {
+	if m.MsgType != 3 {
+		return ""
+	}
+	return media.ImageURL(ch.ImageBaseURL, m)
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+func sampleMessages() []chatlog.Message {
+	return []chatlog.Message{
+		{Sender: "wxid_a", SenderName: "阿强", Time: "2025-10-16T09:00:00+08:00", Content: "MCP 怎么配置？@小美 看 https://example.com/mcp", Mentions: []string{"小美"}},
+		{Sender: "wxid_b", SenderName: "小美", Time: "2025-10-16T09:02:00+08:00", Content: "看官方文档",
+			Reference: &chatlog.Reference{Sender: "wxid_a", Time: "2025-10-16T09:00:00+08:00"}},
+		{Sender: "system", MsgType: 10000, Time: "2025-10-16T09:05:00+08:00", Content: `"阿强"邀请"老王"加入了群聊`},
+		{Sender: "wxid_c", SenderName: "老王", Time: "2025-10-16T09:06:00+08:00", MsgType: chatlog.TypeApp, SubType: chatlog.SubTypeFile,
+			Attachment: &chatlog.Attachment{FileName: "手册.pdf", Size: 2048}},
+	}
+}
+
+func TestDiscordExport(t *testing.T) {
+	d := Discord(Channel{ID: "123@chatroom", Name: "AI群"}, sampleMessages(), time.Date(2025, 10, 17, 0, 0, 0, 0, time.UTC))
+	if d.MessageCount != 4 || d.Channel.Name != "AI群" || d.DateRange.After == nil {
+		t.Fatalf("导出头部不对: %+v", d)
+	}
+	first, reply, join, file := d.Messages[0], d.Messages[1], d.Messages[2], d.Messages[3]
+	if len(first.Mentions) != 1 || first.Mentions[0].Name != "小美" {
+		t.Fatalf("提及丢失: %+v", first.Mentions)
+	}
+	if reply.Type != "Reply" || reply.Reference == nil || reply.Reference.MessageID != first.ID {
+		t.Fatalf("引用回复应指向原消息: %+v", reply.Reference)
+	}
+	if first.ID >= reply.ID {
+		t.Fatalf("消息 id 应递增: %s %s", first.ID, reply.ID)
+	}
+	if join.Type != "RecipientAdd" || join.Author.Name != "阿强" || join.Mentions[0].Name != "老王" {
+		t.Fatalf("入群通知不对: %+v", join)
+	}
+	if len(file.Attachments) != 1 || file.Attachments[0].FileName != "手册.pdf" || file.Attachments[0].FileSizeBytes != 2048 {
+		t.Fatalf("附件不对: %+v", file.Attachments)
+	}
+}
+
+func TestTelegramExport(t *testing.T) {
+	tg := Telegram(Channel{ID: "123@chatroom", Name: "AI群"}, sampleMessages())
+	if tg.Name != "AI群" || len(tg.Messages) != 4 {
+		t.Fatalf("导出头部不对: %+v", tg)
+	}
+	first, reply, join, file := tg.Messages[0], tg.Messages[1], tg.Messages[2], tg.Messages[3]
+	if first.Date != "2025-10-16T09:00:00" || first.From != "阿强" || !strings.HasPrefix(first.FromID, "user") {
+		t.Fatalf("消息头不对: %+v", first)
+	}
+	var kinds []string
+	for _, e := range first.TextEntities {
+		kinds = append(kinds, e.Type)
+	}
+	if strings.Join(kinds, ",") != "plain,mention,plain,link" {
+		t.Fatalf("文本实体切分不对: %v", first.TextEntities)
+	}
+	if _, ok := first.Text.([]any); !ok {
+		t.Fatalf("含实体的 text 应为数组: %#v", first.Text)
+	}
+	if reply.ReplyTo != first.ID || reply.Text != "看官方文档" {
+		t.Fatalf("引用回复不对: %+v", reply)
+	}
+	if join.Type != "service" || join.Action != "invite_members" || join.Actor != "阿强" || len(join.Members) != 1 {
+		t.Fatalf("入群通知不对: %+v", join)
+	}
+	if file.FileName != "手册.pdf" || file.File != fileNotIncluded {
+		t.Fatalf("文件消息不对: %+v", file)
+	}
+	b, err := json.Marshal(tg)
+	if err != nil || strings.Contains(string(b), `"text_entities":null`) {
+		t.Fatalf("text_entities 不应为 null: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package export
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// TelegramExport mirrors the result.json written by Telegram Desktop's
+// "Export chat history" in machine-readable JSON mode.
+type TelegramExport struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Messages []TelegramMessage `json:"messages"`
+}
+
+type TelegramMessage struct {
+	ID           int              `json:"id"`
+	Type         string           `json:"type"` // "message" or "service"
+	Date         string           `json:"date"`
+	DateUnixtime string           `json:"date_unixtime"`
+	From         string           `json:"from,omitempty"`
+	FromID       string           `json:"from_id,omitempty"`
+	Actor        string           `json:"actor,omitempty"`
+	ActorID      string           `json:"actor_id,omitempty"`
+	Action       string           `json:"action,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	Members      []string         `json:"members,omitempty"`
+	ReplyTo      int              `json:"reply_to_message_id,omitempty"`
+	Photo        string           `json:"photo,omitempty"`
+	File         string           `json:"file,omitempty"`
+	FileName     string           `json:"file_name,omitempty"`
+	FileSize     int64            `json:"file_size,omitempty"`
+	MediaType    string           `json:"media_type,omitempty"`
+	Duration     int              `json:"duration_seconds,omitempty"`
+	Text         any              `json:"text"`
+	TextEntities []TelegramEntity `json:"text_entities"`
+}
+
+// fileNotIncluded is the placeholder Telegram Desktop writes for media that
+// was not downloaded; WeChat archives keep no media files either.
+const fileNotIncluded = "(File not included. Change data exporting settings to download.)"
+
+// TelegramEntity is one run of formatted text. Href is only set for
+// text_link entities.
+type TelegramEntity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Href string `json:"href,omitempty"`
+}
+
+// Telegram converts msgs (oldest first) into a Telegram Desktop export.
+// Member and title notices become service messages with the same actions
+// Telegram uses; unrecognised WeChat notices keep their text.
+func Telegram(ch Channel, msgs []chatlog.Message) TelegramExport {
+	out := TelegramExport{
+		Name:     firstNonEmpty(ch.Name, ch.ID),
+		Type:     "private_supergroup",
+		ID:       numericID(ch.ID),
+		Messages: []TelegramMessage{},
+	}
+	for _, e := range prepare(msgs) {
+		tm := TelegramMessage{ID: e.seq, Type: "message", ReplyTo: e.replyTo}
+		if !e.at.IsZero() {
+			tm.Date = e.at.Format("2006-01-02T15:04:05")
+			tm.DateUnixtime = strconv.FormatInt(e.at.Unix(), 10)
+		}
+		body := text(e.Message)
+		if isSystem(e.Message) {
+			tm.Type = "service"
+			tm.Actor = "系统消息"
+			tm.ActorID = "user0"
+			if events := summarize.ParseMemberEvents(e.Message); len(events) > 0 {
+				ev := events[0]
+				if ev.By != "" {
+					tm.Actor, tm.ActorID = ev.By, telegramUser(ev.By)
+				}
+				switch ev.Kind {
+				case summarize.MemberJoin:
+					tm.Action = "invite_members"
+				case summarize.MemberLeave, summarize.MemberRemove:
+					tm.Action = "remove_members"
+				case summarize.GroupRename:
+					tm.Action = "edit_group_title"
+					tm.Title = ev.Name
+				}
+				if ev.Kind == summarize.MemberLeave {
+					tm.Actor, tm.ActorID = ev.Who, telegramUser(ev.Who)
+				}
+				if ev.Kind != summarize.GroupRename {
+					for _, x := range events {
+						tm.Members = append(tm.Members, x.Who)
+					}
+				}
+				body = ""
+			}
+			tm.Text, tm.TextEntities = telegramText(body, nil, nil)
+			out.Messages = append(out.Messages, tm)
+			continue
+		}
+		tm.From, tm.FromID = senderName(e.Message), telegramUser(senderID(e.Message))
+		switch {
+		case e.MsgType == 3:
+			tm.Photo = firstNonEmpty(imageURL(ch, e.Message), fileNotIncluded)
+			body = ""
+		case isSticker(e.Message):
+			tm.MediaType = "sticker"
+			tm.File = fileNotIncluded
+			body = ""
+		case e.IsVideo():
+			tm.MediaType = "video_file"
+			tm.File = fileNotIncluded
+			tm.FileName = e.FileName()
+			tm.FileSize = attachmentSize(e.Message)
+			if e.Attachment != nil {
+				tm.Duration = e.Attachment.Duration
+			}
+			body = ""
+		case e.IsFile():
+			tm.File = fileNotIncluded
+			tm.FileName = firstNonEmpty(e.FileName(), "attachment")
+			tm.FileSize = attachmentSize(e.Message)
+			body = ""
+		}
+		var share *chatlog.Share
+		if s := e.Share; s != nil && !e.IsFile() && s.URL != "" {
+			share = s
+		}
+		tm.Text, tm.TextEntities = telegramText(body, e.Mentions, share)
+		out.Messages = append(out.Messages, tm)
+	}
+	return out
+}
+
+// telegramText splits body into Telegram text entities: URLs become link
+// entities, "@name" for each mention becomes a mention entity and a shared
+// card is appended as a text_link. Like Telegram Desktop, the text field is
+// a plain string when everything is plain and a mixed array otherwise.
+func telegramText(body string, mentions []string, share *chatlog.Share) (any, []TelegramEntity) {
+	entities := []TelegramEntity{}
+	plain := func(s string) {
+		if s == "" {
+			return
+		}
+		if n := len(entities); n > 0 && entities[n-1].Type == "plain" {
+			entities[n-1].Text += s
+			return
+		}
+		entities = append(entities, TelegramEntity{Type: "plain", Text: s})
+	}
+	rest := body
+	for rest != "" {
+		// earliest URL or mention wins
+		start, end, kind := -1, -1, ""
+		if loc := urlRegexp.FindStringIndex(rest); loc != nil {
+			start, end, kind = loc[0], loc[1], "link"
+		}
+		for _, name := range mentions {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if i := strings.Index(rest, "@"+name); i >= 0 && (start < 0 || i < start) {
+				start, end, kind = i, i+len(name)+1, "mention"
+			}
+		}
+		if start < 0 {
+			plain(rest)
+			break
+		}
+		plain(rest[:start])
+		entities = append(entities, TelegramEntity{Type: kind, Text: rest[start:end]})
+		rest = rest[end:]
+	}
+	if share != nil {
+		if len(entities) > 0 {
+			plain("\n")
+		}
+		entities = append(entities, TelegramEntity{Type: "text_link", Text: firstNonEmpty(share.Title, share.URL), Href: share.URL})
+	}
+
+	if len(entities) == 0 {
+		return "", entities
+	}
+	if len(entities) == 1 && entities[0].Type == "plain" {
+		return entities[0].Text, entities
+	}
+	parts := make([]any, 0, len(entities))
+	for _, ent := range entities {
+		if ent.Type == "plain" {
+			parts = append(parts, ent.Text)
+		} else {
+			parts = append(parts, ent)
+		}
+	}
+	return parts, entities
+}
+
+// telegramUser returns a from_id in Telegram's "user<digits>" form.
+func telegramUser(id string) string {
+	return "user" + strconv.FormatInt(numericID(id), 10)
+}
+
+// numericID maps a WeChat id onto a stable positive int64.
+func numericID(s string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int64(h.Sum64() >> 12)
+}
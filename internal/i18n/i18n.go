@@ -0,0 +1,98 @@
+// Package i18n translates the text wechat-view shows to people: page
+// templates, summary highlights and API errors. The Chinese source strings
+// double as catalog keys, so templates and code stay readable and a string
+// missing from a catalog falls back to Chinese instead of to an id.
+//
+// The language is process-wide, like the template directory: Use is called
+// once at startup, before anything renders or serves.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Default is the language of the source strings.
+const Default = "zh-CN"
+
+//go:embed catalogs/*.json
+var catalogFS embed.FS
+
+type locale struct {
+	lang string
+	msgs map[string]string
+}
+
+var current atomic.Pointer[locale]
+
+// Languages lists the supported languages, Default first.
+func Languages() []string {
+	langs := []string{Default}
+	entries, _ := catalogFS.ReadDir("catalogs")
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+// Use switches the process to lang, one of Languages; "" means Default.
+func Use(lang string) error {
+	if lang == "" || lang == Default {
+		current.Store(nil)
+		return nil
+	}
+	msgs, err := catalog(lang)
+	if err != nil {
+		return err
+	}
+	current.Store(&locale{lang: lang, msgs: msgs})
+	return nil
+}
+
+// catalog loads catalogs/<lang>.json, a JSON object from source strings to
+// translations.
+func catalog(lang string) (map[string]string, error) {
+	b, err := catalogFS.ReadFile("catalogs/" + lang + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported language %q (supported: %s)", lang, strings.Join(Languages(), ", "))
+	}
+	var msgs map[string]string
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, fmt.Errorf("catalog %s: %w", lang, err)
+	}
+	return msgs, nil
+}
+
+// Lang is the current language as an HTML lang value.
+func Lang() string {
+	if l := current.Load(); l != nil {
+		return l.lang
+	}
+	return Default
+}
+
+// T translates s, or returns it unchanged when the catalog lacks it.
+func T(s string) string {
+	if l := current.Load(); l != nil {
+		if t, ok := l.msgs[s]; ok {
+			return t
+		}
+	}
+	return s
+}
+
+// Tf translates format and formats args with it.
+func Tf(format string, args ...any) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Errorf is fmt.Errorf with a translated format, for errors shown to users.
+func Errorf(format string, args ...any) error {
+	return fmt.Errorf(T(format), args...)
+}
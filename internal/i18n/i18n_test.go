@@ -0,0 +1,105 @@
+package i18n
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	// templateKey and codeKey find the source strings passed to t in
+	// templates and to T, Tf and Errorf in Go code.
+	templateKey = regexp.MustCompile(`\bt ("(?:[^"\\]|\\.)*")`)
+	codeKey     = regexp.MustCompile(`i18n\.(?:T|Tf|Errorf)\(("(?:[^"\\]|\\.)*")`)
+	verbRegexp  = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+)
+
+// sourceKeys collects every literal key under the module's internal and
+// cmd directories, with where it was first seen.
+func sourceKeys(t *testing.T) map[string]string {
+	t.Helper()
+	keys := map[string]string{}
+	for _, root := range []string{"..", "../../cmd"} {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			var re *regexp.Regexp
+			switch {
+			case strings.HasSuffix(p, "_test.go"):
+				return nil
+			case strings.HasSuffix(p, ".go"):
+				re = codeKey
+			case strings.HasSuffix(p, ".html") && filepath.Base(filepath.Dir(p)) == "templates":
+				re = templateKey
+			default:
+				return nil
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			for _, m := range re.FindAllStringSubmatch(string(b), -1) {
+				key, err := strconv.Unquote(m[1])
+				if err != nil {
+					t.Errorf("%s: 无法解析 %s: %v", p, m[1], err)
+					continue
+				}
+				if _, ok := keys[key]; !ok {
+					keys[key] = p
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) < 100 {
+		t.Fatalf("只找到 %d 个待翻译字符串，扫描路径可能不对", len(keys))
+	}
+	return keys
+}
+
+func TestCatalogsCoverSourceStrings(t *testing.T) {
+	keys := sourceKeys(t)
+	for _, lang := range Languages()[1:] {
+		msgs, err := catalog(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, where := range keys {
+			tr, ok := msgs[key]
+			if !ok {
+				t.Errorf("%s 缺少 %q（%s）", lang, key, where)
+				continue
+			}
+			if want, got := verbRegexp.FindAllString(key, -1), verbRegexp.FindAllString(tr, -1); strings.Join(want, " ") != strings.Join(got, " ") {
+				t.Errorf("%s 的 %q 格式动词 %v 与原文 %v 不一致", lang, tr, got, want)
+			}
+		}
+	}
+}
+
+func TestUseSwitchesCatalog(t *testing.T) {
+	defer Use("")
+	if err := Use("en"); err != nil {
+		t.Fatal(err)
+	}
+	if Lang() != "en" || T("搜索") != "Search" || Tf("%v 条", 3) != "3 messages" {
+		t.Fatalf("切换到 en 后: %s %q %q", Lang(), T("搜索"), Tf("%v 条", 3))
+	}
+	if T("没有翻译的字符串") != "没有翻译的字符串" {
+		t.Fatal("缺少翻译时应回退到原文")
+	}
+	if err := Use("fr"); err == nil || Lang() != "en" {
+		t.Fatalf("不支持的语言应报错且保持原语言: %v %s", err, Lang())
+	}
+	if err := Use(""); err != nil || Lang() != Default || T("搜索") != "搜索" {
+		t.Fatalf("空语言应恢复默认: %v %s", err, Lang())
+	}
+}
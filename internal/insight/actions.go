@@ -0,0 +1,77 @@
+package insight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"wechat-view/internal/summarize"
+)
+
+const refineActionsPrompt = `You review action items that simple rules extracted from a Chinese group chat. Each item has an index, the owner who committed, the task, an optional due hint and the source message. Drop items that are not real commitments (jokes, hypotheticals, tasks already done, questions). For the rest, rewrite the task as a short imperative in Simplified Chinese (max 30 characters), fix the owner if the source shows someone else committed, and normalise the due hint (e.g. "明天", "周五前"; empty if none).
+
+Your response MUST be a valid JSON array:
+[{"index": number, "owner": string, "task": string, "due": string}]
+List only the items to keep, in the original order.`
+
+// RefineActions asks the model to drop false positives from rule-based
+// action items and to tidy the rest. Items it keeps are marked Refined;
+// source, sender and time are preserved from the input.
+func (c Client) RefineActions(ctx context.Context, items []summarize.ActionItem) ([]summarize.ActionItem, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+	type input struct {
+		Index  int    `json:"index"`
+		Owner  string `json:"owner"`
+		Task   string `json:"task"`
+		Due    string `json:"due,omitempty"`
+		Source string `json:"source"`
+	}
+	in := make([]input, len(items))
+	for i, it := range items {
+		in[i] = input{Index: i, Owner: it.Owner, Task: c.Scrub.Text(it.Task), Due: it.Due, Source: c.Scrub.Text(it.Source)}
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.complete(ctx, refineActionsPrompt, string(body))
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.Index(content, "["); i >= 0 {
+		if j := strings.LastIndex(content, "]"); j >= i {
+			content = content[i : j+1]
+		}
+	}
+	var kept []struct {
+		Index int    `json:"index"`
+		Owner string `json:"owner"`
+		Task  string `json:"task"`
+		Due   string `json:"due"`
+	}
+	if err := json.Unmarshal([]byte(content), &kept); err != nil {
+		return nil, fmt.Errorf("parse llm response: %w", err)
+	}
+	out := make([]summarize.ActionItem, 0, len(kept))
+	seen := map[int]bool{}
+	for _, k := range kept {
+		if k.Index < 0 || k.Index >= len(items) || seen[k.Index] {
+			continue
+		}
+		seen[k.Index] = true
+		it := items[k.Index]
+		if s := strings.TrimSpace(k.Owner); s != "" {
+			it.Owner = s
+		}
+		if s := strings.TrimSpace(k.Task); s != "" {
+			it.Task = s
+		}
+		it.Due = strings.TrimSpace(k.Due)
+		it.Refined = true
+		out = append(out, it)
+	}
+	return out, nil
+}
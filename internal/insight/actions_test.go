@@ -0,0 +1,63 @@
+package insight_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+)
+
+func TestRefineActionsKeepsSourceFields(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	llm.SetContent("```json\n" + `[{"index": 1, "owner": "老王", "task": "周五前上线新版", "due": "周五前"}, {"index": 9, "task": "bogus"}]` + "\n```")
+	client := insight.Client{BaseURL: llm.URL, Model: "m"}
+	items := []summarize.ActionItem{
+		{Owner: "阿强", Task: "我明天发", Due: "明天", Sender: "阿强", Source: "我明天发，开玩笑的"},
+		{Owner: "老王", Task: "你周五之前上线吧", Due: "周五之前", At: "10:02", Sender: "小美", Source: "@老王 你周五之前上线吧"},
+	}
+	got, err := client.RefineActions(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("refined = %+v, want 1 item", got)
+	}
+	if a := got[0]; !a.Refined || a.Task != "周五前上线新版" || a.Due != "周五前" || a.Sender != "小美" || a.At != "10:02" || a.Source != items[1].Source {
+		t.Fatalf("refined item = %+v", a)
+	}
+}
+
+func TestDeepDiveTopics(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	llm.SetContent(`[{"index": 1, "explanation": " 大家讨论了发布窗口。", "viewpoints": ["阿强主张周五发布", " "], "openQuestions": ["回滚方案谁负责"]}, {"index": 0, "explanation": ""}, {"index": 7, "explanation": "x"}]`)
+	client := insight.Client{BaseURL: llm.URL, Model: "m"}
+	topics := []summarize.Topic{
+		{Name: "午饭", Keywords: []string{"食堂"}, Count: 2},
+		{Name: "发布", Keywords: []string{"上线"}, Count: 3},
+	}
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "周五上线吧"},
+		{SenderName: "小美", Content: "今天食堂不错"},
+	}
+	got, err := client.DeepDiveTopics(context.Background(), topics, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].DeepDive != nil || topics[1].DeepDive != nil {
+		t.Fatalf("topics = %+v, input = %+v", got, topics)
+	}
+	d := got[1].DeepDive
+	if d == nil || d.Explanation != "大家讨论了发布窗口。" || len(d.Viewpoints) != 1 || len(d.OpenQuestions) != 1 {
+		t.Fatalf("deep dive = %+v", d)
+	}
+	// Each topic is sent with the messages that mention it.
+	if p := llm.LastPrompt(); !strings.Contains(p, "周五上线吧") || strings.Count(p, "今天食堂不错") != 1 {
+		t.Fatalf("prompt = %s", p)
+	}
+}
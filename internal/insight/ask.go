@@ -0,0 +1,115 @@
+package insight
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const askPrompt = `You answer questions about the history of a Chinese group chat. You receive the question and numbered messages retrieved from the archive, each with its date and sender. Answer in Simplified Chinese, briefly, using only these messages. After each statement cite the messages it relies on as [1], [2] and so on. If the messages do not answer the question, say that the archive has nothing on it rather than guessing.`
+
+// Source is an archived message handed to Answer as evidence.
+type Source struct {
+	Date   string `json:"date"`
+	Sender string `json:"sender,omitempty"`
+	Time   string `json:"time,omitempty"`
+	Text   string `json:"text"`
+}
+
+// Answer asks the model question with sources as the only evidence and
+// returns its reply, which cites sources as [n] counting from 1. When delta
+// is set the reply is streamed and delta receives each piece as it arrives;
+// endpoints that do not stream deliver it as one piece.
+func (c Client) Answer(ctx context.Context, question string, sources []Source, delta func(string)) (string, error) {
+	var user strings.Builder
+	fmt.Fprintf(&user, "问题：%s\n\n消息：\n", c.Scrub.Text(question))
+	for i, s := range sources {
+		fmt.Fprintf(&user, "[%d] %s %s %s：%s\n", i+1, s.Date, s.Time, s.Sender, c.Scrub.Text(s.Text))
+	}
+	if delta == nil {
+		return c.complete(ctx, askPrompt, user.String())
+	}
+	reqBody := map[string]any{
+		"model":       c.Model,
+		"temperature": c.Temperature,
+		"stream":      true,
+		"messages": []map[string]string{
+			{"role": "system", "content": askPrompt},
+			{"role": "user", "content": user.String()},
+		},
+	}
+	var answer strings.Builder
+	var used tokenUsage
+	err := c.request(ctx, "/chat/completions", reqBody, func(resp *http.Response) error {
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			var raw struct {
+				Choices []struct {
+					Message struct {
+						Content string `json:"content"`
+					} `json:"message"`
+				} `json:"choices"`
+				Usage tokenUsage `json:"usage"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+				return err
+			}
+			used = raw.Usage
+			if len(raw.Choices) > 0 {
+				answer.WriteString(raw.Choices[0].Message.Content)
+				delta(raw.Choices[0].Message.Content)
+			}
+			return nil
+		}
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				break
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+				// Usage comes with the last chunk from endpoints that
+				// report it while streaming.
+				Usage *tokenUsage `json:"usage"`
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("parse llm stream: %w", err)
+			}
+			if chunk.Error.Message != "" {
+				return errors.New(chunk.Error.Message)
+			}
+			if chunk.Usage != nil {
+				used = *chunk.Usage
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				answer.WriteString(chunk.Choices[0].Delta.Content)
+				delta(chunk.Choices[0].Delta.Content)
+			}
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	c.record(used, []string{askPrompt, user.String()}, answer.String())
+	if strings.TrimSpace(answer.String()) == "" {
+		return "", errors.New("empty llm content")
+	}
+	return answer.String(), nil
+}
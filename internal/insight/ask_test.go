@@ -0,0 +1,37 @@
+package insight_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/insight"
+	"wechat-view/internal/testkit"
+)
+
+func TestAnswerStreamsWithSources(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	llm.SetContent("讨论过，建议把超时调到 60 秒 [1]。")
+	scrub, _ := insight.NewScrubber(nil)
+	client := insight.Client{BaseURL: llm.URL, Model: "m", Scrub: scrub}
+	sources := []insight.Source{{Date: "2025-10-16", Sender: "老王", Time: "10:02", Text: "超时调到 60 秒，有问题打 13812345678"}}
+
+	var pieces []string
+	got, err := client.Answer(context.Background(), "我们讨论过超时吗", sources, func(s string) { pieces = append(pieces, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "讨论过，建议把超时调到 60 秒 [1]。" || len(pieces) < 2 || strings.Join(pieces, "") != got {
+		t.Fatalf("answer = %q from pieces %q", got, pieces)
+	}
+	prompt := llm.LastPrompt()
+	if !strings.Contains(prompt, "[1] 2025-10-16 10:02 老王") || strings.Contains(prompt, "13812345678") {
+		t.Fatalf("prompt = %s", prompt)
+	}
+
+	// Without delta the reply comes back in one piece.
+	if got, err := client.Answer(context.Background(), "q", sources, nil); err != nil || !strings.Contains(got, "[1]") {
+		t.Fatalf("non-streaming answer = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,126 @@
+package insight
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/summarize"
+)
+
+// CacheKey identifies what a result was generated from. Data is a hash of
+// the day's messages (archive.Fingerprint) and the summary sent with them,
+// Prompt the PromptID of the system prompt, plus the chunking when
+// MapReduce is set, and Params the rest of the request: endpoint,
+// temperature, sampling limits and scrubbing.
+type CacheKey struct {
+	Date   string `json:"date"`
+	Talker string `json:"talker"`
+	Data   string `json:"data"`
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Params string `json:"params"`
+}
+
+// Key returns the cache key of c's results for a day; data is the
+// archive.Fingerprint of the messages summary was built from.
+func (c Client) Key(date, talker, data string, summary summarize.Summary) CacheKey {
+	h := sha1.New()
+	_ = json.NewEncoder(h).Encode(summary)
+	params := sha1.Sum([]byte(fmt.Sprintf("%s\x00%g\x00%d\x00%d\x00%s", c.BaseURL, c.Temperature, c.MaxMessages, c.MaxChars, c.Scrub.key())))
+	return CacheKey{
+		Date:   date,
+		Talker: talker,
+		Data:   data + "." + hex.EncodeToString(h.Sum(nil)[:8]),
+		Model:  c.Model,
+		Prompt: PromptID(c.SystemPrompt) + c.MapReduce.key(),
+		Params: hex.EncodeToString(params[:8]),
+	}
+}
+
+func (k CacheKey) id() string {
+	sum := sha1.Sum([]byte(k.Date + "\x00" + k.Talker + "\x00" + k.Data + "\x00" + k.Model + "\x00" + k.Prompt + "\x00" + k.Params))
+	return hex.EncodeToString(sum[:8])
+}
+
+// cacheEntry is one cached variant with its key, for reading the file.
+type cacheEntry struct {
+	CacheKey
+	Variant Variant `json:"variant"`
+	Created string  `json:"created"`
+}
+
+// Cache keeps generated variants on disk, one file per day, so a day
+// re-rendered with unchanged messages (after a template or config change)
+// does not call the model again. Only successful results are cached.
+type Cache struct {
+	Dir string
+}
+
+func (c Cache) path(date string) string {
+	return filepath.Join(c.Dir, date+".json")
+}
+
+func (c Cache) load(date string) (map[string]cacheEntry, error) {
+	entries := map[string]cacheEntry{}
+	b, err := os.ReadFile(c.path(date))
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Get returns the variant cached for k.
+func (c Cache) Get(k CacheKey) (Variant, bool) {
+	if c.Dir == "" {
+		return Variant{}, false
+	}
+	entries, err := c.load(k.Date)
+	if err != nil {
+		return Variant{}, false
+	}
+	e, ok := entries[k.id()]
+	if !ok || e.CacheKey != k || e.Variant.Result == nil {
+		return Variant{}, false
+	}
+	return e.Variant, true
+}
+
+// Put caches v for k, dropping what the same model, prompt and params
+// produced from earlier versions of the day's messages.
+func (c Cache) Put(k CacheKey, v Variant) error {
+	if c.Dir == "" || v.Result == nil {
+		return nil
+	}
+	entries, err := c.load(k.Date)
+	if err != nil {
+		// A corrupt file is only a cache; start over.
+		entries = map[string]cacheEntry{}
+	}
+	for id, e := range entries {
+		if e.Talker == k.Talker && e.Model == k.Model && e.Prompt == k.Prompt && e.Params == k.Params && e.Data != k.Data {
+			delete(entries, id)
+		}
+	}
+	entries[k.id()] = cacheEntry{CacheKey: k, Variant: v, Created: time.Now().Format(time.RFC3339)}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(c.path(k.Date), b)
+}
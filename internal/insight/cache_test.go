@@ -0,0 +1,71 @@
+package insight_test
+
+import (
+	"testing"
+
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+)
+
+func TestCacheKeyedByDataModelAndPrompt(t *testing.T) {
+	cache := insight.Cache{Dir: t.TempDir()}
+	sum := summarize.Summary{TotalMessages: 2}
+	client := insight.Client{Model: "m1"}
+	key := client.Key("2025-09-17", "123@chatroom", "aaaa", sum)
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("空缓存不应命中")
+	}
+	if err := cache.Put(key, insight.Variant{Error: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("失败结果不应缓存")
+	}
+	if err := cache.Put(key, insight.Variant{Model: "m1", Result: &insight.Result{Overview: "第一版"}}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := cache.Get(key); !ok || v.Result.Overview != "第一版" {
+		t.Fatalf("应命中缓存: %+v %v", v, ok)
+	}
+
+	prompted := insight.Client{Model: "m1", SystemPrompt: "换一个提示词"}
+	scrub, err := insight.NewScrubber(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, k := range map[string]insight.CacheKey{
+		"温度":  insight.Client{Model: "m1", Temperature: 0.7}.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"采样":  insight.Client{Model: "m1", MaxMessages: 50}.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"地址":  insight.Client{Model: "m1", BaseURL: "http://other/v1"}.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"脱敏":  insight.Client{Model: "m1", Scrub: scrub}.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"统计":  client.Key("2025-09-17", "123@chatroom", "aaaa", summarize.Summary{TotalMessages: 3}),
+		"模型":  insight.Client{Model: "m2"}.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"提示词": prompted.Key("2025-09-17", "123@chatroom", "aaaa", sum),
+		"群":   client.Key("2025-09-17", "456@chatroom", "aaaa", sum),
+		"数据":  client.Key("2025-09-17", "123@chatroom", "bbbb", sum),
+	} {
+		if _, ok := cache.Get(k); ok {
+			t.Fatalf("%s不同不应命中缓存", name)
+		}
+	}
+
+	// 消息变化后写入新结果，旧版本的结果被替换。
+	if err := cache.Put(client.Key("2025-09-17", "123@chatroom", "bbbb", sum), insight.Variant{Result: &insight.Result{Overview: "第二版"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("旧数据的结果应被清除")
+	}
+}
+
+func TestAnsweredByKeysFallbackResults(t *testing.T) {
+	client := insight.Client{Model: "primary", BaseURL: "http://a/v1", Fallbacks: []insight.Fallback{{Model: "backup", BaseURL: "http://b/v1"}}}
+	sum := summarize.Summary{}
+	got := client.AnsweredBy("backup").Key("2025-09-17", "123@chatroom", "aaaa", sum)
+	if got.Model != "backup" || got == client.Key("2025-09-17", "123@chatroom", "aaaa", sum) {
+		t.Fatalf("备用模型的结果应按备用模型缓存: %+v", got)
+	}
+	if k := client.AnsweredBy("primary").Key("2025-09-17", "123@chatroom", "aaaa", sum); k.Model != "primary" {
+		t.Fatalf("主模型应保持不变: %+v", k)
+	}
+}
@@ -0,0 +1,270 @@
+package insight
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// maxBulletRunes is the per-bullet limit the built-in prompt asks for.
+const maxBulletRunes = 40
+
+// Arm is one model/prompt setup taking part in an A/B comparison.
+type Arm struct {
+	Label  string
+	Client Client
+}
+
+// Variant is one arm's insight for a day, archived next to the others so
+// pages can switch between them and Tally can compare arms over time.
+type Variant struct {
+	Label string `json:"label"`
+	Model string `json:"model"`
+	// Prompt identifies the system prompt: "default" for the built-in one,
+	// otherwise a short hash, so prompt edits show up as separate arms.
+	Prompt    string  `json:"prompt"`
+	LatencyMS int64   `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+	Result    *Result `json:"result,omitempty"`
+	Quality   Quality `json:"quality"`
+}
+
+// Quality is a heuristic 0-100 score of a result. It does not judge whether
+// the analysis is right; it rewards answers that fill the schema, keep to
+// the length limits and talk about what the day's chat was about.
+type Quality struct {
+	Score int `json:"score"`
+	// Completeness is the share of the six sections that are filled.
+	Completeness float64 `json:"completeness"`
+	// Concision is the share of bullets within maxBulletRunes, counting
+	// actions beyond the third as over the limit.
+	Concision float64 `json:"concision"`
+	// Grounding is the share of overview and bullets that mention one of
+	// the day's keywords, topics or most active members.
+	Grounding float64 `json:"grounding"`
+}
+
+// Compare runs every arm on the same day concurrently and returns their
+// variants in arm order. Failures are recorded on the variant, not returned.
+func Compare(ctx context.Context, arms []Arm, date, talker string, summary summarize.Summary, messages []chatlog.Message) []Variant {
+	out := make([]Variant, len(arms))
+	var wg sync.WaitGroup
+	for i, arm := range arms {
+		wg.Add(1)
+		go func(i int, arm Arm) {
+			defer wg.Done()
+			v := Variant{Label: arm.Label, Model: arm.Client.Model, Prompt: PromptID(arm.Client.SystemPrompt)}
+			start := time.Now()
+			res, err := arm.Client.Generate(ctx, date, talker, summary, messages)
+			v.LatencyMS = time.Since(start).Milliseconds()
+			if err != nil {
+				v.Error = err.Error()
+			} else {
+				v.Result = &res
+				v.Quality = Score(res, summary)
+			}
+			out[i] = v
+		}(i, arm)
+	}
+	wg.Wait()
+	return out
+}
+
+// PromptID returns the Variant.Prompt value for a system prompt.
+func PromptID(prompt string) string {
+	if strings.TrimSpace(prompt) == "" {
+		return "default"
+	}
+	sum := sha1.Sum([]byte(prompt))
+	return hex.EncodeToString(sum[:4])
+}
+
+// Score rates r against the day it describes.
+func Score(r Result, summary summarize.Summary) Quality {
+	var q Quality
+	sections := []bool{
+		r.Overview != "",
+		len(r.Highlights) > 0,
+		len(r.Opportunities) > 0,
+		len(r.Risks) > 0,
+		len(r.Actions) > 0,
+		r.Spotlight != "",
+	}
+	filled := 0
+	for _, ok := range sections {
+		if ok {
+			filled++
+		}
+	}
+	q.Completeness = float64(filled) / float64(len(sections))
+
+	var bullets []string
+	for _, list := range [][]string{r.Highlights, r.Opportunities, r.Risks, r.Actions} {
+		bullets = append(bullets, list...)
+	}
+	if len(bullets) > 0 {
+		short := 0
+		for _, b := range bullets {
+			if utf8.RuneCountInString(b) <= maxBulletRunes {
+				short++
+			}
+		}
+		if extra := len(r.Actions) - 3; extra > 0 {
+			short = max(short-extra, 0)
+		}
+		q.Concision = float64(short) / float64(len(bullets))
+	}
+
+	texts := bullets
+	if r.Overview != "" {
+		texts = append(texts, r.Overview)
+	}
+	if terms := groundingTerms(summary); len(texts) > 0 && len(terms) > 0 {
+		grounded := 0
+		for _, t := range texts {
+			for _, term := range terms {
+				if strings.Contains(t, term) {
+					grounded++
+					break
+				}
+			}
+		}
+		q.Grounding = float64(grounded) / float64(len(texts))
+	}
+
+	q.Score = int(math.Round(40*q.Completeness + 20*q.Concision + 40*q.Grounding))
+	q.Completeness = round2(q.Completeness)
+	q.Concision = round2(q.Concision)
+	q.Grounding = round2(q.Grounding)
+	return q
+}
+
+// groundingTerms lists what a grounded insight is expected to mention.
+func groundingTerms(s summarize.Summary) []string {
+	seen := map[string]bool{}
+	var terms []string
+	add := func(t string) {
+		t = strings.TrimSpace(t)
+		if utf8.RuneCountInString(t) < 2 || seen[t] {
+			return
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	for i, kv := range s.Keywords {
+		if i == 20 {
+			break
+		}
+		add(kv.Key)
+	}
+	for _, t := range s.Topics {
+		add(t.Name)
+		for _, k := range t.Keywords {
+			add(k)
+		}
+	}
+	for i, kv := range s.TopSenders {
+		if i == 10 {
+			break
+		}
+		add(kv.Key)
+	}
+	return terms
+}
+
+// ArmStats summarises one arm across the tallied days.
+type ArmStats struct {
+	Label        string  `json:"label"`
+	Model        string  `json:"model"`
+	Prompt       string  `json:"prompt"`
+	Days         int     `json:"days"`
+	Failures     int     `json:"failures"`
+	AvgScore     float64 `json:"avgScore"`
+	AvgLatencyMS int64   `json:"avgLatencyMs"`
+	// Wins counts days on which the arm outscored every other arm that
+	// succeeded that day; Ties counts days it shared the top score.
+	Wins int `json:"wins"`
+	Ties int `json:"ties"`
+}
+
+// Tally aggregates the variants of many days, best average score first.
+// Arms are told apart by label, model and prompt.
+func Tally(days [][]Variant) []ArmStats {
+	type acc struct {
+		ArmStats
+		scoreSum   int
+		latencySum int64
+	}
+	byArm := map[string]*acc{}
+	get := func(v Variant) *acc {
+		key := v.Label + "\x00" + v.Model + "\x00" + v.Prompt
+		a := byArm[key]
+		if a == nil {
+			a = &acc{ArmStats: ArmStats{Label: v.Label, Model: v.Model, Prompt: v.Prompt}}
+			byArm[key] = a
+		}
+		return a
+	}
+	for _, variants := range days {
+		best, top := -1, 0
+		for _, v := range variants {
+			a := get(v)
+			a.Days++
+			a.latencySum += v.LatencyMS
+			if v.Result == nil {
+				a.Failures++
+				continue
+			}
+			a.scoreSum += v.Quality.Score
+			switch {
+			case v.Quality.Score > best:
+				best, top = v.Quality.Score, 1
+			case v.Quality.Score == best:
+				top++
+			}
+		}
+		if len(variants) < 2 || best < 0 {
+			continue
+		}
+		for _, v := range variants {
+			if v.Result == nil || v.Quality.Score != best {
+				continue
+			}
+			if top == 1 {
+				get(v).Wins++
+			} else {
+				get(v).Ties++
+			}
+		}
+	}
+	out := make([]ArmStats, 0, len(byArm))
+	for _, a := range byArm {
+		if ok := a.Days - a.Failures; ok > 0 {
+			a.AvgScore = round2(float64(a.scoreSum) / float64(ok))
+		}
+		if a.Days > 0 {
+			a.AvgLatencyMS = a.latencySum / int64(a.Days)
+		}
+		out = append(out, a.ArmStats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AvgScore != out[j].AvgScore {
+			return out[i].AvgScore > out[j].AvgScore
+		}
+		return out[i].Label < out[j].Label
+	})
+	return out
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
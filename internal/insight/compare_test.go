@@ -0,0 +1,103 @@
+package insight_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+)
+
+func TestScore(t *testing.T) {
+	sum := summarize.Summary{
+		Keywords:   []summarize.KV{{Key: "部署", Count: 5}, {Key: "超时", Count: 3}},
+		TopSenders: []summarize.KV{{Key: "阿强", Count: 9}},
+	}
+	full := insight.Result{
+		Overview:      "大家围绕部署讨论了一整天",
+		Highlights:    []string{"阿强完成部署", "排查了超时"},
+		Opportunities: []string{"补文档"},
+		Risks:         []string{"告警偏多"},
+		Actions:       []string{"加监控"},
+		Spotlight:     "稳住",
+	}
+	q := insight.Score(full, sum)
+	if q.Completeness != 1 || q.Concision != 1 || q.Grounding != 0.5 || q.Score != 80 {
+		t.Fatalf("full result scored %+v", q)
+	}
+
+	sparse := insight.Result{Overview: "今天还行", Highlights: []string{"这是一条明显超过四十个字的要点，用来检查评分会不会因为写得过于啰嗦冗长而扣掉简洁度这一项的全部分数"}}
+	if got := insight.Score(sparse, sum); got.Score >= q.Score || got.Concision != 0 || got.Grounding != 0 {
+		t.Fatalf("sparse result scored %+v", got)
+	}
+}
+
+func TestCompareAndTally(t *testing.T) {
+	good := testkit.NewLLMServer()
+	defer good.Close()
+	broken := testkit.NewLLMServer()
+	defer broken.Close()
+	broken.SetFault(testkit.Fault{Status: http.StatusInternalServerError})
+
+	arms := []insight.Arm{
+		{Label: "A", Client: insight.Client{BaseURL: good.URL, Model: "model-a"}},
+		{Label: "B", Client: insight.Client{BaseURL: broken.URL, Model: "model-b", SystemPrompt: "custom"}},
+	}
+	sum := summarize.Summary{Keywords: []summarize.KV{{Key: "部署"}}}
+	variants := insight.Compare(context.Background(), arms, "2025-10-16", "group", sum, nil)
+	if len(variants) != 2 || variants[0].Label != "A" || variants[0].Result == nil || variants[0].Prompt != "default" {
+		t.Fatalf("arm A = %+v", variants[0])
+	}
+	if variants[1].Result != nil || variants[1].Error == "" || variants[1].Prompt == "default" {
+		t.Fatalf("arm B = %+v", variants[1])
+	}
+
+	tied := []insight.Variant{
+		{Label: "A", Model: "model-a", Prompt: "default", Result: &insight.Result{}, Quality: insight.Quality{Score: 50}},
+		{Label: "B", Model: "model-b", Prompt: variants[1].Prompt, Result: &insight.Result{}, Quality: insight.Quality{Score: 50}},
+	}
+	stats := insight.Tally([][]insight.Variant{variants, tied})
+	if len(stats) != 2 || stats[0].Label != "A" {
+		t.Fatalf("stats = %+v", stats)
+	}
+	a, b := stats[0], stats[1]
+	if a.Days != 2 || a.Wins != 1 || a.Ties != 1 || a.Failures != 0 {
+		t.Fatalf("arm A stats = %+v", a)
+	}
+	if b.Days != 2 || b.Wins != 0 || b.Ties != 1 || b.Failures != 1 || b.AvgScore != 50 {
+		t.Fatalf("arm B stats = %+v", b)
+	}
+}
+
+func TestGenerateFallsBack(t *testing.T) {
+	primary, backup := testkit.NewLLMServer(), testkit.NewLLMServer()
+	defer primary.Close()
+	defer backup.Close()
+	primary.SetContent("抱歉，我无法回答")
+	client := insight.Client{BaseURL: primary.URL, Model: "main", Fallbacks: []insight.Fallback{
+		{Model: "same-endpoint"},
+		{BaseURL: backup.URL, Model: "backup"},
+	}}
+
+	res, err := client.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Model != "backup" || res.Overview != testkit.SampleResult.Overview || primary.Requests() != 2 {
+		t.Fatalf("result from %q after %d primary requests", res.Model, primary.Requests())
+	}
+
+	backup.SetFault(testkit.Fault{Status: http.StatusServiceUnavailable})
+	_, err = client.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "fallback same-endpoint") || !strings.Contains(err.Error(), "fallback backup: llm status 503") {
+		t.Fatalf("err = %v", err)
+	}
+
+	primary.Reset()
+	if res, err := client.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil); err != nil || res.Model != "main" {
+		t.Fatalf("primary result from %q: %v", res.Model, err)
+	}
+}
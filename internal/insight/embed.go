@@ -0,0 +1,56 @@
+package insight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// embedBatch is how many texts go into one /embeddings request.
+const embedBatch = 64
+
+// Embed returns one embedding vector per text from the OpenAI-compatible
+// /embeddings endpoint, using Model as the embedding model. Texts are
+// scrubbed first and sent in batches.
+func (c Client) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatch {
+		end := start + embedBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		input := make([]string, end-start)
+		for i, t := range texts[start:end] {
+			input[i] = c.Scrub.Text(t)
+		}
+		var raw struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+			Usage tokenUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := c.post(ctx, "/embeddings", map[string]any{"model": c.Model, "input": input}, &raw); err != nil {
+			return nil, err
+		}
+		if raw.Error.Message != "" {
+			return nil, errors.New(raw.Error.Message)
+		}
+		c.record(raw.Usage, input, "")
+		if len(raw.Data) != len(input) {
+			return nil, fmt.Errorf("embeddings: got %d vectors for %d texts", len(raw.Data), len(input))
+		}
+		batch := make([][]float64, len(input))
+		for _, d := range raw.Data {
+			if d.Index < 0 || d.Index >= len(batch) || len(d.Embedding) == 0 {
+				return nil, fmt.Errorf("embeddings: bad vector at index %d", d.Index)
+			}
+			batch[d.Index] = d.Embedding
+		}
+		out = append(out, batch...)
+	}
+	return out, nil
+}
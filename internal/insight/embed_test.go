@@ -0,0 +1,41 @@
+package insight_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/insight"
+	"wechat-view/internal/testkit"
+)
+
+func TestEmbedBatchesInOrder(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	scrub, _ := insight.NewScrubber(nil)
+	client := insight.Client{BaseURL: llm.URL, Model: "embed", Scrub: scrub}
+	texts := make([]string, 70)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("消息 %d", i)
+	}
+	texts[3] = "打我 13812345678"
+	vecs, err := client.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != len(texts) || llm.Requests() != 2 {
+		t.Fatalf("got %d vectors in %d requests, want 70 in 2", len(vecs), llm.Requests())
+	}
+	if fmt.Sprint(vecs[0]) == fmt.Sprint(vecs[1]) || fmt.Sprint(vecs[69]) == fmt.Sprint(vecs[0]) {
+		t.Fatal("vectors out of order or identical")
+	}
+	if sent := strings.Join(llm.Embedded(), "\n"); strings.Contains(sent, "13812345678") {
+		t.Fatalf("embeddings input not scrubbed: %s", sent)
+	}
+
+	llm.SetFault(testkit.Fault{Status: 500, Body: "boom"})
+	if _, err := client.Embed(context.Background(), texts[:1]); err == nil {
+		t.Fatal("expected an error from a failing endpoint")
+	}
+}
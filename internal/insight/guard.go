@@ -0,0 +1,150 @@
+package insight
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Kinds of GuardIssue.
+const (
+	IssueName   = "name"
+	IssueLength = "length"
+	IssueBanned = "banned"
+)
+
+// GuardIssue is one reason a result failed Guard.Check. Text is the name,
+// the overlong bullet or the banned term.
+type GuardIssue struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// GuardReport records a result that failed the guardrails, in meta.json.
+// It carries the problems only, never the rejected text.
+type GuardReport struct {
+	Model string `json:"model,omitempty"`
+	// Rejected is set when the result was dropped rather than flagged.
+	Rejected bool         `json:"rejected"`
+	Issues   []GuardIssue `json:"issues"`
+}
+
+// Guard checks a result against the day it describes before it is
+// published: people it names must appear in the day's messages, bullets
+// must stay within MaxBulletRunes and no BannedTerms may occur.
+type Guard struct {
+	// MaxBulletRunes bounds each highlight, opportunity, risk and action;
+	// zero skips the check.
+	MaxBulletRunes int
+	// BannedTerms are matched case-insensitively anywhere in the result.
+	BannedTerms []string
+}
+
+// attribution finds a name right before a verb of saying, at the start of
+// a clause: "阿强认为…", "，小美提到…", "@Bob 建议…". Longer runs of Chinese
+// before the verb ("群里大家普遍认为") are not taken as names.
+var attribution = regexp.MustCompile(`(?:^|[，,。；;：:、！!？?\s（(“"「@和与跟及由])@?([\p{Han}]{2,4}|[A-Za-z][\w.-]{1,20})\s?(?:说|提到|表示|认为|建议|指出|提出|反馈|吐槽|分享|强调|询问|回复|承诺|负责)`)
+
+// genericSubjects are words that stand where a name would but are not one.
+var genericSubjects = map[string]bool{
+	"大家": true, "群友": true, "有人": true, "成员": true, "用户": true, "多人": true,
+	"部分": true, "多位": true, "不少人": true, "管理员": true, "群主": true, "网友": true,
+	"同事": true, "团队": true, "其他人": true, "对方": true, "他们": true, "我们": true,
+	"有成员": true, "多名成员": true, "部分成员": true, "群成员": true, "客户": true, "老板": true,
+	"同时": true, "另外": true, "此外": true, "其中": true, "随后": true, "最后": true,
+	"并且": true, "而且": true, "也有": true, "还有": true, "多数": true, "少数": true,
+	"个别": true, "有些人": true, "一些人": true, "很多人": true,
+}
+
+// adverbs are cut from the end of a candidate name: "大家都认为".
+var adverbs = []string{"一致", "纷纷", "普遍", "主动", "明确", "同样", "多次", "再次", "也", "都", "还", "均", "又", "再", "则", "就", "曾", "已"}
+
+// candidateName returns the name in an attribution match, or "" when it is
+// a generic subject.
+func candidateName(s string) string {
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, a := range adverbs {
+			if strings.HasSuffix(s, a) {
+				s, trimmed = strings.TrimSuffix(s, a), true
+			}
+		}
+	}
+	if utf8.RuneCountInString(s) < 2 || genericSubjects[s] {
+		return ""
+	}
+	return s
+}
+
+// Check returns the result's problems; none means it may be published.
+func (g Guard) Check(r Result, messages []chatlog.Message) []GuardIssue {
+	bullets := make([]string, 0, len(r.Highlights)+len(r.Opportunities)+len(r.Risks)+len(r.Actions))
+	for _, list := range [][]string{r.Highlights, r.Opportunities, r.Risks, r.Actions} {
+		bullets = append(bullets, list...)
+	}
+	texts := append([]string{r.Overview, r.Spotlight}, bullets...)
+
+	var issues []GuardIssue
+	seen := map[GuardIssue]bool{}
+	add := func(issue GuardIssue) {
+		if !seen[issue] {
+			seen[issue] = true
+			issues = append(issues, issue)
+		}
+	}
+
+	names, said := dayNames(messages)
+	for _, text := range texts {
+		for _, m := range attribution.FindAllStringSubmatch(text, -1) {
+			name := candidateName(m[1])
+			if name == "" || strings.Contains(said, name) || knownName(names, name) {
+				continue
+			}
+			add(GuardIssue{Kind: IssueName, Text: name})
+		}
+	}
+	if g.MaxBulletRunes > 0 {
+		for _, b := range bullets {
+			if utf8.RuneCountInString(b) > g.MaxBulletRunes {
+				add(GuardIssue{Kind: IssueLength, Text: truncateRunes(b, g.MaxBulletRunes)})
+			}
+		}
+	}
+	all := strings.ToLower(strings.Join(texts, "\n"))
+	for _, term := range g.BannedTerms {
+		if t := strings.ToLower(strings.TrimSpace(term)); t != "" && strings.Contains(all, t) {
+			add(GuardIssue{Kind: IssueBanned, Text: term})
+		}
+	}
+	return issues
+}
+
+// dayNames returns every sender name and ID of messages, and their text,
+// in which names that were mentioned but did not speak also count.
+func dayNames(messages []chatlog.Message) ([]string, string) {
+	var names []string
+	var text strings.Builder
+	for _, m := range messages {
+		for _, n := range []string{m.SenderName, m.Nickname, m.Sender, m.From} {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		text.WriteString(firstNonEmpty(m.Content, m.Text))
+		text.WriteByte('\n')
+	}
+	return names, text.String()
+}
+
+// knownName reports whether name is, or is part of, one of names; models
+// often shorten "王小明" to "小明".
+func knownName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.Contains(n, name) || strings.Contains(name, n) && utf8.RuneCountInString(n) >= 2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package insight_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+)
+
+func TestGuardCheck(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "王小明", Content: "明天上线，@老李 帮忙看下监控"},
+		{SenderName: "Alice", Content: "ok"},
+	}
+	guard := insight.Guard{MaxBulletRunes: 20, BannedTerms: []string{"Guaranteed"}}
+
+	ok := insight.Result{
+		Overview:   "小明提到明天上线，大家都认为风险可控，同时建议补监控。",
+		Highlights: []string{"Alice 表示没问题", "老李负责盯监控"},
+	}
+	if issues := guard.Check(ok, msgs); len(issues) != 0 {
+		t.Fatalf("clean result flagged: %+v", issues)
+	}
+
+	bad := insight.Result{
+		Overview:   "张伟认为应该推迟，Bob 建议回滚。",
+		Highlights: []string{strings.Repeat("很长", 15), "收益 guaranteed"},
+	}
+	want := []insight.GuardIssue{
+		{Kind: insight.IssueName, Text: "张伟"},
+		{Kind: insight.IssueName, Text: "Bob"},
+		{Kind: insight.IssueLength, Text: strings.Repeat("很长", 9) + "很…"},
+		{Kind: insight.IssueBanned, Text: "Guaranteed"},
+	}
+	if got := guard.Check(bad, msgs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("issues = %+v, want %+v", got, want)
+	}
+}
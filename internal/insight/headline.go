@@ -0,0 +1,86 @@
+package insight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// Headline is a catchy one-line title for a day and a short summary to
+// share it with.
+type Headline struct {
+	Title string `json:"title"`
+	Tweet string `json:"tweet"`
+}
+
+const (
+	// maxTitleRunes and maxTweetRunes cut replies that ignore the limits.
+	maxTitleRunes = 40
+	maxTweetRunes = 140
+	// headlineSampleMessages is how many messages are sent when the day
+	// has no AI insights to go on.
+	headlineSampleMessages = 30
+)
+
+const headlinePrompt = `You receive JSON with the metrics of one day of a Chinese group chat, the day's AI analysis when there is one, and sample messages. Write in Simplified Chinese:
+- "title": a catchy one-line headline about what the day was really about, like a newspaper headline or "今天群里为定价吵了一下午" (max 25 characters, no date, no quotes);
+- "tweet": a shareable summary of the day for social media (max 140 characters, no hashtags).
+Stay factual and friendly; do not mock anyone.
+
+Your response MUST be valid JSON: {"title": string, "tweet": string}`
+
+// Headline asks the model for a title and share text for a day. insights
+// may be nil; messages are sampled when it is.
+func (c Client) Headline(ctx context.Context, date, talker string, summary summarize.Summary, insights *Result, messages []chatlog.Message) (Headline, error) {
+	sum, err := c.Scrub.value(summary)
+	if err != nil {
+		return Headline{}, err
+	}
+	in := map[string]any{"date": date, "talker": talker, "summary": sum}
+	if insights != nil {
+		ins, err := c.Scrub.value(insights)
+		if err != nil {
+			return Headline{}, err
+		}
+		in["analysis"] = ins
+	} else {
+		in["messages"] = sampleMessages(messages, headlineSampleMessages, c.MaxChars, c.Scrub)
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return Headline{}, err
+	}
+	content, err := c.complete(ctx, headlinePrompt, string(body))
+	if err != nil {
+		return Headline{}, err
+	}
+	if i := strings.Index(content, "{"); i >= 0 {
+		if j := strings.LastIndex(content, "}"); j >= i {
+			content = content[i : j+1]
+		}
+	}
+	var h Headline
+	if err := json.Unmarshal([]byte(content), &h); err != nil {
+		return Headline{}, fmt.Errorf("parse llm response: %w", err)
+	}
+	h.Title = truncateRunes(strings.Trim(strings.TrimSpace(h.Title), `"“”「」`), maxTitleRunes)
+	h.Tweet = truncateRunes(strings.TrimSpace(h.Tweet), maxTweetRunes)
+	if h.Title == "" {
+		return Headline{}, fmt.Errorf("parse llm response: empty title")
+	}
+	return h, nil
+}
+
+// truncateRunes cuts s to at most n characters, ending with an ellipsis
+// when it was longer.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,44 @@
+package insight_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+)
+
+func TestHeadline(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	llm.SetContent(`{"title": "“今天群里为定价吵了一下午”", "tweet": "` + strings.Repeat("定价", 80) + `"}`)
+	client := insight.Client{BaseURL: llm.URL, Model: "m"}
+	msgs := []chatlog.Message{{SenderName: "阿强", Content: "这个价格太高了"}}
+
+	h, err := client.Headline(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Title != "今天群里为定价吵了一下午" || utf8.RuneCountInString(h.Tweet) != 140 || !strings.HasSuffix(h.Tweet, "…") {
+		t.Fatalf("headline = %+v", h)
+	}
+	// Without insights the messages are sent; with them, the analysis is.
+	if !strings.Contains(llm.LastPrompt(), "这个价格太高了") {
+		t.Fatalf("prompt = %s", llm.LastPrompt())
+	}
+	if _, err := client.Headline(context.Background(), "2025-10-16", "群", summarize.Summary{}, &testkit.SampleResult, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.LastPrompt(); strings.Contains(p, "这个价格太高了") || !strings.Contains(p, testkit.SampleResult.Overview) {
+		t.Fatalf("prompt = %s", p)
+	}
+
+	llm.SetContent(`{"title": "", "tweet": "x"}`)
+	if _, err := client.Headline(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil, msgs); err == nil {
+		t.Fatal("empty title accepted")
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"wechat-view/internal/chatlog"
 	"wechat-view/internal/summarize"
+	"wechat-view/internal/usage"
 )
 
 // Client talks to an OpenAI-compatible endpoint to generate richer insights.
@@ -25,6 +26,49 @@ type Client struct {
 	HTTP        *http.Client
 	MaxMessages int
 	MaxChars    int
+	// SystemPrompt replaces the built-in analyst prompt when set. It must
+	// still ask for the Result JSON schema.
+	SystemPrompt string
+	// Scrub, when set, removes personal data from the summary and messages
+	// before they are sent.
+	Scrub *Scrubber
+	// Meter, when set, records the tokens of every request.
+	Meter *usage.Meter
+	// MapReduce, when set, analyses long days in chunks instead of
+	// sampling their first MaxMessages.
+	MapReduce MapReduce
+	// Fallbacks are tried in order by Generate when the model fails.
+	Fallbacks []Fallback
+}
+
+// Fallback is another model for Generate to try. Empty BaseURL and APIKey
+// keep the Client's.
+type Fallback struct {
+	BaseURL string
+	Model   string
+	APIKey  string
+}
+
+// tokenUsage is the usage object of OpenAI-compatible responses.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// record adds a request to Meter. Endpoints that report no usage (some
+// local servers) are counted with EstimateTokens of what was sent and
+// received.
+func (c Client) record(u tokenUsage, sent []string, received string) {
+	if c.Meter == nil {
+		return
+	}
+	if u.PromptTokens == 0 && u.CompletionTokens == 0 {
+		for _, s := range sent {
+			u.PromptTokens += EstimateTokens(s)
+		}
+		u.CompletionTokens = EstimateTokens(received)
+	}
+	c.Meter.Record(c.Model, u.PromptTokens, u.CompletionTokens)
 }
 
 // Result captures structured insight from the language model.
@@ -35,6 +79,9 @@ type Result struct {
 	Risks         []string `json:"risks"`
 	Actions       []string `json:"actions"`
 	Spotlight     string   `json:"spotlight"`
+	// Model is the model that wrote the result, set by Generate; it differs
+	// from the Client's when a fallback answered.
+	Model string `json:"model,omitempty"`
 }
 
 const systemPrompt = `You are an experienced product operations analyst. You receive JSON containing aggregated metrics and sampled Chinese chat messages from a single day. Analyse the tone, themes, blockers and collaboration dynamics. Respond in Simplified Chinese with concise business language.
@@ -50,100 +97,223 @@ Your response MUST be valid JSON with the following schema:
 }
 Keep each bullet within 40 Chinese characters. If you lack information for a section, return an empty array or empty string.`
 
-// Generate calls the model and parses its structured response.
+// Generate calls the model and parses its structured response. When that
+// fails (an error, a timeout or a reply that does not parse), each of
+// Fallbacks is tried in turn; the error then lists every attempt.
 func (c Client) Generate(ctx context.Context, date, talker string, summary summarize.Summary, messages []chatlog.Message) (Result, error) {
-	if c.BaseURL == "" || c.Model == "" {
-		return Result{}, errors.New("missing llm configuration")
-	}
-	httpClient := c.HTTP
-	if httpClient == nil {
-		httpClient = &http.Client{Timeout: c.Timeout}
-	}
-	if c.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
-		defer cancel()
-	}
-
-	payload := map[string]any{
-		"date":     date,
-		"talker":   talker,
-		"summary":  summary,
-		"messages": sampleMessages(messages, c.MaxMessages, c.MaxChars),
+	res, err := c.generate(ctx, date, talker, summary, messages)
+	model := c.Model
+	for _, f := range c.Fallbacks {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		next := c.fallback(f)
+		var ferr error
+		if res, ferr = next.generate(ctx, date, talker, summary, messages); ferr != nil {
+			err = fmt.Errorf("%w; fallback %s: %v", err, next.Model, ferr)
+		} else {
+			err, model = nil, next.Model
+		}
 	}
-	body, err := json.Marshal(payload)
 	if err != nil {
 		return Result{}, err
 	}
+	res.Model = model
+	return res, nil
+}
 
-	reqBody := map[string]any{
-		"model":       c.Model,
-		"temperature": c.Temperature,
-		"messages": []map[string]string{
-			{"role": "system", "content": systemPrompt},
-			{"role": "user", "content": string(body)},
-		},
+// fallback returns c switched to f's endpoint and model.
+func (c Client) fallback(f Fallback) Client {
+	c.BaseURL = firstNonEmpty(f.BaseURL, c.BaseURL)
+	c.Model = f.Model
+	c.APIKey = firstNonEmpty(f.APIKey, c.APIKey)
+	return c
+}
+
+// AnsweredBy returns the client Generate used when model answered: c itself
+// or c switched to that fallback. Results are cached under its Key, so a
+// fallback's answer is never mistaken for the primary model's.
+func (c Client) AnsweredBy(model string) Client {
+	for _, f := range c.Fallbacks {
+		if f.Model == model && model != c.Model {
+			return c.fallback(f)
+		}
 	}
-	buf, err := json.Marshal(reqBody)
+	return c
+}
+
+// generate is one Generate attempt with c's model.
+func (c Client) generate(ctx context.Context, date, talker string, summary summarize.Summary, messages []chatlog.Message) (Result, error) {
+	if chunks := c.chunks(messages); len(chunks) > 1 {
+		return c.generateChunked(ctx, date, talker, summary, chunks)
+	} else if len(chunks) == 1 {
+		// One chunk holds the whole day: send all of it in one request.
+		c.MaxMessages = len(messages)
+	}
+	body, _, err := c.payload(date, talker, summary, messages)
 	if err != nil {
 		return Result{}, err
 	}
-
-	endpoint := strings.TrimRight(c.BaseURL, "/") + "/chat/completions"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
+	content, err := c.complete(ctx, c.prompt(), string(body))
 	if err != nil {
 		return Result{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	return parseResult(content)
+}
+
+// parseResult extracts the Result JSON from a reply, ignoring any text or
+// code fence around it.
+func parseResult(content string) (Result, error) {
+	if i := strings.Index(content, "{"); i >= 0 {
+		if j := strings.LastIndex(content, "}"); j >= i {
+			content = content[i : j+1]
+		}
 	}
 
-	resp, err := httpClient.Do(req)
+	var result Result
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return Result{}, fmt.Errorf("parse llm response: %w", err)
+	}
+	result.normalize()
+	return result, nil
+}
+
+// Estimate reports what Generate would send without calling the model:
+// how many messages it samples and roughly how many input tokens the
+// prompt and payload take.
+func (c Client) Estimate(date, talker string, summary summarize.Summary, messages []chatlog.Message) (sampled, tokens int, err error) {
+	if chunks := c.chunks(messages); len(chunks) > 1 {
+		return c.estimateChunked(date, talker, summary, chunks)
+	} else if len(chunks) == 1 {
+		c.MaxMessages = len(messages)
+	}
+	body, sampled, err := c.payload(date, talker, summary, messages)
 	if err != nil {
-		return Result{}, err
+		return 0, 0, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
-		return Result{}, fmt.Errorf("llm status %d: %s", resp.StatusCode, string(b))
+	return sampled, EstimateTokens(c.prompt()) + EstimateTokens(string(body)), nil
+}
+
+// payload is the user message of Generate and the number of messages
+// sampled into it.
+func (c Client) payload(date, talker string, summary summarize.Summary, messages []chatlog.Message) ([]byte, int, error) {
+	sum, err := c.Scrub.value(summary)
+	if err != nil {
+		return nil, 0, err
 	}
+	sampled := sampleMessages(messages, c.MaxMessages, c.MaxChars, c.Scrub)
+	body, err := json.Marshal(map[string]any{
+		"date":     date,
+		"talker":   talker,
+		"summary":  sum,
+		"messages": sampled,
+	})
+	return body, len(sampled), err
+}
 
+// Ping sends a minimal chat completion to check the endpoint, key and model
+// without spending tokens on a real summary.
+func (c Client) Ping(ctx context.Context) error {
+	_, err := c.complete(ctx, "Reply with the single word OK.", "ping")
+	return err
+}
+
+// complete sends one system and one user message and returns the trimmed
+// reply text.
+func (c Client) complete(ctx context.Context, system, user string) (string, error) {
+	reqBody := map[string]any{
+		"model":       c.Model,
+		"temperature": c.Temperature,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+	}
 	var raw struct {
 		Choices []struct {
 			Message struct {
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage tokenUsage `json:"usage"`
 		Error struct {
 			Message string `json:"message"`
 		} `json:"error"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
-		return Result{}, err
+	if err := c.post(ctx, "/chat/completions", reqBody, &raw); err != nil {
+		return "", err
 	}
 	if raw.Error.Message != "" {
-		return Result{}, errors.New(raw.Error.Message)
+		return "", errors.New(raw.Error.Message)
+	}
+	if len(raw.Choices) > 0 {
+		c.record(raw.Usage, []string{system, user}, raw.Choices[0].Message.Content)
 	}
 	if len(raw.Choices) == 0 {
-		return Result{}, errors.New("empty llm response")
+		return "", errors.New("empty llm response")
 	}
 	content := strings.TrimSpace(raw.Choices[0].Message.Content)
 	if content == "" {
-		return Result{}, errors.New("empty llm content")
+		return "", errors.New("empty llm content")
 	}
-	if i := strings.Index(content, "{"); i >= 0 {
-		if j := strings.LastIndex(content, "}"); j >= i {
-			content = content[i : j+1]
-		}
+	return content, nil
+}
+
+// post sends body as JSON to path under BaseURL and decodes the response
+// into out.
+func (c Client) post(ctx context.Context, path string, body, out any) error {
+	return c.request(ctx, path, body, func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+}
+
+// request sends body as JSON to path under BaseURL and hands a successful
+// response to read before the timeout is released.
+func (c Client) request(ctx context.Context, path string, body any, read func(*http.Response) error) error {
+	if c.BaseURL == "" || c.Model == "" {
+		return errors.New("missing llm configuration")
+	}
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: c.Timeout}
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 
-	var result Result
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		return Result{}, fmt.Errorf("parse llm response: %w", err)
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
 	}
-	result.normalize()
-	return result, nil
+	endpoint := strings.TrimRight(c.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
+		return fmt.Errorf("llm status %d: %s", resp.StatusCode, string(b))
+	}
+	return read(resp)
+}
+
+func (c Client) prompt() string {
+	if strings.TrimSpace(c.SystemPrompt) != "" {
+		return c.SystemPrompt
+	}
+	return systemPrompt
 }
 
 func (r *Result) normalize() {
@@ -169,7 +339,7 @@ func cleanSlice(in []string) []string {
 	return out
 }
 
-func sampleMessages(msgs []chatlog.Message, limit, maxChars int) []map[string]string {
+func sampleMessages(msgs []chatlog.Message, limit, maxChars int, scrub *Scrubber) []map[string]string {
 	if limit <= 0 {
 		limit = 60
 	}
@@ -181,7 +351,7 @@ func sampleMessages(msgs []chatlog.Message, limit, maxChars int) []map[string]st
 		if len(out) >= limit {
 			break
 		}
-		text := strings.TrimSpace(firstNonEmpty(m.Content, m.Text))
+		text := strings.TrimSpace(scrub.Text(firstNonEmpty(m.Content, m.Text)))
 		if text == "" {
 			if m.MsgType == 3 {
 				text = "[图片消息]"
@@ -0,0 +1,170 @@
+package insight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// MapReduce analyses days with more messages than Client.MaxMessages in
+// two passes: consecutive chunks of the day are summarised one request
+// each, then one more request turns the chunk summaries into the Result.
+// The zero value keeps the single sampled request.
+type MapReduce struct {
+	// ChunkMessages is how many consecutive messages one chunk holds.
+	ChunkMessages int
+	// MaxChunks bounds the chunk requests per day; longer days get larger
+	// chunks. Zero means no bound.
+	MaxChunks int
+}
+
+// mapConcurrency is how many chunk requests run at once.
+const mapConcurrency = 4
+
+// chunkSummaryTokens is what Estimate assumes a chunk summary takes.
+const chunkSummaryTokens = 300
+
+const chunkPrompt = `You receive JSON with one time window of a Chinese group chat: its position in the day and its messages. Summarise it for an analyst who will combine the summaries of all windows of the day. Respond in Simplified Chinese with at most 8 short lines, each starting with "- ": topics discussed, decisions, problems or blockers, commitments with their owners, and notable quotes. Say who said what when it matters. No preamble.`
+
+const reduceNote = `The day had too many messages for one request, so it was summarised in consecutive time windows. Instead of sampled messages, the JSON has "windows": each window's time range, message count and summary, in order. Base your analysis on all of them.`
+
+// key tells cached results of different chunkings apart.
+func (m MapReduce) key() string {
+	if m.ChunkMessages <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("+mr%d.%d", m.ChunkMessages, m.MaxChunks)
+}
+
+// chunks splits msgs for c, or returns nil when one sampled request covers
+// the day: map-reduce is off or the day has no more than MaxMessages.
+func (c Client) chunks(msgs []chatlog.Message) [][]chatlog.Message {
+	m := c.MapReduce
+	limit := c.MaxMessages
+	if limit <= 0 {
+		limit = 60
+	}
+	if m.ChunkMessages <= 0 || len(msgs) <= limit {
+		return nil
+	}
+	size := m.ChunkMessages
+	if m.MaxChunks > 0 && (len(msgs)+size-1)/size > m.MaxChunks {
+		size = (len(msgs) + m.MaxChunks - 1) / m.MaxChunks
+	}
+	var out [][]chatlog.Message
+	for start := 0; start < len(msgs); start += size {
+		out = append(out, msgs[start:min(start+size, len(msgs))])
+	}
+	return out
+}
+
+// Chunks returns how many chunk requests Generate makes for messages
+// before the final one, or 0 when it makes a single request.
+func (c Client) Chunks(messages []chatlog.Message) int {
+	if chunks := c.chunks(messages); len(chunks) > 1 {
+		return len(chunks)
+	}
+	return 0
+}
+
+// generateChunked is Generate for days split into chunks. A failed chunk
+// fails the day rather than leaving a gap in the analysis.
+func (c Client) generateChunked(ctx context.Context, date, talker string, summary summarize.Summary, chunks [][]chatlog.Message) (Result, error) {
+	summaries := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, mapConcurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk []chatlog.Message) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			body, err := c.chunkPayload(date, talker, i, len(chunks), chunk)
+			if err == nil {
+				summaries[i], err = c.complete(ctx, chunkPrompt, string(body))
+			}
+			errs[i] = err
+		}(i, chunk)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return Result{}, fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+		}
+	}
+
+	body, err := c.reducePayload(date, talker, summary, chunks, summaries)
+	if err != nil {
+		return Result{}, err
+	}
+	content, err := c.complete(ctx, c.reducePrompt(), string(body))
+	if err != nil {
+		return Result{}, err
+	}
+	return parseResult(content)
+}
+
+// estimateChunked is Estimate for days split into chunks, assuming each
+// chunk summary takes chunkSummaryTokens.
+func (c Client) estimateChunked(date, talker string, summary summarize.Summary, chunks [][]chatlog.Message) (sampled, tokens int, err error) {
+	for i, chunk := range chunks {
+		body, err := c.chunkPayload(date, talker, i, len(chunks), chunk)
+		if err != nil {
+			return 0, 0, err
+		}
+		sampled += len(chunk)
+		tokens += EstimateTokens(chunkPrompt) + EstimateTokens(string(body))
+	}
+	body, err := c.reducePayload(date, talker, summary, chunks, make([]string, len(chunks)))
+	if err != nil {
+		return 0, 0, err
+	}
+	tokens += EstimateTokens(c.reducePrompt()) + EstimateTokens(string(body)) + len(chunks)*chunkSummaryTokens
+	return sampled, tokens, nil
+}
+
+// chunkPayload is the user message summarising chunk i of n. Every message
+// of the chunk is sent, cut to MaxChars.
+func (c Client) chunkPayload(date, talker string, i, n int, chunk []chatlog.Message) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"date":     date,
+		"talker":   talker,
+		"window":   fmt.Sprintf("%d/%d", i+1, n),
+		"from":     displayTime(chunk[0]),
+		"to":       displayTime(chunk[len(chunk)-1]),
+		"messages": sampleMessages(chunk, len(chunk), c.MaxChars, c.Scrub),
+	})
+}
+
+// reducePayload is the user message of the final request: the day's
+// metrics and each chunk's summary in place of sampled messages.
+func (c Client) reducePayload(date, talker string, summary summarize.Summary, chunks [][]chatlog.Message, summaries []string) ([]byte, error) {
+	sum, err := c.Scrub.value(summary)
+	if err != nil {
+		return nil, err
+	}
+	windows := make([]map[string]any, len(chunks))
+	for i, chunk := range chunks {
+		windows[i] = map[string]any{
+			"from":     displayTime(chunk[0]),
+			"to":       displayTime(chunk[len(chunk)-1]),
+			"messages": len(chunk),
+			"summary":  summaries[i],
+		}
+	}
+	return json.Marshal(map[string]any{
+		"date":    date,
+		"talker":  talker,
+		"summary": sum,
+		"windows": windows,
+	})
+}
+
+func (c Client) reducePrompt() string {
+	return c.prompt() + "\n\n" + reduceNote
+}
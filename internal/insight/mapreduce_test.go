@@ -0,0 +1,56 @@
+package insight_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+)
+
+func TestGenerateMapReduce(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	msgs := make([]chatlog.Message, 250)
+	for i := range msgs {
+		msgs[i] = chatlog.Message{SenderName: "阿强", Time: fmt.Sprintf("10:%02d:00", i%60), Content: fmt.Sprintf("第 %d 条消息", i)}
+	}
+	client := insight.Client{BaseURL: llm.URL, Model: "m", MaxMessages: 60, MapReduce: insight.MapReduce{ChunkMessages: 100, MaxChunks: 10}}
+
+	res, err := client.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Overview != testkit.SampleResult.Overview {
+		t.Fatalf("result = %+v", res)
+	}
+	// Three chunks of up to 100 messages, then the synthesis.
+	if n := llm.Requests(); n != 4 || client.Chunks(msgs) != 3 {
+		t.Fatalf("requests = %d, chunks = %d, want 4 and 3", n, client.Chunks(msgs))
+	}
+	if p := llm.LastPrompt(); !strings.Contains(p, `"windows"`) || strings.Contains(p, "第 249 条消息") {
+		t.Fatalf("synthesis prompt = %s", p)
+	}
+
+	// MaxChunks grows the chunks instead of adding requests.
+	client.MapReduce.MaxChunks = 2
+	if n := client.Chunks(msgs); n != 2 {
+		t.Fatalf("chunks with maxChunks 2 = %d", n)
+	}
+
+	// A day that fits in one chunk is sent whole in a single request.
+	before := llm.Requests()
+	if _, err := client.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, msgs[:90]); err != nil {
+		t.Fatal(err)
+	}
+	if n := llm.Requests() - before; n != 1 || !strings.Contains(llm.LastPrompt(), "第 89 条消息") {
+		t.Fatalf("requests = %d, prompt = %.200s", n, llm.LastPrompt())
+	}
+	if _, tokens, err := client.Estimate("2025-10-16", "群", summarize.Summary{}, msgs); err != nil || tokens <= 0 {
+		t.Fatalf("estimate = %d, %v", tokens, err)
+	}
+}
@@ -0,0 +1,147 @@
+package insight
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"wechat-view/internal/summarize"
+)
+
+// Placeholders that replace scrubbed text, so the model still sees that
+// something was there.
+const (
+	scrubPhone    = "[电话]"
+	scrubEmail    = "[邮箱]"
+	scrubBankCard = "[银行卡]"
+	scrubAddress  = "[地址]"
+	scrubCustom   = "[已隐去]"
+)
+
+var (
+	// bankCardRe matches 16-19 digit card numbers, optionally grouped by
+	// spaces or dashes; matches must also pass the Luhn check.
+	bankCardRe = regexp.MustCompile(`\d{4}(?:[ -]?\d{4}){3}(?:[ -]?\d{1,3})?`)
+	// addressRe is a heuristic for street addresses: an optional run of
+	// province/city/district names, a road and a house number, and
+	// optionally building, unit and room.
+	addressRe = regexp.MustCompile(`(?:\p{Han}{2,8}?(?:省|自治区|市|州|区|县|镇|乡))*\p{Han}{1,10}?(?:路|街|大道|大街|巷|弄|胡同)\d+(?:-\d+)?号(?:院)?(?:\d+(?:号楼|栋|幢|单元|层|楼|室))*`)
+)
+
+// Scrubber removes personal data from what is sent to the model: phone
+// numbers, email addresses, bank card numbers, street addresses and any
+// extra patterns are replaced by placeholders such as [电话]. It works on
+// text only and does not rename senders; see report.anonymize for that.
+type Scrubber struct {
+	patterns []*regexp.Regexp
+}
+
+// NewScrubber returns a Scrubber with the built-in rules plus patterns,
+// which are Go regular expressions.
+func NewScrubber(patterns []string) (*Scrubber, error) {
+	s := &Scrubber{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("scrub pattern %q: %w", p, err)
+		}
+		s.patterns = append(s.patterns, re)
+	}
+	return s, nil
+}
+
+// key identifies the scrubbing rules for cache keys: empty when s is nil.
+func (s *Scrubber) key() string {
+	if s == nil {
+		return ""
+	}
+	parts := []string{"scrub"}
+	for _, re := range s.patterns {
+		parts = append(parts, re.String())
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// Text returns text with personal data replaced. A nil Scrubber returns
+// text unchanged.
+func (s *Scrubber) Text(text string) string {
+	if s == nil || text == "" {
+		return text
+	}
+	for _, re := range s.patterns {
+		text = re.ReplaceAllString(text, scrubCustom)
+	}
+	text = bankCardRe.ReplaceAllStringFunc(text, func(m string) string {
+		if luhn(m) {
+			return scrubBankCard
+		}
+		return m
+	})
+	text = summarize.ReplaceContacts(text, func(kind, _ string) string {
+		if kind == summarize.EntityEmail {
+			return scrubEmail
+		}
+		return scrubPhone
+	})
+	return addressRe.ReplaceAllString(text, scrubAddress)
+}
+
+// value returns v with Text applied to every string in it, by way of its
+// JSON form, so summaries quoting messages are scrubbed as well.
+func (s *Scrubber) value(v any) (any, error) {
+	if s == nil {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return s.walk(doc), nil
+}
+
+func (s *Scrubber) walk(v any) any {
+	switch x := v.(type) {
+	case string:
+		return s.Text(x)
+	case map[string]any:
+		for k, item := range x {
+			x[k] = s.walk(item)
+		}
+	case []any:
+		for i, item := range x {
+			x[i] = s.walk(item)
+		}
+	}
+	return v
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum used by bank
+// cards.
+func luhn(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 16 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
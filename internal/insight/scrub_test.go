@@ -0,0 +1,43 @@
+package insight_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+)
+
+func TestScrubberText(t *testing.T) {
+	s, err := insight.NewScrubber([]string{`工号\d{6}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "电话13812345678，卡号6222 0200 0000 0000 000，地址：北京市朝阳区建国路88号3号楼1201室，工号123456，邮箱a@b.com，订单1234567890123456"
+	want := "电话[电话]，卡号[银行卡]，地址：[地址]，[已隐去]，邮箱[邮箱]，订单1234567890123456"
+	if got := s.Text(in); got != want {
+		t.Fatalf("Text = %q\nwant  %q", got, want)
+	}
+	if _, err := insight.NewScrubber([]string{"("}); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestGenerateScrubsBeforeSending(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	scrub, _ := insight.NewScrubber(nil)
+	client := insight.Client{BaseURL: llm.URL, Model: "m", Scrub: scrub}
+	msgs := []chatlog.Message{{SenderName: "阿强", MsgType: 1, Content: "有事打我 13812345678"}}
+	sum := summarize.Summary{Highlights: []string{"谁有 13900001111 的联系人？"}}
+	if _, err := client.Generate(context.Background(), "2025-10-16", "group", sum, msgs); err != nil {
+		t.Fatal(err)
+	}
+	prompt := llm.LastPrompt()
+	if strings.Contains(prompt, "13812345678") || strings.Contains(prompt, "13900001111") || !strings.Contains(prompt, "[电话]") {
+		t.Fatalf("prompt not scrubbed: %s", prompt)
+	}
+}
@@ -0,0 +1,18 @@
+package insight
+
+import "unicode"
+
+// EstimateTokens roughly counts the tokens s takes in common BPE
+// tokenizers: one per CJK character and one per four bytes of other text.
+// It is meant for plans and budgets, not for exact billing.
+func EstimateTokens(s string) int {
+	cjk, other := 0, 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other += len(string(r))
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -0,0 +1,82 @@
+package insight_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/testkit"
+	"wechat-view/internal/usage"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"部署失败", 4},
+		{"deploy", 2},
+		{"部署 deploy", 4},
+	} {
+		if got := insight.EstimateTokens(tc.in); got != tc.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestEstimateSamplesLikeGenerate(t *testing.T) {
+	msgs := make([]chatlog.Message, 10)
+	for i := range msgs {
+		msgs[i] = chatlog.Message{Sender: "阿强", Content: strings.Repeat("部署", 50)}
+	}
+	msgs[3].Content = ""
+	c := insight.Client{MaxMessages: 5, MaxChars: 20}
+	sampled, tokens, err := c.Estimate("2025-09-17", "测试群", summarize.Summary{}, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampled != 5 {
+		t.Fatalf("应抽样 5 条，实际 %d", sampled)
+	}
+	long := insight.Client{MaxMessages: 5, MaxChars: 100}
+	if _, more, _ := long.Estimate("2025-09-17", "测试群", summarize.Summary{}, msgs); more <= tokens+5*60 {
+		t.Fatalf("放宽 maxChars 后估算应增加: %d -> %d", tokens, more)
+	}
+}
+
+func TestMeterRecordsUsage(t *testing.T) {
+	llm := testkit.NewLLMServer()
+	defer llm.Close()
+	llm.SetContent("好的")
+	path := filepath.Join(t.TempDir(), usage.FileName)
+	meter := usage.NewMeter(path, map[string]usage.Price{"m": {Prompt: 1, Completion: 2}}, "USD")
+	client := insight.Client{BaseURL: llm.URL, Model: "m", Meter: meter}
+
+	// 非流式响应带 usage，按响应记录。
+	if _, err := client.Answer(context.Background(), "问", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := meter.Total()
+	if got.Requests != 1 || got.PromptTokens == 0 || got.CompletionTokens != 2 {
+		t.Fatalf("非流式用量 = %+v", got)
+	}
+	// 流式响应没有 usage，按估算记录。
+	if _, err := client.Answer(context.Background(), "问", nil, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got = meter.Total(); got.Requests != 2 || got.CompletionTokens != 4 {
+		t.Fatalf("流式用量 = %+v", got)
+	}
+	if _, err := meter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := usage.Load(path)
+	if err != nil || l.DaysOf("")[0].Requests != 2 {
+		t.Fatalf("账本 = %+v, %v", l, err)
+	}
+}
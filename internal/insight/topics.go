@@ -0,0 +1,100 @@
+package insight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// topicSampleMessages is how many messages mentioning a topic are sent with
+// it for a deep dive.
+const topicSampleMessages = 20
+
+const deepDivePrompt = `You receive JSON with the main topics of one day of a Chinese group chat. Each has an index, a name, its keywords, how many messages mention it and sample messages. For each topic write, in Simplified Chinese: an explanation of what was discussed in exactly 3 sentences, the key viewpoints (2-4 short bullets; say who holds them when the messages show it), and the questions left open (0-3 short bullets). Use only what the messages say.
+
+Your response MUST be a valid JSON array:
+[{"index": number, "explanation": string, "viewpoints": [string], "openQuestions": [string]}]`
+
+// DeepDiveTopics asks the model to explain each topic from the messages
+// that mention it, in one request for all of them. It returns a copy of
+// topics with DeepDive set on those the model answered for.
+func (c Client) DeepDiveTopics(ctx context.Context, topics []summarize.Topic, messages []chatlog.Message) ([]summarize.Topic, error) {
+	if len(topics) == 0 {
+		return topics, nil
+	}
+	type input struct {
+		Index    int                 `json:"index"`
+		Name     string              `json:"name"`
+		Keywords []string            `json:"keywords"`
+		Count    int                 `json:"count"`
+		Messages []map[string]string `json:"messages"`
+	}
+	in := make([]input, len(topics))
+	for i, tp := range topics {
+		in[i] = input{
+			Index:    i,
+			Name:     c.Scrub.Text(tp.Name),
+			Keywords: tp.Keywords,
+			Count:    tp.Count,
+			Messages: sampleMessages(topicMessages(tp, messages), topicSampleMessages, c.MaxChars, c.Scrub),
+		}
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.complete(ctx, deepDivePrompt, string(body))
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.Index(content, "["); i >= 0 {
+		if j := strings.LastIndex(content, "]"); j >= i {
+			content = content[i : j+1]
+		}
+	}
+	var dives []struct {
+		Index int `json:"index"`
+		summarize.TopicDeepDive
+	}
+	if err := json.Unmarshal([]byte(content), &dives); err != nil {
+		return nil, fmt.Errorf("parse llm response: %w", err)
+	}
+	out := append([]summarize.Topic(nil), topics...)
+	seen := map[int]bool{}
+	for _, d := range dives {
+		dive := d.TopicDeepDive
+		dive.Explanation = strings.TrimSpace(dive.Explanation)
+		dive.Viewpoints = cleanSlice(dive.Viewpoints)
+		dive.OpenQuestions = cleanSlice(dive.OpenQuestions)
+		if d.Index < 0 || d.Index >= len(out) || seen[d.Index] || dive.Explanation == "" {
+			continue
+		}
+		seen[d.Index] = true
+		out[d.Index].DeepDive = &dive
+	}
+	return out, nil
+}
+
+// topicMessages returns the messages mentioning tp's name or one of its
+// keywords, or its representative message when none do.
+func topicMessages(tp summarize.Topic, messages []chatlog.Message) []chatlog.Message {
+	terms := append([]string{tp.Name}, tp.Keywords...)
+	var out []chatlog.Message
+	for _, m := range messages {
+		text := firstNonEmpty(m.Content, m.Text)
+		for _, term := range terms {
+			if term = strings.TrimSpace(term); term != "" && strings.Contains(text, term) {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	if len(out) == 0 && tp.Representative != "" {
+		out = append(out, chatlog.Message{Content: tp.Representative})
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+// Package media archives images referenced by chat messages so day pages
+// keep working after the chatlog service is gone.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/chatlog"
+)
+
+// Downloader fetches images from the chatlog image endpoint into
+// Dir/YYYY-MM-DD/<md5>.<ext>.
+type Downloader struct {
+	BaseURL string
+	Dir     string
+	// MaxBytes skips files larger than this; 0 means 20 MiB.
+	MaxBytes int64
+	HTTP     *http.Client
+}
+
+// Result counts what a Download call did.
+type Result struct {
+	Downloaded int
+	Existing   int
+	Failed     int
+}
+
+// ImageURL is the chatlog endpoint for an image message. Backslashes in the
+// path are kept as the local API expects them.
+func ImageURL(base string, m chatlog.Message) string {
+	if base == "" || m.MediaPath == "" || m.MediaMD5 == "" {
+		return ""
+	}
+	return strings.TrimRight(base, "/") + "/image/" + m.MediaMD5 + "," + m.MediaPath
+}
+
+// Download stores every image in msgs that is not archived yet. Individual
+// failures are counted, not returned; the error is reserved for problems
+// with the target directory.
+func (d Downloader) Download(ctx context.Context, day string, msgs []chatlog.Message) (Result, error) {
+	var res Result
+	dir := filepath.Join(d.Dir, day)
+	for _, m := range msgs {
+		if m.MsgType != 3 || m.MediaMD5 == "" || !safeName(m.MediaMD5) {
+			continue
+		}
+		if _, ok := Find(d.Dir, day, m.MediaMD5); ok {
+			res.Existing++
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return res, err
+		}
+		if err := d.fetch(ctx, dir, m); err != nil {
+			res.Failed++
+			continue
+		}
+		res.Downloaded++
+	}
+	return res, nil
+}
+
+func (d Downloader) fetch(ctx context.Context, dir string, m chatlog.Message) error {
+	u := ImageURL(d.BaseURL, m)
+	if u == "" {
+		return errors.New("no image url")
+	}
+	client := d.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	max := d.MaxBytes
+	if max <= 0 {
+		max = 20 << 20
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		return fmt.Errorf("image larger than %d bytes", max)
+	}
+	ctype := resp.Header.Get("Content-Type")
+	if ctype == "" || strings.HasPrefix(ctype, "application/octet-stream") {
+		ctype = http.DetectContentType(body)
+	}
+	if !strings.HasPrefix(ctype, "image/") {
+		return fmt.Errorf("unexpected content type %q", ctype)
+	}
+	name := m.MediaMD5 + extension(ctype)
+	return atomicfile.WriteFile(filepath.Join(dir, name), body)
+}
+
+// Find returns the archived file for md5 on day, if any.
+func Find(root, day, md5 string) (string, bool) {
+	if !safeName(md5) {
+		return "", false
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, day, md5+".*"))
+	if len(matches) == 0 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+func extension(ctype string) string {
+	ctype, _, _ = mime.ParseMediaType(ctype)
+	switch ctype {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".img"
+}
+
+// safeName guards file names built from message fields.
+func safeName(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,54 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestDownload(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != `/image/abc123,msg\img.dat` {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(png)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	d := Downloader{BaseURL: srv.URL, Dir: root}
+	msgs := []chatlog.Message{
+		{MsgType: 3, MediaMD5: "abc123", MediaPath: `msg\img.dat`},
+		{MsgType: 3, MediaMD5: "missing", MediaPath: "x"},
+		{MsgType: 3, MediaMD5: "../evil", MediaPath: "x"},
+		{MsgType: 1, Content: "hi"},
+	}
+	res, err := d.Download(context.Background(), "2025-10-16", msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Downloaded != 1 || res.Failed != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	path, ok := Find(root, "2025-10-16", "abc123")
+	if !ok {
+		t.Fatal("archived image not found")
+	}
+	if b, _ := os.ReadFile(path); string(b) != string(png) || path[len(path)-4:] != ".png" {
+		t.Fatalf("archived %s with %q", path, b)
+	}
+
+	before := hits
+	res, _ = d.Download(context.Background(), "2025-10-16", msgs[:1])
+	if res.Existing != 1 || hits != before {
+		t.Fatalf("second run should reuse the archive: %+v hits=%d", res, hits-before)
+	}
+}
@@ -0,0 +1,245 @@
+package members
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/redact"
+)
+
+// Member aggregates one sender's activity across the archive.
+type Member struct {
+	Key        string         `json:"key"`
+	Name       string         `json:"name"`
+	FirstSeen  string         `json:"firstSeen"`
+	LastSeen   string         `json:"lastSeen"`
+	ActiveDays int            `json:"activeDays"`
+	Messages   int            `json:"messages"`
+	PeakMonth  string         `json:"peakMonth"`
+	PeakCount  int            `json:"peakCount"`
+	Monthly    map[string]int `json:"monthly"`
+	// SilentDays is filled in month reports: days since LastSeen.
+	SilentDays int `json:"silentDays,omitempty"`
+	// days lists the days with messages, oldest first, so month reports
+	// can look at the member as of an earlier day.
+	days []string
+}
+
+// upTo returns m as it stood at the end of day: LastSeen, ActiveDays,
+// Messages and the peak month only count days up to day, by month for
+// the message counts. Members built without Add are returned unchanged.
+func (m Member) upTo(day string) Member {
+	if len(m.days) == 0 || m.LastSeen <= day {
+		return m
+	}
+	n := sort.SearchStrings(m.days, day+"\x00")
+	m.days = m.days[:n]
+	m.ActiveDays = n
+	if n > 0 {
+		m.LastSeen = m.days[n-1]
+	}
+	month := day[:7]
+	monthly := make(map[string]int, len(m.Monthly))
+	m.Messages, m.PeakMonth, m.PeakCount = 0, "", 0
+	for mo, c := range m.Monthly {
+		if mo > month {
+			continue
+		}
+		monthly[mo] = c
+		m.Messages += c
+		if c > m.PeakCount || c == m.PeakCount && mo < m.PeakMonth {
+			m.PeakMonth, m.PeakCount = mo, c
+		}
+	}
+	m.Monthly = monthly
+	return m
+}
+
+// MonthReport is the lifecycle view for one calendar month.
+type MonthReport struct {
+	Month       string   `json:"month"`
+	AsOf        string   `json:"asOf"`
+	ActiveCount int      `json:"activeCount"`
+	KnownCount  int      `json:"knownCount"`
+	Activated   []Member `json:"activated"`
+	AtRisk      []Member `json:"atRisk"`
+	Top         []Member `json:"top"`
+}
+
+// Options tune the churn heuristic.
+type Options struct {
+	// SilentDays of no messages before a regular member counts as at risk.
+	SilentDays int
+	// MinActiveDays a member needs before their silence is meaningful.
+	MinActiveDays int
+}
+
+// WithDefaults fills unset thresholds: 14 silent days, 3 active days.
+func (o Options) WithDefaults() Options {
+	if o.SilentDays <= 0 {
+		o.SilentDays = 14
+	}
+	if o.MinActiveDays <= 0 {
+		o.MinActiveDays = 3
+	}
+	return o
+}
+
+// Scan reads every day in dataDir, including the history of days whose raw
+// file retention removed, and returns members keyed by sender id (falling
+// back to display name) plus the days scanned, oldest first. With a non-nil
+// anon, members are keyed and named by their pseudonyms.
+func Scan(dataDir string, anon *redact.Redactor) (map[string]*Member, []string, error) {
+	days, err := archive.HistoryDays(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(map[string]*Member)
+	for _, day := range days {
+		msgs, err := archive.LoadDayMessages(dataDir, day)
+		if err != nil {
+			return nil, nil, err
+		}
+		Add(out, day, anon.Messages(msgs))
+	}
+	return out, days, nil
+}
+
+// Add folds one day's messages into members.
+func Add(members map[string]*Member, day string, msgs []chatlog.Message) {
+	month := day[:7]
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		key, name := senderKey(m)
+		if key == "" {
+			continue
+		}
+		mem := members[key]
+		if mem == nil {
+			mem = &Member{Key: key, FirstSeen: day, Monthly: map[string]int{}}
+			members[key] = mem
+		}
+		if name != "" {
+			mem.Name = name
+		}
+		if mem.Name == "" {
+			mem.Name = key
+		}
+		if day < mem.FirstSeen {
+			mem.FirstSeen = day
+		}
+		if day > mem.LastSeen {
+			mem.LastSeen = day
+		}
+		mem.Messages++
+		mem.Monthly[month]++
+		if c := mem.Monthly[month]; c > mem.PeakCount {
+			mem.PeakCount = c
+			mem.PeakMonth = month
+		}
+		if !seen[key] {
+			seen[key] = true
+			mem.ActiveDays++
+			if i := sort.SearchStrings(mem.days, day); i == len(mem.days) || mem.days[i] != day {
+				mem.days = append(mem.days, "")
+				copy(mem.days[i+1:], mem.days[i:])
+				mem.days[i] = day
+			}
+		}
+	}
+}
+
+// BuildMonth derives the lifecycle report for month (YYYY-MM) as of asOf,
+// normally the last day with data in or before that month. Members are
+// taken as they stood on asOf, so an old month shows who was at risk then,
+// not who is silent today.
+func BuildMonth(members map[string]*Member, month, asOf string, opts Options) MonthReport {
+	opts = opts.WithDefaults()
+	rep := MonthReport{Month: month, AsOf: asOf}
+	asOfTime, _ := time.Parse("2006-01-02", asOf)
+	for _, all := range members {
+		if all.FirstSeen > asOf {
+			continue
+		}
+		mem := all.upTo(asOf)
+		rep.KnownCount++
+		if mem.Monthly[month] > 0 {
+			rep.ActiveCount++
+			rep.Top = append(rep.Top, mem)
+		}
+		if strings.HasPrefix(mem.FirstSeen, month) {
+			rep.Activated = append(rep.Activated, mem)
+		}
+		last, err := time.Parse("2006-01-02", mem.LastSeen)
+		if err != nil || asOfTime.IsZero() {
+			continue
+		}
+		silent := int(asOfTime.Sub(last).Hours() / 24)
+		if silent >= opts.SilentDays && mem.ActiveDays >= opts.MinActiveDays {
+			mem.SilentDays = silent
+			rep.AtRisk = append(rep.AtRisk, mem)
+		}
+	}
+	sort.Slice(rep.Activated, func(i, j int) bool {
+		if rep.Activated[i].FirstSeen == rep.Activated[j].FirstSeen {
+			return rep.Activated[i].Messages > rep.Activated[j].Messages
+		}
+		return rep.Activated[i].FirstSeen < rep.Activated[j].FirstSeen
+	})
+	sort.Slice(rep.AtRisk, func(i, j int) bool {
+		return rep.AtRisk[i].Messages > rep.AtRisk[j].Messages
+	})
+	sort.Slice(rep.Top, func(i, j int) bool {
+		return rep.Top[i].Monthly[month] > rep.Top[j].Monthly[month]
+	})
+	if len(rep.Top) > 10 {
+		rep.Top = rep.Top[:10]
+	}
+	return rep
+}
+
+// Months lists the YYYY-MM months covered by days, oldest first.
+func Months(days []string) []string {
+	var out []string
+	for _, d := range days {
+		if len(d) < 7 {
+			continue
+		}
+		if m := d[:7]; len(out) == 0 || out[len(out)-1] != m {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// AsOf returns the last day in days that falls on or before month's end.
+func AsOf(days []string, month string) string {
+	asOf := ""
+	for _, d := range days {
+		if d[:7] <= month {
+			asOf = d
+		}
+	}
+	return asOf
+}
+
+func senderKey(m chatlog.Message) (string, string) {
+	name := strings.TrimSpace(m.SenderName)
+	if name == "" {
+		name = strings.TrimSpace(m.Nickname)
+	}
+	key := strings.TrimSpace(m.Sender)
+	if key == "" {
+		key = strings.TrimSpace(m.From)
+	}
+	if key == "" {
+		key = name
+	}
+	if key == "系统消息" || m.MsgType == 10000 {
+		return "", ""
+	}
+	return key, name
+}
@@ -0,0 +1,55 @@
+package members
+
+import (
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestBuildMonth(t *testing.T) {
+	all := map[string]*Member{}
+	msg := func(sender string) chatlog.Message {
+		return chatlog.Message{Sender: sender, SenderName: sender + "-name", MsgType: 1}
+	}
+	for _, day := range []string{"2025-09-01", "2025-09-02", "2025-09-03"} {
+		Add(all, day, []chatlog.Message{msg("old"), msg("steady")})
+	}
+	Add(all, "2025-10-20", []chatlog.Message{msg("steady"), msg("new"), msg("new")})
+	Add(all, "2025-10-20", []chatlog.Message{{Sender: "系统消息", MsgType: 10000}})
+
+	rep := BuildMonth(all, "2025-10", "2025-10-20", Options{})
+	if rep.KnownCount != 3 || rep.ActiveCount != 2 {
+		t.Fatalf("counts = known %d active %d, want 3 and 2", rep.KnownCount, rep.ActiveCount)
+	}
+	if len(rep.Activated) != 1 || rep.Activated[0].Key != "new" || rep.Activated[0].Name != "new-name" {
+		t.Fatalf("activated = %+v", rep.Activated)
+	}
+	if len(rep.AtRisk) != 1 || rep.AtRisk[0].Key != "old" || rep.AtRisk[0].SilentDays != 47 {
+		t.Fatalf("at risk = %+v", rep.AtRisk)
+	}
+	if all["new"].PeakMonth != "2025-10" || all["new"].PeakCount != 2 {
+		t.Fatalf("peak = %s/%d", all["new"].PeakMonth, all["new"].PeakCount)
+	}
+}
+
+func TestBuildMonthUsesLastSeenAsOfMonthEnd(t *testing.T) {
+	all := map[string]*Member{}
+	msg := chatlog.Message{Sender: "back", SenderName: "回归者", MsgType: 1}
+	for _, day := range []string{"2025-08-01", "2025-08-02", "2025-08-03"} {
+		Add(all, day, []chatlog.Message{msg})
+	}
+	// 九月沉默，十月又回来发言。
+	Add(all, "2025-09-30", []chatlog.Message{{Sender: "other", MsgType: 1}})
+	Add(all, "2025-10-20", []chatlog.Message{msg})
+
+	rep := BuildMonth(all, "2025-09", "2025-09-30", Options{})
+	if len(rep.AtRisk) != 1 || rep.AtRisk[0].Key != "back" || rep.AtRisk[0].SilentDays != 58 {
+		t.Fatalf("九月底应判为流失风险: %+v", rep.AtRisk)
+	}
+	if got := rep.AtRisk[0]; got.LastSeen != "2025-08-03" || got.ActiveDays != 3 || got.Messages != 3 {
+		t.Fatalf("应按九月底的状态展示: %+v", got)
+	}
+	if rep := BuildMonth(all, "2025-10", "2025-10-20", Options{}); len(rep.AtRisk) != 0 {
+		t.Fatalf("十月已回归，不应判为流失风险: %+v", rep.AtRisk)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DingTalk posts digests to a DingTalk custom robot. When Secret is set the
+// request is signed ("加签" security mode).
+type DingTalk struct {
+	WebhookURL string
+	Secret     string
+	HTTP       *http.Client
+	// now is overridable in tests.
+	now func() time.Time
+}
+
+// Name implements Notifier.
+func (d DingTalk) Name() string { return "dingtalk" }
+
+// Notify implements Notifier.
+func (d DingTalk) Notify(ctx context.Context, dg Digest) error {
+	if d.WebhookURL == "" {
+		return errors.New("missing webhook url")
+	}
+	endpoint := d.WebhookURL
+	if d.Secret != "" {
+		now := time.Now
+		if d.now != nil {
+			now = d.now
+		}
+		ts := strconv.FormatInt(now().UnixMilli(), 10)
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		q.Set("timestamp", ts)
+		q.Set("sign", dingTalkSign(ts, d.Secret))
+		u.RawQuery = q.Encode()
+		endpoint = u.String()
+	}
+	payload := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": dg.Title(),
+			"text":  dg.Markdown(),
+		},
+	}
+	var resp robotResponse
+	if err := postJSON(ctx, d.HTTP, endpoint, payload, &resp); err != nil {
+		return err
+	}
+	return resp.err()
+}
+
+// dingTalkSign computes base64(HmacSHA256(secret, timestamp+"\n"+secret)).
+func dingTalkSign(timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,207 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"wechat-view/internal/notify"
+)
+
+// DefaultSubject is used when no subject template is configured.
+const DefaultSubject = "{{.Talker}} · {{.Date}} 群聊日报"
+
+// TLS modes for Sender.TLS.
+const (
+	TLSStartTLS = "starttls" // upgrade a plain connection (default, port 587)
+	TLSImplicit = "tls"      // TLS from the first byte (port 465)
+	TLSNone     = "none"     // plain text, only for local relays
+)
+
+// Sender delivers digests over SMTP as multipart/alternative mail: a plain
+// text summary plus the rendered day page as the HTML part.
+type Sender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	TLS      string
+	// InsecureSkipVerify disables certificate checks for self-signed relays.
+	InsecureSkipVerify bool
+	// Subject is a text/template over notify.Digest.
+	Subject string
+	Timeout time.Duration
+}
+
+// Name implements notify.Notifier.
+func (s Sender) Name() string { return "email" }
+
+// Notify implements notify.Notifier.
+func (s Sender) Notify(ctx context.Context, d notify.Digest) error {
+	if s.Host == "" || s.From == "" || len(s.To) == 0 {
+		return errors.New("email requires host, from and at least one recipient")
+	}
+	subject, err := renderSubject(s.Subject, d)
+	if err != nil {
+		return err
+	}
+	msg, err := buildMessage(s.From, s.To, subject, d, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, msg)
+}
+
+func renderSubject(tpl string, d notify.Digest) (string, error) {
+	if strings.TrimSpace(tpl) == "" {
+		tpl = DefaultSubject
+	}
+	t, err := template.New("subject").Parse(tpl)
+	if err != nil {
+		return "", fmt.Errorf("parse subject template: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("render subject: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// buildMessage assembles the RFC 5322 message with base64 encoded parts.
+func buildMessage(from string, to []string, subject string, d notify.Digest, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.BEncoding.Encode("UTF-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct{ ctype, body string }{
+		{"text/plain; charset=utf-8", d.Markdown()},
+	}
+	if d.HTML != "" {
+		parts = append(parts, struct{ ctype, body string }{"text/html; charset=utf-8", d.HTML})
+	}
+	for _, p := range parts {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", p.ctype)
+		h.Set("Content-Transfer-Encoding", "base64")
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(wrapBase64([]byte(p.body))); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func wrapBase64(b []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(b)
+	var out bytes.Buffer
+	for len(enc) > 76 {
+		out.WriteString(enc[:76])
+		out.WriteString("\r\n")
+		enc = enc[76:]
+	}
+	out.WriteString(enc)
+	out.WriteString("\r\n")
+	return out.Bytes()
+}
+
+func (s Sender) send(ctx context.Context, msg []byte) error {
+	mode := strings.ToLower(strings.TrimSpace(s.TLS))
+	if mode == "" {
+		mode = TLSStartTLS
+	}
+	port := s.Port
+	if port == 0 {
+		port = 587
+		if mode == TLSImplicit {
+			port = 465
+		}
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.Host, InsecureSkipVerify: s.InsecureSkipVerify}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	switch mode {
+	case TLSImplicit:
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	case TLSStartTLS, TLSNone:
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	default:
+		return fmt.Errorf("unknown tls mode %q", s.TLS)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if mode == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS; set tls to \"tls\" or \"none\"")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, rcpt := range s.To {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,54 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/notify"
+)
+
+func TestBuildMessage(t *testing.T) {
+	d := notify.Digest{Date: "2025-10-16", Talker: "AI技术交流群", TotalMessages: 8, HTML: "<html><body>日报</body></html>"}
+	subject, err := renderSubject("[{{.Talker}}] {{.Date}} · {{.TotalMessages}} 条", d)
+	if err != nil {
+		t.Fatalf("渲染主题失败: %v", err)
+	}
+	raw, err := buildMessage("report@example.com", []string{"a@example.com", "b@example.com"}, subject, d, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("构建邮件失败: %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	dec := new(mime.WordDecoder)
+	gotSubject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if gotSubject != "[AI技术交流群] 2025-10-16 · 8 条" {
+		t.Fatalf("主题不符: %s", gotSubject)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("解析 Content-Type 失败: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("读取分段失败: %v", err)
+		}
+		types = append(types, strings.Split(p.Header.Get("Content-Type"), ";")[0])
+	}
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Fatalf("分段类型不符: %v", types)
+	}
+}
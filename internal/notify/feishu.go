@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Feishu posts digests to a Feishu (飞书/Lark) custom bot as an interactive
+// card. When Secret is set the payload carries the signature fields.
+type Feishu struct {
+	WebhookURL string
+	Secret     string
+	HTTP       *http.Client
+	// now is overridable in tests.
+	now func() time.Time
+}
+
+// Name implements Notifier.
+func (f Feishu) Name() string { return "feishu" }
+
+// Notify implements Notifier.
+func (f Feishu) Notify(ctx context.Context, d Digest) error {
+	if f.WebhookURL == "" {
+		return errors.New("missing webhook url")
+	}
+	elements := []any{
+		map[string]any{"tag": "markdown", "content": d.markdownBody(false)},
+	}
+	if d.URL != "" {
+		elements = append(elements, map[string]any{
+			"tag": "action",
+			"actions": []any{map[string]any{
+				"tag":  "button",
+				"type": "primary",
+				"url":  d.URL,
+				"text": map[string]string{"tag": "plain_text", "content": d.linkLabel()},
+			}},
+		})
+	}
+	payload := map[string]any{
+		"msg_type": "interactive",
+		"card": map[string]any{
+			"header": map[string]any{
+				"template": "blue",
+				"title":    map[string]string{"tag": "plain_text", "content": d.Title()},
+			},
+			"elements": elements,
+		},
+	}
+	if f.Secret != "" {
+		now := time.Now
+		if f.now != nil {
+			now = f.now
+		}
+		ts := strconv.FormatInt(now().Unix(), 10)
+		payload["timestamp"] = ts
+		payload["sign"] = feishuSign(ts, f.Secret)
+	}
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := postJSON(ctx, f.HTTP, f.WebhookURL, payload, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("code %d: %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// feishuSign computes base64(HmacSHA256(key=timestamp+"\n"+secret, "")).
+func feishuSign(timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,373 @@
+// Package mqtt publishes day metrics to an MQTT broker so dashboards and
+// Home Assistant can show them. It speaks just enough MQTT 3.1.1 to connect,
+// publish at QoS 0 or 1 and disconnect.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/notify"
+)
+
+// DefaultTopic is the base topic when none is configured.
+const DefaultTopic = "wechat-view/report"
+
+// Publisher sends the digest's metrics as retained MQTT messages: the full
+// JSON document on Topic and each scalar on Topic/<field>. Only the daily
+// report is published; other kinds of digest would overwrite the sensors
+// with unrelated counts.
+type Publisher struct {
+	// Broker is host:port or a URL: tcp://, mqtt://, ssl://, tls:// or mqtts://.
+	Broker   string
+	Topic    string
+	Username string
+	Password string
+	ClientID string
+	QoS      int
+	Retain   bool
+	// DiscoveryPrefix, e.g. "homeassistant", also publishes Home Assistant
+	// MQTT discovery configs for the sensors. They are always retained,
+	// whatever Retain says, so Home Assistant finds them after a restart.
+	DiscoveryPrefix    string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// Payload is the JSON document published on the base topic.
+type Payload struct {
+	Date          string   `json:"date"`
+	Talker        string   `json:"talker"`
+	TotalMessages int      `json:"total_messages"`
+	UniqueSenders int      `json:"unique_senders"`
+	Highlights    []string `json:"highlights,omitempty"`
+	URL           string   `json:"url,omitempty"`
+}
+
+// Name implements notify.Notifier.
+func (p Publisher) Name() string { return "mqtt" }
+
+// Notify implements notify.Notifier.
+func (p Publisher) Notify(ctx context.Context, d notify.Digest) error {
+	if p.Broker == "" {
+		return errors.New("mqtt requires a broker")
+	}
+	if p.QoS < 0 || p.QoS > 1 {
+		return fmt.Errorf("unsupported qos %d", p.QoS)
+	}
+	if d.Kind != notify.KindDaily {
+		return nil
+	}
+	msgs, err := p.messages(d)
+	if err != nil {
+		return err
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c := &client{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.connect(p.clientID(), p.Username, p.Password); err != nil {
+		return err
+	}
+	for i, m := range msgs {
+		if err := c.publish(m.topic, m.payload, p.QoS, p.Retain || m.retain, uint16(i+1)); err != nil {
+			return fmt.Errorf("publish %s: %w", m.topic, err)
+		}
+	}
+	return c.disconnect()
+}
+
+type message struct {
+	topic   string
+	payload []byte
+	// retain forces the retain flag; Home Assistant only finds discovery
+	// configs that are retained on the broker.
+	retain bool
+}
+
+// messages lists everything published for d, base document first.
+func (p Publisher) messages(d notify.Digest) ([]message, error) {
+	topic := strings.TrimRight(p.Topic, "/")
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	doc, err := json.Marshal(Payload{
+		Date:          d.Date,
+		Talker:        d.Talker,
+		TotalMessages: d.TotalMessages,
+		UniqueSenders: d.UniqueSenders,
+		Highlights:    d.Highlights,
+		URL:           d.URL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := []message{
+		{topic: topic, payload: doc},
+		{topic: topic + "/date", payload: []byte(d.Date)},
+		{topic: topic + "/total_messages", payload: []byte(strconv.Itoa(d.TotalMessages))},
+		{topic: topic + "/unique_senders", payload: []byte(strconv.Itoa(d.UniqueSenders))},
+	}
+	if prefix := strings.TrimRight(p.DiscoveryPrefix, "/"); prefix != "" {
+		id := strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(topic)
+		sensors := []struct{ key, name, unit string }{
+			{"total_messages", i18n.T("群消息数"), i18n.T("条")},
+			{"unique_senders", i18n.T("活跃人数"), i18n.T("人")},
+		}
+		for _, s := range sensors {
+			cfg, err := json.Marshal(map[string]any{
+				"name":                s.name,
+				"unique_id":           id + "_" + s.key,
+				"state_topic":         topic,
+				"value_template":      "{{ value_json." + s.key + " }}",
+				"unit_of_measurement": s.unit,
+				"state_class":         "measurement",
+				"device": map[string]any{
+					"identifiers": []string{id},
+					"name":        firstNonEmpty(d.Talker, "wechat-view"),
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, message{topic: prefix + "/sensor/" + id + "/" + s.key + "/config", payload: cfg, retain: true})
+		}
+	}
+	return out, nil
+}
+
+func (p Publisher) clientID() string {
+	if p.ClientID != "" {
+		return p.ClientID
+	}
+	return "wechat-view-" + strconv.FormatInt(time.Now().UnixNano()%1e9, 36)
+}
+
+func (p Publisher) dial(ctx context.Context) (net.Conn, error) {
+	addr, useTLS, err := parseBroker(p.Broker)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	if !useTLS {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: host, InsecureSkipVerify: p.InsecureSkipVerify}}
+	return td.DialContext(ctx, "tcp", addr)
+}
+
+// parseBroker returns host:port and whether TLS is used. Ports default to
+// 1883, or 8883 for TLS.
+func parseBroker(broker string) (string, bool, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, fmt.Errorf("parse broker: %w", err)
+	}
+	var useTLS bool
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", false, fmt.Errorf("broker %q has no host", broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetDisconnect = 14
+)
+
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) connect(clientID, username, password string) error {
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	flags := byte(0x02)    // clean session
+	if username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags, 0, 60) // keep alive 60s
+	body = appendString(body, clientID)
+	if username != "" {
+		body = appendString(body, username)
+		if password != "" {
+			body = appendString(body, password)
+		}
+	}
+	if err := c.write(packetConnect<<4, body); err != nil {
+		return err
+	}
+	typ, resp, err := c.read()
+	if err != nil {
+		return fmt.Errorf("read connack: %w", err)
+	}
+	if typ != packetConnack || len(resp) < 2 {
+		return fmt.Errorf("unexpected packet %d while connecting", typ)
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("connection refused: %s", connackReason(resp[1]))
+	}
+	return nil
+}
+
+func (c *client) publish(topic string, payload []byte, qos int, retain bool, id uint16) error {
+	header := byte(packetPublish<<4) | byte(qos<<1)
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := c.write(header, body); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	typ, resp, err := c.read()
+	if err != nil {
+		return fmt.Errorf("read puback: %w", err)
+	}
+	if typ != packetPuback || len(resp) < 2 || binary.BigEndian.Uint16(resp) != id {
+		return fmt.Errorf("unexpected packet %d waiting for puback", typ)
+	}
+	return nil
+}
+
+func (c *client) disconnect() error {
+	return c.write(packetDisconnect<<4, nil)
+}
+
+func (c *client) write(header byte, body []byte) error {
+	pkt := append([]byte{header}, encodeLength(len(body))...)
+	_, err := c.conn.Write(append(pkt, body...))
+	return err
+}
+
+// read returns the type and body of the next packet.
+func (c *client) read() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := decodeLength(c.r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// encodeLength encodes the variable-length "remaining length" field.
+func encodeLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func decodeLength(r io.ByteReader) (int, error) {
+	n, mul := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n += int(b&0x7f) * mul
+		if b&0x80 == 0 {
+			return n, nil
+		}
+		mul *= 128
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/notify"
+)
+
+type published struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+// fakeBroker accepts one connection, acknowledges CONNECT and QoS 1 PUBLISH
+// packets and reports what was published once the client disconnects.
+func fakeBroker(t *testing.T) (string, <-chan []published) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan []published, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := &client{conn: conn, r: bufio.NewReader(conn)}
+		var got []published
+		for {
+			header, err := c.r.ReadByte()
+			if err != nil {
+				break
+			}
+			n, _ := decodeLength(c.r)
+			body := make([]byte, n)
+			if _, err := io.ReadFull(c.r, body); err != nil {
+				break
+			}
+			switch header >> 4 {
+			case packetConnect:
+				_ = c.write(packetConnack<<4, []byte{0, 0})
+			case packetPublish:
+				l := int(binary.BigEndian.Uint16(body))
+				p := published{topic: string(body[2 : 2+l]), retain: header&1 == 1}
+				rest := body[2+l:]
+				if qos := (header >> 1) & 3; qos > 0 {
+					_ = c.write(packetPuback<<4, rest[:2])
+					rest = rest[2:]
+				}
+				p.payload = string(rest)
+				got = append(got, p)
+			case packetDisconnect:
+				done <- got
+				return
+			}
+		}
+		done <- got
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestPublisherSendsMetrics(t *testing.T) {
+	addr, done := fakeBroker(t)
+	p := Publisher{Broker: "tcp://" + addr, Topic: "home/wechat/", QoS: 1, Retain: true, DiscoveryPrefix: "homeassistant"}
+	d := notify.Digest{Date: "2025-10-16", Talker: "AI技术交流群", TotalMessages: 1234, UniqueSenders: 56}
+	if err := p.Notify(context.Background(), d); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	got := <-done
+	if len(got) != 6 {
+		t.Fatalf("期望 6 条消息，得到 %d: %+v", len(got), got)
+	}
+	var doc Payload
+	if err := json.Unmarshal([]byte(got[0].payload), &doc); err != nil || got[0].topic != "home/wechat" {
+		t.Fatalf("主消息异常: %+v %v", got[0], err)
+	}
+	if doc.TotalMessages != 1234 || !got[0].retain {
+		t.Fatalf("主消息内容异常: %+v", doc)
+	}
+	if got[2].topic != "home/wechat/total_messages" || got[2].payload != "1234" {
+		t.Fatalf("分项指标异常: %+v", got[2])
+	}
+	if got[4].topic != "homeassistant/sensor/home_wechat/total_messages/config" {
+		t.Fatalf("自动发现主题异常: %s", got[4].topic)
+	}
+}
+
+func TestPublisherRetainsDiscoveryConfigs(t *testing.T) {
+	addr, done := fakeBroker(t)
+	p := Publisher{Broker: "tcp://" + addr, DiscoveryPrefix: "homeassistant"}
+	if err := p.Notify(context.Background(), notify.Digest{Date: "2025-10-16", TotalMessages: 1}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	for _, m := range <-done {
+		if isConfig := strings.HasSuffix(m.topic, "/config"); m.retain != isConfig {
+			t.Fatalf("%s 的 retain 应为 %v", m.topic, isConfig)
+		}
+	}
+}
+
+func TestDiscoveryNamesFollowLanguage(t *testing.T) {
+	p := Publisher{DiscoveryPrefix: "homeassistant"}
+	sensor := func() (name, unit string) {
+		t.Helper()
+		msgs, err := p.messages(notify.Digest{Date: "2025-10-16"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cfg struct {
+			Name string `json:"name"`
+			Unit string `json:"unit_of_measurement"`
+		}
+		if err := json.Unmarshal(msgs[len(msgs)-1].payload, &cfg); err != nil {
+			t.Fatal(err)
+		}
+		return cfg.Name, cfg.Unit
+	}
+	if name, unit := sensor(); name != "活跃人数" || unit != "人" {
+		t.Fatalf("默认语言下传感器为 %s/%s", name, unit)
+	}
+	if err := i18n.Use("en"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { i18n.Use("") })
+	if name, unit := sensor(); name != "Active members" || unit != "members" {
+		t.Fatalf("英文下传感器为 %s/%s", name, unit)
+	}
+}
+
+func TestPublisherSkipsOtherKinds(t *testing.T) {
+	// 未监听的地址：若尝试连接则必然报错。
+	p := Publisher{Broker: "tcp://127.0.0.1:1"}
+	for _, kind := range []notify.Kind{notify.KindEscalation, notify.KindWatchAlert, notify.KindWeeklyAwards, notify.KindSubscription} {
+		d := notify.Digest{Kind: kind, Date: "2025-10-16", TotalMessages: 3}
+		if err := p.Notify(context.Background(), d); err != nil {
+			t.Fatalf("%s 不应发布: %v", kind, err)
+		}
+	}
+}
+
+func TestParseBroker(t *testing.T) {
+	cases := map[string]struct {
+		addr string
+		tls  bool
+	}{
+		"localhost":             {"localhost:1883", false},
+		"mqtt://10.0.0.2:1884":  {"10.0.0.2:1884", false},
+		"mqtts://broker.lan":    {"broker.lan:8883", true},
+		"ssl://broker.lan:9999": {"broker.lan:9999", true},
+	}
+	for in, want := range cases {
+		addr, useTLS, err := parseBroker(in)
+		if err != nil || addr != want.addr || useTLS != want.tls {
+			t.Errorf("parseBroker(%q) = %q %v %v", in, addr, useTLS, err)
+		}
+	}
+	if _, _, err := parseBroker("ws://broker.lan"); err == nil {
+		t.Error("期望不支持 ws://")
+	}
+}
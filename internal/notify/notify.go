@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"wechat-view/internal/i18n"
+)
+
+// Kind tells the daily report apart from the other posts that reuse
+// Digest. Channels that keep state, like MQTT sensors, only take the daily
+// report's numbers.
+type Kind string
+
+const (
+	// KindDaily is the day's report, the zero value.
+	KindDaily Kind = ""
+	// KindEscalation is a reply-debt escalation to a question owner.
+	KindEscalation Kind = "escalation"
+	// KindWatchAlert is a watchlist rule reaching its threshold.
+	KindWatchAlert Kind = "watch-alert"
+	// KindWeeklyAwards is the weekly contributor awards post.
+	KindWeeklyAwards Kind = "weekly-awards"
+	// KindSubscription is a topic subscriber's personalised digest.
+	KindSubscription Kind = "subscription"
+)
+
+// Digest is the condensed day report pushed to chat channels.
+type Digest struct {
+	Kind          Kind
+	Date          string
+	Talker        string
+	TotalMessages int
+	UniqueSenders int
+	Highlights    []string
+	Overview      string
+	// URL links to the published day page when a site base URL is configured.
+	URL string
+	// HTML is the rendered day page, used by channels that can show it inline.
+	HTML string
+	// BroadcastTip suggests when to post announcements, see
+	// summarize.Broadcast.Tip.
+	BroadcastTip string
+	// Focus names the subscribed keywords of a personalised digest; its
+	// Highlights then quote matching messages and Conclusions the answered
+	// questions about them.
+	Focus       string
+	Conclusions []string
+	// Alert names the watchlist rule whose threshold the day reached, with
+	// TotalMessages its hits and Highlights quoting them.
+	Alert     string
+	Threshold int
+	// EscalatedTo names the owner of questions escalated today, with
+	// TotalMessages their number, Threshold the escalation age in hours and
+	// Highlights quoting them.
+	EscalatedTo string
+	// Week names the ISO week of a weekly awards post; Highlights then list
+	// the awards, TotalMessages and UniqueSenders cover the week.
+	Week string
+	// Headline is the day's AI title (llm.headline); it replaces the plain
+	// daily report title.
+	Headline string
+}
+
+// Notifier delivers a digest to one channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, d Digest) error
+}
+
+// Title is the headline shared by all channel formats.
+func (d Digest) Title() string {
+	if d.Alert != "" {
+		return i18n.Tf("%s · %s 关键词监控：%s", d.Talker, d.Date, d.Alert)
+	}
+	if d.Focus != "" {
+		return i18n.Tf("%s · %s 话题订阅：%s", d.Talker, d.Date, d.Focus)
+	}
+	if d.Week != "" {
+		return i18n.Tf("%s · %s 本周贡献榜", d.Talker, d.Week)
+	}
+	if d.EscalatedTo != "" {
+		return i18n.Tf("%s · %s 待回复问题升级：%s", d.Talker, d.Date, d.EscalatedTo)
+	}
+	if d.Headline != "" {
+		return i18n.Tf("%s · %s：%s", d.Talker, d.Date, d.Headline)
+	}
+	return i18n.Tf("%s · %s 群聊日报", d.Talker, d.Date)
+}
+
+// Markdown renders the digest as the markdown subset understood by the
+// WeCom, DingTalk and Feishu robots (headings, bold, lists, links).
+func (d Digest) Markdown() string {
+	return fmt.Sprintf("## %s\n%s", d.Title(), d.markdownBody(true))
+}
+
+// markdownBody renders everything below the title; cards that show the link
+// as a button pass withLink=false.
+func (d Digest) markdownBody(withLink bool) string {
+	var b strings.Builder
+	switch {
+	case d.Alert != "":
+		b.WriteString(i18n.Tf("> 今日命中 **%d** 条，已达告警阈值 %d 条\n\n", d.TotalMessages, d.Threshold))
+	case d.Focus != "":
+		b.WriteString(i18n.Tf("> 相关消息 **%d** 条 · 参与 **%d** 人\n\n", d.TotalMessages, d.UniqueSenders))
+	case d.Week != "":
+		b.WriteString(i18n.Tf("> 本周消息 **%d** 条 · %s\n\n", d.TotalMessages, d.Date))
+	case d.EscalatedTo != "":
+		b.WriteString(i18n.Tf("> 新增 **%d** 个超过 %d 小时无人回复的问题，请 %s 跟进\n\n", d.TotalMessages, d.Threshold, d.EscalatedTo))
+	default:
+		b.WriteString(i18n.Tf("> 消息 **%d** 条 · 活跃 **%d** 人\n\n", d.TotalMessages, d.UniqueSenders))
+	}
+	if d.Overview != "" {
+		b.WriteString(i18n.Tf("**AI 概览**：%s\n\n", d.Overview))
+	}
+	if len(d.Highlights) > 0 {
+		switch {
+		case d.Alert != "":
+			b.WriteString(i18n.T("**命中消息**\n"))
+		case d.Focus != "":
+			b.WriteString(i18n.T("**相关消息**\n"))
+		case d.Week != "":
+			b.WriteString(i18n.T("**本周获奖**\n"))
+		case d.EscalatedTo != "":
+			b.WriteString(i18n.T("**待回复问题**\n"))
+		default:
+			b.WriteString(i18n.T("**要点速览**\n"))
+		}
+		for _, h := range d.Highlights {
+			fmt.Fprintf(&b, "- %s\n", h)
+		}
+		b.WriteString("\n")
+	}
+	if len(d.Conclusions) > 0 {
+		b.WriteString(i18n.T("**相关结论**\n"))
+		for _, c := range d.Conclusions {
+			fmt.Fprintf(&b, "- %s\n", c)
+		}
+		b.WriteString("\n")
+	}
+	if d.BroadcastTip != "" {
+		b.WriteString(i18n.Tf("**公告建议发布时间**：%s\n\n", d.BroadcastTip))
+	}
+	if withLink && d.URL != "" {
+		fmt.Fprintf(&b, "[%s](%s)\n", d.linkLabel(), d.URL)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// linkLabel is the text of the link to the page behind the digest.
+func (d Digest) linkLabel() string {
+	if d.Week != "" {
+		return i18n.T("查看本周周报")
+	}
+	return i18n.T("查看完整日报")
+}
+
+// SendAll pushes d to every notifier and joins the failures; one broken
+// channel does not stop the others.
+func SendAll(ctx context.Context, notifiers []Notifier, d Digest) error {
+	var errs []error
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, d); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// robotResponse covers the errcode/errmsg envelope used by WeCom and DingTalk.
+type robotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (r robotResponse) err() error {
+	if r.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", r.ErrCode, r.ErrMsg)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint string, payload, out any) error {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http %d: %s", resp.StatusCode, string(b))
+	}
+	if out == nil || len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// truncateBytes keeps s within limit bytes without splitting a UTF-8 rune.
+func truncateBytes(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	const ellipsis = "…"
+	cut := limit - len(ellipsis)
+	for cut > 0 && !utf8RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
+
+func utf8RuneStart(b byte) bool { return b&0xC0 != 0x80 }
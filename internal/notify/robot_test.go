@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDingTalkSignedRequest(t *testing.T) {
+	fixed := time.UnixMilli(1700000000000)
+	var query map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{
+			"access_token": r.URL.Query().Get("access_token"),
+			"timestamp":    r.URL.Query().Get("timestamp"),
+			"sign":         r.URL.Query().Get("sign"),
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	d := DingTalk{WebhookURL: srv.URL + "?access_token=abc", Secret: "SECxyz", now: func() time.Time { return fixed }}
+	if err := d.Notify(context.Background(), Digest{Date: "2025-10-16", Talker: "群"}); err != nil {
+		t.Fatalf("推送失败: %v", err)
+	}
+	if query["access_token"] != "abc" || query["timestamp"] != "1700000000000" {
+		t.Fatalf("查询参数异常: %v", query)
+	}
+	if query["sign"] != dingTalkSign("1700000000000", "SECxyz") || query["sign"] == "" {
+		t.Fatalf("签名异常: %v", query)
+	}
+}
+
+func TestFeishuCardPayload(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"code":0,"msg":"success"}`))
+	}))
+	defer srv.Close()
+
+	f := Feishu{WebhookURL: srv.URL, Secret: "s", now: func() time.Time { return time.Unix(1700000000, 0) }}
+	if err := f.Notify(context.Background(), Digest{Date: "2025-10-16", Talker: "群", URL: "https://example.com/d"}); err != nil {
+		t.Fatalf("推送失败: %v", err)
+	}
+	if got["msg_type"] != "interactive" || got["timestamp"] != "1700000000" || got["sign"] != feishuSign("1700000000", "s") {
+		t.Fatalf("卡片字段异常: %v", got)
+	}
+	elements := got["card"].(map[string]any)["elements"].([]any)
+	if len(elements) != 2 {
+		t.Fatalf("期望包含按钮，得到 %d 个元素", len(elements))
+	}
+}
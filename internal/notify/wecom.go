@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// wecomMarkdownLimit is the robot API's byte limit for markdown content.
+const wecomMarkdownLimit = 4096
+
+// WeCom posts digests to a WeCom (企业微信) group robot webhook.
+type WeCom struct {
+	WebhookURL string
+	HTTP       *http.Client
+}
+
+// Name implements Notifier.
+func (w WeCom) Name() string { return "wecom" }
+
+// Notify implements Notifier.
+func (w WeCom) Notify(ctx context.Context, d Digest) error {
+	if w.WebhookURL == "" {
+		return errors.New("missing webhook url")
+	}
+	payload := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": truncateBytes(d.Markdown(), wecomMarkdownLimit),
+		},
+	}
+	var resp robotResponse
+	if err := postJSON(ctx, w.HTTP, w.WebhookURL, payload, &resp); err != nil {
+		return err
+	}
+	return resp.err()
+}
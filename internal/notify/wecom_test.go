@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeComNotify(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("解析请求失败: %v", err)
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer srv.Close()
+
+	d := Digest{Date: "2025-10-16", Talker: "AI技术交流群", TotalMessages: 12, UniqueSenders: 3, Highlights: []string{"热门主题：agent"}, Overview: "讨论集中在 agent"}
+	if err := (WeCom{WebhookURL: srv.URL}).Notify(context.Background(), d); err != nil {
+		t.Fatalf("推送失败: %v", err)
+	}
+	if got["msgtype"] != "markdown" {
+		t.Fatalf("msgtype 异常: %v", got["msgtype"])
+	}
+	content, _ := got["markdown"].(map[string]any)["content"].(string)
+	if !strings.Contains(content, "AI技术交流群 · 2025-10-16") || !strings.Contains(content, "- 热门主题：agent") {
+		t.Fatalf("推送内容不符: %s", content)
+	}
+	d.Headline = "今天群里为定价吵了一下午"
+	if title := d.Title(); title != "AI技术交流群 · 2025-10-16：今天群里为定价吵了一下午" {
+		t.Fatalf("AI 标题未用作推送标题: %s", title)
+	}
+}
+
+func TestWeComNotifyErrCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+	}))
+	defer srv.Close()
+
+	err := (WeCom{WebhookURL: srv.URL}).Notify(context.Background(), Digest{})
+	if err == nil || !strings.Contains(err.Error(), "93000") {
+		t.Fatalf("期望返回 errcode 错误，得到 %v", err)
+	}
+}
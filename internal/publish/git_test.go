@@ -0,0 +1,95 @@
+package publish
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitPublish(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runGit(t, root, "init", "--quiet", "--bare", remote)
+	site := filepath.Join(root, "site")
+	writeFiles(t, site, map[string]string{"index.html": "home", "2025/10/01/index.html": "day", ".tmp-1": "partial"})
+
+	g := Git{Remote: remote, Dir: filepath.Join(root, "clone"), Message: "日报 {{.Date}} ({{.Files}} files)", CNAME: "report.example.com"}
+	ctx := context.Background()
+	res, err := g.Publish(ctx, site, MessageData{Date: "2025-10-01"})
+	if err != nil {
+		t.Fatalf("first publish: %v", err)
+	}
+	if res.Commit == "" || res.Files != 4 {
+		t.Fatalf("first publish = %+v, want a commit of 4 files", res)
+	}
+	if msg := runGit(t, root, "--git-dir", remote, "log", "-1", "--format=%s", "gh-pages"); msg != "日报 2025-10-01 (4 files)" {
+		t.Fatalf("commit message = %q", msg)
+	}
+	if files := runGit(t, root, "--git-dir", remote, "ls-tree", "-r", "--name-only", "gh-pages"); files != ".nojekyll\n2025/10/01/index.html\nCNAME\nindex.html" {
+		t.Fatalf("published files:\n%s", files)
+	}
+
+	// Nothing changed: no commit.
+	if res, err := g.Publish(ctx, site, MessageData{Date: "2025-10-01"}); err != nil || res.Commit != "" {
+		t.Fatalf("unchanged publish = %+v, %v", res, err)
+	}
+
+	// Removed pages disappear from the branch.
+	os.RemoveAll(filepath.Join(site, "2025"))
+	writeFiles(t, site, map[string]string{"index.html": "home 2"})
+	if res, err := g.Publish(ctx, site, MessageData{Date: "2025-10-02"}); err != nil || res.Files != 2 {
+		t.Fatalf("second publish = %+v, %v", res, err)
+	}
+
+	// Hand edits in the clone stop the publish instead of being overwritten.
+	writeFiles(t, g.Dir, map[string]string{"index.html": "edited by hand"})
+	if _, err := g.Publish(ctx, site, MessageData{}); err == nil || !strings.Contains(err.Error(), "uncommitted") {
+		t.Fatalf("dirty clone: %v", err)
+	}
+	runGit(t, g.Dir, "checkout", "--", "index.html")
+
+	// Someone else pushed: the clone fast-forwards first.
+	other := filepath.Join(root, "other")
+	runGit(t, root, "clone", "--quiet", "--branch", "gh-pages", remote, other)
+	writeFiles(t, other, map[string]string{"extra.html": "x"})
+	runGit(t, other, "add", "-A")
+	runGit(t, other, "commit", "--quiet", "-m", "extra")
+	runGit(t, other, "push", "--quiet", "origin", "gh-pages")
+	writeFiles(t, site, map[string]string{"index.html": "home 3"})
+	if _, err := g.Publish(ctx, site, MessageData{}); err != nil {
+		t.Fatalf("publish after a remote push: %v", err)
+	}
+	if files := runGit(t, root, "--git-dir", remote, "ls-tree", "-r", "--name-only", "gh-pages"); strings.Contains(files, "extra.html") {
+		t.Fatalf("mirror kept a file missing from the site:\n%s", files)
+	}
+}
@@ -0,0 +1,95 @@
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// Mirror makes dst an exact copy of src: files are written when their
+// content differs and files and directories missing from src are removed,
+// except the top-level entries named in keep. Temp files of writes still
+// in progress are not copied.
+func Mirror(src, dst string, keep ...string) error {
+	want := map[string]bool{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if atomicfile.IsTemp(d.Name()) {
+			return nil
+		}
+		want[rel] = true
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return writeIfChanged(filepath.Join(dst, rel), b)
+	})
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	var stale []string
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if filepath.Dir(rel) == "." && kept[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !want[rel] {
+			stale = append(stale, p)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range stale {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIfChanged writes b to p unless p already holds exactly b.
+func writeIfChanged(p string, b []byte) error {
+	old, err := os.ReadFile(p)
+	if err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return atomicfile.WriteFile(p, b)
+}
@@ -0,0 +1,90 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SFTP uploads over SFTP with the OpenSSH sftp client in batch mode, so it
+// uses the same keys, agent and known_hosts as ssh. Password logins are not
+// supported.
+type SFTP struct {
+	Host string
+	// Port defaults to 22.
+	Port int
+	User string
+	// IdentityFile is the private key; empty uses ssh's defaults.
+	IdentityFile string
+	// Dir is the site root on the server, e.g. /var/www/report.
+	Dir string
+	// Command is the sftp client; default "sftp".
+	Command string
+}
+
+// Name implements Uploader.
+func (s SFTP) Name() string { return "sftp" }
+
+// Upload implements Uploader with a single sftp session.
+func (s SFTP) Upload(ctx context.Context, files []File) error {
+	var batch strings.Builder
+	// A leading "-" lets mkdir fail when the directory exists.
+	for _, dir := range parentDirs(files) {
+		fmt.Fprintf(&batch, "-mkdir %s\n", sftpQuote(s.remote(dir)))
+	}
+	for _, f := range files {
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(f.Local), sftpQuote(s.remote(f.Path)))
+	}
+	return s.run(ctx, batch.String())
+}
+
+// Check opens a session and lists the site root.
+func (s SFTP) Check(ctx context.Context) error {
+	return s.run(ctx, "ls "+sftpQuote(s.remote(""))+"\n")
+}
+
+func (s SFTP) run(ctx context.Context, batch string) error {
+	if s.Host == "" {
+		return fmt.Errorf("sftp needs a host")
+	}
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if s.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(s.Port))
+	}
+	if s.IdentityFile != "" {
+		args = append(args, "-i", s.IdentityFile)
+	}
+	dest := s.Host
+	if s.User != "" {
+		dest = s.User + "@" + s.Host
+	}
+	cmd := exec.CommandContext(ctx, firstSet(s.Command, "sftp"), append(args, dest)...)
+	cmd.Stdin = strings.NewReader(batch)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(out.String())
+		if len(msg) > 2000 {
+			msg = msg[len(msg)-2000:]
+		}
+		return fmt.Errorf("sftp %s: %v: %s", dest, err, msg)
+	}
+	return nil
+}
+
+func (s SFTP) remote(rel string) string {
+	root := firstSet(s.Dir, ".")
+	if rel == "" {
+		return root
+	}
+	return path.Join(root, rel)
+}
+
+// sftpQuote double-quotes an sftp batch argument.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
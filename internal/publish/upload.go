@@ -0,0 +1,129 @@
+package publish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// File is one local file to upload.
+type File struct {
+	// Path is where the file goes, relative to the target's root, with
+	// forward slashes.
+	Path  string
+	Local string
+}
+
+// Uploader copies files to a site root on a server: WebDAV or SFTP.
+type Uploader interface {
+	Name() string
+	// Upload stores files in order, creating directories as needed.
+	Upload(ctx context.Context, files []File) error
+}
+
+// UploadResult tallies one Incremental upload.
+type UploadResult struct {
+	Uploaded, Unchanged int
+}
+
+// Incremental uploads the files under siteDir that changed since the last
+// successful upload, whose content hashes are kept in statePath: after a
+// daily run that is the new day directory plus the index and aggregate
+// pages that changed. Files at the root, such as index.html, go last so
+// they never link to pages that are not there yet. Files removed locally
+// are left on the server.
+func Incremental(ctx context.Context, u Uploader, siteDir, statePath string) (UploadResult, error) {
+	var res UploadResult
+	state := map[string]string{}
+	if b, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return res, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return res, err
+	}
+
+	next := make(map[string]string, len(state))
+	var files []File
+	err := filepath.WalkDir(siteDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || atomicfile.IsTemp(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(siteDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sum, err := fileHash(p)
+		if err != nil {
+			return err
+		}
+		next[rel] = sum
+		if state[rel] == sum {
+			res.Unchanged++
+			return nil
+		}
+		files = append(files, File{Path: rel, Local: p})
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	if len(files) == 0 {
+		return res, nil
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.Contains(files[i].Path, "/") && !strings.Contains(files[j].Path, "/")
+	})
+	if err := u.Upload(ctx, files); err != nil {
+		return res, err
+	}
+	res.Uploaded = len(files)
+	b, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return res, err
+	}
+	return res, atomicfile.WriteFile(statePath, b)
+}
+
+// parentDirs returns every directory the files need below the root,
+// parents before children.
+func parentDirs(files []File) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, f := range files {
+		for d := path.Dir(f.Path); d != "." && d != "/" && !seen[d]; d = path.Dir(d) {
+			seen[d] = true
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if a, b := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/"); a != b {
+			return a < b
+		}
+		return dirs[i] < dirs[j]
+	})
+	return dirs
+}
+
+func fileHash(p string) (string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16]), nil
+}
@@ -0,0 +1,130 @@
+package publish
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDAV records the requests of a WebDAV client and keeps PUT bodies.
+type fakeDAV struct {
+	mu    sync.Mutex
+	log   []string
+	files map[string]string
+	dirs  map[string]bool
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != "pw" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, r.Method+" "+r.URL.Path)
+	switch r.Method {
+	case "MKCOL":
+		if f.dirs[r.URL.Path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.dirs[r.URL.Path] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.files[r.URL.Path] = string(b)
+		w.WriteHeader(http.StatusCreated)
+	case "PROPFIND":
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+}
+
+func TestIncrementalWebDAV(t *testing.T) {
+	fake := &fakeDAV{files: map[string]string{}, dirs: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	site, state := t.TempDir(), filepath.Join(t.TempDir(), "webdav.json")
+	writeFiles(t, site, map[string]string{"index.html": "home", "2025/10/01/index.html": "day", "topics/发布/index.html": "t"})
+	dav := WebDAV{URL: srv.URL + "/web/report/", Username: "admin", Password: "pw"}
+	ctx := context.Background()
+
+	if err := dav.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	res, err := Incremental(ctx, dav, site, state)
+	if err != nil || res.Uploaded != 3 {
+		t.Fatalf("first upload = %+v, %v", res, err)
+	}
+	if fake.files["/web/report/topics/发布/index.html"] != "t" || !fake.dirs["/web/report/2025/10/"] {
+		t.Fatalf("uploaded files %v, dirs %v", fake.files, fake.dirs)
+	}
+	if last := fake.log[len(fake.log)-1]; last != "PUT /web/report/index.html" {
+		t.Fatalf("root index should go last, log ends with %q", last)
+	}
+
+	// Only the new day and the changed index go up next time.
+	fake.log = nil
+	writeFiles(t, site, map[string]string{"index.html": "home 2", "2025/10/02/index.html": "day 2"})
+	res, err = Incremental(ctx, dav, site, state)
+	if err != nil || res.Uploaded != 2 || res.Unchanged != 2 {
+		t.Fatalf("second upload = %+v, %v", res, err)
+	}
+	puts := 0
+	for _, l := range fake.log {
+		if strings.HasPrefix(l, "PUT") {
+			puts++
+		}
+	}
+	if puts != 2 {
+		t.Fatalf("second upload sent %d PUTs: %v", puts, fake.log)
+	}
+
+	bad := dav
+	bad.Password = "wrong"
+	writeFiles(t, site, map[string]string{"index.html": "home 3"})
+	if _, err := Incremental(ctx, bad, site, state); err == nil {
+		t.Fatal("upload with a wrong password succeeded")
+	}
+	// The failed file is retried on the next run.
+	if res, err := Incremental(ctx, dav, site, state); err != nil || res.Uploaded != 1 {
+		t.Fatalf("retry = %+v, %v", res, err)
+	}
+}
+
+func TestSFTPBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the sftp client")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sftp")
+	batch := filepath.Join(dir, "batch.txt")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+dir+"/args.txt\ncat > "+batch+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := SFTP{Host: "nas.local", Port: 2222, User: "web", Dir: "/srv/report", Command: script}
+	files := []File{{Path: "2025/10/01/index.html", Local: `/tmp/site/a "b".html`}, {Path: "index.html", Local: "/tmp/site/index.html"}}
+	if err := s.Upload(context.Background(), files); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	got, _ := os.ReadFile(batch)
+	want := `-mkdir "/srv/report/2025"
+-mkdir "/srv/report/2025/10"
+-mkdir "/srv/report/2025/10/01"
+put "/tmp/site/a \"b\".html" "/srv/report/2025/10/01/index.html"
+put "/tmp/site/index.html" "/srv/report/index.html"
+`
+	if string(got) != want {
+		t.Fatalf("batch:\n%s\nwant:\n%s", got, want)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args.txt"))
+	if strings.TrimSpace(string(args)) != "-b - -o BatchMode=yes -P 2222 web@nas.local" {
+		t.Fatalf("args = %q", args)
+	}
+}
@@ -0,0 +1,109 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// WebDAV uploads to a WebDAV share, as offered by most NAS systems and
+// shared hosts.
+type WebDAV struct {
+	// URL is the collection the site goes into, e.g.
+	// https://nas.local:5006/web/report/.
+	URL      string
+	Username string
+	Password string
+	HTTP     *http.Client
+}
+
+// Name implements Uploader.
+func (w WebDAV) Name() string { return "webdav" }
+
+// Upload implements Uploader: MKCOL for missing directories, then PUT.
+func (w WebDAV) Upload(ctx context.Context, files []File) error {
+	for _, dir := range parentDirs(files) {
+		// 405 means the collection already exists.
+		if err := w.do(ctx, "MKCOL", dir+"/", nil, "", http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f.Local)
+		if err != nil {
+			return err
+		}
+		ctype := mime.TypeByExtension(path.Ext(f.Path))
+		if err := w.do(ctx, http.MethodPut, f.Path, b, ctype, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check asks for the root collection's properties, to verify the URL and
+// credentials.
+func (w WebDAV) Check(ctx context.Context) error {
+	return w.do(ctx, "PROPFIND", "", nil, "", http.StatusMultiStatus, http.StatusOK)
+}
+
+func (w WebDAV) do(ctx context.Context, method, rel string, body []byte, ctype string, ok ...int) error {
+	req, err := http.NewRequestWithContext(ctx, method, w.target(rel), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	if method == "PROPFIND" {
+		req.Header.Set("Depth", "0")
+	}
+	if w.Username != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+	client := w.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("webdav %s %s: %s", method, "/"+rel, resp.Status)
+}
+
+// target joins rel to URL, escaping each segment.
+func (w WebDAV) target(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		parts[i] = pathEscape(p)
+	}
+	return strings.TrimRight(w.URL, "/") + "/" + strings.Join(parts, "/")
+}
+
+// pathEscape escapes a path segment, keeping it readable for ASCII names.
+func pathEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
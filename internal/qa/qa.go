@@ -0,0 +1,200 @@
+// Package qa accumulates answered questions from daily reply-debt tracking
+// into a persistent, deduplicated knowledge base.
+package qa
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/summarize"
+)
+
+// similarity is the bigram Jaccard score above which two questions are
+// treated as the same one asked again.
+const similarity = 0.6
+
+// Answer is one reply that resolved a question.
+type Answer struct {
+	Text string `json:"text"`
+	By   string `json:"by,omitempty"`
+	Date string `json:"date"`
+}
+
+// Source records one time the question was asked.
+type Source struct {
+	Date    string `json:"date"`
+	AskedAt string `json:"askedAt,omitempty"`
+	Asker   string `json:"asker,omitempty"`
+}
+
+// Entry is one deduplicated question with every answer it received.
+type Entry struct {
+	ID       string   `json:"id"`
+	Question string   `json:"question"`
+	Answers  []Answer `json:"answers"`
+	Sources  []Source `json:"sources"`
+
+	grams map[string]bool
+}
+
+// FirstAsked returns the earliest day the question came up.
+func (e *Entry) FirstAsked() string { return e.Sources[0].Date }
+
+// LastAsked returns the latest day the question came up.
+func (e *Entry) LastAsked() string { return e.Sources[len(e.Sources)-1].Date }
+
+// Base is the knowledge base, persisted as JSON (data/qa.json).
+type Base struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// Load reads a knowledge base; a missing file yields an empty base.
+func Load(path string) (*Base, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Base{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var base Base
+	if err := json.Unmarshal(b, &base); err != nil {
+		return nil, err
+	}
+	return &base, nil
+}
+
+// Save writes the base atomically.
+func (b *Base) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data)
+}
+
+// Add merges one resolved question from day's summary. Questions without a
+// recorded answer are ignored. It reports whether the base changed.
+func (b *Base) Add(day string, item summarize.ReplyItem) bool {
+	if strings.TrimSpace(item.Answer) == "" || strings.TrimSpace(item.Question) == "" {
+		return false
+	}
+	src := Source{Date: day, AskedAt: item.AskedAt, Asker: item.Questioner}
+	ans := Answer{Text: item.Answer, By: item.AnsweredBy, Date: day}
+	entry := b.match(item.Question)
+	if entry == nil {
+		entry = &Entry{ID: entryID(item.Question), Question: item.Question}
+		b.Entries = append(b.Entries, entry)
+	}
+	changed := false
+	if !hasSource(entry.Sources, src) {
+		entry.Sources = append(entry.Sources, src)
+		sort.SliceStable(entry.Sources, func(i, j int) bool { return entry.Sources[i].Date < entry.Sources[j].Date })
+		changed = true
+	}
+	if !hasAnswer(entry.Answers, ans) {
+		entry.Answers = append(entry.Answers, ans)
+		changed = true
+	}
+	return changed
+}
+
+// Sorted returns entries most-asked first, then most recent.
+func (b *Base) Sorted() []*Entry {
+	out := append([]*Entry(nil), b.Entries...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if len(out[i].Sources) != len(out[j].Sources) {
+			return len(out[i].Sources) > len(out[j].Sources)
+		}
+		return out[i].LastAsked() > out[j].LastAsked()
+	})
+	return out
+}
+
+func (b *Base) match(question string) *Entry {
+	grams := bigrams(question)
+	var best *Entry
+	bestScore := 0.0
+	for _, e := range b.Entries {
+		if e.grams == nil {
+			e.grams = bigrams(e.Question)
+		}
+		if s := jaccard(grams, e.grams); s >= similarity && s > bestScore {
+			best, bestScore = e, s
+		}
+	}
+	return best
+}
+
+func hasSource(list []Source, s Source) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnswer(list []Answer, a Answer) bool {
+	for _, v := range list {
+		if normalize(v.Text) == normalize(a.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize drops @mentions, punctuation and spacing and lowercases ASCII.
+func normalize(s string) string {
+	var b strings.Builder
+	skip := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == '@':
+			skip = true
+		case unicode.IsSpace(r):
+			skip = false
+		case skip, unicode.IsPunct(r), unicode.IsSymbol(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func bigrams(s string) map[string]bool {
+	r := []rune(normalize(s))
+	out := make(map[string]bool, len(r))
+	if len(r) == 1 {
+		out[string(r)] = true
+	}
+	for i := 0; i+1 < len(r); i++ {
+		out[string(r[i:i+2])] = true
+	}
+	return out
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+func entryID(question string) string {
+	sum := sha1.Sum([]byte(normalize(question)))
+	return hex.EncodeToString(sum[:])[:10]
+}
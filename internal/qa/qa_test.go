@@ -0,0 +1,44 @@
+package qa
+
+import (
+	"path/filepath"
+	"testing"
+
+	"wechat-view/internal/summarize"
+)
+
+func TestAddDeduplicatesRepeatedQuestions(t *testing.T) {
+	b := &Base{}
+	first := summarize.ReplyItem{Questioner: "A", Question: "向量库选 Milvus 还是 pgvector？", AskedAt: "t1", Answer: "数据量不大直接 pgvector", AnsweredBy: "B"}
+	again := summarize.ReplyItem{Questioner: "C", Question: "@B 向量库选Milvus还是pgvector呢", AskedAt: "t2", Answer: "看规模，上亿用 Milvus", AnsweredBy: "D"}
+	other := summarize.ReplyItem{Questioner: "E", Question: "周末有人去 meetup 吗？", AskedAt: "t3", Answer: "我去", AnsweredBy: "F"}
+	unanswered := summarize.ReplyItem{Questioner: "G", Question: "有人在吗？"}
+
+	if !b.Add("2025-10-01", first) || !b.Add("2025-10-03", again) || !b.Add("2025-10-03", other) {
+		t.Fatal("expected additions to change the base")
+	}
+	if b.Add("2025-10-01", first) {
+		t.Fatal("re-adding the same source should be a no-op")
+	}
+	b.Add("2025-10-04", unanswered)
+
+	if len(b.Entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(b.Entries))
+	}
+	top := b.Sorted()[0]
+	if len(top.Sources) != 2 || len(top.Answers) != 2 || top.FirstAsked() != "2025-10-01" || top.LastAsked() != "2025-10-03" {
+		t.Fatalf("merged entry = %+v", top)
+	}
+
+	path := filepath.Join(t.TempDir(), "qa.json")
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Add("2025-10-03", again) || len(loaded.Entries) != 2 {
+		t.Fatal("reloaded base should recognise existing sources")
+	}
+}
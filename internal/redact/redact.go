@@ -0,0 +1,312 @@
+// Package redact anonymizes messages so reports can be shared outside the
+// group: senders get stable pseudonyms (用户A, 用户B, ...), their names are
+// replaced wherever they appear in text, and phone numbers, email addresses
+// and ID card numbers are masked. Pseudonyms are persisted as one JSON file
+// (data/pseudonyms.json) so a member keeps theirs across days and reruns;
+// that file maps pseudonyms back to people and must not be published.
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+// Prefix starts every pseudonym.
+const Prefix = "用户"
+
+var (
+	// idCardRe matches 18-digit mainland ID card numbers (birth date checked
+	// loosely, last character may be X).
+	idCardRe = regexp.MustCompile(`[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`)
+	urlRe    = regexp.MustCompile(`https?://[^\s]+`)
+)
+
+// Redactor assigns pseudonyms and masks messages. It is safe for concurrent
+// use.
+type Redactor struct {
+	path string
+
+	mu sync.Mutex
+	// names maps "id:<sender id>" and "name:<display name>" to a pseudonym;
+	// an id and the names it was seen with share one.
+	names    map[string]string
+	count    int
+	changed  bool
+	replacer *strings.Replacer
+}
+
+type file struct {
+	Count int               `json:"count"`
+	Names map[string]string `json:"names"`
+}
+
+// Open loads the pseudonyms at path; a missing file yields an empty set.
+func Open(path string) (*Redactor, error) {
+	r := &Redactor{path: path, names: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Names != nil {
+		r.names = f.Names
+	}
+	r.count = f.Count
+	return r, nil
+}
+
+// Save writes the pseudonyms back when new ones were assigned.
+func (r *Redactor) Save() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.changed || r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(file{Count: r.count, Names: r.names}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(r.path, data); err != nil {
+		return err
+	}
+	r.changed = false
+	return nil
+}
+
+// Messages returns anonymized copies of msgs; msgs itself is not modified.
+// Sender ids and names, mentions and quoted senders become pseudonyms,
+// known names are replaced inside text, contact details are masked and
+// everything chatlog sent beyond the known fields (avatars among it) is
+// dropped. A nil Redactor returns msgs unchanged.
+func (r *Redactor) Messages(msgs []chatlog.Message) []chatlog.Message {
+	if r == nil {
+		return msgs
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.learnAll(msgs)
+
+	out := make([]chatlog.Message, len(msgs))
+	for i, m := range msgs {
+		id := firstNonEmpty(m.Sender, m.From)
+		pseudo := r.lookup(id, firstNonEmpty(m.SenderName, m.Nickname))
+		if m.Sender != "" {
+			m.Sender = pseudo
+		}
+		if m.From != "" {
+			m.From = pseudo
+		}
+		if m.SenderName != "" {
+			m.SenderName = pseudo
+		}
+		if m.Nickname != "" {
+			m.Nickname = pseudo
+		}
+		m.Content = r.text(m.Content)
+		m.Text = r.text(m.Text)
+		if len(m.Mentions) > 0 {
+			mentions := make([]string, len(m.Mentions))
+			for j, name := range m.Mentions {
+				mentions[j] = r.lookup("", name)
+			}
+			m.Mentions = mentions
+		}
+		if ref := m.Reference; ref != nil {
+			c := *ref
+			p := r.lookup(c.Sender, c.SenderName)
+			if c.Sender != "" {
+				c.Sender = p
+			}
+			if c.SenderName != "" {
+				c.SenderName = p
+			}
+			c.Content = r.text(c.Content)
+			m.Reference = &c
+		}
+		if sh := m.Share; sh != nil {
+			c := *sh
+			c.Title, c.Desc = r.text(c.Title), r.text(c.Desc)
+			m.Share = &c
+		}
+		m.Extras = nil
+		out[i] = m
+	}
+	return out
+}
+
+// Learn assigns pseudonyms to the people in msgs without redacting them.
+// Learning every archived day first makes names that first appear on a
+// later day replaced in earlier days' text too.
+func (r *Redactor) Learn(msgs []chatlog.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.learnAll(msgs)
+}
+
+func (r *Redactor) learnAll(msgs []chatlog.Message) {
+	for _, m := range msgs {
+		r.learn(firstNonEmpty(m.Sender, m.From), m.SenderName, m.Nickname)
+		if ref := m.Reference; ref != nil {
+			r.learn(ref.Sender, ref.SenderName)
+		}
+		for _, name := range m.Mentions {
+			r.learn("", name)
+		}
+		for _, ev := range summarize.ParseMemberEvents(m) {
+			for _, name := range []string{ev.Who, ev.By} {
+				if name != "你" {
+					r.learn("", name)
+				}
+			}
+		}
+	}
+}
+
+// Pseudonym returns the pseudonym of a sender id or display name, or s
+// itself when it is unknown. Config values naming members (admins and the
+// like) go through it to still match redacted messages.
+func (r *Redactor) Pseudonym(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookup(s, s)
+}
+
+// Text replaces known names in s and masks its contact details.
+func (r *Redactor) Text(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.text(s)
+}
+
+func (r *Redactor) text(s string) string {
+	if s == "" {
+		return s
+	}
+	if r.replacer == nil {
+		r.replacer = r.buildReplacer()
+	}
+	// Names inside links are left alone so shared URLs keep working.
+	var b strings.Builder
+	last := 0
+	for _, loc := range urlRe.FindAllStringIndex(s, -1) {
+		b.WriteString(r.replacer.Replace(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(r.replacer.Replace(s[last:]))
+	s = b.String()
+	s = idCardRe.ReplaceAllStringFunc(s, func(id string) string {
+		return id[:3] + strings.Repeat("*", len(id)-7) + id[len(id)-4:]
+	})
+	return summarize.MaskContacts(s)
+}
+
+// buildReplacer replaces every known display name, longest first so a name
+// containing another is not cut in half. One-character names are left out:
+// replacing them would mangle ordinary words.
+func (r *Redactor) buildReplacer() *strings.Replacer {
+	var names []string
+	for key := range r.names {
+		if name, ok := strings.CutPrefix(key, "name:"); ok && utf8.RuneCountInString(name) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, name, r.names["name:"+name])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// learn makes sure id and names have a pseudonym, reusing the one already
+// held by any of them; callers hold mu.
+func (r *Redactor) learn(id string, names ...string) {
+	var keys []string
+	if id != "" {
+		keys = append(keys, "id:"+id)
+	}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" && !strings.HasPrefix(name, Prefix) {
+			keys = append(keys, "name:"+name)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	pseudo := ""
+	for _, k := range keys {
+		if p, ok := r.names[k]; ok {
+			pseudo = p
+			break
+		}
+	}
+	if pseudo == "" {
+		pseudo = Prefix + letters(r.count)
+		r.count++
+	}
+	for _, k := range keys {
+		if _, ok := r.names[k]; !ok {
+			r.names[k] = pseudo
+			r.changed = true
+			r.replacer = nil
+		}
+	}
+}
+
+// lookup returns the pseudonym of id or name; callers hold mu and have
+// called learn for them.
+func (r *Redactor) lookup(id, name string) string {
+	if p, ok := r.names["id:"+id]; ok && id != "" {
+		return p
+	}
+	if p, ok := r.names["name:"+strings.TrimSpace(name)]; ok {
+		return p
+	}
+	return name
+}
+
+// letters numbers pseudonyms like spreadsheet columns: A..Z, AA, AB, ...
+func letters(n int) string {
+	s := ""
+	for n++; n > 0; n = (n - 1) / 26 {
+		s = string(rune('A'+(n-1)%26)) + s
+	}
+	return s
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
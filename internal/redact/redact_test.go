@@ -0,0 +1,71 @@
+package redact
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestMessagesPseudonymizeAndMask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pseudonyms.json")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	msgs := []chatlog.Message{
+		{Sender: "wxid_zhang", SenderName: "张三", MsgType: 1, Content: "我的电话 13812345678，邮箱 zhangsan@example.com",
+			Extras: map[string]any{"avatar": "https://example.com/a.jpg"}},
+		{Sender: "wxid_li", SenderName: "李四", MsgType: 1, Content: "@张三 身份证 110101199003071234 已发你",
+			Mentions: []string{"张三"}, Reference: &chatlog.Reference{Sender: "wxid_zhang", SenderName: "张三", Content: "找李四要"}},
+		{MsgType: 10000, Content: `"李四"邀请"王五"加入了群聊`},
+	}
+	out := r.Messages(msgs)
+
+	if out[0].Sender != "用户A" || out[0].SenderName != "用户A" || out[1].SenderName != "用户B" {
+		t.Fatalf("化名异常: %q %q %q", out[0].Sender, out[0].SenderName, out[1].SenderName)
+	}
+	if out[0].Extras != nil {
+		t.Fatalf("头像等附加字段应被丢弃: %v", out[0].Extras)
+	}
+	if got := out[0].Content; strings.Contains(got, "13812345678") || strings.Contains(got, "zhangsan@") || !strings.Contains(got, "138****5678") {
+		t.Fatalf("联系方式未打码: %q", got)
+	}
+	if got := out[1].Content; got != "@用户A 身份证 110***********1234 已发你" {
+		t.Fatalf("正文替换异常: %q", got)
+	}
+	if out[1].Mentions[0] != "用户A" || out[1].Reference.SenderName != "用户A" || out[1].Reference.Content != "找用户B要" {
+		t.Fatalf("引用与提及异常: %+v %+v", out[1].Mentions, out[1].Reference)
+	}
+	if got := out[2].Content; got != `"用户B"邀请"用户C"加入了群聊` {
+		t.Fatalf("系统消息异常: %q", got)
+	}
+	if msgs[0].SenderName != "张三" || msgs[1].Reference.SenderName != "张三" {
+		t.Fatal("原始消息不应被修改")
+	}
+
+	if err := r.Save(); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	// A later day with a renamed member and a newcomer keeps earlier pseudonyms.
+	later := reopened.Messages([]chatlog.Message{
+		{Sender: "wxid_new", SenderName: "赵六", Content: "hi"},
+		{Sender: "wxid_zhang", SenderName: "张三丰", Content: "改名了"},
+	})
+	if later[0].SenderName != "用户D" || later[1].SenderName != "用户A" {
+		t.Fatalf("化名应跨天稳定: %q %q", later[0].SenderName, later[1].SenderName)
+	}
+}
+
+func TestLetters(t *testing.T) {
+	for n, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := letters(n); got != want {
+			t.Errorf("letters(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package render
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteAssistantPage writes site/assistant.html, a chat page that sends
+// questions to /api/v1/ask under apiBase (empty for the site's own origin)
+// and streams the answers, linking each cited message to its day page.
+func WriteAssistantPage(siteDir, apiBase string) error {
+	t, err := newTemplate("assistant.html").ParseFS(tplFS, "templates/assistant.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	return writeTemplate(t, filepath.Join(siteDir, "assistant.html"), map[string]any{
+		"AskURL":      strings.TrimRight(apiBase, "/") + "/api/v1/ask",
+		"GeneratedAt": time.Now().Format(time.RFC3339),
+	})
+}
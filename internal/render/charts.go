@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/i18n"
+)
+
+// EChartsAsset is where InstallECharts puts echarts.min.js, relative to the
+// site root.
+const EChartsAsset = "assets/echarts.min.js"
+
+// ChartData is embedded in the day page as a JSON block for the ECharts
+// versions of the hourly activity, sentiment and sender share charts.
+type ChartData struct {
+	Hours    []string `json:"hours"`
+	Messages []int    `json:"messages"`
+	// Positive and Negative are the weighted sentiment per hour; empty
+	// when the day had no sentiment signal.
+	Positive []float64   `json:"positive,omitempty"`
+	Negative []float64   `json:"negative,omitempty"`
+	Senders  []ChartItem `json:"senders"`
+}
+
+// ChartItem is one pie slice.
+type ChartItem struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func buildChartData(ctx DayContext) ChartData {
+	d := ChartData{Hours: make([]string, 0, 24), Messages: make([]int, 0, 24)}
+	for _, s := range ctx.ActivitySeries {
+		d.Hours = append(d.Hours, s.Label)
+		d.Messages = append(d.Messages, s.Count)
+	}
+	for _, s := range ctx.SentimentSeries {
+		d.Positive = append(d.Positive, s.Positive)
+		d.Negative = append(d.Negative, s.Negative)
+	}
+	rest := ctx.Summary.TotalMessages
+	for _, s := range ctx.SenderViews {
+		d.Senders = append(d.Senders, ChartItem{Name: s.Name, Value: s.Count})
+		rest -= s.Count
+	}
+	if rest > 0 && len(d.Senders) > 0 {
+		d.Senders = append(d.Senders, ChartItem{Name: i18n.T("其他"), Value: rest})
+	}
+	return d
+}
+
+// InstallECharts copies the echarts.min.js at src into the site, rewriting
+// it only when the content changed so the manifest and uploads stay quiet.
+func InstallECharts(siteDir, src string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(b, []byte("echarts")) {
+		return fmt.Errorf("%s does not look like echarts.min.js", src)
+	}
+	dst := filepath.Join(siteDir, filepath.FromSlash(EChartsAsset))
+	if old, err := os.ReadFile(dst); err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+	return atomicfile.WriteFile(dst, b)
+}
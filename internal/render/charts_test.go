@@ -0,0 +1,116 @@
+package render
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/summarize"
+)
+
+// chartDataOf extracts the JSON block the ECharts script reads from a
+// rendered day page.
+func chartDataOf(t *testing.T, page string) (ChartData, bool) {
+	t.Helper()
+	_, rest, ok := strings.Cut(page, `<script type="application/json" id="chart-data">`)
+	if !ok {
+		return ChartData{}, false
+	}
+	body, _, _ := strings.Cut(rest, "</script>")
+	var d ChartData
+	if err := json.Unmarshal([]byte(body), &d); err != nil {
+		t.Fatalf("图表数据不是合法 JSON: %v\n%s", err, body)
+	}
+	return d, true
+}
+
+func TestDayPageEmbedsChartData(t *testing.T) {
+	sum := summarize.Summary{TotalMessages: 12, TopSenders: []summarize.KV{{Key: "阿强", Count: 6}, {Key: "小美", Count: 4}}}
+	sum.HourlyHistogram[9] = 5
+	sum.HourlyHistogram[3] = 7
+	sum.HourlySentiment[9] = summarize.HourSentiment{Positive: 2, Negative: 0.5}
+	ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom", Summary: sum, DayStartHour: 4, ChartsScript: "../../../" + EChartsAsset}
+
+	out := filepath.Join(t.TempDir(), "index.html")
+	if err := DayHTML(out, ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	if !strings.Contains(page, `<script src="../../../assets/echarts.min.js"></script>`) {
+		t.Fatal("页面未引用本地 ECharts")
+	}
+	d, ok := chartDataOf(t, page)
+	if !ok {
+		t.Fatal("页面缺少图表数据")
+	}
+	// 按 dayStartHour 从 04 点排到次日 03 点
+	if len(d.Hours) != 24 || d.Hours[0] != "04" || d.Hours[23] != "03" {
+		t.Fatalf("小时轴异常: %v", d.Hours)
+	}
+	if d.Messages[5] != 5 || d.Messages[23] != 7 {
+		t.Fatalf("每小时消息数异常: %v", d.Messages)
+	}
+	if len(d.Positive) != 24 || d.Positive[5] != 2 || d.Negative[5] != 0.5 {
+		t.Fatalf("情绪曲线异常: %v / %v", d.Positive, d.Negative)
+	}
+	want := []ChartItem{{Name: "阿强", Value: 6}, {Name: "小美", Value: 4}, {Name: "其他", Value: 2}}
+	if !reflect.DeepEqual(d.Senders, want) {
+		t.Fatalf("发言占比 = %+v，期望 %+v", d.Senders, want)
+	}
+
+	ctx.ChartsScript = ""
+	if err := DayHTML(out, ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(out)
+	if _, ok := chartDataOf(t, string(b)); ok || strings.Contains(string(b), "echarts.min.js") {
+		t.Fatal("未配置 echartsFile 时不应嵌入 ECharts")
+	}
+}
+
+func TestInstallECharts(t *testing.T) {
+	dir := t.TempDir()
+	site := filepath.Join(dir, "site")
+	src := filepath.Join(dir, "echarts.min.js")
+	if err := os.WriteFile(src, []byte("alert(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallECharts(site, src); err == nil {
+		t.Fatal("不是 echarts 的脚本应被拒绝")
+	}
+	if err := os.WriteFile(src, []byte("!function(){var echarts={}}()"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallECharts(site, src); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(site, filepath.FromSlash(EChartsAsset))
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(dst, old, old); err != nil {
+		t.Fatal(err)
+	}
+	// 内容不变时不重写，清单与上传保持安静
+	if err := InstallECharts(site, src); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dst); err != nil || !info.ModTime().Equal(old) {
+		t.Fatalf("内容未变却重写了 %s", dst)
+	}
+	if err := os.WriteFile(src, []byte("!function(){var echarts={v:2}}()"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallECharts(site, src); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); !strings.Contains(string(b), "v:2") {
+		t.Fatal("新版本未安装")
+	}
+}
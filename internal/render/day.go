@@ -1,24 +1,27 @@
 package render
 
 import (
-	"embed"
 	"fmt"
 	"html/template"
+	"math"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
 	"wechat-view/internal/chatlog"
+	"wechat-view/internal/claims"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/media"
 	"wechat-view/internal/summarize"
+	"wechat-view/internal/unfurl"
 )
 
-//go:embed templates/*
-var tplFS embed.FS
-
 type DayContext struct {
 	Date               string
 	Talker             string
@@ -30,17 +33,91 @@ type DayContext struct {
 	MessageLimit       int
 	HiddenMessageCount int
 	ActivitySeries     []HourSlot
+	SentimentSeries    []SentimentSlot
+	MoodNotes          []string
 	SenderViews        []SenderView
 	LinkViews          []LinkView
 	KeywordViews       []KeywordView
 	AIInsights         *AIInsights
+	// AIVariants lists each arm of an LLM A/B comparison; the page shows
+	// them as switchable tabs when there is more than one.
+	AIVariants []AIVariant
+	// Headline and ShareText come from llm.headline: the headline leads the
+	// page title and header, the share text is the OpenGraph description.
+	Headline  string
+	ShareText string
+	// AIRejected lists why llm.guardrails dropped the day's insights.
+	AIRejected []GuardIssue
+	PDFURL     string
+	Version    string
+	// UpdateNotice is shown in the footer when a newer release exists.
+	UpdateNotice string
+	UpdateURL    string
+	// Watermark is invisible text placed once in the heading of the
+	// overview, AI insights and message sections and of each transcript
+	// page; see internal/watermark. Empty disables it.
+	Watermark string
+	// GeneratedAt and Provenance are stamped into the page head and footer so
+	// exported copies (PDF, saved HTML) show where they came from.
+	GeneratedAt string
+	Provenance  string
+	// DataVersion is shown in the footer; versions above 1 add an
+	// "updated" notice so readers know the page reflects refetched data.
+	DataVersion *archive.DataVersion
+	// Regen is the latest regeneration that changed the page, shown as a
+	// "本页已于 X 重新生成" notice; see archive.DiffMeta.
+	Regen *archive.MetaDiff
+	// LocalMedia maps image MD5s to archived copies relative to the page;
+	// those images are served locally instead of from ImageBaseURL.
+	LocalMedia map[string]string
+	// Claims holds the assign/resolve state of outstanding questions by id.
+	Claims map[string]claims.Claim
+	// Graph is the laid-out interaction network; GraphJSON links its export.
+	Graph     *GraphView
+	GraphJSON string
+	// LinkPreviews supplies fetched titles and descriptions for links
+	// shared without a preview card; nil leaves them as host names.
+	LinkPreviews *unfurl.Cache
+	// HideSections names the sections left out of the page (see
+	// DaySections); "messages" drops the transcript entirely.
+	HideSections []string
+	// ChartsScript is the URL of echarts.min.js relative to the page. When
+	// set the charts are drawn with ECharts from ChartData; the CSS bars
+	// stay for printing and readers without scripts.
+	ChartsScript string
+	ChartData    ChartData
+	// WordCloud is the keyword cloud; SearchURL, when set, links each word
+	// to the site search relative to the page.
+	WordCloud *WordCloudView
+	SearchURL string
+	// MessagePageSize splits the full transcript into messages/N.html
+	// pages of this many messages when MessageLimit truncates the preview;
+	// 0 keeps only the preview.
+	MessagePageSize int
+	MessagePages    []MessagePageLink
+	HourJumps       []HourJump
+	// DayStartHour is report.dayStartHour: the hourly charts start at this
+	// hour, and a non-zero value is shown next to the date.
+	DayStartHour int
 }
 
+// DaySections are the day page sections that can be hidden, each rendered
+// by the "section-<name>" block of templates/day-sections.html.
+var DaySections = []string{"highlights", "vibes", "ai-insights", "activity", "reply-debt", "topics", "links", "messages"}
+
 func DayHTML(outPath string, ctx DayContext) error {
-	ctx.ActivitySeries = buildActivitySeries(ctx.Summary.HourlyHistogram)
+	ctx.ActivitySeries = buildActivitySeries(ctx.Summary.HourlyHistogram, ctx.DayStartHour)
+	ctx.SentimentSeries = buildSentimentSeries(ctx.Summary.HourlySentiment, ctx.DayStartHour)
+	ctx.MoodNotes = moodNotes(ctx.Summary.MoodTurns)
 	ctx.SenderViews = buildSenderViews(ctx.Summary.TopSenders, ctx.Summary.TotalMessages)
-	ctx.LinkViews = buildLinkViews(ctx.Summary.TopLinks, ctx.Messages)
+	ctx.LinkViews = buildLinkViews(ctx.Summary.TopLinks, ctx.Messages, ctx.LinkPreviews)
 	ctx.KeywordViews = buildKeywordViews(ctx.Summary.Keywords, 20)
+	ctx.Graph = buildGraphView(ctx.Summary.Interactions)
+	ctx.WordCloud = buildWordCloud(ctx.Summary.Keywords)
+	if ctx.ChartsScript != "" {
+		ctx.ChartData = buildChartData(ctx)
+	}
+	all := ctx.Messages
 	if ctx.MessageLimit > 0 && len(ctx.Messages) > ctx.MessageLimit {
 		start := len(ctx.Messages) - ctx.MessageLimit
 		if start < 0 {
@@ -49,113 +126,148 @@ func DayHTML(outPath string, ctx DayContext) error {
 		ctx.HiddenMessageCount = start
 		ctx.Messages = append([]chatlog.Message(nil), ctx.Messages[start:]...)
 	}
+	hidden := make(map[string]bool, len(ctx.HideSections))
+	for _, name := range ctx.HideSections {
+		hidden[name] = true
+	}
+	var tr *transcript
+	if ctx.HiddenMessageCount > 0 && ctx.MessagePageSize > 0 && !hidden["messages"] {
+		tr = paginate(all, ctx.MessagePageSize)
+		ctx.MessagePages, ctx.HourJumps = tr.linksFrom(MessagePagesDir + "/")
+	}
+	var src *sourceIndex
+	if !hidden["messages"] {
+		src = newSourceIndex(ctx.Date, all, ctx.Messages, tr, MessagePagesDir+"/")
+	}
 
-	funcMap := template.FuncMap{
+	t, err := newTemplate("day").Funcs(dayFuncs(&ctx, hidden, "", src)).ParseFS(tplFS, "templates/day.html", "templates/day-sections.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	f, err := atomicfile.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if err := t.Execute(f, ctx); err != nil {
+		return err
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	return writeMessagePages(filepath.Dir(outPath), ctx, hidden, tr, all)
+}
+
+// dayFuncs returns the template functions of the day page and its message
+// pages; up is the path from the page to the day directory ("" or "../").
+// src links summaries to their source messages; nil leaves them unlinked.
+func dayFuncs(ctx *DayContext, hidden map[string]bool, up string, src *sourceIndex) template.FuncMap {
+	return template.FuncMap{
 		"imageURL": func(base string, m chatlog.Message) string {
-			if base == "" || m.MediaPath == "" || m.MediaMD5 == "" {
-				return ""
+			if local, ok := ctx.LocalMedia[m.MediaMD5]; ok {
+				return up + local
 			}
-			// keep backslashes in path per local API requirement
-			return strings.TrimRight(base, "/") + "/image/" + m.MediaMD5 + "," + m.MediaPath
+			return media.ImageURL(base, m)
 		},
+		"imageBase":       func() string { return ctx.ImageBaseURL },
+		"watermark":       func() string { return ctx.Watermark },
 		"isImage":         func(m chatlog.Message) bool { return m.MsgType == 3 },
 		"host":            hostOnly,
 		"formatTimestamp": formatTimestamp,
 		"percent":         func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) },
 		"join":            strings.Join,
+		"shortTime":       shortTime,
+		"fileSize":        fileSize,
+		"isRedPacket":     summarize.IsRedPacket,
+		"isTransfer":      summarize.IsTransfer,
+		"isShare":         summarize.IsShare,
+		"favicon":         faviconURL,
+		"hostInitial":     hostInitial,
+		"duration":        duration,
+		"trend":           trend,
+		"first":           firstN,
+		"show":            func(section string) bool { return !hidden[section] },
+		"hours":           func(minutes float64) float64 { return minutes / 60 },
+		"personName":      personName,
+		"msgAnchor":       messageAnchor,
+		"replySource":     src.reply,
+		"quoteSource":     src.quote,
+		"referenceURL":    src.reference,
+		"quotedText":      quotedText,
+		"personURL": func(name string) string {
+			return up + "../../../people/" + personSlug(strings.TrimSpace(name)) + "/index.html"
+		},
 	}
-	t, err := template.New("day").Funcs(funcMap).ParseFS(tplFS, "templates/day.html")
-	if err != nil {
-		return err
-	}
-	f, err := createAtomic(outPath)
-	if err != nil {
-		return err
-	}
-	defer f.abort()
-	if err := t.Execute(f.tmp, ctx); err != nil {
-		return err
-	}
-	return f.commit()
 }
 
 func UpdateHomeIndex(siteDir, dataDir string, recentDays int) error {
-	// Scan dataDir for YYYY-MM-DD.json files and pick the most recent N
-	entries, err := os.ReadDir(dataDir)
+	// Days with raw data or a rendered page; pick the most recent N
+	days, err := archive.ReportDays(dataDir, siteDir)
 	if err != nil {
 		return err
 	}
-	days := make([]string, 0, len(entries))
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if len(name) == 15 && name[4] == '-' && name[7] == '-' && name[10:] == ".json" {
-			days = append(days, name[:10])
-		}
-	}
-	sort.Strings(days)
 	if len(days) > recentDays {
 		days = days[len(days)-recentDays:]
 	}
 	// Build items for template
-	type item struct{ Date, URL, Label string }
+	type item struct {
+		Date, URL, Label string
+		Updated          bool
+	}
 	items := make([]item, 0, len(days))
 	for i := len(days) - 1; i >= 0; i-- { // newest first
 		day := days[i]
 		y, m, d := day[:4], day[5:7], day[8:10]
-		items = append(items, item{
+		it := item{
 			Date:  day,
 			URL:   filepath.ToSlash(filepath.Join(y, m, d, "index.html")),
 			Label: mustFormatLabel(day),
-		})
+		}
+		if meta, err := archive.LoadMeta(siteDir, day); err == nil && meta.DataVersion != nil {
+			it.Updated = meta.DataVersion.Version > 1
+		}
+		items = append(items, it)
 	}
 
-	t, err := template.ParseFS(tplFS, "templates/index.html")
+	t, err := newTemplate("index.html").ParseFS(tplFS, "templates/index.html", "templates/theme.html")
 	if err != nil {
 		return err
 	}
-	f, err := createAtomic(filepath.Join(siteDir, "index.html"))
+	f, err := atomicfile.Create(filepath.Join(siteDir, "index.html"))
 	if err != nil {
 		return err
 	}
-	defer f.abort()
-	data := map[string]any{"Items": items, "GeneratedAt": time.Now().Format(time.RFC3339)}
-	if err := t.Execute(f.tmp, data); err != nil {
+	defer f.Abort()
+	data := map[string]any{"Items": items, "GeneratedAt": time.Now().Format(time.RFC3339), "Sections": siteSections(siteDir)}
+	if err := t.Execute(f, data); err != nil {
 		return err
 	}
-	return f.commit()
+	return f.Commit()
 }
 
-type atomicFile struct {
-	tmp   *os.File
-	final string
-}
+// siteSection is a cross-day page linked from the home index.
+type siteSection struct{ Title, URL string }
 
-func createAtomic(final string) (*atomicFile, error) {
-	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
-		return nil, err
-	}
-	tmp, err := os.CreateTemp(filepath.Dir(final), ".tmp-*")
-	if err != nil {
-		return nil, err
-	}
-	return &atomicFile{tmp: tmp, final: final}, nil
-}
-
-func (a *atomicFile) commit() error {
-	if err := a.tmp.Close(); err != nil {
-		return err
-	}
-	return os.Rename(a.tmp.Name(), a.final)
-}
-
-func (a *atomicFile) abort() {
-	if a.tmp != nil {
-		_ = a.tmp.Close()
-		_ = os.Remove(a.tmp.Name())
+// siteSections lists the aggregate pages that exist under siteDir.
+func siteSections(siteDir string) []siteSection {
+	candidates := []siteSection{
+		{Title: i18n.T("标签趋势"), URL: "tags/index.html"},
+		{Title: i18n.T("搜索"), URL: "search.html"},
+		{Title: i18n.T("群聊助手"), URL: "assistant.html"},
+		{Title: i18n.T("链接库"), URL: "links/index.html"},
+		{Title: i18n.T("问答知识库"), URL: "qa/index.html"},
+		{Title: i18n.T("周报"), URL: "weekly/index.html"},
+		{Title: i18n.T("话题时间线"), URL: "topics/index.html"},
+		{Title: i18n.T("成员档案"), URL: "people/index.html"},
+		{Title: i18n.T("成员月报"), URL: "members/index.html"},
+	}
+	out := make([]siteSection, 0, len(candidates))
+	for _, c := range candidates {
+		if _, err := os.Stat(filepath.Join(siteDir, filepath.FromSlash(c.URL))); err == nil {
+			out = append(out, c)
+		}
 	}
+	return out
 }
 
 func mustFormatLabel(day string) string {
@@ -198,9 +310,41 @@ type AIInsights struct {
 	Risks         []string
 	Actions       []string
 	Spotlight     string
+	// FallbackModel names the llm.fallbackModels entry that wrote the
+	// insights after the primary model failed.
+	FallbackModel string
+	// Flags lists the llm.guardrails problems of insights kept with
+	// action "flag".
+	Flags []GuardIssue
 }
 
-func buildActivitySeries(hist [24]int) []HourSlot {
+// GuardIssue is an llm.guardrails problem; Kind is "name", "length" or
+// "banned".
+type GuardIssue struct {
+	Kind string
+	Text string
+}
+
+type AIVariant struct {
+	Label     string
+	Model     string
+	Score     int
+	LatencyMS int64
+	Error     string
+	Insights  *AIInsights
+}
+
+// dayHours lists the hours of a report day starting at start, so the hours
+// after midnight come last when days start later.
+func dayHours(start int) []int {
+	hours := make([]int, 24)
+	for i := range hours {
+		hours[i] = (start + i) % 24
+	}
+	return hours
+}
+
+func buildActivitySeries(hist [24]int, start int) []HourSlot {
 	slots := make([]HourSlot, 0, len(hist))
 	max := 0
 	for _, v := range hist {
@@ -208,7 +352,8 @@ func buildActivitySeries(hist [24]int) []HourSlot {
 			max = v
 		}
 	}
-	for hour, count := range hist {
+	for _, hour := range dayHours(start) {
+		count := hist[hour]
 		percent := 0.0
 		if max > 0 {
 			percent = float64(count) / float64(max) * 100
@@ -222,6 +367,48 @@ func buildActivitySeries(hist [24]int) []HourSlot {
 	return slots
 }
 
+// SentimentSlot is one hour of the sentiment chart; the percents scale the
+// positive (up) and negative (down) bars against the strongest hour.
+type SentimentSlot struct {
+	Label      string
+	Positive   float64
+	Negative   float64
+	PosPercent float64
+	NegPercent float64
+}
+
+// buildSentimentSeries returns nil when the day had no sentiment signal.
+func buildSentimentSeries(hours [24]summarize.HourSentiment, start int) []SentimentSlot {
+	max := 0.0
+	for _, h := range hours {
+		max = math.Max(max, math.Max(h.Positive, h.Negative))
+	}
+	if max == 0 {
+		return nil
+	}
+	slots := make([]SentimentSlot, 0, len(hours))
+	for _, hour := range dayHours(start) {
+		h := hours[hour]
+		slots = append(slots, SentimentSlot{
+			Label:      fmt.Sprintf("%02d", hour),
+			Positive:   h.Positive,
+			Negative:   h.Negative,
+			PosPercent: h.Positive / max * 100,
+			NegPercent: h.Negative / max * 100,
+		})
+	}
+	return slots
+}
+
+func moodNotes(turns []summarize.MoodTurn) []string {
+	label := map[string]string{summarize.MoodPositive: i18n.T("正"), summarize.MoodNegative: i18n.T("负")}
+	out := make([]string, 0, len(turns))
+	for _, t := range turns {
+		out = append(out, i18n.Tf("%02d:00 前后情绪由%s转%s", t.Hour, label[t.From], label[t.To]))
+	}
+	return out
+}
+
 func buildSenderViews(items []summarize.KV, total int) []SenderView {
 	views := make([]SenderView, 0, len(items))
 	tot := float64(total)
@@ -239,66 +426,57 @@ func buildSenderViews(items []summarize.KV, total int) []SenderView {
 	return views
 }
 
-func buildLinkViews(urls []string, messages []chatlog.Message) []LinkView {
-	freq := make(map[string]int)
+// buildLinkViews describes urls, the summary's top links, with share card
+// titles and a snippet of the message that posted them. Links in messages
+// are matched in their normalized form, after shortlinks are resolved
+// through previews, the way the summary counted them.
+func buildLinkViews(urls []string, messages []chatlog.Message, previews *unfurl.Cache) []LinkView {
+	wanted := make(map[string]bool, len(urls))
 	ordered := make([]string, 0, len(urls))
 	for _, u := range urls {
-		if _, ok := freq[u]; !ok {
+		if !wanted[u] {
+			wanted[u] = true
 			ordered = append(ordered, u)
 		}
-		freq[u]++
 	}
 	meta := make(map[string]LinkView)
 	for _, msg := range messages {
-		if msg.Share != nil && msg.Share.URL != "" {
-			u := msg.Share.URL
-			entry := meta[u]
-			entry.URL = u
-			entry.Host = hostOnly(u)
-			if entry.Title == "" && msg.Share.Title != "" {
-				entry.Title = msg.Share.Title
+		snippet := ""
+		if text := firstNonEmptyStr(msg.Content, msg.Text); strings.TrimSpace(text) != "" {
+			snippet = buildLinkSnippet(text)
+		}
+		for _, l := range messageLinks(msg) {
+			key := summarize.NormalizeURL(previews.Resolve(l.URL))
+			if !wanted[key] {
+				continue
 			}
-			if entry.Desc == "" && msg.Share.Desc != "" {
-				entry.Desc = msg.Share.Desc
+			entry := meta[key]
+			entry.URL, entry.Host = key, hostOnly(key)
+			if entry.Title == "" {
+				entry.Title = l.Title
 			}
-			meta[u] = entry
-		}
-		text := firstNonEmptyStr(msg.Content, msg.Text)
-		if strings.TrimSpace(text) == "" {
-			continue
-		}
-		snippet := buildLinkSnippet(text)
-		if snippet == "" {
-			continue
-		}
-		for _, u := range urls {
-			if strings.Contains(text, u) {
-				entry := meta[u]
-				if entry.URL == "" {
-					entry.URL = u
-					entry.Host = hostOnly(u)
-				}
-				if entry.Snippet == "" {
-					entry.Snippet = snippet
-				}
-				if entry.Title == "" {
-					entry.Title = entry.Host
-				}
-				meta[u] = entry
-				break
+			if entry.Desc == "" {
+				entry.Desc = l.Desc
+			}
+			if entry.Snippet == "" && l.Title == "" {
+				entry.Snippet = snippet
 			}
+			meta[key] = entry
 		}
 	}
 	out := make([]LinkView, 0, len(ordered))
 	for _, u := range ordered {
-		if entry, ok := meta[u]; ok {
-			if entry.Title == "" {
-				entry.Title = hostOnly(u)
-			}
-			out = append(out, entry)
-			continue
+		entry, ok := meta[u]
+		if !ok {
+			entry = LinkView{URL: u, Host: hostOnly(u)}
+		}
+		if p, ok := previews.Get(u); ok && entry.Title == "" {
+			entry.Title, entry.Desc = p.Title, firstNonEmptyStr(entry.Desc, p.Desc)
 		}
-		out = append(out, LinkView{URL: u, Host: hostOnly(u), Title: hostOnly(u)})
+		if entry.Title == "" {
+			entry.Title = entry.Host
+		}
+		out = append(out, entry)
 	}
 	return out
 }
@@ -337,6 +515,27 @@ func hostOnly(raw string) string {
 	return raw
 }
 
+// faviconURL is the conventional favicon of the site raw points at, or ""
+// for anything but an http(s) URL.
+func faviconURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/favicon.ico"
+}
+
+// hostInitial is the letter a share card shows until, or instead of, the
+// favicon.
+func hostInitial(raw string) string {
+	host := strings.TrimPrefix(hostOnly(raw), "www.")
+	r, size := utf8.DecodeRuneInString(host)
+	if size == 0 || r == utf8.RuneError {
+		return "🔗"
+	}
+	return strings.ToUpper(string(r))
+}
+
 func buildKeywordViews(items []summarize.KV, limit int) []KeywordView {
 	if limit > 0 && len(items) > limit {
 		items = items[:limit]
@@ -348,6 +547,54 @@ func buildKeywordViews(items []summarize.KV, limit int) []KeywordView {
 	return out
 }
 
+// shortTime renders an RFC3339 stamp as local "2006-01-02 15:04".
+func shortTime(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// fileSize renders a byte count as B, KB, MB or GB.
+func fileSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, i := float64(n)/unit, 0
+	for v >= unit && i < 2 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, [...]string{"KB", "MB", "GB"}[i])
+}
+
+// duration renders seconds as m:ss.
+func duration(sec int) string {
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
+
+// trend names the direction of a change for the delta badges: "up",
+// "down" or "flat".
+func trend(change int) string {
+	switch {
+	case change > 0:
+		return "up"
+	case change < 0:
+		return "down"
+	}
+	return "flat"
+}
+
+// firstN returns at most n leading items of list.
+func firstN(n int, list []string) []string {
+	if len(list) > n {
+		return list[:n]
+	}
+	return list
+}
+
 func formatTimestamp(ts int64) string {
 	if ts <= 0 {
 		return ""
@@ -0,0 +1,154 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/summarize"
+)
+
+func TestDaySectionsHaveBlocks(t *testing.T) {
+	tpl, err := newTemplate("day").Funcs(dayFuncs(&DayContext{}, nil, "", nil)).ParseFS(tplFS, "templates/day.html", "templates/day-sections.html", "templates/theme.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range DaySections {
+		if tpl.Lookup("section-"+name) == nil {
+			t.Errorf("DaySections 中的 %s 没有对应的 section-%s 模板块", name, name)
+		}
+	}
+}
+
+func TestDayHTMLHidesSections(t *testing.T) {
+	sum := summarize.Summary{
+		TotalMessages: 5,
+		TopSenders:    []summarize.KV{{Key: "阿强", Count: 5}},
+		TopLinks:      []string{"https://docs.example.com/deploy"},
+	}
+	msgs := msgsAt("09:00", "09:10", "09:20", "09:30", "09:40")
+	render := func(hide ...string) (string, string) {
+		t.Helper()
+		dayDir := t.TempDir()
+		out := filepath.Join(dayDir, "index.html")
+		ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom", Summary: sum, Messages: msgs, MessageLimit: 2, MessagePageSize: 2, HideSections: hide}
+		if err := DayHTML(out, ctx); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b), dayDir
+	}
+	headings := map[string]string{"activity": "<h2>互动热度</h2>", "topics": "<h3>Top 发送者</h3>", "links": "<h3>热门链接</h3>", "messages": "<h2>消息时间线"}
+
+	page, dayDir := render()
+	for section, h := range headings {
+		if !strings.Contains(page, h) {
+			t.Fatalf("默认应显示 %s 区块", section)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dayDir, MessagePagesDir, "1.html")); err != nil {
+		t.Fatalf("未生成完整消息分页: %v", err)
+	}
+
+	page, dayDir = render("messages", "links")
+	for section, h := range headings {
+		hidden := section == "messages" || section == "links"
+		if strings.Contains(page, h) == hidden {
+			t.Fatalf("%s 区块显示状态异常（隐藏=%v）", section, hidden)
+		}
+	}
+	// 隐藏消息时间线时不发布完整记录，也不从摘要链接到消息
+	if _, err := os.Stat(filepath.Join(dayDir, MessagePagesDir)); !os.IsNotExist(err) {
+		t.Fatalf("隐藏消息后仍生成了分页: %v", err)
+	}
+	if strings.Contains(page, `href="#m-`) || strings.Contains(page, MessagePagesDir+"/") {
+		t.Fatal("隐藏消息后页面仍链接到消息")
+	}
+
+	// 话题与链接共用一个面板，两者都隐藏时整块去掉
+	page, _ = render("topics", "links")
+	if strings.Contains(page, "群内热议") {
+		t.Fatal("话题与链接都隐藏时面板仍然存在")
+	}
+}
+
+func TestChromePDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("假浏览器是 shell 脚本")
+	}
+	dir := t.TempDir()
+	page := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(page, []byte("<p>日报</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 假浏览器把收到的参数写进 PDF，便于检查调用方式
+	fake := filepath.Join(dir, "chromium")
+	script := `#!/bin/sh
+[ -n "$FAIL" ] && { echo "crashed" >&2; exit 3; }
+for a in "$@"; do case "$a" in --print-to-pdf=*) out="${a#--print-to-pdf=}";; esac; done
+printf '%%PDF %s' "$*" > "$out"
+`
+	if err := os.WriteFile(fake, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := NewPDFRenderer("Chromium", fake, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "report.pdf")
+	if err := pdf.RenderPDF(context.Background(), page, out); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "%PDF") || !strings.Contains(string(b), "--headless") || !strings.Contains(string(b), "file://"+filepath.ToSlash(page)) {
+		t.Fatalf("浏览器调用参数异常: %s", b)
+	}
+
+	// 打印失败时报错，保留旧的 report.pdf，也不留下临时文件
+	t.Setenv("FAIL", "1")
+	err = pdf.RenderPDF(context.Background(), page, out)
+	if err == nil || !strings.Contains(err.Error(), "crashed") {
+		t.Fatalf("浏览器失败未报告: %v", err)
+	}
+	if again, _ := os.ReadFile(out); string(again) != string(b) {
+		t.Fatal("失败的打印覆盖了旧 PDF")
+	}
+	for _, name := range dirNames(t, dir) {
+		if strings.HasPrefix(name, atomicfile.Prefix) {
+			t.Fatalf("残留临时文件 %s", name)
+		}
+	}
+
+	if _, err := NewPDFRenderer("wkhtmltopdf", "", 0); err == nil {
+		t.Fatal("未知的渲染器应报错")
+	}
+}
+
+func TestDayHTMLLinksPDFOnlyWhenSet(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "index.html")
+	ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom"}
+	for _, pdfURL := range []string{"", "report.pdf"} {
+		ctx.PDFURL = pdfURL
+		if err := DayHTML(out, ctx); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked := strings.Contains(string(b), `<a href="report.pdf">下载 PDF</a>`); linked != (pdfURL != "") {
+			t.Fatalf("PDFURL=%q 时链接显示为 %v", pdfURL, linked)
+		}
+	}
+}
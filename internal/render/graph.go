@@ -0,0 +1,196 @@
+package render
+
+import (
+	"math"
+	"path/filepath"
+
+	"wechat-view/internal/summarize"
+)
+
+// GraphJSONName is the interaction graph export written next to a day page.
+const GraphJSONName = "graph.json"
+
+// Interaction graph drawing area and node cap for the day page.
+const (
+	graphWidth    = 640
+	graphHeight   = 420
+	graphMaxNodes = 30
+)
+
+// GraphView is the laid-out interaction graph drawn as inline SVG.
+type GraphView struct {
+	Width, Height int
+	Nodes         []GraphNodeView
+	Edges         []GraphEdgeView
+	// Hidden counts participants left out to keep the drawing readable.
+	Hidden int
+}
+
+// GraphNodeView is a positioned participant.
+type GraphNodeView struct {
+	Name       string
+	X, Y, R    float64
+	In, Out    int
+	Centrality float64
+}
+
+// GraphEdgeView is a line between two node borders.
+type GraphEdgeView struct {
+	From, To       string
+	X1, Y1, X2, Y2 float64
+	Width          float64
+	Weight         int
+}
+
+// buildGraphView lays out the most central nodes with a deterministic
+// Fruchterman-Reingold pass: nodes start on a circle, edges pull and all
+// pairs repel, and the step cools over a fixed number of rounds.
+func buildGraphView(g summarize.InteractionGraph) *GraphView {
+	if len(g.Edges) == 0 {
+		return nil
+	}
+	nodes := g.Nodes
+	view := &GraphView{Width: graphWidth, Height: graphHeight}
+	if len(nodes) > graphMaxNodes {
+		view.Hidden = len(nodes) - graphMaxNodes
+		nodes = nodes[:graphMaxNodes]
+	}
+	index := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		index[n.Name] = i
+	}
+	type link struct{ a, b, w int }
+	var links []link
+	for _, e := range g.Edges {
+		a, okA := index[e.From]
+		b, okB := index[e.To]
+		if okA && okB {
+			links = append(links, link{a, b, e.Weight})
+		}
+	}
+
+	n := len(nodes)
+	w, h := float64(graphWidth), float64(graphHeight)
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i := range nodes {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		x[i] = w/2 + w/3*math.Cos(angle)
+		y[i] = h/2 + h/3*math.Sin(angle)
+	}
+	k := math.Sqrt(w * h / float64(n))
+	temp := w / 10
+	const rounds = 200
+	dx := make([]float64, n)
+	dy := make([]float64, n)
+	for round := 0; round < rounds; round++ {
+		for i := range dx {
+			dx[i], dy[i] = 0, 0
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				ddx, ddy := x[i]-x[j], y[i]-y[j]
+				dist := math.Max(math.Hypot(ddx, ddy), 0.01)
+				f := k * k / dist
+				dx[i] += ddx / dist * f
+				dy[i] += ddy / dist * f
+				dx[j] -= ddx / dist * f
+				dy[j] -= ddy / dist * f
+			}
+		}
+		for _, l := range links {
+			ddx, ddy := x[l.a]-x[l.b], y[l.a]-y[l.b]
+			dist := math.Max(math.Hypot(ddx, ddy), 0.01)
+			f := dist * dist / k * (1 + math.Log(float64(l.w)))
+			dx[l.a] -= ddx / dist * f
+			dy[l.a] -= ddy / dist * f
+			dx[l.b] += ddx / dist * f
+			dy[l.b] += ddy / dist * f
+		}
+		for i := 0; i < n; i++ {
+			// weak gravity keeps disconnected pieces on screen
+			dx[i] += (w/2 - x[i]) * 0.05
+			dy[i] += (h/2 - y[i]) * 0.05
+			d := math.Max(math.Hypot(dx[i], dy[i]), 0.01)
+			step := math.Min(d, temp)
+			x[i] = clamp(x[i]+dx[i]/d*step, 40, w-40)
+			y[i] = clamp(y[i]+dy[i]/d*step, 24, h-24)
+		}
+		temp *= 1 - 1.0/rounds*3
+		if temp < 1 {
+			temp = 1
+		}
+	}
+
+	for i, nd := range nodes {
+		view.Nodes = append(view.Nodes, GraphNodeView{
+			Name:       nd.Name,
+			X:          round1(x[i]),
+			Y:          round1(y[i]),
+			R:          round1(5 + 11*nd.Centrality),
+			In:         nd.In,
+			Out:        nd.Out,
+			Centrality: nd.Centrality,
+		})
+	}
+	for _, l := range links {
+		a, b := view.Nodes[l.a], view.Nodes[l.b]
+		ddx, ddy := b.X-a.X, b.Y-a.Y
+		dist := math.Max(math.Hypot(ddx, ddy), 0.01)
+		ux, uy := ddx/dist, ddy/dist
+		view.Edges = append(view.Edges, GraphEdgeView{
+			From:   a.Name,
+			To:     b.Name,
+			X1:     round1(a.X + ux*a.R),
+			Y1:     round1(a.Y + uy*a.R),
+			X2:     round1(b.X - ux*(b.R+4)),
+			Y2:     round1(b.Y - uy*(b.R+4)),
+			Width:  round1(1 + math.Log(float64(l.w))),
+			Weight: l.w,
+		})
+	}
+	return view
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// graphExport is the node-link JSON understood by d3-force, Gephi's JSON
+// importer and networkx.node_link_graph.
+type graphExport struct {
+	Directed bool              `json:"directed"`
+	Nodes    []graphExportNode `json:"nodes"`
+	Links    []graphExportLink `json:"links"`
+}
+
+type graphExportNode struct {
+	ID         string  `json:"id"`
+	In         int     `json:"in"`
+	Out        int     `json:"out"`
+	Centrality float64 `json:"centrality"`
+}
+
+type graphExportLink struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Weight   int    `json:"weight"`
+	Mentions int    `json:"mentions"`
+	Replies  int    `json:"replies"`
+}
+
+// WriteGraphJSON writes g as dir/graph.json in node-link format.
+func WriteGraphJSON(dir string, g summarize.InteractionGraph) error {
+	out := graphExport{Directed: true, Nodes: []graphExportNode{}, Links: []graphExportLink{}}
+	for _, n := range g.Nodes {
+		out.Nodes = append(out.Nodes, graphExportNode{ID: n.Name, In: n.In, Out: n.Out, Centrality: n.Centrality})
+	}
+	for _, e := range g.Edges {
+		out.Links = append(out.Links, graphExportLink{Source: e.From, Target: e.To, Weight: e.Weight, Mentions: e.Mentions, Replies: e.Replies})
+	}
+	return writeJSON(filepath.Join(dir, GraphJSONName), out)
+}
@@ -0,0 +1,162 @@
+package render
+
+import (
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/redact"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/unfurl"
+)
+
+// LibraryLink is one deduplicated URL on the link library page.
+type LibraryLink struct {
+	URL       string   `json:"url"`
+	Host      string   `json:"host"`
+	Title     string   `json:"title,omitempty"`
+	Desc      string   `json:"desc,omitempty"`
+	FirstSeen string   `json:"firstSeen"`
+	LastSeen  string   `json:"lastSeen"`
+	Sharer    string   `json:"sharer,omitempty"`
+	Count     int      `json:"count"`
+	Sharers   []string `json:"sharers,omitempty"`
+	DayURL    string   `json:"dayURL"`
+}
+
+// sharedLink is a URL found in one message.
+type sharedLink struct {
+	URL, Title, Desc string
+}
+
+// messageLinks returns the links a message shares: its Share card plus any
+// URLs in the text. Trailing punctuation glued on by chat text is trimmed.
+func messageLinks(m chatlog.Message) []sharedLink {
+	var out []sharedLink
+	seen := map[string]bool{}
+	add := func(u, title, desc string) {
+		u = strings.TrimRight(u, linkTrailers)
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		out = append(out, sharedLink{URL: u, Title: title, Desc: desc})
+	}
+	if m.Share != nil && m.Share.URL != "" {
+		add(m.Share.URL, m.Share.Title, m.Share.Desc)
+	}
+	for _, u := range linkURLRegexp.FindAllString(firstNonEmptyStr(m.Content, m.Text), -1) {
+		add(u, "", "")
+	}
+	return out
+}
+
+// linkTrailers is the punctuation trimmed from the end of links in text.
+const linkTrailers = ".,;:!?)）。，"
+
+// BareLinks returns the links in msgs shared as plain text, without a
+// preview card: the ones worth unfurling.
+func BareLinks(msgs []chatlog.Message) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		for _, l := range messageLinks(m) {
+			if l.Title == "" && l.Desc == "" && !seen[l.URL] {
+				seen[l.URL] = true
+				out = append(out, l.URL)
+			}
+		}
+	}
+	return out
+}
+
+// UpdateLinkLibrary writes site/links/index.html (and links.json) listing
+// every URL shared across all days in dataDir, including the history of
+// days whose raw file retention removed. Sharers are named as anon
+// returns them; nil keeps the stored names. Links without a preview card
+// take their title and description from previews when it has them.
+func UpdateLinkLibrary(siteDir, dataDir string, anon *redact.Redactor, previews *unfurl.Cache) error {
+	days, err := archive.HistoryDays(dataDir)
+	if err != nil {
+		return err
+	}
+	byKey := map[string]*LibraryLink{}
+	for _, day := range days {
+		msgs, err := archive.LoadDayMessages(dataDir, day)
+		if err != nil {
+			return err
+		}
+		for _, m := range anon.Messages(msgs) {
+			sender := firstNonEmptyStr(m.SenderName, m.Nickname, m.Sender, m.From)
+			for _, l := range messageLinks(m) {
+				key := summarize.NormalizeURL(previews.Resolve(l.URL))
+				entry := byKey[key]
+				if entry == nil {
+					entry = &LibraryLink{
+						URL:       key,
+						Host:      hostOnly(key),
+						FirstSeen: day,
+						Sharer:    sender,
+						DayURL:    "../" + archive.DayURL(day),
+					}
+					byKey[key] = entry
+				}
+				entry.Count++
+				entry.LastSeen = day
+				if entry.Title == "" {
+					entry.Title = l.Title
+				}
+				if entry.Desc == "" {
+					entry.Desc = l.Desc
+				}
+				if sender != "" && !containsString(entry.Sharers, sender) {
+					entry.Sharers = append(entry.Sharers, sender)
+				}
+			}
+		}
+	}
+	links := make([]*LibraryLink, 0, len(byKey))
+	for _, l := range byKey {
+		if p, ok := previews.Get(l.URL); ok && l.Title == "" {
+			l.Title, l.Desc = p.Title, firstNonEmptyStr(l.Desc, p.Desc)
+		}
+		links = append(links, l)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].FirstSeen != links[j].FirstSeen {
+			return links[i].FirstSeen > links[j].FirstSeen
+		}
+		if links[i].Count != links[j].Count {
+			return links[i].Count > links[j].Count
+		}
+		return links[i].URL < links[j].URL
+	})
+
+	dir := filepath.Join(siteDir, "links")
+	if err := writeJSON(filepath.Join(dir, "links.json"), links); err != nil {
+		return err
+	}
+	funcMap := template.FuncMap{"join": strings.Join}
+	t, err := newTemplate("links.html").Funcs(funcMap).ParseFS(tplFS, "templates/links.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	return writeTemplate(t, filepath.Join(dir, "index.html"), map[string]any{
+		"Links":       links,
+		"DayCount":    len(days),
+		"GeneratedAt": time.Now().Format(time.RFC3339),
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
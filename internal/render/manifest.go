@@ -0,0 +1,188 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
+)
+
+// ManifestName is the manifest file at the site root.
+const ManifestName = "build-manifest.json"
+
+// Manifest describes every file of a generated site so servers and
+// publishers can sync incrementally and invalidate caches.
+type Manifest struct {
+	Version     string               `json:"version"`
+	GeneratedAt string               `json:"generatedAt"`
+	Files       map[string]FileEntry `json:"files"`
+}
+
+// FileEntry describes one site file, keyed by its slash-separated path.
+type FileEntry struct {
+	GeneratedAt string `json:"generatedAt"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	// InputHash identifies the raw data the file was built from: the day's
+	// raw file for day pages, all raw files for cross-day pages.
+	InputHash string `json:"inputHash,omitempty"`
+	// Template is "<name>@<hash>" of the embedded template that rendered it.
+	Template string `json:"template,omitempty"`
+}
+
+var dayFileRegexp = regexp.MustCompile(`^(\d{4})/(\d{2})/(\d{2})/`)
+
+// UpdateManifest walks siteDir and rewrites build-manifest.json. Entries of
+// unchanged files keep their previous generation time.
+func UpdateManifest(siteDir, dataDir, version string) error {
+	prev, _ := LoadManifest(siteDir)
+	inputs, all, err := rawHashes(dataDir)
+	if err != nil {
+		return err
+	}
+	m := Manifest{Version: version, GeneratedAt: time.Now().Format(time.RFC3339), Files: map[string]FileEntry{}}
+	err = filepath.WalkDir(siteDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || name == ManifestName || atomicfile.IsTemp(name) {
+			return nil
+		}
+		rel, err := filepath.Rel(siteDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sum, size, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		entry := FileEntry{Size: size, SHA256: sum, Template: pageTemplate(rel)}
+		if day := dayFileRegexp.FindStringSubmatch(rel); day != nil {
+			entry.InputHash = inputs[day[1]+"-"+day[2]+"-"+day[3]]
+		} else if entry.Template != "" || strings.HasSuffix(rel, ".json") {
+			entry.InputHash = all
+		}
+		if old, ok := prev.Files[rel]; ok && old.SHA256 == sum {
+			entry.GeneratedAt = old.GeneratedAt
+		} else if info, err := d.Info(); err == nil {
+			entry.GeneratedAt = info.ModTime().Format(time.RFC3339)
+		}
+		m.Files[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(siteDir, ManifestName), m)
+}
+
+// LoadManifest reads build-manifest.json from siteDir.
+func LoadManifest(siteDir string) (Manifest, error) {
+	var m Manifest
+	b, err := os.ReadFile(filepath.Join(siteDir, ManifestName))
+	if err != nil {
+		return Manifest{Files: map[string]FileEntry{}}, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{Files: map[string]FileEntry{}}, err
+	}
+	if m.Files == nil {
+		m.Files = map[string]FileEntry{}
+	}
+	return m, nil
+}
+
+// TemplateVersion returns "<name>@<short hash>" for the template in use,
+// so pages rendered from an override in report.templatesDir are told apart.
+func TemplateVersion(name string) string {
+	b, err := fs.ReadFile(tplFS, "templates/"+name)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return name + "@" + hex.EncodeToString(sum[:])[:12]
+}
+
+// pageTemplate maps a site path to the template that produces it.
+func pageTemplate(rel string) string {
+	switch {
+	case dayFileRegexp.MatchString(rel) && path.Base(rel) == "index.html":
+		return TemplateVersion("day.html")
+	case dayFileRegexp.MatchString(rel) && path.Base(path.Dir(rel)) == MessagePagesDir:
+		return TemplateVersion("messages.html")
+	case rel == "index.html":
+		return TemplateVersion("index.html")
+	case rel == "search.html":
+		return TemplateVersion("search.html")
+	case rel == "assistant.html":
+		return TemplateVersion("assistant.html")
+	case strings.HasSuffix(rel, ".html"):
+		switch strings.SplitN(rel, "/", 2)[0] {
+		case "tags":
+			return TemplateVersion("tags.html")
+		case "links":
+			return TemplateVersion("links.html")
+		case "qa":
+			return TemplateVersion("qa.html")
+		case "members":
+			return TemplateVersion("members.html")
+		case "weekly":
+			return TemplateVersion("weekly.html")
+		}
+	}
+	return ""
+}
+
+// rawHashes hashes each raw day file and, combined, the whole data set.
+func rawHashes(dataDir string) (map[string]string, string, error) {
+	days, err := archive.ListDays(dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, "", nil
+		}
+		return nil, "", err
+	}
+	sort.Strings(days)
+	out := make(map[string]string, len(days))
+	all := sha256.New()
+	for _, day := range days {
+		// Hash the JSON itself so compacting a day does not change it.
+		p, _ := archive.FindRaw(dataDir, day)
+		b, err := archive.ReadRawFile(p)
+		if err != nil {
+			return nil, "", err
+		}
+		h := sha256.Sum256(b)
+		sum := hex.EncodeToString(h[:])
+		out[day] = sum[:16]
+		io.WriteString(all, day+":"+sum+"\n")
+	}
+	return out, hex.EncodeToString(all.Sum(nil))[:16], nil
+}
+
+func fileSHA256(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,77 @@
+package render
+
+import (
+	"encoding/json"
+	"html/template"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/members"
+	"wechat-view/internal/redact"
+)
+
+// UpdateMemberReports rebuilds the member lifecycle pages from every raw day
+// in dataDir: site/members/YYYY-MM.html (plus .json) for each month and
+// site/members/index.html showing the latest month. Members are named as
+// anon returns them; nil keeps the stored names.
+func UpdateMemberReports(siteDir, dataDir string, opts members.Options, anon *redact.Redactor) error {
+	opts = opts.WithDefaults()
+	all, days, err := members.Scan(dataDir, anon)
+	if err != nil {
+		return err
+	}
+	months := members.Months(days)
+	funcMap := template.FuncMap{
+		"dayURL": func(day string) string { return "../" + archive.DayURL(day) },
+		"count":  func(m members.Member, month string) int { return m.Monthly[month] },
+	}
+	t, err := newTemplate("members.html").Funcs(funcMap).ParseFS(tplFS, "templates/members.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(siteDir, "members")
+	generated := time.Now().Format(time.RFC3339)
+	for i, month := range months {
+		rep := members.BuildMonth(all, month, members.AsOf(days, month), opts)
+		data := map[string]any{
+			"Report":      rep,
+			"Months":      months,
+			"Options":     opts,
+			"GeneratedAt": generated,
+		}
+		if err := writeTemplate(t, filepath.Join(dir, month+".html"), data); err != nil {
+			return err
+		}
+		if err := writeJSON(filepath.Join(dir, month+".json"), rep); err != nil {
+			return err
+		}
+		if i == len(months)-1 {
+			if err := writeTemplate(t, filepath.Join(dir, "index.html"), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeTemplate(t *template.Template, path string, data any) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if err := t.Execute(f, data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, b)
+}
@@ -0,0 +1,79 @@
+package render
+
+import (
+	"path/filepath"
+	"sort"
+
+	"wechat-view/internal/archive"
+)
+
+// MembershipDay is one entry of site/membership.json.
+type MembershipDay struct {
+	Date       string `json:"date"`
+	Joined     int    `json:"joined"`
+	Left       int    `json:"left"`
+	Cumulative int    `json:"cumulative"`
+	Total      int    `json:"total,omitempty"`
+}
+
+// MembershipNets reads the net membership change of every report day that
+// has a meta.json, keyed by day.
+func MembershipNets(siteDir, dataDir string) (map[string]int, error) {
+	days, err := archive.ReportDays(dataDir, siteDir)
+	if err != nil {
+		return nil, err
+	}
+	nets := make(map[string]int, len(days))
+	for _, day := range days {
+		if meta, err := archive.LoadMeta(siteDir, day); err == nil {
+			nets[day] = meta.Summary.Membership.Net()
+		}
+	}
+	return nets, nil
+}
+
+// RunningMembership sums nets over the days up to and including day, in
+// date order. total adds baseline, the group size on the first archived
+// day, and is 0 when no baseline is set.
+func RunningMembership(nets map[string]int, day string, baseline int) (cumulative, total int) {
+	days := make([]string, 0, len(nets))
+	for d := range nets {
+		if d <= day {
+			days = append(days, d)
+		}
+	}
+	sort.Strings(days)
+	for _, d := range days {
+		cumulative += nets[d]
+	}
+	if baseline > 0 {
+		total = baseline + cumulative
+	}
+	return cumulative, total
+}
+
+// UpdateMembershipSeries writes site/membership.json: per-day joins and
+// departures with the running net change, plus the member count when
+// baseline (the group size on the first archived day) is set.
+func UpdateMembershipSeries(siteDir, dataDir string, baseline int) error {
+	days, err := archive.ReportDays(dataDir, siteDir)
+	if err != nil {
+		return err
+	}
+	series := make([]MembershipDay, 0, len(days))
+	cumulative := 0
+	for _, day := range days {
+		meta, err := archive.LoadMeta(siteDir, day)
+		if err != nil {
+			continue
+		}
+		ms := meta.Summary.Membership
+		cumulative += ms.Net()
+		entry := MembershipDay{Date: day, Joined: ms.Joined, Left: ms.Left, Cumulative: cumulative}
+		if baseline > 0 {
+			entry.Total = baseline + cumulative
+		}
+		series = append(series, entry)
+	}
+	return writeJSON(filepath.Join(siteDir, "membership.json"), series)
+}
@@ -0,0 +1,191 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+// MessagePagesDir holds the full transcript pages next to a day page.
+const MessagePagesDir = "messages"
+
+// MessagePageLink is one transcript page with the time span it covers.
+type MessagePageLink struct {
+	Number   int
+	URL      string
+	From, To string
+	Count    int
+	Current  bool
+}
+
+// HourJump points an hour of the day at the page and anchor of its first
+// message.
+type HourJump struct {
+	Label string
+	Count int
+	URL   string
+}
+
+// messagePage is the data of templates/messages.html.
+type messagePage struct {
+	Date        string
+	Talker      string
+	TalkerLabel string
+	Number      int
+	Total       int
+	Pages       []MessagePageLink
+	HourJumps   []HourJump
+	Prev, Next  string
+	Messages    []chatlog.Message
+	// Anchors maps a message index to the hour anchor placed before it.
+	Anchors map[int]string
+}
+
+// transcript is the full message list of a day split into pages.
+type transcript struct {
+	pages [][]chatlog.Message
+	// links and jumps have URLs relative to the messages directory.
+	links []MessagePageLink
+	jumps []HourJump
+	// anchors maps, per page, a message index to the hour anchor placed
+	// before it.
+	anchors []map[int]string
+}
+
+// paginate splits msgs into pages of at most size messages and finds the
+// first message of every hour.
+func paginate(msgs []chatlog.Message, size int) *transcript {
+	t := &transcript{}
+	seen := map[int]int{}
+	for start := 0; start < len(msgs); start += size {
+		page := msgs[start:min(start+size, len(msgs))]
+		n := len(t.pages) + 1
+		link := MessagePageLink{Number: n, URL: strconv.Itoa(n) + ".html", Count: len(page)}
+		link.From, link.To = messageClock(page[0]), messageClock(page[len(page)-1])
+		anchors := map[int]string{}
+		for i, m := range page {
+			h := messageHour(m)
+			if h < 0 {
+				continue
+			}
+			if j, ok := seen[h]; ok {
+				t.jumps[j].Count++
+				continue
+			}
+			seen[h] = len(t.jumps)
+			anchors[i] = fmt.Sprintf("h%02d", h)
+			t.jumps = append(t.jumps, HourJump{Label: fmt.Sprintf("%02d", h), Count: 1, URL: link.URL + "#" + anchors[i]})
+		}
+		t.pages = append(t.pages, page)
+		t.links = append(t.links, link)
+		t.anchors = append(t.anchors, anchors)
+	}
+	return t
+}
+
+// linksFrom returns the page links and hour jumps with prefix added to
+// their URLs, for pages outside the messages directory.
+func (t *transcript) linksFrom(prefix string) ([]MessagePageLink, []HourJump) {
+	links := make([]MessagePageLink, len(t.links))
+	for i, l := range t.links {
+		l.URL = prefix + l.URL
+		links[i] = l
+	}
+	jumps := make([]HourJump, len(t.jumps))
+	for i, j := range t.jumps {
+		j.URL = prefix + j.URL
+		jumps[i] = j
+	}
+	return links, jumps
+}
+
+// writeMessagePages renders dayDir/messages/N.html for every page and
+// removes pages left over from a longer earlier run; without a transcript
+// the directory is removed. all are the day's messages, for linking quoted
+// replies to their originals.
+func writeMessagePages(dayDir string, ctx DayContext, hidden map[string]bool, tr *transcript, all []chatlog.Message) error {
+	dir := filepath.Join(dayDir, MessagePagesDir)
+	if tr == nil {
+		return os.RemoveAll(dir)
+	}
+	t, err := newTemplate("messages").Funcs(dayFuncs(&ctx, hidden, "../", newSourceIndex(ctx.Date, all, nil, tr, ""))).ParseFS(tplFS, "templates/messages.html", "templates/day-sections.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	for i, page := range tr.pages {
+		data := messagePage{
+			Date:        ctx.Date,
+			Talker:      ctx.Talker,
+			TalkerLabel: ctx.TalkerLabel,
+			Number:      i + 1,
+			Total:       len(tr.pages),
+			HourJumps:   tr.jumps,
+			Messages:    page,
+			Anchors:     tr.anchors[i],
+		}
+		data.Pages, _ = tr.linksFrom("")
+		data.Pages[i].Current = true
+		if i > 0 {
+			data.Prev = tr.links[i-1].URL
+		}
+		if i+1 < len(tr.links) {
+			data.Next = tr.links[i+1].URL
+		}
+		if err := writeTemplate(t, filepath.Join(dir, tr.links[i].URL), data); err != nil {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if n, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".html")); err == nil && n > len(tr.pages) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// messageTime returns when m was sent, or the zero time; unix stamps are
+// read in local time, like the hourly histogram.
+func messageTime(m chatlog.Message) time.Time {
+	if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
+		return t
+	}
+	ts := m.Timestamp
+	if ts <= 0 {
+		ts = m.CreateTime
+	}
+	if ts <= 0 {
+		return time.Time{}
+	}
+	if ts > 1_000_000_000_000 {
+		ts /= 1000
+	}
+	return time.Unix(ts, 0).Local()
+}
+
+// messageHour is the hour of day m was sent, or -1 when unknown.
+func messageHour(m chatlog.Message) int {
+	t := messageTime(m)
+	if t.IsZero() {
+		return -1
+	}
+	return t.Hour()
+}
+
+func messageClock(m chatlog.Message) string {
+	t := messageTime(m)
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("15:04")
+}
@@ -0,0 +1,362 @@
+package render
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/unfurl"
+)
+
+// msgsAt returns one message per clock time ("15:04") on 2025-10-16.
+func msgsAt(clocks ...string) []chatlog.Message {
+	out := make([]chatlog.Message, len(clocks))
+	for i, c := range clocks {
+		if c == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04", "2025-10-16 "+c, time.Local)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = chatlog.Message{Timestamp: t.Unix(), Content: c}
+	}
+	return out
+}
+
+func TestPaginateBoundaries(t *testing.T) {
+	cases := []struct {
+		name   string
+		n      int
+		size   int
+		counts []int
+	}{
+		{"empty", 0, 3, nil},
+		{"fewer than a page", 2, 3, []int{2}},
+		{"exactly a page", 3, 3, []int{3}},
+		{"one over", 4, 3, []int{3, 1}},
+		{"exact multiple", 6, 3, []int{3, 3}},
+		{"page size one", 3, 1, []int{1, 1, 1}},
+	}
+	for _, c := range cases {
+		clocks := make([]string, c.n)
+		for i := range clocks {
+			clocks[i] = time.Date(2025, 10, 16, 9, i, 0, 0, time.Local).Format("15:04")
+		}
+		tr := paginate(msgsAt(clocks...), c.size)
+		var counts []int
+		for i, l := range tr.links {
+			counts = append(counts, l.Count)
+			if l.Number != i+1 || l.URL != filepath.Base(l.URL) || len(tr.pages[i]) != l.Count {
+				t.Errorf("%s: 第 %d 页链接异常: %+v", c.name, i+1, l)
+			}
+		}
+		if !reflect.DeepEqual(counts, c.counts) || len(tr.pages) != len(c.counts) || len(tr.anchors) != len(c.counts) {
+			t.Errorf("%s: 每页条数 %v，期望 %v", c.name, counts, c.counts)
+		}
+	}
+}
+
+func TestPaginateHourJumps(t *testing.T) {
+	// 09 spans pages 1 and 2, 10 starts page 2, the untimed message has no hour
+	tr := paginate(msgsAt("09:00", "09:30", "09:59", "10:00", "", "23:59"), 3)
+	if len(tr.pages) != 2 {
+		t.Fatalf("页数异常: %d", len(tr.pages))
+	}
+	if l := tr.links[0]; l.URL != "1.html" || l.From != "09:00" || l.To != "09:59" {
+		t.Fatalf("第 1 页链接异常: %+v", l)
+	}
+	if l := tr.links[1]; l.URL != "2.html" || l.From != "10:00" || l.To != "23:59" {
+		t.Fatalf("第 2 页链接异常: %+v", l)
+	}
+	want := []HourJump{
+		{Label: "09", Count: 3, URL: "1.html#h09"},
+		{Label: "10", Count: 1, URL: "2.html#h10"},
+		{Label: "23", Count: 1, URL: "2.html#h23"},
+	}
+	if !reflect.DeepEqual(tr.jumps, want) {
+		t.Fatalf("按小时跳转异常: %+v", tr.jumps)
+	}
+	if !reflect.DeepEqual(tr.anchors, []map[int]string{{0: "h09"}, {0: "h10", 2: "h23"}}) {
+		t.Fatalf("锚点异常: %+v", tr.anchors)
+	}
+
+	links, jumps := tr.linksFrom("messages/")
+	if links[1].URL != "messages/2.html" || jumps[0].URL != "messages/1.html#h09" {
+		t.Fatalf("加前缀后的链接异常: %+v %+v", links, jumps)
+	}
+	if tr.links[1].URL != "2.html" || tr.jumps[0].URL != "1.html#h09" {
+		t.Fatalf("linksFrom 修改了原链接: %+v %+v", tr.links, tr.jumps)
+	}
+}
+
+func TestWriteMessagePagesRemovesStalePages(t *testing.T) {
+	dayDir := t.TempDir()
+	ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom"}
+	msgs := msgsAt("09:00", "09:10", "09:20", "09:30", "09:40")
+	if err := writeMessagePages(dayDir, ctx, nil, paginate(msgs, 2), msgs); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(dayDir, MessagePagesDir)
+	if names := dirNames(t, dir); !reflect.DeepEqual(names, []string{"1.html", "2.html", "3.html"}) {
+		t.Fatalf("生成的分页异常: %v", names)
+	}
+	// a note left by hand is not a page and survives
+	if err := os.WriteFile(filepath.Join(dir, "notes.html"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeMessagePages(dayDir, ctx, nil, paginate(msgs, 4), msgs); err != nil {
+		t.Fatal(err)
+	}
+	if names := dirNames(t, dir); !reflect.DeepEqual(names, []string{"1.html", "2.html", "notes.html"}) {
+		t.Fatalf("多余的分页未删除: %v", names)
+	}
+
+	if err := writeMessagePages(dayDir, ctx, nil, nil, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("没有分页时应删除目录: %v", err)
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// archiveDays stores each day's messages as a raw file in a temp data dir
+// and returns it. Messages are stamped 09:00, 09:01, … on their day, and
+// those without a type become text.
+func archiveDays(t *testing.T, days map[string][]chatlog.Message) string {
+	t.Helper()
+	dataDir := t.TempDir()
+	for day, msgs := range days {
+		at, err := time.ParseInLocation("2006-01-02 15:04", day+" 09:00", time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range msgs {
+			if msgs[i].MsgType == 0 {
+				msgs[i].MsgType = 1
+			}
+			msgs[i].Timestamp = at.Add(time.Duration(i) * time.Minute).Unix()
+		}
+		if _, err := archive.WriteRaw(dataDir, day, archive.Raw{Date: day, Messages: msgs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dataDir
+}
+
+func TestUpdateSearchIndex(t *testing.T) {
+	long := strings.Repeat("长", searchSnippetRunes+20)
+	dataDir := archiveDays(t, map[string][]chatlog.Message{
+		"2025-10-15": {
+			{SenderName: "阿强", Content: "回滚方案见 https://docs.example.com/rollback"},
+			{SenderName: "系统", Content: "阿强 撤回了一条消息", MsgType: 10000},
+		},
+		"2025-10-16": {
+			{SenderName: "小美", MsgType: chatlog.TypeApp, Share: &chatlog.Share{Title: "发布手册", Desc: "周五窗口", URL: "https://docs.example.com/release"}},
+			{SenderName: "小美", Content: "[图片]", MsgType: 3},
+			{SenderName: "老王", Content: long},
+		},
+	})
+	site := t.TempDir()
+	if err := UpdateSearchIndex(site, dataDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(site, "search-index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx SearchIndex
+	if err := json.Unmarshal(b, &idx); err != nil {
+		t.Fatal(err)
+	}
+	// 新的一天排在前面，消息与链接按下标引用所属日期
+	if len(idx.Days) != 2 || idx.Days[0].Date != "2025-10-16" || idx.Days[0].URL != archive.DayURL("2025-10-16") {
+		t.Fatalf("日期列表异常: %+v", idx.Days)
+	}
+	want := []SearchDoc{
+		{Day: 0, Time: "09:00", Sender: "小美", Text: "发布手册 周五窗口"},
+		{Day: 0, Time: "09:02", Sender: "老王", Text: string([]rune(long)[:searchSnippetRunes]) + "…"},
+		{Day: 1, Time: "09:00", Sender: "阿强", Text: "回滚方案见 https://docs.example.com/rollback"},
+	}
+	if !reflect.DeepEqual(idx.Docs, want) {
+		t.Fatalf("索引消息 = %+v", idx.Docs)
+	}
+	links := []SearchLink{{Day: 0, URL: "https://docs.example.com/release", Title: "发布手册"}, {Day: 1, URL: "https://docs.example.com/rollback"}}
+	if !reflect.DeepEqual(idx.Links, links) {
+		t.Fatalf("索引链接 = %+v", idx.Links)
+	}
+	if _, err := os.Stat(filepath.Join(site, "search.html")); err != nil {
+		t.Fatalf("未生成搜索页: %v", err)
+	}
+}
+
+func TestUpdateLinkLibrary(t *testing.T) {
+	dataDir := archiveDays(t, map[string][]chatlog.Message{
+		"2025-10-15": {{SenderName: "阿强", Content: "看 https://Docs.Example.com/guide/?utm_source=wx 和 https://t.cn/abc"}},
+		"2025-10-16": {
+			{SenderName: "小美", MsgType: chatlog.TypeApp, Share: &chatlog.Share{Title: "部署指南", URL: "https://docs.example.com/guide"}},
+			{SenderName: "老王", Content: "https://docs.example.com/guide#intro。"},
+		},
+	})
+	cachePath := filepath.Join(t.TempDir(), "unfurl.json")
+	cache := `{"https://t.cn/abc": {"final": "https://blog.example.com/post", "fetchedAt": "2025-10-16T10:00:00Z"},
+		"https://blog.example.com/post": {"title": "博客文章", "fetchedAt": "2025-10-16T10:00:00Z"}}`
+	if err := os.WriteFile(cachePath, []byte(cache), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previews, err := unfurl.Open(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := t.TempDir()
+	if err := UpdateLinkLibrary(site, dataDir, nil, previews); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(site, "links", "links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var links []LibraryLink
+	if err := json.Unmarshal(b, &links); err != nil {
+		t.Fatal(err)
+	}
+	// 跟踪参数、锚点、结尾斜杠与标点不同的同一链接合并；短链按展开后的地址计
+	want := []LibraryLink{
+		{URL: "https://docs.example.com/guide", Host: "docs.example.com", Title: "部署指南", FirstSeen: "2025-10-15", LastSeen: "2025-10-16",
+			Sharer: "阿强", Count: 3, Sharers: []string{"阿强", "小美", "老王"}, DayURL: "../" + archive.DayURL("2025-10-15")},
+		{URL: "https://blog.example.com/post", Host: "blog.example.com", Title: "博客文章", FirstSeen: "2025-10-15", LastSeen: "2025-10-15",
+			Sharer: "阿强", Count: 1, Sharers: []string{"阿强"}, DayURL: "../" + archive.DayURL("2025-10-15")},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Fatalf("链接库 = %+v", links)
+	}
+	page, err := os.ReadFile(filepath.Join(site, "links", "index.html"))
+	if err != nil || !strings.Contains(string(page), "部署指南") {
+		t.Fatalf("链接库页面缺少链接: %v", err)
+	}
+}
+
+func TestUpdatePeopleProfiles(t *testing.T) {
+	dataDir := archiveDays(t, map[string][]chatlog.Message{
+		"2025-10-15": {
+			{SenderName: "阿强", Content: "周五发布？"},
+			{SenderName: "阿强", Content: "回滚见 https://docs.example.com/rollback"},
+		},
+		"2025-10-16": {
+			{SenderName: "阿强", Content: "发布推迟了"},
+			{SenderName: "小美", Content: "好的，发布改到下周"},
+			{SenderName: "系统消息", Content: "小美 加入了群聊"},
+			{Content: "老王 撤回了一条消息", MsgType: 10000},
+		},
+	})
+	site := t.TempDir()
+	var meta archive.DayMeta
+	meta.Summary.Topics = []summarize.Topic{{Name: "发布"}, {Name: "回滚"}}
+	meta.Summary.ReplyDebt.Resolved = []summarize.ReplyItem{{Questioner: "阿强", AnsweredBy: "小美"}}
+	if err := writeJSON(filepath.Join(archive.DayDir(site, "2025-10-16"), "meta.json"), meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdatePeopleProfiles(site, dataDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(site, "people", "people.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var people []Profile
+	if err := json.Unmarshal(b, &people); err != nil {
+		t.Fatal(err)
+	}
+	// 系统消息不算参与者；按发言数排序
+	if len(people) != 2 || people[0].Name != "阿强" || people[1].Name != "小美" {
+		t.Fatalf("参与者 = %+v", people)
+	}
+	q, m := people[0], people[1]
+	if q.Messages != 3 || q.ActiveDays != 2 || q.FirstSeen != "2025-10-15" || q.LastSeen != "2025-10-16" {
+		t.Fatalf("阿强的统计异常: %+v", q)
+	}
+	daily := []TrendPoint{{Date: "2025-10-15", Count: 2, Percent: 100}, {Date: "2025-10-16", Count: 1, Percent: 50}}
+	if !reflect.DeepEqual(q.Daily, daily) || q.PeakHour != 9 || q.Hours[9] != 3 {
+		t.Fatalf("阿强的活跃分布异常: %+v %v", q.Daily, q.Hours)
+	}
+	if q.LinkCount != 1 || len(q.Links) != 1 || q.Links[0].DayURL != "../../"+archive.DayURL("2025-10-15") {
+		t.Fatalf("阿强分享的链接异常: %+v", q.Links)
+	}
+	// 话题与解答来自当天的 meta.json，2025-10-15 没有 meta 不计
+	if !reflect.DeepEqual(q.Topics, []summarize.KV{{Key: "发布", Count: 1}}) || q.Answered != 0 {
+		t.Fatalf("阿强的话题 = %+v，解答 %d", q.Topics, q.Answered)
+	}
+	if m.Answered != 1 || m.Messages != 1 || m.Slug != personSlug("小美") || m.Slug == q.Slug {
+		t.Fatalf("小美的统计异常: %+v", m)
+	}
+	for _, p := range people {
+		if _, err := os.Stat(filepath.Join(site, "people", p.Slug, "index.html")); err != nil {
+			t.Fatalf("未生成 %s 的主页: %v", p.Name, err)
+		}
+	}
+}
+
+func TestUpdateTagTrends(t *testing.T) {
+	site := t.TempDir()
+	metas := map[string][]summarize.TagStat{
+		"2025-10-01": {{Name: "故障", Count: 100}}, // 窗口之外
+		"2025-10-08": {{Name: "故障", Count: 4, Samples: []string{"数据库挂了"}}},
+		"2025-10-19": {{Name: "故障", Count: 2}, {Name: "发布", Count: 6, Samples: []string{"周五发布"}}},
+		"2025-10-20": {{Name: "故障", Count: 1, Samples: []string{"网关超时"}}},
+	}
+	for day, tags := range metas {
+		var meta archive.DayMeta
+		meta.Summary.Tags = tags
+		if err := writeJSON(filepath.Join(archive.DayDir(site, day), "meta.json"), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UpdateTagTrends(site, t.TempDir(), 14); err != nil {
+		t.Fatal(err)
+	}
+	span, _ := archive.Window("2025-10-20", 14)
+	trends := collectTagTrends(site, span)
+	if len(trends) != 2 || trends[0].Name != "故障" || trends[1].Name != "发布" {
+		t.Fatalf("标签排序异常: %+v", trends)
+	}
+	// 近 7 天与之前 7 天分开统计，窗口外的天不计入
+	f, p := trends[0], trends[1]
+	if f.Total != 7 || f.Recent != 3 || f.Prior != 4 || p.Total != 6 || p.Recent != 6 || p.Prior != 0 {
+		t.Fatalf("标签计数异常: 故障 %d/%d/%d，发布 %d/%d/%d", f.Total, f.Recent, f.Prior, p.Total, p.Recent, p.Prior)
+	}
+	if len(f.Series) != 14 || f.Series[1] != (TrendPoint{Date: "2025-10-08", Count: 4, Percent: 100}) || f.Series[12].Percent != 50 || f.Series[0].Count != 0 {
+		t.Fatalf("故障趋势异常: %+v", f.Series)
+	}
+	want := []TagSample{{Date: "2025-10-20", URL: "../" + archive.DayURL("2025-10-20"), Text: "网关超时"}, {Date: "2025-10-08", URL: "../" + archive.DayURL("2025-10-08"), Text: "数据库挂了"}}
+	if !reflect.DeepEqual(f.Samples, want) {
+		t.Fatalf("故障示例异常: %+v", f.Samples)
+	}
+	page, err := os.ReadFile(filepath.Join(site, "tags", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "故障") || !strings.Contains(string(page), "2025-10-07") || strings.Contains(string(page), "2025-10-01") {
+		t.Fatal("标签趋势页未按窗口渲染")
+	}
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// PDFRenderer converts a rendered HTML page into a PDF file.
+type PDFRenderer interface {
+	RenderPDF(ctx context.Context, htmlPath, pdfPath string) error
+}
+
+// ChromePDF prints pages with a headless Chromium/Chrome/Edge binary, which
+// handles CJK fonts and the page's CSS the same way a reader's browser does.
+type ChromePDF struct {
+	// Binary is the browser executable; empty searches common install paths.
+	Binary  string
+	Timeout time.Duration
+}
+
+// NewPDFRenderer resolves the renderer named in config.
+func NewPDFRenderer(kind, binary string, timeout time.Duration) (PDFRenderer, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "chrome", "chromium":
+		return ChromePDF{Binary: binary, Timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("unknown pdf renderer %q", kind)
+}
+
+// RenderPDF implements PDFRenderer.
+func (c ChromePDF) RenderPDF(ctx context.Context, htmlPath, pdfPath string) error {
+	bin := c.Binary
+	if bin == "" {
+		bin = findChrome()
+	}
+	if bin == "" {
+		return errors.New("no chrome/chromium binary found; set report.pdf.binary")
+	}
+	absHTML, err := filepath.Abs(htmlPath)
+	if err != nil {
+		return err
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	// print into a temp file next to the target so a crash never leaves a
+	// truncated report.pdf behind
+	tmp := filepath.Join(filepath.Dir(pdfPath), atomicfile.Prefix+"report.pdf")
+	defer os.Remove(tmp)
+	cmd := exec.CommandContext(ctx, bin,
+		"--headless",
+		"--disable-gpu",
+		"--no-sandbox",
+		"--no-pdf-header-footer",
+		"--virtual-time-budget=5000",
+		"--print-to-pdf="+tmp,
+		"file://"+filepath.ToSlash(absHTML),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(bin), err, strings.TrimSpace(string(out)))
+	}
+	if _, err := os.Stat(tmp); err != nil {
+		return fmt.Errorf("browser produced no pdf: %w", err)
+	}
+	return os.Rename(tmp, pdfPath)
+}
+
+func findChrome() string {
+	names := []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "msedge"}
+	for _, n := range names {
+		if p, err := exec.LookPath(n); err == nil {
+			return p
+		}
+	}
+	var paths []string
+	switch runtime.GOOS {
+	case "darwin":
+		paths = []string{
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+			"/Applications/Microsoft Edge.app/Contents/MacOS/Microsoft Edge",
+		}
+	case "windows":
+		for _, base := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"), os.Getenv("LocalAppData")} {
+			if base == "" {
+				continue
+			}
+			paths = append(paths,
+				filepath.Join(base, "Google", "Chrome", "Application", "chrome.exe"),
+				filepath.Join(base, "Microsoft", "Edge", "Application", "msedge.exe"),
+			)
+		}
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
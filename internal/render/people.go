@@ -0,0 +1,238 @@
+package render
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/redact"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/unfurl"
+)
+
+// profileLinkCap bounds the links listed on a profile page.
+const profileLinkCap = 50
+
+// Profile is one participant's activity over the whole archive.
+type Profile struct {
+	Slug       string         `json:"slug"`
+	Name       string         `json:"name"`
+	FirstSeen  string         `json:"firstSeen"`
+	LastSeen   string         `json:"lastSeen"`
+	Messages   int            `json:"messages"`
+	ActiveDays int            `json:"activeDays"`
+	Daily      []TrendPoint   `json:"daily"`
+	Hours      [24]int        `json:"hours"`
+	PeakHour   int            `json:"peakHour"`
+	Topics     []summarize.KV `json:"topics,omitempty"`
+	// Answered counts questions this person resolved, from the reply
+	// tracking of each day.
+	Answered  int           `json:"answered"`
+	LinkCount int           `json:"linkCount"`
+	Links     []ProfileLink `json:"links,omitempty"`
+	HourBars  []TrendPoint  `json:"-"`
+
+	topics map[string]int
+}
+
+// ProfileLink is a link the person shared.
+type ProfileLink struct {
+	URL    string `json:"url"`
+	Title  string `json:"title,omitempty"`
+	Date   string `json:"date"`
+	DayURL string `json:"dayURL"`
+}
+
+// personSlug names a participant's profile directory. Names are hashed so
+// the URL is stable and safe whatever characters they contain.
+func personSlug(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("p%08x", h.Sum32())
+}
+
+// personName is how day pages and summaries name a message's sender.
+func personName(m chatlog.Message) string {
+	if m.MsgType == 10000 {
+		return ""
+	}
+	name := strings.TrimSpace(firstNonEmptyStr(m.SenderName, m.Nickname, m.Sender, m.From))
+	if name == "系统消息" {
+		return ""
+	}
+	return name
+}
+
+// UpdatePeopleProfiles writes site/people/<slug>/index.html for everyone who
+// spoke in the days in dataDir, plus site/people/index.html and people.json
+// listing them. Messages per day, active hours and shared links come from
+// the raw days, or their archive.History once retention removed them; favorite topics and answered questions from each
+// day's meta.json. People are named as anon returns them; nil keeps the
+// stored names. Links without a preview card take their title from
+// previews.
+func UpdatePeopleProfiles(siteDir, dataDir string, anon *redact.Redactor, previews *unfurl.Cache) error {
+	days, err := archive.HistoryDays(dataDir)
+	if err != nil {
+		return err
+	}
+	byName := map[string]*Profile{}
+	for _, day := range days {
+		msgs, err := archive.LoadDayMessages(dataDir, day)
+		if err != nil {
+			return err
+		}
+		var meta *archive.DayMeta
+		if m, err := archive.LoadMeta(siteDir, day); err == nil {
+			meta = &m
+		}
+		addProfileDay(byName, day, anon.Messages(msgs), meta, previews)
+	}
+
+	people := make([]*Profile, 0, len(byName))
+	for _, p := range byName {
+		p.finish()
+		people = append(people, p)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].Messages != people[j].Messages {
+			return people[i].Messages > people[j].Messages
+		}
+		return people[i].Name < people[j].Name
+	})
+
+	funcs := template.FuncMap{"hourLabel": func(h int) string { return fmt.Sprintf("%02d:00", h) }}
+	listT, err := newTemplate("people.html").Funcs(funcs).ParseFS(tplFS, "templates/people.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	pageT, err := newTemplate("person.html").Funcs(funcs).ParseFS(tplFS, "templates/person.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(siteDir, "people")
+	generated := time.Now().Format(time.RFC3339)
+	for _, p := range people {
+		data := map[string]any{"Person": p, "GeneratedAt": generated}
+		if err := writeTemplate(pageT, filepath.Join(dir, p.Slug, "index.html"), data); err != nil {
+			return err
+		}
+	}
+	data := map[string]any{"People": people, "GeneratedAt": generated}
+	if err := writeTemplate(listT, filepath.Join(dir, "index.html"), data); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "people.json"), people)
+}
+
+// addProfileDay folds one day's messages, and its summary when rendered,
+// into the profiles.
+func addProfileDay(byName map[string]*Profile, day string, msgs []chatlog.Message, meta *archive.DayMeta, previews *unfurl.Cache) {
+	said := map[string][]string{}
+	for _, m := range msgs {
+		name := personName(m)
+		if name == "" {
+			continue
+		}
+		p := byName[name]
+		if p == nil {
+			p = &Profile{Slug: personSlug(name), Name: name, FirstSeen: day, topics: map[string]int{}}
+			byName[name] = p
+		}
+		if p.LastSeen != day {
+			p.ActiveDays++
+			p.Daily = append(p.Daily, TrendPoint{Date: day})
+		}
+		p.LastSeen = day
+		p.Messages++
+		p.Daily[len(p.Daily)-1].Count++
+		if ts := messageUnix(m); ts > 0 {
+			p.Hours[time.Unix(ts, 0).Local().Hour()]++
+		}
+		for _, l := range messageLinks(m) {
+			p.LinkCount++
+			title := l.Title
+			if pv, ok := previews.Get(summarize.NormalizeURL(previews.Resolve(l.URL))); ok && title == "" {
+				title = pv.Title
+			}
+			p.Links = append(p.Links, ProfileLink{URL: l.URL, Title: title, Date: day, DayURL: "../../" + archive.DayURL(day)})
+		}
+		if text := firstNonEmptyStr(m.Content, m.Text); text != "" {
+			said[name] = append(said[name], text)
+		}
+	}
+	if meta == nil {
+		return
+	}
+	for _, item := range meta.Summary.ReplyDebt.Resolved {
+		if p := byName[strings.TrimSpace(item.AnsweredBy)]; p != nil {
+			p.Answered++
+		}
+	}
+	// A topic counts once per day for everyone who mentioned it.
+	for name, texts := range said {
+		p := byName[name]
+		for _, tp := range meta.Summary.Topics {
+			for _, text := range texts {
+				if strings.Contains(strings.ToLower(text), tp.Name) {
+					p.topics[tp.Name]++
+					break
+				}
+			}
+		}
+	}
+}
+
+// finish derives the ranked and display-only fields once every day is in.
+func (p *Profile) finish() {
+	max := 0
+	for _, d := range p.Daily {
+		if d.Count > max {
+			max = d.Count
+		}
+	}
+	for i := range p.Daily {
+		p.Daily[i].Percent = float64(p.Daily[i].Count) / float64(max) * 100
+	}
+	hourMax := 0
+	for h, c := range p.Hours {
+		if c > p.Hours[p.PeakHour] {
+			p.PeakHour = h
+		}
+		if c > hourMax {
+			hourMax = c
+		}
+	}
+	p.HourBars = make([]TrendPoint, 24)
+	for h, c := range p.Hours {
+		p.HourBars[h] = TrendPoint{Date: fmt.Sprintf("%02d:00", h), Count: c}
+		if hourMax > 0 {
+			p.HourBars[h].Percent = float64(c) / float64(hourMax) * 100
+		}
+	}
+	p.Topics = sortedCounts(p.topics)
+	if len(p.Topics) > 10 {
+		p.Topics = p.Topics[:10]
+	}
+	// newest links first
+	sort.SliceStable(p.Links, func(i, j int) bool { return p.Links[i].Date > p.Links[j].Date })
+	if len(p.Links) > profileLinkCap {
+		p.Links = p.Links[:profileLinkCap]
+	}
+}
+
+func messageUnix(m chatlog.Message) int64 {
+	ts := m.Timestamp
+	if ts == 0 {
+		ts = m.CreateTime
+	}
+	if ts > 1_000_000_000_000 {
+		ts /= 1000
+	}
+	return ts
+}
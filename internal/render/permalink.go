@@ -0,0 +1,189 @@
+package render
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/i18n"
+	"wechat-view/internal/summarize"
+)
+
+// messageAnchor is the id of m's card: a hash of the chatlog message id,
+// or of time, sender and text for messages without one, so links to it
+// survive regenerations and repagination. Identical messages without ids
+// share an anchor; links then land on the first.
+func messageAnchor(m chatlog.Message) string {
+	key := m.MsgID
+	if key == "" {
+		key = m.ID
+	}
+	if key == "" {
+		key = strings.Join([]string{m.Time, strconv.FormatInt(m.Timestamp, 10), strconv.FormatInt(m.CreateTime, 10), m.Sender, m.From, m.Content, m.Text}, "\x00")
+	}
+	sum := sha1.Sum([]byte(key))
+	return "m-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// minQuoteRunes keeps short quotes like "好的" from linking to whichever
+// message happens to contain them first.
+const minQuoteRunes = 4
+
+// quoteRegexp finds text the LLM quoted in its spotlight.
+var quoteRegexp = regexp.MustCompile(`[「『“"]([^」』”"]+)[」』”"]`)
+
+// sourceIndex finds the message a question, quote or quoted reply came
+// from and the URL of its card: an anchor on the same page, or on the
+// transcript page holding it. Messages shown on neither have no URL, so
+// nothing links to them.
+type sourceIndex struct {
+	date string
+	msgs []chatlog.Message
+	urls map[string]string
+	// bySent and bySeq find quoted originals, see reference.
+	bySent map[string]string
+	bySeq  map[int64]string
+}
+
+// newSourceIndex indexes all, the day's messages, for a page showing
+// preview; prefix leads from that page to the transcript pages of tr.
+func newSourceIndex(date string, all, preview []chatlog.Message, tr *transcript, prefix string) *sourceIndex {
+	s := &sourceIndex{date: date, msgs: all, urls: map[string]string{}, bySent: map[string]string{}, bySeq: map[int64]string{}}
+	if tr != nil {
+		for i, page := range tr.pages {
+			for _, m := range page {
+				a := messageAnchor(m)
+				if _, ok := s.urls[a]; !ok {
+					s.urls[a] = prefix + tr.links[i].URL + "#" + a
+				}
+			}
+		}
+	}
+	for _, m := range preview {
+		s.urls[messageAnchor(m)] = "#" + messageAnchor(m)
+	}
+	for _, m := range all {
+		a := messageAnchor(m)
+		if at := messageTime(m); !at.IsZero() {
+			for _, sender := range []string{m.Sender, m.SenderName} {
+				if sender != "" {
+					s.bySent[sentKey(sender, at)] = a
+				}
+			}
+		}
+		if m.Timestamp > 0 {
+			s.bySeq[m.Timestamp] = a
+		}
+	}
+	return s
+}
+
+func sentKey(sender string, at time.Time) string {
+	return sender + "\x00" + at.UTC().Format(time.RFC3339)
+}
+
+// reference links a quoted reply to the original, matched by sender and
+// send time like the archive exports, or by chatlog seq, which the client
+// reads into Timestamp.
+func (s *sourceIndex) reference(ref *chatlog.Reference) string {
+	if s == nil || ref == nil {
+		return ""
+	}
+	a := ""
+	if at, err := time.Parse(time.RFC3339, ref.Time); err == nil {
+		for _, sender := range []string{ref.Sender, ref.SenderName} {
+			if a == "" && sender != "" {
+				a = s.bySent[sentKey(sender, at)]
+			}
+		}
+	}
+	if a == "" && ref.Seq > 0 {
+		a = s.bySeq[ref.Seq]
+	}
+	return s.urls[a]
+}
+
+// reply links a reply-debt question to the message asking it. Questions
+// carried over from earlier days are not in this day's messages.
+func (s *sourceIndex) reply(item summarize.ReplyItem) string {
+	if s == nil || (item.Date != "" && item.Date != s.date) {
+		return ""
+	}
+	at, _ := time.Parse(time.RFC3339, item.AskedAt)
+	if u := s.find(item.Question, at); u != "" || at.IsZero() {
+		return u
+	}
+	return s.find(item.Question, time.Time{})
+}
+
+// quote links text, or the first of its quoted fragments found, to the
+// message containing it.
+func (s *sourceIndex) quote(text string) string {
+	if s == nil {
+		return ""
+	}
+	for _, q := range quoteRegexp.FindAllStringSubmatch(text, -1) {
+		if u := s.find(q[1], time.Time{}); u != "" {
+			return u
+		}
+	}
+	return s.find(text, time.Time{})
+}
+
+// find returns the URL of the first shown message whose text contains
+// text, sent at at unless at is zero. Summaries cut long texts with "…",
+// which is dropped before matching.
+func (s *sourceIndex) find(text string, at time.Time) string {
+	needle := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "…"))
+	if utf8.RuneCountInString(needle) < minQuoteRunes {
+		return ""
+	}
+	for _, m := range s.msgs {
+		if !at.IsZero() && !messageTime(m).Equal(at) {
+			continue
+		}
+		body := m.Content
+		if body == "" {
+			body = m.Text
+		}
+		if !strings.Contains(body, needle) {
+			continue
+		}
+		if u, ok := s.urls[messageAnchor(m)]; ok {
+			return u
+		}
+	}
+	return ""
+}
+
+// maxQuotedRunes trims the quoted original shown above a reply.
+const maxQuotedRunes = 80
+
+// quotedText is the trimmed text of a quoted original, or a placeholder
+// for media that has none.
+func quotedText(ref *chatlog.Reference) string {
+	text := strings.Join(strings.Fields(ref.Content), " ")
+	if text == "" {
+		switch ref.Type {
+		case 3:
+			return i18n.T("[图片]")
+		case 34:
+			return i18n.T("[语音]")
+		case 43:
+			return i18n.T("[视频]")
+		case 47:
+			return i18n.T("[表情]")
+		default:
+			return i18n.T("[消息]")
+		}
+	}
+	if r := []rune(text); len(r) > maxQuotedRunes {
+		return string(r[:maxQuotedRunes]) + "…"
+	}
+	return text
+}
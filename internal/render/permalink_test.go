@@ -0,0 +1,118 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestMessageAnchorStableAndDistinct(t *testing.T) {
+	base := chatlog.Message{Time: "2025-10-16T09:00:00+08:00", Sender: "wxid_a", Content: "发布窗口定在周五"}
+	a := messageAnchor(base)
+	if !regexp.MustCompile(`^m-[0-9a-f]{10}$`).MatchString(a) {
+		t.Fatalf("锚点格式异常: %q", a)
+	}
+	// 标签、回复数等渲染时补充的字段不影响锚点
+	same := base
+	same.Tags = []string{"发布"}
+	same.IsQuestion = true
+	if messageAnchor(same) != a {
+		t.Fatal("同一条消息的锚点随附加字段变化")
+	}
+
+	// 同一秒、同一发送者的不同消息不能撞锚点
+	variants := map[string]chatlog.Message{"base": base}
+	other := base
+	other.Content = "发布窗口定在周六"
+	variants["content"] = other
+	other = base
+	other.Sender = "wxid_b"
+	variants["sender"] = other
+	other = base
+	other.Time = "2025-10-16T09:00:01+08:00"
+	variants["time"] = other
+	other = base
+	other.Content, other.Text = "", base.Content
+	variants["text field"] = other
+	seen := map[string]string{}
+	for name, m := range variants {
+		anchor := messageAnchor(m)
+		if prev, ok := seen[anchor]; ok {
+			t.Fatalf("%s 与 %s 锚点冲突: %s", name, prev, anchor)
+		}
+		seen[anchor] = name
+	}
+
+	// 有消息 id 时以 id 为准：撤回重发、编辑后链接仍然有效
+	withID := base
+	withID.MsgID = "8734"
+	edited := withID
+	edited.Content = "发布窗口改到下周一"
+	if messageAnchor(withID) != messageAnchor(edited) || messageAnchor(withID) == a {
+		t.Fatal("带 id 的消息锚点未按 id 生成")
+	}
+	if byID := (chatlog.Message{ID: "8734"}); messageAnchor(byID) != messageAnchor(withID) {
+		t.Fatal("MsgID 与 ID 字段应生成相同锚点")
+	}
+}
+
+func TestMessageAnchorsSurviveRerenderAndRepagination(t *testing.T) {
+	dayDir := t.TempDir()
+	ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom"}
+	msgs := msgsAt("09:00", "09:10", "09:20", "09:30", "09:40")
+	idRegexp := regexp.MustCompile(`<article class="msg-card" id="(m-[0-9a-f]+)"`)
+	anchors := func() []string {
+		t.Helper()
+		var out []string
+		for _, name := range dirNames(t, filepath.Join(dayDir, MessagePagesDir)) {
+			b, err := os.ReadFile(filepath.Join(dayDir, MessagePagesDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range idRegexp.FindAllStringSubmatch(string(b), -1) {
+				out = append(out, m[1])
+			}
+		}
+		return out
+	}
+	var want []string
+	for _, m := range msgs {
+		want = append(want, messageAnchor(m))
+	}
+
+	for _, size := range []int{2, 2, 4} {
+		if err := writeMessagePages(dayDir, ctx, nil, paginate(msgs, size), msgs); err != nil {
+			t.Fatal(err)
+		}
+		if got := anchors(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("每页 %d 条时锚点 %v，期望 %v", size, got, want)
+		}
+	}
+
+	// 换页后，来源链接跟着消息所在的页走，锚点本身不变
+	last := want[4]
+	if u := newSourceIndex(ctx.Date, msgs, nil, paginate(msgs, 2), "messages/").urls[last]; u != "messages/3.html#"+last {
+		t.Fatalf("每页 2 条时链接 %q", u)
+	}
+	if u := newSourceIndex(ctx.Date, msgs, nil, paginate(msgs, 4), "messages/").urls[last]; u != "messages/2.html#"+last {
+		t.Fatalf("每页 4 条时链接 %q", u)
+	}
+}
+
+func TestIdenticalMessagesLinkToFirst(t *testing.T) {
+	msgs := msgsAt("09:00", "09:10", "09:20")
+	msgs[2] = msgs[0] // 同一时刻完全相同的重复消息，没有 id 可区分
+	tr := paginate(msgs, 2)
+	s := newSourceIndex("2025-10-16", msgs, nil, tr, "")
+	a := messageAnchor(msgs[0])
+	if messageAnchor(msgs[2]) != a {
+		t.Fatal("完全相同的消息应共用锚点")
+	}
+	if u := s.urls[a]; u != "1.html#"+a {
+		t.Fatalf("重复消息的链接应指向第一条: %q", u)
+	}
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"html/template"
+	"path/filepath"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/qa"
+)
+
+// UpdateQAPage writes site/qa/index.html and the qa.json export from base.
+func UpdateQAPage(siteDir string, base *qa.Base) error {
+	entries := base.Sorted()
+	dir := filepath.Join(siteDir, "qa")
+	if err := writeJSON(filepath.Join(dir, "qa.json"), entries); err != nil {
+		return err
+	}
+	funcMap := template.FuncMap{
+		"dayURL": func(day string) string { return "../" + archive.DayURL(day) },
+	}
+	t, err := newTemplate("qa.html").Funcs(funcMap).ParseFS(tplFS, "templates/qa.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	return writeTemplate(t, filepath.Join(dir, "index.html"), map[string]any{
+		"Entries":     entries,
+		"GeneratedAt": time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,143 @@
+package render
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/redact"
+)
+
+// searchSnippetRunes caps the text kept per message in the search index.
+const searchSnippetRunes = 300
+
+// SearchIndex is written to site/search-index.json and loaded by search.html.
+// Docs and links refer to days by their index in Days to keep the file small.
+type SearchIndex struct {
+	GeneratedAt string       `json:"generatedAt"`
+	Days        []SearchDay  `json:"days"`
+	Docs        []SearchDoc  `json:"docs"`
+	Links       []SearchLink `json:"links"`
+}
+
+// SearchDay is one archived day.
+type SearchDay struct {
+	Date     string   `json:"date"`
+	URL      string   `json:"url"`
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// SearchDoc is one searchable message.
+type SearchDoc struct {
+	Day    int    `json:"d"`
+	Time   string `json:"t,omitempty"`
+	Sender string `json:"s,omitempty"`
+	Text   string `json:"x"`
+}
+
+// SearchLink is one URL shared on a day.
+type SearchLink struct {
+	Day   int    `json:"d"`
+	URL   string `json:"u"`
+	Title string `json:"t,omitempty"`
+}
+
+// UpdateSearchIndex rebuilds site/search-index.json from every raw day in
+// dataDir and writes the client-side search page to site/search.html.
+// Messages are indexed as anon returns them; nil indexes them as stored.
+func UpdateSearchIndex(siteDir, dataDir string, anon *redact.Redactor) error {
+	days, err := archive.ListDays(dataDir)
+	if err != nil {
+		return err
+	}
+	idx := SearchIndex{GeneratedAt: time.Now().Format(time.RFC3339)}
+	// newest first so the page lists recent discussions before old ones
+	for i := len(days) - 1; i >= 0; i-- {
+		day := days[i]
+		raw, err := archive.LoadRaw(dataDir, day)
+		if err != nil {
+			return err
+		}
+		entry := SearchDay{Date: day, URL: archive.DayURL(day)}
+		if meta, err := archive.LoadMeta(siteDir, day); err == nil {
+			for j, kw := range meta.Summary.Keywords {
+				if j == 8 {
+					break
+				}
+				entry.Keywords = append(entry.Keywords, kw.Key)
+			}
+		}
+		idx.Days = append(idx.Days, entry)
+		addSearchDocs(&idx, len(idx.Days)-1, anon.Messages(raw.Messages))
+	}
+	if err := writeCompactJSON(filepath.Join(siteDir, "search-index.json"), idx); err != nil {
+		return err
+	}
+	t, err := newTemplate("search.html").ParseFS(tplFS, "templates/search.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	return writeTemplate(t, filepath.Join(siteDir, "search.html"), map[string]any{
+		"GeneratedAt": idx.GeneratedAt,
+		"DayCount":    len(idx.Days),
+	})
+}
+
+func addSearchDocs(idx *SearchIndex, day int, msgs []chatlog.Message) {
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		for _, l := range messageLinks(m) {
+			if !seen[l.URL] {
+				seen[l.URL] = true
+				idx.Links = append(idx.Links, SearchLink{Day: day, URL: l.URL, Title: l.Title})
+			}
+		}
+		text := strings.TrimSpace(firstNonEmptyStr(m.Content, m.Text))
+		if m.Share != nil {
+			text = strings.TrimSpace(strings.Join([]string{m.Share.Title, m.Share.Desc, text}, " "))
+		}
+		if text == "" || (m.MsgType != 1 && m.Share == nil) {
+			continue
+		}
+		if r := []rune(text); len(r) > searchSnippetRunes {
+			text = string(r[:searchSnippetRunes]) + "…"
+		}
+		idx.Docs = append(idx.Docs, SearchDoc{
+			Day:    day,
+			Time:   searchTime(m),
+			Sender: firstNonEmptyStr(m.SenderName, m.Nickname, m.Sender, m.From),
+			Text:   text,
+		})
+	}
+}
+
+func searchTime(m chatlog.Message) string {
+	if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
+		return t.Format("15:04")
+	}
+	if s := formatTimestamp(m.Timestamp); s != "" {
+		return s[:5]
+	}
+	return ""
+}
+
+func writeCompactJSON(path string, v any) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"html/template"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/atomicfile"
+)
+
+// TagTrend is one tag's row on the tag trend page.
+type TagTrend struct {
+	Name    string
+	Total   int
+	Recent  int // last 7 days
+	Prior   int // the 7 days before that
+	Series  []TrendPoint
+	Samples []TagSample
+}
+
+// TrendPoint is a single day in a trend series.
+type TrendPoint struct {
+	Date    string
+	Count   int
+	Percent float64
+}
+
+// TagSample links a representative message back to its day page.
+type TagSample struct {
+	Date string
+	URL  string
+	Text string
+}
+
+// UpdateTagTrends writes site/tags/index.html from the tag statistics stored
+// in each day's meta.json over the trailing window of calendar days.
+func UpdateTagTrends(siteDir, dataDir string, window int) error {
+	if window <= 0 {
+		window = 30
+	}
+	days, err := archive.ReportDays(dataDir, siteDir)
+	if err != nil {
+		return err
+	}
+	var trends []*TagTrend
+	var span []string
+	if len(days) > 0 {
+		span, err = archive.Window(days[len(days)-1], window)
+		if err != nil {
+			return err
+		}
+		trends = collectTagTrends(siteDir, span)
+	}
+
+	funcMap := template.FuncMap{
+		"sub":  func(a, b int) int { return a - b },
+		"last": func(s []TrendPoint) int { return len(s) - 1 },
+	}
+	t, err := newTemplate("tags.html").Funcs(funcMap).ParseFS(tplFS, "templates/tags.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	f, err := atomicfile.Create(filepath.Join(siteDir, "tags", "index.html"))
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	data := map[string]any{
+		"Trends":      trends,
+		"Window":      window,
+		"GeneratedAt": time.Now().Format(time.RFC3339),
+	}
+	if len(span) > 0 {
+		data["From"], data["To"] = span[0], span[len(span)-1]
+	}
+	if err := t.Execute(f, data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+func collectTagTrends(siteDir string, span []string) []*TagTrend {
+	byName := map[string]*TagTrend{}
+	for i, day := range span {
+		meta, err := archive.LoadMeta(siteDir, day)
+		if err != nil {
+			// missing or unreadable days simply count as zero
+			continue
+		}
+		for _, st := range meta.Summary.Tags {
+			tr := byName[st.Name]
+			if tr == nil {
+				tr = &TagTrend{Name: st.Name, Series: make([]TrendPoint, len(span))}
+				for j, d := range span {
+					tr.Series[j].Date = d
+				}
+				byName[st.Name] = tr
+			}
+			tr.Series[i].Count = st.Count
+			tr.Total += st.Count
+			switch age := len(span) - 1 - i; {
+			case age < 7:
+				tr.Recent += st.Count
+			case age < 14:
+				tr.Prior += st.Count
+			}
+			for _, s := range st.Samples {
+				tr.Samples = append(tr.Samples, TagSample{Date: day, URL: "../" + archive.DayURL(day), Text: s})
+			}
+		}
+	}
+	out := make([]*TagTrend, 0, len(byName))
+	for _, tr := range byName {
+		max := 0
+		for _, p := range tr.Series {
+			if p.Count > max {
+				max = p.Count
+			}
+		}
+		for j := range tr.Series {
+			if max > 0 {
+				tr.Series[j].Percent = float64(tr.Series[j].Count) / float64(max) * 100
+			}
+		}
+		// newest samples first, a handful is enough
+		sort.SliceStable(tr.Samples, func(a, b int) bool { return tr.Samples[a].Date > tr.Samples[b].Date })
+		if len(tr.Samples) > 5 {
+			tr.Samples = tr.Samples[:5]
+		}
+		out = append(out, tr)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total == out[j].Total {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Total > out[j].Total
+	})
+	return out
+}
@@ -0,0 +1,27 @@
+package render
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// TalkerLink is one chat room on the index of a multi-room site.
+type TalkerLink struct {
+	Label string
+	// URL is the room's own index page, relative to the site root.
+	URL string
+	// Latest is the newest day with a report; empty before the first.
+	Latest string
+}
+
+// WriteTalkerIndex writes siteDir/index.html for a site whose chat rooms
+// each live in a subdirectory (the talkers config), linking to the index
+// of each room in the given order.
+func WriteTalkerIndex(siteDir string, talkers []TalkerLink) error {
+	t, err := newTemplate("talkers.html").ParseFS(tplFS, "templates/talkers.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	data := map[string]any{"Talkers": talkers, "GeneratedAt": time.Now().Format(time.RFC3339)}
+	return writeTemplate(t, filepath.Join(siteDir, "index.html"), data)
+}
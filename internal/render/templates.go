@@ -0,0 +1,171 @@
+package render
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+
+	"wechat-view/internal/i18n"
+)
+
+//go:embed templates/*
+var embeddedFS embed.FS
+
+// tplFS is where every page template is parsed from: the embedded
+// templates, or an overlay of report.templatesDir set by UseTemplatesDir.
+var tplFS fs.FS = embeddedFS
+
+// requiredBlocks lists the templates the render code executes or other
+// pages call, per file. Files not listed only need a non-empty body, which
+// is executed under the file's own name.
+var requiredBlocks = map[string][]string{
+	"day.html":   {"day"},
+	"theme.html": {"theme-head", "page-base", "tr-script"},
+	"day-sections.html": {
+		"section-highlights", "section-vibes", "section-ai-insights", "section-activity",
+		"section-reply-debt", "section-topics", "section-links", "section-messages", "ai-insights",
+		"message-card", "share-card", "hour-jump", "message-styles",
+	},
+	"messages.html": {"messages"},
+}
+
+// newTemplate starts a page template with the functions every page has:
+// t translates its text (formatting the arguments, if any, like Sprintf)
+// and lang is the language of the catalog in use.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(template.FuncMap{
+		"t": func(s string, args ...any) string {
+			if len(args) == 0 {
+				return i18n.T(s)
+			}
+			return i18n.Tf(s, args...)
+		},
+		"lang": i18n.Lang,
+	})
+}
+
+// UseTemplatesDir makes later renders prefer the templates in dir over the
+// embedded ones, file by file; templates missing from dir keep the built-in
+// version. An empty dir restores the embedded templates. It checks the
+// directory first (see CheckTemplatesDir) and is meant to be called once at
+// startup, before anything renders.
+func UseTemplatesDir(dir string) error {
+	if dir == "" {
+		tplFS = embeddedFS
+		return nil
+	}
+	names, err := CheckTemplatesDir(dir)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[string]bool, len(names))
+	for _, name := range names {
+		overrides[name] = true
+	}
+	tplFS = overlayFS{dir: os.DirFS(dir), overrides: overrides}
+	return nil
+}
+
+// CheckTemplatesDir reports the templates in dir that override embedded
+// ones. Every .html file must share its name with an embedded template,
+// parse, and define the blocks the rest of the site relies on, so a typo
+// fails at startup instead of half-way through a run.
+func CheckTemplatesDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	known, err := fs.Glob(embeddedFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	isKnown := make(map[string]bool, len(known))
+	for i, k := range known {
+		known[i] = path.Base(k)
+		isKnown[known[i]] = true
+	}
+	var names []string
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".html" {
+			continue
+		}
+		if !isKnown[name] {
+			errs = append(errs, fmt.Errorf("%s: no built-in template of that name (known: %s)", name, strings.Join(known, ", ")))
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := checkTemplate(name, string(b)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		names = append(names, name)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// checkTemplate parses text without the render functions, which differ per
+// page, and checks the required blocks are defined and not empty.
+func checkTemplate(name, text string) error {
+	trees := map[string]*parse.Tree{}
+	t := parse.New(name)
+	t.Mode = parse.SkipFuncCheck
+	if _, err := t.Parse(text, "", "", trees); err != nil {
+		return err
+	}
+	required := requiredBlocks[name]
+	if required == nil {
+		// the parser records the file body even when it is only whitespace
+		// or comments, so check the content rather than the name
+		if tree := trees[name]; tree == nil || parse.IsEmptyTree(tree.Root) {
+			return errors.New("template body is empty")
+		}
+		return nil
+	}
+	var missing, empty []string
+	for _, block := range required {
+		switch tree := trees[block]; {
+		case tree == nil:
+			missing = append(missing, block)
+		case parse.IsEmptyTree(tree.Root):
+			empty = append(empty, block)
+		}
+	}
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing {{define}} for %s", strings.Join(missing, ", ")))
+	}
+	if len(empty) > 0 {
+		errs = append(errs, fmt.Errorf("empty {{define}} for %s", strings.Join(empty, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// overlayFS serves templates/<name> from dir for the overridden names and
+// from the embedded templates otherwise.
+type overlayFS struct {
+	dir       fs.FS
+	overrides map[string]bool
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if rel, ok := strings.CutPrefix(name, "templates/"); ok && o.overrides[rel] {
+		return o.dir.Open(rel)
+	}
+	return embeddedFS.Open(name)
+}
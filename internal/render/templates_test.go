@@ -0,0 +1,121 @@
+package render
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCheckTemplatesDirAcceptsOverrides(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"widget.html":   `<p>{{t "消息"}} {{.Messages}}</p>`,
+		"messages.html": `{{define "messages"}}{{.Date}}{{end}}`,
+		"README.txt":    "not a template",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "assets.html"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names, err := CheckTemplatesDir(dir)
+	if err != nil {
+		t.Fatalf("合法的覆盖模板被拒绝: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"messages.html", "widget.html"}) {
+		t.Fatalf("覆盖列表异常: %v", names)
+	}
+	// 内置模板原样复制出来必须能通过检查
+	builtin := map[string]string{}
+	known, _ := fs.Glob(embeddedFS, "templates/*.html")
+	for _, k := range known {
+		b, err := fs.ReadFile(embeddedFS, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builtin[path.Base(k)] = string(b)
+	}
+	if names, err := CheckTemplatesDir(writeTemplates(t, builtin)); err != nil || len(names) != len(builtin) {
+		t.Fatalf("内置模板未通过检查: %d/%d %v", len(names), len(builtin), err)
+	}
+	if names, err := CheckTemplatesDir(t.TempDir()); err != nil || len(names) != 0 {
+		t.Fatalf("空目录应无覆盖: %v %v", names, err)
+	}
+	if _, err := CheckTemplatesDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("目录不存在应报错")
+	}
+}
+
+func TestCheckTemplatesDirRejectsBadTemplates(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{"dya.html", `{{define "day"}}x{{end}}`, "no built-in template"},
+		{"widget.html", `{{if .Messages}}`, "widget.html:"},
+		{"widget.html", `{{/* 只有注释 */}}`, "template body is empty"},
+		{"messages.html", `<p>{{.Date}}</p>`, "missing {{define}} for messages"},
+		{"theme.html", `{{define "theme-head"}}x{{end}}`, "missing {{define}} for page-base, tr-script"},
+		{"day-sections.html", `{{define "section-highlights"}}{{end}}`, "empty {{define}} for section-highlights"},
+		{"day.html", `{{define "day"}}  {{end}}`, "empty {{define}} for day"},
+	}
+	for _, c := range cases {
+		_, err := CheckTemplatesDir(writeTemplates(t, map[string]string{c.name: c.body}))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s %q: 错误 %v，期望包含 %q", c.name, c.body, err, c.want)
+		}
+	}
+
+	// 多个文件有误时一次全部报告
+	_, err := CheckTemplatesDir(writeTemplates(t, map[string]string{
+		"widget.html": "",
+		"day.html":    "<p></p>",
+		"qa.html":     "<p>ok</p>",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "widget.html") || !strings.Contains(err.Error(), "day.html") || strings.Contains(err.Error(), "qa.html") {
+		t.Fatalf("应同时报告 widget.html 与 day.html: %v", err)
+	}
+}
+
+func TestUseTemplatesDirOverlaysEmbedded(t *testing.T) {
+	t.Cleanup(func() { _ = UseTemplatesDir("") })
+	dir := writeTemplates(t, map[string]string{"widget.html": `custom {{.Talker}}`})
+	if err := UseTemplatesDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := RenderWidget(&buf, Widget{Talker: "测试群"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "custom 测试群" {
+		t.Fatalf("未使用覆盖模板: %q", buf.String())
+	}
+
+	if err := UseTemplatesDir(writeTemplates(t, map[string]string{"widget.html": ""})); err == nil {
+		t.Fatal("不合法的目录应报错")
+	}
+	buf.Reset()
+	if err := RenderWidget(&buf, Widget{Talker: "测试群"}); err != nil || buf.String() != "custom 测试群" {
+		t.Fatalf("检查失败后不应替换已生效的模板: %q %v", buf.String(), err)
+	}
+
+	if err := UseTemplatesDir(""); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := RenderWidget(&buf, Widget{Talker: "测试群"}); err != nil || !strings.Contains(buf.String(), `class="card"`) {
+		t.Fatalf("未恢复内置模板: %v", err)
+	}
+}
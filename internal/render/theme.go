@@ -0,0 +1,135 @@
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// ThemeFile is the stylesheet every page links to for its colors.
+const ThemeFile = "theme.css"
+
+// Theme selects the color palette of the rendered pages.
+type Theme struct {
+	// Mode is "auto" (follow the reader's system setting, the default),
+	// "light" or "dark".
+	Mode string
+	// Accent replaces the accent color of both palettes.
+	Accent string
+	// Light and Dark override single CSS variables of each palette, keyed
+	// by name without the leading "--" (bg, fg, muted, card-bg, …).
+	Light map[string]string
+	Dark  map[string]string
+}
+
+type themeVar struct{ name, value string }
+
+// The default palettes. Templates refer only to these variables, so a
+// theme never needs to touch the page markup.
+var (
+	lightPalette = []themeVar{
+		{"bg", "#f6f7fb"},
+		{"fg", "#161823"},
+		{"muted", "#5f6b7d"},
+		{"muted-contrast", "#3a4250"},
+		{"card-bg", "#ffffff"},
+		{"glass", "rgba(255,255,255,0.55)"},
+		{"border", "#e0e4ef"},
+		{"accent", "#3563ff"},
+		{"accent-soft", "rgba(53,99,255,0.15)"},
+		{"shadow", "0 8px 32px rgba(15,23,42,0.08)"},
+		{"mark", "#fff3b0"},
+		{"warn-bg", "#fff8e6"},
+		{"warn-border", "#f0c36d"},
+	}
+	darkPalette = []themeVar{
+		{"bg", "#070a14"},
+		{"fg", "#e6ebff"},
+		{"muted", "#94a0c2"},
+		{"muted-contrast", "#c4cbe0"},
+		{"card-bg", "#0f1527"},
+		{"glass", "rgba(15,21,39,0.65)"},
+		{"border", "#20263a"},
+		{"accent", "#7aa2ff"},
+		{"accent-soft", "rgba(122,162,255,0.15)"},
+		{"shadow", "0 12px 40px rgba(7,12,26,0.6)"},
+		{"mark", "#5a4b00"},
+		{"warn-bg", "#231d0e"},
+		{"warn-border", "#6b5522"},
+	}
+)
+
+var themeVarName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// validThemeValue reports whether v can be written into theme.css as a
+// variable value without breaking out of its rule.
+func validThemeValue(v string) bool {
+	return strings.TrimSpace(v) != "" && !strings.ContainsAny(v, ";{}<\n")
+}
+
+// validThemeVar reports whether name can be used as a variable name.
+func validThemeVar(name string) bool {
+	return themeVarName.MatchString(name)
+}
+
+// WriteTheme writes site/theme.css from t. Invalid names and values are
+// skipped so a typo in the config cannot break every page.
+func WriteTheme(siteDir string, t Theme) error {
+	var b strings.Builder
+	b.WriteString("/* Generated by wechat-view from report.theme. */\n")
+	switch strings.ToLower(strings.TrimSpace(t.Mode)) {
+	case "light":
+		writeThemeRoot(&b, "light", lightPalette, t.Accent, t.Light)
+	case "dark":
+		writeThemeRoot(&b, "dark", darkPalette, t.Accent, t.Dark)
+	case "", "auto":
+		writeThemeRoot(&b, "light dark", lightPalette, t.Accent, t.Light)
+		b.WriteString("@media (prefers-color-scheme: dark){\n")
+		writeThemeRoot(&b, "", darkPalette, t.Accent, t.Dark)
+		b.WriteString("}\n")
+	default:
+		return fmt.Errorf("unknown theme mode %q", t.Mode)
+	}
+	return atomicfile.WriteFile(filepath.Join(siteDir, ThemeFile), []byte(b.String()))
+}
+
+func writeThemeRoot(b *strings.Builder, scheme string, palette []themeVar, accent string, overrides map[string]string) {
+	vars := make([]themeVar, len(palette))
+	copy(vars, palette)
+	set := func(name, value string) {
+		for i := range vars {
+			if vars[i].name == name {
+				vars[i].value = value
+				return
+			}
+		}
+		vars = append(vars, themeVar{name, value})
+	}
+	if accent = strings.TrimSpace(accent); validThemeValue(accent) {
+		set("accent", accent)
+		set("accent-soft", "color-mix(in srgb, "+accent+" 15%, transparent)")
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := strings.TrimSpace(overrides[name]); validThemeVar(name) && validThemeValue(v) {
+			set(name, v)
+		}
+	}
+
+	b.WriteString(":root{\n")
+	if scheme != "" {
+		fmt.Fprintf(b, "  color-scheme: %s;\n", scheme)
+	}
+	for _, v := range vars {
+		fmt.Fprintf(b, "  --%s: %s;\n", v.name, v.value)
+	}
+	b.WriteString("}\n")
+}
@@ -0,0 +1,125 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// themeRoots returns the variables of each :root rule in css, in order.
+func themeRoots(t *testing.T, css string) []map[string]string {
+	t.Helper()
+	var roots []map[string]string
+	for _, m := range regexp.MustCompile(`(?s):root\{\n(.*?)\}`).FindAllStringSubmatch(css, -1) {
+		vars := map[string]string{}
+		for _, line := range strings.Split(strings.TrimSpace(m[1]), "\n") {
+			name, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimSpace(line), ";"), ": ")
+			if !ok {
+				t.Fatalf("无法解析的变量行: %q", line)
+			}
+			vars[name] = value
+		}
+		roots = append(roots, vars)
+	}
+	return roots
+}
+
+func writeThemeCSS(t *testing.T, th Theme) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := WriteTheme(dir, th); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, ThemeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWriteThemeModes(t *testing.T) {
+	css := writeThemeCSS(t, Theme{})
+	roots := themeRoots(t, css)
+	if len(roots) != 2 || !strings.Contains(css, "@media (prefers-color-scheme: dark){") {
+		t.Fatalf("auto 模式应输出浅色与深色两套变量:\n%s", css)
+	}
+	if roots[0]["color-scheme"] != "light dark" || roots[0]["--bg"] != "#f6f7fb" || roots[1]["--bg"] != "#070a14" {
+		t.Fatalf("auto 模式调色板异常: %v", roots)
+	}
+	for _, p := range lightPalette {
+		if _, ok := roots[0]["--"+p.name]; !ok {
+			t.Fatalf("缺少变量 --%s", p.name)
+		}
+	}
+
+	roots = themeRoots(t, writeThemeCSS(t, Theme{Mode: "Dark"}))
+	if len(roots) != 1 || roots[0]["color-scheme"] != "dark" || roots[0]["--fg"] != "#e6ebff" {
+		t.Fatalf("dark 模式异常: %v", roots)
+	}
+	roots = themeRoots(t, writeThemeCSS(t, Theme{Mode: "light"}))
+	if len(roots) != 1 || roots[0]["color-scheme"] != "light" || roots[0]["--fg"] != "#161823" {
+		t.Fatalf("light 模式异常: %v", roots)
+	}
+	if err := WriteTheme(t.TempDir(), Theme{Mode: "sepia"}); err == nil {
+		t.Fatal("未知模式应报错")
+	}
+}
+
+func TestWriteThemeOverrides(t *testing.T) {
+	css := writeThemeCSS(t, Theme{
+		Accent: "#e4572e",
+		Light:  map[string]string{"bg": "#fffdf7", "sidebar": "#eeeeee", "Bad": "red", "fg": "red;} body{display:none"},
+		Dark:   map[string]string{"bg": " #000 "},
+	})
+	roots := themeRoots(t, css)
+	light, dark := roots[0], roots[1]
+	for _, vars := range roots {
+		if vars["--accent"] != "#e4572e" || vars["--accent-soft"] != "color-mix(in srgb, #e4572e 15%, transparent)" {
+			t.Fatalf("强调色未覆盖两套调色板: %v", vars)
+		}
+	}
+	if light["--bg"] != "#fffdf7" || light["--sidebar"] != "#eeeeee" || dark["--bg"] != "#000" {
+		t.Fatalf("变量覆盖异常: light=%v dark=%v", light, dark)
+	}
+	// 非法的名称与值被跳过，保留默认值，不能跳出规则
+	if light["--fg"] != "#161823" || strings.Contains(css, "display:none") || strings.Contains(css, "--Bad") {
+		t.Fatalf("非法覆盖未被忽略:\n%s", css)
+	}
+	if strings.Count(css, "{") != strings.Count(css, "}") {
+		t.Fatalf("theme.css 括号不配对:\n%s", css)
+	}
+
+	css = writeThemeCSS(t, Theme{Accent: "red}"})
+	if strings.Contains(css, "red}") || themeRoots(t, css)[0]["--accent"] != "#3563ff" {
+		t.Fatalf("非法强调色未被忽略:\n%s", css)
+	}
+}
+
+func TestPagesLinkThemeFromSiteRoot(t *testing.T) {
+	site := t.TempDir()
+	dayDir := filepath.Join(site, "2025", "10", "16")
+	out := filepath.Join(dayDir, "index.html")
+	ctx := DayContext{Date: "2025-10-16", Talker: "test@chatroom", Messages: msgsAt("09:00", "09:10", "09:20"), MessageLimit: 1, MessagePageSize: 2}
+	if err := DayHTML(out, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTheme(site, Theme{}); err != nil {
+		t.Fatal(err)
+	}
+	href := regexp.MustCompile(`<link rel="stylesheet" href="([^"]*theme\.css)"/>`)
+	for _, page := range []string{out, filepath.Join(dayDir, MessagePagesDir, "1.html")} {
+		b, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := href.FindStringSubmatch(string(b))
+		if m == nil {
+			t.Fatalf("%s 未引用 theme.css", page)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(page), filepath.FromSlash(m[1]))); err != nil {
+			t.Fatalf("%s 的 %s 指不到站点根目录: %v", page, m[1], err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package render
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/summarize"
+)
+
+const (
+	// topicGapDays is how many quiet days a topic may have before a
+	// matching topic starts a new timeline instead of continuing it.
+	topicGapDays = 3
+	// topicMinOverlap is how many keywords a day's topic must share with a
+	// timeline to continue it.
+	topicMinOverlap = 2
+	// topicKeywordCap bounds the keywords a timeline matches by, so long
+	// threads do not swallow everything.
+	topicKeywordCap = 8
+)
+
+// TopicThread is a topic followed across consecutive days.
+type TopicThread struct {
+	Slug     string     `json:"slug"`
+	Name     string     `json:"name"`
+	Keywords []string   `json:"keywords"`
+	First    string     `json:"first"`
+	Last     string     `json:"last"`
+	Total    int        `json:"total"`
+	Days     []TopicDay `json:"days"`
+
+	names    map[string]int
+	keywords map[string]int
+}
+
+// TopicDay is one day's share of a topic timeline.
+type TopicDay struct {
+	Date           string   `json:"date"`
+	URL            string   `json:"url"`
+	Name           string   `json:"name"`
+	Keywords       []string `json:"keywords"`
+	Count          int      `json:"count"`
+	Representative string   `json:"representative,omitempty"`
+	Percent        float64  `json:"-"`
+}
+
+// UpdateTopicTimelines writes site/topics/<slug>/index.html for every topic
+// that came up on more than one day, plus site/topics/index.html and
+// topics.json listing them. Topics of different days are matched by shared
+// keywords.
+func UpdateTopicTimelines(siteDir, dataDir string) error {
+	days, err := archive.ReportDays(dataDir, siteDir)
+	if err != nil {
+		return err
+	}
+	var metas []dayTopics
+	for _, day := range days {
+		meta, err := archive.LoadMeta(siteDir, day)
+		if err != nil {
+			continue // not rendered yet
+		}
+		metas = append(metas, dayTopics{Date: day, Topics: meta.Summary.Topics})
+	}
+	threads := threadTopics(metas)
+
+	funcs := template.FuncMap{"join": strings.Join}
+	listT, err := newTemplate("topics.html").Funcs(funcs).ParseFS(tplFS, "templates/topics.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	pageT, err := newTemplate("topic.html").Funcs(funcs).ParseFS(tplFS, "templates/topic.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(siteDir, "topics")
+	generated := time.Now().Format(time.RFC3339)
+	for _, th := range threads {
+		data := map[string]any{"Thread": th, "GeneratedAt": generated}
+		if err := writeTemplate(pageT, filepath.Join(dir, th.Slug, "index.html"), data); err != nil {
+			return err
+		}
+	}
+	data := map[string]any{"Threads": threads, "GeneratedAt": generated}
+	if err := writeTemplate(listT, filepath.Join(dir, "index.html"), data); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "topics.json"), threads)
+}
+
+// dayTopics is the input of threadTopics: one day's topics.
+type dayTopics struct {
+	Date   string
+	Topics []summarize.Topic
+}
+
+// threadTopics walks days in order and appends each topic to the open
+// timeline it shares the most keywords with, or starts a new one. Only
+// timelines spanning two days or more are returned, most recent first.
+func threadTopics(days []dayTopics) []*TopicThread {
+	var all []*TopicThread
+	for _, day := range days {
+		date, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			continue
+		}
+		taken := map[*TopicThread]bool{}
+		for _, tp := range day.Topics {
+			var best *TopicThread
+			bestOverlap := 0
+			for _, th := range all {
+				if taken[th] {
+					continue
+				}
+				last, _ := time.Parse("2006-01-02", th.Last)
+				if date.Sub(last) > (topicGapDays+1)*24*time.Hour {
+					continue
+				}
+				if n := keywordOverlap(th.Keywords, tp.Keywords); n >= topicMinOverlap && n > bestOverlap {
+					best, bestOverlap = th, n
+				}
+			}
+			if best == nil {
+				best = &TopicThread{First: day.Date, names: map[string]int{}, keywords: map[string]int{}}
+				all = append(all, best)
+			}
+			taken[best] = true
+			best.add(day.Date, tp)
+		}
+	}
+
+	out := make([]*TopicThread, 0, len(all))
+	slugs := map[string]int{}
+	for _, th := range all {
+		if len(th.Days) < 2 {
+			continue
+		}
+		max := 0
+		for _, d := range th.Days {
+			if d.Count > max {
+				max = d.Count
+			}
+		}
+		for i := range th.Days {
+			th.Days[i].Percent = float64(th.Days[i].Count) / float64(max) * 100
+		}
+		th.Slug = th.First + "-" + slugify(th.Name)
+		if n := slugs[th.Slug]; n > 0 {
+			slugs[th.Slug]++
+			th.Slug = fmt.Sprintf("%s-%d", th.Slug, n+1)
+		} else {
+			slugs[th.Slug] = 1
+		}
+		out = append(out, th)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Last != out[j].Last {
+			return out[i].Last > out[j].Last
+		}
+		return out[i].Total > out[j].Total
+	})
+	return out
+}
+
+// add records the day's topic and refreshes the timeline's name and
+// matching keywords.
+func (th *TopicThread) add(date string, tp summarize.Topic) {
+	keywords := tp.Keywords
+	if len(keywords) == 0 {
+		keywords = []string{tp.Name}
+	}
+	th.Days = append(th.Days, TopicDay{
+		Date:           date,
+		URL:            "../../" + archive.DayURL(date),
+		Name:           tp.Name,
+		Keywords:       keywords,
+		Count:          tp.Count,
+		Representative: tp.Representative,
+	})
+	th.Last = date
+	th.Total += tp.Count
+	th.names[tp.Name] += tp.Count
+	for _, k := range keywords {
+		th.keywords[k] += tp.Count
+	}
+	th.Name = topKey(th.names)
+	th.Keywords = th.Keywords[:0]
+	for _, kv := range sortedCounts(th.keywords) {
+		if len(th.Keywords) == topicKeywordCap {
+			break
+		}
+		th.Keywords = append(th.Keywords, kv.Key)
+	}
+}
+
+func keywordOverlap(a, b []string) int {
+	n := 0
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+func topKey(counts map[string]int) string {
+	if kvs := sortedCounts(counts); len(kvs) > 0 {
+		return kvs[0].Key
+	}
+	return ""
+}
+
+func sortedCounts(counts map[string]int) []summarize.KV {
+	out := make([]summarize.KV, 0, len(counts))
+	for k, v := range counts {
+		out = append(out, summarize.KV{Key: k, Count: v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// slugify keeps ASCII topic names readable in the URL and hashes the rest,
+// mostly Chinese, to a short stable id.
+func slugify(name string) string {
+	if s := strings.ToLower(strings.Join(strings.Fields(name), "-")); slugRe.MatchString(s) && len(s) <= 40 {
+		return s
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
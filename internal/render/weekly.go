@@ -0,0 +1,201 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"wechat-view/internal/archive"
+	"wechat-view/internal/summarize"
+)
+
+// BroadcastWindow is how many days of history feed the announcement-time
+// suggestion.
+const BroadcastWindow = 28
+
+// WeeklyReport rolls up one ISO week of day reports.
+type WeeklyReport struct {
+	Week          string              `json:"week"` // e.g. 2025-W41
+	From          string              `json:"from"`
+	To            string              `json:"to"`
+	Days          []WeekDay           `json:"days"`
+	TotalMessages int                 `json:"totalMessages"`
+	PeakDay       string              `json:"peakDay,omitempty"`
+	TopSenders    []summarize.KV      `json:"topSenders,omitempty"`
+	Keywords      []summarize.KV      `json:"keywords,omitempty"`
+	Broadcast     summarize.Broadcast `json:"broadcast"`
+	BroadcastTip  string              `json:"broadcastTip,omitempty"`
+	Awards        summarize.Awards    `json:"awards"`
+}
+
+// WeekDay is one generated day inside a week.
+type WeekDay struct {
+	Date     string  `json:"date"`
+	URL      string  `json:"url"`
+	Messages int     `json:"messages"`
+	Senders  int     `json:"senders"`
+	Percent  float64 `json:"-"`
+}
+
+// UpdateWeeklyReports writes site/weekly/YYYY-Www.html (plus .json) for every
+// week with generated days and site/weekly/index.html for the latest one.
+func UpdateWeeklyReports(siteDir, dataDir string) error {
+	days, err := archive.ReportDays(dataDir, siteDir)
+	if err != nil {
+		return err
+	}
+	metas := map[string]archive.DayMeta{}
+	var weeks []string
+	byWeek := map[string][]string{}
+	for _, day := range days {
+		meta, err := archive.LoadMeta(siteDir, day)
+		if err != nil {
+			continue // not rendered yet
+		}
+		metas[day] = meta
+		w, err := isoWeek(day)
+		if err != nil {
+			return err
+		}
+		if _, ok := byWeek[w]; !ok {
+			weeks = append(weeks, w)
+		}
+		byWeek[w] = append(byWeek[w], day)
+	}
+	t, err := newTemplate("weekly.html").Funcs(template.FuncMap{
+		"dayURL": func(day string) string { return "../" + archive.DayURL(day) },
+		"pct":    func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) },
+	}).ParseFS(tplFS, "templates/weekly.html", "templates/theme.html")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(siteDir, "weekly")
+	generated := time.Now().Format(time.RFC3339)
+	for i, w := range weeks {
+		rep := buildWeek(w, byWeek[w], metas)
+		rep.Broadcast = broadcastFrom(metas, rep.To, BroadcastWindow)
+		rep.BroadcastTip = rep.Broadcast.Tip()
+		data := map[string]any{"Report": rep, "Weeks": weeks, "GeneratedAt": generated}
+		if err := writeTemplate(t, filepath.Join(dir, w+".html"), data); err != nil {
+			return err
+		}
+		if err := writeJSON(filepath.Join(dir, w+".json"), rep); err != nil {
+			return err
+		}
+		if i == len(weeks)-1 {
+			if err := writeTemplate(t, filepath.Join(dir, "index.html"), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadWeeklyReport reads back the weekly report UpdateWeeklyReports wrote for
+// the ISO week containing day.
+func LoadWeeklyReport(siteDir, day string) (WeeklyReport, error) {
+	var rep WeeklyReport
+	w, err := isoWeek(day)
+	if err != nil {
+		return rep, err
+	}
+	b, err := os.ReadFile(filepath.Join(siteDir, "weekly", w+".json"))
+	if err != nil {
+		return rep, err
+	}
+	err = json.Unmarshal(b, &rep)
+	return rep, err
+}
+
+// RecentBroadcast suggests announcement hours from the day reports in the
+// window days ending at day.
+func RecentBroadcast(siteDir, day string, window int) (summarize.Broadcast, error) {
+	span, err := archive.Window(day, window)
+	if err != nil {
+		return summarize.Broadcast{}, err
+	}
+	metas := map[string]archive.DayMeta{}
+	for _, d := range span {
+		if meta, err := archive.LoadMeta(siteDir, d); err == nil {
+			metas[d] = meta
+		}
+	}
+	return broadcastFrom(metas, day, window), nil
+}
+
+func broadcastFrom(metas map[string]archive.DayMeta, last string, window int) summarize.Broadcast {
+	span, err := archive.Window(last, window)
+	if err != nil {
+		return summarize.Broadcast{}
+	}
+	sums := make([]summarize.Summary, 0, len(span))
+	for _, d := range span {
+		if meta, ok := metas[d]; ok {
+			sums = append(sums, meta.Summary)
+		}
+	}
+	return summarize.BroadcastAdvice(sums, 3)
+}
+
+func buildWeek(week string, days []string, metas map[string]archive.DayMeta) WeeklyReport {
+	rep := WeeklyReport{Week: week, From: days[0], To: days[len(days)-1]}
+	senders := map[string]int{}
+	keywords := map[string]int{}
+	peak := 0
+	sums := make([]summarize.Summary, 0, len(days))
+	for _, day := range days {
+		s := metas[day].Summary
+		sums = append(sums, s)
+		rep.Days = append(rep.Days, WeekDay{Date: day, URL: "../" + archive.DayURL(day), Messages: s.TotalMessages, Senders: s.UniqueSenders})
+		rep.TotalMessages += s.TotalMessages
+		if s.TotalMessages > peak {
+			peak, rep.PeakDay = s.TotalMessages, day
+		}
+		for _, kv := range s.TopSenders {
+			senders[kv.Key] += kv.Count
+		}
+		for _, kv := range s.Keywords {
+			keywords[kv.Key] += kv.Count
+		}
+	}
+	for i := range rep.Days {
+		if peak > 0 {
+			rep.Days[i].Percent = float64(rep.Days[i].Messages) / float64(peak) * 100
+		}
+	}
+	rep.TopSenders = rankKV(senders, 10)
+	rep.Keywords = rankKV(keywords, 15)
+	rep.Awards = summarize.WeeklyAwards(sums)
+	return rep
+}
+
+func rankKV(m map[string]int, k int) []summarize.KV {
+	out := make([]summarize.KV, 0, len(m))
+	for key, c := range m {
+		out = append(out, summarize.KV{Key: key, Count: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count == out[j].Count {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Count > out[j].Count
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// isoWeek returns the ISO week label of day, e.g. 2025-W41.
+func isoWeek(day string) (string, error) {
+	t, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return "", err
+	}
+	y, w := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, w), nil
+}
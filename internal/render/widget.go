@@ -0,0 +1,70 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"path/filepath"
+
+	"wechat-view/internal/summarize"
+)
+
+// WidgetName is the day's embeddable summary card, next to its index.html.
+const WidgetName = "widget.html"
+
+// Widget is the compact summary of a day shown by widget.html, small
+// enough to iframe into a wiki page or a Grafana text panel. The API
+// serves the same card as JSON.
+type Widget struct {
+	Date     string `json:"date"`
+	Talker   string `json:"talker"`
+	Messages int    `json:"messages"`
+	Senders  int    `json:"senders"`
+	// VibeScore and VibeTone are the day's group vibes (0-100).
+	VibeScore int    `json:"vibeScore"`
+	VibeTone  string `json:"vibeTone,omitempty"`
+	// TopTopic is the most discussed topic; empty on quiet days.
+	TopTopic      string `json:"topTopic,omitempty"`
+	TopTopicCount int    `json:"topTopicCount,omitempty"`
+	// Headline is the AI headline (llm.headline), when there is one.
+	Headline string `json:"headline,omitempty"`
+	// URL links to the full report; empty hides the link.
+	URL string `json:"url,omitempty"`
+}
+
+// NewWidget builds the card for a day from its summary.
+func NewWidget(date, talker string, sum summarize.Summary) Widget {
+	w := Widget{
+		Date:      date,
+		Talker:    talker,
+		Messages:  sum.TotalMessages,
+		Senders:   sum.UniqueSenders,
+		VibeScore: sum.GroupVibes.Score,
+		VibeTone:  sum.GroupVibes.Tone,
+	}
+	if len(sum.Topics) > 0 {
+		w.TopTopic, w.TopTopicCount = sum.Topics[0].Name, sum.Topics[0].Count
+	}
+	return w
+}
+
+// WriteWidget writes dayDir/widget.html for w.
+func WriteWidget(dayDir string, w Widget) error {
+	t, err := widgetTemplate()
+	if err != nil {
+		return err
+	}
+	return writeTemplate(t, filepath.Join(dayDir, WidgetName), w)
+}
+
+// RenderWidget writes the widget.html page for w to out.
+func RenderWidget(out io.Writer, w Widget) error {
+	t, err := widgetTemplate()
+	if err != nil {
+		return err
+	}
+	return t.Execute(out, w)
+}
+
+func widgetTemplate() (*template.Template, error) {
+	return newTemplate("widget.html").ParseFS(tplFS, "templates/widget.html")
+}
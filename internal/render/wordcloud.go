@@ -0,0 +1,133 @@
+package render
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"wechat-view/internal/summarize"
+)
+
+// Word cloud drawing area, word cap and font size range for the day page.
+const (
+	cloudWidth    = 640
+	cloudHeight   = 260
+	cloudMaxWords = 40
+	cloudMinFont  = 12.0
+	cloudMaxFont  = 40.0
+)
+
+// WordCloudView is the laid-out keyword cloud drawn as inline SVG.
+type WordCloudView struct {
+	Width, Height int
+	Words         []CloudWord
+	// Hidden counts keywords that did not fit.
+	Hidden int
+}
+
+// CloudWord is a positioned keyword; X and Y are the center of its box.
+type CloudWord struct {
+	Text  string
+	Count int
+	X, Y  float64
+	Size  float64
+	// Tone is "accent" for the top words, "fg" or "muted" for the rest.
+	Tone string
+}
+
+type cloudBox struct{ x0, y0, x1, y1 float64 }
+
+func (a cloudBox) overlaps(b cloudBox) bool {
+	return a.x0 < b.x1 && b.x0 < a.x1 && a.y0 < b.y1 && b.y0 < a.y1
+}
+
+// buildWordCloud places keywords from the biggest down along an
+// Archimedean spiral from the center, each at the first spot where its
+// box overlaps nothing placed before. Font size grows with the square
+// root of the count, so one dominant word does not shrink the rest to
+// nothing. The layout is deterministic for the same keywords.
+func buildWordCloud(keywords []summarize.KV) *WordCloudView {
+	if len(keywords) == 0 {
+		return nil
+	}
+	view := &WordCloudView{Width: cloudWidth, Height: cloudHeight}
+	if len(keywords) > cloudMaxWords {
+		view.Hidden = len(keywords) - cloudMaxWords
+		keywords = keywords[:cloudMaxWords]
+	}
+	lo, hi := math.Inf(1), 0.0
+	for _, kv := range keywords {
+		lo = math.Min(lo, math.Sqrt(float64(kv.Count)))
+		hi = math.Max(hi, math.Sqrt(float64(kv.Count)))
+	}
+
+	w, h := float64(cloudWidth), float64(cloudHeight)
+	var placed []cloudBox
+	for i, kv := range keywords {
+		size := cloudMinFont
+		if hi > lo {
+			size += (cloudMaxFont - cloudMinFont) * (math.Sqrt(float64(kv.Count)) - lo) / (hi - lo)
+		} else {
+			size = (cloudMinFont + cloudMaxFont) / 2
+		}
+		bw, bh := textWidth(kv.Key)*size+4, size*1.15
+		box, ok := cloudBox{}, false
+		// The spiral is stretched to the canvas aspect ratio.
+		for t := 0.0; t < 120; t += 0.12 {
+			r := 3 * t
+			cx, cy := w/2+r*math.Cos(t)*w/h, h/2+r*math.Sin(t)
+			b := cloudBox{cx - bw/2, cy - bh/2, cx + bw/2, cy + bh/2}
+			if b.x0 < 0 || b.y0 < 0 || b.x1 > w || b.y1 > h {
+				continue
+			}
+			free := true
+			for _, p := range placed {
+				if b.overlaps(p) {
+					free = false
+					break
+				}
+			}
+			if free {
+				box, ok = b, true
+				break
+			}
+		}
+		if !ok {
+			view.Hidden++
+			continue
+		}
+		placed = append(placed, box)
+		tone := "muted"
+		switch {
+		case i < 3:
+			tone = "accent"
+		case i < 12:
+			tone = "fg"
+		}
+		view.Words = append(view.Words, CloudWord{
+			Text:  kv.Key,
+			Count: kv.Count,
+			X:     round1((box.x0 + box.x1) / 2),
+			Y:     round1((box.y0 + box.y1) / 2),
+			Size:  round1(size),
+			Tone:  tone,
+		})
+	}
+	if len(view.Words) == 0 {
+		return nil
+	}
+	return view
+}
+
+// textWidth estimates the width of s in ems: CJK and other wide runes take
+// a full em, ASCII about 0.6.
+func textWidth(s string) float64 {
+	width := 0.0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			width += 0.6
+		} else {
+			width += 1
+		}
+	}
+	return width
+}
@@ -0,0 +1,103 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+)
+
+func TestWordCloudWeightsBySquareRoot(t *testing.T) {
+	view := buildWordCloud([]summarize.KV{{Key: "发布", Count: 100}, {Key: "kafka", Count: 25}, {Key: "回滚", Count: 1}})
+	if view == nil || len(view.Words) != 3 {
+		t.Fatalf("词云异常: %+v", view)
+	}
+	sizes := map[string]float64{}
+	for _, w := range view.Words {
+		sizes[w.Text] = w.Size
+	}
+	// sqrt: 1 → 最小字号，10 → 最大字号，5 在两者之间 4/9 处
+	want := round1(cloudMinFont + (cloudMaxFont-cloudMinFont)*4/9)
+	if sizes["发布"] != cloudMaxFont || sizes["回滚"] != cloudMinFont || sizes["kafka"] != want {
+		t.Fatalf("字号 = %v，期望 kafka 为 %v", sizes, want)
+	}
+
+	same := buildWordCloud([]summarize.KV{{Key: "发布", Count: 3}, {Key: "回滚", Count: 3}})
+	for _, w := range same.Words {
+		if w.Size != (cloudMinFont+cloudMaxFont)/2 {
+			t.Fatalf("次数相同时应取中间字号: %+v", same.Words)
+		}
+	}
+}
+
+func TestWordCloudLayout(t *testing.T) {
+	var kws []summarize.KV
+	for i := 0; i < cloudMaxWords+5; i++ {
+		kws = append(kws, summarize.KV{Key: fmt.Sprintf("关键词%d", i), Count: 200 - i*4})
+	}
+	view := buildWordCloud(kws)
+	if view.Hidden < 5 || len(view.Words)+view.Hidden != len(kws) {
+		t.Fatalf("显示 %d 个、隐藏 %d 个，共 %d 个", len(view.Words), view.Hidden, len(kws))
+	}
+	var boxes []cloudBox
+	for i, w := range view.Words {
+		bw, bh := textWidth(w.Text)*w.Size+4, w.Size*1.15
+		b := cloudBox{w.X - bw/2, w.Y - bh/2, w.X + bw/2, w.Y + bh/2}
+		// 坐标保留一位小数，留出舍入误差
+		if b.x0 < -0.1 || b.y0 < -0.1 || b.x1 > cloudWidth+0.1 || b.y1 > cloudHeight+0.1 {
+			t.Fatalf("%s 超出画布: %+v", w.Text, b)
+		}
+		shrunk := cloudBox{b.x0 + 0.1, b.y0 + 0.1, b.x1 - 0.1, b.y1 - 0.1}
+		for _, p := range boxes {
+			if shrunk.overlaps(p) {
+				t.Fatalf("%s 与已放置的词重叠", w.Text)
+			}
+		}
+		boxes = append(boxes, shrunk)
+		wantTone := "muted"
+		if i < 3 {
+			wantTone = "accent"
+		} else if i < 12 {
+			wantTone = "fg"
+		}
+		if w.Tone != wantTone {
+			t.Fatalf("第 %d 个词色调 %s，期望 %s", i, w.Tone, wantTone)
+		}
+	}
+	if w := view.Words[0]; math.Abs(w.X-cloudWidth/2) > 1 || math.Abs(w.Y-cloudHeight/2) > 1 {
+		t.Fatalf("最大的词应在中心: %+v", w)
+	}
+	if again := buildWordCloud(kws); !reflect.DeepEqual(again, view) {
+		t.Fatal("同样的关键词布局不一致")
+	}
+	if buildWordCloud(nil) != nil {
+		t.Fatal("没有关键词时不应生成词云")
+	}
+}
+
+func TestWordCloudFromSummaryKeywords(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "Kafka rollback started"},
+		{SenderName: "小美", Content: "kafka rollback done, the lag is gone"},
+		{SenderName: "老王", Content: "KAFKA consumer lag"},
+	}
+	view := buildWordCloud(summarize.BuildSummary(msgs).Keywords)
+	counts := map[string]int{}
+	for _, w := range view.Words {
+		counts[w.Text] = w.Count
+	}
+	if counts["kafka"] != 3 || counts["rollback"] != 2 || counts["lag"] != 2 {
+		t.Fatalf("词云词频异常: %v", counts)
+	}
+	for _, stop := range []string{"the", "is", "Kafka", "KAFKA"} {
+		if _, ok := counts[stop]; ok {
+			t.Fatalf("%s 不应出现在词云中: %v", stop, counts)
+		}
+	}
+	if view.Words[0].Text != "kafka" || view.Words[0].Size != cloudMaxFont {
+		t.Fatalf("最高频词应最大: %+v", view.Words[0])
+	}
+}
@@ -0,0 +1,214 @@
+// Package risk flags messages that match sensitive-word or policy rules and
+// keeps the human review of those hits. Reviewers confirm a hit or mark it a
+// false positive; false positives add a whitelist phrase so the same text is
+// no longer flagged or counted, closing the detect-review-improve loop.
+package risk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/summarize"
+	"wechat-view/internal/tags"
+)
+
+// Review statuses. Hits without a review are pending.
+const (
+	StatusPending       = "pending"
+	StatusConfirmed     = "confirmed"
+	StatusFalsePositive = "false_positive"
+)
+
+// Hit is one message matched by one rule.
+type Hit struct {
+	ID      string `json:"id"`
+	Date    string `json:"date"`
+	Rule    string `json:"rule"`
+	Match   string `json:"match"`
+	Sender  string `json:"sender,omitempty"`
+	Time    string `json:"time,omitempty"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+	// Review is set once the hit was confirmed or dismissed.
+	Review *Review `json:"review,omitempty"`
+}
+
+// Detector matches messages against compiled risk rules.
+type Detector struct {
+	rules []rule
+	allow []string
+}
+
+type rule struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+// Compile validates rules (same shape as tag rules: a name and
+// case-insensitive patterns) and the global allow phrases. A nil Detector is
+// returned when no rules are configured.
+func Compile(rules []tags.Rule, allow []string) (*Detector, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	d := &Detector{}
+	seen := map[string]bool{}
+	for i, r := range rules {
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			return nil, fmt.Errorf("risk.rules[%d]: name is required", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("risk.rules[%d]: duplicate rule %q", i, name)
+		}
+		seen[name] = true
+		cr := rule{name: name}
+		for _, p := range r.Patterns {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("risk.rules[%d] %s: invalid pattern %q: %w", i, name, p, err)
+			}
+			cr.patterns = append(cr.patterns, re)
+		}
+		if len(cr.patterns) == 0 {
+			return nil, fmt.Errorf("risk.rules[%d] %s: at least one pattern is required", i, name)
+		}
+		d.rules = append(d.rules, cr)
+	}
+	for _, a := range allow {
+		if a = strings.TrimSpace(a); a != "" {
+			d.allow = append(d.allow, a)
+		}
+	}
+	return d, nil
+}
+
+// Scan returns day's hits in message order, one per message and rule.
+// System notices are skipped, as are texts containing a configured allow
+// phrase or a phrase whitelisted in store (which may be nil). Status and
+// Review come from store.
+func (d *Detector) Scan(day string, msgs []chatlog.Message, store *Store) []Hit {
+	if d == nil {
+		return nil
+	}
+	var out []Hit
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		text := messageText(m)
+		if strings.TrimSpace(text) == "" || d.allowed(text) {
+			continue
+		}
+		for _, r := range d.rules {
+			match := ""
+			for _, re := range r.patterns {
+				if match = re.FindString(text); match != "" {
+					break
+				}
+			}
+			if match == "" || store.Allowed(r.name, text) {
+				continue
+			}
+			h := Hit{
+				ID:      HitID(day, m, r.name),
+				Date:    day,
+				Rule:    r.name,
+				Match:   match,
+				Sender:  firstNonEmpty(m.SenderName, m.Sender),
+				Time:    m.Time,
+				Content: text,
+				Status:  StatusPending,
+			}
+			if rv, ok := store.Get(h.ID); ok {
+				h.Status = rv.Status
+				h.Review = &rv
+			}
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func (d *Detector) allowed(text string) bool {
+	lower := strings.ToLower(text)
+	for _, a := range d.allow {
+		if strings.Contains(lower, strings.ToLower(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats counts hits for the day summary. falsePositives is the number of
+// the day's hits dismissed in review, which Scan no longer returns.
+func Stats(hits []Hit, falsePositives int) *summarize.RiskStats {
+	st := &summarize.RiskStats{Hits: len(hits), FalsePositive: falsePositives}
+	byRule := map[string]int{}
+	for _, h := range hits {
+		switch h.Status {
+		case StatusConfirmed:
+			st.Confirmed++
+		default:
+			st.Pending++
+		}
+		byRule[h.Rule]++
+	}
+	for name, n := range byRule {
+		st.ByRule = append(st.ByRule, summarize.KV{Key: name, Count: n})
+	}
+	sort.Slice(st.ByRule, func(i, j int) bool {
+		if st.ByRule[i].Count != st.ByRule[j].Count {
+			return st.ByRule[i].Count > st.ByRule[j].Count
+		}
+		return st.ByRule[i].Key < st.ByRule[j].Key
+	})
+	return st
+}
+
+// HitID identifies a rule hit on a message: the day as YYYYMMDD, a dash
+// and 12 hex digits. The day prefix lets the API find the raw file.
+func HitID(day string, m chatlog.Message, ruleName string) string {
+	h := sha1.Sum([]byte(strings.Join([]string{day, m.Sender, m.Time, messageText(m), ruleName}, "\x00")))
+	return strings.ReplaceAll(day, "-", "") + "-" + hex.EncodeToString(h[:6])
+}
+
+// DayOf returns the YYYY-MM-DD day encoded in a hit id.
+func DayOf(id string) (string, bool) {
+	if !idRegexp.MatchString(id) {
+		return "", false
+	}
+	return id[:4] + "-" + id[4:6] + "-" + id[6:8], true
+}
+
+var idRegexp = regexp.MustCompile(`^\d{8}-[0-9a-f]{12}$`)
+
+// messageText is what rules match: the text plus any shared card title and
+// description, like tag rules.
+func messageText(m chatlog.Message) string {
+	text := m.Content
+	if text == "" {
+		text = m.Text
+	}
+	if m.Share != nil {
+		text = strings.TrimSpace(text + "\n" + m.Share.Title + "\n" + m.Share.Desc)
+	}
+	return text
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package risk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/tags"
+)
+
+func TestScanAndReviewLoop(t *testing.T) {
+	d, err := Compile([]tags.Rule{{Name: "引流", Patterns: []string{"加我v信", "返利"}}}, []string{"官方返利说明"})
+	if err != nil {
+		t.Fatalf("编译规则失败: %v", err)
+	}
+	msgs := []chatlog.Message{
+		{Sender: "a", Time: "2025-10-16T09:00:00+08:00", Content: "加我V信领返利"},
+		{Sender: "b", Time: "2025-10-16T09:01:00+08:00", Content: "见官方返利说明"},
+		{Sender: "c", Time: "2025-10-16T09:02:00+08:00", Content: "双十一返利群又开了"},
+		{Sender: "系统消息", MsgType: 10000, Content: "返利群已解散"},
+	}
+	store, err := Open(filepath.Join(t.TempDir(), "risk_reviews.json"))
+	if err != nil {
+		t.Fatalf("打开复核记录失败: %v", err)
+	}
+	hits := d.Scan("2025-10-16", msgs, store)
+	if len(hits) != 2 || hits[0].Match != "加我V信" || hits[0].Status != StatusPending {
+		t.Fatalf("命中不对: %+v", hits)
+	}
+	if day, ok := DayOf(hits[0].ID); !ok || day != "2025-10-16" {
+		t.Fatalf("id 应包含日期: %s", hits[0].ID)
+	}
+
+	if _, err := store.Confirm(hits[0], "alice", ""); err != nil {
+		t.Fatalf("确认失败: %v", err)
+	}
+	if _, err := store.Dismiss(hits[1], "alice", "", "双十一"); err != nil {
+		t.Fatalf("标记误报失败: %v", err)
+	}
+	hits = d.Scan("2025-10-16", msgs, store)
+	st := Stats(hits, len(store.List("2025-10-16", StatusFalsePositive)))
+	if st.Hits != 1 || st.Confirmed != 1 || st.Pending != 0 || st.FalsePositive != 1 {
+		t.Fatalf("统计不对: %+v", st)
+	}
+
+	// 改判为违规后撤销白名单
+	reopened, err := Open(store.path)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	if len(reopened.Whitelist()) != 1 {
+		t.Fatalf("白名单未持久化: %+v", reopened.Whitelist())
+	}
+	dismissed := Hit{ID: HitID("2025-10-16", msgs[2], "引流"), Date: "2025-10-16", Rule: "引流", Content: msgs[2].Content}
+	if _, err := reopened.Confirm(dismissed, "bob", ""); err != nil {
+		t.Fatalf("改判失败: %v", err)
+	}
+	if len(reopened.Whitelist()) != 0 || len(d.Scan("2025-10-16", msgs, reopened)) != 2 {
+		t.Fatal("改判后应撤销白名单")
+	}
+}
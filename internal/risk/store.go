@@ -0,0 +1,216 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// ErrInvalidID is returned for ids that are not HitID values.
+var ErrInvalidID = errors.New("invalid risk hit id")
+
+// Review is the reviewer's decision on one hit. The hit's details are kept
+// so dismissed hits can still be listed after the whitelist hides them.
+type Review struct {
+	ID         string `json:"id"`
+	Date       string `json:"date"`
+	Rule       string `json:"rule"`
+	Content    string `json:"content,omitempty"`
+	Status     string `json:"status"`
+	ReviewedBy string `json:"reviewedBy,omitempty"`
+	ReviewedAt string `json:"reviewedAt"`
+	Note       string `json:"note,omitempty"`
+	// Phrase is the whitelist entry a false positive added.
+	Phrase string `json:"phrase,omitempty"`
+}
+
+// Allow is a whitelist entry: texts containing Phrase are not flagged by
+// Rule (or by any rule when Rule is empty).
+type Allow struct {
+	Rule   string `json:"rule,omitempty"`
+	Phrase string `json:"phrase"`
+	// From is the review that added the entry.
+	From string `json:"from,omitempty"`
+}
+
+type storeFile struct {
+	Reviews []Review `json:"reviews"`
+	Allow   []Allow  `json:"allow"`
+}
+
+// Store is the file-backed review log and whitelist (data/risk_reviews.json),
+// shared by the generator and the API server. It is safe for concurrent use
+// and a nil *Store behaves as an empty one.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	reviews map[string]Review
+	allow   []Allow
+}
+
+// Open loads the store at path; a missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now, reviews: map[string]Review{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f storeFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	for _, r := range f.Reviews {
+		s.reviews[r.ID] = r
+	}
+	s.allow = f.Allow
+	return s, nil
+}
+
+// Get returns the review of hit id.
+func (s *Store) Get(id string) (Review, bool) {
+	if s == nil {
+		return Review{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reviews[id]
+	return r, ok
+}
+
+// List returns the reviews of day (all days when empty) with the given
+// status (any when empty), newest first.
+func (s *Store) List(day, status string) []Review {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Review{}
+	for _, r := range s.reviews {
+		if (day == "" || r.Date == day) && (status == "" || r.Status == status) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ReviewedAt != out[j].ReviewedAt {
+			return out[i].ReviewedAt > out[j].ReviewedAt
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Whitelist returns the whitelist entries added by reviews.
+func (s *Store) Whitelist() []Allow {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Allow(nil), s.allow...)
+}
+
+// Allowed reports whether a whitelist entry covers text for ruleName.
+func (s *Store) Allowed(ruleName, text string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lower := strings.ToLower(text)
+	for _, a := range s.allow {
+		if (a.Rule == "" || a.Rule == ruleName) && strings.Contains(lower, strings.ToLower(a.Phrase)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Confirm records hit as a real violation, dropping any whitelist entry an
+// earlier false-positive review of the same hit added.
+func (s *Store) Confirm(hit Hit, by, note string) (Review, error) {
+	return s.review(hit, StatusConfirmed, by, note, "")
+}
+
+// Dismiss records hit as a false positive and whitelists phrase for its
+// rule; an empty phrase whitelists the whole message text.
+func (s *Store) Dismiss(hit Hit, by, note, phrase string) (Review, error) {
+	phrase = strings.TrimSpace(phrase)
+	if phrase == "" {
+		phrase = strings.TrimSpace(hit.Content)
+	}
+	if !strings.Contains(strings.ToLower(hit.Content), strings.ToLower(phrase)) {
+		return Review{}, errors.New("phrase must appear in the message")
+	}
+	return s.review(hit, StatusFalsePositive, by, note, phrase)
+}
+
+func (s *Store) review(hit Hit, status, by, note, phrase string) (Review, error) {
+	if _, ok := DayOf(hit.ID); !ok {
+		return Review{}, ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := Review{
+		ID:         hit.ID,
+		Date:       hit.Date,
+		Rule:       hit.Rule,
+		Content:    hit.Content,
+		Status:     status,
+		ReviewedBy: by,
+		ReviewedAt: s.now().Format(time.RFC3339),
+		Note:       note,
+		Phrase:     phrase,
+	}
+	prevReview, existed := s.reviews[hit.ID]
+	prevAllow := s.allow
+	allow := make([]Allow, 0, len(s.allow)+1)
+	for _, a := range s.allow {
+		if a.From != hit.ID {
+			allow = append(allow, a)
+		}
+	}
+	if phrase != "" {
+		allow = append(allow, Allow{Rule: hit.Rule, Phrase: phrase, From: hit.ID})
+	}
+	s.reviews[hit.ID] = r
+	s.allow = allow
+	if err := s.save(); err != nil {
+		if existed {
+			s.reviews[hit.ID] = prevReview
+		} else {
+			delete(s.reviews, hit.ID)
+		}
+		s.allow = prevAllow
+		return Review{}, err
+	}
+	return r, nil
+}
+
+// save writes the store atomically; callers hold mu.
+func (s *Store) save() error {
+	f := storeFile{Reviews: make([]Review, 0, len(s.reviews)), Allow: s.allow}
+	for _, r := range s.reviews {
+		f.Reviews = append(f.Reviews, r)
+	}
+	sort.Slice(f.Reviews, func(i, j int) bool { return f.Reviews[i].ID < f.Reviews[j].ID })
+	if f.Allow == nil {
+		f.Allow = []Allow{}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.path, data)
+}
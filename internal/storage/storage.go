@@ -0,0 +1,255 @@
+// Package storage copies the data and site directories to object storage,
+// so the site can be served from a bucket behind a CDN.
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// Store is a flat key/value object store. Keys use forward slashes.
+type Store interface {
+	// Put stores body under key, replacing any previous object.
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	// Get returns the object under key, or an error wrapping fs.ErrNotExist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key  string
+	Size int64
+	// MD5 is the hex MD5 of the content when the store knows it; S3 and
+	// compatible stores report it as the ETag of single-part uploads.
+	MD5 string
+}
+
+// Dir is a Store backed by a local directory, for tests and for mirroring
+// to a mounted drive.
+type Dir string
+
+// Put implements Store.
+func (d Dir) Put(_ context.Context, key string, body []byte, _ string) error {
+	return atomicfile.WriteFile(d.path(key), body)
+}
+
+// Get implements Store.
+func (d Dir) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(d.path(key))
+}
+
+// Delete implements Store.
+func (d Dir) Delete(_ context.Context, key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List implements Store.
+func (d Dir) List(_ context.Context, prefix string) ([]Object, error) {
+	files, err := localFiles(string(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Object
+	for _, f := range files {
+		if !strings.HasPrefix(f.Key, prefix) {
+			continue
+		}
+		sum, err := fileMD5(d.path(f.Key))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Object{Key: f.Key, Size: f.Size, MD5: sum})
+	}
+	return out, nil
+}
+
+func (d Dir) path(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(key))
+}
+
+// SyncOptions tunes Sync.
+type SyncOptions struct {
+	// Prune deletes objects under the prefix that have no local file.
+	Prune bool
+	// Keep lists key prefixes that Prune leaves alone, e.g. the data
+	// prefix nested under a site stored at the bucket root.
+	Keep []string
+	// Skip excludes local files by their slash-separated relative path.
+	Skip func(rel string) bool
+	// Workers bounds concurrent uploads; 0 means 4.
+	Workers int
+}
+
+// SyncResult tallies one Sync.
+type SyncResult struct {
+	Uploaded, Unchanged, Deleted int
+	// Bytes is the size of the uploaded files.
+	Bytes int64
+}
+
+// Sync makes the objects under prefix match the files under dir: files
+// whose MD5 differs from the stored object are uploaded and, with Prune,
+// objects without a local file are deleted. Temp files of writes in
+// progress are never uploaded. Failed uploads do not stop the others; the
+// first error is returned with the tally of what succeeded.
+func Sync(ctx context.Context, s Store, dir, prefix string, opts SyncOptions) (SyncResult, error) {
+	var res SyncResult
+	files, err := localFiles(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return res, nil
+		}
+		return res, err
+	}
+	remote, err := s.List(ctx, prefix)
+	if err != nil {
+		return res, err
+	}
+	stored := make(map[string]Object, len(remote))
+	for _, o := range remote {
+		stored[o.Key] = o
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	sem := make(chan struct{}, workers)
+	local := make(map[string]bool, len(files))
+	for _, f := range files {
+		if opts.Skip != nil && opts.Skip(f.Key) {
+			continue
+		}
+		key := prefix + f.Key
+		local[key] = true
+		f := f
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			p := filepath.Join(dir, filepath.FromSlash(f.Key))
+			body, err := os.ReadFile(p)
+			if err != nil {
+				fail(err)
+				return
+			}
+			sum := md5.Sum(body)
+			if o, ok := stored[key]; ok && o.Size == int64(len(body)) && strings.EqualFold(o.MD5, hex.EncodeToString(sum[:])) {
+				mu.Lock()
+				res.Unchanged++
+				mu.Unlock()
+				return
+			}
+			if err := s.Put(ctx, key, body, ContentType(key)); err != nil {
+				fail(err)
+				return
+			}
+			mu.Lock()
+			res.Uploaded++
+			res.Bytes += int64(len(body))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if opts.Prune && firstErr == nil {
+	objects:
+		for _, o := range remote {
+			if local[o.Key] {
+				continue
+			}
+			for _, keep := range opts.Keep {
+				if keep != "" && strings.HasPrefix(o.Key, keep) {
+					continue objects
+				}
+			}
+			if err := s.Delete(ctx, o.Key); err != nil {
+				fail(err)
+				continue
+			}
+			res.Deleted++
+		}
+	}
+	return res, firstErr
+}
+
+// ContentType guesses the Content-Type of key from its extension.
+func ContentType(key string) string {
+	ext := path.Ext(key)
+	if ext == ".gz" {
+		return "application/gzip"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// localFiles lists the regular files under dir as objects keyed by their
+// slash-separated relative path, skipping temp files.
+func localFiles(dir string) ([]Object, error) {
+	var out []Object
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || atomicfile.IsTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		out = append(out, Object{Key: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, err
+}
+
+func fileMD5(p string) (string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,153 @@
+// Package subscribe builds personalised digests: each subscriber only gets
+// the day's messages and conclusions about the keywords they follow.
+package subscribe
+
+import (
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/notify"
+	"wechat-view/internal/summarize"
+)
+
+// MaxMessages caps the matched messages quoted in one digest.
+const MaxMessages = 12
+
+// maxQuote trims each quoted message to this many runes.
+const maxQuote = 80
+
+// Digest narrows base to the messages and resolved questions that mention
+// any of keywords. A keyword matches message text and shared link titles
+// case-insensitively, or a tag with the same name. It reports false when
+// nothing matched, so quiet days send nothing. The full-page HTML of base is
+// dropped; it is not personalised. The result is a notify.KindSubscription
+// digest, so it never reaches the MQTT daily sensors.
+func Digest(keywords []string, base notify.Digest, msgs []chatlog.Message, sum summarize.Summary) (notify.Digest, bool) {
+	focus := strings.Join(keywords, "、")
+	keywords = normalize(keywords)
+	if len(keywords) == 0 {
+		return notify.Digest{}, false
+	}
+	d := base
+	d.Kind = notify.KindSubscription
+	d.HTML = ""
+	d.Overview = ""
+	d.BroadcastTip = ""
+	d.Focus = focus
+	d.Highlights = nil
+	d.Conclusions = nil
+
+	senders := map[string]bool{}
+	matched := 0
+	for _, m := range msgs {
+		if m.MsgType == 10000 || !matches(m, keywords) {
+			continue
+		}
+		matched++
+		senders[sender(m)] = true
+		if len(d.Highlights) < MaxMessages {
+			d.Highlights = append(d.Highlights, quote(m))
+		}
+	}
+	for _, item := range sum.ReplyDebt.Resolved {
+		if !contains(item.Question+"\n"+item.Answer, keywords) {
+			continue
+		}
+		line := item.Questioner + " 问：" + clip(item.Question)
+		if item.Answer != "" {
+			line += " → " + item.AnsweredBy + "：" + clip(item.Answer)
+		}
+		d.Conclusions = append(d.Conclusions, line)
+	}
+	if matched == 0 && len(d.Conclusions) == 0 {
+		return notify.Digest{}, false
+	}
+	d.TotalMessages = matched
+	d.UniqueSenders = len(senders)
+	return d, true
+}
+
+func normalize(keywords []string) []string {
+	var out []string
+	for _, k := range keywords {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func matches(m chatlog.Message, keywords []string) bool {
+	for _, tag := range m.Tags {
+		for _, k := range keywords {
+			if strings.ToLower(tag) == k {
+				return true
+			}
+		}
+	}
+	text := m.Content + "\n" + m.Text
+	if m.Share != nil {
+		text += "\n" + m.Share.Title
+	}
+	return contains(text, keywords)
+}
+
+func contains(text string, keywords []string) bool {
+	text = strings.ToLower(text)
+	for _, k := range keywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func quote(m chatlog.Message) string {
+	text := strings.TrimSpace(m.Content)
+	if text == "" {
+		text = strings.TrimSpace(m.Text)
+	}
+	if text == "" && m.Share != nil {
+		text = m.Share.Title
+	}
+	line := sender(m) + "：" + clip(text)
+	if at := clock(m); at != "" {
+		line = at + " " + line
+	}
+	return line
+}
+
+func clip(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxQuote {
+		return string(r[:maxQuote]) + "…"
+	}
+	return s
+}
+
+func sender(m chatlog.Message) string {
+	for _, s := range []string{m.SenderName, m.Nickname, m.Sender, m.From} {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return "未知"
+}
+
+func clock(m chatlog.Message) string {
+	if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
+		return t.Format("15:04")
+	}
+	ts := m.Timestamp
+	if ts == 0 {
+		ts = m.CreateTime
+	}
+	if ts <= 0 {
+		return ""
+	}
+	if ts > 1_000_000_000_000 {
+		ts /= 1000
+	}
+	return time.Unix(ts, 0).Local().Format("15:04")
+}
@@ -0,0 +1,48 @@
+package subscribe
+
+import (
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/notify"
+	"wechat-view/internal/summarize"
+)
+
+func TestDigestKeepsOnlySubscribedTopics(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "今天 claude 又挂了", Time: "2025-10-16T09:05:00+08:00"},
+		{SenderName: "小美", Content: "午饭吃啥"},
+		{SenderName: "老王", Content: "我们组在试", Tags: []string{"MCP"}},
+		{SenderName: "系统消息", MsgType: 10000, Content: `"Claude粉"邀请"新人"加入了群聊`},
+	}
+	sum := summarize.Summary{ReplyDebt: summarize.ReplyDebt{Resolved: []summarize.ReplyItem{
+		{Questioner: "小美", Question: "MCP 怎么配置？", Answer: "看官方文档", AnsweredBy: "老王"},
+		{Questioner: "阿强", Question: "周末聚餐吗", Answer: "去", AnsweredBy: "小美"},
+	}}}
+	base := notify.Digest{Date: "2025-10-16", Talker: "AI群", TotalMessages: 4, HTML: "<html></html>", Highlights: []string{"全群要点"}}
+
+	d, ok := Digest([]string{"Claude", "mcp"}, base, msgs, sum)
+	if !ok {
+		t.Fatal("应当命中订阅")
+	}
+	if d.TotalMessages != 2 || d.UniqueSenders != 2 || len(d.Highlights) != 2 {
+		t.Fatalf("命中消息不对: %+v", d)
+	}
+	if d.Highlights[0] != "09:05 阿强：今天 claude 又挂了" {
+		t.Fatalf("引用格式不对: %q", d.Highlights[0])
+	}
+	if len(d.Conclusions) != 1 || !strings.Contains(d.Conclusions[0], "看官方文档") {
+		t.Fatalf("结论不对: %v", d.Conclusions)
+	}
+	if d.Kind != notify.KindSubscription {
+		t.Fatalf("订阅摘要类型不对: %q", d.Kind)
+	}
+	if d.HTML != "" || !strings.Contains(d.Title(), "话题订阅：Claude、mcp") {
+		t.Fatalf("个性化摘要不应携带全量页面: %q", d.Title())
+	}
+
+	if _, ok := Digest([]string{"区块链"}, base, msgs, sum); ok {
+		t.Fatal("没有相关内容时不应发送")
+	}
+}
@@ -0,0 +1,130 @@
+package summarize
+
+import (
+	"regexp"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// maxActionItems caps the action items kept per day.
+const maxActionItems = 30
+
+// ActionItem is an explicit commitment found in a message: "我明天发给你",
+// "@阿强 你周五之前上线".
+type ActionItem struct {
+	// Owner is who committed: the sender, or the member addressed with
+	// "@name 你…".
+	Owner string `json:"owner"`
+	// Task is the clause holding the commitment.
+	Task string `json:"task"`
+	// Due is the deadline as written ("明天", "周五之前"), when there is one.
+	Due string `json:"due,omitempty"`
+	// At, Sender and Source identify the message it came from.
+	At     string `json:"at,omitempty"`
+	Sender string `json:"sender"`
+	Source string `json:"source"`
+	// Refined marks items rewritten by the LLM (see insight.RefineActions).
+	Refined bool `json:"refined,omitempty"`
+}
+
+// Alternations the commitment patterns are built from.
+const (
+	dueWords   = `今天|今晚|今儿|明天|明早|明晚|后天|下周[一二三四五六日天]?|(?:本|这)周[一二三四五六日天末]?|周[一二三四五六日天末]|月底|月初|\d{1,2}月\d{1,2}[号日]|\d{1,2}[号日]|\d{1,2}[点:：]\d{0,2}`
+	soonWords  = `马上|尽快|稍后|晚点|回头|待会|等下|一会儿?`
+	actionVerb = `(?:发|给|交|提交|上线|发布|整理|跟进|处理|修|改|看|安排|补|写|出|同步|确认|联系|搞定|完成|部署|测|提测|review|merge)`
+)
+
+var (
+	// commitRe is a first-person promise: "我" closely followed by a time,
+	// urgency or take-on marker, then an action: "我明天发给你", "我这边晚点
+	// 整理一下", "我来改".
+	commitRe = regexp.MustCompile(`(?i)我(?:们|这边)?[^，。！？,.!?；;\s]{0,2}?(?:来|负责|争取|` + soonWords + `|` + dueWords + `)[^，。！？,.!?；;]{0,4}?` + actionVerb)
+	// deadlineRe is a task with an explicit deadline: "周五之前上线".
+	deadlineRe = regexp.MustCompile(`(?i)(?:` + dueWords + `)\s*(?:之前|以前|前)[^，。！？,.!?；;]{0,8}?` + actionVerb)
+	dueRe      = regexp.MustCompile(`(?:` + dueWords + `)\s*(?:之前|以前|前)?|` + soonWords)
+	// declineRe rules out refusals, past events, guesses, opinions,
+	// conditionals and questions.
+	declineRe = regexp.MustCompile(`不会|不能|没|来不及|搞不定|已经|从来|去年|昨天|发现|觉得|认为|感觉|估计|可能|也许|听说|如果|要是|[吗么？?]\s*$`)
+	// clauseRe splits text into clauses, keeping the closing punctuation so
+	// questions can be told apart.
+	clauseRe  = regexp.MustCompile(`[^，。！？,!?；;\n]+[，。！？,!?；;\n]*`)
+	mentionRe = regexp.MustCompile(`@\S+[\s\x{2005}]*`)
+)
+
+// buildActionItems finds commitments in msgs. Each clause yields at most one
+// item; refusals and questions are skipped.
+func buildActionItems(msgs []chatlog.Message) []ActionItem {
+	var out []ActionItem
+	for _, m := range msgs {
+		if m.MsgType != 0 && m.MsgType != 1 {
+			continue
+		}
+		text := strings.TrimSpace(firstNonEmptyString(m.Content, m.Text))
+		if text == "" {
+			continue
+		}
+		for _, clause := range clauseRe.FindAllString(text, -1) {
+			if declineRe.MatchString(strings.TrimSpace(clause)) {
+				continue
+			}
+			clause = strings.TrimSpace(strings.TrimRight(clause, "，。！,!；;\n"))
+			task := clipRunes(stripMentions(clause), 80)
+			if task == "" {
+				continue
+			}
+			owner := senderDisplay(m)
+			switch {
+			case commitRe.MatchString(clause):
+			case deadlineRe.MatchString(clause):
+				if name := addressee(m, clause); name != "" {
+					owner = name
+				}
+			default:
+				continue
+			}
+			item := ActionItem{
+				Owner:  owner,
+				Task:   task,
+				Due:    strings.TrimSpace(dueRe.FindString(clause)),
+				Sender: senderDisplay(m),
+				Source: clipRunes(text, 160),
+			}
+			if t := messageTime(m); !t.IsZero() {
+				item.At = t.Format("15:04")
+			}
+			out = append(out, item)
+			if len(out) == maxActionItems {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// addressee returns the member an "@name 你…" clause hands the task to.
+func addressee(m chatlog.Message, clause string) string {
+	if !strings.Contains(clause, "你") {
+		return ""
+	}
+	for _, name := range m.Mentions {
+		if name = strings.TrimSpace(name); name != "" && strings.Contains(clause, "@"+name) {
+			return name
+		}
+	}
+	if len(m.Mentions) == 1 {
+		return strings.TrimSpace(m.Mentions[0])
+	}
+	return ""
+}
+
+func stripMentions(s string) string {
+	return strings.TrimSpace(mentionRe.ReplaceAllString(s, ""))
+}
+
+func clipRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package summarize
+
+import (
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Reasons a message is taken for an announcement.
+const (
+	AnnounceNotice   = "群公告"
+	AnnounceAll      = "@所有人"
+	AnnounceAdmin    = "管理员长消息"
+	AnnounceMentions = "多人提及"
+)
+
+const (
+	// subTypeGroupNotice is the app message subtype WeChat uses to post a
+	// group notice into the chat.
+	subTypeGroupNotice = 87
+	maxAnnouncements   = 10
+	announceMaxRunes   = 1000
+)
+
+// AnnounceRules decides which messages are pinned as announcements. Group
+// notices and "@所有人" messages always are.
+type AnnounceRules struct {
+	// Admins are sender ids or display names whose long messages count as
+	// announcements.
+	Admins []string
+	// MinChars is how long an admin message must be; 0 means 150.
+	MinChars int
+	// MinMentions pins messages mentioning at least this many members; 0
+	// means 5.
+	MinMentions int
+}
+
+// Announcement is a message pinned to the top of the day page.
+type Announcement struct {
+	At     string `json:"at,omitempty"`
+	Sender string `json:"sender"`
+	Text   string `json:"text"`
+	// Reason is one of the Announce* constants.
+	Reason string `json:"reason"`
+}
+
+// build picks the day's announcements in message order, up to
+// maxAnnouncements; quoted replies are skipped.
+func (r AnnounceRules) build(msgs []chatlog.Message) []Announcement {
+	minChars, minMentions := r.MinChars, r.MinMentions
+	if minChars <= 0 {
+		minChars = 150
+	}
+	if minMentions <= 0 {
+		minMentions = 5
+	}
+	var out []Announcement
+	for _, m := range msgs {
+		text := strings.TrimSpace(firstNonEmptyString(m.Content, m.Text))
+		reason := ""
+		switch {
+		case m.MsgType == 10000:
+			if strings.Contains(text, "群公告") {
+				reason = AnnounceNotice
+			}
+		case m.MsgType == chatlog.TypeApp && m.SubType == subTypeGroupNotice:
+			reason = AnnounceNotice
+			if m.Share != nil {
+				text = strings.TrimSpace(firstNonEmptyString(m.Share.Desc, m.Share.Title, text))
+			}
+		case m.MsgType != 0 && m.MsgType != 1:
+		case strings.Contains(text, "@所有人") || strings.Contains(text, "@All"):
+			reason = AnnounceAll
+		case len(uniqueStrings(m.Mentions)) >= minMentions:
+			reason = AnnounceMentions
+		case runeLen(text) >= minChars && r.isAdmin(m):
+			reason = AnnounceAdmin
+		}
+		if reason == "" || text == "" {
+			continue
+		}
+		a := Announcement{Sender: senderDisplay(m), Text: clipRunes(text, announceMaxRunes), Reason: reason}
+		if t := messageTime(m); !t.IsZero() {
+			a.At = t.Format("15:04")
+		}
+		out = append(out, a)
+		if len(out) == maxAnnouncements {
+			break
+		}
+	}
+	return out
+}
+
+func (r AnnounceRules) isAdmin(m chatlog.Message) bool {
+	for _, who := range []string{m.Sender, m.From, m.SenderName, m.Nickname} {
+		if who != "" && containsFold(r.Admins, who) {
+			return true
+		}
+	}
+	return false
+}
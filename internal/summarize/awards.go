@@ -0,0 +1,215 @@
+package summarize
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/i18n"
+)
+
+// Contribution is one sender's helpful activity on a day: the input of the
+// weekly awards.
+type Contribution struct {
+	Name string `json:"name"`
+	// Answers counts questions they resolved; ResponseMinutes sums how long
+	// those answers took.
+	Answers         int     `json:"answers,omitempty"`
+	ResponseMinutes float64 `json:"responseMinutes,omitempty"`
+	// Links counts links they were first to share that day.
+	Links int `json:"links,omitempty"`
+	// Thanks counts positive messages that quoted or mentioned them.
+	Thanks int `json:"thanks,omitempty"`
+}
+
+// contribTracker accumulates Contributions while scanning messages.
+type contribTracker map[string]*Contribution
+
+func (t contribTracker) get(name string) *Contribution {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+	c := t[name]
+	if c == nil {
+		c = &Contribution{Name: name}
+		t[name] = c
+	}
+	return c
+}
+
+func (t contribTracker) link(name string) {
+	if c := t.get(name); c != nil {
+		c.Links++
+	}
+}
+
+// thank credits each person a positive message quoted or mentioned, once.
+func (t contribTracker) thank(from string, to []string) {
+	seen := map[string]bool{}
+	for _, name := range to {
+		name = strings.TrimSpace(name)
+		if name == "" || name == from || seen[name] {
+			continue
+		}
+		seen[name] = true
+		t.get(name).Thanks++
+	}
+}
+
+func (t contribTracker) answers(rd ReplyDebt) {
+	for _, item := range rd.Resolved {
+		if c := t.get(item.AnsweredBy); c != nil {
+			c.Answers++
+			c.ResponseMinutes += item.ResponseMinutes
+		}
+	}
+}
+
+func (t contribTracker) list() []Contribution {
+	out := make([]Contribution, 0, len(t))
+	for _, c := range t {
+		c.ResponseMinutes = roundTo(c.ResponseMinutes, 1)
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Award weights: an answer counts three points, a thank-you two and a
+// shared link one. Answers also earn up to fastAnswerBonus more each the
+// faster they came, falling to nothing at fastAnswerMinutes.
+const (
+	answerPoints      = 3
+	thanksPoints      = 2
+	linkPoints        = 1
+	fastAnswerBonus   = 2
+	fastAnswerMinutes = 60
+	// minMVPScore keeps a quiet week from crowning anyone.
+	minMVPScore = 5
+)
+
+// ContributorScore is one member's week under the award scoring model.
+type ContributorScore struct {
+	Name    string `json:"name"`
+	Answers int    `json:"answers"`
+	Links   int    `json:"links"`
+	Thanks  int    `json:"thanks"`
+	// AvgResponseMinutes is how long their answers took on average.
+	AvgResponseMinutes float64 `json:"avgResponseMinutes,omitempty"`
+	Score              float64 `json:"score"`
+}
+
+// Award names a winner and says why.
+type Award struct {
+	Title  string `json:"title"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Awards are a week's MVP and category awards with the ranking they came
+// from.
+type Awards struct {
+	MVP     *Award             `json:"mvp,omitempty"`
+	Awards  []Award            `json:"awards,omitempty"`
+	Ranking []ContributorScore `json:"ranking,omitempty"`
+}
+
+// WeeklyAwards scores the contributions in sums and picks the MVP plus the
+// best answerer, link sharer, most appreciated and fastest responder. A
+// member wins at most one category besides MVP.
+func WeeklyAwards(sums []Summary) Awards {
+	byName := map[string]*ContributorScore{}
+	minutes := map[string]float64{}
+	for _, s := range sums {
+		for _, c := range s.Contributions {
+			cs := byName[c.Name]
+			if cs == nil {
+				cs = &ContributorScore{Name: c.Name}
+				byName[c.Name] = cs
+			}
+			cs.Answers += c.Answers
+			cs.Links += c.Links
+			cs.Thanks += c.Thanks
+			minutes[c.Name] += c.ResponseMinutes
+		}
+	}
+	var ranking []ContributorScore
+	for name, cs := range byName {
+		speed := 0.0
+		if cs.Answers > 0 {
+			cs.AvgResponseMinutes = roundTo(minutes[name]/float64(cs.Answers), 1)
+			speed = math.Max(0, 1-cs.AvgResponseMinutes/fastAnswerMinutes)
+		}
+		cs.Score = roundTo(float64(cs.Answers)*(answerPoints+fastAnswerBonus*speed)+
+			float64(cs.Thanks*thanksPoints)+float64(cs.Links*linkPoints), 1)
+		if cs.Score > 0 {
+			ranking = append(ranking, *cs)
+		}
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		return ranking[i].Name < ranking[j].Name
+	})
+	a := Awards{Ranking: ranking}
+	if len(a.Ranking) > 10 {
+		a.Ranking = a.Ranking[:10]
+	}
+	if len(ranking) == 0 || ranking[0].Score < minMVPScore {
+		return a
+	}
+	mvp := ranking[0]
+	a.MVP = &Award{Title: i18n.T("本周 MVP"), Name: mvp.Name, Reason: i18n.Tf("综合得分 %.1f：解答 %d 个问题，分享 %d 条链接，收到 %d 次好评", mvp.Score, mvp.Answers, mvp.Links, mvp.Thanks)}
+
+	won := map[string]bool{mvp.Name: true}
+	pick := func(title string, better func(a, b ContributorScore) bool, ok func(ContributorScore) bool, reason func(ContributorScore) string) {
+		var best *ContributorScore
+		for i := range ranking {
+			c := ranking[i]
+			if won[c.Name] || !ok(c) {
+				continue
+			}
+			if best == nil || better(c, *best) {
+				best = &ranking[i]
+			}
+		}
+		if best != nil {
+			won[best.Name] = true
+			a.Awards = append(a.Awards, Award{Title: title, Name: best.Name, Reason: reason(*best)})
+		}
+	}
+	pick(i18n.T("答疑之星"),
+		func(a, b ContributorScore) bool { return a.Answers > b.Answers },
+		func(c ContributorScore) bool { return c.Answers >= 2 },
+		func(c ContributorScore) string { return i18n.Tf("解答了 %d 个问题", c.Answers) })
+	pick(i18n.T("最佳分享"),
+		func(a, b ContributorScore) bool { return a.Links > b.Links },
+		func(c ContributorScore) bool { return c.Links >= 2 },
+		func(c ContributorScore) string { return i18n.Tf("首发分享了 %d 条链接", c.Links) })
+	pick(i18n.T("人气之星"),
+		func(a, b ContributorScore) bool { return a.Thanks > b.Thanks },
+		func(c ContributorScore) bool { return c.Thanks >= 2 },
+		func(c ContributorScore) string { return i18n.Tf("被点赞、感谢 %d 次", c.Thanks) })
+	pick(i18n.T("闪电回复"),
+		func(a, b ContributorScore) bool { return a.AvgResponseMinutes < b.AvgResponseMinutes },
+		func(c ContributorScore) bool { return c.Answers >= 2 },
+		func(c ContributorScore) string {
+			return i18n.Tf("%d 次解答平均 %.1f 分钟内回复", c.Answers, c.AvgResponseMinutes)
+		})
+	return a
+}
+
+// Lines renders the awards as one line each, MVP first, for notifications.
+func (a Awards) Lines() []string {
+	var out []string
+	if a.MVP != nil {
+		out = append(out, fmt.Sprintf("🏆 %s：%s（%s）", a.MVP.Title, a.MVP.Name, a.MVP.Reason))
+	}
+	for _, aw := range a.Awards {
+		out = append(out, fmt.Sprintf("🎖 %s：%s（%s）", aw.Title, aw.Name, aw.Reason))
+	}
+	return out
+}
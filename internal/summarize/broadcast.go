@@ -0,0 +1,166 @@
+package summarize
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/i18n"
+)
+
+// replyWindow is how soon another member has to speak for a message to
+// count as replied to.
+const replyWindow = 10 * time.Minute
+
+// BroadcastSlot aggregates one hour of the day over several days.
+type BroadcastSlot struct {
+	Hour      int     `json:"hour"`
+	Messages  int     `json:"messages"`
+	Replied   int     `json:"replied"`
+	ReplyRate float64 `json:"replyRate"`
+	// Score weighs the reply rate by how busy the hour is, so a quiet hour
+	// with one lucky reply does not win.
+	Score float64 `json:"score"`
+}
+
+// Broadcast suggests when to post announcements, from the hourly message
+// volume (who is reading) and reply rate (who reacts) of past days.
+type Broadcast struct {
+	Days  int               `json:"days"`
+	Slots [24]BroadcastSlot `json:"slots"`
+	// Best lists the recommended hours, best first.
+	Best []int `json:"best,omitempty"`
+}
+
+// BroadcastAdvice combines the hourly statistics of sums and picks the k
+// best hours. Hours with less than 2% of the busiest hour's traffic are
+// never recommended.
+func BroadcastAdvice(sums []Summary, k int) Broadcast {
+	var b Broadcast
+	maxMessages := 0
+	for _, s := range sums {
+		if s.TotalMessages == 0 {
+			continue
+		}
+		b.Days++
+		for h := 0; h < 24; h++ {
+			b.Slots[h].Messages += s.HourlyHistogram[h]
+			b.Slots[h].Replied += s.HourlyReplied[h]
+		}
+	}
+	for h := range b.Slots {
+		b.Slots[h].Hour = h
+		if b.Slots[h].Messages > maxMessages {
+			maxMessages = b.Slots[h].Messages
+		}
+	}
+	if maxMessages == 0 {
+		return b
+	}
+	candidates := make([]int, 0, 24)
+	for h := range b.Slots {
+		sl := &b.Slots[h]
+		if sl.Messages == 0 {
+			continue
+		}
+		sl.ReplyRate = roundTo(float64(sl.Replied)/float64(sl.Messages), 2)
+		sl.Score = roundTo(sl.ReplyRate*math.Sqrt(float64(sl.Messages)/float64(maxMessages)), 3)
+		if float64(sl.Messages) >= 0.02*float64(maxMessages) {
+			candidates = append(candidates, h)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return b.Slots[candidates[i]].Score > b.Slots[candidates[j]].Score
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	b.Best = candidates
+	return b
+}
+
+// Tip renders the best hour as a one-line suggestion, or "" without data.
+func (b Broadcast) Tip() string {
+	if len(b.Best) == 0 {
+		return ""
+	}
+	sl := b.Slots[b.Best[0]]
+	return i18n.Tf("%02d:00–%02d:00（近 %d 天该时段 %d 条消息，回复率 %.0f%%）",
+		sl.Hour, (sl.Hour+1)%24, b.Days, sl.Messages, sl.ReplyRate*100)
+}
+
+// hourlyReplied counts, per hour, the messages that another member followed
+// within replyWindow or quoted later. Quotes are matched on the quoted
+// message's second and sender, since chatlog reports Reference.Time in
+// whatever format the message itself was stored with.
+func hourlyReplied(msgs []chatlog.Message) [24]int {
+	var out [24]int
+	times := make([]time.Time, len(msgs))
+	for i, m := range msgs {
+		times[i] = messageTime(m)
+	}
+	quoted := map[string]bool{}
+	for _, m := range msgs {
+		if m.Reference == nil {
+			continue
+		}
+		if t := parseMessageTime(m.Reference.Time); !t.IsZero() {
+			for _, who := range []string{m.Reference.Sender, m.Reference.SenderName} {
+				if who != "" {
+					quoted[quoteKey(t, who)] = true
+				}
+			}
+		}
+	}
+	for i, m := range msgs {
+		if times[i].IsZero() || m.MsgType == 10000 {
+			continue
+		}
+		replied := len(quoted) > 0 && (quoted[quoteKey(times[i], m.Sender)] || quoted[quoteKey(times[i], m.SenderName)])
+		sender := senderDisplay(m)
+		for j := i + 1; j < len(msgs) && !replied; j++ {
+			if times[j].IsZero() {
+				continue
+			}
+			if times[j].Sub(times[i]) > replyWindow {
+				break
+			}
+			if other := senderDisplay(msgs[j]); other != "" && other != sender && msgs[j].MsgType != 10000 {
+				replied = true
+			}
+		}
+		if replied {
+			out[times[i].Hour()]++
+		}
+	}
+	return out
+}
+
+func quoteKey(t time.Time, sender string) string {
+	return strconv.FormatInt(t.Unix(), 10) + "\x00" + sender
+}
+
+// parseMessageTime reads a chatlog time string: unix seconds or
+// milliseconds, RFC 3339, or a local "2006-01-02 15:04:05".
+func parseMessageTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if ts > 1_000_000_000_000 {
+			ts = ts / 1000
+		}
+		return time.Unix(ts, 0).Local()
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t
+	}
+	return time.Time{}
+}
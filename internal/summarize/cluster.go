@@ -0,0 +1,268 @@
+package summarize
+
+import (
+	"math"
+	"sort"
+)
+
+// TopicEmbedding groups the day's messages by meaning instead of by shared
+// keywords: messages are embedded, clustered with k-means on cosine
+// similarity, and each cluster is named after its most distinctive tokens.
+// The zero value keeps the keyword topics.
+type TopicEmbedding struct {
+	// Embed returns one vector per text, in order. Errors fall back to the
+	// keyword topics.
+	Embed func(texts []string) ([][]float64, error)
+	// Clusters is k; 0 means 8. Clusters of fewer than three messages are
+	// dropped and at most five topics are kept, as with keyword topics.
+	Clusters int
+	// MaxMessages bounds how many messages are embedded, sampled evenly over
+	// the day; 0 means 500.
+	MaxMessages int
+}
+
+const clusterIterations = 20
+
+// topics clusters texts, whose kept tokens are in tokens, or returns ok
+// false when embedding is disabled or fails.
+func (e TopicEmbedding) topics(texts []string, tokens [][]string) ([]Topic, bool) {
+	if e.Embed == nil {
+		return nil, false
+	}
+	// Messages without a single kept token ("哈哈", stickers) carry no topic.
+	var idxs []int
+	for i := range texts {
+		if len(tokens[i]) > 0 {
+			idxs = append(idxs, i)
+		}
+	}
+	max := e.MaxMessages
+	if max <= 0 {
+		max = 500
+	}
+	if len(idxs) > max {
+		sampled := make([]int, max)
+		for i := range sampled {
+			sampled[i] = idxs[i*len(idxs)/max]
+		}
+		idxs = sampled
+	}
+	if len(idxs) < 3 {
+		return nil, false
+	}
+	in := make([]string, len(idxs))
+	for i, idx := range idxs {
+		in[i] = texts[idx]
+	}
+	vecs, err := e.Embed(in)
+	if err != nil || len(vecs) != len(in) {
+		return nil, false
+	}
+	for i := range vecs {
+		vecs[i] = unitVector(vecs[i])
+	}
+	k := e.Clusters
+	if k <= 0 {
+		k = 8
+	}
+	if k > len(vecs)/3 {
+		k = len(vecs) / 3
+	}
+	if k < 1 {
+		k = 1
+	}
+	assign, centroids := kmeans(vecs, k)
+
+	// Token document frequency over the embedded messages, for naming.
+	df := map[string]int{}
+	for _, idx := range idxs {
+		for tok := range tokenSet(tokens[idx]) {
+			df[tok]++
+		}
+	}
+	members := make([][]int, k)
+	for i, c := range assign {
+		members[c] = append(members[c], i)
+	}
+	sort.SliceStable(members, func(i, j int) bool { return len(members[i]) > len(members[j]) })
+
+	var topics []Topic
+	used := map[string]bool{}
+	for _, group := range members {
+		if len(topics) >= 5 || len(group) < 3 {
+			break
+		}
+		cf := map[string]int{}
+		for _, i := range group {
+			for tok := range tokenSet(tokens[idxs[i]]) {
+				cf[tok]++
+			}
+		}
+		keys := distinctiveTokens(cf, df, len(idxs))
+		for len(keys) > 0 && used[keys[0]] {
+			keys = keys[1:]
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if len(keys) > 5 {
+			keys = keys[:5]
+		}
+		used[keys[0]] = true
+
+		c := centroids[assign[group[0]]]
+		best, bestSim := group[0], -2.0
+		for _, i := range group {
+			if sim := dot(vecs[i], c); sim > bestSim {
+				best, bestSim = i, sim
+			}
+		}
+		topics = append(topics, Topic{
+			Name:           keys[0],
+			Keywords:       keys,
+			Count:          len(group),
+			Representative: texts[idxs[best]],
+			Clustered:      true,
+		})
+	}
+	if len(topics) == 0 {
+		return nil, false
+	}
+	return topics, true
+}
+
+// distinctiveTokens ranks tokens found in at least two of a cluster's
+// messages by how much more common they are there than over the whole day
+// of n messages.
+func distinctiveTokens(cf, df map[string]int, n int) []string {
+	type scored struct {
+		tok   string
+		score float64
+	}
+	var list []scored
+	for tok, c := range cf {
+		if c < 2 {
+			continue
+		}
+		list = append(list, scored{tok, float64(c) * math.Log(float64(n+1)/float64(df[tok]+1))})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score > list[j].score
+		}
+		return list[i].tok < list[j].tok
+	})
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = s.tok
+	}
+	return out
+}
+
+// kmeans clusters unit vectors into k groups by cosine similarity. Seeds
+// are picked farthest-first starting from the vector nearest the mean, so
+// the result is deterministic.
+func kmeans(vecs [][]float64, k int) ([]int, [][]float64) {
+	centroids := [][]float64{vecs[nearest(vecs, unitVector(meanVector(vecs, nil)))]}
+	for len(centroids) < k {
+		far, farSim := 0, 2.0
+		for i, v := range vecs {
+			closest := -2.0
+			for _, c := range centroids {
+				closest = math.Max(closest, dot(v, c))
+			}
+			if closest < farSim {
+				far, farSim = i, closest
+			}
+		}
+		centroids = append(centroids, vecs[far])
+	}
+
+	assign := make([]int, len(vecs))
+	for iter := 0; iter < clusterIterations; iter++ {
+		changed := iter == 0
+		for i, v := range vecs {
+			if c := nearest(centroids, v); c != assign[i] {
+				assign[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		for c := range centroids {
+			var group []int
+			for i, a := range assign {
+				if a == c {
+					group = append(group, i)
+				}
+			}
+			// An emptied cluster keeps its previous centroid.
+			if len(group) > 0 {
+				centroids[c] = unitVector(meanVector(vecs, group))
+			}
+		}
+	}
+	return assign, centroids
+}
+
+// nearest is the index of the vector in vecs most similar to v.
+func nearest(vecs [][]float64, v []float64) int {
+	best, bestSim := 0, -2.0
+	for i, c := range vecs {
+		if sim := dot(c, v); sim > bestSim {
+			best, bestSim = i, sim
+		}
+	}
+	return best
+}
+
+// meanVector averages vecs, or only those at idxs when given.
+func meanVector(vecs [][]float64, idxs []int) []float64 {
+	if idxs == nil {
+		idxs = make([]int, len(vecs))
+		for i := range idxs {
+			idxs[i] = i
+		}
+	}
+	mean := make([]float64, len(vecs[idxs[0]]))
+	for _, i := range idxs {
+		for d, x := range vecs[i] {
+			if d < len(mean) {
+				mean[d] += x
+			}
+		}
+	}
+	for d := range mean {
+		mean[d] /= float64(len(idxs))
+	}
+	return mean
+}
+
+func unitVector(v []float64) []float64 {
+	norm := math.Sqrt(dot(v, v))
+	out := make([]float64, len(v))
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func dot(a, b []float64) float64 {
+	s := 0.0
+	for i := 0; i < len(a) && i < len(b); i++ {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func tokenSet(tokens []string) map[string]bool {
+	set := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		set[t] = true
+	}
+	return set
+}
@@ -0,0 +1,100 @@
+package summarize
+
+import (
+	"math"
+	"sort"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Comparison puts the day next to earlier days: yesterday, the same weekday
+// a week before, and who joined or dropped out of the conversation since
+// yesterday. A missing earlier day leaves its part empty.
+type Comparison struct {
+	Yesterday *Delta `json:"yesterday,omitempty"`
+	LastWeek  *Delta `json:"lastWeek,omitempty"`
+	// NewSenders spoke today but not yesterday; GoneSenders spoke yesterday
+	// but not today. Both are sorted by today's/yesterday's message count.
+	NewSenders  []string `json:"newSenders,omitempty"`
+	GoneSenders []string `json:"goneSenders,omitempty"`
+}
+
+// Delta compares the day's volume with one earlier day.
+type Delta struct {
+	Date     string `json:"date"`
+	Messages int    `json:"messages"`
+	Senders  int    `json:"senders"`
+	// MessagesChange and SendersChange are today minus the earlier day;
+	// MessagesPercent is relative to the earlier day (0 when it had none).
+	MessagesChange  int     `json:"messagesChange"`
+	MessagesPercent float64 `json:"messagesPercent"`
+	SendersChange   int     `json:"sendersChange"`
+}
+
+// Earlier is a previous day's messages for Compare.
+type Earlier struct {
+	Date     string
+	Messages []chatlog.Message
+}
+
+// Compare builds the comparison of msgs with yesterday and the same weekday
+// last week; pass nil for days without data.
+func Compare(msgs []chatlog.Message, yesterday, lastWeek *Earlier) Comparison {
+	today := activeSenders(msgs)
+	var c Comparison
+	if yesterday != nil {
+		c.Yesterday = newDelta(msgs, today, yesterday)
+		before := activeSenders(yesterday.Messages)
+		c.NewSenders = sendersMissing(today, before)
+		c.GoneSenders = sendersMissing(before, today)
+	}
+	if lastWeek != nil {
+		c.LastWeek = newDelta(msgs, today, lastWeek)
+	}
+	return c
+}
+
+func newDelta(msgs []chatlog.Message, today map[string]int, e *Earlier) *Delta {
+	d := &Delta{
+		Date:     e.Date,
+		Messages: len(e.Messages),
+		Senders:  len(activeSenders(e.Messages)),
+	}
+	d.MessagesChange = len(msgs) - d.Messages
+	d.SendersChange = len(today) - d.Senders
+	if d.Messages > 0 {
+		d.MessagesPercent = math.Round(float64(d.MessagesChange)/float64(d.Messages)*1000) / 10
+	}
+	return d
+}
+
+// activeSenders counts messages per sender, leaving out system notices.
+func activeSenders(msgs []chatlog.Message) map[string]int {
+	out := map[string]int{}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		if s := senderDisplay(m); s != "" {
+			out[s]++
+		}
+	}
+	return out
+}
+
+// sendersMissing returns the senders of a absent from b, busiest first.
+func sendersMissing(a, b map[string]int) []string {
+	var out []string
+	for s := range a {
+		if _, ok := b[s]; !ok {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a[out[i]] != a[out[j]] {
+			return a[out[i]] > a[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
@@ -0,0 +1,316 @@
+package summarize
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Entity kinds, also the keys of extra patterns in NewEntityExtractor.
+const (
+	EntityPhone     = "phone"
+	EntityEmail     = "email"
+	EntityIP        = "ip"
+	EntityErrorCode = "errorCode"
+	EntityTicket    = "ticket"
+)
+
+// entityTopN is how many values of each kind a summary keeps.
+const entityTopN = 10
+
+// Entities counts structured values mentioned in the day's messages, each
+// by the number of messages that mention it. Phone numbers and emails are
+// masked before counting so the summary does not publish them.
+type Entities struct {
+	Phones     []KV `json:"phones,omitempty"`
+	Emails     []KV `json:"emails,omitempty"`
+	IPs        []KV `json:"ips,omitempty"`
+	ErrorCodes []KV `json:"errorCodes,omitempty"`
+	Tickets    []KV `json:"tickets,omitempty"`
+}
+
+// Empty reports whether nothing was found.
+func (e Entities) Empty() bool {
+	return len(e.Phones)+len(e.Emails)+len(e.IPs)+len(e.ErrorCodes)+len(e.Tickets) == 0
+}
+
+// entityPattern finds one kind of entity; value turns a submatch into the
+// counted value, or "" to drop it. A nil value counts the first capture
+// group, or the whole match when there is none.
+type entityPattern struct {
+	kind  string
+	re    *regexp.Regexp
+	value func(m []string) string
+}
+
+var (
+	mobileRe   = regexp.MustCompile(`(?:\+?86[- ]?)?1[3-9]\d[- ]?\d{4}[- ]?\d{4}`)
+	landlineRe = regexp.MustCompile(`0\d{2,3}-\d{7,8}`)
+	emailRe    = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	ipv4Re     = regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}`)
+	jiraRe     = regexp.MustCompile(`\b([A-Z][A-Z0-9]{1,9})-\d{2,6}\b`)
+)
+
+// notTickets are PROJECT-123 lookalikes that are standards, algorithms,
+// model names or error code families rather than ticket keys. Single-digit
+// numbers (GPT-4, UTF-8) are not matched at all.
+var notTickets = map[string]bool{
+	"ORA": true, "TNS": true, "PLS": true, "IMP": true, "EXP": true, "ERR": true,
+	"HTTP": true, "UTF": true, "ISO": true, "GB": true, "RFC": true, "CVE": true,
+	"SHA": true, "AES": true, "RSA": true, "MD": true, "COVID": true, "IPV": true,
+	"GPT": true, "GLM": true, "QWEN": true, "LLAMA": true,
+}
+
+var httpReasons = `Bad Request|Unauthorized|Forbidden|Not Found|Method Not Allowed|Request Timeout|Conflict|Payload Too Large|Too Many Requests|Internal Server Error|Bad Gateway|Service Unavailable|Gateway Time-?out`
+
+var builtinEntityPatterns = []entityPattern{
+	{EntityErrorCode, regexp.MustCompile(`\b(?:ORA|TNS|PLS|IMP|EXP)-\d{5}\b`), nil},
+	{EntityErrorCode, regexp.MustCompile(`\bERR_[A-Z0-9_]{3,}\b`), nil},
+	{EntityErrorCode, regexp.MustCompile(`\bE(?:CONNREFUSED|CONNRESET|CONNABORTED|TIMEDOUT|NOENT|ACCES|PERM|ADDRINUSE|PIPE|HOSTUNREACH|NETUNREACH|NOTFOUND|AI_AGAIN|MFILE|NOSPC)\b`), nil},
+	{EntityErrorCode, regexp.MustCompile(`\b0x[0-9A-Fa-f]{8}\b`), func(m []string) string { return "0x" + strings.ToUpper(m[0][2:]) }},
+	{EntityErrorCode, regexp.MustCompile(`\b[A-Z][A-Za-z0-9]+(?:Exception|Error)\b`), nil},
+	{EntityErrorCode, regexp.MustCompile(`(?i)(?:\bHTTP(?:/\d(?:\.\d)?)?|\bstatus(?: code)?|状态码|返回码)\s*[:：=]?\s*([1-5]\d{2})\b`), httpStatus},
+	{EntityErrorCode, regexp.MustCompile(`\b([45]\d{2})\s*(?:` + httpReasons + `)`), httpStatus},
+	{EntityErrorCode, regexp.MustCompile(`(?:报错|错误)\s*([45]\d{2})\b`), httpStatus},
+	{EntityErrorCode, regexp.MustCompile(`(?i)(错误码|错误代码|error\s*code|err(?:or)?code|errno|exit\s*code|退出码)\s*[:：=]?\s*(-?[A-Za-z0-9_.]*[A-Za-z0-9])`), labelledCode},
+	{EntityTicket, regexp.MustCompile(`(?i)(?:工单|单号|\bticket|\bissue)\s*(?:号|编号|no\.?|id)?\s*[:：#]?\s*([A-Za-z0-9][A-Za-z0-9-]{3,23})`), ticketNumber},
+}
+
+// ticketNumber keeps labelled ticket numbers that contain a digit, so
+// "ticket system" is not read as ticket "SYSTEM".
+func ticketNumber(m []string) string {
+	if !strings.ContainsAny(m[1], "0123456789") {
+		return ""
+	}
+	return strings.ToUpper(m[1])
+}
+
+func httpStatus(m []string) string {
+	return "HTTP " + m[1]
+}
+
+// labelledCode turns "错误码: 10001" style matches into "code 10001",
+// "errno 2" or "exit 137". Values need a digit or must look like a
+// constant (INVALID_TOKEN), which drops prose such as "error code is".
+func labelledCode(m []string) string {
+	label, value := m[1], m[2]
+	if !strings.ContainsAny(value, "0123456789") && (len(value) < 3 || strings.ToUpper(value) != value) {
+		return ""
+	}
+	switch l := strings.ToLower(strings.Join(strings.Fields(label), " ")); {
+	case l == "errno":
+		return "errno " + value
+	case l == "exit code" || l == "exitcode" || l == "退出码":
+		return "exit " + value
+	}
+	return "code " + value
+}
+
+// EntityExtractor finds entities in message text. The zero value is not
+// usable; a nil *EntityExtractor uses the built-in patterns.
+type EntityExtractor struct {
+	patterns []entityPattern
+}
+
+// NewEntityExtractor adds extra regular expressions per kind to the built-in
+// patterns, e.g. {"ticket": ["INC\\d{7}"]}. A pattern with a capture group
+// counts the first group instead of the whole match.
+func NewEntityExtractor(extra map[string][]string) (*EntityExtractor, error) {
+	x := &EntityExtractor{patterns: append([]entityPattern(nil), builtinEntityPatterns...)}
+	kinds := make([]string, 0, len(extra))
+	for k := range extra {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		switch kind {
+		case EntityPhone, EntityEmail, EntityIP, EntityErrorCode, EntityTicket:
+		default:
+			return nil, fmt.Errorf("unknown entity kind %q", kind)
+		}
+		for _, expr := range extra[kind] {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("entity pattern %q: %w", expr, err)
+			}
+			x.patterns = append(x.patterns, entityPattern{kind: kind, re: re})
+		}
+	}
+	return x, nil
+}
+
+var defaultEntityExtractor = &EntityExtractor{patterns: builtinEntityPatterns}
+
+// Extract returns the entities in text by kind, each value once.
+func (x *EntityExtractor) Extract(text string) map[string][]string {
+	if x == nil {
+		x = defaultEntityExtractor
+	}
+	found := map[string][]string{}
+	seen := map[string]bool{}
+	add := func(kind, v string) {
+		if v == "" || seen[kind+"\x00"+v] {
+			return
+		}
+		seen[kind+"\x00"+v] = true
+		found[kind] = append(found[kind], v)
+	}
+
+	for _, loc := range mobileRe.FindAllStringIndex(text, -1) {
+		if digitBounded(text, loc[0], loc[1]) {
+			add(EntityPhone, maskPhone(text[loc[0]:loc[1]]))
+		}
+	}
+	for _, loc := range landlineRe.FindAllStringIndex(text, -1) {
+		if digitBounded(text, loc[0], loc[1]) {
+			add(EntityPhone, maskPhone(text[loc[0]:loc[1]]))
+		}
+	}
+	for _, m := range emailRe.FindAllString(text, -1) {
+		add(EntityEmail, maskEmail(m))
+	}
+	for _, loc := range ipv4Re.FindAllStringIndex(text, -1) {
+		if ip := text[loc[0]:loc[1]]; ipBounded(text, loc[0], loc[1]) && net.ParseIP(ip) != nil {
+			add(EntityIP, ip)
+		}
+	}
+	for _, m := range jiraRe.FindAllStringSubmatch(text, -1) {
+		if !notTickets[strings.TrimRight(m[1], "0123456789")] {
+			add(EntityTicket, m[0])
+		}
+	}
+	for _, p := range x.patterns {
+		for _, m := range p.re.FindAllStringSubmatch(text, -1) {
+			var v string
+			switch {
+			case p.value != nil:
+				v = p.value(m)
+			case len(m) > 1:
+				v = m[1]
+			default:
+				v = m[0]
+			}
+			add(p.kind, strings.TrimSpace(v))
+		}
+	}
+	return found
+}
+
+// digitBounded reports that text[start:end] is not part of a longer digit
+// run, so order numbers and timestamps are not taken for phone numbers.
+func digitBounded(text string, start, end int) bool {
+	return (start == 0 || !isDigit(text[start-1])) && (end == len(text) || !isDigit(text[end]))
+}
+
+// ipBounded is digitBounded for dotted quads: also not part of a longer
+// dotted number such as a version string (v1.2.3.4, 1.2.3.4.5).
+func ipBounded(text string, start, end int) bool {
+	if start > 0 {
+		if c := text[start-1]; isDigit(c) || c == '.' || c == 'v' || c == 'V' {
+			return false
+		}
+	}
+	if end < len(text) {
+		if c := text[end]; isDigit(c) || (c == '.' && end+1 < len(text) && isDigit(text[end+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// maskPhone keeps the first three and last four digits of a mobile number
+// (138****5678) and the area code and last four of a landline.
+func maskPhone(s string) string {
+	if i := strings.IndexByte(s, '-'); i > 0 && s[0] == '0' {
+		local := s[i+1:]
+		return s[:i] + "-****" + local[len(local)-4:]
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	digits = digits[len(digits)-11:]
+	return digits[:3] + "****" + digits[7:]
+}
+
+// maskEmail keeps the first character of the local part and the domain.
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	return s[:1] + "***" + strings.ToLower(s[at:])
+}
+
+// MaskContacts masks every phone number and email address in text the way
+// Extract reports them, leaving the rest of the text as is.
+func MaskContacts(text string) string {
+	return ReplaceContacts(text, func(kind, s string) string {
+		if kind == EntityEmail {
+			return maskEmail(s)
+		}
+		return maskPhone(s)
+	})
+}
+
+// ReplaceContacts replaces every phone number (EntityPhone) and email
+// address (EntityEmail) in text with repl(kind, match).
+func ReplaceContacts(text string, repl func(kind, s string) string) string {
+	phone := func(s string) string { return repl(EntityPhone, s) }
+	text = replaceBounded(mobileRe, text, phone)
+	text = replaceBounded(landlineRe, text, phone)
+	return emailRe.ReplaceAllStringFunc(text, func(s string) string { return repl(EntityEmail, s) })
+}
+
+// replaceBounded replaces the digitBounded matches of re in text with repl.
+func replaceBounded(re *regexp.Regexp, text string, repl func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if !digitBounded(text, loc[0], loc[1]) {
+			continue
+		}
+		b.WriteString(text[last:loc[0]])
+		b.WriteString(repl(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// buildEntities counts the entities of msgs; system notices are skipped.
+func buildEntities(x *EntityExtractor, msgs []chatlog.Message) Entities {
+	counts := map[string]map[string]int{}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		text := strings.TrimSpace(firstNonEmptyString(m.Content, m.Text))
+		if text == "" {
+			continue
+		}
+		for kind, values := range x.Extract(text) {
+			if counts[kind] == nil {
+				counts[kind] = map[string]int{}
+			}
+			for _, v := range values {
+				counts[kind][v]++
+			}
+		}
+	}
+	return Entities{
+		Phones:     topK(counts[EntityPhone], entityTopN),
+		Emails:     topK(counts[EntityEmail], entityTopN),
+		IPs:        topK(counts[EntityIP], entityTopN),
+		ErrorCodes: topK(counts[EntityErrorCode], entityTopN),
+		Tickets:    topK(counts[EntityTicket], entityTopN),
+	}
+}
@@ -0,0 +1,122 @@
+package summarize
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Escalation carries questions that stay unanswered too long into the
+// following days' reports until someone answers them.
+type Escalation struct {
+	// After is how long a question may wait before it is escalated.
+	After time.Duration
+	// CarryDays is how many days after it was asked a question is carried;
+	// 0 means 7.
+	CarryDays int
+	// Owner is who escalated questions are assigned to, if anyone.
+	Owner string
+}
+
+// Escalate updates rd, the reply debt of day built from msgs, with the
+// escalation rules. Today's outstanding questions waiting longer than After
+// are escalated; earlier ones, the previous report's Escalated and
+// Outstanding, are carried forward while still unanswered and within
+// CarryDays, or moved to LateResolved when a message of msgs answers them.
+// Ages are measured at the day's last message, or its end when it had none.
+func (e Escalation) Escalate(rd *ReplyDebt, day string, earlier []ReplyItem, msgs []chatlog.Message) {
+	if e.After <= 0 {
+		return
+	}
+	carryDays := e.CarryDays
+	if carryDays <= 0 {
+		carryDays = 7
+	}
+	start, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return
+	}
+	now := start.Add(24*time.Hour - time.Second)
+	var last time.Time
+	for _, m := range msgs {
+		if t := messageTime(m); t.After(last) {
+			last = t
+		}
+	}
+	if !last.IsZero() {
+		now = last
+	}
+
+	seen := map[string]bool{}
+	var escalated []ReplyItem
+	escalate := func(item ReplyItem) {
+		if item.EscalatedOn == "" {
+			item.EscalatedOn = day
+		}
+		if item.Owner == "" {
+			item.Owner = e.Owner
+		}
+		escalated = append(escalated, item)
+	}
+	for _, item := range earlier {
+		if item.ID == "" || seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		if item.Date == "" || item.Date >= day {
+			continue
+		}
+		asked, err := time.Parse(time.RFC3339, item.AskedAt)
+		if err != nil {
+			continue
+		}
+		if d, err := time.ParseInLocation("2006-01-02", item.Date, time.Local); err != nil || start.Sub(d) > time.Duration(carryDays)*24*time.Hour {
+			continue
+		}
+		if answer, ok := answeredBy(item, msgs); ok {
+			item.Answer = trimQuestionText(answer)
+			item.AnsweredBy = senderDisplay(answer)
+			if t := messageTime(answer); !t.IsZero() {
+				item.ResponseMinutes = roundTo(t.Sub(asked).Minutes(), 1)
+			}
+			item.AgeMinutes = 0
+			rd.LateResolved = append(rd.LateResolved, item)
+			continue
+		}
+		item.AgeMinutes = roundTo(now.Sub(asked).Minutes(), 1)
+		if item.AgeMinutes >= e.After.Minutes() {
+			escalate(item)
+		}
+	}
+	for i := range rd.Outstanding {
+		item := &rd.Outstanding[i]
+		item.Date = day
+		if item.AgeMinutes >= e.After.Minutes() && !seen[item.ID] {
+			seen[item.ID] = true
+			escalate(*item)
+		}
+	}
+	// oldest first
+	sort.SliceStable(escalated, func(i, j int) bool { return escalated[i].AskedAt < escalated[j].AskedAt })
+	rd.Escalated = escalated
+}
+
+// answeredBy returns the first message in msgs that answers the earlier
+// question item, by the same rules as same-day questions.
+func answeredBy(item ReplyItem, msgs []chatlog.Message) (chatlog.Message, bool) {
+	q := &questionStatus{
+		Message:  chatlog.Message{SenderName: item.Questioner, Content: strings.TrimSuffix(item.Question, "…")},
+		Mentions: item.Mentions,
+	}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		if matchesQuestionResponse(m, q, firstNonEmptyString(m.Content, m.Text)) {
+			return m, true
+		}
+	}
+	return chatlog.Message{}, false
+}
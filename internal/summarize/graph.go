@@ -0,0 +1,130 @@
+package summarize
+
+import (
+	"sort"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// InteractionGraph is the day's directed "who talks to whom" network: an
+// edge From→To counts @-mentions of To and quoted replies to To's messages.
+type InteractionGraph struct {
+	Nodes []GraphNode `json:"nodes,omitempty"`
+	Edges []GraphEdge `json:"edges,omitempty"`
+}
+
+// GraphNode is one participant. In and Out are weighted degrees;
+// Centrality is the share of other participants they interacted with
+// (degree centrality, 0..1).
+type GraphNode struct {
+	Name       string  `json:"name"`
+	In         int     `json:"in"`
+	Out        int     `json:"out"`
+	Centrality float64 `json:"centrality"`
+}
+
+// GraphEdge is a directed, weighted interaction.
+type GraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Mentions int    `json:"mentions,omitempty"`
+	Replies  int    `json:"replies,omitempty"`
+	Weight   int    `json:"weight"`
+}
+
+// buildInteractionGraph collects mention and quote edges between senders.
+// Self-interactions and system notices are ignored. Nodes are ordered by
+// centrality, edges by weight.
+func buildInteractionGraph(msgs []chatlog.Message) InteractionGraph {
+	type key struct{ from, to string }
+	edges := map[key]*GraphEdge{}
+	add := func(from, to string, reply bool) {
+		to = strings.TrimSpace(to)
+		if from == "" || to == "" || from == to {
+			return
+		}
+		e := edges[key{from, to}]
+		if e == nil {
+			e = &GraphEdge{From: from, To: to}
+			edges[key{from, to}] = e
+		}
+		if reply {
+			e.Replies++
+		} else {
+			e.Mentions++
+		}
+		e.Weight++
+	}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		from := senderDisplay(m)
+		for _, to := range uniqueStrings(m.Mentions) {
+			add(from, to, false)
+		}
+		if ref := m.Reference; ref != nil {
+			add(from, firstNonEmptyString(ref.SenderName, ref.Sender), true)
+		}
+	}
+	if len(edges) == 0 {
+		return InteractionGraph{}
+	}
+
+	var g InteractionGraph
+	nodes := map[string]*GraphNode{}
+	neighbors := map[string]map[string]bool{}
+	node := func(name string) *GraphNode {
+		n := nodes[name]
+		if n == nil {
+			n = &GraphNode{Name: name}
+			nodes[name] = n
+			neighbors[name] = map[string]bool{}
+		}
+		return n
+	}
+	for _, e := range edges {
+		node(e.From).Out += e.Weight
+		node(e.To).In += e.Weight
+		neighbors[e.From][e.To] = true
+		neighbors[e.To][e.From] = true
+		g.Edges = append(g.Edges, *e)
+	}
+	for name, n := range nodes {
+		if len(nodes) > 1 {
+			n.Centrality = float64(len(neighbors[name])) / float64(len(nodes)-1)
+		}
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		a, b := g.Nodes[i], g.Nodes[j]
+		if a.Centrality != b.Centrality {
+			return a.Centrality > b.Centrality
+		}
+		if a.In+a.Out != b.In+b.Out {
+			return a.In+a.Out > b.In+b.Out
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return g
+}
+
+func firstNonEmptyString(vals ...string) string {
+	for _, v := range vals {
+		if s := strings.TrimSpace(v); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package summarize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Lexicon holds group-specific word lists merged on top of the built-in
+// stopwords and sentiment lexicons.
+type Lexicon struct {
+	Stopwords []string `json:"stopwords"`
+	Positive  []string `json:"positive"`
+	Negative  []string `json:"negative"`
+	// Emoji maps bracket emoji names (e.g. "旺柴") to a sentiment weight;
+	// positive weights count as positive signal, negative ones as negative.
+	Emoji map[string]float64 `json:"emoji"`
+}
+
+// LoadLexicon reads a Lexicon from a JSON file.
+func LoadLexicon(path string) (Lexicon, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Lexicon{}, fmt.Errorf("read lexicon: %w", err)
+	}
+	var lex Lexicon
+	if err := json.Unmarshal(b, &lex); err != nil {
+		return Lexicon{}, fmt.Errorf("parse lexicon: %w", err)
+	}
+	return lex, nil
+}
+
+// Merge returns l extended with the entries of o; o wins on emoji conflicts.
+func (l Lexicon) Merge(o Lexicon) Lexicon {
+	out := Lexicon{
+		Stopwords: append(append([]string(nil), l.Stopwords...), o.Stopwords...),
+		Positive:  append(append([]string(nil), l.Positive...), o.Positive...),
+		Negative:  append(append([]string(nil), l.Negative...), o.Negative...),
+	}
+	if len(l.Emoji) > 0 || len(o.Emoji) > 0 {
+		out.Emoji = make(map[string]float64, len(l.Emoji)+len(o.Emoji))
+		for k, v := range l.Emoji {
+			out.Emoji[k] = v
+		}
+		for k, v := range o.Emoji {
+			out.Emoji[k] = v
+		}
+	}
+	return out
+}
+
+// wordSets is the effective lexicon used during one Build.
+type wordSets struct {
+	stopEN   map[string]bool
+	stopCN   map[string]bool
+	positive []string
+	negative []string
+	emoji    map[string]float64
+}
+
+// newWordSets merges extra into the built-in sets; dict adds the stopwords
+// only the dict tokenizer needs.
+func newWordSets(extra Lexicon, dict bool) wordSets {
+	ws := wordSets{
+		stopEN:   make(map[string]bool, len(stopwordEN)),
+		stopCN:   make(map[string]bool, len(stopwordCN)),
+		positive: append([]string(nil), positiveLexicons...),
+		negative: append([]string(nil), negativeLexicons...),
+		emoji:    make(map[string]float64, len(positiveEmojiSet)+len(negativeEmojiSet)),
+	}
+	for k := range stopwordEN {
+		ws.stopEN[k] = true
+	}
+	for k := range stopwordCN {
+		ws.stopCN[k] = true
+	}
+	if dict {
+		for k := range dictStopwordCN {
+			ws.stopCN[k] = true
+		}
+	}
+	for k := range positiveEmojiSet {
+		ws.emoji[k] = 0.5
+	}
+	for k := range negativeEmojiSet {
+		ws.emoji[k] = -0.5
+	}
+	for _, w := range extra.Stopwords {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		if isASCIIWord(w) {
+			ws.stopEN[strings.ToLower(w)] = true
+		} else {
+			ws.stopCN[w] = true
+		}
+	}
+	ws.positive = appendNonEmpty(ws.positive, extra.Positive)
+	ws.negative = appendNonEmpty(ws.negative, extra.Negative)
+	for k, v := range extra.Emoji {
+		if k = strings.Trim(strings.TrimSpace(k), "[]"); k != "" {
+			ws.emoji[k] = v
+		}
+	}
+	return ws
+}
+
+func appendNonEmpty(dst, src []string) []string {
+	for _, s := range src {
+		if s = strings.TrimSpace(s); s != "" {
+			dst = append(dst, strings.ToLower(s))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,80 @@
+package summarize
+
+import (
+	"net/url"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// IsShare reports whether m is a shared link card (an app message with a
+// title or URL); files, red packets and transfers are app messages too
+// but not shares.
+func IsShare(m chatlog.Message) bool {
+	if m.Share == nil || (m.Share.Title == "" && m.Share.URL == "") {
+		return false
+	}
+	return !m.IsFile() && !IsRedPacket(m) && !IsTransfer(m)
+}
+
+// linkTrailers is punctuation chat text glues onto the end of links.
+const linkTrailers = ".,;:!?)]}）。，；！？》」"
+
+// trackingParams are query parameters that only record where a link was
+// shared from; prefixes end with "_".
+var trackingParams = []string{
+	"utm_", "from", "spm", "share_", "vd_source", "is_from", "isappinstalled",
+	"scene", "chksm", "sessionid", "clicktime", "enterid", "ref", "ref_src",
+	"fbclid", "gclid", "msclkid", "igshid", "xhsshare", "xsec_source",
+	"app_platform", "timestamp", "unique_k", "bbid", "ts", "si",
+	// WeChat article share parameters; __biz, mid, idx and sn identify
+	// the article.
+	"mpshare", "sharer_", "srcid", "xtrack", "exportkey", "pass_ticket",
+	"wx_header", "poc_token", "ascene", "subscene", "devicetype", "nettype",
+	"abtest_cookie", "realreporttime",
+}
+
+// NormalizeURL returns the form links are counted and deduplicated by:
+// trailing punctuation, tracking parameters (utm_*, from=, spm= and the
+// like), fragments, default ports and trailing slashes are dropped, the
+// scheme and host lowercased and the remaining query parameters sorted.
+// Fragments that look like client-side routes ("#/post/1", "#!/post/1")
+// are kept.
+func NormalizeURL(raw string) string {
+	raw = strings.TrimRight(strings.TrimSpace(raw), linkTrailers)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	if !strings.HasPrefix(u.Fragment, "/") && !strings.HasPrefix(u.Fragment, "!/") {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if u.RawQuery != "" {
+		// Re-encoding sorts the parameters, so their order does not matter.
+		q := u.Query()
+		for key := range q {
+			if isTrackingParam(key) {
+				q.Del(key)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	return u.String()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range trackingParams {
+		if key == p || (strings.HasSuffix(p, "_") && strings.HasPrefix(key, p)) {
+			return true
+		}
+	}
+	return false
+}
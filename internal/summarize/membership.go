@@ -0,0 +1,129 @@
+package summarize
+
+import (
+	"regexp"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Membership event kinds.
+const (
+	MemberJoin   = "join"
+	MemberLeave  = "leave"
+	MemberRemove = "remove"
+	GroupRename  = "rename"
+)
+
+// MemberEvent is one membership system notice: someone joined, left or was
+// removed, or the group was renamed (Name holds the new group name).
+type MemberEvent struct {
+	Kind string `json:"kind"`
+	At   string `json:"at,omitempty"`
+	Who  string `json:"who,omitempty"`
+	// By is the inviter, remover or renamer; "你" is the exporting account.
+	By   string `json:"by,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Membership collects the day's membership changes. Build only counts the
+// day itself. Cumulative (net change since the first archived day, through
+// this day) and Total (Cumulative plus the configured group size on that
+// first day, when one is set) depend on the other days, so they are not
+// stored: the generator fills them from the ordered day list when it
+// renders the page, and site/membership.json carries the series.
+type Membership struct {
+	Joined     int           `json:"joined"`
+	Left       int           `json:"left"`
+	Events     []MemberEvent `json:"events,omitempty"`
+	Cumulative int           `json:"-"`
+	Total      int           `json:"-"`
+}
+
+// Net returns joins minus departures.
+func (m Membership) Net() int { return m.Joined - m.Left }
+
+var (
+	inviteRegexp = regexp.MustCompile(`^"?(.*?)"?\s*邀请\s*"?(.+?)"?\s*加入了群聊`)
+	qrJoinRegexp = regexp.MustCompile(`^"?(.*?)"?\s*通过扫描\s*"?(.*?)"?\s*分享的二维码加入群聊`)
+	removeRegexp = regexp.MustCompile(`^"?(.*?)"?\s*将\s*"?(.+?)"?\s*移出了群聊`)
+	leaveRegexp  = regexp.MustCompile(`^"?(.*?)"?\s*退出了群聊`)
+	// renameRegexp covers 修改群名为, 修改了群名称为 and 将群名称修改为.
+	renameRegexp = regexp.MustCompile(`^"?(.*?)"?\s*(?:修改了?群名称?为|将群名称?修改为)\s*[“"](.*)[”"]`)
+)
+
+// ParseMemberEvents recognises membership notices in a system message. An
+// invite of several people ("A、B") yields one event per person.
+func ParseMemberEvents(m chatlog.Message) []MemberEvent {
+	if m.MsgType != 10000 {
+		return nil
+	}
+	text := strings.TrimSpace(m.Content)
+	var kind string
+	var match []string
+	for _, p := range []struct {
+		kind string
+		re   *regexp.Regexp
+	}{
+		{GroupRename, renameRegexp},
+		{MemberJoin, inviteRegexp},
+		{MemberRemove, removeRegexp},
+		{MemberLeave, leaveRegexp},
+	} {
+		if match = p.re.FindStringSubmatch(text); match != nil {
+			kind = p.kind
+			break
+		}
+	}
+	if match == nil {
+		if qr := qrJoinRegexp.FindStringSubmatch(text); qr != nil {
+			// The joiner comes first here, the sharer second.
+			kind, match = MemberJoin, []string{qr[0], qr[2], qr[1]}
+		} else {
+			return nil
+		}
+	}
+	by := youOr(match[1])
+	if kind == MemberLeave {
+		return []MemberEvent{{Kind: kind, Who: by}}
+	}
+	if kind == GroupRename {
+		return []MemberEvent{{Kind: kind, By: by, Name: match[2]}}
+	}
+	var out []MemberEvent
+	for _, who := range strings.Split(match[2], "、") {
+		if who = strings.Trim(strings.TrimSpace(who), `"`); who != "" {
+			out = append(out, MemberEvent{Kind: kind, Who: who, By: by})
+		}
+	}
+	return out
+}
+
+func youOr(name string) string {
+	if name = strings.TrimSpace(name); name == "" || name == "你" {
+		return "你"
+	}
+	return name
+}
+
+func buildMembership(msgs []chatlog.Message) Membership {
+	var out Membership
+	for _, m := range msgs {
+		events := ParseMemberEvents(m)
+		at := ""
+		if t := messageTime(m); !t.IsZero() {
+			at = t.Format("15:04")
+		}
+		for _, ev := range events {
+			ev.At = at
+			switch ev.Kind {
+			case MemberJoin:
+				out.Joined++
+			case MemberLeave, MemberRemove:
+				out.Left++
+			}
+			out.Events = append(out.Events, ev)
+		}
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+package summarize
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"wechat-view/internal/chatlog"
+)
+
+//go:embed t2s.txt
+var builtinT2S string
+
+// Normalizer folds spelling variants before keywords, topics and links are
+// counted, so "開會", "开会" and "ｏｋ" / "ok" land in the same bucket. It only
+// affects the summary; raw data and the transcript keep the original text.
+type Normalizer struct {
+	// Simplify maps traditional characters to simplified ones.
+	Simplify bool
+	// HalfWidth maps full-width ASCII (Ａ-Ｚ, ０-９, ！…) and the ideographic
+	// space to their half-width forms.
+	HalfWidth bool
+	// LowerURLs lowercases the scheme and host of http(s) links; paths and
+	// queries are case-sensitive and left alone.
+	LowerURLs bool
+
+	t2s map[rune]rune
+}
+
+// NewNormalizer returns a Normalizer seeded with the embedded
+// traditional-to-simplified table.
+func NewNormalizer(simplify, halfWidth, lowerURLs bool) *Normalizer {
+	n := &Normalizer{Simplify: simplify, HalfWidth: halfWidth, LowerURLs: lowerURLs, t2s: make(map[rune]rune)}
+	_ = n.Load(strings.NewReader(builtinT2S))
+	return n
+}
+
+// Load merges a character table into the traditional-to-simplified map.
+// Lines are either whitespace-separated "繁简" pairs or OpenCC
+// TSCharacters.txt entries ("繁<TAB>简 [简…]", first candidate wins);
+// later entries override earlier ones.
+func (n *Normalizer) Load(r io.Reader) error {
+	if n.t2s == nil {
+		n.t2s = make(map[rune]rune)
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if from, to, ok := strings.Cut(line, "\t"); ok {
+			n.add(from, strings.Fields(to))
+			continue
+		}
+		for _, pair := range strings.Fields(line) {
+			from, size := utf8.DecodeRuneInString(pair)
+			n.add(string(from), []string{pair[size:]})
+		}
+	}
+	return sc.Err()
+}
+
+// LoadFile merges a character table file, see Load.
+func (n *Normalizer) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read t2s table: %w", err)
+	}
+	defer f.Close()
+	if err := n.Load(f); err != nil {
+		return fmt.Errorf("parse t2s table: %w", err)
+	}
+	return nil
+}
+
+func (n *Normalizer) add(from string, to []string) {
+	if len(to) == 0 || utf8.RuneCountInString(from) != 1 || utf8.RuneCountInString(to[0]) != 1 {
+		return
+	}
+	f, _ := utf8.DecodeRuneInString(from)
+	t, _ := utf8.DecodeRuneInString(to[0])
+	if f != t {
+		n.t2s[f] = t
+	}
+}
+
+// String returns s with the enabled normalizations applied.
+func (n *Normalizer) String(s string) string {
+	if n == nil || s == "" {
+		return s
+	}
+	if n.Simplify || n.HalfWidth {
+		s = strings.Map(n.mapRune, s)
+	}
+	if n.LowerURLs {
+		s = lowerURLs(s)
+	}
+	return s
+}
+
+func (n *Normalizer) mapRune(r rune) rune {
+	if n.HalfWidth {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xfee0
+		}
+	}
+	if n.Simplify {
+		if t, ok := n.t2s[r]; ok {
+			return t
+		}
+	}
+	return r
+}
+
+// Messages returns copies of msgs with Content, Text and the shared link
+// normalized; msgs itself is not modified.
+func (n *Normalizer) Messages(msgs []chatlog.Message) []chatlog.Message {
+	if n == nil || (!n.Simplify && !n.HalfWidth && !n.LowerURLs) {
+		return msgs
+	}
+	out := make([]chatlog.Message, len(msgs))
+	for i, m := range msgs {
+		m.Content = n.String(m.Content)
+		m.Text = n.String(m.Text)
+		if m.Share != nil {
+			share := *m.Share
+			share.Title = n.String(share.Title)
+			if n.LowerURLs {
+				share.URL = lowerURL(share.URL)
+			}
+			m.Share = &share
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// lowerURLs lowercases the scheme and host of every http(s) link in s.
+func lowerURLs(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	fields := strings.Fields(s)
+	for _, f := range fields {
+		lower := strings.ToLower(f)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			continue
+		}
+		if u := lowerURL(f); u != f {
+			s = strings.Replace(s, f, u, 1)
+		}
+	}
+	return s
+}
+
+func lowerURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return raw
+	}
+	// Rebuild by prefix so the rest of the link keeps its exact spelling.
+	prefix := u.Scheme + "://" + u.Host
+	if len(raw) < len(prefix) || !strings.EqualFold(raw[:len(prefix)], prefix) {
+		return raw
+	}
+	return strings.ToLower(prefix) + raw[len(prefix):]
+}
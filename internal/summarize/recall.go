@@ -0,0 +1,89 @@
+package summarize
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+// recallWindow bounds how far back the original of a recall is searched;
+// WeChat only allows recalling within two minutes.
+const recallWindow = 3 * time.Minute
+
+var recallRegexp = regexp.MustCompile(`^\s*"?(.*?)"?\s*撤回了一条消息`)
+
+// Recall is one 撤回 notice, paired with the original message when the
+// fetched data still contains it.
+type Recall struct {
+	Who        string `json:"who"`
+	At         string `json:"at"`
+	Original   string `json:"original,omitempty"`
+	OriginalAt string `json:"originalAt,omitempty"`
+}
+
+// RecalledBy returns who recalled a message if m is a recall notice.
+func RecalledBy(m chatlog.Message) (string, bool) {
+	if m.MsgType != 10000 {
+		return "", false
+	}
+	match := recallRegexp.FindStringSubmatch(m.Content)
+	if match == nil {
+		return "", false
+	}
+	who := strings.TrimSpace(match[1])
+	if who == "" {
+		who = "你"
+	}
+	return who, true
+}
+
+// buildRecalls finds recall notices and pairs each with the latest earlier
+// message by the same person inside recallWindow. A message is paired at
+// most once.
+func buildRecalls(msgs []chatlog.Message) []Recall {
+	var out []Recall
+	used := map[int]bool{}
+	for i, m := range msgs {
+		who, ok := RecalledBy(m)
+		if !ok {
+			continue
+		}
+		at := messageTime(m)
+		rc := Recall{Who: who}
+		if !at.IsZero() {
+			rc.At = at.Format("15:04:05")
+		}
+		for j := i - 1; j >= 0; j-- {
+			prev := msgs[j]
+			pt := messageTime(prev)
+			if !at.IsZero() && !pt.IsZero() && at.Sub(pt) > recallWindow {
+				break
+			}
+			if used[j] || prev.MsgType == 10000 || !sameSender(prev, who) {
+				continue
+			}
+			used[j] = true
+			rc.Original = trimQuestionText(prev)
+			if rc.Original == "" {
+				rc.Original = "[非文本消息]"
+			}
+			if !pt.IsZero() {
+				rc.OriginalAt = pt.Format("15:04:05")
+			}
+			break
+		}
+		out = append(out, rc)
+	}
+	return out
+}
+
+// sameSender matches the display name quoted in a recall notice; "你"
+// stands for the exporting account.
+func sameSender(m chatlog.Message, who string) bool {
+	if who == "你" {
+		return m.IsSelf
+	}
+	return who == senderDisplay(m) || who == m.Nickname || who == m.SenderName
+}
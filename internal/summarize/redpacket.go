@@ -0,0 +1,89 @@
+package summarize
+
+import (
+	"strings"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+// App message subtypes used by WeChat for money.
+const (
+	subTypeTransfer  = 2000
+	subTypeRedPacket = 2001
+)
+
+// Red packet rain: at least rainCount packets within rainWindow.
+const (
+	rainCount  = 3
+	rainWindow = 30 * time.Minute
+)
+
+// RedPackets counts red packets (红包) and transfers (转账) of the day.
+type RedPackets struct {
+	Count     int `json:"count"`
+	Transfers int `json:"transfers"`
+	// Claims counts "领取了红包" system notices.
+	Claims  int  `json:"claims"`
+	Senders []KV `json:"senders,omitempty"`
+	// Rain is set when packets cluster; RainAt is the HH:MM the densest
+	// burst started and RainCount its size.
+	Rain      bool   `json:"rain,omitempty"`
+	RainAt    string `json:"rainAt,omitempty"`
+	RainCount int    `json:"rainCount,omitempty"`
+}
+
+// IsRedPacket reports whether m sends a red packet. Besides the app message
+// subtype it accepts the "[红包]" text some exports produce.
+func IsRedPacket(m chatlog.Message) bool {
+	if m.MsgType == chatlog.TypeApp && m.SubType == subTypeRedPacket {
+		return true
+	}
+	return m.MsgType == 1 && strings.HasPrefix(strings.TrimSpace(m.Content), "[红包]")
+}
+
+// IsTransfer reports whether m is a money transfer.
+func IsTransfer(m chatlog.Message) bool {
+	if m.MsgType == chatlog.TypeApp && m.SubType == subTypeTransfer {
+		return true
+	}
+	return m.MsgType == 1 && strings.HasPrefix(strings.TrimSpace(m.Content), "[转账]")
+}
+
+func buildRedPackets(msgs []chatlog.Message) RedPackets {
+	var rp RedPackets
+	senders := map[string]int{}
+	var times []time.Time
+	for _, m := range msgs {
+		switch {
+		case IsRedPacket(m):
+			rp.Count++
+			if s := senderDisplay(m); s != "" {
+				senders[s]++
+			}
+			if t := messageTime(m); !t.IsZero() {
+				times = append(times, t)
+			}
+		case IsTransfer(m):
+			rp.Transfers++
+		case m.MsgType == 10000 && strings.Contains(m.Content, "领取了") && strings.Contains(m.Content, "红包"):
+			rp.Claims++
+		}
+	}
+	rp.Senders = topK(senders, 5)
+	// densest burst: for each packet count the ones within rainWindow after it
+	for i := range times {
+		n := 1
+		for j := i + 1; j < len(times) && times[j].Sub(times[i]) <= rainWindow; j++ {
+			n++
+		}
+		if n > rp.RainCount {
+			rp.RainCount, rp.RainAt = n, times[i].Format("15:04")
+		}
+	}
+	rp.Rain = rp.RainCount >= rainCount
+	if rp.Count == 0 {
+		rp.RainAt, rp.RainCount = "", 0
+	}
+	return rp
+}
@@ -0,0 +1,76 @@
+package summarize
+
+import (
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+// ReplyMatch is the similarity fallback for question/answer pairing: a
+// message that neither quotes nor mentions the asker still answers an open
+// question when it shares enough of the question's keywords. The zero value
+// disables it, keeping only mention and quote matching.
+type ReplyMatch struct {
+	// Threshold is the least similarity, 0..1, that counts as an answer;
+	// 0 disables the fallback.
+	Threshold float64
+	// Window is how soon after the question the answer has to come; 0
+	// means 30 minutes.
+	Window time.Duration
+	// Similarity scores a question against a candidate answer, e.g. by
+	// embedding cosine. Nil uses keyword overlap: the share of the
+	// question's keywords the answer repeats, with at least two shared.
+	Similarity func(question, answer string) float64
+}
+
+func (r ReplyMatch) window() time.Duration {
+	if r.Window > 0 {
+		return r.Window
+	}
+	return 30 * time.Minute
+}
+
+// matches reports whether msg, sent at msgTime with text, answers q by
+// similarity. Questions themselves and the asker's own messages never do.
+func (r ReplyMatch) matches(msg chatlog.Message, q *questionStatus, text string, msgTime time.Time, tokens func(string) []string) bool {
+	if r.Threshold <= 0 || msg.IsQuestion || text == "" {
+		return false
+	}
+	questioner := q.NormalizedQuestioner
+	if questioner == "" {
+		questioner = normalizeName(senderDisplay(q.Message))
+	}
+	if responder := normalizeName(senderDisplay(msg)); responder == "" || responder == questioner {
+		return false
+	}
+	if q.AskedAt.IsZero() || msgTime.IsZero() || msgTime.Sub(q.AskedAt) > r.window() {
+		return false
+	}
+	question := firstNonEmptyString(q.Message.Content, q.Message.Text)
+	if r.Similarity != nil {
+		return r.Similarity(question, text) >= r.Threshold
+	}
+	return keywordOverlap(tokens(question), tokens(text)) >= r.Threshold
+}
+
+// keywordOverlap is the share of the question's distinct keywords found in
+// the answer, or 0 when they share fewer than two.
+func keywordOverlap(question, answer []string) float64 {
+	qs := map[string]bool{}
+	for _, t := range question {
+		qs[t] = true
+	}
+	if len(qs) == 0 {
+		return 0
+	}
+	shared := map[string]bool{}
+	for _, t := range answer {
+		if qs[t] {
+			shared[t] = true
+		}
+	}
+	if len(shared) < 2 {
+		return 0
+	}
+	return float64(len(shared)) / float64(len(qs))
+}
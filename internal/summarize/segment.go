@@ -0,0 +1,148 @@
+package summarize
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed dict.txt
+var builtinDict string
+
+// DictTokenizer segments Chinese text with a jieba-style approach: build a
+// DAG of dictionary words over each Han run and pick the route with the
+// highest unigram log-probability. ASCII words are passed through.
+type DictTokenizer struct {
+	freq    map[string]float64
+	total   float64
+	maxRune int
+}
+
+// NewDictTokenizer returns a segmenter seeded with the embedded dictionary.
+func NewDictTokenizer() *DictTokenizer {
+	d := &DictTokenizer{freq: make(map[string]float64)}
+	_ = d.Load(strings.NewReader(builtinDict))
+	return d
+}
+
+// Load merges "word [freq]" lines into the dictionary. Missing frequencies
+// default to a value high enough for the word to win over single runes.
+func (d *DictTokenizer) Load(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		word := fields[0]
+		freq := 1000.0
+		if len(fields) > 1 {
+			if v, err := strconv.ParseFloat(fields[1], 64); err == nil && v > 0 {
+				freq = v
+			}
+		}
+		d.AddWord(word, freq)
+	}
+	return sc.Err()
+}
+
+// AddWord registers or overrides a single dictionary entry.
+func (d *DictTokenizer) AddWord(word string, freq float64) {
+	word = strings.TrimSpace(word)
+	if word == "" || freq <= 0 {
+		return
+	}
+	if old, ok := d.freq[word]; ok {
+		d.total -= old
+	}
+	d.freq[word] = freq
+	d.total += freq
+	if n := runeLen(word); n > d.maxRune {
+		d.maxRune = n
+	}
+}
+
+// Tokenize implements Tokenizer.
+func (d *DictTokenizer) Tokenize(text string) []string {
+	out := []string{}
+	han := []rune{}
+	other := strings.Builder{}
+	flushHan := func() {
+		if len(han) > 0 {
+			out = append(out, d.cut(han)...)
+			han = han[:0]
+		}
+	}
+	flushOther := func() {
+		if other.Len() > 0 {
+			out = append(out, asciiTokens(other.String())...)
+			other.Reset()
+		}
+	}
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			flushOther()
+			han = append(han, r)
+			continue
+		}
+		flushHan()
+		other.WriteRune(r)
+	}
+	flushHan()
+	flushOther()
+	return out
+}
+
+// cut runs the max-probability route over one contiguous Han sequence.
+func (d *DictTokenizer) cut(seq []rune) []string {
+	n := len(seq)
+	if n == 0 {
+		return nil
+	}
+	logTotal := math.Log(math.Max(d.total, 1))
+	minLog := math.Log(1) - logTotal
+	// route[i] holds the best score from i to the end and the end index of the
+	// first word on that path.
+	type step struct {
+		score float64
+		end   int
+	}
+	route := make([]step, n+1)
+	for i := n - 1; i >= 0; i-- {
+		best := step{score: math.Inf(-1)}
+		limit := n
+		if d.maxRune > 0 && i+d.maxRune < limit {
+			limit = i + d.maxRune
+		}
+		for j := i + 1; j <= limit; j++ {
+			word := string(seq[i:j])
+			freq, ok := d.freq[word]
+			var score float64
+			switch {
+			case ok:
+				score = math.Log(freq) - logTotal
+			case j == i+1:
+				score = minLog
+			default:
+				continue
+			}
+			score += route[j].score
+			if score > best.score {
+				best = step{score: score, end: j}
+			}
+		}
+		route[i] = best
+	}
+	words := make([]string, 0, n/2+1)
+	for i := 0; i < n; {
+		j := route[i].end
+		words = append(words, string(seq[i:j]))
+		i = j
+	}
+	return words
+}
@@ -0,0 +1,48 @@
+package summarize
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestDictTokenizerPrefersDictionaryWords(t *testing.T) {
+	seg := NewDictTokenizer()
+	got := seg.Tokenize("这个问题用大模型解决")
+	want := []string{"这个", "问题", "用", "大模型", "解决"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("分词结果不符: %v", got)
+	}
+}
+
+func TestDictStopwordsOnlyApplyToDictTokenizer(t *testing.T) {
+	msgs := []chatlog.Message{{Content: "觉得 觉得 觉得"}}
+	has := func(sum Summary) bool {
+		for _, kv := range sum.Keywords {
+			if kv.Key == "觉得" {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(BuildSummary(msgs)) {
+		t.Fatal("默认分词的关键词不应变化")
+	}
+	if has(Builder{Tokenizer: NewDictTokenizer()}.Build(msgs)) {
+		t.Fatal("词典分词应过滤口头语")
+	}
+}
+
+func TestDictTokenizerUserDict(t *testing.T) {
+	seg := NewDictTokenizer()
+	if err := seg.Load(strings.NewReader("氛围编程 5000\n")); err != nil {
+		t.Fatalf("加载用户词典失败: %v", err)
+	}
+	got := seg.Tokenize("聊聊氛围编程 vibe coding")
+	want := []string{"聊", "聊", "氛围编程", "vibe", "coding"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("分词结果不符: %v", got)
+	}
+}
@@ -0,0 +1,66 @@
+package summarize
+
+import "math"
+
+// moodThreshold is the net signal an hour needs before it counts as
+// positive or negative; weaker hours are neutral and never start a turn.
+const moodThreshold = 1.0
+
+// HourSentiment sums the positive and negative signals of one hour's
+// messages (words and weighted emojis, see Lexicon).
+type HourSentiment struct {
+	Positive float64 `json:"positive"`
+	Negative float64 `json:"negative"`
+}
+
+// Net is Positive minus Negative.
+func (h HourSentiment) Net() float64 { return h.Positive - h.Negative }
+
+// Mood labels used by MoodTurn.
+const (
+	MoodPositive = "positive"
+	MoodNegative = "negative"
+)
+
+// MoodTurn marks the hour where the mood flipped compared with the previous
+// non-neutral hour.
+type MoodTurn struct {
+	Hour int    `json:"hour"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func moodOf(h HourSentiment) string {
+	switch net := h.Net(); {
+	case net >= moodThreshold:
+		return MoodPositive
+	case net <= -moodThreshold:
+		return MoodNegative
+	}
+	return ""
+}
+
+// buildMoodTurns walks the hours in order and reports every flip between
+// positive and negative, skipping neutral hours in between.
+func buildMoodTurns(hours [24]HourSentiment) []MoodTurn {
+	var out []MoodTurn
+	last := ""
+	for h, hs := range hours {
+		mood := moodOf(hs)
+		if mood == "" {
+			continue
+		}
+		if last != "" && mood != last {
+			out = append(out, MoodTurn{Hour: h, From: last, To: mood})
+		}
+		last = mood
+	}
+	return out
+}
+
+func roundSentiment(hours *[24]HourSentiment) {
+	for i := range hours {
+		hours[i].Positive = math.Round(hours[i].Positive*100) / 100
+		hours[i].Negative = math.Round(hours[i].Negative*100) / 100
+	}
+}
@@ -1,6 +1,8 @@
 package summarize
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"net/url"
@@ -10,21 +12,102 @@ import (
 	"unicode"
 
 	"wechat-view/internal/chatlog"
+	"wechat-view/internal/i18n"
 )
 
 type Summary struct {
-	TotalMessages   int        `json:"totalMessages"`
-	UniqueSenders   int        `json:"uniqueSenders"`
-	TopSenders      []KV       `json:"topSenders"`
-	TopLinks        []string   `json:"topLinks"`
-	HourlyHistogram [24]int    `json:"hourlyHistogram"`
-	Keywords        []KV       `json:"keywords"`
-	PeakHour        int        `json:"peakHour"`
-	Highlights      []string   `json:"highlights"`
-	Topics          []Topic    `json:"topics"`
-	ImageCount      int        `json:"imageCount"`
-	GroupVibes      GroupVibes `json:"groupVibes"`
-	ReplyDebt       ReplyDebt  `json:"replyDebt"`
+	TotalMessages   int      `json:"totalMessages"`
+	UniqueSenders   int      `json:"uniqueSenders"`
+	TopSenders      []KV     `json:"topSenders"`
+	TopLinks        []string `json:"topLinks"`
+	HourlyHistogram [24]int  `json:"hourlyHistogram"`
+	// HourlyReplied counts messages per hour that drew a reply, see
+	// BroadcastAdvice.
+	HourlyReplied [24]int `json:"hourlyReplied"`
+	// HourlySentiment splits the GroupVibes sentiment signals by hour;
+	// MoodTurns lists the hours where the mood flipped.
+	HourlySentiment [24]HourSentiment `json:"hourlySentiment"`
+	MoodTurns       []MoodTurn        `json:"moodTurns,omitempty"`
+	Keywords        []KV              `json:"keywords"`
+	PeakHour        int               `json:"peakHour"`
+	Highlights      []string          `json:"highlights"`
+	Topics          []Topic           `json:"topics"`
+	ImageCount      int               `json:"imageCount"`
+	VideoCount      int               `json:"videoCount"`
+	FileCount       int               `json:"fileCount"`
+	ShareCount      int               `json:"shareCount"`
+	GroupVibes      GroupVibes        `json:"groupVibes"`
+	ReplyDebt       ReplyDebt         `json:"replyDebt"`
+	Tags            []TagStat         `json:"tags,omitempty"`
+	EmojiStats      EmojiStats        `json:"emojiStats"`
+	RedPackets      RedPackets        `json:"redPackets"`
+	RecalledCount   int               `json:"recalledCount"`
+	// Recalls lists each recall, with the original text when it could be paired.
+	Recalls []Recall `json:"recalls,omitempty"`
+	// Membership lists joins, departures and group renames.
+	Membership Membership `json:"membership"`
+	// Interactions is the mention/quote network between senders.
+	Interactions InteractionGraph `json:"interactions"`
+	// Risk counts sensitive-content hits; it is filled in from the review
+	// queue by the generator and nil when no risk rules are configured.
+	Risk *RiskStats `json:"risk,omitempty"`
+	// Compare relates the day to yesterday and last week; the generator
+	// fills it in from earlier raw files.
+	Compare Comparison `json:"compare"`
+	// Entities counts phone numbers, emails, IPs, error codes and ticket
+	// numbers mentioned in messages.
+	Entities Entities `json:"entities"`
+	// Watch lists the watchlist rules covering the talker with their hits.
+	Watch []WatchHit `json:"watch,omitempty"`
+	// ActionItems lists explicit commitments ("我明天发给你") with owner
+	// and due hint.
+	ActionItems []ActionItem `json:"actionItems,omitempty"`
+	// Announcements are group notices, "@所有人" messages, long admin
+	// messages and messages mentioning many members.
+	Announcements []Announcement `json:"announcements,omitempty"`
+	// Contributions scores each sender's answers, first-shared links and
+	// thanks received, for the weekly awards.
+	Contributions []Contribution `json:"contributions,omitempty"`
+}
+
+// RiskStats counts the day's risk hits. Hits reviewed as false positives
+// are whitelisted and no longer counted in Hits; FalsePositive records how
+// many were dismissed.
+type RiskStats struct {
+	Hits          int  `json:"hits"`
+	Pending       int  `json:"pending"`
+	Confirmed     int  `json:"confirmed"`
+	FalsePositive int  `json:"falsePositive"`
+	ByRule        []KV `json:"byRule,omitempty"`
+}
+
+// EmojiStats counts custom stickers (msgType 47) and bracket emojis such as
+// [旺柴] per sender.
+type EmojiStats struct {
+	StickerCount int  `json:"stickerCount"`
+	EmojiCount   int  `json:"emojiCount"`
+	TopEmojis    []KV `json:"topEmojis,omitempty"`
+	// TopSenders ranks senders by stickers plus bracket emojis.
+	TopSenders []KV       `json:"topSenders,omitempty"`
+	King       *EmojiKing `json:"king,omitempty"`
+}
+
+// EmojiKing is the day's most prolific sticker and emoji sender (表情包之王).
+type EmojiKing struct {
+	Name     string `json:"name"`
+	Stickers int    `json:"stickers"`
+	Emojis   int    `json:"emojis"`
+	Favorite string `json:"favorite,omitempty"`
+}
+
+// minEmojiKing is the least stickers plus emojis needed to be crowned.
+const minEmojiKing = 3
+
+// TagStat counts messages carrying a rule-based tag with a few samples.
+type TagStat struct {
+	Name    string   `json:"name"`
+	Count   int      `json:"count"`
+	Samples []string `json:"samples,omitempty"`
 }
 
 type Topic struct {
@@ -32,6 +115,19 @@ type Topic struct {
 	Keywords       []string `json:"keywords"`
 	Count          int      `json:"count"`
 	Representative string   `json:"representative"`
+	// Clustered marks topics found by embedding clustering rather than by
+	// shared keywords.
+	Clustered bool `json:"clustered,omitempty"`
+	// DeepDive is the LLM's reading of the topic (llm.topicDeepDive).
+	DeepDive *TopicDeepDive `json:"deepDive,omitempty"`
+}
+
+// TopicDeepDive explains a topic: what was discussed, who thought what and
+// what is still open.
+type TopicDeepDive struct {
+	Explanation   string   `json:"explanation"`
+	Viewpoints    []string `json:"viewpoints"`
+	OpenQuestions []string `json:"openQuestions"`
 }
 
 type GroupVibes struct {
@@ -49,9 +145,16 @@ type ReplyDebt struct {
 	Resolved           []ReplyItem `json:"resolved"`
 	AvgResponseMinutes float64     `json:"avgResponseMinutes"`
 	BestResponseHours  []int       `json:"bestResponseHours"`
+	// Escalated lists questions left unanswered longer than the escalation
+	// age, today's and those carried over from earlier days, oldest first;
+	// LateResolved the carried questions answered today. See Escalation.
+	Escalated    []ReplyItem `json:"escalated,omitempty"`
+	LateResolved []ReplyItem `json:"lateResolved,omitempty"`
 }
 
 type ReplyItem struct {
+	// ID identifies the question across regenerations, see ReplyID.
+	ID              string   `json:"id,omitempty"`
 	Questioner      string   `json:"questioner"`
 	Question        string   `json:"question"`
 	AskedAt         string   `json:"askedAt"`
@@ -59,6 +162,81 @@ type ReplyItem struct {
 	AgeMinutes      float64  `json:"ageMinutes,omitempty"`
 	ResponseMinutes float64  `json:"responseMinutes,omitempty"`
 	Responders      []string `json:"responders,omitempty"`
+	// Answer is the first reply that resolved the question.
+	Answer     string `json:"answer,omitempty"`
+	AnsweredBy string `json:"answeredBy,omitempty"`
+	// Date is the day the question was asked, EscalatedOn the day it was
+	// first escalated and Owner who it was escalated to.
+	Date        string `json:"date,omitempty"`
+	EscalatedOn string `json:"escalatedOn,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+// emojiTracker accumulates EmojiStats while scanning messages.
+type emojiTracker struct {
+	totals    EmojiStats
+	emojis    map[string]int
+	stickers  map[string]int
+	perSender map[string]int
+	favorite  map[string]map[string]int
+}
+
+func newEmojiTracker() *emojiTracker {
+	return &emojiTracker{
+		emojis:    map[string]int{},
+		stickers:  map[string]int{},
+		perSender: map[string]int{},
+		favorite:  map[string]map[string]int{},
+	}
+}
+
+func (t *emojiTracker) add(sender string, m chatlog.Message) {
+	if m.MsgType == 47 {
+		t.totals.StickerCount++
+		if sender != "" {
+			t.stickers[sender]++
+			t.perSender[sender]++
+		}
+	}
+	for _, e := range m.Emojis {
+		// bracket text longer than a WeChat emoji name is usually a
+		// placeholder like [图片] quoted in text or plain brackets
+		if runeLen(e) > 4 || e == "图片" || e == "链接" {
+			continue
+		}
+		t.totals.EmojiCount++
+		t.emojis[e]++
+		if sender != "" {
+			t.perSender[sender]++
+			if t.favorite[sender] == nil {
+				t.favorite[sender] = map[string]int{}
+			}
+			t.favorite[sender][e]++
+		}
+	}
+}
+
+func (t *emojiTracker) stats() EmojiStats {
+	out := t.totals
+	out.TopEmojis = topK(t.emojis, 10)
+	out.TopSenders = topK(t.perSender, 5)
+	if len(out.TopSenders) > 0 && out.TopSenders[0].Count >= minEmojiKing {
+		name := out.TopSenders[0].Key
+		king := &EmojiKing{Name: name, Stickers: t.stickers[name]}
+		king.Emojis = out.TopSenders[0].Count - king.Stickers
+		if fav := topK(t.favorite[name], 1); len(fav) > 0 {
+			king.Favorite = fav[0].Key
+		}
+		out.King = king
+	}
+	return out
+}
+
+// ReplyID derives a stable question id from when, by whom and what was
+// asked, so claims survive re-rendering the day.
+func ReplyID(item ReplyItem) string {
+	sum := sha1.Sum([]byte(item.AskedAt + "\x00" + item.Questioner + "\x00" + item.Question))
+	return hex.EncodeToString(sum[:])[:12]
 }
 
 type vibeTracker struct {
@@ -80,6 +258,7 @@ type questionStatus struct {
 	ResponseMinutes      float64
 	ResponseHour         int
 	Responders           map[string]string
+	Answer               chatlog.Message
 }
 
 type KV struct {
@@ -87,15 +266,70 @@ type KV struct {
 	Count int    `json:"count"`
 }
 
+// Builder carries optional analysis settings. The zero value reproduces the
+// default heuristics used by BuildSummary.
+type Builder struct {
+	// Tokenizer segments text for keywords and topics; nil uses GramTokenizer.
+	Tokenizer Tokenizer
+	// Lexicon adds stopwords and sentiment words to the built-in sets.
+	Lexicon Lexicon
+	// Normalizer, when set, folds traditional/full-width/URL variants in the
+	// message text before anything is counted.
+	Normalizer *Normalizer
+	// Entities extracts phone numbers, error codes and the like; nil uses
+	// the built-in patterns.
+	Entities *EntityExtractor
+	// Watchlist counts hits of the configured keywords; see Watchlist.For
+	// to narrow it to one talker.
+	Watchlist *Watchlist
+	// Announce picks the messages pinned as the day's announcements.
+	Announce AnnounceRules
+	// ResolveLink, when set, maps a link to where it leads (expanded
+	// shortlinks) before links are normalized and counted.
+	ResolveLink func(string) string
+	// ReplyMatch pairs answers that only repeat the question's keywords.
+	ReplyMatch ReplyMatch
+	// TopicEmbedding, when its Embed is set, finds topics by clustering
+	// message embeddings instead of by shared keywords.
+	TopicEmbedding TopicEmbedding
+}
+
+// BuildSummary computes the daily summary with default settings.
 func BuildSummary(msgs []chatlog.Message) Summary {
+	return Builder{}.Build(msgs)
+}
+
+// Build computes the daily summary for msgs.
+func (b Builder) Build(msgs []chatlog.Message) Summary {
+	tokenizer := b.Tokenizer
+	if tokenizer == nil {
+		tokenizer = GramTokenizer{}
+	}
+	_, dict := tokenizer.(*DictTokenizer)
+	words := newWordSets(b.Lexicon, dict)
+	msgs = b.Normalizer.Messages(msgs)
 	sum := Summary{}
 	sum.TotalMessages = len(msgs)
 
 	senderCount := map[string]int{}
 	linkCount := map[string]int{}
 	tokenCount := map[string]int{}
+	tagStats := map[string]*TagStat{}
+	emojis := newEmojiTracker()
+	contrib := contribTracker{}
+	keywords := func(s string) []string {
+		var out []string
+		for _, tok := range tokenizer.Tokenize(s) {
+			if tok, ok := words.keepToken(tok); ok {
+				out = append(out, tok)
+			}
+		}
+		return out
+	}
 
 	messagesText := make([]string, 0, len(msgs))
+	// messageTokens holds the kept tokens of each entry in messagesText.
+	messageTokens := make([][]string, 0, len(msgs))
 	analytics := vibeTracker{}
 	questions := make([]*questionStatus, 0)
 	lastTime := time.Time{}
@@ -108,6 +342,7 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 		}
 
 		// hour histogram from Timestamp/CreateTime
+		hour := -1
 		ts := m.Timestamp
 		if ts == 0 {
 			ts = m.CreateTime
@@ -116,8 +351,8 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 			if ts > 1_000_000_000_000 { // ms
 				ts = ts / 1000
 			}
-			h := time.Unix(ts, 0).Local().Hour()
-			sum.HourlyHistogram[h]++
+			hour = time.Unix(ts, 0).Local().Hour()
+			sum.HourlyHistogram[hour]++
 		}
 
 		// text, links, media count
@@ -132,11 +367,41 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 		if m.Share != nil && m.Share.URL != "" {
 			foundLinks = append(foundLinks, m.Share.URL)
 		}
+		seenLinks := map[string]bool{}
 		for _, u := range foundLinks {
-			linkCount[u]++
+			if b.ResolveLink != nil {
+				u = b.ResolveLink(u)
+			}
+			if u = NormalizeURL(u); !seenLinks[u] {
+				seenLinks[u] = true
+				if linkCount[u] == 0 {
+					contrib.link(senderDisplay(m))
+				}
+				linkCount[u]++
+			}
 		}
-		if m.MsgType == 3 { // image
+		switch {
+		case m.MsgType == 3: // image
 			sum.ImageCount++
+		case m.IsVideo():
+			sum.VideoCount++
+		case m.IsFile():
+			sum.FileCount++
+		case IsShare(m):
+			sum.ShareCount++
+		}
+		for _, tag := range m.Tags {
+			st := tagStats[tag]
+			if st == nil {
+				st = &TagStat{Name: tag}
+				tagStats[tag] = st
+			}
+			st.Count++
+			if len(st.Samples) < 3 {
+				if sample := trimQuestionText(m); sample != "" {
+					st.Samples = append(st.Samples, sample)
+				}
+			}
 		}
 		if len(foundLinks) > 0 || runeLen(text) > 80 || m.MsgType == 49 {
 			analytics.infoDense++
@@ -150,9 +415,20 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 		if strings.ContainsAny(text, "!！") {
 			analytics.exclaimMsg++
 		}
-		pos, neg := sentimentSignals(text, m.Emojis)
+		pos, neg := words.sentimentSignals(text, m.Emojis)
 		analytics.sentimentPos += pos
 		analytics.sentimentNeg += neg
+		if pos > neg {
+			to := m.Mentions
+			if m.Reference != nil {
+				to = append(to[:len(to):len(to)], firstNonEmptyString(m.Reference.SenderName, m.Reference.Sender))
+			}
+			contrib.thank(senderDisplay(m), to)
+		}
+		if hour >= 0 {
+			sum.HourlySentiment[hour].Positive += pos
+			sum.HourlySentiment[hour].Negative += neg
+		}
 
 		msgTime := messageTime(m)
 		if !msgTime.IsZero() && msgTime.After(lastTime) {
@@ -169,8 +445,9 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 			if msgTime.IsZero() || (!q.AskedAt.IsZero() && msgTime.Before(q.AskedAt)) {
 				continue
 			}
-			if matchesQuestionResponse(m, q, text) {
+			if matchesQuestionResponse(m, q, text) || b.ReplyMatch.matches(m, q, text, msgTime, keywords) {
 				q.Resolved = true
+				q.Answer = m
 				if !msgTime.IsZero() && !q.AskedAt.IsZero() && msgTime.After(q.AskedAt) {
 					q.ResponseMinutes = msgTime.Sub(q.AskedAt).Minutes()
 				}
@@ -188,6 +465,8 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 			}
 		}
 
+		emojis.add(s, m)
+
 		if shouldTrackQuestion(m, text) {
 			qMsg := m
 			questions = append(questions, &questionStatus{
@@ -199,19 +478,15 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 			})
 		}
 
-		// tokenization (ASCII + simple Chinese grams)
-		for _, tok := range asciiTokens(text) {
-			tok = strings.ToLower(tok)
-			if stopwordEN[tok] || len(tok) <= 2 {
-				continue
+		var kept []string
+		for _, tok := range tokenizer.Tokenize(text) {
+			if tok, ok := words.keepToken(tok); ok {
+				tokenCount[tok]++
+				kept = append(kept, tok)
 			}
-			tokenCount[tok]++
 		}
-		for _, tok := range chineseGrams(text) {
-			if stopwordCN[tok] {
-				continue
-			}
-			tokenCount[tok]++
+		if text != "" {
+			messageTokens = append(messageTokens, kept)
 		}
 	}
 
@@ -230,6 +505,20 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 	sum.TopSenders = topK(senderCount, 5)
 	sum.TopLinks = topKKeys(linkCount, 5)
 	sum.Keywords = topK(tokenCount, 20)
+	sum.Tags = sortTagStats(tagStats)
+	sum.EmojiStats = emojis.stats()
+	sum.HourlyReplied = hourlyReplied(msgs)
+	sum.RedPackets = buildRedPackets(msgs)
+	sum.Recalls = buildRecalls(msgs)
+	sum.Membership = buildMembership(msgs)
+	roundSentiment(&sum.HourlySentiment)
+	sum.MoodTurns = buildMoodTurns(sum.HourlySentiment)
+	sum.Interactions = buildInteractionGraph(msgs)
+	sum.Entities = buildEntities(b.Entities, msgs)
+	sum.Watch = b.Watchlist.build(msgs)
+	sum.ActionItems = buildActionItems(msgs)
+	sum.Announcements = b.Announce.build(msgs)
+	sum.RecalledCount = len(sum.Recalls)
 
 	// Build topics by top tokens; group messages containing that token
 	topTokens := make([]string, 0, len(sum.Keywords))
@@ -275,50 +564,117 @@ func BuildSummary(msgs []chatlog.Message) Summary {
 		}
 		topics = append(topics, Topic{
 			Name:           tk,
-			Keywords:       []string{tk},
+			Keywords:       topicKeywords(tk, idxs, messageTokens),
 			Count:          len(idxs),
 			Representative: rep,
 		})
 		used[tk] = true
 	}
 	sum.Topics = topics
+	if clustered, ok := b.TopicEmbedding.topics(messagesText, messageTokens); ok {
+		sum.Topics = clustered
+	}
 
 	// Highlights (concise bullets)
 	sum.Highlights = buildHighlights(sum)
 	sum.GroupVibes = buildGroupVibes(sum, analytics)
 	sum.ReplyDebt = buildReplyDebt(questions, lastTime)
+	contrib.answers(sum.ReplyDebt)
+	sum.Contributions = contrib.list()
 	return sum
 }
 
+// topicKeywords is the topic token followed by up to four tokens that
+// co-occur with it in at least two of its messages; topic timelines match
+// topics across days by these.
+func topicKeywords(name string, idxs []int, messageTokens [][]string) []string {
+	co := map[string]int{}
+	for _, i := range idxs {
+		seen := map[string]bool{}
+		for _, tok := range messageTokens[i] {
+			if seen[tok] || strings.Contains(tok, name) || strings.Contains(name, tok) {
+				continue
+			}
+			seen[tok] = true
+			co[tok]++
+		}
+	}
+	out := []string{name}
+	for _, kv := range topK(co, 4) {
+		if kv.Count >= 2 {
+			out = append(out, kv.Key)
+		}
+	}
+	return out
+}
+
+func sortTagStats(stats map[string]*TagStat) []TagStat {
+	if len(stats) == 0 {
+		return nil
+	}
+	out := make([]TagStat, 0, len(stats))
+	for _, st := range stats {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count == out[j].Count {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
 func buildHighlights(s Summary) []string {
 	hi := []string{}
-	hi = append(hi, sprintf("消息 %d 条，活跃 %d 人；峰值 %02d:00-%02d:59", s.TotalMessages, s.UniqueSenders, s.PeakHour, s.PeakHour))
+	hi = append(hi, i18n.Tf("消息 %d 条，活跃 %d 人；峰值 %02d:00-%02d:59", s.TotalMessages, s.UniqueSenders, s.PeakHour, s.PeakHour))
 	if len(s.TopSenders) > 0 {
 		parts := []string{}
 		for i := 0; i < len(s.TopSenders) && i < 3; i++ {
 			kv := s.TopSenders[i]
 			parts = append(parts, sprintf("%s(%d)", kv.Key, kv.Count))
 		}
-		hi = append(hi, "Top 发送者："+strings.Join(parts, "、"))
+		hi = append(hi, i18n.T("Top 发送者：")+strings.Join(parts, i18n.T("、")))
 	}
 	if len(s.Topics) > 0 {
 		names := []string{}
 		for i := 0; i < len(s.Topics) && i < 3; i++ {
 			names = append(names, s.Topics[i].Name)
 		}
-		hi = append(hi, "热门主题："+strings.Join(names, "、"))
+		hi = append(hi, i18n.T("热门主题：")+strings.Join(names, i18n.T("、")))
 	}
 	if len(s.TopLinks) > 0 {
 		// show first domain
 		u := s.TopLinks[0]
 		if uu, err := url.Parse(u); err == nil && uu.Host != "" {
-			hi = append(hi, sprintf("热门链接 %d 个，例如 %s", len(s.TopLinks), uu.Host))
+			hi = append(hi, i18n.Tf("热门链接 %d 个，例如 %s", len(s.TopLinks), uu.Host))
 		} else {
-			hi = append(hi, sprintf("热门链接 %d 个", len(s.TopLinks)))
+			hi = append(hi, i18n.Tf("热门链接 %d 个", len(s.TopLinks)))
+		}
+	}
+	if rp := s.RedPackets; rp.Rain {
+		hi = append(hi, i18n.Tf("红包雨：共 %d 个红包，%s 起 %d 分钟内连发 %d 个", rp.Count, rp.RainAt, int(rainWindow/time.Minute), rp.RainCount))
+	} else if rp.Count > 0 || rp.Transfers > 0 {
+		parts := []string{}
+		if rp.Count > 0 {
+			parts = append(parts, i18n.Tf("红包 %d 个", rp.Count))
+		}
+		if rp.Transfers > 0 {
+			parts = append(parts, i18n.Tf("转账 %d 笔", rp.Transfers))
 		}
+		hi = append(hi, strings.Join(parts, i18n.T("、")))
 	}
 	if s.ImageCount > 0 {
-		hi = append(hi, sprintf("图片 %d 张", s.ImageCount))
+		hi = append(hi, i18n.Tf("图片 %d 张", s.ImageCount))
+	}
+	if s.VideoCount > 0 {
+		hi = append(hi, i18n.Tf("视频 %d 个", s.VideoCount))
+	}
+	if s.FileCount > 0 {
+		hi = append(hi, i18n.Tf("文件 %d 个", s.FileCount))
+	}
+	if s.ShareCount > 0 {
+		hi = append(hi, i18n.Tf("分享卡片 %d 张", s.ShareCount))
 	}
 	return hi
 }
@@ -334,33 +690,33 @@ func buildGroupVibes(sum Summary, analytics vibeTracker) GroupVibes {
 	controversy := clamp01(float64(analytics.questionMsg+analytics.mentionMsg+analytics.exclaimMsg) / (total * 1.0))
 	balanced := clamp01(1 - math.Abs(0.35-controversy)/0.35)
 	score := int(math.Round((activity*0.35 + sentiment*0.3 + infoDensity*0.2 + balanced*0.15) * 100))
-	tone := "讨论平稳"
+	tone := i18n.T("讨论平稳")
 	switch {
 	case score >= 85:
-		tone = "群氛高涨"
+		tone = i18n.T("群氛高涨")
 	case score >= 70:
-		tone = "活跃良好"
+		tone = i18n.T("活跃良好")
 	case score <= 40:
-		tone = "氛围偏冷"
+		tone = i18n.T("氛围偏冷")
 	}
 	reasons := []string{}
 	if activity >= 0.7 {
-		reasons = append(reasons, sprintf("活跃度高（%d 条、%d 人参与）", sum.TotalMessages, sum.UniqueSenders))
+		reasons = append(reasons, i18n.Tf("活跃度高（%d 条、%d 人参与）", sum.TotalMessages, sum.UniqueSenders))
 	} else if activity <= 0.3 {
-		reasons = append(reasons, "消息量偏低，讨论热度不足")
+		reasons = append(reasons, i18n.T("消息量偏低，讨论热度不足"))
 	}
 	if sentiment >= 0.6 {
-		reasons = append(reasons, "情绪偏正向，互动轻松")
+		reasons = append(reasons, i18n.T("情绪偏正向，互动轻松"))
 	} else if sentiment <= 0.4 {
-		reasons = append(reasons, "负面/吐槽内容偏多")
+		reasons = append(reasons, i18n.T("负面/吐槽内容偏多"))
 	}
 	if infoDensity >= 0.5 {
-		reasons = append(reasons, "信息密度高（链接或长文较多）")
+		reasons = append(reasons, i18n.T("信息密度高（链接或长文较多）"))
 	}
 	if controversy >= 0.55 {
-		reasons = append(reasons, "争议度高，需要关注共识")
+		reasons = append(reasons, i18n.T("争议度高，需要关注共识"))
 	} else if controversy <= 0.2 {
-		reasons = append(reasons, "讨论较温和，可适度引导观点碰撞")
+		reasons = append(reasons, i18n.T("讨论较温和，可适度引导观点碰撞"))
 	}
 	return GroupVibes{
 		Score:       score,
@@ -393,8 +749,11 @@ func buildReplyDebt(questions []*questionStatus, lastTime time.Time) ReplyDebt {
 			AskedAt:    askedAtStr,
 			Mentions:   q.Mentions,
 		}
+		item.ID = ReplyID(item)
 		if q.Resolved {
 			item.ResponseMinutes = roundTo(q.ResponseMinutes, 1)
+			item.Answer = trimQuestionText(q.Answer)
+			item.AnsweredBy = senderDisplay(q.Answer)
 			if len(q.Responders) > 0 {
 				responders := make([]string, 0, len(q.Responders))
 				for _, name := range q.Responders {
@@ -429,13 +788,13 @@ func buildReplyDebt(questions []*questionStatus, lastTime time.Time) ReplyDebt {
 	return rd
 }
 
-func sentimentSignals(text string, emojis []string) (float64, float64) {
+func (ws wordSets) sentimentSignals(text string, emojis []string) (float64, float64) {
 	if text == "" && len(emojis) == 0 {
 		return 0, 0
 	}
 	lower := strings.ToLower(text)
 	var pos, neg float64
-	for _, token := range positiveLexicons {
+	for _, token := range ws.positive {
 		if token == "" {
 			continue
 		}
@@ -444,7 +803,7 @@ func sentimentSignals(text string, emojis []string) (float64, float64) {
 			break
 		}
 	}
-	for _, token := range negativeLexicons {
+	for _, token := range ws.negative {
 		if token == "" {
 			continue
 		}
@@ -458,11 +817,10 @@ func sentimentSignals(text string, emojis []string) (float64, float64) {
 		if e == "" {
 			continue
 		}
-		if positiveEmojiSet[e] {
-			pos += 0.5
-		}
-		if negativeEmojiSet[e] {
-			neg += 0.5
+		if w := ws.emoji[e]; w > 0 {
+			pos += w
+		} else if w < 0 {
+			neg -= w
 		}
 	}
 	return pos, neg
@@ -538,12 +896,7 @@ func messageTime(m chatlog.Message) time.Time {
 		}
 		return time.Unix(ts, 0).Local()
 	}
-	if m.Time != "" {
-		if t, err := time.Parse(time.RFC3339, m.Time); err == nil {
-			return t
-		}
-	}
-	return time.Time{}
+	return parseMessageTime(m.Time)
 }
 
 func trimQuestionText(m chatlog.Message) string {
@@ -792,6 +1145,12 @@ var (
 		"什么": true, "怎么": true, "这种": true, "一些": true, "大家": true, "自己": true, "一下": true, "还是": true, "好的": true,
 		"的": true, "了": true, "在": true, "是": true, "和": true, "与": true, "也": true, "都": true, "并": true, "很": true, "更": true, "及": true, "被": true, "就": true, "而": true,
 	}
+	// dictStopwordCN are filler words the dict tokenizer keeps whole, so
+	// they would top its keywords. The gram tokenizer keeps its original
+	// stopwords and output.
+	dictStopwordCN = map[string]bool{
+		"真的": true, "感觉": true, "觉得": true, "知道": true, "现在": true, "其实": true, "然后": true, "这样": true, "但是": true, "确实": true,
+	}
 	positiveLexicons = []string{"哈哈", "[微笑]", "👍", "赞", "感谢", "给力", "稳", "太好了", "nice", "great", "perfect", "爽", "牛逼", "加油", "🎉"}
 	negativeLexicons = []string{"[捂脸]", "[泪]", "[汗]", "哭", "麻烦", "晕", "糟糕", "不行", "翻车", "崩", "麻了", "难顶", "bug", "问题", "??", "？？", "🙈", "😭", "😓", "😡"}
 	positiveEmojiSet = map[string]bool{"微笑": true, "强": true, "赞": true, "OK": true}
@@ -0,0 +1,684 @@
+package summarize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestEmojiStatsCrownsKing(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", MsgType: 47},
+		{SenderName: "阿强", MsgType: 47},
+		{SenderName: "阿强", MsgType: 1, Content: "哈哈[旺柴][旺柴]", Emojis: []string{"旺柴", "旺柴"}},
+		{SenderName: "小美", MsgType: 1, Content: "收到[强]", Emojis: []string{"强"}},
+		{SenderName: "小美", MsgType: 1, Content: "[图片]", Emojis: []string{"图片"}},
+	}
+	st := BuildSummary(msgs).EmojiStats
+	if st.StickerCount != 2 || st.EmojiCount != 3 {
+		t.Fatalf("计数异常: %+v", st)
+	}
+	if st.King == nil || st.King.Name != "阿强" || st.King.Stickers != 2 || st.King.Emojis != 2 || st.King.Favorite != "旺柴" {
+		t.Fatalf("表情包之王异常: %+v", st.King)
+	}
+}
+
+func TestBroadcastAdvicePrefersRepliedHours(t *testing.T) {
+	var a, b Summary
+	a.TotalMessages, b.TotalMessages = 1, 1
+	// 09:00 is busy but ignored, 20:00 is busy and answered, 03:00 is tiny
+	a.HourlyHistogram[9], a.HourlyReplied[9] = 100, 10
+	a.HourlyHistogram[20], a.HourlyReplied[20] = 60, 50
+	b.HourlyHistogram[20], b.HourlyReplied[20] = 40, 30
+	b.HourlyHistogram[3], b.HourlyReplied[3] = 1, 1
+	adv := BroadcastAdvice([]Summary{a, b}, 2)
+	if adv.Days != 2 || len(adv.Best) != 2 || adv.Best[0] != 20 || adv.Best[1] != 9 {
+		t.Fatalf("推荐时段异常: %+v", adv.Best)
+	}
+	if got := adv.Slots[20].ReplyRate; got != 0.8 {
+		t.Fatalf("回复率异常: %v", got)
+	}
+}
+
+func TestHourlyRepliedMatchesQuotes(t *testing.T) {
+	asked := time.Date(2025, 10, 16, 9, 5, 0, 0, time.Local)
+	msgs := []chatlog.Message{
+		{Sender: "wxid_a", SenderName: "阿强", MsgType: 1, Content: "有人用过这个吗", Timestamp: asked.Unix()},
+		{Sender: "wxid_c", SenderName: "阿明", MsgType: 1, Content: "早", Timestamp: asked.Add(time.Minute).Unix()},
+		// 小美一小时后引用了阿强的提问，引用里的时间是另一种格式
+		{Sender: "wxid_b", SenderName: "小美", MsgType: 49, Content: "用过，挺好", Timestamp: asked.Add(time.Hour).Unix(),
+			Reference: &chatlog.Reference{Time: asked.Format("2006-01-02 15:04:05"), Sender: "wxid_a", SenderName: "阿强"}},
+		{Sender: "wxid_a", SenderName: "阿强", MsgType: 1, Content: "谢谢", Timestamp: asked.Add(3 * time.Hour).UnixMilli()},
+		{Sender: "wxid_a", SenderName: "阿强", MsgType: 1, Content: "再问一句", Timestamp: asked.Add(4 * time.Hour).Unix()},
+		{Sender: "wxid_b", SenderName: "小美", MsgType: 49, Content: "好", Timestamp: asked.Add(5 * time.Hour).Unix(),
+			Reference: &chatlog.Reference{Time: strconv.FormatInt(asked.Add(4*time.Hour).Unix(), 10), SenderName: "阿强"}},
+	}
+	got := hourlyReplied(msgs)
+	// 09:05 被阿明紧接着回复且被引用，09:06 无人回应，10:05 与 12:05 无人回应，
+	// 13:05 被引用（引用只带昵称与 unix 秒）
+	if got[9] != 1 || got[10] != 0 || got[12] != 0 || got[13] != 1 || got[14] != 0 {
+		t.Fatalf("按小时的回复数异常: %v", got)
+	}
+
+	// 只有引用、没有紧接着的回复也算被回复
+	msgs = append(msgs[:1:1], msgs[2])
+	if got := hourlyReplied(msgs); got[9] != 1 {
+		t.Fatalf("引用未计为回复: %v", got)
+	}
+}
+
+func TestRedPacketRain(t *testing.T) {
+	at := func(min int) int64 { return int64(1758094120+min*60) * 1000 }
+	msgs := []chatlog.Message{
+		{SenderName: "老板", MsgType: 49, SubType: 2001, Timestamp: at(0)},
+		{SenderName: "老板", MsgType: 49, SubType: 2001, Timestamp: at(5)},
+		{SenderName: "小李", MsgType: 1, Content: "[红包]恭喜发财", Timestamp: at(12)},
+		{SenderName: "系统消息", MsgType: 10000, Content: "小李领取了老板的红包", Timestamp: at(13)},
+		{SenderName: "小李", MsgType: 49, SubType: 2000, Timestamp: at(90)},
+		{SenderName: "老板", MsgType: 49, SubType: 2001, Timestamp: at(120)},
+	}
+	sum := BuildSummary(msgs)
+	rp := sum.RedPackets
+	if rp.Count != 4 || rp.Transfers != 1 || rp.Claims != 1 {
+		t.Fatalf("计数异常: %+v", rp)
+	}
+	if !rp.Rain || rp.RainCount != 3 || rp.Senders[0].Key != "老板" {
+		t.Fatalf("红包雨判断异常: %+v", rp)
+	}
+	found := false
+	for _, h := range sum.Highlights {
+		found = found || strings.HasPrefix(h, "红包雨") && strings.Contains(h, fmt.Sprintf(" %d 分钟内", int(rainWindow/time.Minute)))
+	}
+	if !found {
+		t.Fatalf("要点中缺少红包雨: %v", sum.Highlights)
+	}
+}
+
+func TestRecallPairsOriginal(t *testing.T) {
+	at := func(sec int) int64 { return int64(1758007700+sec) * 1000 }
+	msgs := []chatlog.Message{
+		{SenderName: "李峻", MsgType: 1, Content: "发错群了", Timestamp: at(0)},
+		{SenderName: "毛佳杰", MsgType: 1, Content: "句意", Timestamp: at(10)},
+		{Sender: "系统消息", MsgType: 10000, Content: `"李峻" 撤回了一条消息`, Timestamp: at(30)},
+		{Sender: "系统消息", MsgType: 10000, Content: `"Calvin" 撤回了一条消息`, Timestamp: at(40)},
+	}
+	sum := BuildSummary(msgs)
+	if sum.RecalledCount != 2 {
+		t.Fatalf("撤回计数异常: %d", sum.RecalledCount)
+	}
+	if r := sum.Recalls[0]; r.Who != "李峻" || r.Original != "发错群了" {
+		t.Fatalf("未配对原文: %+v", r)
+	}
+	if r := sum.Recalls[1]; r.Who != "Calvin" || r.Original != "" {
+		t.Fatalf("不应配对: %+v", r)
+	}
+}
+
+func TestNormalizerMergesVariants(t *testing.T) {
+	n := NewNormalizer(true, true, true)
+	if got := n.String("開會討論ＡＰＩ設計！"); got != "开会讨论API设计!" {
+		t.Fatalf("归一化结果不对: %q", got)
+	}
+	if got := n.String("看 HTTPS://GitHub.COM/Foo/Bar 这个"); got != "看 https://github.com/Foo/Bar 这个" {
+		t.Fatalf("URL 只应小写协议和域名: %q", got)
+	}
+	if err := n.Load(strings.NewReader("羣\t群 羣\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.String("羣"); got != "群" {
+		t.Fatalf("OpenCC 格式映射未生效: %q", got)
+	}
+
+	msgs := []chatlog.Message{
+		{Content: "開會", Sender: "a"},
+		{Content: "开会", Sender: "b"},
+		{Content: "https://Example.com/x", Sender: "a"},
+		{Content: "https://example.com/x", Sender: "b"},
+	}
+	sum := Builder{Normalizer: n}.Build(msgs)
+	if len(sum.TopLinks) != 1 {
+		t.Fatalf("链接应合并计数: %+v", sum.TopLinks)
+	}
+	if msgs[0].Content != "開會" {
+		t.Fatalf("原始消息不应被修改: %q", msgs[0].Content)
+	}
+}
+
+func TestMembershipParsesSystemNotices(t *testing.T) {
+	sys := func(text string) chatlog.Message {
+		return chatlog.Message{Sender: "系统消息", MsgType: 10000, Content: text}
+	}
+	msgs := []chatlog.Message{
+		sys(`"马工"邀请"Carson"加入了群聊`),
+		sys(`"Muxso"与群里其他人都不是朋友关系，请注意隐私安全`),
+		sys(`你邀请"小林、阿强"加入了群聊`),
+		sys(`"王欢"通过扫描"马工"分享的二维码加入群聊`),
+		sys(`"马工"将"广告号"移出了群聊`),
+		sys(`"马工"修改群名为“AI软工: 找到有价值的问题”`),
+		{Sender: "b", Content: "谁去邀请他来群里"},
+	}
+	ms := Builder{}.Build(msgs).Membership
+	if ms.Joined != 4 || ms.Left != 1 || len(ms.Events) != 6 {
+		t.Fatalf("成员变动统计不对: %+v", ms)
+	}
+	if ev := ms.Events[1]; ev.Who != "小林" || ev.By != "你" {
+		t.Fatalf("多人邀请解析不对: %+v", ev)
+	}
+	if ev := ms.Events[3]; ev.Who != "王欢" || ev.By != "马工" {
+		t.Fatalf("扫码入群解析不对: %+v", ev)
+	}
+	if ev := ms.Events[5]; ev.Kind != GroupRename || ev.Name != "AI软工: 找到有价值的问题" {
+		t.Fatalf("改群名解析不对: %+v", ev)
+	}
+	for _, text := range []string{`你修改群名为“周末群”`, `"马工"修改了群名称为"周末群"`, `"马工"将群名称修改为“周末群”`} {
+		evs := ParseMemberEvents(sys(text))
+		if len(evs) != 1 || evs[0].Kind != GroupRename || evs[0].Name != "周末群" {
+			t.Fatalf("%s 解析不对: %+v", text, evs)
+		}
+	}
+}
+
+func TestInteractionGraphFromMentionsAndQuotes(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "@小美 看下这个", Mentions: []string{"小美"}},
+		{SenderName: "小美", Content: "好的", Reference: &chatlog.Reference{SenderName: "阿强", Content: "@小美 看下这个"}},
+		{SenderName: "老王", Content: "@小美 @阿强 开会", Mentions: []string{"小美", "阿强"}},
+		{SenderName: "阿强", Content: "@阿强 自言自语", Mentions: []string{"阿强"}},
+		{SenderName: "系统消息", MsgType: 10000, Content: `"x"邀请"y"加入了群聊`, Mentions: []string{"y"}},
+	}
+	g := Builder{}.Build(msgs).Interactions
+	if len(g.Edges) != 4 || len(g.Nodes) != 3 {
+		t.Fatalf("互动图规模不对: %+v", g)
+	}
+	for _, e := range g.Edges {
+		if e.From == "小美" && (e.To != "阿强" || e.Replies != 1) {
+			t.Fatalf("引用回复应记为 小美→阿强: %+v", e)
+		}
+	}
+	if top := g.Nodes[0]; top.Centrality != 1 {
+		t.Fatalf("中心性计算不对: %+v", g.Nodes)
+	}
+}
+
+func TestHourlySentimentFindsMoodTurn(t *testing.T) {
+	at := func(h int) int64 {
+		return time.Date(2025, 10, 16, h, 5, 0, 0, time.Local).Unix()
+	}
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "太棒了，感谢大家", Timestamp: at(9)},
+		{SenderName: "小美", Content: "赞", Timestamp: at(9)},
+		{SenderName: "老王", Content: "随便聊聊", Timestamp: at(12)},
+		{SenderName: "阿强", Content: "又崩溃了，太垃圾", Timestamp: at(15)},
+	}
+	sum := Builder{Lexicon: Lexicon{Positive: []string{"棒", "赞"}, Negative: []string{"崩溃"}}}.Build(msgs)
+	if sum.HourlySentiment[9].Positive != 2 || sum.HourlySentiment[15].Negative < 1 {
+		t.Fatalf("分时情绪不对: %+v", sum.HourlySentiment)
+	}
+	if len(sum.MoodTurns) != 1 || sum.MoodTurns[0] != (MoodTurn{Hour: 15, From: MoodPositive, To: MoodNegative}) {
+		t.Fatalf("情绪转折不对: %+v", sum.MoodTurns)
+	}
+}
+
+func TestCompareWithYesterdayAndLastWeek(t *testing.T) {
+	today := []chatlog.Message{
+		{SenderName: "阿强", Content: "早"},
+		{SenderName: "阿强", Content: "今天发版"},
+		{SenderName: "新人", Content: "大家好"},
+		{SenderName: "系统消息", MsgType: 10000, Content: `"阿强"邀请"新人"加入了群聊`},
+	}
+	yesterday := &Earlier{Date: "2025-10-15", Messages: []chatlog.Message{
+		{SenderName: "阿强", Content: "晚安"},
+		{SenderName: "小美", Content: "晚安"},
+	}}
+	lastWeek := &Earlier{Date: "2025-10-09"}
+
+	c := Compare(today, yesterday, lastWeek)
+	if d := c.Yesterday; d == nil || d.MessagesChange != 2 || d.MessagesPercent != 100 || d.SendersChange != 0 {
+		t.Fatalf("较昨日不对: %+v", c.Yesterday)
+	}
+	if d := c.LastWeek; d == nil || d.Messages != 0 || d.MessagesPercent != 0 || d.MessagesChange != 4 {
+		t.Fatalf("较上周同日不对: %+v", c.LastWeek)
+	}
+	if len(c.NewSenders) != 1 || c.NewSenders[0] != "新人" || len(c.GoneSenders) != 1 || c.GoneSenders[0] != "小美" {
+		t.Fatalf("新增/沉默成员不对: %+v", c)
+	}
+	if empty := Compare(today, nil, nil); empty.Yesterday != nil || empty.NewSenders != nil {
+		t.Fatalf("缺少历史数据时应为空: %+v", empty)
+	}
+}
+
+func TestEntitiesFromTechSupportChat(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", MsgType: 1, Content: "接口又 502 Bad Gateway 了，网关 10.0.3.21 上看到 ECONNREFUSED"},
+		{SenderName: "小美", MsgType: 1, Content: "我这边也是 HTTP 502，工单号：inc-20251016 已提"},
+		{SenderName: "老王", MsgType: 1, Content: "OPS-1423 跟进，日志里有 NullPointerException，错误码: 40013"},
+		{SenderName: "老王", MsgType: 1, Content: "有问题打 13812345678 或者发 Wang.Li@Example.com，升级到 v1.2.3.4 看看"},
+		{SenderName: "阿强", MsgType: 1, Content: "订单 201380012345678901 不是手机号，UTF-8 也不是工单，error code is unknown"},
+		{SenderName: "系统", MsgType: 10000, Content: "ORA-00942 出现在系统消息里不算"},
+	}
+	e := BuildSummary(msgs).Entities
+	want := map[string][]KV{
+		"errorCodes": {{Key: "HTTP 502", Count: 2}, {Key: "ECONNREFUSED", Count: 1}, {Key: "NullPointerException", Count: 1}, {Key: "code 40013", Count: 1}},
+		"tickets":    {{Key: "INC-20251016", Count: 1}, {Key: "OPS-1423", Count: 1}},
+		"ips":        {{Key: "10.0.3.21", Count: 1}},
+		"phones":     {{Key: "138****5678", Count: 1}},
+		"emails":     {{Key: "W***@example.com", Count: 1}},
+	}
+	got := map[string][]KV{"errorCodes": e.ErrorCodes, "tickets": e.Tickets, "ips": e.IPs, "phones": e.Phones, "emails": e.Emails}
+	for kind, w := range want {
+		g := got[kind]
+		if len(g) != len(w) {
+			t.Fatalf("%s = %+v, want %+v", kind, g, w)
+		}
+		for i := range w {
+			if g[i] != w[i] {
+				t.Fatalf("%s = %+v, want %+v", kind, g, w)
+			}
+		}
+	}
+
+	x, err := NewEntityExtractor(map[string][]string{"ticket": {`REQ(\d{6})`}})
+	if err != nil {
+		t.Fatalf("NewEntityExtractor: %v", err)
+	}
+	if got := x.Extract("跟进 REQ004217")["ticket"]; len(got) != 1 || got[0] != "004217" {
+		t.Fatalf("custom ticket pattern = %v", got)
+	}
+	if _, err := NewEntityExtractor(map[string][]string{"bogus": {"x"}}); err == nil {
+		t.Fatal("unknown entity kind should fail")
+	}
+}
+
+func TestWatchlistCountsHitsPerTalker(t *testing.T) {
+	w, err := NewWatchlist([]WatchRule{
+		{Name: "售后", Patterns: []string{"退款", `退\s*货`}, Threshold: 2},
+		{Name: "竞品", Patterns: []string{"AcmeChat"}, Talkers: []string{"other@chatroom"}},
+		{Name: "缺陷", Patterns: []string{`\bbug\b`}},
+	})
+	if err != nil {
+		t.Fatalf("NewWatchlist: %v", err)
+	}
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", MsgType: 1, Content: "昨天买的要退款，顺便问下退 货流程"},
+		{SenderName: "小美", MsgType: 1, Content: "我也申请退款了"},
+		{SenderName: "老王", MsgType: 1, Content: "AcmeChat 也有这个 BUG"},
+		{SenderName: "系统", MsgType: 10000, Content: "退款 不算系统消息"},
+	}
+	b := Builder{Watchlist: w.For("123@chatroom")}
+	got := b.Build(msgs).Watch
+	if len(got) != 2 || got[0].Name != "售后" || got[1].Name != "缺陷" {
+		t.Fatalf("watch = %+v, want the 售后 and 缺陷 rules", got)
+	}
+	refund := got[0]
+	if refund.Hits != 2 || !refund.Alert() || len(refund.Messages) != 2 || refund.Messages[0].Sender != "阿强" {
+		t.Fatalf("售后 = %+v", refund)
+	}
+	if len(refund.Terms) != 2 || refund.Terms[0] != (KV{Key: "退款", Count: 2}) {
+		t.Fatalf("售后 terms = %+v", refund.Terms)
+	}
+	if bug := got[1]; bug.Hits != 1 || bug.Alert() || bug.Terms[0].Key != "bug" {
+		t.Fatalf("缺陷 = %+v", bug)
+	}
+	if (&Watchlist{}).For("x") != nil || w.For("other@chatroom").rules[1].Name != "竞品" {
+		t.Fatal("For should keep rules covering the talker only")
+	}
+	if _, err := NewWatchlist([]WatchRule{{Name: "空"}}); err == nil {
+		t.Fatal("a rule without patterns should fail")
+	}
+}
+
+func TestBuildActionItems(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", MsgType: 1, Content: "好的，我明天发给你"},
+		{SenderName: "小美", MsgType: 1, Content: "@老王 你周五之前上线吧", Mentions: []string{"老王"}},
+		{SenderName: "老王", MsgType: 1, Content: "我这边晚点整理一下文档。顺便说下今天好热"},
+		{SenderName: "阿强", MsgType: 1, Content: "我明天能发吗？"},
+		{SenderName: "小美", MsgType: 1, Content: "我觉得明天发布不太好"},
+		{SenderName: "老王", MsgType: 1, Content: "我今天不会提交了"},
+		{SenderName: "系统", MsgType: 10000, Content: "我明天发"},
+	}
+	got := BuildSummary(msgs).ActionItems
+	if len(got) != 3 {
+		t.Fatalf("action items = %+v, want 3", got)
+	}
+	if a := got[0]; a.Owner != "阿强" || a.Task != "我明天发给你" || a.Due != "明天" || a.Source != "好的，我明天发给你" {
+		t.Fatalf("item 0 = %+v", a)
+	}
+	if a := got[1]; a.Owner != "老王" || a.Sender != "小美" || a.Task != "你周五之前上线吧" || a.Due != "周五之前" {
+		t.Fatalf("item 1 = %+v", a)
+	}
+	if a := got[2]; a.Owner != "老王" || a.Task != "我这边晚点整理一下文档" || a.Due != "晚点" {
+		t.Fatalf("item 2 = %+v", a)
+	}
+}
+
+func TestAnnouncementsPinned(t *testing.T) {
+	long := strings.Repeat("本周六下午两点在三楼会议室开分享会，", 10)
+	msgs := []chatlog.Message{
+		{SenderName: "群主", Sender: "wxid_owner", MsgType: 1, Content: long},
+		{SenderName: "阿强", MsgType: 1, Content: long},
+		{SenderName: "小美", MsgType: 1, Content: "@所有人 今晚八点直播"},
+		{SenderName: "老王", MsgType: 1, Content: "@a @b @c 开会", Mentions: []string{"a", "b", "c"}},
+		{SenderName: "系统消息", MsgType: 10000, Content: `"群主"修改了群公告`},
+		{SenderName: "阿强", MsgType: 49, SubType: 57, Content: "群公告第5条"},
+	}
+	got := Builder{Announce: AnnounceRules{Admins: []string{"wxid_owner"}, MinMentions: 3}}.Build(msgs).Announcements
+	var reasons []string
+	for _, a := range got {
+		reasons = append(reasons, a.Sender+":"+a.Reason)
+	}
+	want := "群主:管理员长消息,小美:@所有人,老王:多人提及,系统消息:群公告"
+	if strings.Join(reasons, ",") != want {
+		t.Fatalf("announcements = %v, want %s", reasons, want)
+	}
+	if got[0].Text != long {
+		t.Fatalf("text = %q", got[0].Text)
+	}
+}
+
+func TestTopLinksNormalizeAndResolve(t *testing.T) {
+	for in, want := range map[string]string{
+		"HTTPS://Example.COM:443/a/?utm_source=wx&id=7&from=timeline#top": "https://example.com/a?id=7",
+		"https://mp.weixin.qq.com/s?__biz=MzA&mid=1&scene=21&chksm=ab":    "https://mp.weixin.qq.com/s?__biz=MzA&mid=1",
+		"https://app.example.com/#/post/1":                                "https://app.example.com#/post/1",
+		"https://example.com/x?b=2&a=1，":                                  "https://example.com/x?a=1&b=2",
+		"not a url":                                                       "not a url",
+	} {
+		if got := NormalizeURL(in); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	short := map[string]string{
+		"https://t.cn/A6abc":  "https://www.bilibili.com/video/BV1xx?share_source=copy_web&vd_source=9",
+		"https://b23.tv/xyz1": "https://www.bilibili.com/video/BV1xx/?share_medium=android",
+	}
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "看这个 https://t.cn/A6abc"},
+		{SenderName: "小美", Content: "https://b23.tv/xyz1 同一个"},
+		{SenderName: "老王", Content: "https://www.bilibili.com/video/BV1xx"},
+	}
+	b := Builder{ResolveLink: func(u string) string {
+		if long, ok := short[u]; ok {
+			return long
+		}
+		return u
+	}}
+	if got := b.Build(msgs).TopLinks; len(got) != 1 || got[0] != "https://www.bilibili.com/video/BV1xx" {
+		t.Fatalf("TopLinks = %v", got)
+	}
+}
+
+func TestShareCountSkipsFilesAndRedPackets(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", MsgType: 49, SubType: 5, Share: &chatlog.Share{Title: "一篇文章", URL: "https://mp.weixin.qq.com/s/abc"}},
+		{SenderName: "小美", MsgType: 49, SubType: 33, Share: &chatlog.Share{Title: "小程序"}},
+		{SenderName: "老王", MsgType: 49, SubType: chatlog.SubTypeFile, Share: &chatlog.Share{Title: "报告.pdf"}},
+		{SenderName: "老板", MsgType: 49, SubType: 2001, Share: &chatlog.Share{Title: "恭喜发财"}},
+		{SenderName: "小李", MsgType: 49, Share: &chatlog.Share{}},
+	}
+	sum := BuildSummary(msgs)
+	if sum.ShareCount != 2 || sum.FileCount != 1 {
+		t.Fatalf("ShareCount = %d, FileCount = %d", sum.ShareCount, sum.FileCount)
+	}
+}
+
+func TestKeywordsTokenizeAndDropStopwords(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "Deploy the service to Kubernetes"},
+		{SenderName: "小美", Content: "kubernetes 集群 OK"},
+		{SenderName: "阿强", Content: "我们的集群又挂了"},
+		{SenderName: "老王", Content: "KUBERNETES is on fire, deploy later"},
+	}
+	counts := map[string]int{}
+	for _, kv := range BuildSummary(msgs).Keywords {
+		counts[kv.Key] = kv.Count
+	}
+	// 英文词不区分大小写合并，中文按二/三元组切分
+	for word, want := range map[string]int{"kubernetes": 3, "deploy": 2, "集群": 2, "service": 1} {
+		if counts[word] != want {
+			t.Errorf("%s 计数 = %d，期望 %d（%v）", word, counts[word], want, counts)
+		}
+	}
+	// 停用词、两个字母以内的英文词与单字不计入
+	for _, word := range []string{"the", "to", "is", "on", "ok", "我们", "的", "了"} {
+		if _, ok := counts[word]; ok {
+			t.Errorf("%s 应被过滤: %v", word, counts)
+		}
+	}
+	if kw := BuildSummary(msgs).Keywords; kw[0].Key != "kubernetes" {
+		t.Errorf("关键词未按次数排序: %v", kw)
+	}
+}
+
+func TestCustomLexiconMergesOverBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	load := func(name, body string) Lexicon {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		lex, err := LoadLexicon(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lex
+	}
+	base := load("base.json", `{"stopwords": ["Kubernetes", " "], "positive": ["YYDS"], "emoji": {"旺柴": -1}}`)
+	group := load("group.json", `{"stopwords": ["集群"], "negative": ["寄了"], "emoji": {"旺柴": 2, "捂脸": 0}}`)
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"stopwords": "集群"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLexicon(bad); err == nil || !strings.Contains(err.Error(), "parse lexicon") {
+		t.Fatalf("格式错误的词表应报错: %v", err)
+	}
+	at := func(h int) int64 {
+		return time.Date(2025, 10, 16, h, 5, 0, 0, time.Local).Unix()
+	}
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "Kubernetes 集群部署 YYDS", Emojis: []string{"旺柴"}, Timestamp: at(10)},
+		{SenderName: "小美", Content: "kubernetes 集群部署寄了", Emojis: []string{"捂脸"}, Timestamp: at(11)},
+	}
+	sum := Builder{Lexicon: base.Merge(group)}.Build(msgs)
+	counts := map[string]int{}
+	for _, kv := range sum.Keywords {
+		counts[kv.Key] = kv.Count
+	}
+	// 自定义停用词不区分大小写，与内置停用词一起生效
+	if _, ok := counts["kubernetes"]; ok || counts["集群"] != 0 || counts["部署"] != 2 {
+		t.Fatalf("自定义停用词未生效: %v", counts)
+	}
+	// 后合并的词表覆盖表情权重，权重为 0 时不计入情绪
+	if got := sum.HourlySentiment[10]; got.Positive != 3 || got.Negative != 0 {
+		t.Fatalf("10 点情绪 = %+v，期望 YYDS 与旺柴共 3 分", got)
+	}
+	if got := sum.HourlySentiment[11]; got.Positive != 0 || got.Negative != 1 {
+		t.Fatalf("11 点情绪 = %+v，期望只有寄了计 1 分", got)
+	}
+}
+
+func TestTopicKeywordsFollowCoOccurrence(t *testing.T) {
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Content: "kafka rollback started"},
+		{SenderName: "小美", Content: "kafka rollback done"},
+		{SenderName: "老王", Content: "kafka consumer lag"},
+		{SenderName: "阿强", Content: "kafka lag recovered"},
+	}
+	topics := Builder{}.Build(msgs).Topics
+	if len(topics) == 0 || topics[0].Name != "kafka" {
+		t.Fatalf("Topics = %+v", topics)
+	}
+	got := strings.Join(topics[0].Keywords, ",")
+	if got != "kafka,lag,rollback" {
+		t.Fatalf("Keywords = %s，应为话题词加上至少共现两次的词", got)
+	}
+}
+
+func TestWeeklyAwardsScoresContributions(t *testing.T) {
+	base := time.Date(2025, 10, 13, 10, 0, 0, 0, time.Local).Unix()
+	msgs := []chatlog.Message{
+		{SenderName: "小美", Timestamp: base, Content: "部署脚本报错怎么办？", IsQuestion: true},
+		{SenderName: "阿强", Timestamp: base + 60, Content: "@小美 把 PATH 加上就行", Mentions: []string{"小美"}},
+		{SenderName: "小美", Timestamp: base + 120, Content: "@阿强 感谢，太好了", Mentions: []string{"阿强"}},
+		{SenderName: "老王", Timestamp: base + 180, Content: "文档在这 https://example.com/doc"},
+		{SenderName: "小美", Timestamp: base + 240, Content: "同一个 https://example.com/doc"},
+	}
+	sum := Builder{}.Build(msgs)
+	var got Contribution
+	for _, c := range sum.Contributions {
+		if c.Name == "阿强" {
+			got = c
+		}
+	}
+	if got.Answers != 1 || got.Thanks != 1 {
+		t.Fatalf("阿强 contribution = %+v, want 1 answer and 1 thanks", got)
+	}
+
+	awards := WeeklyAwards([]Summary{sum, sum})
+	if awards.MVP == nil || awards.MVP.Name != "阿强" {
+		t.Fatalf("MVP = %+v, ranking %+v", awards.MVP, awards.Ranking)
+	}
+	for _, r := range awards.Ranking {
+		if r.Name == "老王" && r.Links != 2 {
+			t.Errorf("老王 links = %d, want 2: only the first sharer is credited", r.Links)
+		}
+		if r.Name == "小美" && r.Links != 0 {
+			t.Errorf("小美 links = %d, want 0", r.Links)
+		}
+	}
+	if len(WeeklyAwards(nil).Lines()) != 0 {
+		t.Error("an empty week should have no awards")
+	}
+}
+
+func TestEscalationCarriesAndResolves(t *testing.T) {
+	day1 := time.Date(2025, 10, 13, 9, 0, 0, 0, time.Local).Unix()
+	yesterday := Builder{}.Build([]chatlog.Message{
+		{SenderName: "小美", Timestamp: day1, Content: "测试环境谁能重启一下？", IsQuestion: true},
+		{SenderName: "老王", Timestamp: day1 + 60, Content: "CI 为什么又红了？", IsQuestion: true},
+		{SenderName: "阿强", Timestamp: day1 + 600, Content: "午饭吃啥"},
+	}).ReplyDebt
+	if len(yesterday.Outstanding) != 2 {
+		t.Fatalf("Outstanding = %+v", yesterday.Outstanding)
+	}
+	for i := range yesterday.Outstanding {
+		yesterday.Outstanding[i].Date = "2025-10-13"
+	}
+
+	day2 := day1 + 26*3600
+	msgs := []chatlog.Message{
+		{SenderName: "阿强", Timestamp: day2, Content: "@小美 重启好了", Mentions: []string{"小美"}},
+	}
+	rd := Builder{}.Build(msgs).ReplyDebt
+	Escalation{After: 24 * time.Hour, Owner: "值班"}.Escalate(&rd, "2025-10-14", yesterday.Outstanding, msgs)
+
+	if len(rd.LateResolved) != 1 || rd.LateResolved[0].Questioner != "小美" || rd.LateResolved[0].AnsweredBy != "阿强" {
+		t.Fatalf("LateResolved = %+v，应为小美的问题由阿强回复", rd.LateResolved)
+	}
+	if len(rd.Escalated) != 1 {
+		t.Fatalf("Escalated = %+v", rd.Escalated)
+	}
+	got := rd.Escalated[0]
+	if got.Questioner != "老王" || got.EscalatedOn != "2025-10-14" || got.Owner != "值班" || got.AgeMinutes < 24*60 {
+		t.Errorf("escalated item = %+v", got)
+	}
+
+	// Carried again the next day, it keeps the day it was first escalated.
+	var next ReplyDebt
+	Escalation{After: 24 * time.Hour}.Escalate(&next, "2025-10-15", rd.Escalated, nil)
+	if len(next.Escalated) != 1 || next.Escalated[0].EscalatedOn != "2025-10-14" {
+		t.Errorf("carried = %+v", next.Escalated)
+	}
+	// Past CarryDays it is dropped.
+	var late ReplyDebt
+	Escalation{After: 24 * time.Hour, CarryDays: 2}.Escalate(&late, "2025-10-16", rd.Escalated, nil)
+	if len(late.Escalated) != 0 {
+		t.Errorf("expired = %+v", late.Escalated)
+	}
+}
+
+func TestReplyMatchSimilarityFallback(t *testing.T) {
+	base := time.Date(2025, 10, 13, 10, 0, 0, 0, time.Local).Unix()
+	msgs := []chatlog.Message{
+		{SenderName: "小美", Timestamp: base, Content: "nginx upstream timeout after deploy?", IsQuestion: true},
+		{SenderName: "阿强", Timestamp: base + 120, Content: "raise the nginx upstream timeout to 60s"},
+	}
+	if got := (Builder{}).Build(msgs).ReplyDebt; len(got.Resolved) != 0 {
+		t.Fatalf("without the fallback the answer should not match: %+v", got.Resolved)
+	}
+	got := Builder{ReplyMatch: ReplyMatch{Threshold: 0.5}}.Build(msgs).ReplyDebt
+	if len(got.Resolved) != 1 || got.Resolved[0].AnsweredBy != "阿强" {
+		t.Fatalf("Resolved = %+v, Outstanding = %+v", got.Resolved, got.Outstanding)
+	}
+
+	// Too late, or below the threshold, it stays outstanding.
+	msgs[1].Timestamp = base + 3600
+	if got := (Builder{ReplyMatch: ReplyMatch{Threshold: 0.5}}).Build(msgs).ReplyDebt; len(got.Resolved) != 0 {
+		t.Errorf("answer outside the window matched: %+v", got.Resolved)
+	}
+	msgs[1].Timestamp = base + 120
+	if got := (Builder{ReplyMatch: ReplyMatch{Threshold: 0.9}}).Build(msgs).ReplyDebt; len(got.Resolved) != 0 {
+		t.Errorf("answer below the threshold matched: %+v", got.Resolved)
+	}
+
+	// A custom scorer, e.g. embeddings, replaces keyword overlap.
+	custom := ReplyMatch{Threshold: 0.8, Similarity: func(q, a string) float64 { return 0.9 }}
+	msgs[1].Content = "试试调大超时"
+	if got := (Builder{ReplyMatch: custom}).Build(msgs).ReplyDebt; len(got.Resolved) != 1 {
+		t.Errorf("custom similarity ignored: %+v", got.Outstanding)
+	}
+}
+
+func TestTopicEmbeddingClustersMessages(t *testing.T) {
+	// Two themes that share no keyword between their messages: the keyword
+	// heuristic cannot group them, the fake embedding does.
+	texts := []string{
+		"数据库 主从延迟 又报警了", "慢查询 拖垮了 数据库", "索引 重建 之后 慢查询 少了", "数据库 连接池 满了",
+		"周末 团建 去爬山", "团建 预算 批下来了", "爬山 记得 带水", "周末 天气 不错 适合 爬山",
+	}
+	var msgs []chatlog.Message
+	for _, s := range texts {
+		msgs = append(msgs, chatlog.Message{SenderName: "阿强", MsgType: 1, Content: s})
+	}
+	embed := func(in []string) ([][]float64, error) {
+		out := make([][]float64, len(in))
+		for i, s := range in {
+			if strings.Contains(s, "数据库") || strings.Contains(s, "慢查询") {
+				out[i] = []float64{1, 0.1}
+			} else {
+				out[i] = []float64{0.1, 1}
+			}
+		}
+		return out, nil
+	}
+	got := Builder{TopicEmbedding: TopicEmbedding{Embed: embed, Clusters: 2}}.Build(msgs).Topics
+	if len(got) != 2 {
+		t.Fatalf("topics = %+v, want 2 clusters", got)
+	}
+	theme := func(s string) bool { return strings.Contains(strings.Join(texts[:4], " "), s) }
+	if theme(got[0].Name) == theme(got[1].Name) {
+		t.Errorf("both topics named from one theme: %q, %q", got[0].Name, got[1].Name)
+	}
+	for _, tp := range got {
+		if !tp.Clustered || tp.Count != 4 || theme(tp.Name) != theme(tp.Representative) {
+			t.Errorf("topic = %+v", tp)
+		}
+	}
+
+	// A failing provider keeps the keyword topics.
+	failing := func([]string) ([][]float64, error) { return nil, errors.New("down") }
+	for _, tp := range (Builder{TopicEmbedding: TopicEmbedding{Embed: failing}}).Build(msgs).Topics {
+		if tp.Clustered {
+			t.Fatalf("fallback topic marked clustered: %+v", tp)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package summarize
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits message text into candidate keyword tokens. Stopword and
+// length filtering happens in the summary builder, so implementations only
+// need to segment.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// GramTokenizer is the original heuristic: ASCII words plus overlapping
+// Chinese bigrams/trigrams. It needs no dictionary but yields fragments.
+type GramTokenizer struct{}
+
+// Tokenize implements Tokenizer.
+func (GramTokenizer) Tokenize(text string) []string {
+	out := asciiTokens(text)
+	return append(out, chineseGrams(text)...)
+}
+
+// NewTokenizer resolves the tokenizer named in config. An empty name or
+// "gram" keeps the legacy behaviour; "dict" enables dictionary segmentation
+// with an optional user dictionary merged on top of the embedded one.
+func NewTokenizer(name, userDict string) (Tokenizer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "gram", "grams":
+		return GramTokenizer{}, nil
+	case "dict", "jieba":
+		seg := NewDictTokenizer()
+		if userDict != "" {
+			f, err := os.Open(userDict)
+			if err != nil {
+				return nil, fmt.Errorf("open user dict: %w", err)
+			}
+			defer f.Close()
+			if err := seg.Load(f); err != nil {
+				return nil, fmt.Errorf("load user dict: %w", err)
+			}
+		}
+		return seg, nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer %q", name)
+}
+
+// keepToken applies stopword and length filtering shared by all tokenizers
+// and returns the normalised token.
+func (ws wordSets) keepToken(tok string) (string, bool) {
+	tok = strings.TrimSpace(tok)
+	if tok == "" {
+		return "", false
+	}
+	if isASCIIWord(tok) {
+		tok = strings.ToLower(tok)
+		if ws.stopEN[tok] || len(tok) <= 2 {
+			return "", false
+		}
+		return tok, true
+	}
+	if runeLen(tok) < 2 || ws.stopCN[tok] {
+		return "", false
+	}
+	return tok, true
+}
+
+func isASCIIWord(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package summarize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// watchMaxMessages caps the matching messages kept per watchlist rule.
+const watchMaxMessages = 20
+
+// WatchRule is one watchlist entry: competitor names, "退款", "bug" and the
+// like. Patterns are case-insensitive regular expressions; plain keywords
+// work as-is.
+type WatchRule struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"`
+	// Talkers limits the rule to these talker ids; empty means all.
+	Talkers []string `json:"talkers"`
+	// Threshold marks the day for an alert once this many messages hit;
+	// 0 never alerts.
+	Threshold int `json:"threshold"`
+}
+
+// Watchlist counts the messages hitting each rule.
+type Watchlist struct {
+	rules []watchRule
+}
+
+type watchRule struct {
+	WatchRule
+	patterns []*regexp.Regexp
+}
+
+// NewWatchlist compiles rules. A nil Watchlist is returned when there are
+// none.
+func NewWatchlist(rules []WatchRule) (*Watchlist, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	w := &Watchlist{}
+	for i, r := range rules {
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name == "" {
+			return nil, fmt.Errorf("watchlist[%d]: name is required", i)
+		}
+		wr := watchRule{WatchRule: r}
+		for _, p := range r.Patterns {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("watchlist[%d] %s: invalid pattern %q: %w", i, r.Name, p, err)
+			}
+			wr.patterns = append(wr.patterns, re)
+		}
+		if len(wr.patterns) == 0 {
+			return nil, fmt.Errorf("watchlist[%d] %s: at least one pattern is required", i, r.Name)
+		}
+		w.rules = append(w.rules, wr)
+	}
+	return w, nil
+}
+
+// For returns the rules that apply to talker, or nil when none do.
+func (w *Watchlist) For(talker string) *Watchlist {
+	if w == nil {
+		return nil
+	}
+	out := &Watchlist{}
+	for _, r := range w.rules {
+		if len(r.Talkers) == 0 || containsFold(r.Talkers, talker) {
+			out.rules = append(out.rules, r)
+		}
+	}
+	if len(out.rules) == 0 {
+		return nil
+	}
+	return out
+}
+
+// WatchHit is the day's result for one watchlist rule.
+type WatchHit struct {
+	Name      string `json:"name"`
+	Hits      int    `json:"hits"`
+	Threshold int    `json:"threshold,omitempty"`
+	// Terms counts the matched text per distinct match, most frequent first.
+	Terms []KV `json:"terms,omitempty"`
+	// Messages quotes the first watchMaxMessages hits.
+	Messages []WatchMessage `json:"messages,omitempty"`
+}
+
+// Alert reports whether the hits reached the rule's threshold.
+func (h WatchHit) Alert() bool { return h.Threshold > 0 && h.Hits >= h.Threshold }
+
+// WatchMessage is one message hitting a watchlist rule.
+type WatchMessage struct {
+	At     string `json:"at,omitempty"`
+	Sender string `json:"sender"`
+	Text   string `json:"text"`
+}
+
+// build counts hits per rule in msgs; system notices are skipped. Every
+// rule is listed, quiet ones with zero hits.
+func (w *Watchlist) build(msgs []chatlog.Message) []WatchHit {
+	if w == nil {
+		return nil
+	}
+	out := make([]WatchHit, len(w.rules))
+	terms := make([]map[string]int, len(w.rules))
+	for i, r := range w.rules {
+		out[i] = WatchHit{Name: r.Name, Threshold: r.Threshold}
+		terms[i] = map[string]int{}
+	}
+	for _, m := range msgs {
+		if m.MsgType == 10000 {
+			continue
+		}
+		text := firstNonEmptyString(m.Content, m.Text)
+		if m.Share != nil {
+			text = strings.TrimSpace(m.Share.Title + " " + text)
+		}
+		if text == "" {
+			continue
+		}
+		for i, r := range w.rules {
+			hit := false
+			for _, re := range r.patterns {
+				for _, match := range re.FindAllString(text, -1) {
+					terms[i][strings.ToLower(match)]++
+					hit = true
+				}
+			}
+			if !hit {
+				continue
+			}
+			out[i].Hits++
+			if len(out[i].Messages) < watchMaxMessages {
+				wm := WatchMessage{Sender: senderDisplay(m), Text: text}
+				if r := []rune(text); len(r) > 120 {
+					wm.Text = string(r[:120]) + "…"
+				}
+				if t := messageTime(m); !t.IsZero() {
+					wm.At = t.Format("15:04")
+				}
+				out[i].Messages = append(out[i].Messages, wm)
+			}
+		}
+	}
+	for i := range out {
+		out[i].Terms = topK(terms[i], 10)
+	}
+	return out
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"wechat-view/internal/chatlog"
+)
+
+// Rule names a tag and the patterns that trigger it. Patterns are
+// case-insensitive regular expressions; plain keywords work as-is.
+type Rule struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"`
+}
+
+// Tagger applies compiled rules to messages.
+type Tagger struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+// Compile validates rules and returns a Tagger. A nil Tagger is returned when
+// no rules are configured; it matches nothing, and Apply with it clears the
+// tags earlier rules left on messages.
+func Compile(rules []Rule) (*Tagger, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	t := &Tagger{rules: make([]compiledRule, 0, len(rules))}
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			return nil, fmt.Errorf("tags[%d]: name is required", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("tags[%d]: duplicate tag %q", i, name)
+		}
+		seen[name] = true
+		cr := compiledRule{name: name}
+		for _, p := range r.Patterns {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("tags[%d] %s: invalid pattern %q: %w", i, name, p, err)
+			}
+			cr.patterns = append(cr.patterns, re)
+		}
+		if len(cr.patterns) == 0 {
+			return nil, fmt.Errorf("tags[%d] %s: at least one pattern is required", i, name)
+		}
+		t.rules = append(t.rules, cr)
+	}
+	return t, nil
+}
+
+// Match returns the tags whose patterns hit text, in rule order.
+func (t *Tagger) Match(text string) []string {
+	if t == nil || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var out []string
+	for _, r := range t.rules {
+		for _, re := range r.patterns {
+			if re.MatchString(text) {
+				out = append(out, r.name)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Apply sets Tags on every message (share titles and descriptions count as
+// text) and reports whether any message's tags changed. A nil Tagger removes
+// all tags, so deleting the last rule still clears the archive.
+func (t *Tagger) Apply(msgs []chatlog.Message) bool {
+	changed := false
+	for i := range msgs {
+		m := &msgs[i]
+		text := m.Content
+		if text == "" {
+			text = m.Text
+		}
+		if m.Share != nil {
+			text = strings.TrimSpace(text + "\n" + m.Share.Title + "\n" + m.Share.Desc)
+		}
+		got := t.Match(text)
+		if !equal(got, m.Tags) {
+			m.Tags = got
+			changed = true
+		}
+	}
+	return changed
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package tags
+
+import (
+	"strings"
+	"testing"
+
+	"wechat-view/internal/chatlog"
+)
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	cases := map[string][]Rule{
+		"name is required": {{Patterns: []string{"a"}}},
+		"duplicate tag":    {{Name: "故障", Patterns: []string{"a"}}, {Name: "故障", Patterns: []string{"b"}}},
+		"invalid pattern":  {{Name: "故障", Patterns: []string{"("}}},
+		"at least one":     {{Name: "故障", Patterns: []string{" "}}},
+	}
+	for want, rules := range cases {
+		if _, err := Compile(rules); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%v: error = %v, want %q", rules, err, want)
+		}
+	}
+	if tg, err := Compile(nil); tg != nil || err != nil {
+		t.Fatalf("no rules = %v, %v, want nil tagger", tg, err)
+	}
+}
+
+func TestMatchInRuleOrder(t *testing.T) {
+	tg, err := Compile([]Rule{
+		{Name: "发布", Patterns: []string{"上线", `release\b`}},
+		{Name: "故障", Patterns: []string{"报错", "宕机"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tg.Match("服务宕机了，RELEASE 回滚"); strings.Join(got, ",") != "发布,故障" {
+		t.Fatalf("Match = %v", got)
+	}
+	if got := tg.Match("  "); got != nil {
+		t.Fatalf("blank text matched %v", got)
+	}
+}
+
+func TestApplyReportsChanges(t *testing.T) {
+	tg, err := Compile([]Rule{{Name: "文档", Patterns: []string{"wiki"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []chatlog.Message{
+		{Content: "看看这个", Share: &chatlog.Share{Title: "部署 Wiki"}},
+		{Text: "无关"},
+		{Content: "旧标签", Tags: []string{"故障"}},
+	}
+	if !tg.Apply(msgs) {
+		t.Fatal("first Apply should report a change")
+	}
+	if strings.Join(msgs[0].Tags, ",") != "文档" || msgs[1].Tags != nil || msgs[2].Tags != nil {
+		t.Fatalf("tags = %v, %v, %v", msgs[0].Tags, msgs[1].Tags, msgs[2].Tags)
+	}
+	if tg.Apply(msgs) {
+		t.Fatal("second Apply changed nothing but reported a change")
+	}
+}
+
+func TestNilTaggerClearsTags(t *testing.T) {
+	// Deleting every rule compiles to a nil Tagger, which must still strip
+	// the tags the old rules wrote into raw files.
+	var tg *Tagger
+	msgs := []chatlog.Message{{Content: "报错", Tags: []string{"故障"}}, {Content: "早"}}
+	if !tg.Apply(msgs) || msgs[0].Tags != nil {
+		t.Fatalf("nil Apply kept %v", msgs[0].Tags)
+	}
+	if tg.Apply(msgs) {
+		t.Fatal("nil Apply on untagged messages reported a change")
+	}
+}
@@ -0,0 +1,279 @@
+// Package testkit provides programmable fake chatlog and LLM servers for
+// end-to-end checks of the report pipeline. Both servers can inject delays,
+// HTTP errors and malformed bodies so failure handling can be exercised
+// without the real services.
+package testkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"wechat-view/internal/demo"
+	"wechat-view/internal/insight"
+)
+
+// MalformedJSON is a truncated document for Fault.Body.
+const MalformedJSON = `{"messages": [{"sender": "broken"`
+
+// Fault describes how a fake server misbehaves. The zero value is healthy.
+type Fault struct {
+	// Delay is waited before answering (or until the client gives up).
+	Delay time.Duration
+	// Status, when non-zero, is returned instead of 200.
+	Status int
+	// Body, when set, replaces the normal response body.
+	Body string
+}
+
+// server is the shared fault injection and request counting.
+type server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fault    Fault
+	requests int
+}
+
+// SetFault changes the behaviour of subsequent requests.
+func (s *server) SetFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = f
+}
+
+// Requests returns how many requests the server has received.
+func (s *server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// inject applies the current fault; it reports whether the response has
+// been written already.
+func (s *server) inject(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	s.requests++
+	f := s.fault
+	s.mu.Unlock()
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if f.Status != 0 && f.Status != http.StatusOK {
+		w.WriteHeader(f.Status)
+		_, _ = w.Write([]byte(f.Body))
+		return true
+	}
+	if f.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(f.Body))
+		return true
+	}
+	return false
+}
+
+// ChatlogServer fakes the chatlog HTTP API (/api/v1/chatlog). Days without
+// explicit data are answered with deterministic demo chat.
+type ChatlogServer struct {
+	server
+	days map[string][]byte
+}
+
+// NewChatlogServer starts a fake chatlog service; call Close when done.
+func NewChatlogServer() *ChatlogServer {
+	s := &ChatlogServer{days: map[string][]byte{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/chatlog", s.handleChatlog)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetDay serves body (a chatlog API response) for day.
+func (s *ChatlogServer) SetDay(day string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.days[day] = body
+}
+
+func (s *ChatlogServer) handleChatlog(w http.ResponseWriter, r *http.Request) {
+	if s.inject(w, r) {
+		return
+	}
+	day := r.URL.Query().Get("time")
+	s.mu.Lock()
+	body, ok := s.days[day]
+	s.mu.Unlock()
+	if !ok {
+		var err error
+		if body, err = demo.Day(day); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// LLMServer fakes an OpenAI-compatible /chat/completions endpoint. By
+// default it answers with Result as the assistant message, streamed when the
+// request asks for it. Its /embeddings
+// endpoint returns character-count vectors, so texts sharing characters
+// come out similar.
+type LLMServer struct {
+	server
+	content  string
+	prompt   string
+	embedded []string
+}
+
+// SampleResult is the insight the fake LLM returns by default.
+var SampleResult = insight.Result{
+	Overview:      "测试概览：群里讨论了部署与故障排查。",
+	Highlights:    []string{"完成一次发布", "定位了超时问题"},
+	Opportunities: []string{"整理部署文档"},
+	Risks:         []string{"告警噪音偏多"},
+	Actions:       []string{"本周内补充监控"},
+	Spotlight:     "感谢值班同学的快速响应",
+}
+
+// NewLLMServer starts a fake LLM service; call Close when done.
+func NewLLMServer() *LLMServer {
+	s := &LLMServer{}
+	s.Reset()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat/completions", s.handleCompletions)
+	mux.HandleFunc("/embeddings", s.handleEmbeddings)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// LastPrompt returns the user message of the last request served.
+func (s *LLMServer) LastPrompt() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prompt
+}
+
+// Embedded returns every text sent to /embeddings so far.
+func (s *LLMServer) Embedded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.embedded...)
+}
+
+// Reset clears the fault and restores the SampleResult reply.
+func (s *LLMServer) Reset() {
+	b, _ := json.Marshal(SampleResult)
+	s.SetFault(Fault{})
+	s.SetContent(string(b))
+}
+
+// SetContent changes the assistant message text, e.g. to something that is
+// not JSON.
+func (s *LLMServer) SetContent(content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content = content
+}
+
+func (s *LLMServer) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.inject(w, r) {
+		return
+	}
+	var req struct {
+		Model    string `json:"model"`
+		Stream   bool   `json:"stream"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" || len(req.Messages) == 0 {
+		http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	content := s.content
+	prompt := 0
+	for _, m := range req.Messages {
+		if m.Role == "user" {
+			s.prompt = m.Content
+		}
+		prompt += utf8.RuneCountInString(m.Content)
+	}
+	s.mu.Unlock()
+	if req.Stream {
+		streamContent(w, content)
+		return
+	}
+	// Usage counts one token per character, so tests can predict it.
+	resp := map[string]any{
+		"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		"usage":   map[string]int{"prompt_tokens": prompt, "completion_tokens": utf8.RuneCountInString(content)},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// streamContent sends content as server-sent chat completion chunks of a few
+// characters each, ending with [DONE].
+func streamContent(w http.ResponseWriter, content string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += 4 {
+		end := min(start+4, len(runes))
+		chunk, _ := json.Marshal(map[string]any{
+			"choices": []map[string]any{{"delta": map[string]string{"content": string(runes[start:end])}}},
+		})
+		_, _ = w.Write([]byte("data: " + string(chunk) + "\n\n"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+}
+
+// embeddingDims is the length of the fake embedding vectors.
+const embeddingDims = 64
+
+func (s *LLMServer) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.inject(w, r) {
+		return
+	}
+	var req struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" || len(req.Input) == 0 {
+		http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.embedded = append(s.embedded, req.Input...)
+	s.mu.Unlock()
+	data := make([]map[string]any, len(req.Input))
+	for i, text := range req.Input {
+		vec := make([]float64, embeddingDims)
+		for _, r := range text {
+			vec[int(r)%embeddingDims]++
+		}
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": vec}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+}
@@ -0,0 +1,52 @@
+package testkit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"wechat-view/internal/chatlog"
+	"wechat-view/internal/insight"
+	"wechat-view/internal/summarize"
+)
+
+func TestChatlogServerFaults(t *testing.T) {
+	s := NewChatlogServer()
+	defer s.Close()
+	c := chatlog.Client{BaseURL: s.URL}
+	msgs, _, err := c.FetchDay("2025-10-16", "demo@chatroom", "")
+	if err != nil || len(msgs) == 0 {
+		t.Fatalf("默认应返回演示数据: %d 条, %v", len(msgs), err)
+	}
+	s.SetFault(Fault{Status: http.StatusServiceUnavailable})
+	if _, _, err := c.FetchDay("2025-10-16", "demo@chatroom", ""); err == nil {
+		t.Fatal("期望 503 时返回错误")
+	}
+	s.SetFault(Fault{Body: MalformedJSON})
+	if _, _, err := c.FetchDay("2025-10-16", "demo@chatroom", ""); err == nil {
+		t.Fatal("期望畸形响应时返回错误")
+	}
+	if s.Requests() != 3 {
+		t.Fatalf("请求计数异常: %d", s.Requests())
+	}
+}
+
+func TestLLMServerFaults(t *testing.T) {
+	s := NewLLMServer()
+	defer s.Close()
+	c := insight.Client{BaseURL: s.URL, Model: "test", Timeout: 200 * time.Millisecond}
+	res, err := c.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil)
+	if err != nil || res.Overview != SampleResult.Overview {
+		t.Fatalf("默认应返回示例洞察: %+v, %v", res, err)
+	}
+	s.SetFault(Fault{Delay: 500 * time.Millisecond})
+	if _, err := c.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil); err == nil {
+		t.Fatal("期望超时返回错误")
+	}
+	s.Reset()
+	s.SetContent("not json")
+	if _, err := c.Generate(context.Background(), "2025-10-16", "群", summarize.Summary{}, nil); err == nil {
+		t.Fatal("期望非 JSON 内容返回错误")
+	}
+}
@@ -0,0 +1,178 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// retryAfter is how long a failed fetch is remembered before the link is
+// tried again.
+const retryAfter = 7 * 24 * time.Hour
+
+// Preview is what a page says about itself, or for a shortlink where it
+// leads.
+type Preview struct {
+	Title string `json:"title,omitempty"`
+	Desc  string `json:"desc,omitempty"`
+	// Final is the expanded address of a shortlink.
+	Final string `json:"final,omitempty"`
+	// FetchedAt is when the page was fetched (RFC 3339).
+	FetchedAt string `json:"fetchedAt"`
+	// Error records why the last fetch failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Cache maps URLs to their previews. It is safe for concurrent use; a nil
+// Cache holds nothing.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Preview
+	changed bool
+}
+
+// Open loads the cache at path; a missing file yields an empty cache.
+func Open(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: map[string]Preview{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		return nil, err
+	}
+	if c.entries == nil {
+		c.entries = map[string]Preview{}
+	}
+	return c, nil
+}
+
+// Get returns the preview of url when it was fetched successfully.
+func (c *Cache) Get(url string) (Preview, bool) {
+	if c == nil {
+		return Preview{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.entries[url]
+	return p, ok && p.Error == "" && (p.Title != "" || p.Desc != "")
+}
+
+// Resolve returns where url leads when it is an expanded shortlink, and url
+// itself otherwise.
+func (c *Cache) Resolve(url string) string {
+	if c == nil {
+		return url
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p := c.entries[url]; p.Final != "" {
+		return p.Final
+	}
+	return url
+}
+
+// Fill fetches the previews of the urls that are not cached yet, and of
+// failed ones once retryAfter has passed, at most limit of them (0 means no
+// limit). It returns how many were fetched successfully.
+func (c *Cache) Fill(ctx context.Context, f *Fetcher, urls []string, limit int) int {
+	return c.fill(ctx, urls, limit, func(u string) (Preview, error) { return f.Fetch(ctx, u) })
+}
+
+// Expand resolves the shortlinks among urls the way Fill fetches previews.
+func (c *Cache) Expand(ctx context.Context, f *Fetcher, urls []string, limit int) int {
+	var short []string
+	for _, u := range urls {
+		if IsShortlink(u) {
+			short = append(short, u)
+		}
+	}
+	return c.fill(ctx, short, limit, func(u string) (Preview, error) {
+		final, err := f.Expand(ctx, u)
+		return Preview{Final: final}, err
+	})
+}
+
+func (c *Cache) fill(ctx context.Context, urls []string, limit int, fetch func(string) (Preview, error)) int {
+	if c == nil || len(urls) == 0 {
+		return 0
+	}
+	now := time.Now()
+	var todo []string
+	c.mu.Lock()
+	for _, u := range urls {
+		p, ok := c.entries[u]
+		if ok && p.Error == "" {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339, p.FetchedAt); ok && err == nil && now.Sub(at) < retryAfter {
+			continue
+		}
+		if !containsString(todo, u) {
+			todo = append(todo, u)
+		}
+	}
+	c.mu.Unlock()
+	if limit > 0 && len(todo) > limit {
+		todo = todo[:limit]
+	}
+
+	ok := 0
+	for _, u := range todo {
+		if ctx.Err() != nil {
+			break
+		}
+		p, err := fetch(u)
+		p.FetchedAt = now.Format(time.RFC3339)
+		if err != nil {
+			p = Preview{FetchedAt: p.FetchedAt, Error: err.Error()}
+		} else {
+			ok++
+		}
+		c.mu.Lock()
+		c.entries[u] = p
+		c.changed = true
+		c.mu.Unlock()
+	}
+	return ok
+}
+
+// Save writes the cache back when Fill changed it.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed || c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(c.path, data); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package unfurl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// robots holds the Allow/Disallow rules of one host that apply to us.
+type robots struct {
+	allow, disallow []string
+}
+
+// robotsFor fetches and caches the rules of u's host. A missing robots.txt
+// (any 4xx) allows everything; an unreachable one or a server error
+// disallows everything, as RFC 9309 asks.
+func (f *Fetcher) robotsFor(ctx context.Context, u *url.URL) (*robots, error) {
+	key := u.Scheme + "://" + u.Host
+	if r, ok := f.robots[key]; ok {
+		return r, nil
+	}
+	body, _, err := f.get(ctx, key+"/robots.txt", 64<<10)
+	var status *statusError
+	switch {
+	case errors.As(err, &status) && status.code >= 400 && status.code < 500:
+		body, err = nil, nil
+	case err != nil:
+		return nil, err
+	}
+	r := parseRobots(string(body), f.userAgent())
+	if f.robots == nil {
+		f.robots = map[string]*robots{}
+	}
+	f.robots[key] = r
+	return r, nil
+}
+
+// parseRobots returns the rules of the group naming agent's product token,
+// or of the "*" group when none does.
+func parseRobots(body, agent string) *robots {
+	token := strings.ToLower(agent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	var (
+		own, star *robots
+		current   []*robots
+		inRules   bool
+	)
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field, value = strings.ToLower(strings.TrimSpace(field)), strings.TrimSpace(value)
+		switch field {
+		case "user-agent":
+			if inRules {
+				current, inRules = nil, false
+			}
+			ua := strings.ToLower(value)
+			switch {
+			case ua == "*":
+				if star == nil {
+					star = &robots{}
+				}
+				current = append(current, star)
+			case token != "" && strings.Contains(token, ua):
+				if own == nil {
+					own = &robots{}
+				}
+				current = append(current, own)
+			default:
+				// A group for someone else: its rules are skipped, but
+				// it still takes part in grouping.
+				current = append(current, nil)
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			for _, r := range current {
+				if r == nil {
+					continue
+				}
+				if field == "allow" {
+					r.allow = append(r.allow, value)
+				} else {
+					r.disallow = append(r.disallow, value)
+				}
+			}
+		}
+	}
+	switch {
+	case own != nil:
+		return own
+	case star != nil:
+		return star
+	}
+	return &robots{}
+}
+
+// allowed applies the longest matching rule to path; Allow wins ties.
+func (r *robots) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	best, allow := -1, true
+	for _, p := range r.allow {
+		if n := matchLen(p, path); n > best {
+			best, allow = n, true
+		}
+	}
+	for _, p := range r.disallow {
+		if n := matchLen(p, path); n > best {
+			best, allow = n, false
+		}
+	}
+	return allow
+}
+
+// matchLen returns len(pattern) when pattern matches the start of path, or
+// -1. "*" matches any run of characters and a trailing "$" anchors the end.
+func matchLen(pattern, path string) int {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	rest := path
+	for i, part := range parts {
+		if i == 0 {
+			if !strings.HasPrefix(rest, part) {
+				return -1
+			}
+			rest = rest[len(part):]
+			continue
+		}
+		j := strings.Index(rest, part)
+		if i == len(parts)-1 && anchored {
+			j = strings.LastIndex(rest, part)
+		}
+		if j < 0 {
+			return -1
+		}
+		rest = rest[j+len(part):]
+	}
+	if anchored && rest != "" {
+		return -1
+	}
+	return len(pattern)
+}
@@ -0,0 +1,92 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxHops bounds the redirects followed when expanding a shortlink.
+const maxHops = 5
+
+// shortlinkHosts are URL shorteners whose links are expanded.
+var shortlinkHosts = []string{
+	"t.cn", "url.cn", "b23.tv", "dwz.cn", "suo.im", "m.tb.cn", "v.douyin.com",
+	"xhslink.com", "v.kuaishou.com", "reurl.cc", "bit.ly", "t.co", "tinyurl.com",
+	"goo.gl", "j.mp", "is.gd", "ow.ly", "buff.ly", "rebrand.ly", "cutt.ly", "s.id",
+}
+
+// IsShortlink reports whether rawURL points at a known URL shortener.
+func IsShortlink(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, h := range shortlinkHosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand follows rawURL's redirects, through chained shorteners too, and
+// returns the first address that is not a shortlink. Only the redirect
+// responses are read; the target page is not fetched.
+func (f *Fetcher) Expand(ctx context.Context, rawURL string) (string, error) {
+	client := *f.client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	current := rawURL
+	for hop := 0; hop < maxHops; hop++ {
+		next, err := f.location(ctx, &client, current)
+		if err != nil {
+			return "", err
+		}
+		if next == "" {
+			return "", fmt.Errorf("%s did not redirect", current)
+		}
+		if !IsShortlink(next) {
+			return next, nil
+		}
+		current = next
+	}
+	return "", fmt.Errorf("more than %d redirects", maxHops)
+}
+
+// location returns where rawURL redirects to, or "" when it does not. HEAD
+// is tried first; some shorteners only answer GET.
+func (f *Fetcher) location(ctx context.Context, client *http.Client, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+	var lastErr error
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", f.userAgent())
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 16<<10))
+		resp.Body.Close()
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			loc, err := resp.Location()
+			if err != nil {
+				return "", err
+			}
+			return loc.String(), nil
+		}
+		if resp.StatusCode == http.StatusOK {
+			return "", nil
+		}
+		lastErr = &statusError{code: resp.StatusCode}
+	}
+	return "", lastErr
+}
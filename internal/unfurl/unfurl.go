@@ -0,0 +1,217 @@
+// Package unfurl fetches the title and description of bare links shared in
+// chat, so day pages and the link library can show more than a host name.
+// Pages are fetched once with a timeout and a size cap, robots.txt is
+// honoured, and results are kept in one JSON file (data/unfurl.json) that
+// later runs and recalc read without going back to the network.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultUserAgent identifies the fetcher to sites and in robots.txt.
+const DefaultUserAgent = "wechat-view-unfurl/1.0 (+https://github.com/myysophia/wechat-view)"
+
+// ErrDisallowed is returned for pages robots.txt asks us not to fetch.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+var errPrivateAddr = errors.New("refusing to fetch a private or loopback address")
+
+// Fetcher downloads pages and extracts their preview. It remembers each
+// host's robots.txt and is not safe for concurrent use.
+type Fetcher struct {
+	// Timeout bounds each request, robots.txt included; 0 means 5s.
+	Timeout time.Duration
+	// MaxBytes is how much of a page is read; 0 means 256 KiB. Titles and
+	// descriptions sit in the head, so the rest is not needed.
+	MaxBytes  int64
+	UserAgent string
+	// AllowPrivate permits loopback and private network addresses. Links
+	// come from chat members, so they are refused by default to keep the
+	// fetcher from probing the network it runs in.
+	AllowPrivate bool
+	// HTTP overrides the client, for tests.
+	HTTP *http.Client
+
+	robots map[string]*robots
+}
+
+// Fetch returns the preview of rawURL.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Preview{}, fmt.Errorf("not an http(s) URL: %q", rawURL)
+	}
+	rules, err := f.robotsFor(ctx, u)
+	if err != nil {
+		return Preview{}, fmt.Errorf("robots.txt: %w", err)
+	}
+	if !rules.allowed(u.RequestURI()) {
+		return Preview{}, ErrDisallowed
+	}
+	body, ctype, err := f.get(ctx, u.String(), f.maxBytes())
+	if err != nil {
+		return Preview{}, err
+	}
+	if mt, _, _ := mime.ParseMediaType(ctype); mt != "" && mt != "text/html" && mt != "application/xhtml+xml" {
+		return Preview{}, fmt.Errorf("not an HTML page: %s", mt)
+	}
+	if !utf8.Valid(body) {
+		// Legacy GBK pages would come out garbled; keep the host instead.
+		return Preview{}, errors.New("page is not UTF-8")
+	}
+	p := parse(string(body))
+	if p.Title == "" && p.Desc == "" {
+		return Preview{}, errors.New("no title or description")
+	}
+	return p, nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL string, limit int64) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &statusError{code: resp.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, "", err
+	}
+	// A page cut at the cap may end mid-rune; drop the partial rune.
+	for i := 0; i < utf8.UTFMax && len(body) > 0 && !utf8.Valid(body); i++ {
+		body = body[:len(body)-1]
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+type statusError struct{ code int }
+
+func (e *statusError) Error() string { return fmt.Sprintf("status %d", e.code) }
+
+func (f *Fetcher) client() *http.Client {
+	if f.HTTP != nil {
+		return f.HTTP
+	}
+	dialer := &net.Dialer{Timeout: f.timeout()}
+	if !f.AllowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return errPrivateAddr
+			}
+			return nil
+		}
+	}
+	// No proxy: the dialer would then check the proxy's address, not the
+	// page's, and any link could reach internal hosts through it.
+	f.HTTP = &http.Client{Transport: &http.Transport{
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: f.timeout(),
+	}}
+	return f.HTTP
+}
+
+func (f *Fetcher) timeout() time.Duration {
+	if f.Timeout > 0 {
+		return f.Timeout
+	}
+	return 5 * time.Second
+}
+
+func (f *Fetcher) maxBytes() int64 {
+	if f.MaxBytes > 0 {
+		return f.MaxBytes
+	}
+	return 256 << 10
+}
+
+func (f *Fetcher) userAgent() string {
+	if f.UserAgent != "" {
+		return f.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+var (
+	titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrRe  = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	spaceRe = regexp.MustCompile(`\s+`)
+)
+
+// parse extracts the page title (og:title when <title> is missing) and
+// og:description (or the description meta tag).
+func parse(page string) Preview {
+	var p Preview
+	if m := titleRe.FindStringSubmatch(page); m != nil {
+		p.Title = clean(m[1], 120)
+	}
+	var ogTitle, ogDesc, desc string
+	for _, tag := range metaRe.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, a := range attrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3]
+		}
+		key := strings.ToLower(firstNonEmpty(attrs["property"], attrs["name"]))
+		switch key {
+		case "og:title":
+			ogTitle = attrs["content"]
+		case "og:description":
+			ogDesc = attrs["content"]
+		case "description":
+			desc = attrs["content"]
+		}
+	}
+	if p.Title == "" {
+		p.Title = clean(ogTitle, 120)
+	}
+	p.Desc = clean(firstNonEmpty(ogDesc, desc), 240)
+	return p
+}
+
+func clean(s string, max int) string {
+	s = strings.TrimSpace(spaceRe.ReplaceAllString(html.UnescapeString(s), " "))
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
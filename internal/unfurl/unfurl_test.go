@@ -0,0 +1,159 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFetchHonoursRobotsAndCaches(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	count := func(paths ...string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, p := range paths {
+			n += hits[p]
+		}
+		return n
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\nAllow: /private/ok\n\nUser-agent: other\nDisallow: /\n"))
+		case "/post", "/private/ok":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head><title>
+  Go 1.21 &amp; 发布说明 </title><meta property="og:description" content="新版本的主要变化"></head><body>` + strings.Repeat("x", 1<<20) + `</body></html>`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{AllowPrivate: true, MaxBytes: 4 << 10}
+	p, err := f.Fetch(context.Background(), srv.URL+"/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "Go 1.21 & 发布说明" || p.Desc != "新版本的主要变化" {
+		t.Fatalf("preview = %+v", p)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/private/x"); !errors.Is(err, ErrDisallowed) {
+		t.Fatalf("disallowed path: err = %v", err)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/private/ok"); err != nil {
+		t.Fatalf("allowed subpath: %v", err)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/image"); err == nil {
+		t.Fatal("expected an error for a non-HTML page")
+	}
+	if n := count("/robots.txt"); n != 1 {
+		t.Fatalf("robots.txt fetched %d times, want 1", n)
+	}
+
+	path := filepath.Join(t.TempDir(), "unfurl.json")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{srv.URL + "/post", srv.URL + "/missing", srv.URL + "/post"}
+	if n := c.Fill(context.Background(), f, urls, 0); n != 1 {
+		t.Fatalf("Fill = %d, want 1", n)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = Open(path)
+	if p, ok := c.Get(srv.URL + "/post"); !ok || p.Title == "" {
+		t.Fatalf("cached preview = %+v, %v", p, ok)
+	}
+	if _, ok := c.Get(srv.URL + "/missing"); ok {
+		t.Fatal("failed fetches should not be returned")
+	}
+	before := count("/post", "/missing")
+	c.Fill(context.Background(), f, urls, 0)
+	if after := count("/post", "/missing"); after != before {
+		t.Fatalf("cached and recently failed links were refetched (%d requests)", after-before)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>internal</title>"))
+	}))
+	defer srv.Close()
+	if _, err := (&Fetcher{}).Fetch(context.Background(), srv.URL+"/admin"); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Fatalf("err = %v, want a private address refusal", err)
+	}
+	if tr := (&Fetcher{}).client().Transport.(*http.Transport); tr.Proxy != nil {
+		t.Fatal("fetcher uses a proxy, which would bypass the address check")
+	}
+}
+
+func TestRobotsMatching(t *testing.T) {
+	r := parseRobots("User-agent: wechat-view-unfurl\nDisallow: /*.pdf$\nDisallow: /tmp\n\nUser-agent: *\nDisallow: /\n", DefaultUserAgent)
+	for path, want := range map[string]bool{"/": true, "/a.pdf": false, "/a.pdf?x": true, "/tmp/x": false, "/docs": true} {
+		if got := r.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestExpandFollowsChainedShortlinks(t *testing.T) {
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host + r.URL.Path {
+		case "t.cn/abc":
+			// Answers GET only, like some shorteners.
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "http://bit.ly/x", http.StatusFound)
+		case "bit.ly/x":
+			http.Redirect(w, r, "http://example.com/post?utm_source=x", http.StatusMovedPermanently)
+		default:
+			gets++
+			_, _ = w.Write([]byte("<title>target</title>"))
+		}
+	}))
+	defer srv.Close()
+	// Every host is served by srv.
+	addr := srv.Listener.Addr().String()
+	f := &Fetcher{HTTP: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}}
+	if !IsShortlink("http://t.cn/abc") || IsShortlink("https://example.com/t.cn") {
+		t.Fatal("IsShortlink misclassified")
+	}
+	c, _ := Open(filepath.Join(t.TempDir(), "unfurl.json"))
+	urls := []string{"http://t.cn/abc", "http://example.com/plain"}
+	if n := c.Expand(context.Background(), f, urls, 0); n != 1 {
+		t.Fatalf("Expand = %d, want 1", n)
+	}
+	if got := c.Resolve("http://t.cn/abc"); got != "http://example.com/post?utm_source=x" {
+		t.Fatalf("Resolve = %q", got)
+	}
+	if got := c.Resolve("http://example.com/plain"); got != "http://example.com/plain" {
+		t.Fatalf("non-shortlinks should resolve to themselves, got %q", got)
+	}
+	if gets != 0 {
+		t.Fatalf("the target page was fetched %d times", gets)
+	}
+}
@@ -0,0 +1,227 @@
+// Package usage keeps a ledger of LLM token usage with cost estimates per
+// day and model. It is persisted as one JSON file (data/llm-usage.json) that
+// the generator and the API server both add to, like claims.json.
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// FileName is the ledger's name in the data directory.
+const FileName = "llm-usage.json"
+
+// Price is what 1000 prompt and completion tokens cost.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Cost estimates the cost of one request.
+func (p Price) Cost(prompt, completion int) float64 {
+	return (float64(prompt)*p.Prompt + float64(completion)*p.Completion) / 1000
+}
+
+// Entry is the usage of one model, or of all, over a period.
+type Entry struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (e *Entry) add(o Entry) {
+	e.Requests += o.Requests
+	e.PromptTokens += o.PromptTokens
+	e.CompletionTokens += o.CompletionTokens
+	e.Cost += o.Cost
+}
+
+// Ledger is the usage recorded so far.
+type Ledger struct {
+	// Currency is the currency of the costs, from llm.pricing.
+	Currency string `json:"currency,omitempty"`
+	// Days maps YYYY-MM-DD to model to that day's usage.
+	Days map[string]map[string]Entry `json:"days"`
+}
+
+// Load reads the ledger at path; a missing file yields an empty ledger.
+func Load(path string) (Ledger, error) {
+	l := Ledger{Days: map[string]map[string]Entry{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return l, err
+	}
+	if l.Days == nil {
+		l.Days = map[string]map[string]Entry{}
+	}
+	return l, nil
+}
+
+// Period is the usage of a day or month, in total and by model.
+type Period struct {
+	Period string `json:"period"`
+	Entry
+	Models map[string]Entry `json:"models"`
+}
+
+// Day returns the usage of day (YYYY-MM-DD).
+func (l Ledger) Day(day string) Period {
+	return l.sum(day, func(d string) bool { return d == day })
+}
+
+// Month returns the usage of month (YYYY-MM).
+func (l Ledger) Month(month string) Period {
+	return l.sum(month, func(d string) bool { return strings.HasPrefix(d, month+"-") })
+}
+
+// DaysOf returns the usage of each recorded day whose date starts with
+// prefix ("" for all), oldest first.
+func (l Ledger) DaysOf(prefix string) []Period {
+	var out []Period
+	for d := range l.Days {
+		if strings.HasPrefix(d, prefix) {
+			out = append(out, l.Day(d))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Period < out[j].Period })
+	return out
+}
+
+// Months returns the usage of each recorded month, oldest first.
+func (l Ledger) Months() []Period {
+	seen := map[string]bool{}
+	var out []Period
+	for d := range l.Days {
+		if m := d[:min(len(d), 7)]; !seen[m] {
+			seen[m] = true
+			out = append(out, l.Month(m))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Period < out[j].Period })
+	return out
+}
+
+func (l Ledger) sum(name string, match func(day string) bool) Period {
+	p := Period{Period: name, Models: map[string]Entry{}}
+	for d, models := range l.Days {
+		if !match(d) {
+			continue
+		}
+		for model, e := range models {
+			p.Entry.add(e)
+			m := p.Models[model]
+			m.add(e)
+			p.Models[model] = m
+		}
+	}
+	return p
+}
+
+// Meter records the usage of a process's requests and adds it to the
+// ledger file on Flush. It is safe for concurrent use; a nil Meter records
+// nothing.
+type Meter struct {
+	path     string
+	prices   map[string]Price
+	currency string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]map[string]Entry
+	total   Entry
+}
+
+// NewMeter returns a Meter for the ledger at path, pricing models by name.
+func NewMeter(path string, prices map[string]Price, currency string) *Meter {
+	return &Meter{path: path, prices: prices, currency: currency, now: time.Now, pending: map[string]map[string]Entry{}}
+}
+
+// Record adds one request of model, dated today.
+func (m *Meter) Record(model string, prompt, completion int) {
+	if m == nil {
+		return
+	}
+	e := Entry{Requests: 1, PromptTokens: prompt, CompletionTokens: completion, Cost: m.prices[model].Cost(prompt, completion)}
+	day := m.now().Format("2006-01-02")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending[day] == nil {
+		m.pending[day] = map[string]Entry{}
+	}
+	p := m.pending[day][model]
+	p.add(e)
+	m.pending[day][model] = p
+	m.total.add(e)
+}
+
+// Total is everything recorded by this Meter, flushed or not.
+func (m *Meter) Total() Entry {
+	if m == nil {
+		return Entry{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// Currency is the currency of the Meter's costs.
+func (m *Meter) Currency() string {
+	if m == nil {
+		return ""
+	}
+	return m.currency
+}
+
+// Flush adds the usage recorded since the last Flush to the ledger file,
+// re-reading it first so other processes' additions are kept, and returns
+// the updated ledger.
+func (m *Meter) Flush() (Ledger, error) {
+	if m == nil {
+		return Ledger{}, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, err := Load(m.path)
+	if err != nil {
+		return l, err
+	}
+	if len(m.pending) == 0 {
+		return l, nil
+	}
+	for day, models := range m.pending {
+		if l.Days[day] == nil {
+			l.Days[day] = map[string]Entry{}
+		}
+		for model, e := range models {
+			sum := l.Days[day][model]
+			sum.add(e)
+			l.Days[day][model] = sum
+		}
+	}
+	if m.currency != "" {
+		l.Currency = m.currency
+	}
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return l, err
+	}
+	if err := atomicfile.WriteFile(m.path, b); err != nil {
+		return l, err
+	}
+	m.pending = map[string]map[string]Entry{}
+	return l, nil
+}
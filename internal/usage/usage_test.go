@@ -0,0 +1,60 @@
+package usage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMeterFlushMergesLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	prices := map[string]Price{"gpt": {Prompt: 0.5, Completion: 1.5}}
+
+	first := NewMeter(path, prices, "USD")
+	first.now = func() time.Time { return time.Date(2025, 9, 30, 23, 0, 0, 0, time.UTC) }
+	first.Record("gpt", 1000, 200)
+	first.Record("local", 500, 100)
+	if _, err := first.Flush(); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	// 另一个进程稍后写入，不应覆盖已有记录。
+	second := NewMeter(path, prices, "USD")
+	second.now = func() time.Time { return time.Date(2025, 10, 1, 8, 0, 0, 0, time.UTC) }
+	second.Record("gpt", 2000, 0)
+	second.Record("gpt", 2000, 1000)
+	l, err := second.Flush()
+	if err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if got := second.Total(); got.Requests != 2 || got.PromptTokens != 4000 || math.Abs(got.Cost-3.5) > 1e-9 {
+		t.Fatalf("本次运行统计不对: %+v", got)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if reloaded.Currency != "USD" || len(reloaded.Days) != 2 || len(l.Days) != 2 {
+		t.Fatalf("账本内容不对: %+v", reloaded)
+	}
+	sep := reloaded.Month("2025-09")
+	if sep.Requests != 2 || math.Abs(sep.Cost-0.8) > 1e-9 || sep.Models["local"].Cost != 0 {
+		t.Fatalf("9 月汇总不对: %+v", sep)
+	}
+	if months := reloaded.Months(); len(months) != 2 || months[0].Period != "2025-09" || months[1].Requests != 2 {
+		t.Fatalf("按月汇总不对: %+v", months)
+	}
+	if days := reloaded.DaysOf("2025-10"); len(days) != 1 || days[0].CompletionTokens != 1000 {
+		t.Fatalf("按日汇总不对: %+v", days)
+	}
+}
+
+func TestNilMeterIsNoop(t *testing.T) {
+	var m *Meter
+	m.Record("gpt", 1, 1)
+	if _, err := m.Flush(); err != nil || m.Total().Requests != 0 {
+		t.Fatalf("nil Meter 应忽略记录: %v", err)
+	}
+}
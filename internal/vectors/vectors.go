@@ -0,0 +1,274 @@
+// Package vectors is the local semantic search index: one file of message
+// embeddings per archived day under data/vectors, searched by brute-force
+// cosine similarity.
+package vectors
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// Entry is one embedded message.
+type Entry struct {
+	Sender string `json:"sender,omitempty"`
+	// Time is when the message was sent (Unix seconds), 0 if unknown.
+	Time int64  `json:"time,omitempty"`
+	Text string `json:"text"`
+	// Vector is the unit-length embedding of Text.
+	Vector []float32 `json:"vector"`
+}
+
+// Day is the index file of one archived day of one talker.
+type Day struct {
+	Talker string `json:"talker"`
+	Model  string `json:"model"`
+	// Fingerprint is the raw day's archive.Fingerprint when it was
+	// embedded; a different one means the day has to be embedded again.
+	Fingerprint string  `json:"fingerprint"`
+	Entries     []Entry `json:"entries"`
+}
+
+// Path is where day's index is stored under dataDir.
+func Path(dataDir, day string) string {
+	return filepath.Join(dataDir, "vectors", day+".json")
+}
+
+// Load reads day's index from dataDir.
+func Load(dataDir, day string) (Day, error) {
+	var d Day
+	b, err := os.ReadFile(Path(dataDir, day))
+	if err != nil {
+		return d, err
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return d, fmt.Errorf("parse %s vectors: %w", day, err)
+	}
+	return d, nil
+}
+
+// Save writes day's index to dataDir, normalizing the vectors.
+func Save(dataDir, day string, d Day) error {
+	for i := range d.Entries {
+		d.Entries[i].Vector = Normalize(d.Entries[i].Vector)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(Path(dataDir, day)), 0o755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(Path(dataDir, day), b)
+}
+
+// Normalize returns v scaled to unit length as float32, or v unchanged when
+// it is all zeros.
+func Normalize[F float32 | float64](v []F) []float32 {
+	sum := 0.0
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		if norm == 0 {
+			out[i] = float32(x)
+		} else {
+			out[i] = float32(float64(x) / norm)
+		}
+	}
+	return out
+}
+
+// Query narrows a search. Empty fields do not filter.
+type Query struct {
+	Vector []float64
+	// From and To bound the days searched (YYYY-MM-DD, inclusive).
+	From, To string
+	Talker   string
+	// Limit is how many hits to return; 0 means 10.
+	Limit int
+	// MinScore drops hits less similar than this.
+	MinScore float64
+}
+
+// Hit is a message found by a search.
+type Hit struct {
+	Date   string  `json:"date"`
+	Talker string  `json:"talker"`
+	Sender string  `json:"sender,omitempty"`
+	Time   string  `json:"time,omitempty"`
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+}
+
+// DefaultCacheBytes bounds the memory an Index spends on cached days.
+const DefaultCacheBytes = 256 << 20
+
+// Index searches the day files under a data directory, caching each until
+// its file changes. The cache keeps the most recently searched days up to
+// DefaultCacheBytes of vectors and text; days beyond that are read from
+// disk on every search. It is safe for concurrent use.
+type Index struct {
+	dataDir  string
+	maxBytes int64
+
+	mu    sync.Mutex
+	order *list.List // most recently used first, values are *cachedDay
+	days  map[string]*list.Element
+	bytes int64
+}
+
+type cachedDay struct {
+	date    string
+	modTime time.Time
+	bytes   int64
+	day     Day
+}
+
+// NewIndex returns an index over dataDir/vectors.
+func NewIndex(dataDir string) *Index {
+	return &Index{dataDir: dataDir, maxBytes: DefaultCacheBytes, order: list.New(), days: map[string]*list.Element{}}
+}
+
+// Search returns the messages most similar to q.Vector, best first. Days
+// embedded with another model than model are skipped, since their vectors
+// are not comparable; an empty model searches every day.
+func (ix *Index) Search(q Query, model string) ([]Hit, error) {
+	days, err := ix.listDays()
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	query := Normalize(q.Vector)
+	var hits []Hit
+	for _, day := range days {
+		if (q.From != "" && day < q.From) || (q.To != "" && day > q.To) {
+			continue
+		}
+		d, err := ix.load(day)
+		if err != nil {
+			return nil, err
+		}
+		if (q.Talker != "" && d.Talker != q.Talker) || (model != "" && d.Model != "" && d.Model != model) {
+			continue
+		}
+		for _, e := range d.Entries {
+			if len(e.Vector) != len(query) {
+				continue
+			}
+			score := dot(query, e.Vector)
+			if score < q.MinScore {
+				continue
+			}
+			h := Hit{Date: day, Talker: d.Talker, Sender: e.Sender, Text: e.Text, Score: math.Round(score*1000) / 1000}
+			if e.Time > 0 {
+				h.Time = time.Unix(e.Time, 0).Local().Format(time.RFC3339)
+			}
+			hits = append(hits, h)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Date > hits[j].Date
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// listDays returns the days with an index file, oldest first.
+func (ix *Index) listDays() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(ix.dataDir, "vectors"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".json" || atomicfile.IsTemp(name) {
+			continue
+		}
+		day := name[:len(name)-len(".json")]
+		if _, err := time.Parse("2006-01-02", day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+func (ix *Index) load(day string) (Day, error) {
+	info, err := os.Stat(Path(ix.dataDir, day))
+	if err != nil {
+		return Day{}, err
+	}
+	ix.mu.Lock()
+	if el, ok := ix.days[day]; ok {
+		if c := el.Value.(*cachedDay); c.modTime.Equal(info.ModTime()) {
+			ix.order.MoveToFront(el)
+			ix.mu.Unlock()
+			return c.day, nil
+		}
+	}
+	ix.mu.Unlock()
+	d, err := Load(ix.dataDir, day)
+	if err != nil {
+		return Day{}, err
+	}
+	c := &cachedDay{date: day, modTime: info.ModTime(), bytes: d.size(), day: d}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if el, ok := ix.days[day]; ok {
+		ix.bytes -= el.Value.(*cachedDay).bytes
+		el.Value = c
+		ix.order.MoveToFront(el)
+	} else {
+		ix.days[day] = ix.order.PushFront(c)
+	}
+	ix.bytes += c.bytes
+	for ix.bytes > ix.maxBytes && ix.order.Len() > 0 {
+		el := ix.order.Back()
+		ix.order.Remove(el)
+		old := el.Value.(*cachedDay)
+		delete(ix.days, old.date)
+		ix.bytes -= old.bytes
+	}
+	return d, nil
+}
+
+// size estimates the memory d takes once loaded.
+func (d Day) size() int64 {
+	n := int64(len(d.Talker) + len(d.Model) + len(d.Fingerprint))
+	for _, e := range d.Entries {
+		n += 64 + int64(len(e.Sender)+len(e.Text)) + 4*int64(len(e.Vector))
+	}
+	return n
+}
+
+func dot(a, b []float32) float64 {
+	s := 0.0
+	for i := 0; i < len(a) && i < len(b); i++ {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package vectors
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSearchFiltersByTalkerAndModel(t *testing.T) {
+	dir := t.TempDir()
+	if err := Save(dir, "2025-10-15", Day{Talker: "a", Model: "m", Entries: []Entry{{Text: "x", Vector: []float32{3, 4}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(dir, "2025-10-16", Day{Talker: "b", Model: "m", Entries: []Entry{{Text: "y", Vector: []float32{4, 3}}}}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Load(dir, "2025-10-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := d.Entries[0].Vector; math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 {
+		t.Fatalf("saved vector not normalized: %v", v)
+	}
+
+	ix := NewIndex(dir)
+	hits, err := ix.Search(Query{Vector: []float64{1, 0}}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Text != "y" || hits[0].Score != 0.8 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if hits, _ := ix.Search(Query{Vector: []float64{1, 0}, Talker: "a"}, "m"); len(hits) != 1 || hits[0].Text != "x" {
+		t.Fatalf("talker filter: %+v", hits)
+	}
+	if hits, _ := ix.Search(Query{Vector: []float64{1, 0}}, "other"); len(hits) != 0 {
+		t.Fatalf("vectors of another model compared: %+v", hits)
+	}
+}
+
+func TestIndexCacheIsBounded(t *testing.T) {
+	dir := t.TempDir()
+	days := []string{"2025-10-14", "2025-10-15", "2025-10-16"}
+	for _, day := range days {
+		if err := Save(dir, day, Day{Talker: "a", Model: "m", Entries: []Entry{{Text: day, Vector: make([]float32, 256)}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := Load(dir, days[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndex(dir)
+	ix.maxBytes = 2 * d.size()
+
+	hits, err := ix.Search(Query{Vector: make([]float64, 256)}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("evicted days must still be searched: %+v", hits)
+	}
+	if ix.order.Len() != 2 || ix.bytes != 2*d.size() {
+		t.Fatalf("cache holds %d days, %d bytes; want 2 days, %d bytes", ix.order.Len(), ix.bytes, 2*d.size())
+	}
+	if _, ok := ix.days[days[0]]; ok {
+		t.Fatalf("least recently used day was kept")
+	}
+
+	// a cached day that changes on disk is replaced, not counted twice
+	if err := Save(dir, days[2], Day{Talker: "a", Model: "m", Entries: []Entry{{Text: "x", Vector: make([]float32, 256)}}}); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(Path(dir, days[2]), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.load(days[2]); err != nil {
+		t.Fatal(err)
+	}
+	var sum int64
+	for el := ix.order.Front(); el != nil; el = el.Next() {
+		sum += el.Value.(*cachedDay).bytes
+	}
+	if ix.order.Len() != 2 || ix.bytes != sum || ix.bytes > ix.maxBytes {
+		t.Fatalf("cache accounting off after reload: %d days, %d bytes (sum %d)", ix.order.Len(), ix.bytes, sum)
+	}
+}
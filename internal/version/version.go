@@ -0,0 +1,152 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wechat-view/internal/atomicfile"
+)
+
+// Version is the program version, set at build time with
+// -ldflags "-X wechat-view/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// DefaultRepo is the GitHub repository whose releases are checked.
+const DefaultRepo = "myysophia/wechat-view"
+
+// Release is the latest published release.
+type Release struct {
+	Tag       string    `json:"tag"`
+	URL       string    `json:"url"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Checker queries GitHub Releases, caching the answer on disk so scheduled
+// runs hit the API at most once per TTL.
+type Checker struct {
+	Repo      string
+	CachePath string
+	TTL       time.Duration
+	HTTP      *http.Client
+	// BaseURL overrides https://api.github.com (tests, GitHub Enterprise).
+	BaseURL string
+}
+
+// Latest returns the newest release, from cache when still fresh.
+func (c Checker) Latest(ctx context.Context) (Release, error) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if rel, ok := c.cached(ttl); ok {
+		return rel, nil
+	}
+	repo := c.Repo
+	if repo == "" {
+		repo = DefaultRepo
+	}
+	base := strings.TrimRight(c.BaseURL, "/")
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/repos/"+repo+"/releases/latest", nil)
+	if err != nil {
+		return Release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "wechat-view/"+Version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Release{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Release{}, fmt.Errorf("github releases: http %d", resp.StatusCode)
+	}
+	var body struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Release{}, err
+	}
+	if body.TagName == "" {
+		return Release{}, errors.New("github releases: empty tag")
+	}
+	rel := Release{Tag: body.TagName, URL: body.HTMLURL, CheckedAt: time.Now()}
+	c.store(rel)
+	return rel, nil
+}
+
+func (c Checker) cached(ttl time.Duration) (Release, bool) {
+	if c.CachePath == "" {
+		return Release{}, false
+	}
+	b, err := os.ReadFile(c.CachePath)
+	if err != nil {
+		return Release{}, false
+	}
+	var rel Release
+	if json.Unmarshal(b, &rel) != nil || rel.Tag == "" || time.Since(rel.CheckedAt) > ttl {
+		return Release{}, false
+	}
+	return rel, true
+}
+
+func (c Checker) store(rel Release) {
+	if c.CachePath == "" {
+		return
+	}
+	b, err := json.Marshal(rel)
+	if err != nil {
+		return
+	}
+	_ = atomicfile.WriteFile(c.CachePath, b)
+}
+
+// Newer reports whether latest is a higher semantic version than current.
+// Development builds ("dev" or unparsable) never report an update.
+func Newer(latest, current string) bool {
+	l, ok1 := parse(latest)
+	c, ok2 := parse(current)
+	if !ok1 || !ok2 {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parse(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
@@ -0,0 +1,50 @@
+package version
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	cases := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.2.0", "1.2.0", false},
+		{"v1.10.0", "v1.9.3", true},
+		{"v2.0.0-rc1", "v1.9.0", true},
+		{"v1.0.0", "dev", false},
+	}
+	for _, c := range cases {
+		if got := Newer(c.latest, c.current); got != c.want {
+			t.Errorf("Newer(%s, %s) = %v，期望 %v", c.latest, c.current, got, c.want)
+		}
+	}
+}
+
+func TestCheckerCachesRelease(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"tag_name":"v1.3.0","html_url":"https://github.com/x/y/releases/v1.3.0"}`))
+	}))
+	defer srv.Close()
+
+	c := Checker{BaseURL: srv.URL, CachePath: filepath.Join(t.TempDir(), "latest.json")}
+	for i := 0; i < 2; i++ {
+		rel, err := c.Latest(context.Background())
+		if err != nil {
+			t.Fatalf("检查版本失败: %v", err)
+		}
+		if rel.Tag != "v1.3.0" {
+			t.Fatalf("版本号异常: %s", rel.Tag)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("期望命中缓存只请求 1 次，实际 %d 次", calls)
+	}
+}
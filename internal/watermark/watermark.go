@@ -0,0 +1,139 @@
+// Package watermark hides short provenance payloads in page text using
+// zero-width characters, so copied or exported text can be traced back to a
+// generation run and, in serve mode, to the viewer who opened it.
+package watermark
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	zero      = '\u200b' // zero width space
+	one       = '\u200c' // zero width non-joiner
+	markOpen  = "\u2060\u200d"
+	markClose = "\u200d\u2060"
+)
+
+// Slot marks where serve mode injects the viewer mark. It is invisible and
+// distinct from encoded payloads, so static pages simply carry it unused.
+const Slot = "\u2063\u2062\u2063"
+
+// Mark is the provenance carried by a watermark.
+type Mark struct {
+	Viewer string
+	Source string
+	Time   time.Time
+}
+
+// Values are percent-escaped so a ";" or "=" in a viewer or talker name
+// cannot split a field or forge another one.
+var (
+	escaper   = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D")
+	unescaper = strings.NewReplacer("%25", "%", "%3B", ";", "%3D", "=")
+)
+
+// String serialises the mark as "key=value" pairs; empty fields are omitted.
+func (m Mark) String() string {
+	var parts []string
+	if m.Viewer != "" {
+		parts = append(parts, "v="+escaper.Replace(m.Viewer))
+	}
+	if m.Source != "" {
+		parts = append(parts, "s="+escaper.Replace(m.Source))
+	}
+	if !m.Time.IsZero() {
+		parts = append(parts, "t="+m.Time.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(parts, ";")
+}
+
+// ParseMark reverses Mark.String; unknown keys are ignored.
+func ParseMark(s string) Mark {
+	var m Mark
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "v":
+			m.Viewer = unescaper.Replace(v)
+		case "s":
+			m.Source = unescaper.Replace(v)
+		case "t":
+			m.Time, _ = time.Parse(time.RFC3339, v)
+		}
+	}
+	return m
+}
+
+// Encode renders payload as an invisible run of zero-width characters.
+func Encode(payload string) string {
+	var b strings.Builder
+	b.WriteString(markOpen)
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		for bit := 7; bit >= 0; bit-- {
+			if c&(1<<bit) != 0 {
+				b.WriteRune(one)
+			} else {
+				b.WriteRune(zero)
+			}
+		}
+	}
+	b.WriteString(markClose)
+	return b.String()
+}
+
+// Decode extracts every distinct payload hidden in text, in order of first
+// appearance. Runs damaged by editing are skipped.
+func Decode(text string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for {
+		i := strings.Index(text, markOpen)
+		if i < 0 {
+			return out
+		}
+		text = text[i+len(markOpen):]
+		j := strings.Index(text, markClose)
+		if j < 0 {
+			return out
+		}
+		if payload, ok := decodeBits(text[:j]); ok && !seen[payload] {
+			seen[payload] = true
+			out = append(out, payload)
+		}
+		text = text[j+len(markClose):]
+	}
+}
+
+func decodeBits(s string) (string, bool) {
+	var buf []byte
+	var cur byte
+	n := 0
+	for _, r := range s {
+		switch r {
+		case zero:
+			cur <<= 1
+		case one:
+			cur = cur<<1 | 1
+		default:
+			return "", false
+		}
+		if n++; n%8 == 0 {
+			buf = append(buf, cur)
+			cur = 0
+		}
+	}
+	if n%8 != 0 {
+		return "", false
+	}
+	return string(buf), true
+}
+
+// Fill replaces every Slot in page with the encoded mark.
+func Fill(page []byte, m Mark) []byte {
+	return []byte(strings.ReplaceAll(string(page), Slot, Encode(m.String())))
+}
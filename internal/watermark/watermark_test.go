@@ -0,0 +1,32 @@
+package watermark
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	at := time.Date(2025, 10, 16, 8, 0, 0, 0, time.UTC)
+	gen := Mark{Source: "群聊@chatroom", Time: at}
+	page := []byte("<p>今天" + Encode(gen.String()) + Slot + "的讨论</p><p>第二段" + Encode(gen.String()) + Slot + "</p>")
+	page = Fill(page, Mark{Viewer: "alice", Time: at})
+
+	got := Decode(string(page))
+	if len(got) != 2 {
+		t.Fatalf("decoded %d payloads, want 2: %q", len(got), got)
+	}
+	if m := ParseMark(got[0]); m.Source != gen.Source || !m.Time.Equal(at) {
+		t.Fatalf("generation mark = %+v", m)
+	}
+	if m := ParseMark(got[1]); m.Viewer != "alice" {
+		t.Fatalf("viewer mark = %+v", m)
+	}
+}
+
+func TestMarkEscapesSeparators(t *testing.T) {
+	m := Mark{Viewer: "bob;s=伪造群", Source: "a=b%3B;c"}
+	got := ParseMark(m.String())
+	if got.Viewer != m.Viewer || got.Source != m.Source {
+		t.Fatalf("round trip = %+v, want %+v", got, m)
+	}
+}